@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/domain/usecase"
+)
+
+type APIKeyGroup struct {
+	APIKeyService *usecase.APIKeyService
+}
+
+// swagger:route POST /users/{id}/api-keys apiKey createAPIKey
+//
+// Creates a new API key of a specific user for machine clients.
+// A key is limited to given scopes (permissions) and is shown only once.
+// API keys can not be managed with API keys.
+//
+// Consumes:
+// - application/json
+// Produces:
+// - application/json
+//
+// Responses:
+//   201: CreatedAPIKey
+//   400: errorResponse
+//   403: errorResponse
+//   500: errorResponse
+func (akg *APIKeyGroup) CreateAPIKey(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userID, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if err := checkOwner(ctx, userID); err != nil {
+		return err
+	}
+
+	var newKey entity.NewAPIKey
+	if err := decode(r, &newKey); err != nil {
+		return err
+	}
+
+	if err := validate(newKey); err != nil {
+		return err
+	}
+
+	key, err := akg.APIKeyService.Create(ctx, userID, newKey)
+	if err != nil {
+		return err
+	}
+
+	return respond(ctx, w, key, http.StatusCreated)
+}
+
+// swagger:route GET /users/{id}/api-keys apiKey listAPIKeys
+//
+// Gets API keys of a specific user, newest first. Keys themselves are never returned.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: []APIKey
+//   403: errorResponse
+//   500: errorResponse
+func (akg *APIKeyGroup) ListAPIKeys(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userID, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if err := checkOwner(ctx, userID); err != nil {
+		return err
+	}
+
+	keys, err := akg.APIKeyService.QueryByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return respond(ctx, w, keys, http.StatusOK)
+}
+
+// swagger:route DELETE /users/{id}/api-keys/{keyID} apiKey deleteAPIKey
+//
+// Revokes an API key of a specific user.
+//
+// Responses:
+//   204: emptyResponse
+//   403: errorResponse
+//   404: errorResponse
+//   500: errorResponse
+func (akg *APIKeyGroup) DeleteAPIKey(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userID, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	id, err := parseURLParamID(r, "keyID")
+	if err != nil {
+		return err
+	}
+
+	if err := checkOwner(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := akg.APIKeyService.Delete(ctx, userID, id); err != nil {
+		return err
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
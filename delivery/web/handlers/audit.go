@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/rtbe/clean-rest-api/domain/usecase"
+	"github.com/rtbe/clean-rest-api/internal/query"
+)
+
+type AuditGroup struct {
+	AuditService *usecase.AuditService
+}
+
+// auditFilters maps URL query parameters of audit log to filters of a list query.
+var auditFilters = []struct {
+	param string
+	field string
+	op    query.Operator
+}{
+	{param: "entity", field: "entity_type", op: query.Eq},
+	{param: "entity_id", field: "entity_id", op: query.Eq},
+	{param: "actor", field: "actor_id", op: query.Eq},
+	{param: "from", field: "date_created", op: query.Gte},
+	{param: "to", field: "date_created", op: query.Lt},
+}
+
+// swagger:route GET /audit audit listAuditRecords
+//
+// Gets a page of audit records, newest first.
+// Records can be filtered by type of a changed entity (entity=product), it`s id (entity_id),
+// a user that made a change (actor) and a period of time (from and to in RFC 3339 format, to is exclusive).
+// Size of a page is defined by limit parameter, next page can be requested with cursor parameter
+// which value is returned as next_cursor along with a page.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: listResponse
+//   400: errorResponse
+//   500: errorResponse
+func (adg *AuditGroup) ListAuditRecords(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	q, err := parseListQuery(r)
+	if err != nil {
+		return err
+	}
+
+	values := r.URL.Query()
+	for _, f := range auditFilters {
+		if v := values.Get(f.param); v != "" {
+			q.Filters = append(q.Filters, query.Filter{Field: f.field, Op: f.op, Value: v})
+		}
+	}
+
+	records, page, err := adg.AuditService.Query(ctx, q)
+	if err != nil {
+		return listQueryError(err)
+	}
+
+	return respond(ctx, w, listResponse{Data: records, Page: page}, http.StatusOK)
+}
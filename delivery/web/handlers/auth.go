@@ -1,13 +1,15 @@
 package handlers
 
 import (
-	"encoding/json"
+	"math"
+	"net"
 	"net/http"
-	"strings"
+	"strconv"
+
+	"github.com/pkg/errors"
 
 	"github.com/rtbe/clean-rest-api/domain/entity"
 	"github.com/rtbe/clean-rest-api/domain/usecase"
-	"github.com/rtbe/clean-rest-api/internal/validation"
 )
 
 type AuthGroup struct {
@@ -16,7 +18,7 @@ type AuthGroup struct {
 
 // swagger:route POST /auth/signup auth signUp
 //
-// Creates a new user.
+// Creates a new user and sends him an email verification token.
 //
 //
 // Consumes:
@@ -26,30 +28,27 @@ type AuthGroup struct {
 //
 // Responses:
 //   201: User
+//   400: errorResponse
+//   409: errorResponse
 //   500: errorResponse
 func (ag *AuthGroup) SignUp(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
 	var newUser entity.NewUser
-	err := json.NewDecoder(r.Body).Decode(&newUser)
-	if err != nil {
+	if err := decode(r, &newUser); err != nil {
 		return err
 	}
 
-	if err := validation.Check(newUser); err != nil {
-		return RequestError{
-			ErrorText: "validation error",
-			Fields:    err.Error(),
-			Status:    http.StatusBadRequest,
-		}
+	// Self registered users always get a basic role, other roles are granted by users with user:write permission.
+	newUser.Roles = []string{entity.UserRole}
+
+	if err := validate(newUser); err != nil {
+		return err
 	}
 
+	// A user name or an email that is already taken is reported as a conflict.
 	user, err := ag.AuthService.SignUp(ctx, newUser)
 	if err != nil {
-		// Check if user already registered
-		if strings.Contains(err.Error(), "duplicate") {
-			return nil
-		}
 		return err
 	}
 
@@ -59,6 +58,13 @@ func (ag *AuthGroup) SignUp(w http.ResponseWriter, r *http.Request) error {
 // swagger:route POST /auth/signin auth signIn
 //
 // Issues pair of access/refresh tokens.
+// Every sign in starts a new session, so a user can be signed in on several devices at once.
+// Optional device name helps a user to tell sessions apart.
+// Users that did not verify their email can not sign in if verification is required.
+// If a user has two-factor authentication enabled, only a challenge token is returned,
+// sign in should be completed with /auth/signin/2fa.
+// After failed attempts next ones with the same user name or from the same IP address
+// are slowed down with growing delays and an account is locked for a while after too many of them.
 //
 // Consumes:
 // - application/json
@@ -66,24 +72,75 @@ func (ag *AuthGroup) SignUp(w http.ResponseWriter, r *http.Request) error {
 // - application/json
 //
 // Responses:
-//   200: TokenPair
+//   200: SignInResult
+//   400: errorResponse
+//   401: errorResponse
+//   403: errorResponse
+//   429: errorResponse
 //   500: errorResponse
 func (ag *AuthGroup) SignIn(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
-	var decodedUser entity.User
-	err := json.NewDecoder(r.Body).Decode(&decodedUser)
+	var credentials entity.Credentials
+	if err := decode(r, &credentials); err != nil {
+		return err
+	}
+
+	if err := validate(credentials); err != nil {
+		return err
+	}
+
+	newSession := entity.NewSession{
+		Device:    credentials.Device,
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+	}
+
+	result, err := ag.AuthService.SignIn(ctx, credentials, newSession)
 	if err != nil {
+		return signInError(w, err)
+	}
+
+	return respond(ctx, w, result, http.StatusOK)
+}
+
+// swagger:route POST /auth/signin/2fa auth signInTwoFactor
+//
+// Exchanges a challenge token returned by sign in along with a code from an authenticator app
+// or a recovery code for a pair of access/refresh tokens.
+// A challenge token can be used only once, so a wrong code requires to sign in again.
+//
+// Consumes:
+// - application/json
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: TokenPair
+//   400: errorResponse
+//   401: errorResponse
+//   500: errorResponse
+func (ag *AuthGroup) SignInTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	var signIn entity.TwoFactorSignIn
+	if err := decode(r, &signIn); err != nil {
 		return err
 	}
 
-	tokenPair, err := ag.AuthService.SignIn(ctx, decodedUser)
+	if err := validate(signIn); err != nil {
+		return err
+	}
+
+	newSession := entity.NewSession{
+		Device:    signIn.Device,
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+	}
+
+	tokenPair, err := ag.AuthService.SignInTwoFactor(ctx, signIn.ChallengeToken, signIn.Code, newSession)
 	if err != nil {
-		// Check error if tokens already issued
-		if strings.Contains(err.Error(), "duplicate") {
-			return nil
-		}
-		return nil
+		return authError(err)
 	}
 
 	return respond(ctx, w, tokenPair, http.StatusOK)
@@ -91,7 +148,8 @@ func (ag *AuthGroup) SignIn(w http.ResponseWriter, r *http.Request) error {
 
 // swagger:route POST /auth/signout auth signOut
 //
-// Deletes a refresh token belonging to specific  user.
+// Ends all sessions belonging to specific user.
+// Attempts are throttled the same way sign in attempts are.
 //
 // Consumes:
 // - application/json
@@ -100,27 +158,34 @@ func (ag *AuthGroup) SignIn(w http.ResponseWriter, r *http.Request) error {
 //
 // Responses:
 //   204: emptyResponse
+//   400: errorResponse
+//   401: errorResponse
+//   429: errorResponse
 //   500: errorResponse
 func (ag *AuthGroup) SignOut(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
-	var decodedUser entity.User
-	err := json.NewDecoder(r.Body).Decode(&decodedUser)
-	if err != nil {
+	var credentials entity.Credentials
+	if err := decode(r, &credentials); err != nil {
 		return err
 	}
 
-	err = ag.AuthService.SignOut(ctx, decodedUser)
-	if err != nil {
+	if err := validate(credentials); err != nil {
 		return err
 	}
 
+	if err := ag.AuthService.SignOut(ctx, credentials, clientIP(r)); err != nil {
+		return signInError(w, err)
+	}
+
 	return respond(ctx, w, nil, http.StatusNoContent)
 }
 
-// swagger:route POST /refreshTokens auth refreshTokens
+// swagger:route POST /auth/refresh auth refreshTokens
 //
-// Receives pair of access/refresh tokens and returns fresh pair.
+// Receives a refresh token and returns fresh pair of access/refresh tokens.
+// Presented refresh token can not be used again,
+// reuse of it revokes all tokens issued since the sign in.
 //
 // Consumes:
 // - application/json
@@ -129,36 +194,217 @@ func (ag *AuthGroup) SignOut(w http.ResponseWriter, r *http.Request) error {
 //
 // Responses:
 //   200: TokenPair
+//   400: errorResponse
+//   401: errorResponse
 //   500: errorResponse
 func (ag *AuthGroup) RefreshTokens(w http.ResponseWriter, r *http.Request) error {
-	//ctx := r.Context()
+	ctx := r.Context()
 
-	var decodedTokenPair entity.TokenPair
-	err := json.NewDecoder(r.Body).Decode(&decodedTokenPair)
-	if err != nil {
+	var refreshRequest entity.RefreshRequest
+	if err := decode(r, &refreshRequest); err != nil {
 		return err
 	}
 
-	accessToken := decodedTokenPair.AccessToken
-	accessTokenClaims, err := entity.ParseAccessTokenClaims(accessToken)
+	if err := validate(refreshRequest); err != nil {
+		return err
+	}
+
+	tokenPair, err := ag.AuthService.Refresh(ctx, refreshRequest.RefreshToken)
 	if err != nil {
+		return authError(err)
+	}
+
+	return respond(ctx, w, tokenPair, http.StatusOK)
+}
+
+// swagger:route POST /auth/password/forgot auth forgotPassword
+//
+// Sends a password reset token to a user with given email.
+// Response does not tell whether a user with that email exists.
+//
+// Consumes:
+// - application/json
+//
+// Responses:
+//   204: emptyResponse
+//   400: errorResponse
+//   500: errorResponse
+func (ag *AuthGroup) ForgotPassword(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	var forgotRequest entity.ForgotPasswordRequest
+	if err := decode(r, &forgotRequest); err != nil {
+		return err
+	}
+
+	if err := validate(forgotRequest); err != nil {
+		return err
+	}
+
+	if err := ag.AuthService.ForgotPassword(ctx, forgotRequest.Email); err != nil {
+		return err
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// swagger:route POST /auth/password/reset auth resetPassword
+//
+// Sets a new password of a user with a password reset token.
+// Token can be used only once, all sessions of a user are ended.
+//
+// Consumes:
+// - application/json
+//
+// Responses:
+//   204: emptyResponse
+//   400: errorResponse
+//   500: errorResponse
+func (ag *AuthGroup) ResetPassword(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	var resetRequest entity.ResetPasswordRequest
+	if err := decode(r, &resetRequest); err != nil {
+		return err
+	}
+
+	if err := validate(resetRequest); err != nil {
+		return err
+	}
+
+	if err := ag.AuthService.ResetPassword(ctx, resetRequest.Token, resetRequest.Password); err != nil {
+		return authError(err)
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// swagger:route POST /auth/email/verify auth verifyEmail
+//
+// Confirms an email of a user with an email verification token.
+//
+// Consumes:
+// - application/json
+//
+// Responses:
+//   204: emptyResponse
+//   400: errorResponse
+//   500: errorResponse
+func (ag *AuthGroup) VerifyEmail(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	var verifyRequest entity.VerifyEmailRequest
+	if err := decode(r, &verifyRequest); err != nil {
+		return err
+	}
+
+	if err := validate(verifyRequest); err != nil {
+		return err
+	}
+
+	if err := ag.AuthService.VerifyEmail(ctx, verifyRequest.Token); err != nil {
+		return authError(err)
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// swagger:route POST /auth/email/resend auth resendVerification
+//
+// Sends a new email verification token to a user with given email.
+// Response does not tell whether a user with that email exists.
+//
+// Consumes:
+// - application/json
+//
+// Responses:
+//   204: emptyResponse
+//   400: errorResponse
+//   500: errorResponse
+func (ag *AuthGroup) ResendVerification(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	var resendRequest entity.ResendVerificationRequest
+	if err := decode(r, &resendRequest); err != nil {
+		return err
+	}
+
+	if err := validate(resendRequest); err != nil {
+		return err
+	}
+
+	if err := ag.AuthService.ResendVerification(ctx, resendRequest.Email); err != nil {
 		return err
 	}
 
-	refreshToken := decodedTokenPair.RefreshToken
-	refreshTokenClaims, err := entity.ParseRefreshTokenClaims(refreshToken)
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// swagger:route POST /users/{id}/unlock auth unlockUser
+//
+// Unlocks an account of a specific user locked after too many failed sign in attempts.
+// Attempts made from IP addresses stay counted.
+//
+// Responses:
+//   204: emptyResponse
+//   400: errorResponse
+//   403: errorResponse
+//   404: errorResponse
+//   500: errorResponse
+func (ag *AuthGroup) UnlockUser(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userID, err := parseURLParamID(r, "id")
 	if err != nil {
 		return err
 	}
-	if accessTokenClaims.Refresh_uuid != refreshTokenClaims.UUID {
+
+	if err := checkOwner(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := ag.AuthService.Unlock(ctx, userID); err != nil {
 		return err
 	}
 
-	//respTokenPair, err := ag.AuthService.Refresh(ctx, &entity.JWTTokenPair{AccessToken: refreshTokenClaims})
-	//if err != nil {
-	//	return err
-	//}
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// signInError turns throttled sign in attempts into too many requests responses
+// that tell a client when to retry, other errors are handled by authError.
+func signInError(w http.ResponseWriter, err error) error {
+	var tooMany *usecase.TooManyAttemptsError
+	if !errors.As(err, &tooMany) {
+		return authError(err)
+	}
+
+	seconds := int(math.Ceil(tooMany.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
 
-	return nil
-	//return respond(ctx, w, respTokenPair, http.StatusOK)
+	return RequestError{
+		ErrorText: usecase.ErrTooManyAttempts.Error(),
+		Status:    http.StatusTooManyRequests,
+	}
+}
+
+// authError turns authentication errors that have different kinds depending on a request
+// into unauthorized or validation errors, errors of other kinds are presented as is.
+func authError(err error) error {
+	switch errors.Cause(err) {
+	case usecase.ErrInvalidTwoFactorCode:
+		return entity.UnauthorizedError(usecase.ErrInvalidTwoFactorCode.Error())
+	case usecase.ErrInvalidActionToken:
+		return &entity.ValidationError{Msg: usecase.ErrInvalidActionToken.Error()}
+	default:
+		return err
+	}
+}
+
+// clientIP returns an IP address a request came from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	mid "github.com/rtbe/clean-rest-api/delivery/web/middlewares"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/domain/usecase"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+	"github.com/rtbe/clean-rest-api/internal/mail"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+	actiontoken "github.com/rtbe/clean-rest-api/repository/action_token"
+	"github.com/rtbe/clean-rest-api/repository/audit"
+	"github.com/rtbe/clean-rest-api/repository/auth"
+	loginattempt "github.com/rtbe/clean-rest-api/repository/login_attempt"
+	"github.com/rtbe/clean-rest-api/repository/order"
+	orderitem "github.com/rtbe/clean-rest-api/repository/order_item"
+	"github.com/rtbe/clean-rest-api/repository/outbox"
+	"github.com/rtbe/clean-rest-api/repository/session"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
+	twofactor "github.com/rtbe/clean-rest-api/repository/two_factor"
+	"github.com/rtbe/clean-rest-api/repository/user"
+)
+
+// newAuthRouter creates a router of sign in and unlock routes on top of in-memory repositories.
+// Requests to unlock are made on behalf of a user with roles from X-Roles header.
+func newAuthRouter(cfg usecase.AuthConfig) (http.Handler, *usecase.UserService) {
+	users := usecase.NewUserService(user.NewInMemRepo(nil), order.NewInMemRepo(), orderitem.NewInMemRepo(nil), outbox.NewInMemRepo(), transaction.NewInMemManager(), usecase.NewAuditService(audit.NewInMemRepo()))
+	twoFactor := usecase.NewTwoFactorService(twofactor.NewInMemRepo(), users, "test")
+	authService := usecase.NewAuthService(auth.NewInMemRepo(), session.NewInMemRepo(), actiontoken.NewInMemRepo(), loginattempt.NewInMemRepo(), users, twoFactor, mail.NewInMemMailer(), cfg)
+	ag := AuthGroup{AuthService: authService}
+
+	// claims stands for Authenticate middleware.
+	claims := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := &entity.AccessTokenClaims{User_id: "admin", User_roles: strings.Split(r.Header.Get("X-Roles"), ",")}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), mid.ClaimsKey, c)))
+		})
+	}
+
+	r := chi.NewRouter()
+	r.Use(mid.RequestInfo)
+	r.Method(http.MethodPost, "/auth/signin", Handler{H: ag.SignIn, L: logger.Nop()})
+	r.With(claims, mid.RequirePermission(entity.DefaultRolePermissions(), entity.PermissionUserUnlock)).
+		Method(http.MethodPost, "/users/{id}/unlock", Handler{H: ag.UnlockUser, L: logger.Nop()})
+
+	return r, users
+}
+
+func TestAuthGroup(t *testing.T) {
+	router, users := newAuthRouter(usecase.AuthConfig{
+		UserNameThrottle: entity.LoginThrottle{MaxFailures: 2, BackoffBase: time.Minute, Lockout: time.Hour, Window: time.Hour},
+		IPThrottle:       entity.LoginThrottle{MaxFailures: 100, BackoffBase: time.Minute, Lockout: time.Hour, Window: time.Hour},
+	})
+
+	u, err := users.Create(context.Background(), entity.NewUser{
+		UserName:        "alan",
+		Email:           "alan@example.com",
+		Password:        "OOP_is_about_messages",
+		PasswordConfirm: "OOP_is_about_messages",
+	})
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to create a user. Error: %s", tests.Failed, err)
+	}
+
+	signIn := func(password string) *http.Response {
+		body := `{"user_name":"alan","password":"` + password + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/auth/signin", strings.NewReader(body))
+		req.RemoteAddr = "10.0.0.1:1000"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+
+	unlock := func(roles string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/users/"+u.ID+"/unlock", nil)
+		req.Header.Set("X-Roles", roles)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+
+	t.Run("Given the need to lock an account after failed sign in attempts", func(t *testing.T) {
+		tt := []struct {
+			name       string
+			do         func() *http.Response
+			statusCode int
+		}{
+			{name: "free failure", do: func() *http.Response { return signIn("wrong") }, statusCode: http.StatusUnauthorized},
+			{name: "failure that locks an account", do: func() *http.Response { return signIn("wrong") }, statusCode: http.StatusUnauthorized},
+			{name: "attempt to a locked account", do: func() *http.Response { return signIn("OOP_is_about_messages") }, statusCode: http.StatusTooManyRequests},
+			{name: "unlock without a permission", do: func() *http.Response { return unlock(entity.UserRole) }, statusCode: http.StatusForbidden},
+			{name: "attempt while still locked", do: func() *http.Response { return signIn("OOP_is_about_messages") }, statusCode: http.StatusTooManyRequests},
+			{name: "unlock by an admin", do: func() *http.Response { return unlock(entity.AdminRole) }, statusCode: http.StatusNoContent},
+			{name: "attempt after unlock", do: func() *http.Response { return signIn("OOP_is_about_messages") }, statusCode: http.StatusOK},
+		}
+		for _, tc := range tt {
+			t.Run(tc.name, func(t *testing.T) {
+				res := tc.do()
+				defer res.Body.Close()
+
+				if res.StatusCode != tc.statusCode {
+					t.Fatalf("\t%s\tTest %s:\tWant status code: %d, got status code: %d", tests.Failed, tc.name, tc.statusCode, res.StatusCode)
+				}
+				t.Logf("\t%s\tTest %s:\tShould be able to receive appropriate status code", tests.Success, tc.name)
+
+				if res.StatusCode != http.StatusTooManyRequests {
+					return
+				}
+
+				seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+				if err != nil || seconds < 1 || seconds > 3600 {
+					t.Fatalf("\t%s\tTest %s:\tWant Retry-After within a lockout, got: %q", tests.Failed, tc.name, res.Header.Get("Retry-After"))
+				}
+				var p problem
+				if err := json.NewDecoder(res.Body).Decode(&p); err != nil || p.Status != http.StatusTooManyRequests {
+					t.Fatalf("\t%s\tTest %s:\tWant too many requests problem, got: %+v, error: %v", tests.Failed, tc.name, p, err)
+				}
+				t.Logf("\t%s\tTest %s:\tShould tell when to retry.", tests.Success, tc.name)
+			})
+		}
+	})
+}
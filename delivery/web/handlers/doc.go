@@ -1,5 +1,7 @@
 package handlers
 
+import "github.com/rtbe/clean-rest-api/internal/keys"
+
 // package handlers REST API
 //
 // Documentation of web API
@@ -17,17 +19,62 @@ package handlers
 //
 //  swagger:meta
 
-// Error response
+// Error response in RFC 7807 problem details format (application/problem+json)
 // swagger:response errorResponse
 type errorResponse struct {
 	// Error response message
 	//
 	// in: body
 	Body struct {
-		// Example: There are some error
+		// URI of a kind of a problem
+		//
+		// Example: /problems/not-found
+		Type string `json:"type"`
+
+		// Short summary of a kind of a problem
+		//
+		// Example: Resource is not found
+		Title string `json:"title"`
+
+		// HTTP status code
+		//
+		// Example: 404
+		Status int `json:"status"`
+
+		// Explanation of this occurrence of a problem
+		//
+		// Example: getting a user with id 7c6a6a3e-4d8e-4a43-9bde-1a6bd8a4d1a8: not found
+		Detail string `json:"detail,omitempty"`
+
+		// ID of a request a problem occurred in
+		//
+		Instance string `json:"instance,omitempty"`
+
+		// Invalid fields of request data
+		//
+		Fields []struct {
+			Field string `json:"field"`
+			Error string `json:"error"`
+		} `json:"fields,omitempty"`
+	}
+}
+
+// Page of items
+// swagger:response listResponse
+type listResponseDoc struct {
+	// in: body
+	Body struct {
+		// Items of a page
+		//
+		Data []interface{} `json:"data"`
+
+		// Cursor of a next page, empty if there are no more items
+		//
+		NextCursor string `json:"next_cursor,omitempty"`
+
+		// Whether there are more items after this page
 		//
-		Error  string `json:"error"`
-		Fields string `json:"fields,omitempty"`
+		HasMore bool `json:"has_more"`
 	}
 }
 
@@ -48,3 +95,10 @@ type statusResponse struct {
 		Host   string `json:"host"`
 	}
 }
+
+// JSON Web Key Set
+// swagger:response jwksResponse
+type jwksResponse struct {
+	// in: body
+	Body keys.JWKS
+}
@@ -2,12 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/validation"
 )
 
 // RequestError is our known error that will be presented to an app user.
+// It is used for errors that are specific to HTTP and do not have a domain error kind,
+// domain errors are presented by their kind, see problemOf.
 type RequestError struct {
 	ErrorText string `json:"error"`
-	Fields    string `json:"fields,omitempty"`
 	Status    int    `json:"status_code"`
 }
 
@@ -20,3 +26,86 @@ func (re RequestError) Error() string {
 
 	return string(data)
 }
+
+// problemTypeBase is a base of URIs that identify kinds of problems.
+// It is relative, so it is resolved against an address an API is served on.
+const problemTypeBase = "/problems/"
+
+// problem is a description of an error presented to an app user in RFC 7807 format.
+type problem struct {
+	Type     string                 `json:"type"`
+	Title    string                 `json:"title"`
+	Status   int                    `json:"status"`
+	Detail   string                 `json:"detail,omitempty"`
+	Instance string                 `json:"instance,omitempty"`
+	Fields   validation.FieldErrors `json:"fields,omitempty"`
+}
+
+// problemOf describes an error as a problem by it`s kind.
+// Details of authentication errors are limited to their cause, so a client does not learn why exactly it failed.
+// Unknown errors are described as internal server errors without any details,
+// so internals of an app are not revealed.
+func problemOf(err error) problem {
+	switch cause := errors.Cause(err).(type) {
+	case RequestError:
+		return problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(cause.Status),
+			Status: cause.Status,
+			Detail: cause.ErrorText,
+		}
+	case *entity.ValidationError:
+		p := problem{
+			Type:   problemTypeBase + "validation",
+			Title:  "Request data is invalid",
+			Status: http.StatusBadRequest,
+			Detail: err.Error(),
+			Fields: cause.Fields,
+		}
+		if len(cause.Fields) != 0 {
+			p.Detail = cause.Msg
+		}
+		return p
+	case entity.NotFoundError:
+		return problem{
+			Type:   problemTypeBase + "not-found",
+			Title:  "Resource is not found",
+			Status: http.StatusNotFound,
+			Detail: err.Error(),
+		}
+	case entity.ConflictError:
+		return problem{
+			Type:   problemTypeBase + "conflict",
+			Title:  "Request conflicts with current state of a resource",
+			Status: http.StatusConflict,
+			Detail: err.Error(),
+		}
+	case entity.PreconditionFailedError:
+		return problem{
+			Type:   problemTypeBase + "precondition-failed",
+			Title:  "Resource was changed, get it`s current version and try again",
+			Status: http.StatusPreconditionFailed,
+			Detail: err.Error(),
+		}
+	case entity.UnauthorizedError:
+		return problem{
+			Type:   problemTypeBase + "unauthorized",
+			Title:  "Authentication failed",
+			Status: http.StatusUnauthorized,
+			Detail: cause.Error(),
+		}
+	case entity.ForbiddenError:
+		return problem{
+			Type:   problemTypeBase + "forbidden",
+			Title:  "Access is forbidden",
+			Status: http.StatusForbidden,
+			Detail: cause.Error(),
+		}
+	default:
+		return problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(http.StatusInternalServerError),
+			Status: http.StatusInternalServerError,
+		}
+	}
+}
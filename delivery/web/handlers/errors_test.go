@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	mid "github.com/rtbe/clean-rest-api/delivery/web/middlewares"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+	"github.com/rtbe/clean-rest-api/internal/validation"
+)
+
+func TestProblemOf(t *testing.T) {
+	tt := []struct {
+		name   string
+		err    error
+		status int
+		kind   string
+		detail string
+		fields int
+	}{
+		{
+			name:   "Request error",
+			err:    RequestError{ErrorText: "too many requests", Status: http.StatusTooManyRequests},
+			status: http.StatusTooManyRequests,
+			kind:   "about:blank",
+			detail: "too many requests",
+		},
+		{
+			name: "Validation error of fields",
+			err: entity.NewValidationError(validation.FieldErrors{
+				{Field: "email", Error: "email is required"},
+				{Field: "password", Error: "password is required"},
+			}),
+			status: http.StatusBadRequest,
+			kind:   problemTypeBase + "validation",
+			detail: "validation error",
+			fields: 2,
+		},
+		{
+			name:   "Validation error without fields",
+			err:    errors.Wrap(&entity.ValidationError{Msg: "request body is empty"}, "decoding"),
+			status: http.StatusBadRequest,
+			kind:   problemTypeBase + "validation",
+			detail: "decoding: request body is empty",
+		},
+		{
+			name:   "Not found error",
+			err:    errors.Wrap(entity.NotFoundError("not found"), "ID: 1"),
+			status: http.StatusNotFound,
+			kind:   problemTypeBase + "not-found",
+			detail: "ID: 1: not found",
+		},
+		{
+			name:   "Conflict error",
+			err:    entity.ConflictError("duplicate key"),
+			status: http.StatusConflict,
+			kind:   problemTypeBase + "conflict",
+			detail: "duplicate key",
+		},
+		{
+			name:   "Precondition failed error",
+			err:    entity.PreconditionFailedError("version conflict"),
+			status: http.StatusPreconditionFailed,
+			kind:   problemTypeBase + "precondition-failed",
+			detail: "version conflict",
+		},
+		{
+			name:   "Unauthorized error",
+			err:    errors.Wrap(entity.UnauthorizedError("invalid credentials"), "user alan has wrong password"),
+			status: http.StatusUnauthorized,
+			kind:   problemTypeBase + "unauthorized",
+			detail: "invalid credentials",
+		},
+		{
+			name:   "Forbidden error",
+			err:    errors.Wrap(entity.ForbiddenError("access is forbidden"), "user alan is not an admin"),
+			status: http.StatusForbidden,
+			kind:   problemTypeBase + "forbidden",
+			detail: "access is forbidden",
+		},
+		{
+			name:   "Unknown error",
+			err:    errors.New("connection refused"),
+			status: http.StatusInternalServerError,
+			kind:   "about:blank",
+		},
+	}
+
+	for testID, tc := range tt {
+		p := problemOf(tc.err)
+		if p.Status != tc.status || p.Type != tc.kind || p.Detail != tc.detail || len(p.Fields) != tc.fields {
+			t.Fatalf("\t%s\tTest %d:\tWant status: %d, type: %s, detail: %q, fields: %d, got: %+v", tests.Failed, testID, tc.status, tc.kind, tc.detail, tc.fields, p)
+		}
+		t.Logf("\t%s\tTest %d:\t%s: should be presented as %d.", tests.Success, testID, tc.name, tc.status)
+	}
+}
+
+func TestHandlerDecodeProblem(t *testing.T) {
+	handler := Handler{
+		H: func(w http.ResponseWriter, r *http.Request) error {
+			var newProduct entity.NewProduct
+			if err := decode(r, &newProduct); err != nil {
+				return err
+			}
+			return respond(r.Context(), w, nil, http.StatusNoContent)
+		},
+		L: logger.Nop(),
+	}
+
+	tt := []struct {
+		name   string
+		body   string
+		status int
+		field  string
+	}{
+		{name: "Valid body", body: `{"title":"product","price":"10.20","stock":1}`, status: http.StatusNoContent},
+		{name: "Empty body", body: "", status: http.StatusBadRequest},
+		{name: "Malformed JSON", body: `{"title":`, status: http.StatusBadRequest},
+		{name: "Wrong type of a field", body: `{"stock":"many"}`, status: http.StatusBadRequest, field: "stock"},
+		{name: "Invalid money", body: `{"price":"10.201"}`, status: http.StatusBadRequest},
+	}
+
+	for testID, tc := range tt {
+		info := mid.Request{ID: "request-id"}
+		req := httptest.NewRequest(http.MethodPost, "/products/", strings.NewReader(tc.body))
+		req = req.WithContext(context.WithValue(req.Context(), mid.RequestKey, &info))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tc.status {
+			t.Fatalf("\t%s\tTest %d:\tWant status code: %d, got: %d", tests.Failed, testID, tc.status, rec.Code)
+		}
+		if tc.status == http.StatusBadRequest {
+			var p problem
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to decode a problem. Error: %s", tests.Failed, testID, err)
+			}
+			if p.Instance != info.ID || p.Detail == "" {
+				t.Fatalf("\t%s\tTest %d:\tWant a problem of request %s with details, got: %+v", tests.Failed, testID, info.ID, p)
+			}
+			if tc.field != "" && (len(p.Fields) != 1 || p.Fields[0].Field != tc.field) {
+				t.Fatalf("\t%s\tTest %d:\tWant an error of field %s, got: %+v", tests.Failed, testID, tc.field, p.Fields)
+			}
+		}
+		t.Logf("\t%s\tTest %d:\t%s: should respond with %d.", tests.Success, testID, tc.name, tc.status)
+	}
+}
@@ -4,13 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	mid "github.com/rtbe/clean-rest-api/delivery/web/middlewares"
+	"github.com/rtbe/clean-rest-api/domain/entity"
 	"github.com/rtbe/clean-rest-api/internal/logger"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/internal/validation"
 )
 
 // Handler is a handler function so we can return an error from request handling functions.
@@ -29,47 +35,38 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Centralize error handling from handlerFunc here.
 	if err := h.H(w, r); err != nil {
+		l := logger.FromContextOr(ctx, h.L)
+
 		info, e := mid.GetRequestInfo(r.Context())
 		if e != nil {
-			h.L.Log("error", fmt.Sprintf(
-				"%s: GETTING REQUEST INFO: %v ",
-				info.ID, err.Error(),
-			))
+			l.Error("getting request info", logger.Err(e), logger.String("request_error", err.Error()))
 			return
 		}
 
-		// Customize handling of known and unknown errors.
-		switch err := errors.Cause(err).(type) {
-
-		// Known error handling.
-		case RequestError:
-			info.StatusCode = err.Status
-			if err := respond(ctx, w, err, err.Status); err != nil {
-				h.L.Log("error", fmt.Sprintf(
-					"responding with error: %v",
-					err.Error(),
-				))
-			}
-
-			// Unknown error handling.
-		default:
-			e := RequestError{
-				ErrorText: http.StatusText(http.StatusInternalServerError),
-			}
-			info.StatusCode = http.StatusInternalServerError
-
-			if err := respond(ctx, w, e, http.StatusInternalServerError); err != nil {
-				h.L.Log("error", fmt.Sprintf(
-					"responding with error: %v",
-					err.Error(),
-				))
-			}
+		// Known and unknown errors are presented as problems of their kind.
+		p := problemOf(err)
+		p.Instance = info.ID
+
+		// Details of unknown errors are not shown to a client, so they are logged instead.
+		if p.Status >= http.StatusInternalServerError {
+			l.Error("handling a request", logger.Err(err))
+		} else {
+			l.Debug("request failed", logger.Int("status", p.Status), logger.Err(err))
+		}
+
+		if err := respondWithType(ctx, w, p, p.Status, "application/problem+json"); err != nil {
+			l.Error("responding with error", logger.Err(err))
 		}
 	}
 }
 
 // respond is a helper function for handling json responses.
 func respond(ctx context.Context, w http.ResponseWriter, data interface{}, statusCode int) error {
+	return respondWithType(ctx, w, data, statusCode, "application/json")
+}
+
+// respondWithType responds with data encoded as json and marked with given content type.
+func respondWithType(ctx context.Context, w http.ResponseWriter, data interface{}, statusCode int, contentType string) error {
 
 	// Set status code of request into it's context for logging it later.
 	requestInfo, err := mid.GetRequestInfo(ctx)
@@ -78,7 +75,7 @@ func respond(ctx context.Context, w http.ResponseWriter, data interface{}, statu
 	}
 	requestInfo.StatusCode = statusCode
 
-	if statusCode == http.StatusNoContent {
+	if statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
 		w.WriteHeader(statusCode)
 		return nil
 	}
@@ -87,7 +84,7 @@ func respond(ctx context.Context, w http.ResponseWriter, data interface{}, statu
 	if err != nil {
 		return err
 	}
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", contentType)
 
 	w.WriteHeader(statusCode)
 
@@ -98,6 +95,41 @@ func respond(ctx context.Context, w http.ResponseWriter, data interface{}, statu
 	return nil
 }
 
+// validate checks incoming data and turns errors of it`s fields into validation error.
+func validate(v interface{}) error {
+	err := validation.Check(v)
+	if fields, ok := err.(*validation.FieldErrors); ok {
+		return entity.NewValidationError(*fields)
+	}
+
+	return err
+}
+
+// decode decodes a JSON body of a request into v.
+// A body that can not be decoded is a mistake of a client, so it is reported as validation error,
+// with a field it is about if it is known.
+func decode(r *http.Request, v interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return nil
+	}
+
+	switch cause := errors.Cause(err).(type) {
+	case *json.UnmarshalTypeError:
+		return entity.NewValidationError(validation.FieldErrors{
+			{Field: cause.Field, Error: cause.Field + " must be " + cause.Type.String()},
+		})
+	case *json.SyntaxError:
+		return &entity.ValidationError{Msg: "request body is not valid JSON: " + cause.Error()}
+	}
+
+	if errors.Cause(err) == io.EOF {
+		return &entity.ValidationError{Msg: "request body is empty"}
+	}
+
+	return &entity.ValidationError{Msg: "request body can not be decoded: " + err.Error()}
+}
+
 // parseURLParamID gets value from URL by it's key and checks if it's validity to UUID format.
 func parseURLParamID(r *http.Request, key string) (string, error) {
 	v := chi.URLParam(r, key)
@@ -107,11 +139,111 @@ func parseURLParamID(r *http.Request, key string) (string, error) {
 	}
 
 	if _, err := uuid.Parse(v); err != nil {
-		return "", RequestError{
-			ErrorText: "id is not in UUID format",
-			Status:    http.StatusBadRequest,
+		return "", entity.NewValidationError(validation.FieldErrors{
+			{Field: key, Error: key + " is not in UUID format"},
+		})
+	}
+
+	return v, nil
+}
+
+// listResponse is a page of items returned by list requests along with pagination metadata.
+type listResponse struct {
+	Data interface{} `json:"data"`
+	query.Page
+}
+
+// parseListQuery gets list query (filters, sort order, limit and cursor) from URL query parameters.
+func parseListQuery(r *http.Request) (query.Query, error) {
+	q, err := query.Parse(r.URL.Query())
+	if err != nil {
+		return query.Query{}, listQueryError(err)
+	}
+
+	return q, nil
+}
+
+// listQueryError converts an error caused by invalid list query into validation error.
+func listQueryError(err error) error {
+	if errors.Cause(err) != query.ErrInvalidQuery {
+		return err
+	}
+
+	return &entity.ValidationError{Msg: err.Error()}
+}
+
+// checkOwner forbids access to a resource of other user
+// if access granted to a request is limited to resources owned by a user.
+func checkOwner(ctx context.Context, ownerID string) error {
+	access, err := mid.GetAccess(ctx)
+	if err != nil {
+		return err
+	}
+
+	if access.Own && access.UserID != ownerID {
+		return entity.ForbiddenError("access to resources of other users is forbidden")
+	}
+
+	return nil
+}
+
+// restrictToOwner narrows down list query to resources owned by a user
+// if access granted to a request is limited to them.
+func restrictToOwner(ctx context.Context, q query.Query, ownerField string) (query.Query, error) {
+	access, err := mid.GetAccess(ctx)
+	if err != nil {
+		return query.Query{}, err
+	}
+
+	if access.Own {
+		q.Filters = append(q.Filters, query.Filter{Field: ownerField, Op: query.Eq, Value: access.UserID})
+	}
+
+	return q, nil
+}
+
+// etag returns an entity tag of particular version of a resource.
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// checkETag sets ETag header of a resource with given version
+// and reports whether a client already has that version according to If-None-Match header,
+// so a resource does not have to be sent again.
+func checkETag(w http.ResponseWriter, r *http.Request, version int) bool {
+	tag := etag(version)
+	w.Header().Set("ETag", tag)
+
+	for _, t := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			return true
 		}
 	}
 
-	return "", nil
+	return false
+}
+
+// parseIfMatch gets a version of a resource a change is based on from If-Match header.
+// The header is required, so a resource can not be changed by a client that has not seen it`s current version.
+// Any version is matched by "*", which is returned as zero.
+func parseIfMatch(r *http.Request) (int, error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" {
+		return 0, RequestError{
+			ErrorText: "header 'If-Match' is required",
+			Status:    http.StatusPreconditionRequired,
+		}
+	}
+	if v == "*" {
+		return 0, nil
+	}
+
+	// Entity tags are strong, so a weak one or a tag that was not issued by an app never matches.
+	version, err := strconv.Atoi(strings.Trim(v, `"`))
+	if err != nil || version <= 0 || v != etag(version) {
+		return 0, entity.PreconditionFailedError("header 'If-Match' does not match current version of a resource")
+	}
+
+	return version, nil
 }
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/rtbe/clean-rest-api/internal/keys"
+)
+
+type KeysGroup struct {
+	Keys *keys.Set
+}
+
+// swagger:route GET /.well-known/jwks.json keys jwks
+//
+// Gets public keys access tokens are signed with in JSON Web Key Set format,
+// so other services can verify tokens without calling the application.
+// Tokens point to a key they are signed with by "kid" header.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: jwksResponse
+func (kg KeysGroup) JWKS(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	// Keys change rarely, so clients can cache them for a while,
+	// new keys should be published before they are used for signing.
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	return respond(ctx, w, kg.Keys.JWKS(), http.StatusOK)
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	mid "github.com/rtbe/clean-rest-api/delivery/web/middlewares"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/domain/usecase"
+	"github.com/rtbe/clean-rest-api/internal/validation"
+)
+
+// oidcStateCookie binds a login through identity provider to a browser it was started in.
+const oidcStateCookie = "oidc_state"
+
+type OIDCGroup struct {
+	OIDCService *usecase.OIDCService
+}
+
+// swagger:route GET /auth/oidc/{provider}/login oidc oidcLogin
+//
+// Redirects a user to external identity provider to sign in with it.
+//
+// Responses:
+//   302: emptyResponse
+//   404: errorResponse
+//   500: errorResponse
+func (og *OIDCGroup) Login(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	authURL, state, err := og.OIDCService.Login(ctx, chi.URLParam(r, "provider"))
+	if err != nil {
+		return oidcError(err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	requestInfo, err := mid.GetRequestInfo(ctx)
+	if err != nil {
+		return err
+	}
+	requestInfo.StatusCode = http.StatusFound
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+	return nil
+}
+
+// swagger:route GET /auth/oidc/{provider}/callback oidc oidcCallback
+//
+// Completes sign in with external identity provider and issues pair of access/refresh tokens.
+// An identity is linked to a user with the same email if both a provider and a user verified it,
+// otherwise a new user is created.
+// If a user has two-factor authentication enabled, only a challenge token is returned,
+// sign in should be completed with /auth/signin/2fa.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: SignInResult
+//   400: errorResponse
+//   401: errorResponse
+//   403: errorResponse
+//   404: errorResponse
+//   409: errorResponse
+//   500: errorResponse
+func (og *OIDCGroup) Callback(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	// Login is over whatever the outcome is.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/auth/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	if e := q.Get("error"); e != "" {
+		return errors.Wrap(usecase.ErrExternalAuthFailed, e)
+	}
+
+	state := q.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		return oidcError(usecase.ErrInvalidOIDCState)
+	}
+
+	newSession := entity.NewSession{
+		Device:    q.Get("device"),
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+	}
+
+	result, err := og.OIDCService.Callback(ctx, chi.URLParam(r, "provider"), state, q.Get("code"), newSession)
+	if err != nil {
+		return oidcError(err)
+	}
+
+	return respond(ctx, w, result, http.StatusOK)
+}
+
+// oidcError turns an unknown or expired login state into validation error of a state,
+// other errors are handled by authError.
+func oidcError(err error) error {
+	if errors.Cause(err) != usecase.ErrInvalidOIDCState {
+		return authError(err)
+	}
+
+	return entity.NewValidationError(validation.FieldErrors{
+		{Field: "state", Error: usecase.ErrInvalidOIDCState.Error()},
+	})
+}
@@ -1,15 +1,13 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
 	"net/http"
 
-	"github.com/go-chi/chi"
 	"github.com/pkg/errors"
+	mid "github.com/rtbe/clean-rest-api/delivery/web/middlewares"
 	"github.com/rtbe/clean-rest-api/domain/entity"
 	"github.com/rtbe/clean-rest-api/domain/usecase"
-	"github.com/rtbe/clean-rest-api/internal/database"
-	"github.com/rtbe/clean-rest-api/internal/validation"
 )
 
 type OrderGroup struct {
@@ -20,6 +18,7 @@ type OrderGroup struct {
 //
 // Creates a new order
 // .
+// Retries of a request with the same Idempotency-Key header get the first response again.
 //
 // Consumes:
 // - application/json
@@ -33,16 +32,16 @@ func (og *OrderGroup) CreateOrder(w http.ResponseWriter, r *http.Request) error
 	ctx := r.Context()
 
 	var newOrder entity.NewOrder
-	if err := json.NewDecoder(r.Body).Decode(&newOrder); err != nil {
+	if err := decode(r, &newOrder); err != nil {
 		return err
 	}
 
-	if err := validation.Check(newOrder); err != nil {
-		return RequestError{
-			ErrorText: "validation error",
-			Fields:    err.Error(),
-			Status:    http.StatusBadRequest,
-		}
+	if err := validate(newOrder); err != nil {
+		return err
+	}
+
+	if err := checkOwner(ctx, newOrder.UserID); err != nil {
+		return err
 	}
 
 	order, err := og.OrderService.Create(ctx, newOrder)
@@ -53,45 +52,96 @@ func (og *OrderGroup) CreateOrder(w http.ResponseWriter, r *http.Request) error
 	return respond(ctx, w, order, http.StatusCreated)
 }
 
-// swagger:route GET /orders/{lastSeenID}/{id} order listOrders
+// swagger:route POST /orders/checkout order checkoutOrder
 //
-// Gets paginated list of orders.
-// This request uses two provided values to implement pagination: last seen id and limit.
-// Results of a request sorted by creation date of selected users and sended back as JSON.
+// Checks out a new order together with it`s items
+// and reserves stock of ordered products.
+// The whole order is rejected if any of products is out of stock.
+// Retries of a request with the same Idempotency-Key header get the first response again.
 //
+// Consumes:
+// - application/json
 // Produces:
 // - application/json
 //
 // Responses:
-//   200: []Order
+//   201: Checkout
+//   400: errorResponse
+//   404: errorResponse
+//   409: errorResponse
+//   500: errorResponse
+func (og *OrderGroup) CheckoutOrder(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	var newCheckout entity.NewCheckout
+	if err := decode(r, &newCheckout); err != nil {
+		return err
+	}
+
+	if err := validate(newCheckout); err != nil {
+		return err
+	}
+
+	if err := checkOwner(ctx, newCheckout.UserID); err != nil {
+		return err
+	}
+
+	checkout, err := og.OrderService.Checkout(ctx, newCheckout)
+	if err != nil {
+		return err
+	}
+
+	return respond(ctx, w, checkout, http.StatusCreated)
+}
+
+// swagger:route GET /orders/ order listOrders
+//
+// Gets a page of orders.
+// Items can be filtered with filter[field][op]=value parameters
+// and sorted with sort=-field1,field2 parameter (newest first by default).
+// Size of a page is defined by limit parameter, next page can be requested with cursor parameter
+// which value is returned as next_cursor along with a page.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: listResponse
+//   400: errorResponse
 //   500: errorResponse
 func (og *OrderGroup) ListOrders(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
-	lastSeenID, err := parseURLParamID(r, "lastSeenID")
+	q, err := parseListQuery(r)
 	if err != nil {
 		return err
 	}
-	limit := chi.URLParam(r, "limit")
 
-	orders, err := og.OrderService.Query(ctx, lastSeenID, limit)
+	q, err = restrictToOwner(ctx, q, "user_id")
 	if err != nil {
 		return err
 	}
 
-	return respond(ctx, w, orders, http.StatusOK)
+	orders, page, err := og.OrderService.Query(ctx, q)
+	if err != nil {
+		return listQueryError(err)
+	}
+
+	return respond(ctx, w, listResponse{Data: orders, Page: page}, http.StatusOK)
 }
 
 // swagger:route GET /orders/{id} order getOrder
 //
 // Gets an order by it\`s id
-// and returns it\`s JSON representation.
+// and returns it\`s JSON representation along with it\`s version in ETag header.
+// If a version in If-None-Match header is still current, nothing is returned.
 //
 // Produces:
 // - application/json
 //
 // Responses:
 //   200: Order
+//   304: emptyResponse
 //   500: errorResponse
 func (og *OrderGroup) GetOrder(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
@@ -103,15 +153,15 @@ func (og *OrderGroup) GetOrder(w http.ResponseWriter, r *http.Request) error {
 
 	order, err := og.OrderService.QueryByID(ctx, id)
 	if err != nil {
-		switch err {
-		case database.ErrNotFound:
-			return RequestError{
-				ErrorText: err.Error(),
-				Status:    http.StatusNotFound,
-			}
-		default:
-			return errors.Wrapf(err, "ID: %s", id)
-		}
+		return errors.Wrapf(err, "ID: %s", id)
+	}
+
+	if err := checkOwner(ctx, order.UserID); err != nil {
+		return err
+	}
+
+	if checkETag(w, r, order.Version) {
+		return respond(ctx, w, nil, http.StatusNotModified)
 	}
 
 	return respond(ctx, w, order, http.StatusOK)
@@ -136,6 +186,10 @@ func (og *OrderGroup) ListUserOrders(w http.ResponseWriter, r *http.Request) err
 		return err
 	}
 
+	if err := checkOwner(ctx, id); err != nil {
+		return err
+	}
+
 	orders, err := og.OrderService.QueryByUserID(ctx, id)
 	if err != nil {
 		return err
@@ -146,8 +200,11 @@ func (og *OrderGroup) ListUserOrders(w http.ResponseWriter, r *http.Request) err
 
 // swagger:route PATCH /orders/{id} order updateOrder
 //
-// Updates a specific order
-// .
+// Updates a specific order.
+// Status of an order can only be changed according to order lifecycle:
+// pending -> paid -> shipped -> delivered, pending and paid orders can be cancelled,
+// paid and delivered orders can be refunded.
+// Version of an order an update is based on should be passed in If-Match header.
 //
 // Consumes:
 // - application/json
@@ -156,12 +213,16 @@ func (og *OrderGroup) ListUserOrders(w http.ResponseWriter, r *http.Request) err
 //
 // Responses:
 //   204: emptyResponse
+//   404: errorResponse
+//   409: errorResponse
+//   412: errorResponse
+//   428: errorResponse
 //   500: errorResponse
 func (og *OrderGroup) UpdateOrder(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
 	var updateOrder entity.UpdateOrder
-	if err := json.NewDecoder(r.Body).Decode(&updateOrder); err != nil {
+	if err := decode(r, &updateOrder); err != nil {
 		return err
 	}
 
@@ -170,23 +231,77 @@ func (og *OrderGroup) UpdateOrder(w http.ResponseWriter, r *http.Request) error
 		return err
 	}
 
-	if err := og.OrderService.Update(ctx, id, updateOrder); err != nil {
+	if err := checkOrderOwner(ctx, og.OrderService, id); err != nil {
+		return err
+	}
+
+	// Users that can only manage their own orders are allowed to cancel them,
+	// other status changes are up to the staff.
+	access, err := mid.GetAccess(ctx)
+	if err != nil {
+		return err
+	}
+	if access.Own && updateOrder.Status != nil && *updateOrder.Status != entity.OrderStatusCancelled {
+		return entity.ForbiddenError("you are only allowed to cancel your orders")
+	}
+
+	version, err := parseIfMatch(r)
+	if err != nil {
+		return err
+	}
+
+	if err := og.OrderService.Update(ctx, id, access.UserID, version, updateOrder); err != nil {
 		return err
 	}
 
 	return respond(ctx, w, nil, http.StatusNoContent)
 }
 
+// swagger:route GET /orders/{id}/history order getOrderHistory
+//
+// Gets status transitions of an order
+// sorted from oldest to newest.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: []OrderStatusChange
+//   404: errorResponse
+//   500: errorResponse
+func (og *OrderGroup) GetOrderHistory(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	id, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if err := checkOrderOwner(ctx, og.OrderService, id); err != nil {
+		return err
+	}
+
+	history, err := og.OrderService.QueryStatusHistory(ctx, id)
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", id)
+	}
+
+	return respond(ctx, w, history, http.StatusOK)
+}
+
 // swagger:route DELETE /orders/{id} order deleteOrder
 //
-// Deletes an order by it\`s id
-// and returns it\`s JSON representation.
+// Deletes an order by it\`s id.
+// Version of an order a client knows about should be passed in If-Match header.
 //
 // Produces:
 // - application/json
 //
 // Responses:
 //   204: emptyResponse
+//   404: errorResponse
+//   412: errorResponse
+//   428: errorResponse
 //   500: errorResponse
 func (og *OrderGroup) DeleteOrder(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
@@ -196,7 +311,40 @@ func (og *OrderGroup) DeleteOrder(w http.ResponseWriter, r *http.Request) error
 		return err
 	}
 
-	if err := og.OrderService.Delete(ctx, id); err != nil {
+	if err := checkOrderOwner(ctx, og.OrderService, id); err != nil {
+		return err
+	}
+
+	version, err := parseIfMatch(r)
+	if err != nil {
+		return err
+	}
+
+	if err := og.OrderService.Delete(ctx, id, version); err != nil {
+		return err
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// swagger:route POST /orders/{id}/restore order restoreOrder
+//
+// Restores a deleted order by it\`s id.
+// Deleted orders are kept until their retention period is over.
+//
+// Responses:
+//   204: emptyResponse
+//   404: errorResponse
+//   500: errorResponse
+func (og *OrderGroup) RestoreOrder(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	id, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if err := og.OrderService.Restore(ctx, id); err != nil {
 		return err
 	}
 
@@ -221,9 +369,32 @@ func (og *OrderGroup) DeleteUserOrders(w http.ResponseWriter, r *http.Request) e
 		return err
 	}
 
+	if err := checkOwner(ctx, id); err != nil {
+		return err
+	}
+
 	if err := og.OrderService.DeleteByUserID(ctx, id); err != nil {
 		return err
 	}
 
 	return respond(ctx, w, nil, http.StatusNoContent)
 }
+
+// checkOrderOwner forbids access to an order of other user
+// if access granted to a request is limited to resources owned by a user.
+func checkOrderOwner(ctx context.Context, orderService *usecase.OrderService, orderID string) error {
+	access, err := mid.GetAccess(ctx)
+	if err != nil {
+		return err
+	}
+	if !access.Own {
+		return nil
+	}
+
+	order, err := orderService.QueryByID(ctx, orderID)
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", orderID)
+	}
+
+	return checkOwner(ctx, order.UserID)
+}
@@ -1,25 +1,26 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
 	"net/http"
 
-	"github.com/go-chi/chi"
 	"github.com/pkg/errors"
+	mid "github.com/rtbe/clean-rest-api/delivery/web/middlewares"
 	"github.com/rtbe/clean-rest-api/domain/entity"
 	"github.com/rtbe/clean-rest-api/domain/usecase"
-	"github.com/rtbe/clean-rest-api/internal/database"
-	"github.com/rtbe/clean-rest-api/internal/validation"
+	"github.com/rtbe/clean-rest-api/internal/query"
 )
 
 type OrderItemGroup struct {
 	OrderItemService *usecase.OrderItemService
+	OrderService     *usecase.OrderService
 }
 
 // swagger:route POST /products/ product createOrderItem
 //
 // Creates a new order item
 // .
+// Retries of a request with the same Idempotency-Key header get the first response again.
 //
 // Consumes:
 // - application/json
@@ -33,16 +34,16 @@ func (oig *OrderItemGroup) CreateOrderItem(w http.ResponseWriter, r *http.Reques
 	ctx := r.Context()
 
 	var newOrderItem entity.NewOrderItem
-	if err := json.NewDecoder(r.Body).Decode(&newOrderItem); err != nil {
+	if err := decode(r, &newOrderItem); err != nil {
 		return err
 	}
 
-	if err := validation.Check(newOrderItem); err != nil {
-		return RequestError{
-			ErrorText: "validation error",
-			Fields:    err.Error(),
-			Status:    http.StatusBadRequest,
-		}
+	if err := validate(newOrderItem); err != nil {
+		return err
+	}
+
+	if err := checkOrderOwner(ctx, oig.OrderService, newOrderItem.OrderID); err != nil {
+		return err
 	}
 
 	orderItem, err := oig.OrderItemService.Create(ctx, newOrderItem)
@@ -53,45 +54,83 @@ func (oig *OrderItemGroup) CreateOrderItem(w http.ResponseWriter, r *http.Reques
 	return respond(ctx, w, orderItem, http.StatusCreated)
 }
 
+// swagger:route GET /order_items/ orderItem listOrderItems
+//
+// Gets a page of order items.
+// Items can be filtered with filter[field][op]=value parameters
+// and sorted with sort=-field1,field2 parameter (newest first by default).
+// Size of a page is defined by limit parameter, next page can be requested with cursor parameter
+// which value is returned as next_cursor along with a page.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: listResponse
+//   400: errorResponse
+//   500: errorResponse
+func (oig *OrderItemGroup) ListOrderItems(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	q, err := parseListQuery(r)
+	if err != nil {
+		return err
+	}
+
+	if err := oig.checkListOwner(ctx, q); err != nil {
+		return err
+	}
+
+	items, page, err := oig.OrderItemService.Query(ctx, q)
+	if err != nil {
+		return listQueryError(err)
+	}
+
+	return respond(ctx, w, listResponse{Data: items, Page: page}, http.StatusOK)
+}
+
 // swagger:route GET /orderItems/{id} orderItem getOrderItem
 //
 // Gets an order item by it\`s id
-// and returns it\`s JSON representation.
+// and returns it\`s JSON representation along with it\`s version in ETag header.
+// If a version in If-None-Match header is still current, nothing is returned.
 //
 // Produces:
 // - application/json
 //
 // Responses:
 //   201: OrderItem
+//   304: emptyResponse
 //   500: errorResponse
 func (oig *OrderItemGroup) GetOrderItem(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
 	id, err := parseURLParamID(r, "id")
 	if err != nil {
-		switch err {
-		case database.ErrNotFound:
-			return RequestError{
-				ErrorText: err.Error(),
-				Status:    http.StatusNotFound,
-			}
-		default:
-			return errors.Wrapf(err, "ID: %s", id)
-		}
+		return err
 	}
 
 	orderItem, err := oig.OrderItemService.QueryByID(ctx, id)
 	if err != nil {
+		return errors.Wrapf(err, "ID: %s", id)
+	}
+
+	if err := checkOrderOwner(ctx, oig.OrderService, orderItem.OrderID); err != nil {
 		return err
 	}
 
+	if checkETag(w, r, orderItem.Version) {
+		return respond(ctx, w, nil, http.StatusNotModified)
+	}
+
 	return respond(ctx, w, orderItem, http.StatusOK)
 }
 
 // swagger:route PATCH /orders/user/{id} orderItem updateOrderItem
 //
-// Updates an order item
-// .
+// Updates an order item.
+// Version of an order item an update is based on should be passed in If-Match header.
+// Items can be changed only while an order is pending.
 //
 // Consumes:
 // - application/json
@@ -100,12 +139,21 @@ func (oig *OrderItemGroup) GetOrderItem(w http.ResponseWriter, r *http.Request)
 //
 // Responses:
 //   204: emptyResponse
+//   400: errorResponse
+//   404: errorResponse
+//   409: errorResponse
+//   412: errorResponse
+//   428: errorResponse
 //   500: errorResponse
 func (oig *OrderItemGroup) UpdateOrderItem(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
 	var updateOrderItem entity.UpdateOrderItem
-	if err := json.NewDecoder(r.Body).Decode(&updateOrderItem); err != nil {
+	if err := decode(r, &updateOrderItem); err != nil {
+		return err
+	}
+
+	if err := validate(updateOrderItem); err != nil {
 		return err
 	}
 
@@ -114,7 +162,16 @@ func (oig *OrderItemGroup) UpdateOrderItem(w http.ResponseWriter, r *http.Reques
 		return err
 	}
 
-	if err := oig.OrderItemService.Update(ctx, id, updateOrderItem); err != nil {
+	if err := oig.checkOrderItemOwner(ctx, id); err != nil {
+		return err
+	}
+
+	version, err := parseIfMatch(r)
+	if err != nil {
+		return err
+	}
+
+	if err := oig.OrderItemService.Update(ctx, id, version, updateOrderItem); err != nil {
 		return err
 	}
 
@@ -123,24 +180,62 @@ func (oig *OrderItemGroup) UpdateOrderItem(w http.ResponseWriter, r *http.Reques
 
 // swagger:route DELETE /orderItems/{id} orderItem deleteOrderItem
 //
-// Deletes an order item by it\`s id
-// .
+// Deletes an order item by it\`s id.
+// Version of an order item a client knows about should be passed in If-Match header.
+// Items can be changed only while an order is pending.
 //
 // Produces:
 // - application/json
 //
 // Responses:
 //   204: emptyResponse
+//   404: errorResponse
+//   409: errorResponse
+//   412: errorResponse
+//   428: errorResponse
 //   500: errorResponse
 func (oig *OrderItemGroup) DeleteOrderItem(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
-	id, err := parseURLParamID(r, "orderID")
+	id, err := parseURLParamID(r, "id")
 	if err != nil {
 		return err
 	}
 
-	if err := oig.OrderItemService.Delete(ctx, id); err != nil {
+	if err := oig.checkOrderItemOwner(ctx, id); err != nil {
+		return err
+	}
+
+	version, err := parseIfMatch(r)
+	if err != nil {
+		return err
+	}
+
+	if err := oig.OrderItemService.Delete(ctx, id, version); err != nil {
+		return err
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// swagger:route POST /order_items/{id}/restore orderItem restoreOrderItem
+//
+// Restores a deleted order item by it\`s id.
+// Deleted order items are kept until their retention period is over.
+//
+// Responses:
+//   204: emptyResponse
+//   404: errorResponse
+//   500: errorResponse
+func (oig *OrderItemGroup) RestoreOrderItem(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	id, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if err := oig.OrderItemService.Restore(ctx, id); err != nil {
 		return err
 	}
 
@@ -160,7 +255,15 @@ func (oig *OrderItemGroup) DeleteOrderItem(w http.ResponseWriter, r *http.Reques
 func (oig *OrderItemGroup) ListOrderOrderItems(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
-	id := chi.URLParam(r, "orderID")
+	id, err := parseURLParamID(r, "orderID")
+	if err != nil {
+		return err
+	}
+
+	if err := checkOrderOwner(ctx, oig.OrderService, id); err != nil {
+		return err
+	}
+
 	orders, err := oig.OrderItemService.QueryByOrderID(ctx, id)
 	if err != nil {
 		return err
@@ -187,9 +290,65 @@ func (oig *OrderItemGroup) DeleteOrderOrderItems(w http.ResponseWriter, r *http.
 		return err
 	}
 
+	if err := checkOrderOwner(ctx, oig.OrderService, id); err != nil {
+		return err
+	}
+
 	if err := oig.OrderItemService.DeleteByOrderID(ctx, id); err != nil {
 		return err
 	}
 
 	return respond(ctx, w, nil, http.StatusNoContent)
 }
+
+// checkOrderItemOwner forbids access to an order item of other user
+// if access granted to a request is limited to resources owned by a user.
+func (oig *OrderItemGroup) checkOrderItemOwner(ctx context.Context, id string) error {
+	access, err := mid.GetAccess(ctx)
+	if err != nil {
+		return err
+	}
+	if !access.Own {
+		return nil
+	}
+
+	orderItem, err := oig.OrderItemService.QueryByID(ctx, id)
+	if err != nil {
+		return errors.Wrapf(err, "ID: %s", id)
+	}
+
+	return checkOrderOwner(ctx, oig.OrderService, orderItem.OrderID)
+}
+
+// checkListOwner forbids listing of order items of other users
+// if access granted to a request is limited to resources owned by a user.
+// Order items do not refer to users directly, so such list query should be filtered by user`s order.
+func (oig *OrderItemGroup) checkListOwner(ctx context.Context, q query.Query) error {
+	access, err := mid.GetAccess(ctx)
+	if err != nil {
+		return err
+	}
+	if !access.Own {
+		return nil
+	}
+
+	var filtered bool
+	for _, f := range q.Filters {
+		if f.Field != "order_id" || f.Op != query.Eq {
+			continue
+		}
+		if err := query.UUID.Validate(f.Value); err != nil {
+			return listQueryError(err)
+		}
+		if err := checkOrderOwner(ctx, oig.OrderService, f.Value); err != nil {
+			return err
+		}
+		filtered = true
+	}
+
+	if !filtered {
+		return entity.ForbiddenError("order items should be filtered by your order with filter[order_id]")
+	}
+
+	return nil
+}
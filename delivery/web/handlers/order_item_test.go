@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	mid "github.com/rtbe/clean-rest-api/delivery/web/middlewares"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/domain/usecase"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+	"github.com/rtbe/clean-rest-api/repository/audit"
+	"github.com/rtbe/clean-rest-api/repository/order"
+	orderitem "github.com/rtbe/clean-rest-api/repository/order_item"
+	"github.com/rtbe/clean-rest-api/repository/outbox"
+	"github.com/rtbe/clean-rest-api/repository/product"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
+)
+
+// newOrderItemRouter creates a router of order item routes on top of in-memory repositories.
+// Requests are made on behalf of a user with id from X-User header and a user role.
+func newOrderItemRouter() (http.Handler, *usecase.OrderService, *product.InMemRepo) {
+	orders := order.NewInMemRepo()
+	items := orderitem.NewInMemRepo(orders)
+	products := product.NewInMemRepo(items)
+	events := outbox.NewInMemRepo()
+	tx := transaction.NewInMemManager()
+	auditService := usecase.NewAuditService(audit.NewInMemRepo())
+
+	orderService := usecase.NewOrderService(orders, items, products, events, tx, auditService, 0)
+	oig := OrderItemGroup{
+		OrderItemService: usecase.NewOrderItemService(items, orders, products, events, tx, auditService, 0),
+		OrderService:     orderService,
+	}
+
+	// claims stands for Authenticate middleware.
+	claims := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := &entity.AccessTokenClaims{User_id: r.Header.Get("X-User"), User_roles: []string{entity.UserRole}}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), mid.ClaimsKey, c)))
+		})
+	}
+	can := func(p entity.Permission) func(http.Handler) http.Handler {
+		return mid.RequirePermission(entity.DefaultRolePermissions(), p)
+	}
+
+	r := chi.NewRouter()
+	r.Use(mid.RequestInfo, claims)
+	r.With(can(entity.PermissionOrderWrite)).Method(http.MethodPost, "/order_items/", Handler{H: oig.CreateOrderItem, L: logger.Nop()})
+	r.With(can(entity.PermissionOrderWrite)).Method(http.MethodPatch, "/order_items/{id}", Handler{H: oig.UpdateOrderItem, L: logger.Nop()})
+	r.With(can(entity.PermissionOrderWrite)).Method(http.MethodDelete, "/order_items/{id}", Handler{H: oig.DeleteOrderItem, L: logger.Nop()})
+
+	return r, orderService, products
+}
+
+func TestOrderItemGroup(t *testing.T) {
+	ctx := context.Background()
+	router, orders, products := newOrderItemRouter()
+
+	p, err := products.Create(ctx, entity.NewProduct{Title: "product", Price: 100, Stock: 3})
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to create a product. Error: %s", tests.Failed, err)
+	}
+	o, err := orders.Create(ctx, entity.NewOrder{UserID: "alan"})
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to create an order. Error: %s", tests.Failed, err)
+	}
+
+	do := func(method, target, body string) *http.Response {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-User", "alan")
+		req.Header.Set("If-Match", "*")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+	stock := func() int {
+		p, err := products.QueryByID(ctx, p.ID)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to query a product. Error: %s", tests.Failed, err)
+		}
+		return p.Stock
+	}
+	newItem := func(quantity int) string {
+		b, _ := json.Marshal(entity.NewOrderItem{OrderID: o.ID, ProductID: p.ID, Quantity: quantity})
+		return string(b)
+	}
+
+	t.Run("Given the need to keep stock of a product with order items", func(t *testing.T) {
+		res := do(http.MethodPost, "/order_items/", newItem(4))
+		res.Body.Close()
+		if res.StatusCode != http.StatusConflict || stock() != 3 {
+			t.Fatalf("\t%s\tWant conflict on ordering more than is in stock, got status code: %d, stock: %d", tests.Failed, res.StatusCode, stock())
+		}
+		t.Logf("\t%s\tShould reject ordering more than is in stock.", tests.Success)
+
+		res = do(http.MethodPost, "/order_items/", newItem(2))
+		defer res.Body.Close()
+		var oi entity.OrderItem
+		if err := json.NewDecoder(res.Body).Decode(&oi); err != nil || res.StatusCode != http.StatusCreated || stock() != 1 {
+			t.Fatalf("\t%s\tWant an item to be taken out of stock, got status code: %d, stock: %d, error: %v", tests.Failed, res.StatusCode, stock(), err)
+		}
+		t.Logf("\t%s\tShould take an item out of stock.", tests.Success)
+
+		res = do(http.MethodPatch, "/order_items/"+oi.ID, `{"quantity":4}`)
+		res.Body.Close()
+		if res.StatusCode != http.StatusConflict || stock() != 1 {
+			t.Fatalf("\t%s\tWant conflict on raising a quantity over stock, got status code: %d, stock: %d", tests.Failed, res.StatusCode, stock())
+		}
+		t.Logf("\t%s\tShould reject raising a quantity over stock.", tests.Success)
+
+		res = do(http.MethodDelete, "/order_items/"+oi.ID, "")
+		res.Body.Close()
+		if res.StatusCode != http.StatusNoContent || stock() != 3 {
+			t.Fatalf("\t%s\tWant a deleted item back in stock, got status code: %d, stock: %d", tests.Failed, res.StatusCode, stock())
+		}
+		t.Logf("\t%s\tShould give a deleted item back to stock.", tests.Success)
+	})
+
+	t.Run("Given the need to validate and restrict changes of order items", func(t *testing.T) {
+		res := do(http.MethodPost, "/order_items/", newItem(1))
+		defer res.Body.Close()
+		var oi entity.OrderItem
+		if err := json.NewDecoder(res.Body).Decode(&oi); err != nil || res.StatusCode != http.StatusCreated {
+			t.Fatalf("\t%s\tShould be able to create an order item, got status code: %d, error: %v", tests.Failed, res.StatusCode, err)
+		}
+
+		res = do(http.MethodPatch, "/order_items/"+oi.ID, `{"quantity":0}`)
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest || stock() != 2 {
+			t.Fatalf("\t%s\tWant bad request on a zero quantity, got status code: %d, stock: %d", tests.Failed, res.StatusCode, stock())
+		}
+		t.Logf("\t%s\tShould reject a zero quantity.", tests.Success)
+
+		paid := entity.OrderStatusPaid
+		if err := orders.Update(ctx, o.ID, "admin", 0, entity.UpdateOrder{Status: &paid}); err != nil {
+			t.Fatalf("\t%s\tShould be able to pay for an order. Error: %s", tests.Failed, err)
+		}
+
+		tt := []struct {
+			method string
+			target string
+			body   string
+		}{
+			{method: http.MethodPost, target: "/order_items/", body: newItem(1)},
+			{method: http.MethodPatch, target: "/order_items/" + oi.ID, body: `{"quantity":2}`},
+			{method: http.MethodDelete, target: "/order_items/" + oi.ID},
+		}
+		for testID, tc := range tt {
+			res := do(tc.method, tc.target, tc.body)
+			res.Body.Close()
+			if res.StatusCode != http.StatusConflict || stock() != 2 {
+				t.Fatalf("\t%s\tTest %d:\tWant conflict on %s of a paid order, got status code: %d, stock: %d", tests.Failed, testID, tc.method, res.StatusCode, stock())
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject %s of an item of a paid order.", tests.Success, testID, tc.method)
+		}
+	})
+}
@@ -1,14 +1,12 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
+	"strings"
 
-	"github.com/go-chi/chi"
 	"github.com/pkg/errors"
 	"github.com/rtbe/clean-rest-api/domain/entity"
 	"github.com/rtbe/clean-rest-api/domain/usecase"
-	"github.com/rtbe/clean-rest-api/internal/database"
 	"github.com/rtbe/clean-rest-api/internal/validation"
 )
 
@@ -33,16 +31,12 @@ func (pg *ProductGroup) CreateProduct(w http.ResponseWriter, r *http.Request) er
 	ctx := r.Context()
 
 	var newProduct entity.NewProduct
-	if err := json.NewDecoder(r.Body).Decode(&newProduct); err != nil {
+	if err := decode(r, &newProduct); err != nil {
 		return err
 	}
 
-	if err := validation.Check(newProduct); err != nil {
-		return RequestError{
-			ErrorText: "validation error",
-			Fields:    err.Error(),
-			Status:    http.StatusBadRequest,
-		}
+	if err := validate(newProduct); err != nil {
+		return err
 	}
 
 	product, err := pg.ProductService.Create(ctx, newProduct)
@@ -53,45 +47,87 @@ func (pg *ProductGroup) CreateProduct(w http.ResponseWriter, r *http.Request) er
 	return respond(ctx, w, product, http.StatusCreated)
 }
 
-// swagger:route GET /products/{lastSeenID}/{id} product listProducts
+// swagger:route GET /products/ product listProducts
 //
-// Gets paginated list of products.
-// This request uses two provided values to implement pagination: last seen id and limit.
-// Results of a request sorted by creation date of selected users and sended back as JSON.
+// Gets a page of products.
+// Items can be filtered with filter[field][op]=value parameters
+// and sorted with sort=-field1,field2 parameter (newest first by default).
+// Size of a page is defined by limit parameter, next page can be requested with cursor parameter
+// which value is returned as next_cursor along with a page.
 //
 // Produces:
 // - application/json
 //
 // Responses:
-//   200: []Product
+//   200: listResponse
+//   400: errorResponse
 //   500: errorResponse
 func (pg *ProductGroup) ListProducts(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
-	lastSeenID, err := parseURLParamID(r, "lastSeenID")
+	q, err := parseListQuery(r)
 	if err != nil {
 		return err
 	}
-	limit := chi.URLParam(r, "limit")
 
-	products, err := pg.ProductService.Query(ctx, lastSeenID, limit)
+	products, page, err := pg.ProductService.Query(ctx, q)
+	if err != nil {
+		return listQueryError(err)
+	}
+
+	return respond(ctx, w, listResponse{Data: products, Page: page}, http.StatusOK)
+}
+
+// swagger:route GET /products/search product searchProducts
+//
+// Searches products by keywords in their title and description.
+// Keywords are passed with q parameter, the last keyword is matched as a prefix,
+// so this request can be used for type-ahead suggestions.
+// Results are sorted by relevance and contain highlighted fragments of matched text.
+// Number of results is defined by limit parameter.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: []ProductSearchResult
+//   400: errorResponse
+//   500: errorResponse
+func (pg *ProductGroup) SearchProducts(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+	if text == "" {
+		return entity.NewValidationError(validation.FieldErrors{
+			{Field: "q", Error: "search query is empty"},
+		})
+	}
+
+	q, err := parseListQuery(r)
+	if err != nil {
+		return err
+	}
+
+	results, err := pg.ProductService.Search(ctx, text, q.Limit)
 	if err != nil {
 		return err
 	}
 
-	return respond(ctx, w, products, http.StatusOK)
+	return respond(ctx, w, results, http.StatusOK)
 }
 
 // swagger:route GET /products/{id} product getProduct
 //
 // Gets a product by it\`s id
-// and returns it\`s JSON representation.
+// and returns it\`s JSON representation along with it\`s version in ETag header.
+// If a version in If-None-Match header is still current, nothing is returned.
 //
 // Produces:
 // - application/json
 //
 // Responses:
 //   200: Product
+//   304: emptyResponse
 //   500: errorResponse
 func (pg *ProductGroup) GetProduct(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
@@ -103,15 +139,11 @@ func (pg *ProductGroup) GetProduct(w http.ResponseWriter, r *http.Request) error
 
 	product, err := pg.ProductService.QueryByID(ctx, id)
 	if err != nil {
-		switch err {
-		case database.ErrNotFound:
-			return RequestError{
-				ErrorText: err.Error(),
-				Status:    http.StatusNotFound,
-			}
-		default:
-			return errors.Wrapf(err, "ID: %s", id)
-		}
+		return errors.Wrapf(err, "ID: %s", id)
+	}
+
+	if checkETag(w, r, product.Version) {
+		return respond(ctx, w, nil, http.StatusNotModified)
 	}
 
 	return respond(ctx, w, product, http.StatusOK)
@@ -119,20 +151,23 @@ func (pg *ProductGroup) GetProduct(w http.ResponseWriter, r *http.Request) error
 
 // swagger:route PATCH /products/{id} product updateProduct
 //
-// Updates a product
-// .
+// Updates a product.
+// Version of a product an update is based on should be passed in If-Match header.
 //
 // Consumes:
 // - application/json
 //
 // Responses:
 //   201: emptyResponse
+//   404: errorResponse
+//   412: errorResponse
+//   428: errorResponse
 //   500: errorResponse
 func (pg *ProductGroup) UpdateProduct(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
 	var updateProduct entity.UpdateProduct
-	if err := json.NewDecoder(r.Body).Decode(&updateProduct); err != nil {
+	if err := decode(r, &updateProduct); err != nil {
 		return err
 	}
 
@@ -141,7 +176,12 @@ func (pg *ProductGroup) UpdateProduct(w http.ResponseWriter, r *http.Request) er
 		return err
 	}
 
-	if err := pg.ProductService.Update(ctx, id, updateProduct); err != nil {
+	version, err := parseIfMatch(r)
+	if err != nil {
+		return err
+	}
+
+	if err := pg.ProductService.Update(ctx, id, version, updateProduct); err != nil {
 		return err
 	}
 
@@ -150,14 +190,17 @@ func (pg *ProductGroup) UpdateProduct(w http.ResponseWriter, r *http.Request) er
 
 // swagger:route DELETE /products/{id} product deleteProduct
 //
-// Deletes a product by it\`s id
-// and returns it\`s JSON representation.
+// Deletes a product by it\`s id.
+// Version of a product a client knows about should be passed in If-Match header.
 //
 // Produces:
 // - application/json
 //
 // Responses:
 //   204: emptyResponse
+//   404: errorResponse
+//   412: errorResponse
+//   428: errorResponse
 //   500: errorResponse
 func (pg *ProductGroup) DeleteProduct(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
@@ -167,7 +210,36 @@ func (pg *ProductGroup) DeleteProduct(w http.ResponseWriter, r *http.Request) er
 		return err
 	}
 
-	if err := pg.ProductService.Delete(ctx, id); err != nil {
+	version, err := parseIfMatch(r)
+	if err != nil {
+		return err
+	}
+
+	if err := pg.ProductService.Delete(ctx, id, version); err != nil {
+		return err
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// swagger:route POST /products/{id}/restore product restoreProduct
+//
+// Restores a deleted product by it\`s id.
+// Deleted products are kept until their retention period is over.
+//
+// Responses:
+//   204: emptyResponse
+//   404: errorResponse
+//   500: errorResponse
+func (pg *ProductGroup) RestoreProduct(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	id, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if err := pg.ProductService.Restore(ctx, id); err != nil {
 		return err
 	}
 
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"net/http"
+
+	mid "github.com/rtbe/clean-rest-api/delivery/web/middlewares"
+	"github.com/rtbe/clean-rest-api/domain/usecase"
+)
+
+type SessionGroup struct {
+	SessionService *usecase.SessionService
+}
+
+// swagger:route GET /auth/sessions session listSessions
+//
+// Gets active sessions of a signed in user, most recently used first.
+// Session a request was made within is marked as current.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: []Session
+//   401: errorResponse
+//   500: errorResponse
+func (sg *SessionGroup) ListSessions(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	claims, err := mid.GetJWTClaims(ctx)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := sg.SessionService.QueryByUserID(ctx, claims.User_id)
+	if err != nil {
+		return err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.Session_id
+	}
+
+	return respond(ctx, w, sessions, http.StatusOK)
+}
+
+// swagger:route DELETE /auth/sessions/{id} session deleteSession
+//
+// Ends a session of a signed in user,
+// so tokens issued within it can not be refreshed anymore.
+//
+// Responses:
+//   204: emptyResponse
+//   404: errorResponse
+//   500: errorResponse
+func (sg *SessionGroup) DeleteSession(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	id, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	claims, err := mid.GetJWTClaims(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := sg.SessionService.Revoke(ctx, claims.User_id, id); err != nil {
+		return err
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// swagger:route DELETE /auth/sessions session deleteSessions
+//
+// Ends all sessions of a signed in user, signing him out everywhere.
+//
+// Responses:
+//   204: emptyResponse
+//   500: errorResponse
+func (sg *SessionGroup) DeleteSessions(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	claims, err := mid.GetJWTClaims(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := sg.SessionService.RevokeAll(ctx, claims.User_id); err != nil {
+		return err
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// swagger:route GET /users/{id}/sessions session listUserSessions
+//
+// Gets active sessions of a specific user, most recently used first.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: []Session
+//   403: errorResponse
+//   500: errorResponse
+func (sg *SessionGroup) ListUserSessions(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userID, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if err := checkOwner(ctx, userID); err != nil {
+		return err
+	}
+
+	sessions, err := sg.SessionService.QueryByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return respond(ctx, w, sessions, http.StatusOK)
+}
+
+// swagger:route DELETE /users/{id}/sessions/{sessionID} session deleteUserSession
+//
+// Ends a session of a specific user.
+//
+// Responses:
+//   204: emptyResponse
+//   403: errorResponse
+//   404: errorResponse
+//   500: errorResponse
+func (sg *SessionGroup) DeleteUserSession(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userID, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	id, err := parseURLParamID(r, "sessionID")
+	if err != nil {
+		return err
+	}
+
+	if err := checkOwner(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := sg.SessionService.Revoke(ctx, userID, id); err != nil {
+		return err
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// swagger:route DELETE /users/{id}/sessions session deleteUserSessions
+//
+// Ends all sessions of a specific user.
+//
+// Responses:
+//   204: emptyResponse
+//   403: errorResponse
+//   500: errorResponse
+func (sg *SessionGroup) DeleteUserSessions(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	userID, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if err := checkOwner(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := sg.SessionService.RevokeAll(ctx, userID); err != nil {
+		return err
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	mid "github.com/rtbe/clean-rest-api/delivery/web/middlewares"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/domain/usecase"
+	"github.com/rtbe/clean-rest-api/internal/validation"
+)
+
+type TwoFactorGroup struct {
+	TwoFactorService *usecase.TwoFactorService
+}
+
+// swagger:route POST /auth/2fa/enroll twoFactor enrollTwoFactor
+//
+// Generates a new TOTP secret for a signed in user.
+// Returned provisioning URI should be shown as QR code to be scanned by an authenticator app.
+// Two-factor authentication is enabled only after it is confirmed with a code.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: TwoFactorEnrollment
+//   409: errorResponse
+//   500: errorResponse
+func (tfg *TwoFactorGroup) Enroll(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	claims, err := mid.GetJWTClaims(ctx)
+	if err != nil {
+		return err
+	}
+
+	enrollment, err := tfg.TwoFactorService.Enroll(ctx, claims.User_id)
+	if err != nil {
+		return twoFactorError(err)
+	}
+
+	return respond(ctx, w, enrollment, http.StatusOK)
+}
+
+// swagger:route POST /auth/2fa/confirm twoFactor confirmTwoFactor
+//
+// Enables two-factor authentication of a signed in user with a code from an authenticator app
+// and returns recovery codes. Recovery codes are shown only once.
+//
+// Consumes:
+// - application/json
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: RecoveryCodes
+//   400: errorResponse
+//   409: errorResponse
+//   500: errorResponse
+func (tfg *TwoFactorGroup) Confirm(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	claims, code, err := parseTwoFactorCode(r)
+	if err != nil {
+		return err
+	}
+
+	codes, err := tfg.TwoFactorService.Confirm(ctx, claims.User_id, code)
+	if err != nil {
+		return twoFactorError(err)
+	}
+
+	return respond(ctx, w, codes, http.StatusOK)
+}
+
+// swagger:route POST /auth/2fa/recovery-codes twoFactor regenerateRecoveryCodes
+//
+// Replaces recovery codes of a signed in user, previous codes can not be used anymore.
+//
+// Consumes:
+// - application/json
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: RecoveryCodes
+//   400: errorResponse
+//   409: errorResponse
+//   500: errorResponse
+func (tfg *TwoFactorGroup) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	claims, code, err := parseTwoFactorCode(r)
+	if err != nil {
+		return err
+	}
+
+	codes, err := tfg.TwoFactorService.RegenerateRecoveryCodes(ctx, claims.User_id, code)
+	if err != nil {
+		return twoFactorError(err)
+	}
+
+	return respond(ctx, w, codes, http.StatusOK)
+}
+
+// swagger:route POST /auth/2fa/disable twoFactor disableTwoFactor
+//
+// Disables two-factor authentication of a signed in user with a code from an authenticator app
+// or a recovery code.
+//
+// Consumes:
+// - application/json
+//
+// Responses:
+//   204: emptyResponse
+//   400: errorResponse
+//   409: errorResponse
+//   500: errorResponse
+func (tfg *TwoFactorGroup) Disable(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	claims, code, err := parseTwoFactorCode(r)
+	if err != nil {
+		return err
+	}
+
+	if err := tfg.TwoFactorService.Disable(ctx, claims.User_id, code); err != nil {
+		return twoFactorError(err)
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// parseTwoFactorCode gets claims of a signed in user and a code from a request body.
+func parseTwoFactorCode(r *http.Request) (*entity.AccessTokenClaims, string, error) {
+	claims, err := mid.GetJWTClaims(r.Context())
+	if err != nil {
+		return nil, "", err
+	}
+
+	var code entity.TwoFactorCode
+	if err := decode(r, &code); err != nil {
+		return nil, "", err
+	}
+
+	if err := validate(code); err != nil {
+		return nil, "", err
+	}
+
+	return claims, code.Code, nil
+}
+
+// twoFactorError turns a wrong two-factor authentication code into validation error of a code,
+// errors of other kinds are presented as is.
+func twoFactorError(err error) error {
+	if errors.Cause(err) != usecase.ErrInvalidTwoFactorCode {
+		return err
+	}
+
+	return entity.NewValidationError(validation.FieldErrors{
+		{Field: "code", Error: usecase.ErrInvalidTwoFactorCode.Error()},
+	})
+}
@@ -1,54 +1,59 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
 
-	"github.com/go-chi/chi"
 	"github.com/pkg/errors"
 	mid "github.com/rtbe/clean-rest-api/delivery/web/middlewares"
 	"github.com/rtbe/clean-rest-api/domain/entity"
 	"github.com/rtbe/clean-rest-api/domain/usecase"
-	"github.com/rtbe/clean-rest-api/internal/database"
 )
 
 type UserGroup struct {
 	UserService *usecase.UserService
 }
 
-// swagger:route GET /users/{lastSeenID}/{limit} user listUsers
+// swagger:route GET /users/ user listUsers
 //
-// Gets paginated list of users.
-// This request uses two provided values to implement pagination: last seen id and limit.
-// Results of a request sorted by creation date of selected users and sended back as JSON.
+// Gets a page of users.
+// Items can be filtered with filter[field][op]=value parameters
+// and sorted with sort=-field1,field2 parameter (newest first by default).
+// Size of a page is defined by limit parameter, next page can be requested with cursor parameter
+// which value is returned as next_cursor along with a page.
 //
 // Produces:
 // - application/json
 //
 // Responses:
-//   200: []User
+//   200: listResponse
+//   400: errorResponse
 //   500: errorResponse
 func (ug *UserGroup) ListUsers(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 
-	lastSeenID, err := parseURLParamID(r, "lastSeenID")
+	q, err := parseListQuery(r)
 	if err != nil {
 		return err
 	}
 
-	limit := chi.URLParam(r, "limit")
-	users, err := ug.UserService.Query(ctx, lastSeenID, limit)
+	q, err = restrictToOwner(ctx, q, "user_id")
 	if err != nil {
 		return err
 	}
 
-	return respond(ctx, w, users, http.StatusOK)
+	users, page, err := ug.UserService.Query(ctx, q)
+	if err != nil {
+		return listQueryError(err)
+	}
+
+	return respond(ctx, w, listResponse{Data: users, Page: page}, http.StatusOK)
 }
 
 // swagger:route GET /users/id/{id} user getUser
 //
 // Gets a user by his id
-// and returns it\`s JSON representation.
+// and returns it\`s JSON representation along with it\`s version in ETag header.
+// If a version in If-None-Match header is still current, nothing is returned.
 //
 // Consumes:
 // - application/json
@@ -57,6 +62,7 @@ func (ug *UserGroup) ListUsers(w http.ResponseWriter, r *http.Request) error {
 //
 // Responses:
 //   201: User
+//   304: emptyResponse
 //   500: errorResponse
 func (ug *UserGroup) GetUserByID(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
@@ -66,17 +72,17 @@ func (ug *UserGroup) GetUserByID(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	if err := checkOwner(ctx, id); err != nil {
+		return err
+	}
+
 	user, err := ug.UserService.QueryByID(ctx, id)
 	if err != nil {
-		switch err {
-		case database.ErrNotFound:
-			return RequestError{
-				ErrorText: err.Error(),
-				Status:    http.StatusNotFound,
-			}
-		default:
-			return errors.Wrapf(err, "ID: %s", id)
-		}
+		return errors.Wrapf(err, "ID: %s", id)
+	}
+
+	if checkETag(w, r, user.Version) {
+		return respond(ctx, w, nil, http.StatusNotModified)
 	}
 
 	return respond(ctx, w, user, http.StatusOK)
@@ -84,14 +90,17 @@ func (ug *UserGroup) GetUserByID(w http.ResponseWriter, r *http.Request) error {
 
 // swagger:route PATCH /users/{id} user updateUser
 //
-// Updates a user
-// .
+// Updates a user.
+// Version of a user an update is based on should be passed in If-Match header.
 //
 // Consumes:
 // - application/json
 //
 // Responses:
 //   204: emptyResponse
+//   404: errorResponse
+//   412: errorResponse
+//   428: errorResponse
 //   500: errorResponse
 func (ug *UserGroup) UpdateUser(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
@@ -101,25 +110,30 @@ func (ug *UserGroup) UpdateUser(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	claims, err := mid.GetJWTClaims(ctx)
-	if err != nil {
+	if err := checkOwner(ctx, id); err != nil {
+		return err
+	}
+
+	var user entity.UpdateUser
+	if err := decode(r, &user); err != nil {
 		return err
 	}
 
-	// Restrict modification of other user.
-	if id != claims.Id {
-		return RequestError{
-			ErrorText: "modification of other user is restricted",
-			Status:    http.StatusBadRequest,
-		}
+	// Users that can only manage their own account can not grant roles to themselves.
+	access, err := mid.GetAccess(ctx)
+	if err != nil {
+		return err
+	}
+	if access.Own && user.Roles != nil {
+		return entity.ForbiddenError("you are not allowed to change your roles")
 	}
 
-	var user entity.UpdateUser
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+	version, err := parseIfMatch(r)
+	if err != nil {
 		return err
 	}
 
-	if err := ug.UserService.Update(ctx, id, user); err != nil {
+	if err := ug.UserService.Update(ctx, id, version, user); err != nil {
 		return err
 	}
 
@@ -128,14 +142,17 @@ func (ug *UserGroup) UpdateUser(w http.ResponseWriter, r *http.Request) error {
 
 // swagger:route DELETE /users/{id} user deleteUser
 //
-// Deletes a user
-// .
+// Deletes a user.
+// Version of a user a client knows about should be passed in If-Match header.
 //
 // Produces:
 // - application/json
 //
 // Responses:
 //   204: emptyResponse
+//   404: errorResponse
+//   412: errorResponse
+//   428: errorResponse
 //   500: errorResponse
 func (ug *UserGroup) DeleteUser(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
@@ -145,7 +162,40 @@ func (ug *UserGroup) DeleteUser(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	if err := ug.UserService.Delete(ctx, id); err != nil {
+	if err := checkOwner(ctx, id); err != nil {
+		return err
+	}
+
+	version, err := parseIfMatch(r)
+	if err != nil {
+		return err
+	}
+
+	if err := ug.UserService.Delete(ctx, id, version); err != nil {
+		return err
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// swagger:route POST /users/{id}/restore user restoreUser
+//
+// Restores a deleted user by it\`s id.
+// Deleted users are kept until their retention period is over.
+//
+// Responses:
+//   204: emptyResponse
+//   404: errorResponse
+//   500: errorResponse
+func (ug *UserGroup) RestoreUser(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	id, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if err := ug.UserService.Restore(ctx, id); err != nil {
 		return err
 	}
 
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/domain/usecase"
+)
+
+type WebhookGroup struct {
+	WebhookService *usecase.WebhookService
+}
+
+// swagger:route POST /webhooks webhook createWebhook
+//
+// Subscribes a receiver at a URL to domain events of given types.
+// Every event is posted to a receiver as JSON with Webhook-Id, Webhook-Event, Webhook-Timestamp
+// and Webhook-Signature headers, a signature is sha256=hex(HMAC-SHA256(secret, "timestamp.body")).
+// Deliveries that are not answered with 2xx status are retried with exponential backoff until they die.
+//
+// Consumes:
+// - application/json
+// Produces:
+// - application/json
+//
+// Responses:
+//   201: WebhookSubscription
+//   400: errorResponse
+//   500: errorResponse
+func (wg *WebhookGroup) CreateWebhook(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	var newSubscription entity.NewWebhookSubscription
+	if err := decode(r, &newSubscription); err != nil {
+		return err
+	}
+
+	if err := validate(newSubscription); err != nil {
+		return err
+	}
+
+	subscription, err := wg.WebhookService.Create(ctx, newSubscription)
+	if err != nil {
+		return err
+	}
+
+	return respond(ctx, w, subscription, http.StatusCreated)
+}
+
+// swagger:route GET /webhooks webhook listWebhooks
+//
+// Gets a page of webhook subscriptions, newest first. Secrets are never returned.
+// Size of a page is defined by limit parameter, next page can be requested with cursor parameter
+// which value is returned as next_cursor along with a page.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: listResponse
+//   400: errorResponse
+//   500: errorResponse
+func (wg *WebhookGroup) ListWebhooks(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	q, err := parseListQuery(r)
+	if err != nil {
+		return err
+	}
+
+	subscriptions, page, err := wg.WebhookService.Query(ctx, q)
+	if err != nil {
+		return listQueryError(err)
+	}
+
+	return respond(ctx, w, listResponse{Data: subscriptions, Page: page}, http.StatusOK)
+}
+
+// swagger:route GET /webhooks/{id} webhook getWebhook
+//
+// Gets a specific webhook subscription.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: WebhookSubscription
+//   404: errorResponse
+//   500: errorResponse
+func (wg *WebhookGroup) GetWebhook(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	id, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	subscription, err := wg.WebhookService.QueryByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return respond(ctx, w, subscription, http.StatusOK)
+}
+
+// swagger:route PATCH /webhooks/{id} webhook updateWebhook
+//
+// Changes a URL, a secret or event types of a specific webhook subscription.
+//
+// Consumes:
+// - application/json
+//
+// Responses:
+//   204: emptyResponse
+//   400: errorResponse
+//   404: errorResponse
+//   500: errorResponse
+func (wg *WebhookGroup) UpdateWebhook(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	id, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	var updateSubscription entity.UpdateWebhookSubscription
+	if err := decode(r, &updateSubscription); err != nil {
+		return err
+	}
+
+	if err := validate(updateSubscription); err != nil {
+		return err
+	}
+
+	if err := wg.WebhookService.Update(ctx, id, updateSubscription); err != nil {
+		return err
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// swagger:route DELETE /webhooks/{id} webhook deleteWebhook
+//
+// Deletes a specific webhook subscription along with it`s deliveries.
+//
+// Responses:
+//   204: emptyResponse
+//   404: errorResponse
+//   500: errorResponse
+func (wg *WebhookGroup) DeleteWebhook(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	id, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if err := wg.WebhookService.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// swagger:route GET /webhooks/{id}/deliveries webhook listWebhookDeliveries
+//
+// Gets a page of deliveries of a specific webhook subscription, newest first.
+// Deliveries can be filtered with filter[field][op]=value parameters, e.g. filter[status][eq]=dead.
+// Size of a page is defined by limit parameter, next page can be requested with cursor parameter
+// which value is returned as next_cursor along with a page.
+//
+// Produces:
+// - application/json
+//
+// Responses:
+//   200: listResponse
+//   400: errorResponse
+//   404: errorResponse
+//   500: errorResponse
+func (wg *WebhookGroup) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	id, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	q, err := parseListQuery(r)
+	if err != nil {
+		return err
+	}
+
+	deliveries, page, err := wg.WebhookService.QueryDeliveries(ctx, id, q)
+	if err != nil {
+		return listQueryError(err)
+	}
+
+	return respond(ctx, w, listResponse{Data: deliveries, Page: page}, http.StatusOK)
+}
+
+// swagger:route POST /webhooks/{id}/deliveries/{deliveryID}/redeliver webhook redeliverWebhookDelivery
+//
+// Schedules a delivery of a specific webhook subscription to be posted again right away,
+// a dead delivery gets all of it`s attempts back.
+//
+// Responses:
+//   204: emptyResponse
+//   404: errorResponse
+//   500: errorResponse
+func (wg *WebhookGroup) RedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	id, err := parseURLParamID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	deliveryID, err := parseURLParamID(r, "deliveryID")
+	if err != nil {
+		return err
+	}
+
+	if err := wg.WebhookService.Redeliver(ctx, id, deliveryID); err != nil {
+		return err
+	}
+
+	return respond(ctx, w, nil, http.StatusNoContent)
+}
@@ -0,0 +1,27 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+)
+
+// Audit is an middleware that passes an authenticated user along with an id of a request into request context,
+// so services record changes made within a request on behalf of that user.
+// It should go after RequestInfo and Authenticate middlewares,
+// changes made within requests without claims are recorded as anonymous ones.
+func Audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var actor entity.Actor
+		if claims, err := GetJWTClaims(ctx); err == nil {
+			actor.UserID = claims.User_id
+		}
+		if info, err := GetRequestInfo(ctx); err == nil {
+			actor.RequestID = info.ID
+		}
+
+		next.ServeHTTP(w, r.WithContext(entity.WithActor(ctx, actor)))
+	})
+}
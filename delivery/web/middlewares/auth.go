@@ -5,48 +5,135 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/logger"
 )
 
 var (
-	errAuthWrongHeaderFormat = errors.New("expected 'Authorization' header format: Bearer <token>")
+	errAuthWrongHeaderFormat = errors.New("expected 'Authorization' header format: Bearer <token> or ApiKey <key>")
 	errAuthHeaderMissing     = errors.New("header 'Authorization' is missing")
+	errAPIKeysNotAccepted    = errors.New("API keys are not accepted")
 )
 
 // ClaimsKey is the context.Context key to store authentication claims.
 var ClaimsKey = &contextKey{"claims"}
 
-// Authenticate is an middleware that validates passed access JWT token in `Authorization` header.
+// AccessKey is the context.Context key to store access granted by RequirePermission middleware.
+var AccessKey = &contextKey{"access"}
+
+// Access is an access to a route granted to an authenticated user.
+type Access struct {
+	UserID string
+
+	// Own is true when access is limited to resources owned by the user,
+	// so handlers should check ownership of resources they work with.
+	Own bool
+}
+
+// APIKeyVerifier checks API keys and returns claims of requests authenticated with them.
+// It returns entity.ErrInvalidAPIKey if a key is unknown or expired.
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key string) (*entity.AccessTokenClaims, error)
+}
+
+// SessionVerifier checks that sessions access tokens were issued within are still active.
+// It returns entity.ErrSessionEnded if a session is ended or expired.
+type SessionVerifier interface {
+	VerifySession(ctx context.Context, userID, id string) error
+}
+
+// Authenticate is an middleware that validates passed access JWT token or API key in `Authorization` header.
 // So it serves as gateway to all of app incoming requests.
-// Access token claims then passed into request context so you can get them later with ClaimsCtxKey.
-func Authenticate(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
+// API keys are checked with a given verifier, if it is nil they are not accepted.
+// Sessions of access tokens are checked with a given verifier, so tokens stop working once a session ends,
+// if it is nil access tokens are accepted until they expire.
+// Claims of a request then passed into request context so you can get them later with GetJWTClaims.
+func Authenticate(apiKeys APIKeyVerifier, sessions SessionVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
 
-		// Expecting: bearer <token>
-		bearer := r.Header.Get("Authorization")
-		if len(bearer) == 0 {
-			http.Error(w, errAuthHeaderMissing.Error(), http.StatusBadRequest)
-			return
-		}
-		if len(bearer) < 6 || strings.ToLower(bearer[0:6]) != "bearer" {
-			http.Error(w, errAuthWrongHeaderFormat.Error(), http.StatusBadRequest)
-			return
-		}
+			// Expecting: bearer <token> or apikey <key>
+			header := r.Header.Get("Authorization")
+			if len(header) == 0 {
+				writeProblem(w, r, http.StatusBadRequest, errAuthHeaderMissing.Error())
+				return
+			}
 
-		accessToken := bearer[7:]
-		accessTokenClaims, err := entity.ParseAccessTokenClaims(accessToken)
+			parts := strings.SplitN(header, " ", 2)
+			if len(parts) != 2 {
+				writeProblem(w, r, http.StatusBadRequest, errAuthWrongHeaderFormat.Error())
+				return
+			}
+
+			var (
+				claims *entity.AccessTokenClaims
+				err    error
+			)
+			switch strings.ToLower(parts[0]) {
+			case "bearer":
+				claims, err = entity.ParseAccessTokenClaims(parts[1])
+				if err == nil && sessions != nil {
+					err = sessions.VerifySession(ctx, claims.User_id, claims.Session_id)
+					if err != nil && !errors.Is(err, entity.ErrSessionEnded) {
+						logger.FromContext(ctx).Error("verifying a session", logger.Err(err))
+						writeProblem(w, r, http.StatusInternalServerError, "")
+						return
+					}
+				}
+			case "apikey":
+				if apiKeys == nil {
+					writeProblem(w, r, http.StatusUnauthorized, errAPIKeysNotAccepted.Error())
+					return
+				}
+				claims, err = apiKeys.VerifyAPIKey(ctx, parts[1])
+				if err != nil && !errors.Is(err, entity.ErrInvalidAPIKey) {
+					logger.FromContext(ctx).Error("verifying an API key", logger.Err(err))
+					writeProblem(w, r, http.StatusInternalServerError, "")
+					return
+				}
+			default:
+				writeProblem(w, r, http.StatusBadRequest, errAuthWrongHeaderFormat.Error())
+				return
+			}
+			if err != nil {
+				writeProblem(w, r, http.StatusUnauthorized, err.Error())
+				return
+			}
+
+			// Add claims to the context so we can retrieve them later
+			ctx = context.WithValue(ctx, ClaimsKey, claims)
+
+			// Entries logged within a request from now on tell which user made it.
+			ctx = logger.NewContext(ctx, logger.FromContext(ctx).With(logger.String("user_id", claims.User_id)))
+			if info, err := GetRequestInfo(ctx); err == nil {
+				info.UserID = claims.User_id
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// DenyAPIKeys is an middleware that rejects requests authenticated with API keys,
+// so routes that manage credentials of a user are available to signed in users only.
+func DenyAPIKeys(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := GetJWTClaims(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			writeProblem(w, r, http.StatusUnauthorized, err.Error())
 			return
 		}
 
-		// Add claims to the context so we can retrieve them later
-		ctx = context.WithValue(ctx, ClaimsKey, accessTokenClaims)
+		if claims.IsAPIKey() {
+			writeProblem(w, r, http.StatusForbidden, errAPIKeysNotAccepted.Error())
+			return
+		}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r)
 	})
 }
 
@@ -60,7 +147,7 @@ func Authorize(requiredRole string) func(http.Handler) http.Handler {
 
 			claims, err := GetJWTClaims(ctx)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				writeProblem(w, r, http.StatusBadRequest, err.Error())
 				return
 			}
 
@@ -77,7 +164,7 @@ func Authorize(requiredRole string) func(http.Handler) http.Handler {
 					claims.User_roles,
 					requiredRole,
 				)
-				http.Error(w, s, http.StatusUnauthorized)
+				writeProblem(w, r, http.StatusUnauthorized, s)
 				return
 			}
 
@@ -86,6 +173,99 @@ func Authorize(requiredRole string) func(http.Handler) http.Handler {
 	}
 }
 
+// RequirePermission is an middleware that filters requests based on permissions
+// granted to roles in access token claims and, for requests authenticated with API key, to it`s scopes.
+// Access granted to a request is passed into request context so you can get it later with GetAccess.
+func RequirePermission(rp entity.RolePermissions, p entity.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			claims, err := GetJWTClaims(ctx)
+			if err != nil {
+				writeProblem(w, r, http.StatusUnauthorized, err.Error())
+				return
+			}
+
+			granted, own := grants(rp, claims, p)
+			if !granted {
+				s := fmt.Sprintf(
+					"you are not allowed to perform that action; roles: %v, required permission: %s",
+					claims.User_roles,
+					p,
+				)
+				writeProblem(w, r, http.StatusForbidden, s)
+				return
+			}
+
+			ctx = context.WithValue(ctx, AccessKey, Access{UserID: claims.User_id, Own: own})
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireQueryPermission is an middleware that requires a permission for requests
+// that turn on a boolean query parameter, e.g. include_deleted=true. Other requests are passed as they are.
+// Permission limited to owned resources is not enough, since such a parameter is not about particular resources.
+func RequireQueryPermission(rp entity.RolePermissions, param string, p entity.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Invalid values are left for handlers to reject.
+			if on, _ := strconv.ParseBool(r.URL.Query().Get(param)); !on {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, err := GetJWTClaims(r.Context())
+			if err != nil {
+				writeProblem(w, r, http.StatusUnauthorized, err.Error())
+				return
+			}
+
+			if granted, own := grants(rp, claims, p); !granted || own {
+				s := fmt.Sprintf(
+					"you are not allowed to use %s parameter; roles: %v, required permission: %s",
+					param,
+					claims.User_roles,
+					p,
+				)
+				writeProblem(w, r, http.StatusForbidden, s)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// grants checks whether a permission is granted to roles in claims and, for requests authenticated with API key, to it`s scopes.
+func grants(rp entity.RolePermissions, claims *entity.AccessTokenClaims, p entity.Permission) (granted bool, own bool) {
+	granted, own = rp.Grants(claims.User_roles, p)
+
+	// Requests authenticated with API key are limited to scopes of a key as well.
+	if claims.IsAPIKey() {
+		scoped, scopedOwn := entity.ScopesGrant(claims.Scopes, p)
+		granted, own = granted && scoped, own || scopedOwn
+	}
+
+	return granted, own
+}
+
+// GetAccess returns access granted to a request from the given context.
+func GetAccess(ctx context.Context) (Access, error) {
+	if ctx == nil {
+		return Access{}, errNoContext
+	}
+
+	access, ok := ctx.Value(AccessKey).(Access)
+	if !ok {
+		return Access{}, errNoAccessInContext
+	}
+
+	return access, nil
+}
+
 // GetJWTClaims returns JWT access token claims from the given context.
 func GetJWTClaims(ctx context.Context) (*entity.AccessTokenClaims, error) {
 	if ctx == nil {
@@ -12,7 +12,7 @@ func CheckHeader(header, value string, status int) func(http.Handler) http.Handl
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 			if str := r.Header.Get(header); str != value {
-				http.Error(w, fmt.Sprintf("%s header should have value of %s", header, value), status)
+				writeProblem(w, r, status, fmt.Sprintf("%s header should have value of %s", header, value))
 				return
 			}
 
@@ -0,0 +1,207 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+)
+
+const (
+	// maxIdempotencyKeyLength is a maximum length of Idempotency-Key header.
+	maxIdempotencyKeyLength = 255
+
+	// maxIdempotentBodySize is a maximum size of a body of a request with Idempotency-Key header,
+	// it is read into memory to tell requests apart.
+	maxIdempotentBodySize = 1 << 20
+)
+
+var (
+	errIdempotencyKeyTooLong    = errors.New("header 'Idempotency-Key' should be at most 255 characters long")
+	errIdempotencyKeyReused     = errors.New("key in 'Idempotency-Key' header was already used for a different request")
+	errIdempotencyKeyInProgress = errors.New("a request with the same key in 'Idempotency-Key' header is in progress")
+	errIdempotentBodyTooLarge   = errors.New("body of a request with 'Idempotency-Key' header should be at most 1MB")
+)
+
+// IdempotencyStore keeps responses to requests made with Idempotency-Key header.
+// It is implemented by idempotency repositories.
+type IdempotencyStore interface {
+	// Reserve saves a record of a request in progress unless there is a record with the same principal and key
+	// that is neither expired nor abandoned, which is returned instead. It reports whether a record was saved.
+	Reserve(ctx context.Context, r entity.IdempotencyRecord) (entity.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, r entity.IdempotencyRecord) error
+	Delete(ctx context.Context, principal, key string) error
+}
+
+// IdempotencyConfig is a configuration of Idempotent middleware.
+type IdempotencyConfig struct {
+	Store IdempotencyStore
+
+	// TTL is a period of time a response is replayed for.
+	TTL time.Duration
+
+	// LockTimeout is a period of time a request in progress holds a key for.
+	// If a request is not completed by then, e.g. because of a crash, it is considered abandoned
+	// and it`s retries can take a key over. It should be longer than any request takes.
+	LockTimeout time.Duration
+}
+
+// Idempotent is an middleware that makes retries of requests with Idempotency-Key header safe.
+// A response to the first request is saved by a client and a key, and retries of the same request get
+// that response again instead of repeating it`s effects, with Idempotent-Replayed header set.
+// A key can not be reused for a different request, neither can it be used while the first request is in progress.
+// Server errors and panics are not saved, so a request that failed can be retried.
+// Bodies of requests with a key are read into memory, so they are limited to maxIdempotentBodySize.
+// Requests without a key are passed as they are. Clients are told the same way RateLimit does,
+// so on protected routes it should go after Authenticate.
+func Idempotent(cfg IdempotencyConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			l := logger.FromContext(ctx)
+
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				writeProblem(w, r, http.StatusBadRequest, errIdempotencyKeyTooLong.Error())
+				return
+			}
+
+			body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodySize))
+			if err != nil {
+				if len(body) >= maxIdempotentBodySize {
+					writeProblem(w, r, http.StatusRequestEntityTooLarge, errIdempotentBodyTooLarge.Error())
+					return
+				}
+				writeProblem(w, r, http.StatusBadRequest, "")
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			now := time.Now().UTC()
+			rec, reserved, err := cfg.Store.Reserve(ctx, entity.IdempotencyRecord{
+				Principal:   clientKey(r),
+				Key:         key,
+				Fingerprint: entity.RequestFingerprint(r.Method, r.URL.RequestURI(), body),
+				LockedUntil: now.Add(cfg.LockTimeout),
+				ExpiresAt:   now.Add(cfg.TTL),
+				DateCreated: now,
+			})
+			if err != nil {
+				l.Error("reserving an idempotency key", logger.Err(err))
+				writeProblem(w, r, http.StatusInternalServerError, "")
+				return
+			}
+
+			if !reserved {
+				switch {
+				case rec.Fingerprint != entity.RequestFingerprint(r.Method, r.URL.RequestURI(), body):
+					writeProblem(w, r, http.StatusUnprocessableEntity, errIdempotencyKeyReused.Error())
+				case !rec.Completed():
+					writeProblem(w, r, http.StatusConflict, errIdempotencyKeyInProgress.Error())
+				default:
+					replay(w, r, rec)
+				}
+				return
+			}
+
+			// Headers set by middlewares before, e.g. rate limit ones, are not a part of a response to save.
+			before := w.Header().Clone()
+			rw := &responseRecorder{ResponseWriter: w}
+
+			// A client that timed out cancels a request context, but a response still has to be saved
+			// for it`s retries, so records are updated regardless.
+			release := func() {
+				if err := cfg.Store.Delete(context.Background(), rec.Principal, rec.Key); err != nil {
+					l.Error("releasing an idempotency key", logger.Err(err))
+				}
+			}
+
+			serve(rw, r, next, release)
+
+			if rw.status == 0 {
+				rw.status = http.StatusOK
+			}
+			if rw.status >= http.StatusInternalServerError {
+				release()
+				return
+			}
+
+			rec.StatusCode = rw.status
+			rec.Header = entity.ResponseHeader{}
+			for k, v := range w.Header() {
+				if !reflect.DeepEqual(before[k], v) {
+					rec.Header[k] = v
+				}
+			}
+			rec.Body = rw.body.Bytes()
+
+			// A response is already sent, so if it can not be saved, a request is let to be made again.
+			if err := cfg.Store.Complete(context.Background(), rec); err != nil {
+				l.Error("saving a response to an idempotent request", logger.Err(err))
+				release()
+			}
+		})
+	}
+}
+
+// serve passes a request to next handler and calls release if it panics, then the panic goes on.
+func serve(w http.ResponseWriter, r *http.Request, next http.Handler, release func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			release()
+			panic(p)
+		}
+	}()
+
+	next.ServeHTTP(w, r)
+}
+
+// replay writes a saved response to a request again.
+func replay(w http.ResponseWriter, r *http.Request, rec entity.IdempotencyRecord) {
+	for k, v := range rec.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+
+	// Set status code of request into it's context for logging it later.
+	if info, err := GetRequestInfo(r.Context()); err == nil {
+		info.StatusCode = rec.StatusCode
+	}
+
+	w.WriteHeader(rec.StatusCode)
+	w.Write(rec.Body)
+}
+
+// responseRecorder is a http.ResponseWriter that keeps a copy of a response it writes.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader implements http.ResponseWriter interface.
+func (rw *responseRecorder) WriteHeader(statusCode int) {
+	if rw.status == 0 {
+		rw.status = statusCode
+	}
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements http.ResponseWriter interface.
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
@@ -1,13 +1,15 @@
 package middlewares
 
 import (
-	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/rtbe/clean-rest-api/internal/logger"
 )
 
+// Logger is an middleware that logs every request when it starts and when it is completed.
+// It puts a logger with an ID of a request into a request context,
+// so entries logged with logger.FromContext can be told apart by a request they belong to.
 func Logger(l logger.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -17,22 +19,30 @@ func Logger(l logger.Logger) func(http.Handler) http.Handler {
 				return
 			}
 
+			rl := l.With(logger.String("request_id", info.ID))
+
 			// Log info about request before invoking next handler.
-			start := fmt.Sprintf("%s: started  : %s %s -> %s",
-				info.ID,
-				r.Method, r.URL.Path, r.RemoteAddr,
+			rl.Info("request started",
+				logger.String("method", r.Method),
+				logger.String("path", r.URL.Path),
+				logger.String("remote_addr", r.RemoteAddr),
 			)
-			l.Log("info", start)
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(logger.NewContext(r.Context(), rl)))
 
 			// Log info about request after invoking next handler.
-			finish := fmt.Sprintf("%s: completed: %s %s -> %s (%d) (%s)",
-				info.ID,
-				r.Method, r.URL.Path, r.RemoteAddr,
-				info.StatusCode, time.Since(info.Now),
-			)
-			l.Log("info", finish)
+			// A user is known only after it was authenticated down the chain.
+			fields := []logger.Field{
+				logger.String("method", r.Method),
+				logger.String("path", r.URL.Path),
+				logger.String("remote_addr", r.RemoteAddr),
+				logger.Int("status", info.StatusCode),
+				logger.Duration("duration", time.Since(info.Now)),
+			}
+			if info.UserID != "" {
+				fields = append(fields, logger.String("user_id", info.UserID))
+			}
+			rl.Info("request completed", fields...)
 		})
 	}
 }
@@ -6,6 +6,7 @@ import "errors"
 var (
 	errNoContext         = errors.New("there is no request context")
 	errNoClaimsInContext = errors.New("there is no JWT claims in request context")
+	errNoAccessInContext = errors.New("there is no granted access in request context")
 )
 
 // contextKey is a value for use with context.WithValue. It's used as
@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// problemTypeBase is a base of URIs that identify kinds of problems, handlers use the same one.
+const problemTypeBase = "/problems/"
+
+// problem is a description of an error presented to an app user in RFC 7807 format.
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// problemKind is a type and a title of a problem.
+type problemKind struct {
+	typ   string
+	title string
+}
+
+// problemKinds are kinds of problems by their status codes, they are described the same way handlers do.
+// Problems with other status codes are described by their status code only.
+var problemKinds = map[int]problemKind{
+	http.StatusUnauthorized: {typ: problemTypeBase + "unauthorized", title: "Authentication failed"},
+	http.StatusForbidden:    {typ: problemTypeBase + "forbidden", title: "Access is forbidden"},
+	http.StatusConflict:     {typ: problemTypeBase + "conflict", title: "Request conflicts with current state of a resource"},
+}
+
+// writeProblem responds to a request with a problem of a given status code and detail in RFC 7807 format.
+// An instance of a problem is an ID of a request, see RequestInfo. Details of server errors are not shown.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	p := problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+	if kind, ok := problemKinds[status]; ok {
+		p.Type, p.Title = kind.typ, kind.title
+	}
+	if status >= http.StatusInternalServerError {
+		p.Detail = ""
+	}
+
+	// Set status code of request into it's context for logging it later.
+	if info, err := GetRequestInfo(r.Context()); err == nil {
+		p.Instance = info.ID
+		info.StatusCode = status
+	}
+
+	// Details are shown as they are, e.g. with <token> placeholders.
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.SetEscapeHTML(false)
+	enc.Encode(p)
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(body.Bytes())
+}
@@ -0,0 +1,308 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+var (
+	errRateLimitExceeded = errors.New("rate limit exceeded")
+	errInvalidRateLimit  = errors.New("invalid rate limit")
+)
+
+// Rate is a token bucket policy: a client has a bucket of Limit tokens that is refilled
+// at Limit tokens per Period, every request takes a token. So a client can make a burst of Limit requests
+// and then Limit requests per Period on average. Zero Limit means no limit.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// RateLimits is a configuration of request rate limits.
+type RateLimits struct {
+	// Store keeps buckets of clients, it should be shared by all instances of an application
+	// for limits to hold across them.
+	Store RateLimitStore
+
+	// Default is a limit of routes that have no limit of their own.
+	Default Rate
+
+	// Routes are limits of particular routes by their patterns, e.g. /products/{id}.
+	Routes map[string]Rate
+
+	// IP is a limit of requests from one IP address to all routes RateLimitByIP guards.
+	// It should be much higher than other limits, since many clients may share an address, e.g. behind NAT.
+	IP Rate
+}
+
+// RateLimitStatus is a state of a bucket after a request took a token from it.
+type RateLimitStatus struct {
+	// Allowed is false if a bucket had no tokens left.
+	Allowed bool
+
+	// Remaining is a number of tokens left in a bucket.
+	Remaining int
+
+	// Reset is a period of time after which a bucket is full again.
+	Reset time.Duration
+
+	// RetryAfter is a period of time after which a rejected request can be retried.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore is an interface that represents storage of token buckets.
+// An in-process store suits a single instance of an application,
+// a distributed one (e.g. on top of Redis) is needed to share limits between instances.
+type RateLimitStore interface {
+	// Take takes a token from a bucket of a key, a bucket of an unknown key starts full.
+	Take(ctx context.Context, key string, rate Rate) (RateLimitStatus, error)
+}
+
+// TokenBucket is a state of a bucket stores keep.
+type TokenBucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Take refills a bucket for time passed since it was updated and takes a token from it.
+// It is the algorithm stores share, so they only have to keep buckets.
+func (b TokenBucket) Take(rate Rate, now time.Time) (TokenBucket, RateLimitStatus) {
+	limit := float64(rate.Limit)
+	perToken := float64(rate.Period) / limit
+
+	if b.Updated.IsZero() {
+		b.Tokens = limit
+	} else if elapsed := now.Sub(b.Updated); elapsed > 0 {
+		b.Tokens = math.Min(limit, b.Tokens+float64(elapsed)/perToken)
+	}
+	b.Updated = now
+
+	var status RateLimitStatus
+	if b.Tokens >= 1 {
+		b.Tokens--
+		status.Allowed = true
+	} else {
+		status.RetryAfter = time.Duration((1 - b.Tokens) * perToken)
+	}
+
+	status.Remaining = int(b.Tokens)
+	status.Reset = time.Duration((limit - b.Tokens) * perToken)
+
+	return b, status
+}
+
+// MemoryRateLimitStore is an in-process store of token buckets (map+Mutex).
+type MemoryRateLimitStore struct {
+	buckets map[string]TokenBucket
+	periods map[string]time.Duration
+	swept   time.Time
+	now     func() time.Time
+	sync.Mutex
+}
+
+// NewMemoryRateLimitStore creates a new in-process store of token buckets.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: make(map[string]TokenBucket),
+		periods: make(map[string]time.Duration),
+		now:     time.Now,
+	}
+}
+
+// Take takes a token from a bucket of a key.
+// Buckets that have been full for a while are dropped, since they are no different from new ones.
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, rate Rate) (RateLimitStatus, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := s.now()
+	if now.Sub(s.swept) >= time.Minute {
+		for k, b := range s.buckets {
+			if now.Sub(b.Updated) >= s.periods[k] {
+				delete(s.buckets, k)
+				delete(s.periods, k)
+			}
+		}
+		s.swept = now
+	}
+
+	b, status := s.buckets[key].Take(rate, now)
+	s.buckets[key] = b
+	s.periods[key] = rate.Period
+
+	return status, nil
+}
+
+// RateLimit is an middleware that limits request rate of clients with token buckets.
+// A limit is chosen by a pattern of a matched route of a router.
+// Clients are told by an authenticated user, by an API key or by an IP address of anonymous requests,
+// so on protected routes it should go after Authenticate.
+// Responses carry RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers,
+// rejected requests get Too Many Requests status along with Retry-After header.
+func RateLimit(rl RateLimits, router chi.Routes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			// Routing is not finished yet, so a pattern of a route is found from scratch.
+			rctx := chi.NewRouteContext()
+			var pattern string
+			if router.Match(rctx, r.Method, r.URL.Path) {
+				pattern = rctx.RoutePattern()
+			}
+
+			rate, ok := rl.Routes[pattern]
+			if !ok {
+				rate = rl.Default
+			}
+			if rate.Limit <= 0 || rate.Period <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			status, err := rl.Store.Take(ctx, pattern+" "+clientKey(r), rate)
+			if err != nil {
+				writeProblem(w, r, http.StatusInternalServerError, "")
+				return
+			}
+
+			setRateLimitHeaders(w, rate, status)
+			if !status.Allowed {
+				rejectRequest(w, r, status)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimitByIP is an middleware that limits request rate of clients by their IP addresses only,
+// with IP limit shared by all routes it guards.
+// On protected routes it goes before Authenticate, so requests with invalid credentials are limited as well
+// and credentials can not be guessed at an unlimited rate, while RateLimit after Authenticate
+// limits authenticated clients by a user or an API key.
+// RateLimit-* headers of allowed requests are left to RateLimit, so a client sees it`s own limit,
+// they are sent along with rejected requests only.
+func RateLimitByIP(rl RateLimits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rl.IP.Limit <= 0 || rl.IP.Period <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// A bucket of an address is shared by all routes, so unlike keys of RateLimit it`s key has no pattern.
+			status, err := rl.Store.Take(r.Context(), ipKey(r), rl.IP)
+			if err != nil {
+				writeProblem(w, r, http.StatusInternalServerError, "")
+				return
+			}
+
+			if !status.Allowed {
+				setRateLimitHeaders(w, rl.IP, status)
+				rejectRequest(w, r, status)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setRateLimitHeaders tells a client about a limit and a state of it`s bucket.
+func setRateLimitHeaders(w http.ResponseWriter, rate Rate, status RateLimitStatus) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(rate.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(status.Reset)))
+}
+
+// rejectRequest responds to a request over a limit with Too Many Requests status and Retry-After header.
+func rejectRequest(w http.ResponseWriter, r *http.Request, status RateLimitStatus) {
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(status.RetryAfter)))
+	writeProblem(w, r, http.StatusTooManyRequests, errRateLimitExceeded.Error())
+}
+
+// clientKey returns a key a client of a request is told by:
+// an authenticated user, an API key or an IP address of anonymous requests.
+func clientKey(r *http.Request) string {
+	if claims, err := GetJWTClaims(r.Context()); err == nil {
+		if claims.IsAPIKey() {
+			return "apikey:" + claims.Api_key_id
+		}
+		return "user:" + claims.User_id
+	}
+
+	return ipKey(r)
+}
+
+// ipKey returns a key a client of a request is told by regardless of it`s credentials: an IP address.
+func ipKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ceilSeconds rounds a period of time up to whole seconds.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ParseRate parses a rate limit in limit/period format, e.g. 100/1m.
+func ParseRate(s string) (Rate, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) != 2 {
+		return Rate{}, fmt.Errorf("%w: %q is not in limit/period format", errInvalidRateLimit, s)
+	}
+
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil || limit < 0 {
+		return Rate{}, fmt.Errorf("%w: limit of %q", errInvalidRateLimit, s)
+	}
+
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Rate{}, fmt.Errorf("%w: period of %q", errInvalidRateLimit, s)
+	}
+
+	return Rate{Limit: limit, Period: period}, nil
+}
+
+// ParseRouteRates parses rate limits of routes in pattern=limit/period;pattern=limit/period format,
+// e.g. /auth/signin=10/1m;/products/{id}=50/1s.
+func ParseRouteRates(s string) (map[string]Rate, error) {
+	limits := make(map[string]Rate)
+
+	for _, def := range strings.Split(s, ";") {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+
+		parts := strings.SplitN(def, "=", 2)
+		pattern := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || pattern == "" {
+			return nil, fmt.Errorf("%w: route limit %q", errInvalidRateLimit, def)
+		}
+
+		rate, err := ParseRate(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		limits[pattern] = rate
+	}
+
+	return limits, nil
+}
@@ -18,6 +18,8 @@ type Request struct {
 	ID         string
 	Now        time.Time
 	StatusCode int
+	// UserID is an ID of a user a request was authenticated as, it is empty for anonymous requests.
+	UserID string
 }
 
 var RequestKey = &contextKey{"requestInfo"}
@@ -7,6 +7,7 @@ import (
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/rtbe/clean-rest-api/delivery/web/handlers"
 	mid "github.com/rtbe/clean-rest-api/delivery/web/middlewares"
+	"github.com/rtbe/clean-rest-api/domain/entity"
 	"github.com/rtbe/clean-rest-api/domain/usecase"
 	"github.com/rtbe/clean-rest-api/internal/logger"
 )
@@ -19,72 +20,169 @@ type App struct {
 }
 
 // NewApp creates a new application.
-func NewApp(s usecase.Services, l logger.Logger) *App {
+// Every route except authentication, status, key set and documentation ones requires an authenticated user
+// with a role that is granted a permission declared by a route.
+// Machine clients can authenticate with API keys that are further limited to their scopes.
+// Request rate of every client is limited by route patterns, see mid.RateLimit.
+// Requests that create orders can be safely retried with Idempotency-Key header, see mid.Idempotent.
+// Changes of users, products, orders and order items are recorded on behalf of a user into audit log, see mid.Audit.
+// Deleted items are listed with ?include_deleted=true and restored only by users with a role granted to do so.
+func NewApp(s usecase.Services, rp entity.RolePermissions, rl mid.RateLimits, ic mid.IdempotencyConfig, l logger.Logger) *App {
 
 	r := chi.NewMux()
 
 	// Set up middlewares for whole application:
-	r.Use(mid.RequestInfo, mid.Logger(l))
+	r.Use(mid.RequestInfo, mid.Audit, mid.Logger(l))
+
+	// limit is a middleware that limits request rate of a client.
+	limit := mid.RateLimit(rl, r)
+
+	// limitIP is a middleware that limits request rate of a client by it`s IP address regardless of credentials.
+	limitIP := mid.RateLimitByIP(rl)
+
+	// authenticate is a middleware that requires an access token or an API key.
+	// Rate of requests is limited by an IP address before credentials are checked, so they can not be guessed,
+	// and rate of authenticated requests is limited by a user or an API key as well.
+	// Changes made within authenticated requests are recorded on behalf of a user.
+	authenticate := func(next http.Handler) http.Handler {
+		return limitIP(mid.Authenticate(s.APIKey, s.Session)(mid.Audit(limit(next))))
+	}
+
+	// can returns a middleware that requires a permission for a route.
+	can := func(p entity.Permission) func(http.Handler) http.Handler {
+		return mid.RequirePermission(rp, p)
+	}
+
+	// deleted is a middleware that requires a permission to list deleted items with ?include_deleted=true.
+	deleted := mid.RequireQueryPermission(rp, "include_deleted", entity.PermissionDeletedRead)
+
+	// idempotent is a middleware that replays responses to retried requests with the same Idempotency-Key.
+	idempotent := mid.Idempotent(ic)
 
 	// Configure routes for Auth Group
 	ag := handlers.AuthGroup{AuthService: s.Auth}
-	r.With().Route("/auth", func(r chi.Router) {
+	r.With(limit).Route("/auth", func(r chi.Router) {
 		r.Method(http.MethodPost, "/signup", handlers.Handler{H: ag.SignUp, L: l})
 		r.With().Method(http.MethodPost, "/signin", handlers.Handler{H: ag.SignIn, L: l})
+		r.Method(http.MethodPost, "/signin/2fa", handlers.Handler{H: ag.SignInTwoFactor, L: l})
 		r.With().Method(http.MethodPost, "/signout", handlers.Handler{H: ag.SignOut, L: l})
 		r.With().Method(http.MethodPost, "/refresh", handlers.Handler{H: ag.RefreshTokens, L: l})
+		r.Method(http.MethodPost, "/password/forgot", handlers.Handler{H: ag.ForgotPassword, L: l})
+		r.Method(http.MethodPost, "/password/reset", handlers.Handler{H: ag.ResetPassword, L: l})
+		r.Method(http.MethodPost, "/email/verify", handlers.Handler{H: ag.VerifyEmail, L: l})
+		r.Method(http.MethodPost, "/email/resend", handlers.Handler{H: ag.ResendVerification, L: l})
+	})
+
+	// Configure routes for OIDC Group
+	oidcg := handlers.OIDCGroup{OIDCService: s.OIDC}
+	r.With(limit).Route("/auth/oidc/{provider}", func(r chi.Router) {
+		r.Method(http.MethodGet, "/login", handlers.Handler{H: oidcg.Login, L: l})
+		r.Method(http.MethodGet, "/callback", handlers.Handler{H: oidcg.Callback, L: l})
+	})
+
+	// Configure routes for Session Group
+	sg := handlers.SessionGroup{SessionService: s.Session}
+	r.With(authenticate, mid.DenyAPIKeys).Route("/auth/sessions", func(r chi.Router) {
+		r.Method(http.MethodGet, "/", handlers.Handler{H: sg.ListSessions, L: l})
+		r.Method(http.MethodDelete, "/", handlers.Handler{H: sg.DeleteSessions, L: l})
+		r.Method(http.MethodDelete, "/{id}", handlers.Handler{H: sg.DeleteSession, L: l})
+	})
+
+	// Configure routes for Two-Factor Authentication Group
+	tfg := handlers.TwoFactorGroup{TwoFactorService: s.TwoFactor}
+	r.With(authenticate, mid.DenyAPIKeys).Route("/auth/2fa", func(r chi.Router) {
+		r.Method(http.MethodPost, "/enroll", handlers.Handler{H: tfg.Enroll, L: l})
+		r.Method(http.MethodPost, "/confirm", handlers.Handler{H: tfg.Confirm, L: l})
+		r.Method(http.MethodPost, "/recovery-codes", handlers.Handler{H: tfg.RegenerateRecoveryCodes, L: l})
+		r.Method(http.MethodPost, "/disable", handlers.Handler{H: tfg.Disable, L: l})
 	})
 
 	// Configure routes for User Group
 	ug := handlers.UserGroup{UserService: s.User}
-	r.With().Route("/users", func(r chi.Router) {
-		r.With().Method(http.MethodGet, "/{lastSeenID}/{limit}", handlers.Handler{H: ug.ListUsers, L: l})
-		r.Method(http.MethodGet, "/{id}", handlers.Handler{H: ug.GetUserByID, L: l})
-		r.With().Method(http.MethodPatch, "/{id}", handlers.Handler{H: ug.UpdateUser, L: l})
-		r.With().Method(http.MethodDelete, "/{id}", handlers.Handler{H: ug.DeleteUser, L: l})
+	akg := handlers.APIKeyGroup{APIKeyService: s.APIKey}
+	r.With(authenticate).Route("/users", func(r chi.Router) {
+		r.With(can(entity.PermissionUserRead), deleted).Method(http.MethodGet, "/", handlers.Handler{H: ug.ListUsers, L: l})
+		r.With(can(entity.PermissionUserRead)).Method(http.MethodGet, "/{id}", handlers.Handler{H: ug.GetUserByID, L: l})
+		r.With(can(entity.PermissionUserWrite)).Method(http.MethodPatch, "/{id}", handlers.Handler{H: ug.UpdateUser, L: l})
+		r.With(can(entity.PermissionUserWrite)).Method(http.MethodDelete, "/{id}", handlers.Handler{H: ug.DeleteUser, L: l})
+		r.With(can(entity.PermissionDeletedRestore)).Method(http.MethodPost, "/{id}/restore", handlers.Handler{H: ug.RestoreUser, L: l})
+		r.With(can(entity.PermissionUserUnlock)).Method(http.MethodPost, "/{id}/unlock", handlers.Handler{H: ag.UnlockUser, L: l})
+		r.With(can(entity.PermissionUserRead)).Method(http.MethodGet, "/{id}/sessions", handlers.Handler{H: sg.ListUserSessions, L: l})
+		r.With(can(entity.PermissionUserWrite)).Method(http.MethodDelete, "/{id}/sessions", handlers.Handler{H: sg.DeleteUserSessions, L: l})
+		r.With(can(entity.PermissionUserWrite)).Method(http.MethodDelete, "/{id}/sessions/{sessionID}", handlers.Handler{H: sg.DeleteUserSession, L: l})
+		r.With(mid.DenyAPIKeys, can(entity.PermissionUserRead)).Method(http.MethodGet, "/{id}/api-keys", handlers.Handler{H: akg.ListAPIKeys, L: l})
+		r.With(mid.DenyAPIKeys, can(entity.PermissionUserWrite)).Method(http.MethodPost, "/{id}/api-keys", handlers.Handler{H: akg.CreateAPIKey, L: l})
+		r.With(mid.DenyAPIKeys, can(entity.PermissionUserWrite)).Method(http.MethodDelete, "/{id}/api-keys/{keyID}", handlers.Handler{H: akg.DeleteAPIKey, L: l})
 	})
 
 	// Configure routes for Product Group
 	pg := handlers.ProductGroup{ProductService: s.Product}
-	r.With().Route("/products", func(r chi.Router) {
-		r.With().Method(http.MethodPost, "/", handlers.Handler{H: pg.CreateProduct, L: l})
-		r.Method(http.MethodGet, "/{lastSeenID}/{limit}", handlers.Handler{H: pg.ListProducts, L: l})
-		r.Method(http.MethodGet, "/{id}", handlers.Handler{H: pg.GetProduct, L: l})
-		r.With().Method(http.MethodPatch, "/{id}", handlers.Handler{H: pg.UpdateProduct, L: l})
-		r.Method(http.MethodDelete, "/{id}", handlers.Handler{H: pg.DeleteProduct, L: l})
+	r.With(authenticate).Route("/products", func(r chi.Router) {
+		r.With(can(entity.PermissionProductWrite)).Method(http.MethodPost, "/", handlers.Handler{H: pg.CreateProduct, L: l})
+		r.With(can(entity.PermissionProductRead), deleted).Method(http.MethodGet, "/", handlers.Handler{H: pg.ListProducts, L: l})
+		r.With(can(entity.PermissionProductRead)).Method(http.MethodGet, "/search", handlers.Handler{H: pg.SearchProducts, L: l})
+		r.With(can(entity.PermissionProductRead)).Method(http.MethodGet, "/{id}", handlers.Handler{H: pg.GetProduct, L: l})
+		r.With(can(entity.PermissionProductWrite)).Method(http.MethodPatch, "/{id}", handlers.Handler{H: pg.UpdateProduct, L: l})
+		r.With(can(entity.PermissionProductWrite)).Method(http.MethodDelete, "/{id}", handlers.Handler{H: pg.DeleteProduct, L: l})
+		r.With(can(entity.PermissionDeletedRestore)).Method(http.MethodPost, "/{id}/restore", handlers.Handler{H: pg.RestoreProduct, L: l})
 	})
 
 	// Configure routes for Order Group
 	og := handlers.OrderGroup{OrderService: s.Order}
-	r.With().Route("/orders", func(r chi.Router) {
-		r.With().Method(http.MethodPost, "/", handlers.Handler{H: og.CreateOrder, L: l})
-		r.Method(http.MethodGet, "/{id}", handlers.Handler{H: og.GetOrder, L: l})
-		r.Method(http.MethodGet, "/{lastSeenID}/{limit}", handlers.Handler{H: og.ListOrders, L: l})
-		r.With().Method(http.MethodPatch, "/{id}", handlers.Handler{H: og.UpdateOrder, L: l})
-		r.Method(http.MethodDelete, "/{id}", handlers.Handler{H: og.DeleteOrder, L: l})
+	r.With(authenticate).Route("/orders", func(r chi.Router) {
+		r.With(can(entity.PermissionOrderWrite), idempotent).Method(http.MethodPost, "/", handlers.Handler{H: og.CreateOrder, L: l})
+		r.With(can(entity.PermissionOrderRead), deleted).Method(http.MethodGet, "/", handlers.Handler{H: og.ListOrders, L: l})
+		r.With(can(entity.PermissionOrderWrite), idempotent).Method(http.MethodPost, "/checkout", handlers.Handler{H: og.CheckoutOrder, L: l})
+		r.With(can(entity.PermissionOrderRead)).Method(http.MethodGet, "/{id}", handlers.Handler{H: og.GetOrder, L: l})
+		r.With(can(entity.PermissionOrderRead)).Method(http.MethodGet, "/{id}/history", handlers.Handler{H: og.GetOrderHistory, L: l})
+		r.With(can(entity.PermissionOrderWrite)).Method(http.MethodPatch, "/{id}", handlers.Handler{H: og.UpdateOrder, L: l})
+		r.With(can(entity.PermissionOrderWrite)).Method(http.MethodDelete, "/{id}", handlers.Handler{H: og.DeleteOrder, L: l})
+		r.With(can(entity.PermissionDeletedRestore)).Method(http.MethodPost, "/{id}/restore", handlers.Handler{H: og.RestoreOrder, L: l})
 		r.Route("/users", func(r chi.Router) {
-			r.Method(http.MethodGet, "/{userID}", handlers.Handler{H: og.ListUserOrders, L: l})
-			r.Method(http.MethodDelete, "/{userID}", handlers.Handler{H: og.DeleteUserOrders, L: l})
+			r.With(can(entity.PermissionOrderRead)).Method(http.MethodGet, "/{userID}", handlers.Handler{H: og.ListUserOrders, L: l})
+			r.With(can(entity.PermissionOrderWrite)).Method(http.MethodDelete, "/{userID}", handlers.Handler{H: og.DeleteUserOrders, L: l})
 		})
 	})
 
 	// Configure routes for Order Items Group
-	oig := handlers.OrderItemGroup{OrderItemService: s.OrderItem}
-	r.With().Route("/order_items", func(r chi.Router) {
-		r.With().Method(http.MethodPost, "/", handlers.Handler{H: oig.CreateOrderItem, L: l})
-		r.Method(http.MethodGet, "/{id}", handlers.Handler{H: oig.GetOrderItem, L: l})
-		r.With().Method(http.MethodPatch, "/{id}", handlers.Handler{H: oig.UpdateOrderItem, L: l})
-		r.Method(http.MethodDelete, "/{id}", handlers.Handler{H: oig.DeleteOrderItem, L: l})
+	oig := handlers.OrderItemGroup{OrderItemService: s.OrderItem, OrderService: s.Order}
+	r.With(authenticate).Route("/order_items", func(r chi.Router) {
+		r.With(can(entity.PermissionOrderWrite), idempotent).Method(http.MethodPost, "/", handlers.Handler{H: oig.CreateOrderItem, L: l})
+		r.With(can(entity.PermissionOrderRead), deleted).Method(http.MethodGet, "/", handlers.Handler{H: oig.ListOrderItems, L: l})
+		r.With(can(entity.PermissionOrderRead)).Method(http.MethodGet, "/{id}", handlers.Handler{H: oig.GetOrderItem, L: l})
+		r.With(can(entity.PermissionOrderWrite)).Method(http.MethodPatch, "/{id}", handlers.Handler{H: oig.UpdateOrderItem, L: l})
+		r.With(can(entity.PermissionOrderWrite)).Method(http.MethodDelete, "/{id}", handlers.Handler{H: oig.DeleteOrderItem, L: l})
+		r.With(can(entity.PermissionDeletedRestore)).Method(http.MethodPost, "/{id}/restore", handlers.Handler{H: oig.RestoreOrderItem, L: l})
 		// TODO: WHERE SHOULD I PUT EM?
 		r.Route("/orders/{orderID}", func(r chi.Router) {
-			r.Method(http.MethodGet, "/", handlers.Handler{H: oig.ListOrderOrderItems, L: l})
-			r.Method(http.MethodDelete, "/", handlers.Handler{H: oig.DeleteOrderOrderItems, L: l})
+			r.With(can(entity.PermissionOrderRead)).Method(http.MethodGet, "/", handlers.Handler{H: oig.ListOrderOrderItems, L: l})
+			r.With(can(entity.PermissionOrderWrite)).Method(http.MethodDelete, "/", handlers.Handler{H: oig.DeleteOrderOrderItems, L: l})
 		})
 	})
 
+	// Configure routes for Audit Group
+	adg := handlers.AuditGroup{AuditService: s.Audit}
+	r.With(authenticate, can(entity.PermissionAuditRead)).Method(http.MethodGet, "/audit", handlers.Handler{H: adg.ListAuditRecords, L: l})
+
+	// Configure routes for Webhook Group
+	wg := handlers.WebhookGroup{WebhookService: s.Webhook}
+	r.With(authenticate).Route("/webhooks", func(r chi.Router) {
+		r.With(can(entity.PermissionWebhookWrite)).Method(http.MethodPost, "/", handlers.Handler{H: wg.CreateWebhook, L: l})
+		r.With(can(entity.PermissionWebhookRead)).Method(http.MethodGet, "/", handlers.Handler{H: wg.ListWebhooks, L: l})
+		r.With(can(entity.PermissionWebhookRead)).Method(http.MethodGet, "/{id}", handlers.Handler{H: wg.GetWebhook, L: l})
+		r.With(can(entity.PermissionWebhookWrite)).Method(http.MethodPatch, "/{id}", handlers.Handler{H: wg.UpdateWebhook, L: l})
+		r.With(can(entity.PermissionWebhookWrite)).Method(http.MethodDelete, "/{id}", handlers.Handler{H: wg.DeleteWebhook, L: l})
+		r.With(can(entity.PermissionWebhookRead)).Method(http.MethodGet, "/{id}/deliveries", handlers.Handler{H: wg.ListWebhookDeliveries, L: l})
+		r.With(can(entity.PermissionWebhookWrite)).Method(http.MethodPost, "/{id}/deliveries/{deliveryID}/redeliver", handlers.Handler{H: wg.RedeliverWebhookDelivery, L: l})
+	})
+
 	// Configure routes for Status Group
-	sg := handlers.StatusGroup{}
-	r.Method(http.MethodGet, "/status", handlers.Handler{H: sg.Status, L: l})
+	stg := handlers.StatusGroup{}
+	r.With(limit).Method(http.MethodGet, "/status", handlers.Handler{H: stg.Status, L: l})
+
+	// Configure routes for JSON Web Key Set
+	kg := handlers.KeysGroup{Keys: entity.SigningKeys()}
+	r.With(limit).Method(http.MethodGet, "/.well-known/jwks.json", handlers.Handler{H: kg.JWKS, L: l})
 
 	// Configure routes for Documentation
 	handlerSwagger := func(w http.ResponseWriter, r *http.Request) {
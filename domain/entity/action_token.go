@@ -0,0 +1,147 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// TokenPurpose is an action a single-use token is issued for.
+type TokenPurpose string
+
+// Set of actions single-use tokens are issued for.
+const (
+	PurposePasswordReset     TokenPurpose = "password_reset"
+	PurposeEmailVerification TokenPurpose = "email_verification"
+	PurposeTwoFactor         TokenPurpose = "two_factor"
+)
+
+// ActionToken defines a model for a signed single-use token that is sent to a user by email
+// to confirm an action, e.g. password reset, or handed to a client to complete sign in with a second factor.
+// Only an identifier of a token is stored, a signed token itself is handed to a user only.
+type ActionToken struct {
+	UUID    string       `bson:"_id"`
+	UserID  string       `bson:"user_id"`
+	Purpose TokenPurpose `bson:"purpose"`
+	// Email is an address a token was sent to,
+	// so a token stops working when a user changes his email.
+	Email     string `bson:"email"`
+	Token     string `bson:"-"`
+	ExpiresAt int64  `bson:"expires_at"`
+	Used      bool   `bson:"used"`
+}
+
+// ActionTokenClaims is a set of additional claims for jwt action token.
+type ActionTokenClaims struct {
+	User_id string
+	UUID    string
+	Purpose TokenPurpose
+	jwt.StandardClaims
+}
+
+// ForgotPasswordRequest is an email of a user that forgot his password.
+//
+// swagger:model
+type ForgotPasswordRequest struct {
+	// Email of a user
+	//
+	// example: user@google.com
+	// required: true
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordRequest is an information needed to set a new password.
+//
+// swagger:model
+type ResetPasswordRequest struct {
+	// Password reset token sent to a user by email
+	//
+	// required: true
+	Token string `json:"token" validate:"required"`
+
+	// New password of a user
+	//
+	// required: true
+	Password string `json:"password" validate:"required"`
+
+	// Confirmation of a new password
+	//
+	// required: true
+	PasswordConfirm string `json:"password_confirm" validate:"required,eqfield=Password"`
+}
+
+// VerifyEmailRequest is a token that confirms an email of a user.
+//
+// swagger:model
+type VerifyEmailRequest struct {
+	// Email verification token sent to a user by email
+	//
+	// required: true
+	Token string `json:"token" validate:"required"`
+}
+
+// ResendVerificationRequest is an email a verification token should be sent again to.
+//
+// swagger:model
+type ResendVerificationRequest struct {
+	// Email of a user
+	//
+	// example: user@google.com
+	// required: true
+	Email string `json:"email" validate:"required,email"`
+}
+
+// NewActionToken creates a new signed single-use token for a given action
+// that expires after given period of time.
+func NewActionToken(userID, email string, purpose TokenPurpose, ttl time.Duration) (ActionToken, error) {
+	expires := time.Now().Add(ttl).Unix()
+	tokenUUID := uuid.New().String()
+
+	claims := ActionTokenClaims{
+		User_id: userID,
+		UUID:    tokenUUID,
+		Purpose: purpose,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expires,
+		},
+	}
+
+	signedToken, err := signingKeys.Sign(claims)
+	if err != nil {
+		return ActionToken{}, errors.Wrapf(err, "creating %s token", purpose)
+	}
+
+	return ActionToken{
+		UUID:      tokenUUID,
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		Token:     signedToken,
+		ExpiresAt: expires,
+	}, nil
+}
+
+// ParseActionTokenClaims checks validity of action token issued for a given action and returns it's claims.
+func ParseActionTokenClaims(tokenString string, purpose TokenPurpose) (*ActionTokenClaims, error) {
+	token, err := parseJWTToken(tokenString, &ActionTokenClaims{})
+	if err != nil {
+		return &ActionTokenClaims{}, errors.Wrapf(err, "%s token is not valid", purpose)
+	}
+
+	claims, ok := token.Claims.(*ActionTokenClaims)
+	if !ok || !token.Valid || claims.UUID == "" {
+		return &ActionTokenClaims{}, errors.Errorf("%s token is not valid", purpose)
+	}
+
+	if claims.Purpose != purpose {
+		return &ActionTokenClaims{}, errors.Errorf("token is not issued for %s", purpose)
+	}
+
+	if claims.ExpiresAt < time.Now().UTC().Unix() {
+		return &ActionTokenClaims{}, errors.Errorf("%s token is expired", purpose)
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,46 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestActionToken(t *testing.T) {
+	t.Run("Given the need to issue single-use tokens for actions", func(t *testing.T) {
+		reset, err := NewActionToken("user", "user@example.com", PurposePasswordReset, time.Hour)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create a token. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to create a token.", tests.Success)
+
+		claims, err := ParseActionTokenClaims(reset.Token, PurposePasswordReset)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to parse token claims. Error: %s", tests.Failed, err)
+		}
+		if claims.UUID != reset.UUID || claims.User_id != "user" {
+			t.Fatalf("\t%s\tShould keep id of a token and a user in claims, got: %+v", tests.Failed, claims)
+		}
+		t.Logf("\t%s\tShould keep id of a token and a user in claims.", tests.Success)
+
+		if _, err := ParseActionTokenClaims(reset.Token, PurposeEmailVerification); err == nil {
+			t.Fatalf("\t%s\tShould not accept a token issued for other action.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould not accept a token issued for other action.", tests.Success)
+
+		if _, err := ParseAccessTokenClaims(reset.Token); err == nil {
+			t.Fatalf("\t%s\tShould not accept a token as an access token.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould not accept a token as an access token.", tests.Success)
+
+		expired, err := NewActionToken("user", "user@example.com", PurposePasswordReset, -time.Hour)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create a token. Error: %s", tests.Failed, err)
+		}
+		if _, err := ParseActionTokenClaims(expired.Token, PurposePasswordReset); err == nil {
+			t.Fatalf("\t%s\tShould not accept an expired token.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould not accept an expired token.", tests.Success)
+	})
+}
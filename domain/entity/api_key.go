@@ -0,0 +1,156 @@
+package entity
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to recognize.
+const apiKeyPrefix = "cra_"
+
+// ErrInvalidAPIKey is returned when API key is unknown or expired.
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKey is a long-lived key a machine client authenticates with on behalf of a user.
+// A key grants only permissions listed in it`s scopes that roles of a user grant as well.
+// Only a hash of a key is stored, a key itself is shown once on creation.
+//
+// swagger:model
+type APIKey struct {
+	// The UUID of an API key
+	//
+	// required: true
+	ID string `db:"api_key_id" json:"id"`
+
+	// The UUID of a user an API key belongs to
+	//
+	// required: true
+	UserID string `db:"user_id" json:"user_id"`
+
+	// Name of an API key given by a user
+	//
+	// example: Nightly export
+	Name string `db:"name" json:"name"`
+
+	// First characters of an API key that help to tell keys apart
+	//
+	// example: cra_Xk3v
+	Prefix string `db:"prefix" json:"prefix"`
+
+	// SHA-256 hash of an API key, it is never sent to clients
+	//
+	Hash string `db:"key_hash" json:"-"`
+
+	// Permissions an API key is limited to
+	//
+	// example: ["product:read", "order:read:own"]
+	Scopes pq.StringArray `db:"scopes" json:"scopes"`
+
+	// Time an API key expires at
+	//
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+
+	// Time an API key was last used at, it is updated at most once a minute
+	//
+	LastUsed *time.Time `db:"last_used" json:"last_used"`
+
+	// Date of an API key creation
+	//
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+}
+
+// NewAPIKey is an information needed to create a new API key.
+//
+// swagger:model
+type NewAPIKey struct {
+	// Name of an API key
+	//
+	// example: Nightly export
+	// required: true
+	Name string `json:"name" validate:"required"`
+
+	// Permissions an API key is limited to
+	//
+	// example: ["product:read", "order:read:own"]
+	// required: true
+	Scopes []string `json:"scopes" validate:"required,min=1"`
+
+	// Time an API key expires at
+	//
+	// required: true
+	ExpiresAt time.Time `json:"expires_at" validate:"required"`
+}
+
+// CreatedAPIKey is a newly created API key along with a key itself.
+//
+// swagger:model
+type CreatedAPIKey struct {
+	APIKey
+
+	// API key, it is shown only once and should be sent in "Authorization: ApiKey <key>" header
+	//
+	// required: true
+	Key string `json:"key"`
+}
+
+// GenerateAPIKey generates a new random API key and returns it along with it`s hash.
+func GenerateAPIKey() (key string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", errors.Wrap(err, "generating API key")
+	}
+
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns a hash API key is stored and looked up by.
+// API keys are random enough, so a fast hash is as safe as a slow one.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyPrefix returns first characters of API key that are shown to tell keys apart.
+func APIKeyPrefix(key string) string {
+	const n = len(apiKeyPrefix) + 4
+	if len(key) < n {
+		return key
+	}
+	return key[:n]
+}
+
+// ValidateScopes checks that API key scopes are permissions in resource:action or resource:action:own format.
+func ValidateScopes(scopes []string) error {
+	for _, s := range scopes {
+		parts := strings.Split(s, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" ||
+			(len(parts) == 3 && ":"+parts[2] != ownSuffix) {
+			return errors.Errorf("scope %q is not a permission", s)
+		}
+	}
+
+	return nil
+}
+
+// ScopesGrant checks whether API key scopes include a permission.
+// If only a limited to owned resources version of a permission is included, own is true.
+func ScopesGrant(scopes []string, p Permission) (granted bool, own bool) {
+	for _, s := range scopes {
+		switch Permission(s) {
+		case p:
+			return true, false
+		case p.Own():
+			granted, own = true, true
+		}
+	}
+
+	return granted, own
+}
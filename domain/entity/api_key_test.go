@@ -0,0 +1,81 @@
+package entity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestAPIKey(t *testing.T) {
+	t.Run("Given the need to generate an API key", func(t *testing.T) {
+		key, hash, err := GenerateAPIKey()
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to generate API key. Error: %s", tests.Failed, err)
+		}
+
+		if !strings.HasPrefix(key, apiKeyPrefix) || APIKeyPrefix(key) != key[:len(apiKeyPrefix)+4] {
+			t.Fatalf("\t%s\tShould generate recognizable API key, got: %s", tests.Failed, key)
+		}
+		t.Logf("\t%s\tShould generate recognizable API key.", tests.Success)
+
+		if hash != HashAPIKey(key) || hash == key {
+			t.Fatalf("\t%s\tShould return hash of API key.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould return hash of API key.", tests.Success)
+
+		other, _, err := GenerateAPIKey()
+		if err != nil || other == key {
+			t.Fatalf("\t%s\tShould generate unique API keys.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould generate unique API keys.", tests.Success)
+	})
+
+	t.Run("Given the need to validate API key scopes", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			scopes   []string
+			valid    bool
+		}{
+			{testName: "permissions", scopes: []string{"product:read", "order:write"}, valid: true},
+			{testName: "permission limited to own resources", scopes: []string{"order:read:own"}, valid: true},
+			{testName: "permission without action", scopes: []string{"product"}, valid: false},
+			{testName: "permission with unknown suffix", scopes: []string{"order:read:all"}, valid: false},
+			{testName: "empty scope", scopes: []string{""}, valid: false},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				err := ValidateScopes(tc.scopes)
+				if (err == nil) != tc.valid {
+					t.Fatalf("\t%s\tTest %d:\tWant valid: %t, got error: %v", tests.Failed, testID, tc.valid, err)
+				}
+				t.Logf("\t%s\tTest %d:\tWant valid: %t, got error: %v", tests.Success, testID, tc.valid, err)
+			})
+		}
+	})
+
+	t.Run("Given the need to check permissions of API key scopes", func(t *testing.T) {
+		tt := []struct {
+			testName   string
+			scopes     []string
+			permission Permission
+			granted    bool
+			own        bool
+		}{
+			{testName: "scope grants permission", scopes: []string{"product:read"}, permission: PermissionProductRead, granted: true},
+			{testName: "scope grants permission limited to own resources", scopes: []string{"order:read:own"}, permission: PermissionOrderRead, granted: true, own: true},
+			{testName: "unlimited scope wins over limited one", scopes: []string{"order:read:own", "order:read"}, permission: PermissionOrderRead, granted: true},
+			{testName: "scope does not grant other permission", scopes: []string{"product:read"}, permission: PermissionProductWrite, granted: false},
+			{testName: "no scopes", permission: PermissionProductRead, granted: false},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				granted, own := ScopesGrant(tc.scopes, tc.permission)
+				if granted != tc.granted || own != tc.own {
+					t.Fatalf("\t%s\tTest %d:\tWant granted: %t, own: %t, got granted: %t, own: %t", tests.Failed, testID, tc.granted, tc.own, granted, own)
+				}
+				t.Logf("\t%s\tTest %d:\tWant granted: %t, own: %t, got granted: %t, own: %t", tests.Success, testID, tc.granted, tc.own, granted, own)
+			})
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package entity
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AuditAction is a kind of change made to an entity.
+type AuditAction string
+
+// Set of audited actions.
+const (
+	AuditActionCreate  AuditAction = "create"
+	AuditActionUpdate  AuditAction = "update"
+	AuditActionDelete  AuditAction = "delete"
+	AuditActionRestore AuditAction = "restore"
+)
+
+// Set of audited entity types.
+const (
+	AuditEntityUser      = "user"
+	AuditEntityProduct   = "product"
+	AuditEntityOrder     = "order"
+	AuditEntityOrderItem = "order_item"
+)
+
+// AuditRecord is a record of a change made to an entity, it tells who changed what and how.
+// Records are never changed once they are saved.
+//
+// swagger:model
+type AuditRecord struct {
+	// The UUID of an audit record
+	//
+	// required: true
+	ID string `db:"audit_id" json:"id"`
+
+	// The UUID of a user that made a change, it is empty for changes made by anonymous users (e.g. sign up)
+	//
+	ActorID string `db:"actor_id" json:"actor_id,omitempty"`
+
+	// The UUID of a request a change was made within
+	//
+	RequestID string `db:"request_id" json:"request_id,omitempty"`
+
+	// Type of a changed entity
+	//
+	// example: product
+	EntityType string `db:"entity_type" json:"entity_type"`
+
+	// The UUID of a changed entity
+	//
+	EntityID string `db:"entity_id" json:"entity_id"`
+
+	// Kind of a change
+	//
+	// example: update
+	Action AuditAction `db:"action" json:"action"`
+
+	// Changed fields of an entity with their values before and after a change
+	//
+	// example: {"price": {"before": "10.00", "after": "12.50"}}
+	Changes AuditChanges `db:"changes" json:"changes"`
+
+	// Date of a change
+	//
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+}
+
+// NewAuditRecord contains information about a change made to an entity.
+type NewAuditRecord struct {
+	ActorID    string
+	RequestID  string
+	EntityType string
+	EntityID   string
+	Action     AuditAction
+	Changes    AuditChanges
+}
+
+// Actor is a user that makes changes along with a request the changes are made within.
+type Actor struct {
+	UserID    string
+	RequestID string
+}
+
+// actorKey is the context.Context key to store an actor.
+var actorKey = &struct{ name string }{"actor"}
+
+// WithActor returns a copy of the given context that carries an actor,
+// so changes made by services with that context are recorded on behalf of the actor.
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey, a)
+}
+
+// ActorFromContext returns an actor carried by the given context,
+// changes made with a context without an actor are recorded as anonymous ones.
+func ActorFromContext(ctx context.Context) Actor {
+	a, _ := ctx.Value(actorKey).(Actor)
+	return a
+}
+
+// AuditChange holds JSON values of a single field of an entity before and after a change.
+// A value is missing if an entity did not exist before or after a change.
+type AuditChange struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditChanges is a set of changed fields of an entity that is stored as JSON.
+type AuditChanges map[string]AuditChange
+
+// DiffAudit returns fields of an entity which JSON values differ between before and after states.
+// Either state can be nil, e.g. there is no before state of a created entity.
+// Fields hidden from JSON (e.g. password hashes) never get into audit records.
+func DiffAudit(before, after interface{}) (AuditChanges, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding state before a change")
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding state after a change")
+	}
+
+	changes := make(AuditChanges)
+	for field, b := range beforeFields {
+		if a := afterFields[field]; !bytes.Equal(a, b) {
+			changes[field] = AuditChange{Before: b, After: a}
+		}
+	}
+	for field, a := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			changes[field] = AuditChange{After: a}
+		}
+	}
+
+	return changes, nil
+}
+
+// jsonFields encodes v into JSON and splits it into top level fields.
+func jsonFields(v interface{}) (map[string]json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// Value implements driver.Valuer interface.
+func (c AuditChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(c)
+}
+
+// Scan implements sql.Scanner interface.
+func (c *AuditChanges) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return errors.Errorf("can not scan %T into audit changes", src)
+	}
+}
@@ -0,0 +1,66 @@
+package entity
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestDiffAudit(t *testing.T) {
+	t.Run("Given the need to find changed fields of an entity", func(t *testing.T) {
+		product := Product{ID: "1", Title: "Tea", Price: 1000, Stock: 5, Version: 1}
+		changed := product
+		changed.Price = 1250
+		changed.Version = 2
+
+		user := User{ID: "1", UserName: "user", Password: []byte("hash")}
+		rehashed := user
+		rehashed.Password = []byte("other hash")
+
+		tt := []struct {
+			testName string
+			before   interface{}
+			after    interface{}
+			changes  string
+		}{
+			{
+				testName: "Updated entity",
+				before:   product,
+				after:    changed,
+				changes:  `{"price":{"before":10.00,"after":12.50},"version":{"before":1,"after":2}}`,
+			},
+			{
+				testName: "Unchanged entity",
+				before:   product,
+				after:    product,
+				changes:  `{}`,
+			},
+			{
+				testName: "Created entity",
+				after:    OrderItem{ID: "1", OrderID: "2", Quantity: 3},
+				changes:  `{"date_created":{"after":"0001-01-01T00:00:00Z"},"date_updated":{"after":"0001-01-01T00:00:00Z"},"order_id":{"after":"2"},"order_item_id":{"after":"1"},"product_id":{"after":""},"product_title":{"after":""},"quantity":{"after":3},"unit_price":{"after":0.00},"version":{"after":0}}`,
+			},
+			{
+				testName: "Hidden fields",
+				before:   user,
+				after:    rehashed,
+				changes:  `{}`,
+			},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				changes, err := DiffAudit(tc.before, tc.after)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to find changed fields. Error: %s", tests.Failed, testID, err)
+				}
+
+				data, err := json.Marshal(changes)
+				if err != nil || string(data) != tc.changes {
+					t.Fatalf("\t%s\tTest %d:\tWant changes: %s, got: %s (%v)", tests.Failed, testID, tc.changes, data, err)
+				}
+				t.Logf("\t%s\tTest %d:\tWant changes: %s, got: %s", tests.Success, testID, tc.changes, data)
+			})
+		}
+	})
+}
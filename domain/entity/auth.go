@@ -1,13 +1,13 @@
 package entity
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/rtbe/clean-rest-api/internal/config"
+	"github.com/rtbe/clean-rest-api/internal/keys"
 )
 
 var (
@@ -15,6 +15,18 @@ var (
 	UserRole  = "USER"
 )
 
+const (
+	// AccessTokenTTL is a period of time access token is valid for.
+	AccessTokenTTL = time.Hour
+
+	// RefreshTokenTTL is a period of time refresh token is valid for.
+	RefreshTokenTTL = 15 * time.Minute
+
+	// SessionTTL is a period of time a session lasts since it`s tokens were issued last time.
+	// Access tokens stop working along with their session, so it lasts as long as the longest lived of them, an access token.
+	SessionTTL = AccessTokenTTL
+)
+
 // TokenPairModel is an pair of access/refresh tokens.
 //
 // swagger:model
@@ -30,7 +42,19 @@ type TokenPairModel struct {
 	RefreshToken string `json:"refresh_token,omitempty" validate:"required"`
 }
 
-var jwtSalt = config.New().JWTSalt
+// signingKeys are keys JWT tokens are signed and verified with.
+// Until keys are configured with SetSigningKeys tokens are signed with HS512 using JWT salt.
+var signingKeys = keys.NewHMACSet([]byte(config.New().JWTSalt))
+
+// SetSigningKeys replaces keys JWT tokens are signed and verified with.
+func SetSigningKeys(s *keys.Set) {
+	signingKeys = s
+}
+
+// SigningKeys returns keys JWT tokens are signed and verified with.
+func SigningKeys() *keys.Set {
+	return signingKeys
+}
 
 // Auth defines model for authentication.
 type Auth struct {
@@ -39,6 +63,34 @@ type Auth struct {
 	Email    string
 }
 
+// Credentials is an information needed to sign in.
+//
+// swagger:model
+type Credentials struct {
+	// Username of a user
+	//
+	// required: true
+	UserName string `json:"user_name" validate:"required"`
+
+	// Password of a user
+	//
+	// required: true
+	Password string `json:"password" validate:"required"`
+
+	// Name of a device a user signs in from, e.g. "Work laptop"
+	Device string `json:"device,omitempty"`
+}
+
+// RefreshRequest is a refresh token presented to get a fresh pair of tokens.
+//
+// swagger:model
+type RefreshRequest struct {
+	// JWT refresh token
+	//
+	// required: true
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
 // AccessToken defines model for jwt access token.
 type AccessToken struct {
 	Token     string
@@ -46,10 +98,14 @@ type AccessToken struct {
 }
 
 // RefreshToken defines a model for jwt refresh token.
+// Every refresh token belongs to a family of tokens that were issued one after another
+// by rotation, starting from a single sign in.
+// Only an identifier of a token is stored, a signed token itself is handed to a client only.
 type RefreshToken struct {
 	UUID      string `bson:"_id"`
+	FamilyID  string `bson:"family_id"`
 	UserID    string `bson:"user_id"`
-	Token     string `bson:"token"`
+	Token     string `bson:"-"`
 	ExpiresAt int64  `bson:"expires_at"`
 	Used      bool   `bson:"used"`
 }
@@ -80,29 +136,48 @@ type AccessTokenClaims struct {
 	User_id string
 	//This field helps to bind access token to appropriate refresh token.
 	Refresh_uuid string
-	User_roles   []string
+	//This field is an id of a session access token was issued within.
+	Session_id string
+	User_roles []string
+	//These fields are set only for requests authenticated with API key,
+	//such requests are limited to permissions listed in scopes of a key.
+	Api_key_id string   `json:",omitempty"`
+	Scopes     []string `json:",omitempty"`
 	jwt.StandardClaims
 }
 
+// IsAPIKey reports whether claims belong to a request authenticated with API key rather than access token.
+func (c *AccessTokenClaims) IsAPIKey() bool {
+	return c.Api_key_id != ""
+}
+
 // RefreshTokenClaims is a set of additional claims for jwt refresh token.
 type RefreshTokenClaims struct {
-	User_id string
-	UUID    string
+	User_id   string
+	UUID      string
+	Family_id string
 	jwt.StandardClaims
 }
 
-// NewTokenPair creates a new pair of access and refresh jwt tokens.
+// NewTokenPair creates a new pair of access and refresh jwt tokens
+// that starts a new family of refresh tokens.
 func NewTokenPair(userID string, userRoles []string) (*JWTTokenPair, error) {
-	refreshTokenExp := time.Now().Add(time.Minute * 15).Unix()
+	return NewTokenPairInFamily(userID, userRoles, uuid.New().String())
+}
+
+// NewTokenPairInFamily creates a new pair of access and refresh jwt tokens
+// with refresh token that belongs to a given family.
+func NewTokenPairInFamily(userID string, userRoles []string, familyID string) (*JWTTokenPair, error) {
+	refreshTokenExp := time.Now().Add(RefreshTokenTTL).Unix()
 	refreshTokenUUID := uuid.New().String()
 
-	refreshToken, err := createRefreshToken(userID, refreshTokenUUID, refreshTokenExp)
+	refreshToken, err := createRefreshToken(userID, refreshTokenUUID, familyID, refreshTokenExp)
 	if err != nil {
 		return &JWTTokenPair{}, errors.Wrap(err, "creating refresh token")
 	}
 
-	accessTokenExp := time.Now().Add(time.Hour * 1).Unix()
-	accessToken, err := createAccessToken(userID, refreshTokenUUID, userRoles, accessTokenExp)
+	accessTokenExp := time.Now().Add(AccessTokenTTL).Unix()
+	accessToken, err := createAccessToken(userID, refreshTokenUUID, familyID, userRoles, accessTokenExp)
 	if err != nil {
 		return &JWTTokenPair{}, errors.Wrap(err, "creating access token")
 	}
@@ -115,6 +190,7 @@ func NewTokenPair(userID string, userRoles []string) (*JWTTokenPair, error) {
 		RefreshToken: RefreshToken{
 			UserID:    userID,
 			UUID:      refreshTokenUUID,
+			FamilyID:  familyID,
 			Token:     refreshToken,
 			ExpiresAt: refreshTokenExp,
 			Used:      false,
@@ -125,18 +201,18 @@ func NewTokenPair(userID string, userRoles []string) (*JWTTokenPair, error) {
 }
 
 // createAccessToken creates a new jwt access token.
-func createAccessToken(userID string, refreshUUID string, userRoles []string, expires int64) (string, error) {
+func createAccessToken(userID string, refreshUUID string, sessionID string, userRoles []string, expires int64) (string, error) {
 	claims := AccessTokenClaims{
 		User_id:      userID,
 		Refresh_uuid: refreshUUID,
+		Session_id:   sessionID,
 		User_roles:   userRoles,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expires,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
-	signedToken, err := token.SignedString([]byte(jwtSalt))
+	signedToken, err := signingKeys.Sign(claims)
 	if err != nil {
 		return "", errors.Wrap(err, "creating access token")
 	}
@@ -145,17 +221,17 @@ func createAccessToken(userID string, refreshUUID string, userRoles []string, ex
 }
 
 // createRefreshToken creates a new jwt refresh token.
-func createRefreshToken(userID, UUID string, expires int64) (string, error) {
+func createRefreshToken(userID, UUID, familyID string, expires int64) (string, error) {
 	claims := RefreshTokenClaims{
-		User_id: userID,
-		UUID:    UUID,
+		User_id:   userID,
+		UUID:      UUID,
+		Family_id: familyID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expires,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
-	signedToken, err := token.SignedString([]byte(jwtSalt))
+	signedToken, err := signingKeys.Sign(claims)
 	if err != nil {
 		return "", errors.Wrap(err, "creating refresh token")
 	}
@@ -190,8 +266,10 @@ func ParseAccessTokenClaims(tokenString string) (*AccessTokenClaims, error) {
 		return &AccessTokenClaims{}, errors.Wrap(err, "access token is not valid")
 	}
 
+	// Every access token is issued within a session,
+	// so tokens of other kinds signed with the same keys are not accepted as access tokens.
 	claims, ok := token.Claims.(*AccessTokenClaims)
-	if !ok || !token.Valid {
+	if !ok || !token.Valid || claims.Session_id == "" {
 		return &AccessTokenClaims{}, errors.New("access token is not valid")
 	}
 
@@ -204,12 +282,7 @@ func ParseAccessTokenClaims(tokenString string) (*AccessTokenClaims, error) {
 
 // parseJWTToken parses token string into jwt token.
 func parseJWTToken(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return []byte(jwtSalt), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, signingKeys.Keyfunc)
 	if err != nil {
 		return nil, errors.Wrap(err, "JWT token is not valid")
 	}
@@ -0,0 +1,46 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestTokenFamily(t *testing.T) {
+	t.Run("Given the need to rotate refresh tokens within a family", func(t *testing.T) {
+		first, err := NewTokenPair("user", []string{UserRole})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create a token pair. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to create a token pair.", tests.Success)
+
+		rotated, err := NewTokenPairInFamily("user", []string{UserRole}, first.RefreshToken.FamilyID)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create a token pair in a family. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to create a token pair in a family.", tests.Success)
+
+		if rotated.RefreshToken.UUID == first.RefreshToken.UUID {
+			t.Fatalf("\t%s\tShould issue a refresh token with a new id.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould issue a refresh token with a new id.", tests.Success)
+
+		claims, err := ParseRefreshTokenClaims(rotated.RefreshToken.Token)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to parse refresh token claims. Error: %s", tests.Failed, err)
+		}
+		if claims.Family_id != first.RefreshToken.FamilyID || claims.UUID != rotated.RefreshToken.UUID {
+			t.Fatalf("\t%s\tShould keep a family of a token in claims. Want: %s, got: %s", tests.Failed, first.RefreshToken.FamilyID, claims.Family_id)
+		}
+		t.Logf("\t%s\tShould keep a family of a token in claims.", tests.Success)
+
+		other, err := NewTokenPair("user", []string{UserRole})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create a token pair. Error: %s", tests.Failed, err)
+		}
+		if other.RefreshToken.FamilyID == first.RefreshToken.FamilyID {
+			t.Fatalf("\t%s\tShould start a new family on every sign in.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould start a new family on every sign in.", tests.Success)
+	})
+}
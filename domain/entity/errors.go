@@ -0,0 +1,74 @@
+package entity
+
+import (
+	"github.com/rtbe/clean-rest-api/internal/validation"
+)
+
+// Domain errors tell what kind of failure happened regardless of a layer it happened in,
+// so errors of the same kind are presented to a client the same way.
+// Sentinel errors are values of these types, so they still can be compared with errors.Cause(err) == ErrSomething.
+
+// NotFoundError is returned when a requested entity does not exist.
+type NotFoundError string
+
+// Error implements error interface.
+func (e NotFoundError) Error() string {
+	return string(e)
+}
+
+// ConflictError is returned when a change conflicts with current state of entities,
+// e.g. a unique value is already taken or an entity is referenced by others.
+type ConflictError string
+
+// Error implements error interface.
+func (e ConflictError) Error() string {
+	return string(e)
+}
+
+// UnauthorizedError is returned when a client can not be authenticated.
+type UnauthorizedError string
+
+// Error implements error interface.
+func (e UnauthorizedError) Error() string {
+	return string(e)
+}
+
+// ForbiddenError is returned when an authenticated client is not allowed to do what it asks for.
+type ForbiddenError string
+
+// Error implements error interface.
+func (e ForbiddenError) Error() string {
+	return string(e)
+}
+
+// PreconditionFailedError is returned when a change is based on a state of an entity that is not current anymore.
+type PreconditionFailedError string
+
+// Error implements error interface.
+func (e PreconditionFailedError) Error() string {
+	return string(e)
+}
+
+// ValidationError is returned when given data is invalid.
+// Fields tell which fields of it are wrong and why, if it is known.
+type ValidationError struct {
+	Msg    string
+	Fields validation.FieldErrors
+}
+
+// NewValidationError creates a validation error of invalid fields.
+func NewValidationError(fields validation.FieldErrors) *ValidationError {
+	return &ValidationError{
+		Msg:    "validation error",
+		Fields: fields,
+	}
+}
+
+// Error implements error interface.
+func (e *ValidationError) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Msg
+	}
+
+	return e.Msg + ": " + e.Fields.Error()
+}
@@ -0,0 +1,137 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// EventType is a name of a domain event.
+type EventType string
+
+// Set of domain events other systems can learn about.
+const (
+	EventOrderCreated        EventType = "OrderCreated"
+	EventOrderStatusChanged  EventType = "OrderStatusChanged"
+	EventProductStockChanged EventType = "ProductStockChanged"
+	EventUserRegistered      EventType = "UserRegistered"
+)
+
+// Set of aggregates domain events belong to, events of an aggregate are published in order they happened.
+const (
+	AggregateOrder   = "order"
+	AggregateProduct = "product"
+	AggregateUser    = "user"
+)
+
+// EventPayload is a body of a domain event.
+type EventPayload interface {
+	EventType() EventType
+}
+
+// OrderCreated happens when a new order is created or checked out.
+type OrderCreated struct {
+	OrderID string             `json:"order_id"`
+	UserID  string             `json:"user_id"`
+	Status  string             `json:"status"`
+	Total   Money              `json:"total"`
+	Items   []OrderCreatedItem `json:"items"`
+}
+
+// OrderCreatedItem is an item of a created order.
+type OrderCreatedItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+	UnitPrice Money  `json:"unit_price"`
+}
+
+// EventType implements EventPayload interface.
+func (OrderCreated) EventType() EventType { return EventOrderCreated }
+
+// OrderStatusChanged happens when an order moves to another status of it`s lifecycle.
+type OrderStatusChanged struct {
+	OrderID    string `json:"order_id"`
+	FromStatus string `json:"from_status"`
+	ToStatus   string `json:"to_status"`
+	Actor      string `json:"actor"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// EventType implements EventPayload interface.
+func (OrderStatusChanged) EventType() EventType { return EventOrderStatusChanged }
+
+// ProductStockChanged happens when a product is restocked or reserved by a checkout.
+type ProductStockChanged struct {
+	ProductID string `json:"product_id"`
+	FromStock int    `json:"from_stock"`
+	ToStock   int    `json:"to_stock"`
+}
+
+// EventType implements EventPayload interface.
+func (ProductStockChanged) EventType() EventType { return EventProductStockChanged }
+
+// UserRegistered happens when a new user signs up.
+type UserRegistered struct {
+	UserID   string `json:"user_id"`
+	UserName string `json:"user_name"`
+	Email    string `json:"email"`
+}
+
+// EventType implements EventPayload interface.
+func (UserRegistered) EventType() EventType { return EventUserRegistered }
+
+// Event is a domain event kept in outbox until it is published.
+// Events are published at least once, so consumers should tell repeated events apart by their ids.
+type Event struct {
+	ID            string          `db:"event_id" json:"id"`
+	Sequence      int64           `db:"sequence" json:"-"`
+	AggregateType string          `db:"aggregate_type" json:"aggregate_type"`
+	AggregateID   string          `db:"aggregate_id" json:"aggregate_id"`
+	Type          EventType       `db:"event_type" json:"type"`
+	Payload       json.RawMessage `db:"payload" json:"payload"`
+
+	// Attempts is a number of failed attempts to publish an event.
+	Attempts      int        `db:"attempts" json:"-"`
+	LastError     string     `db:"last_error" json:"-"`
+	NextAttemptAt time.Time  `db:"next_attempt_at" json:"-"`
+	PublishedAt   *time.Time `db:"published_at" json:"-"`
+
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+}
+
+// NewEvent contains information about a domain event that happened to an aggregate.
+type NewEvent struct {
+	AggregateType string
+	AggregateID   string
+	Type          EventType
+	Payload       json.RawMessage
+}
+
+// NewDomainEvent encodes a payload of a domain event that happened to an aggregate.
+func NewDomainEvent(aggregateType, aggregateID string, payload EventPayload) (NewEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return NewEvent{}, errors.Wrapf(err, "encoding %s event", payload.EventType())
+	}
+
+	return NewEvent{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Type:          payload.EventType(),
+		Payload:       data,
+	}, nil
+}
+
+// EventRetryDelay returns a delay before next attempt to publish an event after given number of failed attempts.
+// Delay doubles with each attempt starting from base, but never exceeds max.
+func EventRetryDelay(attempts int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestEvent(t *testing.T) {
+	t.Run("Given the need to encode a domain event", func(t *testing.T) {
+		ne, err := NewDomainEvent(AggregateProduct, "1", ProductStockChanged{ProductID: "1", FromStock: 5, ToStock: 3})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to encode an event. Error: %s", tests.Failed, err)
+		}
+
+		want := `{"product_id":"1","from_stock":5,"to_stock":3}`
+		if ne.Type != EventProductStockChanged || string(ne.Payload) != want {
+			t.Fatalf("\t%s\tWant %s event with payload: %s, got %s event with payload: %s", tests.Failed, EventProductStockChanged, want, ne.Type, ne.Payload)
+		}
+		t.Logf("\t%s\tWant %s event with payload: %s", tests.Success, EventProductStockChanged, want)
+	})
+
+	t.Run("Given the need to delay retries of an event", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			attempts int
+			delay    time.Duration
+		}{
+			{testName: "First retry", attempts: 1, delay: time.Second},
+			{testName: "Third retry", attempts: 3, delay: 4 * time.Second},
+			{testName: "Retry after many attempts", attempts: 100, delay: time.Minute},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				if delay := EventRetryDelay(tc.attempts, time.Second, time.Minute); delay != tc.delay {
+					t.Fatalf("\t%s\tTest %d:\tWant delay: %v, got: %v", tests.Failed, testID, tc.delay, delay)
+				}
+				t.Logf("\t%s\tTest %d:\tWant delay: %v", tests.Success, testID, tc.delay)
+			})
+		}
+	})
+}
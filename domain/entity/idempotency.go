@@ -0,0 +1,79 @@
+package entity
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IdempotencyRecord is a request made with Idempotency-Key header along with a response to it,
+// so retries of the request get the same response instead of repeating it`s effects.
+// A record without status code belongs to a request that is still in progress,
+// unless it`s lock is over, which means a request was abandoned, e.g. because of a crash.
+type IdempotencyRecord struct {
+	// Principal is a client that made a request, keys of different clients do not clash.
+	Principal string `db:"principal"`
+
+	// Key is a value of Idempotency-Key header.
+	Key string `db:"idempotency_key"`
+
+	// Fingerprint is a hash of a request, a key can not be reused for a different request.
+	Fingerprint string `db:"fingerprint"`
+
+	StatusCode int            `db:"status_code"`
+	Header     ResponseHeader `db:"header"`
+	Body       []byte         `db:"body"`
+
+	// LockedUntil is a time a request in progress holds a key till.
+	LockedUntil time.Time `db:"locked_until"`
+	ExpiresAt   time.Time `db:"expires_at"`
+	DateCreated time.Time `db:"date_created"`
+}
+
+// Completed reports whether a response to a request is saved.
+func (r IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
+
+// Abandoned reports whether a request was not completed before it`s lock is over at a given time.
+func (r IdempotencyRecord) Abandoned(now time.Time) bool {
+	return !r.Completed() && !r.LockedUntil.After(now)
+}
+
+// RequestFingerprint returns a hash that tells requests with different method, path or body apart.
+func RequestFingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ResponseHeader is a set of HTTP response headers that is stored as JSON.
+type ResponseHeader map[string][]string
+
+// Value implements driver.Valuer interface.
+func (h ResponseHeader) Value() (driver.Value, error) {
+	if h == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(h)
+}
+
+// Scan implements sql.Scanner interface.
+func (h *ResponseHeader) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*h = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, h)
+	case string:
+		return json.Unmarshal([]byte(v), h)
+	default:
+		return errors.Errorf("can not scan %T into response header", src)
+	}
+}
@@ -0,0 +1,63 @@
+package entity
+
+import (
+	"strings"
+	"time"
+)
+
+// LoginAttempts is a count of failed sign in attempts made with particular user name or from particular IP address.
+type LoginAttempts struct {
+	// Key is what attempts are counted by, see UserNameAttemptsKey and IPAttemptsKey.
+	Key         string    `bson:"_id"`
+	Failures    int       `bson:"failures"`
+	LastFailure time.Time `bson:"last_failure"`
+}
+
+// UserNameAttemptsKey returns a key failed sign in attempts with a user name are counted by.
+func UserNameAttemptsKey(userName string) string {
+	return "user:" + strings.ToLower(userName)
+}
+
+// IPAttemptsKey returns a key failed sign in attempts from an IP address are counted by.
+func IPAttemptsKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginThrottle is a policy that slows down password guessing.
+// Once half of MaxFailures attempts failed, every next attempt is allowed only after a delay
+// that starts at BackoffBase and doubles with every failure.
+// After MaxFailures failures sign in is blocked for Lockout.
+// Failures are forgotten after Window passed since the last one.
+type LoginThrottle struct {
+	MaxFailures int
+	BackoffBase time.Duration
+	Lockout     time.Duration
+	Window      time.Duration
+}
+
+// BlockedUntil returns time until which sign in attempts are rejected.
+// Zero time means that attempts are not blocked.
+func (lt LoginThrottle) BlockedUntil(a LoginAttempts) time.Time {
+	if lt.MaxFailures <= 0 || a.Failures == 0 {
+		return time.Time{}
+	}
+
+	if a.Failures >= lt.MaxFailures {
+		return a.LastFailure.Add(lt.Lockout)
+	}
+
+	free := lt.MaxFailures / 2
+	if a.Failures <= free {
+		return time.Time{}
+	}
+
+	delay := lt.BackoffBase
+	for i := free + 1; i < a.Failures && delay < lt.Lockout; i++ {
+		delay *= 2
+	}
+	if delay > lt.Lockout {
+		delay = lt.Lockout
+	}
+
+	return a.LastFailure.Add(delay)
+}
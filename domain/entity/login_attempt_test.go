@@ -0,0 +1,61 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	t.Run("Given the need to slow down password guessing", func(t *testing.T) {
+		lt := LoginThrottle{MaxFailures: 6, BackoffBase: time.Second, Lockout: 15 * time.Minute, Window: time.Hour}
+		last := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		tt := []struct {
+			testName string
+			failures int
+			blocked  time.Duration
+		}{
+			{testName: "no failures", failures: 0},
+			{testName: "first failures are free", failures: 3},
+			{testName: "backoff starts after half of max failures", failures: 4, blocked: time.Second},
+			{testName: "backoff doubles with every failure", failures: 5, blocked: 2 * time.Second},
+			{testName: "lockout after max failures", failures: 6, blocked: 15 * time.Minute},
+			{testName: "lockout after more than max failures", failures: 9, blocked: 15 * time.Minute},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				until := lt.BlockedUntil(LoginAttempts{Failures: tc.failures, LastFailure: last})
+
+				var want time.Time
+				if tc.blocked != 0 {
+					want = last.Add(tc.blocked)
+				}
+				if !until.Equal(want) {
+					t.Fatalf("\t%s\tTest %d:\tWant blocked until: %v, got: %v", tests.Failed, testID, want, until)
+				}
+				t.Logf("\t%s\tTest %d:\tWant blocked until: %v, got: %v", tests.Success, testID, want, until)
+			})
+		}
+	})
+
+	t.Run("Given the need to cap backoff with lockout", func(t *testing.T) {
+		lt := LoginThrottle{MaxFailures: 100, BackoffBase: time.Second, Lockout: time.Minute, Window: time.Hour}
+		last := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		until := lt.BlockedUntil(LoginAttempts{Failures: 99, LastFailure: last})
+		if !until.Equal(last.Add(time.Minute)) {
+			t.Fatalf("\t%s\tWant blocked until: %v, got: %v", tests.Failed, last.Add(time.Minute), until)
+		}
+		t.Logf("\t%s\tWant blocked until: %v, got: %v", tests.Success, last.Add(time.Minute), until)
+	})
+
+	t.Run("Given the need to disable throttling", func(t *testing.T) {
+		until := LoginThrottle{}.BlockedUntil(LoginAttempts{Failures: 1000, LastFailure: time.Now()})
+		if !until.IsZero() {
+			t.Fatalf("\t%s\tWant attempts not to be blocked, got blocked until: %v", tests.Failed, until)
+		}
+		t.Logf("\t%s\tWant attempts not to be blocked.", tests.Success)
+	})
+}
@@ -0,0 +1,130 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Money is an amount of money in minor units (cents),
+// so arithmetic on it is exact unlike arithmetic on floating point numbers.
+// It is represented as a decimal number with two fractional digits in JSON and in database.
+//
+// swagger:strfmt decimal
+type Money int64
+
+// ErrInvalidMoney is returned when a value can not be parsed into money.
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+// ParseMoney parses a decimal number with at most two fractional digits into money.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+
+	sign := int64(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	}
+
+	parts := strings.SplitN(s, ".", 2)
+	if parts[0] == "" || len(parts) == 2 && (parts[1] == "" || len(parts[1]) > 2) {
+		return 0, errors.Wrapf(ErrInvalidMoney, "%q", s)
+	}
+
+	units, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || units < 0 {
+		return 0, errors.Wrapf(ErrInvalidMoney, "%q", s)
+	}
+
+	var cents int64
+	if len(parts) == 2 {
+		fraction := parts[1]
+		if len(fraction) == 1 {
+			fraction += "0"
+		}
+		cents, err = strconv.ParseInt(fraction, 10, 64)
+		if err != nil || cents < 0 {
+			return 0, errors.Wrapf(ErrInvalidMoney, "%q", s)
+		}
+	}
+
+	return Money(sign * (units*100 + cents)), nil
+}
+
+// String returns decimal representation of money, e.g. 10.20.
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+// Multiply returns money multiplied by given quantity.
+func (m Money) Multiply(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// Percentage returns a part of money defined by given rate in basis points (1/100 of a percent),
+// rounded half away from zero to the nearest minor unit.
+func (m Money) Percentage(basisPoints int) Money {
+	v := int64(m) * int64(basisPoints)
+	if v < 0 {
+		return Money((v - 5000) / 10000)
+	}
+	return Money((v + 5000) / 10000)
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+// It accepts both JSON numbers and strings, e.g. 10.2 and "10.20".
+func (m *Money) UnmarshalJSON(data []byte) error {
+	v, err := ParseMoney(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Value implements driver.Valuer interface.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan implements sql.Scanner interface.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	case int64:
+		*m = Money(v * 100)
+		return nil
+	default:
+		return errors.Errorf("can not scan %T into money", src)
+	}
+}
+
+// scanString parses money from textual database representation.
+func (m *Money) scanString(s string) error {
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
@@ -0,0 +1,101 @@
+package entity
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestMoney(t *testing.T) {
+	t.Run("Given the need to parse money from it`s decimal representation", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			value    string
+			money    Money
+			valid    bool
+		}{
+			{testName: "Whole number", value: "10", money: 1000, valid: true},
+			{testName: "Single fractional digit", value: "10.2", money: 1020, valid: true},
+			{testName: "Two fractional digits", value: "0.07", money: 7, valid: true},
+			{testName: "Negative number", value: "-1.50", money: -150, valid: true},
+			{testName: "Three fractional digits", value: "1.001", valid: false},
+			{testName: "Exponent", value: "1e3", valid: false},
+			{testName: "Empty fraction", value: "1.", valid: false},
+			{testName: "Not a number", value: "ten", valid: false},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				m, err := ParseMoney(tc.value)
+				if tc.valid && err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to parse %q. Error: %s", tests.Failed, testID, tc.value, err)
+				}
+				if !tc.valid && err == nil {
+					t.Fatalf("\t%s\tTest %d:\tShould not be able to parse %q.", tests.Failed, testID, tc.value)
+				}
+				if tc.valid && m != tc.money {
+					t.Fatalf("\t%s\tTest %d:\tWant money: %d, got: %d", tests.Failed, testID, tc.money, m)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get appropriate result parsing %q.", tests.Success, testID, tc.value)
+			})
+		}
+	})
+
+	t.Run("Given the need to marshal money into JSON and back", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			money    Money
+			json     string
+		}{
+			{testName: "Price with cents", money: 1020, json: "10.20"},
+			{testName: "Price without units", money: 5, json: "0.05"},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				data, err := json.Marshal(tc.money)
+				if err != nil || string(data) != tc.json {
+					t.Fatalf("\t%s\tTest %d:\tWant JSON: %s, got: %s (%v)", tests.Failed, testID, tc.json, data, err)
+				}
+
+				var m Money
+				if err := json.Unmarshal(data, &m); err != nil || m != tc.money {
+					t.Fatalf("\t%s\tTest %d:\tWant money: %d, got: %d (%v)", tests.Failed, testID, tc.money, m, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to marshal %s into JSON and back.", tests.Success, testID, tc.money)
+			})
+		}
+	})
+}
+
+func TestCalculateOrderTotals(t *testing.T) {
+	t.Run("Given the need to calculate order totals", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			items    []OrderItem
+			taxRate  int
+			totals   OrderTotals
+		}{
+			{testName: "Order without items", taxRate: 2000, totals: OrderTotals{}},
+			{
+				testName: "Order without tax",
+				items:    []OrderItem{{UnitPrice: 1020, Quantity: 2}, {UnitPrice: 5, Quantity: 1}},
+				totals:   OrderTotals{Subtotal: 2045, Tax: 0, Total: 2045},
+			},
+			{
+				testName: "Order with rounded tax",
+				items:    []OrderItem{{UnitPrice: 333, Quantity: 1}},
+				taxRate:  1950,
+				totals:   OrderTotals{Subtotal: 333, Tax: 65, Total: 398},
+			},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				totals := CalculateOrderTotals(tc.items, tc.taxRate)
+				if totals != tc.totals {
+					t.Fatalf("\t%s\tTest %d:\tWant totals: %+v, got: %+v", tests.Failed, testID, tc.totals, totals)
+				}
+				t.Logf("\t%s\tTest %d:\tWant totals: %+v", tests.Success, testID, tc.totals)
+			})
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package entity
+
+import "time"
+
+// OIDCLogin is a login of a user through external OpenID Connect provider that is in progress.
+// It is created when a user is redirected to a provider and taken once a provider redirects him back,
+// so an authorization response can not be replayed or forged by a third party.
+type OIDCLogin struct {
+	// State is a random value a provider returns back along with authorization code.
+	State    string `bson:"_id"`
+	Provider string `bson:"provider"`
+	// Nonce binds ID token to a login.
+	Nonce string `bson:"nonce"`
+	// CodeVerifier is a PKCE secret authorization code is exchanged with.
+	CodeVerifier string `bson:"code_verifier"`
+	ExpiresAt    int64  `bson:"expires_at"`
+}
+
+// ExternalIdentity is an account of a user at external identity provider linked to a user.
+//
+// swagger:model
+type ExternalIdentity struct {
+	// Name of a provider as it is configured
+	//
+	// example: corp
+	Provider string `db:"provider" json:"provider"`
+
+	// Identifier of a user at a provider
+	//
+	Subject string `db:"subject" json:"subject"`
+
+	// The UUID of a user an identity is linked to
+	//
+	UserID string `db:"user_id" json:"user_id"`
+
+	// Email of a user asserted by a provider when an identity was linked
+	//
+	Email string `db:"email" json:"email"`
+
+	// Date an identity was linked
+	//
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+}
@@ -2,8 +2,50 @@ package entity
 
 import (
 	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Set of order statuses.
+// Order lifecycle is: pending -> paid -> shipped -> delivered,
+// pending and paid orders can be cancelled, paid and delivered orders can be refunded.
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusRefunded  = "refunded"
 )
 
+// ErrInvalidStatusTransition is returned when an order can not be moved from it`s current status to a requested one.
+var ErrInvalidStatusTransition = ConflictError("invalid order status transition")
+
+// orderStatusTransitions maps each order status to statuses an order can be moved to from it.
+var orderStatusTransitions = map[string][]string{
+	OrderStatusPending:   {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusShipped, OrderStatusCancelled, OrderStatusRefunded},
+	OrderStatusShipped:   {OrderStatusDelivered},
+	OrderStatusDelivered: {OrderStatusRefunded},
+	OrderStatusCancelled: {},
+	OrderStatusRefunded:  {},
+}
+
+// ValidateStatusTransition checks if an order can be moved from one status to another.
+func ValidateStatusTransition(from, to string) error {
+	if _, ok := orderStatusTransitions[to]; !ok {
+		return errors.Wrapf(ErrInvalidStatusTransition, "unknown status %q", to)
+	}
+
+	for _, status := range orderStatusTransitions[from] {
+		if status == to {
+			return nil
+		}
+	}
+
+	return errors.Wrapf(ErrInvalidStatusTransition, "from %q to %q", from, to)
+}
+
 // Order is an particular order.
 //
 // swagger:model
@@ -21,6 +63,14 @@ type Order struct {
 	//
 	Status string `db:"status" json:"status"`
 
+	// Server-computed money amounts of an order
+	//
+	OrderTotals
+
+	// Version of an order, it is increased by every update of it
+	//
+	Version int `db:"version" json:"version"`
+
 	// Date of an order creation
 	//
 	DateCreated time.Time `db:"date_created" json:"date_created"`
@@ -28,6 +78,44 @@ type Order struct {
 	// Date of an order last modification
 	//
 	DateUpdated time.Time `db:"date_updated" json:"date_updated"`
+
+	// Date of an order deletion, deleted orders are kept until their retention period is over
+	//
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+}
+
+// OrderTotals is a set of server-computed money amounts of an order.
+//
+// swagger:model
+type OrderTotals struct {
+	// Sum of prices of all order items
+	//
+	Subtotal Money `db:"subtotal" json:"subtotal"`
+
+	// Tax on order subtotal
+	//
+	Tax Money `db:"tax" json:"tax"`
+
+	// Subtotal together with tax
+	//
+	Total Money `db:"total" json:"total"`
+}
+
+// CalculateOrderTotals computes money amounts of an order from it`s items
+// and tax rate given in basis points (1/100 of a percent).
+func CalculateOrderTotals(items []OrderItem, taxRate int) OrderTotals {
+	var subtotal Money
+	for _, item := range items {
+		subtotal += item.Total()
+	}
+
+	tax := subtotal.Percentage(taxRate)
+
+	return OrderTotals{
+		Subtotal: subtotal,
+		Tax:      tax,
+		Total:    subtotal + tax,
+	}
 }
 
 // NewOrder is an information needed to create a new order.
@@ -39,9 +127,9 @@ type NewOrder struct {
 	// required: true
 	UserID string `json:"user_id" validate:"required"`
 
-	// Status of an order
+	// Status of an order, new orders always start as pending
 	//
-	Status string `json:"status" validate:"required"`
+	Status string `json:"status"`
 }
 
 // UpdateOrder is an information needed to update an existing order.
@@ -51,4 +139,85 @@ type UpdateOrder struct {
 	// Status of an order
 	//
 	Status *string `json:"status"`
+
+	// Reason of an order status change
+	//
+	Reason string `json:"reason"`
+}
+
+// OrderStatusChange is a record about a single transition of an order status.
+//
+// swagger:model
+type OrderStatusChange struct {
+	// UUID of a status change
+	//
+	ID string `db:"order_status_change_id" json:"order_status_change_id"`
+
+	// UUID of an order
+	//
+	OrderID string `db:"order_id" json:"order_id"`
+
+	// Status of an order before transition
+	//
+	FromStatus string `db:"from_status" json:"from_status"`
+
+	// Status of an order after transition
+	//
+	ToStatus string `db:"to_status" json:"to_status"`
+
+	// UUID of a user who changed a status
+	//
+	Actor string `db:"actor" json:"actor"`
+
+	// Reason of a status change
+	//
+	Reason string `db:"reason" json:"reason"`
+
+	// Date of a status change
+	//
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+}
+
+// NewCheckout is an information needed to check out a new order together with it`s items.
+//
+// swagger:model
+type NewCheckout struct {
+	// UUID of a user related to particular order
+	//
+	// required: true
+	UserID string `json:"user_id" validate:"required"`
+
+	// Items of an order
+	//
+	// required: true
+	Items []NewCheckoutItem `json:"items" validate:"required,min=1,dive"`
+}
+
+// NewCheckoutItem is an information about a single product inside of a checkout.
+//
+// swagger:model
+type NewCheckoutItem struct {
+	// UUID of a product
+	//
+	// required: true
+	ProductID string `json:"product_id" validate:"required"`
+
+	// Quantity of a product
+	//
+	// min: 1
+	// required: true
+	Quantity int `json:"quantity" validate:"gte=1"`
+}
+
+// Checkout is a checked out order together with it`s items.
+//
+// swagger:model
+type Checkout struct {
+	// Checked out order
+	//
+	Order Order `json:"order"`
+
+	// Items of a checked out order
+	//
+	Items []OrderItem `json:"items"`
 }
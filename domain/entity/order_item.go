@@ -28,6 +28,18 @@ type OrderItem struct {
 	// required : true
 	Quantity int `db:"quantity" json:"quantity"`
 
+	// Price of a single product at the moment an order item was created
+	//
+	UnitPrice Money `db:"unit_price" json:"unit_price"`
+
+	// Title of a product at the moment an order item was created
+	//
+	ProductTitle string `db:"product_title" json:"product_title"`
+
+	// Version of an order item, it is increased by every update of it
+	//
+	Version int `db:"version" json:"version"`
+
 	// Date of an order item creation
 	//
 	DateCreated time.Time `db:"date_created" json:"date_created"`
@@ -35,6 +47,10 @@ type OrderItem struct {
 	// Date of an order item last modification
 	//
 	DateUpdated time.Time `db:"date_updated" json:"date_updated"`
+
+	// Date of an order item deletion, deleted order items are kept until their retention period is over
+	//
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
 }
 
 // NewOrderItem is an information needed to create a new order item.
@@ -56,6 +72,14 @@ type NewOrderItem struct {
 	// min: 0
 	// required : true
 	Quantity int `json:"quantity" validate:"gte=1"`
+
+	// Snapshot of a product price, it is filled by server from a product
+	//
+	UnitPrice Money `json:"-"`
+
+	// Snapshot of a product title, it is filled by server from a product
+	//
+	ProductTitle string `json:"-"`
 }
 
 // UpdateOrderItem is an information needed to update an existing order item.
@@ -64,7 +88,11 @@ type NewOrderItem struct {
 type UpdateOrderItem struct {
 	// Quantity of an order item
 	//
-	// min: 0
-	// required : true
-	Quantity *int `json:"quantity"`
+	// min: 1
+	Quantity *int `json:"quantity" validate:"omitempty,gte=1"`
+}
+
+// Total returns price of an order item.
+func (oi OrderItem) Total() Money {
+	return oi.UnitPrice.Multiply(oi.Quantity)
 }
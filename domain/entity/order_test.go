@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestValidateStatusTransition(t *testing.T) {
+	t.Run("Given the need to move an order through it`s lifecycle", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			from     string
+			to       string
+			valid    bool
+		}{
+			{testName: "pending to paid", from: OrderStatusPending, to: OrderStatusPaid, valid: true},
+			{testName: "pending to cancelled", from: OrderStatusPending, to: OrderStatusCancelled, valid: true},
+			{testName: "paid to shipped", from: OrderStatusPaid, to: OrderStatusShipped, valid: true},
+			{testName: "paid to refunded", from: OrderStatusPaid, to: OrderStatusRefunded, valid: true},
+			{testName: "shipped to delivered", from: OrderStatusShipped, to: OrderStatusDelivered, valid: true},
+			{testName: "delivered to refunded", from: OrderStatusDelivered, to: OrderStatusRefunded, valid: true},
+			{testName: "pending to shipped", from: OrderStatusPending, to: OrderStatusShipped, valid: false},
+			{testName: "shipped to cancelled", from: OrderStatusShipped, to: OrderStatusCancelled, valid: false},
+			{testName: "cancelled to paid", from: OrderStatusCancelled, to: OrderStatusPaid, valid: false},
+			{testName: "refunded to delivered", from: OrderStatusRefunded, to: OrderStatusDelivered, valid: false},
+			{testName: "pending to unknown status", from: OrderStatusPending, to: "lost", valid: false},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				err := ValidateStatusTransition(tc.from, tc.to)
+				if tc.valid && err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to move an order from %s to %s. Error: %s", tests.Failed, testID, tc.from, tc.to, err)
+				}
+				if !tc.valid && errors.Cause(err) != ErrInvalidStatusTransition {
+					t.Fatalf("\t%s\tTest %d:\tShould not be able to move an order from %s to %s. Error: %v", tests.Failed, testID, tc.from, tc.to, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get appropriate result moving an order from %s to %s.", tests.Success, testID, tc.from, tc.to)
+			})
+		}
+	})
+}
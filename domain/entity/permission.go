@@ -0,0 +1,140 @@
+package entity
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Permission is a right to perform a particular action on a particular resource, e.g. product:write.
+// Permission with ":own" suffix is limited to resources owned by a user, e.g. order:read:own.
+type Permission string
+
+// Set of permissions used by application routes.
+const (
+	PermissionUserRead  Permission = "user:read"
+	PermissionUserWrite Permission = "user:write"
+
+	// PermissionUserUnlock allows to unlock accounts locked after too many failed sign in attempts.
+	PermissionUserUnlock Permission = "user:unlock"
+
+	PermissionProductRead  Permission = "product:read"
+	PermissionProductWrite Permission = "product:write"
+
+	// Order permissions cover order items as well, since order items are parts of an order.
+	PermissionOrderRead  Permission = "order:read"
+	PermissionOrderWrite Permission = "order:write"
+
+	// PermissionDeletedRead allows to list deleted users, products, orders and order items along with other ones.
+	PermissionDeletedRead Permission = "deleted:read"
+
+	// PermissionDeletedRestore allows to restore deleted users, products, orders and order items.
+	PermissionDeletedRestore Permission = "deleted:restore"
+
+	// PermissionAuditRead allows to read audit log of changes made to users, products, orders and order items.
+	PermissionAuditRead Permission = "audit:read"
+
+	// Webhook permissions cover managing subscriptions to domain events and reading their deliveries.
+	PermissionWebhookRead  Permission = "webhook:read"
+	PermissionWebhookWrite Permission = "webhook:write"
+)
+
+// ownSuffix is a suffix of permissions limited to resources owned by a user.
+const ownSuffix = ":own"
+
+// ErrInvalidRolePermissions is returned when role permissions can not be parsed.
+var ErrInvalidRolePermissions = errors.New("invalid role permissions")
+
+// Own returns permission limited to resources owned by a user.
+func (p Permission) Own() Permission {
+	if p.IsOwn() {
+		return p
+	}
+	return p + ownSuffix
+}
+
+// IsOwn reports whether permission is limited to resources owned by a user.
+func (p Permission) IsOwn() bool {
+	return strings.HasSuffix(string(p), ownSuffix)
+}
+
+// RolePermissions maps roles to permissions granted to them.
+// Roles are case-insensitive.
+type RolePermissions map[string][]Permission
+
+// DefaultRolePermissions returns permissions of built-in roles:
+// admin can do anything, while user can browse products and manage only his own account and orders.
+func DefaultRolePermissions() RolePermissions {
+	return RolePermissions{
+		AdminRole: {
+			PermissionUserRead,
+			PermissionUserWrite,
+			PermissionUserUnlock,
+			PermissionProductRead,
+			PermissionProductWrite,
+			PermissionOrderRead,
+			PermissionOrderWrite,
+			PermissionDeletedRead,
+			PermissionDeletedRestore,
+			PermissionAuditRead,
+			PermissionWebhookRead,
+			PermissionWebhookWrite,
+		},
+		UserRole: {
+			PermissionUserRead.Own(),
+			PermissionUserWrite.Own(),
+			PermissionProductRead,
+			PermissionOrderRead.Own(),
+			PermissionOrderWrite.Own(),
+		},
+	}
+}
+
+// ParseRolePermissions parses custom roles in ROLE=permission,permission;ROLE=permission format
+// and adds them to built-in roles. Permissions of a built-in role are replaced if it is redefined.
+func ParseRolePermissions(s string) (RolePermissions, error) {
+	rp := DefaultRolePermissions()
+
+	for _, def := range strings.Split(s, ";") {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+
+		parts := strings.SplitN(def, "=", 2)
+		role := strings.ToUpper(strings.TrimSpace(parts[0]))
+		if len(parts) != 2 || role == "" {
+			return nil, errors.Wrapf(ErrInvalidRolePermissions, "role definition %q", def)
+		}
+
+		var permissions []Permission
+		for _, p := range strings.Split(parts[1], ",") {
+			p = strings.TrimSpace(p)
+			if strings.Count(p, ":") < 1 {
+				return nil, errors.Wrapf(ErrInvalidRolePermissions, "permission %q of role %s", p, role)
+			}
+			permissions = append(permissions, Permission(p))
+		}
+
+		rp[role] = permissions
+	}
+
+	return rp, nil
+}
+
+// Grants checks whether any of given roles has a permission.
+// If only a limited to owned resources version of a permission is granted, own is true.
+func (rp RolePermissions) Grants(roles []string, p Permission) (granted bool, own bool) {
+	for _, role := range roles {
+		for _, rolePermission := range rp[strings.ToUpper(role)] {
+			switch rolePermission {
+			case p:
+				return true, false
+			case p.Own():
+				granted, own = true, true
+			}
+		}
+	}
+
+	return granted, own
+}
@@ -0,0 +1,64 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestRolePermissions(t *testing.T) {
+	t.Run("Given the need to check permissions of roles", func(t *testing.T) {
+		rp, err := ParseRolePermissions("support=order:read,user:read:own; USER=product:read,order:read:own")
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to parse role permissions. Error: %s", tests.Failed, err)
+		}
+
+		tt := []struct {
+			testName   string
+			roles      []string
+			permission Permission
+			granted    bool
+			own        bool
+		}{
+			{testName: "admin can write products", roles: []string{AdminRole}, permission: PermissionProductWrite, granted: true},
+			{testName: "role names are case insensitive", roles: []string{"admin"}, permission: PermissionOrderWrite, granted: true},
+			{testName: "redefined user can read products", roles: []string{UserRole}, permission: PermissionProductRead, granted: true},
+			{testName: "redefined user can read only own orders", roles: []string{UserRole}, permission: PermissionOrderRead, granted: true, own: true},
+			{testName: "redefined user can not write orders", roles: []string{UserRole}, permission: PermissionOrderWrite, granted: false},
+			{testName: "custom role can read any order", roles: []string{"SUPPORT"}, permission: PermissionOrderRead, granted: true},
+			{testName: "unlimited permission of one role wins over limited one of other", roles: []string{UserRole, "SUPPORT"}, permission: PermissionOrderRead, granted: true},
+			{testName: "unknown role has no permissions", roles: []string{"GUEST"}, permission: PermissionProductRead, granted: false},
+			{testName: "no roles", permission: PermissionProductRead, granted: false},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				granted, own := rp.Grants(tc.roles, tc.permission)
+				if granted != tc.granted || own != tc.own {
+					t.Fatalf("\t%s\tTest %d:\tWant granted: %t, own: %t, got granted: %t, own: %t", tests.Failed, testID, tc.granted, tc.own, granted, own)
+				}
+				t.Logf("\t%s\tTest %d:\tWant granted: %t, own: %t, got granted: %t, own: %t", tests.Success, testID, tc.granted, tc.own, granted, own)
+			})
+		}
+	})
+
+	t.Run("Given the need to reject malformed role permissions", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			s        string
+		}{
+			{testName: "role without permissions", s: "SUPPORT"},
+			{testName: "permission without action", s: "SUPPORT=order"},
+			{testName: "permissions without role", s: "=order:read"},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				_, err := ParseRolePermissions(tc.s)
+				if errors.Cause(err) != ErrInvalidRolePermissions {
+					t.Fatalf("\t%s\tTest %d:\tWant error: %v, got: %v", tests.Failed, testID, ErrInvalidRolePermissions, err)
+				}
+				t.Logf("\t%s\tTest %d:\tWant error: %v, got: %v", tests.Success, testID, ErrInvalidRolePermissions, err)
+			})
+		}
+	})
+}
@@ -26,7 +26,7 @@ type Product struct {
 	//
 	// gte:0.00
 	// required: true
-	Price float32 `db:"price" json:"price"`
+	Price Money `db:"price" json:"price"`
 
 	// Stock of a product
 	//
@@ -34,6 +34,10 @@ type Product struct {
 	// required: true
 	Stock int `db:"stock" json:"stock"`
 
+	// Version of a product, it is increased by every update of it
+	//
+	Version int `db:"version" json:"version"`
+
 	// Date of a product creation
 	//
 	DateCreated time.Time `db:"date_created" json:"date_created"`
@@ -41,6 +45,10 @@ type Product struct {
 	// Date of a product last modification
 	//
 	DateUpdated time.Time `db:"date_updated" json:"date_updated"`
+
+	// Date of a product deletion, deleted products are kept until their retention period is over
+	//
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
 }
 
 // NewProduct is an information needed to create a new product.
@@ -61,7 +69,7 @@ type NewProduct struct {
 	//
 	// gte:0.00
 	// required: true
-	Price float32 `json:"price,omitempty" validate:"gte=0"`
+	Price Money `json:"price,omitempty" validate:"gte=0"`
 
 	// Stock of a product
 	//
@@ -88,7 +96,7 @@ type UpdateProduct struct {
 	//
 	// gte:0
 	// required: true
-	Price *float32 `json:"price"`
+	Price *Money `json:"price"`
 
 	// Stock of a product
 	//
@@ -96,3 +104,22 @@ type UpdateProduct struct {
 	// required: true
 	Stock *int `json:"stock"`
 }
+
+// ProductSearchResult is a product found by a full-text search.
+//
+// swagger:model
+type ProductSearchResult struct {
+	Product
+
+	// Relevance of a product to a search query, more relevant products have higher rank
+	//
+	Rank float64 `db:"rank" json:"rank"`
+
+	// Title of a product with matched words wrapped into <b></b> tags
+	//
+	TitleHighlight string `db:"title_highlight" json:"title_highlight"`
+
+	// Fragments of product description with matched words wrapped into <b></b> tags
+	//
+	DescriptionHighlight string `db:"description_highlight" json:"description_highlight"`
+}
@@ -0,0 +1,52 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrSessionEnded is returned when a session an access token was issued within is ended or expired.
+var ErrSessionEnded = errors.New("session has ended")
+
+// Session is a sign in of a user on a particular device.
+// A session lives as long as a family of refresh tokens issued by rotation since the sign in,
+// so id of a session is an id of that family. It expires together with the latest access token of a family (see SessionTTL),
+// and access tokens issued within a session are not accepted once it is ended or expired.
+//
+// swagger:model
+type Session struct {
+	// ID of a session
+	ID string `json:"id" bson:"_id"`
+
+	// ID of a user a session belongs to
+	UserID string `json:"user_id" bson:"user_id"`
+
+	// Name of a device given by a user on sign in
+	Device string `json:"device" bson:"device"`
+
+	// User agent of a client a user signed in with
+	UserAgent string `json:"user_agent" bson:"user_agent"`
+
+	// IP address a user signed in from
+	IP string `json:"ip" bson:"ip"`
+
+	// Creation time of a session
+	DateCreated time.Time `json:"date_created" bson:"date_created"`
+
+	// Time tokens of a session were last refreshed
+	LastUsed time.Time `json:"last_used" bson:"last_used"`
+
+	// Time a session expires at unless it`s tokens are refreshed
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+
+	// Whether a session is the one a request was made within
+	Current bool `json:"current" bson:"-"`
+}
+
+// NewSession is an information about a client a user signs in with.
+type NewSession struct {
+	Device    string
+	UserAgent string
+	IP        string
+}
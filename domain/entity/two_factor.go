@@ -0,0 +1,126 @@
+package entity
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// recoveryCodesCount is a number of recovery codes issued to a user at once.
+const recoveryCodesCount = 10
+
+// recoveryCodeEncoding is an encoding of recovery codes, lowercase is easier to type.
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// TwoFactor defines a model for a second authentication factor of a user,
+// which is a TOTP secret shared with an authenticator app.
+// 2FA is enabled only after a user confirms he set up an app with a valid code.
+type TwoFactor struct {
+	UserID  string `bson:"_id"`
+	Secret  string `bson:"secret"`
+	Enabled bool   `bson:"enabled"`
+	// RecoveryCodes are hashes of single-use codes a user can sign in with if he lost his device.
+	RecoveryCodes []string `bson:"recovery_codes"`
+	// LastUsedStep is a TOTP period of the last accepted code, so a code can not be used twice.
+	LastUsedStep int64     `bson:"last_used_step"`
+	DateCreated  time.Time `bson:"date_created"`
+}
+
+// TwoFactorEnrollment is a TOTP secret a user should add to his authenticator app.
+//
+// swagger:model
+type TwoFactorEnrollment struct {
+	// Base32 encoded secret, for manual entry
+	//
+	// required: true
+	Secret string `json:"secret"`
+
+	// Provisioning URI to be shown as QR code
+	//
+	// example: otpauth://totp/clean-rest-api:admin?secret=JBSWY3DPEHPK3PXP&issuer=clean-rest-api
+	// required: true
+	URI string `json:"uri"`
+}
+
+// TwoFactorCode is a code from an authenticator app or a recovery code.
+//
+// swagger:model
+type TwoFactorCode struct {
+	// TOTP code or recovery code
+	//
+	// required: true
+	Code string `json:"code" validate:"required"`
+}
+
+// RecoveryCodes is a set of single-use codes a user can sign in with if he lost his device.
+// They are shown only once.
+//
+// swagger:model
+type RecoveryCodes struct {
+	// Recovery codes
+	//
+	// required: true
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TwoFactorSignIn is an information needed to complete sign in with a second factor.
+//
+// swagger:model
+type TwoFactorSignIn struct {
+	// Challenge token returned by sign in
+	//
+	// required: true
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+
+	// TOTP code or recovery code
+	//
+	// required: true
+	Code string `json:"code" validate:"required"`
+
+	// Name of a device a user signs in from, e.g. "Work laptop"
+	Device string `json:"device,omitempty"`
+}
+
+// SignInResult is a result of sign in: a pair of tokens
+// or a challenge token if a user should complete sign in with a second factor.
+//
+// swagger:model
+type SignInResult struct {
+	TokenPair
+
+	// Short-lived token to be exchanged for a pair of tokens along with a second factor code
+	ChallengeToken string `json:"challenge_token,omitempty"`
+}
+
+// NewRecoveryCodes generates a set of random recovery codes along with their hashes to be stored.
+func NewRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < recoveryCodesCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, errors.Wrap(err, "generating recovery code")
+		}
+
+		c := recoveryCodeEncoding.EncodeToString(b)
+		code := c[:4] + "-" + c[4:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns a hash of a recovery code that is stored instead of it.
+// Codes are compared case-insensitively, ignoring dashes and spaces.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
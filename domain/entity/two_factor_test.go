@@ -0,0 +1,40 @@
+package entity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	t.Run("Given the need to issue recovery codes", func(t *testing.T) {
+		codes, hashes, err := NewRecoveryCodes()
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to generate recovery codes. Error: %s", tests.Failed, err)
+		}
+		if len(codes) != recoveryCodesCount || len(hashes) != recoveryCodesCount {
+			t.Fatalf("\t%s\tWant %d codes, got: %d", tests.Failed, recoveryCodesCount, len(codes))
+		}
+		t.Logf("\t%s\tShould be able to generate recovery codes.", tests.Success)
+
+		seen := make(map[string]bool)
+		for i, code := range codes {
+			if seen[code] {
+				t.Fatalf("\t%s\tShould generate unique codes, got %s twice.", tests.Failed, code)
+			}
+			seen[code] = true
+
+			if HashRecoveryCode(code) != hashes[i] {
+				t.Fatalf("\t%s\tShould return a hash of every code.", tests.Failed)
+			}
+		}
+		t.Logf("\t%s\tShould generate unique codes along with their hashes.", tests.Success)
+
+		typed := " " + strings.ToUpper(strings.Replace(codes[0], "-", "", 1)) + " "
+		if HashRecoveryCode(typed) != hashes[0] {
+			t.Fatalf("\t%s\tShould compare codes ignoring case, dashes and spaces.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould compare codes ignoring case, dashes and spaces.", tests.Success)
+	})
+}
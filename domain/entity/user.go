@@ -28,10 +28,9 @@ type User struct {
 	//
 	LastName string `db:"last_name" json:"last_name"`
 
-	// Password of a user
+	// Hash of a user password, it is never sent to clients
 	//
-	// required: true
-	Password []byte `db:"password" json:"password"`
+	Password []byte `db:"password" json:"-"`
 
 	// Email of a user
 	//
@@ -39,10 +38,18 @@ type User struct {
 	// required: true
 	Email string `db:"email" json:"email"`
 
+	// Whether a user confirmed that he owns his email
+	//
+	EmailVerified bool `db:"email_verified" json:"email_verified"`
+
 	// Set of user roles
 	//
 	Roles pq.StringArray `db:"roles" json:"roles"`
 
+	// Version of a user, it is increased by every update of it
+	//
+	Version int `db:"version" json:"version"`
+
 	// Date of a user creation
 	//
 	DateCreated time.Time `db:"date_created" json:"date_created"`
@@ -50,6 +57,10 @@ type User struct {
 	// Date of a user last modification
 	//
 	DateUpdated time.Time `db:"date_updated" json:"date_updated"`
+
+	// Date of a user deletion, deleted users are kept until their retention period is over
+	//
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
 }
 
 // NewUser is an information needed to create a new user.
@@ -89,6 +100,10 @@ type NewUser struct {
 	//
 	// required: true
 	Roles []string `json:"roles" validate:"required"`
+
+	// Whether an email of a user is already confirmed, e.g. by external identity provider
+	//
+	EmailVerified bool `json:"-"`
 }
 
 // UpdateUser is an information needed to update a existing user.
@@ -123,4 +138,8 @@ type UpdateUser struct {
 	// Set of user roles
 	//
 	Roles []string `json:"roles"`
+
+	// Whether a user confirmed his email, it is set by email verification only
+	//
+	EmailVerified *bool `json:"-"`
 }
@@ -0,0 +1,191 @@
+package entity
+
+import (
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// Set of statuses of webhook deliveries.
+const (
+	// DeliveryStatusPending is a status of a delivery that is waiting for the first or the next attempt.
+	DeliveryStatusPending = "pending"
+	// DeliveryStatusSucceeded is a status of a delivery a receiver responded to with 2xx status.
+	DeliveryStatusSucceeded = "succeeded"
+	// DeliveryStatusDead is a status of a delivery that failed too many times, it is retried only if redelivered.
+	DeliveryStatusDead = "dead"
+)
+
+// eventTypes is a set of domain events webhooks can subscribe to.
+var eventTypes = map[EventType]bool{
+	EventOrderCreated:        true,
+	EventOrderStatusChanged:  true,
+	EventProductStockChanged: true,
+	EventUserRegistered:      true,
+}
+
+// WebhookSubscription is a subscription of a receiver at a URL to domain events of given types.
+// Deliveries are signed with a secret of a subscription, so a receiver can check where they came from.
+//
+// swagger:model
+type WebhookSubscription struct {
+	// The UUID of a subscription
+	//
+	// required: true
+	ID string `db:"subscription_id" json:"id"`
+
+	// URL deliveries are posted to
+	//
+	// example: https://warehouse.example.com/webhooks
+	URL string `db:"url" json:"url"`
+
+	// Secret deliveries are signed with, it is never sent to clients
+	//
+	Secret string `db:"secret" json:"-"`
+
+	// Types of domain events a receiver is subscribed to
+	//
+	// example: ["OrderCreated", "OrderStatusChanged"]
+	EventTypes pq.StringArray `db:"event_types" json:"event_types"`
+
+	// Date of a subscription creation
+	//
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+
+	// Date of a subscription update
+	//
+	DateUpdated time.Time `db:"date_updated" json:"date_updated"`
+}
+
+// NewWebhookSubscription is an information needed to subscribe to domain events.
+//
+// swagger:model
+type NewWebhookSubscription struct {
+	// URL deliveries are posted to
+	//
+	// example: https://warehouse.example.com/webhooks
+	// required: true
+	URL string `json:"url" validate:"required,url"`
+
+	// Secret deliveries are signed with
+	//
+	// required: true
+	Secret string `json:"secret" validate:"required,min=16"`
+
+	// Types of domain events to subscribe to
+	//
+	// example: ["OrderCreated", "OrderStatusChanged"]
+	// required: true
+	EventTypes []string `json:"event_types" validate:"required,min=1"`
+}
+
+// UpdateWebhookSubscription contains information needed to change a subscription.
+//
+// swagger:model
+type UpdateWebhookSubscription struct {
+	// URL deliveries are posted to
+	//
+	// example: https://warehouse.example.com/webhooks
+	URL *string `json:"url" validate:"omitempty,url"`
+
+	// Secret deliveries are signed with
+	//
+	Secret *string `json:"secret" validate:"omitempty,min=16"`
+
+	// Types of domain events to subscribe to
+	//
+	// example: ["OrderCreated"]
+	EventTypes []string `json:"event_types" validate:"omitempty,min=1"`
+}
+
+// Subscribed reports whether a subscription includes events of given type.
+func (s WebhookSubscription) Subscribed(t EventType) bool {
+	for _, et := range s.EventTypes {
+		if EventType(et) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateWebhookURL checks that a URL of a subscription is an absolute HTTP(S) one.
+func ValidateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("url %q is not an HTTP(S) URL", rawURL)
+	}
+	return nil
+}
+
+// ValidateEventTypes checks that a subscription subscribes only to known domain events.
+func ValidateEventTypes(types []string) error {
+	for _, t := range types {
+		if !eventTypes[EventType(t)] {
+			return errors.Errorf("unknown event type %q", t)
+		}
+	}
+	return nil
+}
+
+// WebhookDelivery is a domain event delivered to a receiver of a subscription.
+//
+// swagger:model
+type WebhookDelivery struct {
+	// The UUID of a delivery
+	//
+	// required: true
+	ID string `db:"delivery_id" json:"id"`
+
+	// The UUID of a subscription
+	//
+	SubscriptionID string `db:"subscription_id" json:"subscription_id"`
+
+	// The UUID of a delivered event, repeated deliveries of an event have the same one
+	//
+	EventID string `db:"event_id" json:"event_id"`
+
+	// Type of a delivered event
+	//
+	// example: OrderCreated
+	EventType EventType `db:"event_type" json:"event_type"`
+
+	// Body of a delivery
+	//
+	Payload json.RawMessage `db:"payload" json:"payload"`
+
+	// Status of a delivery
+	//
+	// example: pending
+	Status string `db:"status" json:"status"`
+
+	// Number of failed attempts to deliver an event
+	//
+	Attempts int `db:"attempts" json:"attempts"`
+
+	// HTTP status a receiver responded with last time, zero if it did not respond
+	//
+	ResponseStatus int `db:"response_status" json:"response_status"`
+
+	// Error of the last failed attempt
+	//
+	LastError string `db:"last_error" json:"last_error,omitempty"`
+
+	// Time of the next attempt of a pending delivery
+	//
+	NextAttemptAt time.Time `db:"next_attempt_at" json:"next_attempt_at"`
+
+	// Time an event was delivered at
+	//
+	DeliveredAt *time.Time `db:"delivered_at" json:"delivered_at,omitempty"`
+
+	// Date of a delivery creation
+	//
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+
+	// Date of a delivery update
+	//
+	DateUpdated time.Time `db:"date_updated" json:"date_updated"`
+}
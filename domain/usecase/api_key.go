@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	apikey "github.com/rtbe/clean-rest-api/repository/api_key"
+)
+
+// APIKey is an interface that represents API key business domain use case.
+type APIKey interface {
+	Create(ctx context.Context, userID string, newKey entity.NewAPIKey) (entity.CreatedAPIKey, error)
+	QueryByUserID(ctx context.Context, userID string) ([]entity.APIKey, error)
+	Delete(ctx context.Context, userID, id string) error
+	VerifyAPIKey(ctx context.Context, key string) (*entity.AccessTokenClaims, error)
+}
+
+// ErrInvalidNewAPIKey is returned when API key is requested with malformed scopes or expiry in the past.
+var ErrInvalidNewAPIKey = &entity.ValidationError{Msg: "invalid API key request"}
+
+// lastUsedPrecision is how often time an API key was last used at is updated,
+// so a busy client does not cause a write on every request.
+const lastUsedPrecision = time.Minute
+
+// APIKeyService is an business domain intermidiate layer
+// between API key entity and API key DB layer (repository).
+type APIKeyService struct {
+	repo        apikey.Repository
+	userService User
+}
+
+// NewAPIKeyService creates a new API key entity service.
+func NewAPIKeyService(r apikey.Repository, u User) *APIKeyService {
+	return &APIKeyService{
+		repo:        r,
+		userService: u,
+	}
+}
+
+// Create creates a new API key of particular user.
+// A key itself is returned only here, only it`s hash is stored.
+func (s *APIKeyService) Create(ctx context.Context, userID string, nk entity.NewAPIKey) (entity.CreatedAPIKey, error) {
+	if err := entity.ValidateScopes(nk.Scopes); err != nil {
+		return entity.CreatedAPIKey{}, errors.Wrap(ErrInvalidNewAPIKey, err.Error())
+	}
+
+	now := time.Now().UTC()
+	if !nk.ExpiresAt.After(now) {
+		return entity.CreatedAPIKey{}, errors.Wrap(ErrInvalidNewAPIKey, "expiry is in the past")
+	}
+
+	key, hash, err := entity.GenerateAPIKey()
+	if err != nil {
+		return entity.CreatedAPIKey{}, err
+	}
+
+	k := entity.APIKey{
+		ID:          uuid.NewString(),
+		UserID:      userID,
+		Name:        nk.Name,
+		Prefix:      entity.APIKeyPrefix(key),
+		Hash:        hash,
+		Scopes:      nk.Scopes,
+		ExpiresAt:   nk.ExpiresAt.UTC(),
+		DateCreated: now,
+	}
+
+	if err := s.repo.Create(ctx, k); err != nil {
+		return entity.CreatedAPIKey{}, err
+	}
+
+	return entity.CreatedAPIKey{APIKey: k, Key: key}, nil
+}
+
+// QueryByUserID gets all API keys of particular user.
+func (s *APIKeyService) QueryByUserID(ctx context.Context, userID string) ([]entity.APIKey, error) {
+	return s.repo.QueryByUserID(ctx, userID)
+}
+
+// Delete revokes an API key of particular user.
+func (s *APIKeyService) Delete(ctx context.Context, userID, id string) error {
+	return s.repo.Delete(ctx, userID, id)
+}
+
+// VerifyAPIKey checks an API key and returns claims of a request authenticated with it.
+// Roles are read from a user on every request, so changes of them take effect immediately.
+func (s *APIKeyService) VerifyAPIKey(ctx context.Context, key string) (*entity.AccessTokenClaims, error) {
+	k, err := s.repo.QueryByHash(ctx, entity.HashAPIKey(key))
+	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return nil, entity.ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if !k.ExpiresAt.After(now) {
+		return nil, errors.Wrap(entity.ErrInvalidAPIKey, "API key is expired")
+	}
+
+	u, err := s.userService.QueryByID(ctx, k.UserID)
+	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return nil, entity.ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	if k.LastUsed == nil || now.Sub(*k.LastUsed) >= lastUsedPrecision {
+		if err := s.repo.Touch(ctx, k.ID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	return &entity.AccessTokenClaims{
+		User_id:    u.ID,
+		User_roles: u.Roles,
+		Api_key_id: k.ID,
+		Scopes:     k.Scopes,
+	}, nil
+}
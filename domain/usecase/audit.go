@@ -0,0 +1,61 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/repository/audit"
+)
+
+// Audit is an interface that represents audit log business domain use case.
+type Audit interface {
+	Query(ctx context.Context, q query.Query) ([]entity.AuditRecord, query.Page, error)
+}
+
+// AuditService is an business domain intermidiate layer
+// between audit record entity and audit DB layer (repository).
+// Other services record every create, update and delete of users, products, orders and order items through it.
+// Changes that follow from other ones (e.g. totals of an order recalculated after it`s items change) are not recorded.
+type AuditService struct {
+	repo audit.Repository
+}
+
+// NewAuditService creates a new audit record entity service.
+func NewAuditService(r audit.Repository) *AuditService {
+	return &AuditService{
+		repo: r,
+	}
+}
+
+// Query gets a paginated list of audit records.
+func (s *AuditService) Query(ctx context.Context, q query.Query) ([]entity.AuditRecord, query.Page, error) {
+	return s.repo.Query(ctx, q)
+}
+
+// Record saves a record of a change of an entity on behalf of an actor carried by the given context.
+// Before and after states of an entity are compared field by field, either of them is nil
+// if an entity did not exist before or after a change.
+// It should be called with the same context a change was made with, so both share a transaction.
+func (s *AuditService) Record(
+	ctx context.Context,
+	entityType, entityID string,
+	action entity.AuditAction,
+	before, after interface{},
+) error {
+	changes, err := entity.DiffAudit(before, after)
+	if err != nil {
+		return err
+	}
+
+	actor := entity.ActorFromContext(ctx)
+	_, err = s.repo.Create(ctx, entity.NewAuditRecord{
+		ActorID:    actor.UserID,
+		RequestID:  actor.RequestID,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Action:     action,
+		Changes:    changes,
+	})
+	return err
+}
@@ -6,61 +6,242 @@ package usecase
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/mail"
+	actiontoken "github.com/rtbe/clean-rest-api/repository/action_token"
 	"github.com/rtbe/clean-rest-api/repository/auth"
+	loginattempt "github.com/rtbe/clean-rest-api/repository/login_attempt"
+	"github.com/rtbe/clean-rest-api/repository/session"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // Auth is an interface that represents authentication business domain use case.
 type Auth interface {
 	SignUp(ctx context.Context, newUser entity.NewUser) (entity.User, error)
-	SignIn(ctx context.Context, user entity.User) (entity.TokenPair, error)
-	SignOut(ctx context.Context, user entity.User) error
-	Refresh(ctx context.Context, tokenPair *entity.TokenPair) (entity.TokenPair, error)
+	SignIn(ctx context.Context, credentials entity.Credentials, newSession entity.NewSession) (entity.SignInResult, error)
+	SignInTwoFactor(ctx context.Context, challengeToken, code string, newSession entity.NewSession) (entity.TokenPair, error)
+	SignOut(ctx context.Context, credentials entity.Credentials, ip string) error
+	Refresh(ctx context.Context, refreshToken string) (entity.TokenPair, error)
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, email string) error
+	Unlock(ctx context.Context, userID string) error
+}
+
+var (
+	// ErrInvalidCredentials is returned when user name or password do not match.
+	ErrInvalidCredentials = entity.UnauthorizedError("invalid user name or password")
+
+	// ErrInvalidRefreshToken is returned when refresh token is malformed, expired or revoked.
+	ErrInvalidRefreshToken = entity.UnauthorizedError("invalid refresh token")
+
+	// ErrRefreshTokenReused is returned when already used refresh token is presented again.
+	// It means that the token was most likely stolen, so the whole family of tokens is revoked.
+	ErrRefreshTokenReused = entity.UnauthorizedError("refresh token reused")
+
+	// ErrEmailNotVerified is returned on sign in of a user that did not verify his email
+	// when verification is required.
+	ErrEmailNotVerified = entity.ForbiddenError("email is not verified")
+
+	// ErrInvalidActionToken is returned when password reset or email verification token
+	// is malformed, expired or already used.
+	ErrInvalidActionToken = errors.New("invalid or expired token")
+
+	// ErrTooManyAttempts is a cause of TooManyAttemptsError.
+	ErrTooManyAttempts = errors.New("too many failed sign in attempts")
+)
+
+// TooManyAttemptsError is returned when sign in attempts with a user name or from an IP address
+// are throttled after failed ones.
+type TooManyAttemptsError struct {
+	// RetryAfter is a period of time after which attempts are allowed again.
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrTooManyAttempts, e.RetryAfter)
+}
+
+// Cause lets errors.Cause compare TooManyAttemptsError with ErrTooManyAttempts.
+func (e *TooManyAttemptsError) Cause() error {
+	return ErrTooManyAttempts
+}
+
+// AuthConfig is a configuration of authentication.
+type AuthConfig struct {
+	// RequireVerifiedEmail forbids sign in of users that did not verify their email.
+	RequireVerifiedEmail bool
+
+	// PasswordResetTTL is a period of time password reset token is valid for.
+	PasswordResetTTL time.Duration
+
+	// EmailVerificationTTL is a period of time email verification token is valid for.
+	EmailVerificationTTL time.Duration
+
+	// TwoFactorChallengeTTL is a period of time a user has to complete sign in with a second factor.
+	TwoFactorChallengeTTL time.Duration
+
+	// UserNameThrottle slows down and locks sign in attempts with a user name after failed ones.
+	UserNameThrottle entity.LoginThrottle
+
+	// IPThrottle slows down and blocks sign in attempts from an IP address after failed ones.
+	IPThrottle entity.LoginThrottle
 }
 
 // AuthService is an business domain intermidiate layer
 // between auth entity and User DB layer (repository).
 type AuthService struct {
-	authRepo    auth.Repository
-	userService User
+	authRepo        auth.Repository
+	sessionRepo     session.Repository
+	actionTokenRepo actiontoken.Repository
+	attemptRepo     loginattempt.Repository
+	userService     User
+	twoFactor       TwoFactor
+	mailer          mail.Mailer
+	cfg             AuthConfig
 }
 
 // NewAuthService creates a new auth entity service.
-func NewAuthService(ar auth.Repository, u User) *AuthService {
+func NewAuthService(
+	ar auth.Repository,
+	sr session.Repository,
+	tr actiontoken.Repository,
+	lr loginattempt.Repository,
+	u User,
+	tf TwoFactor,
+	m mail.Mailer,
+	cfg AuthConfig,
+) *AuthService {
 	return &AuthService{
-		authRepo:    ar,
-		userService: u,
+		authRepo:        ar,
+		sessionRepo:     sr,
+		actionTokenRepo: tr,
+		attemptRepo:     lr,
+		userService:     u,
+		twoFactor:       tf,
+		mailer:          m,
+		cfg:             cfg,
 	}
 }
 
-// SignUp creates a new user.
+// SignUp creates a new user and sends him a token to verify his email.
 func (s *AuthService) SignUp(ctx context.Context, nu entity.NewUser) (entity.User, error) {
 	u, err := s.userService.Create(ctx, nu)
 	if err != nil {
 		return entity.User{}, err
 	}
+
+	if err := s.sendVerification(ctx, u); err != nil {
+		return entity.User{}, err
+	}
+
 	return u, nil
 }
 
 // SignIn issues pair of access and refresh token for particular user.
-func (s *AuthService) SignIn(ctx context.Context, user entity.User) (entity.TokenPair, error) {
-	u, err := s.userService.QueryByID(ctx, user.UserName)
+// Every sign in starts a new session with a new family of refresh tokens,
+// so a user can have several sessions at once.
+// If a user has 2FA enabled, a short-lived challenge token is issued instead,
+// it should be exchanged for a pair of tokens with SignInTwoFactor.
+// Attempts are throttled after failed ones, see authenticate.
+func (s *AuthService) SignIn(ctx context.Context, c entity.Credentials, ns entity.NewSession) (entity.SignInResult, error) {
+	u, err := s.authenticate(ctx, c, ns.IP)
+	if err != nil {
+		return entity.SignInResult{}, err
+	}
+
+	return s.completeSignIn(ctx, u, ns)
+}
+
+// completeSignIn signs in a user that has proved his identity:
+// it checks that his email is verified if it is required
+// and either starts a new session or issues a challenge token if he has 2FA enabled.
+func (s *AuthService) completeSignIn(ctx context.Context, u entity.User, ns entity.NewSession) (entity.SignInResult, error) {
+	if s.cfg.RequireVerifiedEmail && !u.EmailVerified {
+		return entity.SignInResult{}, ErrEmailNotVerified
+	}
+
+	enabled, err := s.twoFactor.IsEnabled(ctx, u.ID)
+	if err != nil {
+		return entity.SignInResult{}, err
+	}
+
+	if enabled {
+		t, err := entity.NewActionToken(u.ID, u.Email, entity.PurposeTwoFactor, s.cfg.TwoFactorChallengeTTL)
+		if err != nil {
+			return entity.SignInResult{}, err
+		}
+
+		if err := s.actionTokenRepo.Create(ctx, t); err != nil {
+			return entity.SignInResult{}, err
+		}
+
+		return entity.SignInResult{ChallengeToken: t.Token}, nil
+	}
+
+	tokenPair, err := s.startSession(ctx, u, ns)
+	if err != nil {
+		return entity.SignInResult{}, err
+	}
+
+	return entity.SignInResult{TokenPair: tokenPair}, nil
+}
+
+// SignInTwoFactor completes sign in of a user with 2FA enabled:
+// a challenge token issued by SignIn along with TOTP or recovery code is exchanged for a pair of tokens.
+// A challenge token can be presented only once, so a wrong code requires to sign in again.
+func (s *AuthService) SignInTwoFactor(ctx context.Context, challengeToken, code string, ns entity.NewSession) (entity.TokenPair, error) {
+	t, err := s.useActionToken(ctx, challengeToken, entity.PurposeTwoFactor)
 	if err != nil {
 		return entity.TokenPair{}, err
 	}
 
-	if isPasswordValid := bcrypt.CompareHashAndPassword(u.Password, user.Password); isPasswordValid == nil {
-		return entity.TokenPair{}, errors.Wrap(isPasswordValid, "user password is not valid")
+	if err := s.twoFactor.Verify(ctx, t.UserID, code); err != nil {
+		if errors.Cause(err) == ErrTwoFactorNotEnabled {
+			return entity.TokenPair{}, ErrInvalidActionToken
+		}
+		return entity.TokenPair{}, err
+	}
+
+	u, err := s.userService.QueryByID(ctx, t.UserID)
+	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return entity.TokenPair{}, ErrInvalidActionToken
+		}
+		return entity.TokenPair{}, err
 	}
 
+	return s.startSession(ctx, u, ns)
+}
+
+// startSession starts a new session of a user and issues a pair of tokens of a new family within it.
+func (s *AuthService) startSession(ctx context.Context, u entity.User, ns entity.NewSession) (entity.TokenPair, error) {
 	JWTTokenPair, err := entity.NewTokenPair(u.ID, u.Roles)
 	if err != nil {
 		return entity.TokenPair{}, err
 	}
 
+	now := time.Now().UTC()
+	err = s.sessionRepo.Create(ctx, entity.Session{
+		ID:          JWTTokenPair.RefreshToken.FamilyID,
+		UserID:      u.ID,
+		Device:      ns.Device,
+		UserAgent:   ns.UserAgent,
+		IP:          ns.IP,
+		DateCreated: now,
+		LastUsed:    now,
+		ExpiresAt:   now.Add(entity.SessionTTL),
+	})
+	if err != nil {
+		return entity.TokenPair{}, err
+	}
+
 	err = s.authRepo.Create(ctx, JWTTokenPair.RefreshToken)
 	if err != nil {
 		return entity.TokenPair{}, err
@@ -72,40 +253,77 @@ func (s *AuthService) SignIn(ctx context.Context, user entity.User) (entity.Toke
 	}, nil
 }
 
-// SignOut deletes refresh token for particular user.
-func (s *AuthService) SignOut(ctx context.Context, user entity.User) error {
+// SignOut ends all sessions of particular user and deletes their refresh tokens.
+// Attempts are throttled the same way sign in attempts are.
+func (s *AuthService) SignOut(ctx context.Context, c entity.Credentials, ip string) error {
+	u, err := s.authenticate(ctx, c, ip)
+	if err != nil {
+		return err
+	}
 
-	u, err := s.userService.QueryByID(ctx, user.UserName)
+	err = s.authRepo.DeleteByUserID(ctx, u.ID)
 	if err != nil {
 		return err
 	}
 
-	if isPasswordValid := bcrypt.CompareHashAndPassword(u.Password, user.Password); isPasswordValid == nil {
-		return errors.Wrap(isPasswordValid, "user password is not valid")
+	return s.sessionRepo.DeleteByUserID(ctx, u.ID)
+}
+
+// Refresh rotates refresh token: presented token is marked as used
+// and a fresh pair of access and refresh JWT tokens of the same family is issued.
+// If presented token was already used, the whole family of tokens is revoked together with it`s session.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (entity.TokenPair, error) {
+	claims, err := entity.ParseRefreshTokenClaims(refreshToken)
+	if err != nil {
+		return entity.TokenPair{}, errors.Wrap(ErrInvalidRefreshToken, err.Error())
 	}
 
-	err = s.authRepo.Delete(ctx, u.ID)
+	rt, err := s.authRepo.MarkUsed(ctx, claims.UUID)
 	if err != nil {
-		return err
+		if errors.Cause(err) == database.ErrNotFound {
+			return entity.TokenPair{}, ErrInvalidRefreshToken
+		}
+		return entity.TokenPair{}, err
 	}
 
-	return nil
-}
+	if rt.Used {
+		if err := s.authRepo.DeleteFamily(ctx, rt.FamilyID); err != nil {
+			return entity.TokenPair{}, err
+		}
+		if err := s.sessionRepo.Delete(ctx, rt.FamilyID); err != nil {
+			return entity.TokenPair{}, err
+		}
+		return entity.TokenPair{}, ErrRefreshTokenReused
+	}
+
+	if rt.UserID != claims.User_id || rt.FamilyID != claims.Family_id {
+		return entity.TokenPair{}, ErrInvalidRefreshToken
+	}
 
-// Refresh refreshes access and refresh JWT tokens.
-func (s *AuthService) Refresh(ctx context.Context, tokenPair *entity.JWTTokenPair) (entity.TokenPair, error) {
+	// A session is extended together with a family of tokens it holds.
+	now := time.Now().UTC()
+	if err := s.sessionRepo.Touch(ctx, rt.FamilyID, now, now.Add(entity.SessionTTL)); err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return entity.TokenPair{}, ErrInvalidRefreshToken
+		}
+		return entity.TokenPair{}, err
+	}
 
-	accessTokenClaims, err := entity.ParseAccessTokenClaims(tokenPair.AccessToken.Token)
+	// Roles are read again, so changes of them take effect on a next refresh.
+	u, err := s.userService.QueryByID(ctx, rt.UserID)
 	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return entity.TokenPair{}, ErrInvalidRefreshToken
+		}
 		return entity.TokenPair{}, err
 	}
 
-	JWTTokenPair, err := entity.NewTokenPair(accessTokenClaims.User_id, accessTokenClaims.User_roles)
+	JWTTokenPair, err := entity.NewTokenPairInFamily(u.ID, u.Roles, rt.FamilyID)
 	if err != nil {
 		return entity.TokenPair{}, err
 	}
 
-	err = s.authRepo.Refresh(ctx, accessTokenClaims.User_id, JWTTokenPair.RefreshToken)
+	err = s.authRepo.Create(ctx, JWTTokenPair.RefreshToken)
 	if err != nil {
 		return entity.TokenPair{}, err
 	}
@@ -115,3 +333,264 @@ func (s *AuthService) Refresh(ctx context.Context, tokenPair *entity.JWTTokenPai
 		RefreshToken: JWTTokenPair.RefreshToken.Token,
 	}, nil
 }
+
+// ForgotPassword sends a password reset token to a user with a given email.
+// Absence of a user is not reported, so emails of users can not be discovered with it.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) error {
+	u, err := s.userService.QueryByEmail(ctx, email)
+	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	t, err := entity.NewActionToken(u.ID, u.Email, entity.PurposePasswordReset, s.cfg.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	if err := s.actionTokenRepo.Create(ctx, t); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      []string{u.Email},
+		Subject: "Password reset",
+		Body: fmt.Sprintf(
+			"Use the following token to reset your password, it expires at %s:\n\n%s\n\n"+
+				"If you did not request a password reset, ignore this email.",
+			time.Unix(t.ExpiresAt, 0).UTC().Format(time.RFC1123), t.Token,
+		),
+	})
+}
+
+// ResetPassword sets a new password of a user that presented a valid password reset token.
+// All other password reset tokens of a user are revoked and all his sessions are ended,
+// so whoever knew an old password is signed out.
+func (s *AuthService) ResetPassword(ctx context.Context, token, password string) error {
+	t, err := s.useActionToken(ctx, token, entity.PurposePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	err = s.userService.Update(ctx, t.UserID, 0, entity.UpdateUser{Password: &password})
+	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return ErrInvalidActionToken
+		}
+		return err
+	}
+
+	if err := s.actionTokenRepo.DeleteByUserID(ctx, t.UserID, entity.PurposePasswordReset); err != nil {
+		return err
+	}
+
+	if err := s.authRepo.DeleteByUserID(ctx, t.UserID); err != nil {
+		return err
+	}
+
+	return s.sessionRepo.DeleteByUserID(ctx, t.UserID)
+}
+
+// VerifyEmail marks an email of a user that presented a valid email verification token as verified.
+// Token is valid only while a user has the same email it was sent to.
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	t, err := s.useActionToken(ctx, token, entity.PurposeEmailVerification)
+	if err != nil {
+		return err
+	}
+
+	u, err := s.userService.QueryByID(ctx, t.UserID)
+	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return ErrInvalidActionToken
+		}
+		return err
+	}
+
+	if u.Email != t.Email {
+		return ErrInvalidActionToken
+	}
+
+	verified := true
+	if err := s.userService.Update(ctx, u.ID, 0, entity.UpdateUser{EmailVerified: &verified}); err != nil {
+		return err
+	}
+
+	return s.actionTokenRepo.DeleteByUserID(ctx, u.ID, entity.PurposeEmailVerification)
+}
+
+// ResendVerification sends a new email verification token to a user with a given email
+// if he did not verify it yet.
+// Absence of a user is not reported, so emails of users can not be discovered with it.
+func (s *AuthService) ResendVerification(ctx context.Context, email string) error {
+	u, err := s.userService.QueryByEmail(ctx, email)
+	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	if u.EmailVerified {
+		return nil
+	}
+
+	return s.sendVerification(ctx, u)
+}
+
+// sendVerification sends a token to verify an email of a user.
+func (s *AuthService) sendVerification(ctx context.Context, u entity.User) error {
+	t, err := entity.NewActionToken(u.ID, u.Email, entity.PurposeEmailVerification, s.cfg.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	if err := s.actionTokenRepo.Create(ctx, t); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      []string{u.Email},
+		Subject: "Email verification",
+		Body: fmt.Sprintf(
+			"Use the following token to verify your email, it expires at %s:\n\n%s",
+			time.Unix(t.ExpiresAt, 0).UTC().Format(time.RFC1123), t.Token,
+		),
+	})
+}
+
+// useActionToken checks a signed action token issued for a given action and marks it as used,
+// so it can not be presented again.
+func (s *AuthService) useActionToken(ctx context.Context, token string, purpose entity.TokenPurpose) (entity.ActionToken, error) {
+	claims, err := entity.ParseActionTokenClaims(token, purpose)
+	if err != nil {
+		return entity.ActionToken{}, errors.Wrap(ErrInvalidActionToken, err.Error())
+	}
+
+	t, err := s.actionTokenRepo.MarkUsed(ctx, claims.UUID)
+	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return entity.ActionToken{}, ErrInvalidActionToken
+		}
+		return entity.ActionToken{}, err
+	}
+
+	if t.Used || t.Purpose != purpose || t.UserID != claims.User_id {
+		return entity.ActionToken{}, ErrInvalidActionToken
+	}
+
+	return t, nil
+}
+
+// Unlock forgets failed sign in attempts with a user name of particular user,
+// so an account locked after them can be signed in again right away.
+// Attempts from IP addresses stay counted.
+func (s *AuthService) Unlock(ctx context.Context, userID string) error {
+	u, err := s.userService.QueryByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.attemptRepo.Reset(ctx, entity.UserNameAttemptsKey(u.UserName))
+}
+
+// authenticate finds a user by credentials and checks a password.
+// Failed attempts are counted both by a user name and by an IP address they came from,
+// and once there are too many of them, attempts are rejected for a while without checking a password.
+// An attempt is counted as failed before a password is checked, so concurrent attempts can not slip past
+// the throttle together, and it is taken back if a password turns out to be right.
+// A successful attempt forgets failures with a user name, but not from an IP address,
+// so a valid account of an attacker can not be used to reset them.
+func (s *AuthService) authenticate(ctx context.Context, c entity.Credentials, ip string) (entity.User, error) {
+	userNameKey := entity.UserNameAttemptsKey(c.UserName)
+	ipKey := entity.IPAttemptsKey(ip)
+
+	now := time.Now().UTC()
+	// Attempts that are already throttled are rejected without being counted,
+	// so they do not prolong a lockout.
+	if err := s.checkAttempts(ctx, userNameKey, s.cfg.UserNameThrottle, now); err != nil {
+		return entity.User{}, err
+	}
+	if err := s.checkAttempts(ctx, ipKey, s.cfg.IPThrottle, now); err != nil {
+		return entity.User{}, err
+	}
+
+	if err := s.countAttempt(ctx, userNameKey, s.cfg.UserNameThrottle, now); err != nil {
+		return entity.User{}, err
+	}
+	if err := s.countAttempt(ctx, ipKey, s.cfg.IPThrottle, now); err != nil {
+		return entity.User{}, err
+	}
+
+	u, err := s.verifyCredentials(ctx, c)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	if err := s.attemptRepo.Reset(ctx, userNameKey); err != nil {
+		return entity.User{}, err
+	}
+	if err := s.attemptRepo.RemoveFailure(ctx, ipKey); err != nil {
+		return entity.User{}, err
+	}
+
+	return u, nil
+}
+
+// checkAttempts returns TooManyAttemptsError if attempts counted by a key are throttled.
+func (s *AuthService) checkAttempts(ctx context.Context, key string, lt entity.LoginThrottle, now time.Time) error {
+	a, err := s.attemptRepo.Query(ctx, key)
+	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	return throttled(a, lt, now)
+}
+
+// countAttempt counts an attempt by a key as failed and returns TooManyAttemptsError
+// if attempts counted before it are throttled, e.g. by concurrent attempts that passed checkAttempts along with it.
+func (s *AuthService) countAttempt(ctx context.Context, key string, lt entity.LoginThrottle, now time.Time) error {
+	a, err := s.attemptRepo.AddFailure(ctx, key, now, lt.Window)
+	if err != nil {
+		return err
+	}
+
+	return throttled(a, lt, now)
+}
+
+// throttled returns TooManyAttemptsError if attempts are throttled at a given time.
+func throttled(a entity.LoginAttempts, lt entity.LoginThrottle, now time.Time) error {
+	// Failures outside of a window are forgotten.
+	if !a.LastFailure.After(now.Add(-lt.Window)) {
+		return nil
+	}
+
+	until := lt.BlockedUntil(a)
+	if !until.After(now) {
+		return nil
+	}
+
+	return &TooManyAttemptsError{RetryAfter: until.Sub(now)}
+}
+
+// verifyCredentials finds a user by credentials and checks a password.
+func (s *AuthService) verifyCredentials(ctx context.Context, c entity.Credentials) (entity.User, error) {
+	u, err := s.userService.QueryByUserName(ctx, c.UserName)
+	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return entity.User{}, ErrInvalidCredentials
+		}
+		return entity.User{}, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword(u.Password, []byte(c.Password)); err != nil {
+		return entity.User{}, ErrInvalidCredentials
+	}
+
+	return u, nil
+}
@@ -0,0 +1,250 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/mail"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+	actiontoken "github.com/rtbe/clean-rest-api/repository/action_token"
+	"github.com/rtbe/clean-rest-api/repository/audit"
+	"github.com/rtbe/clean-rest-api/repository/auth"
+	loginattempt "github.com/rtbe/clean-rest-api/repository/login_attempt"
+	"github.com/rtbe/clean-rest-api/repository/order"
+	orderitem "github.com/rtbe/clean-rest-api/repository/order_item"
+	"github.com/rtbe/clean-rest-api/repository/outbox"
+	"github.com/rtbe/clean-rest-api/repository/session"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
+	twofactor "github.com/rtbe/clean-rest-api/repository/two_factor"
+	"github.com/rtbe/clean-rest-api/repository/user"
+)
+
+// authFixture is an auth service along with in-memory repositories it keeps data in.
+type authFixture struct {
+	service  *AuthService
+	users    *UserService
+	tokens   *auth.InMemRepo
+	sessions *session.InMemRepo
+	attempts *loginattempt.InMemRepo
+}
+
+// newAuthFixture creates an auth service on top of empty in-memory repositories.
+func newAuthFixture(cfg AuthConfig) authFixture {
+	f := authFixture{
+		tokens:   auth.NewInMemRepo(),
+		sessions: session.NewInMemRepo(),
+		attempts: loginattempt.NewInMemRepo(),
+	}
+	f.users = NewUserService(user.NewInMemRepo(nil), order.NewInMemRepo(), orderitem.NewInMemRepo(nil), outbox.NewInMemRepo(), transaction.NewInMemManager(), NewAuditService(audit.NewInMemRepo()))
+	twoFactor := NewTwoFactorService(twofactor.NewInMemRepo(), f.users, "test")
+	f.service = NewAuthService(f.tokens, f.sessions, actiontoken.NewInMemRepo(), f.attempts, f.users, twoFactor, mail.NewInMemMailer(), cfg)
+
+	return f
+}
+
+// signUp creates a user with a given name and password or fails a test.
+func (f authFixture) signUp(t *testing.T, userName, password string) entity.User {
+	u, err := f.service.SignUp(context.Background(), entity.NewUser{
+		UserName:        userName,
+		Email:           userName + "@example.com",
+		Password:        password,
+		PasswordConfirm: password,
+	})
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to sign up. Error: %s", tests.Failed, err)
+	}
+	return u
+}
+
+func TestAuthService(t *testing.T) {
+	ctx := context.Background()
+	ns := entity.NewSession{IP: "10.0.0.1"}
+
+	t.Run("Given the need to throttle failed sign in attempts", func(t *testing.T) {
+		f := newAuthFixture(AuthConfig{
+			UserNameThrottle: entity.LoginThrottle{MaxFailures: 4, BackoffBase: time.Minute, Lockout: time.Hour, Window: time.Hour},
+			IPThrottle:       entity.LoginThrottle{MaxFailures: 100, BackoffBase: time.Minute, Lockout: time.Hour, Window: time.Hour},
+		})
+		u := f.signUp(t, "alan", "OOP_is_about_messages")
+		wrong := entity.Credentials{UserName: "alan", Password: "wrong"}
+
+		// Half of max failures are free, the next one starts a backoff.
+		for i := 0; i < 3; i++ {
+			if _, err := f.service.SignIn(ctx, wrong, ns); errors.Cause(err) != ErrInvalidCredentials {
+				t.Fatalf("\t%s\tAttempt %d:\tWant ErrInvalidCredentials, got: %v", tests.Failed, i, err)
+			}
+		}
+		t.Logf("\t%s\tShould reject wrong passwords as invalid credentials.", tests.Success)
+
+		_, err := f.service.SignIn(ctx, entity.Credentials{UserName: "alan", Password: "OOP_is_about_messages"}, ns)
+		var tooMany *TooManyAttemptsError
+		if !errors.As(err, &tooMany) {
+			t.Fatalf("\t%s\tWant TooManyAttemptsError even with a right password, got: %v", tests.Failed, err)
+		}
+		if tooMany.RetryAfter <= 0 || tooMany.RetryAfter > time.Minute {
+			t.Fatalf("\t%s\tWant retry after a minute at most, got: %v", tests.Failed, tooMany.RetryAfter)
+		}
+		t.Logf("\t%s\tShould reject attempts during a backoff and tell when to retry.", tests.Success)
+
+		if err := f.service.Unlock(ctx, u.ID); err != nil {
+			t.Fatalf("\t%s\tShould be able to unlock a user. Error: %s", tests.Failed, err)
+		}
+		if _, err := f.service.SignIn(ctx, entity.Credentials{UserName: "alan", Password: "OOP_is_about_messages"}, ns); err != nil {
+			t.Fatalf("\t%s\tShould be able to sign in after unlock. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to sign in after unlock.", tests.Success)
+
+		if _, err := f.attempts.Query(ctx, entity.UserNameAttemptsKey("alan")); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant failures with a user name to be forgotten after sign in, got: %v", tests.Failed, err)
+		}
+		a, err := f.attempts.Query(ctx, entity.IPAttemptsKey(ns.IP))
+		if err != nil || a.Failures != 3 {
+			t.Fatalf("\t%s\tWant failures from an IP address to stay counted, got: %d, error: %v", tests.Failed, a.Failures, err)
+		}
+		t.Logf("\t%s\tShould forget failures with a user name, but not a successful attempt from an IP address.", tests.Success)
+	})
+
+	t.Run("Given the need to throttle concurrent sign in attempts", func(t *testing.T) {
+		f := newAuthFixture(AuthConfig{
+			UserNameThrottle: entity.LoginThrottle{MaxFailures: 4, BackoffBase: time.Minute, Lockout: time.Hour, Window: time.Hour},
+			IPThrottle:       entity.LoginThrottle{MaxFailures: 100, BackoffBase: time.Minute, Lockout: time.Hour, Window: time.Hour},
+		})
+		f.signUp(t, "alan", "OOP_is_about_messages")
+
+		n := 20
+		var mu sync.Mutex
+		var checked int
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				_, err := f.service.SignIn(ctx, entity.Credentials{UserName: "alan", Password: "wrong"}, ns)
+				switch errors.Cause(err) {
+				case ErrInvalidCredentials:
+					mu.Lock()
+					checked++
+					mu.Unlock()
+				case ErrTooManyAttempts:
+				default:
+					t.Errorf("\t%s\tWant invalid credentials or too many attempts, got: %v", tests.Failed, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		// Two free failures and the one that starts a backoff.
+		if checked > 3 {
+			t.Fatalf("\t%s\tWant passwords of 3 attempts at most to be checked, got: %d", tests.Failed, checked)
+		}
+		t.Logf("\t%s\tShould check passwords of %d of %d concurrent attempts.", tests.Success, checked, n)
+	})
+
+	t.Run("Given the need to end a session along with it`s access tokens", func(t *testing.T) {
+		f := newAuthFixture(AuthConfig{})
+		u := f.signUp(t, "alan", "OOP_is_about_messages")
+		sessions := NewSessionService(f.sessions, f.tokens)
+
+		res, err := f.service.SignIn(ctx, entity.Credentials{UserName: "alan", Password: "OOP_is_about_messages"}, ns)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to sign in. Error: %s", tests.Failed, err)
+		}
+		claims, err := entity.ParseAccessTokenClaims(res.AccessToken)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to parse an access token. Error: %s", tests.Failed, err)
+		}
+
+		started, err := f.sessions.QueryByID(ctx, claims.Session_id)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to get a session. Error: %s", tests.Failed, err)
+		}
+		if started.ExpiresAt.Sub(started.LastUsed) != entity.SessionTTL || started.ExpiresAt.Unix() < claims.ExpiresAt {
+			t.Fatalf("\t%s\tWant a session to outlive it`s access token that expires at %v, got: %v", tests.Failed, time.Unix(claims.ExpiresAt, 0), started.ExpiresAt)
+		}
+		t.Logf("\t%s\tShould start a session that outlives it`s access token.", tests.Success)
+
+		time.Sleep(10 * time.Millisecond)
+		pair, err := f.service.Refresh(ctx, res.RefreshToken)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to refresh tokens. Error: %s", tests.Failed, err)
+		}
+		refreshedClaims, err := entity.ParseAccessTokenClaims(pair.AccessToken)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to parse an access token. Error: %s", tests.Failed, err)
+		}
+		refreshed, err := f.sessions.QueryByID(ctx, claims.Session_id)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to get a session. Error: %s", tests.Failed, err)
+		}
+		if !refreshed.ExpiresAt.After(started.ExpiresAt) || refreshed.ExpiresAt.Unix() < refreshedClaims.ExpiresAt {
+			t.Fatalf("\t%s\tWant a session to be extended on refresh past it`s new access token, got: %v, was: %v", tests.Failed, refreshed.ExpiresAt, started.ExpiresAt)
+		}
+		t.Logf("\t%s\tShould extend a session on refresh.", tests.Success)
+
+		if err := sessions.VerifySession(ctx, u.ID, claims.Session_id); err != nil {
+			t.Fatalf("\t%s\tShould accept an active session. Error: %s", tests.Failed, err)
+		}
+		if err := sessions.VerifySession(ctx, "someone else", claims.Session_id); errors.Cause(err) != entity.ErrSessionEnded {
+			t.Fatalf("\t%s\tWant a session of another user to be rejected, got: %v", tests.Failed, err)
+		}
+		if err := sessions.Revoke(ctx, u.ID, claims.Session_id); err != nil {
+			t.Fatalf("\t%s\tShould be able to revoke a session. Error: %s", tests.Failed, err)
+		}
+		if err := sessions.VerifySession(ctx, u.ID, claims.Session_id); errors.Cause(err) != entity.ErrSessionEnded {
+			t.Fatalf("\t%s\tWant a revoked session to be rejected, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould reject access tokens of a revoked session.", tests.Success)
+	})
+	t.Run("Given the need to revoke a family of refresh tokens once one of them is reused", func(t *testing.T) {
+		f := newAuthFixture(AuthConfig{})
+		u := f.signUp(t, "alan", "OOP_is_about_messages")
+		sessions := NewSessionService(f.sessions, f.tokens)
+		credentials := entity.Credentials{UserName: "alan", Password: "OOP_is_about_messages"}
+
+		stolen, err := f.service.SignIn(ctx, credentials, ns)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to sign in. Error: %s", tests.Failed, err)
+		}
+		other, err := f.service.SignIn(ctx, credentials, ns)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to sign in. Error: %s", tests.Failed, err)
+		}
+		claims, err := entity.ParseAccessTokenClaims(stolen.AccessToken)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to parse an access token. Error: %s", tests.Failed, err)
+		}
+
+		rotated, err := f.service.Refresh(ctx, stolen.RefreshToken)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to refresh tokens. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould rotate a refresh token.", tests.Success)
+
+		if _, err := f.service.Refresh(ctx, stolen.RefreshToken); errors.Cause(err) != ErrRefreshTokenReused {
+			t.Fatalf("\t%s\tWant ErrRefreshTokenReused for a rotated refresh token, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould detect reuse of a rotated refresh token.", tests.Success)
+
+		if _, err := f.service.Refresh(ctx, rotated.RefreshToken); errors.Cause(err) != ErrInvalidRefreshToken {
+			t.Fatalf("\t%s\tWant the latest refresh token of a family to be revoked, got: %v", tests.Failed, err)
+		}
+		if _, err := f.sessions.QueryByID(ctx, claims.Session_id); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant a session of a family to be ended, got: %v", tests.Failed, err)
+		}
+		if err := sessions.VerifySession(ctx, u.ID, claims.Session_id); errors.Cause(err) != entity.ErrSessionEnded {
+			t.Fatalf("\t%s\tWant access tokens of a family to be rejected, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould revoke a whole family along with it`s session.", tests.Success)
+
+		if _, err := f.service.Refresh(ctx, other.RefreshToken); err != nil {
+			t.Fatalf("\t%s\tShould keep other sessions of a user. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould keep other sessions of a user.", tests.Success)
+	})
+}
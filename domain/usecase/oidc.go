@@ -0,0 +1,249 @@
+package usecase
+
+import (
+	"context"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/oidc"
+	"github.com/rtbe/clean-rest-api/repository/identity"
+	oidclogin "github.com/rtbe/clean-rest-api/repository/oidc_login"
+)
+
+// OIDC is an interface that represents sign in through external identity providers business domain use case.
+type OIDC interface {
+	Providers() []string
+	Login(ctx context.Context, provider string) (authURL, state string, err error)
+	Callback(ctx context.Context, provider, state, code string, newSession entity.NewSession) (entity.SignInResult, error)
+}
+
+var (
+	// ErrUnknownProvider is returned when identity provider is not configured.
+	ErrUnknownProvider = entity.NotFoundError("unknown identity provider")
+
+	// ErrInvalidOIDCState is returned when a provider redirects back with state of unknown,
+	// expired or already completed login.
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+
+	// ErrExternalAuthFailed is returned when a provider refuses to exchange authorization code
+	// or returns ID token that can not be verified.
+	ErrExternalAuthFailed = entity.UnauthorizedError("external authentication failed")
+
+	// ErrIdentityConflict is returned when external identity can not be linked to a user safely:
+	// a user with the same email exists, but either a provider or a user did not verify it.
+	ErrIdentityConflict = entity.ConflictError("external identity can not be linked to a user")
+)
+
+// OIDCService is an business domain intermidiate layer
+// between external identity providers and user DB layer (repository).
+type OIDCService struct {
+	providers    map[string]*oidc.Provider
+	loginRepo    oidclogin.Repository
+	identityRepo identity.Repository
+	userService  User
+	auth         *AuthService
+	loginTTL     time.Duration
+}
+
+// NewOIDCService creates a new service of sign in through external identity providers,
+// loginTTL is a period of time a user has to authenticate at a provider.
+func NewOIDCService(
+	providers map[string]*oidc.Provider,
+	lr oidclogin.Repository,
+	ir identity.Repository,
+	u User,
+	a *AuthService,
+	loginTTL time.Duration,
+) *OIDCService {
+	return &OIDCService{
+		providers:    providers,
+		loginRepo:    lr,
+		identityRepo: ir,
+		userService:  u,
+		auth:         a,
+		loginTTL:     loginTTL,
+	}
+}
+
+// Providers returns names of configured identity providers.
+func (s *OIDCService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Login starts a login through identity provider and returns an URL a user should be redirected to
+// along with a state that a provider returns back.
+func (s *OIDCService) Login(ctx context.Context, provider string) (string, string, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		secret, err := oidc.RandomString()
+		if err != nil {
+			return "", "", err
+		}
+		secrets[i] = secret
+	}
+
+	l := entity.OIDCLogin{
+		State:        secrets[0],
+		Provider:     provider,
+		Nonce:        secrets[1],
+		CodeVerifier: secrets[2],
+		ExpiresAt:    time.Now().Add(s.loginTTL).Unix(),
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, l.State, l.Nonce, l.CodeVerifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := s.loginRepo.Create(ctx, l); err != nil {
+		return "", "", err
+	}
+
+	return authURL, l.State, nil
+}
+
+// Callback completes a login through identity provider: authorization code is exchanged for ID token
+// and a user it asserts is signed in like with a password.
+// External identity seen for the first time is linked to a user with the same email
+// if both a provider and a user verified it, otherwise a new user is created.
+func (s *OIDCService) Callback(ctx context.Context, provider, state, code string, ns entity.NewSession) (entity.SignInResult, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return entity.SignInResult{}, ErrUnknownProvider
+	}
+
+	l, err := s.loginRepo.Take(ctx, state)
+	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return entity.SignInResult{}, ErrInvalidOIDCState
+		}
+		return entity.SignInResult{}, err
+	}
+
+	if l.Provider != provider || l.ExpiresAt < time.Now().Unix() {
+		return entity.SignInResult{}, ErrInvalidOIDCState
+	}
+
+	claims, err := p.Exchange(ctx, code, l.CodeVerifier, l.Nonce)
+	if err != nil {
+		return entity.SignInResult{}, errors.Wrap(ErrExternalAuthFailed, err.Error())
+	}
+
+	u, err := s.user(ctx, provider, claims)
+	if err != nil {
+		return entity.SignInResult{}, err
+	}
+
+	return s.auth.completeSignIn(ctx, u, ns)
+}
+
+// user finds a user external identity is linked to, linking it first if it is seen for the first time.
+func (s *OIDCService) user(ctx context.Context, provider string, claims oidc.Claims) (entity.User, error) {
+	ei, err := s.identityRepo.QueryBySubject(ctx, provider, claims.Subject)
+	if err == nil {
+		return s.userService.QueryByID(ctx, ei.UserID)
+	}
+	if errors.Cause(err) != database.ErrNotFound {
+		return entity.User{}, err
+	}
+
+	if claims.Email == "" {
+		return entity.User{}, errors.Wrap(ErrIdentityConflict, "provider did not assert an email")
+	}
+
+	u, err := s.userService.QueryByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		// Otherwise whoever registered with someone else`s email or controls an account
+		// at a provider that does not check emails would take over an account.
+		if !claims.EmailVerified || !u.EmailVerified {
+			return entity.User{}, ErrIdentityConflict
+		}
+	case errors.Cause(err) == database.ErrNotFound:
+		if u, err = s.createUser(ctx, claims); err != nil {
+			return entity.User{}, err
+		}
+	default:
+		return entity.User{}, err
+	}
+
+	err = s.identityRepo.Create(ctx, entity.ExternalIdentity{
+		Provider:    provider,
+		Subject:     claims.Subject,
+		UserID:      u.ID,
+		Email:       claims.Email,
+		DateCreated: time.Now().UTC(),
+	})
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	return u, nil
+}
+
+// createUser creates a new user from claims of ID token.
+// A user gets a basic role and a random password, so he can sign in only through a provider
+// until he resets his password.
+func (s *OIDCService) createUser(ctx context.Context, claims oidc.Claims) (entity.User, error) {
+	userName, err := s.userName(ctx, claims)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	password, err := oidc.RandomString()
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	return s.userService.Create(ctx, entity.NewUser{
+		UserName:        userName,
+		FirstName:       claims.GivenName,
+		LastName:        claims.FamilyName,
+		Email:           claims.Email,
+		Password:        password,
+		PasswordConfirm: password,
+		Roles:           []string{entity.UserRole},
+		EmailVerified:   claims.EmailVerified,
+	})
+}
+
+// userName picks a free user name for a new user, preferring the one a user has at a provider.
+func (s *OIDCService) userName(ctx context.Context, claims oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+
+	userName := base
+	for i := 0; i < 5; i++ {
+		_, err := s.userService.QueryByUserName(ctx, userName)
+		if errors.Cause(err) == database.ErrNotFound {
+			return userName, nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		id := uuid.New()
+		userName = base + "-" + hex.EncodeToString(id[:3])
+	}
+
+	return "", errors.Errorf("no free user name for %s", base)
+}
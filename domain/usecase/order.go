@@ -2,43 +2,307 @@ package usecase
 
 import (
 	"context"
+	"sort"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/query"
 	"github.com/rtbe/clean-rest-api/repository/order"
+	orderitem "github.com/rtbe/clean-rest-api/repository/order_item"
+	"github.com/rtbe/clean-rest-api/repository/outbox"
+	"github.com/rtbe/clean-rest-api/repository/product"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
 )
 
+// ErrOutOfStock is returned when there is not enough of a product in stock to check out an order.
+var ErrOutOfStock = entity.ConflictError("product is out of stock")
+
 // Order is an interface that represents order domain use case.
 type Order interface {
 	Create(ctx context.Context, newOrder entity.NewOrder) (entity.Order, error)
-	Query(ctx context.Context, lastSeenID, limit string) ([]entity.Order, error)
+	Checkout(ctx context.Context, newCheckout entity.NewCheckout) (entity.Checkout, error)
+	Query(ctx context.Context, q query.Query) ([]entity.Order, query.Page, error)
 	QueryByID(ctx context.Context, id string) (entity.Order, error)
 	QueryByUserID(ctx context.Context, userID string) ([]entity.Order, error)
-	Update(ctx context.Context, id string, updateOrder entity.UpdateOrder) error
-	Delete(ctx context.Context, id string) error
+	QueryStatusHistory(ctx context.Context, id string) ([]entity.OrderStatusChange, error)
+	Update(ctx context.Context, id, actorID string, version int, updateOrder entity.UpdateOrder) error
+	Delete(ctx context.Context, id string, version int) error
 	DeleteByUserID(ctx context.Context, userID string) error
+	Restore(ctx context.Context, id string) error
 }
 
 // OrderService is an business domain intermidiate layer
 // between order entity, order item entity and database layer (repository).
+// Every change of an order, it`s items and products is recorded into audit log along with it,
+// creation of orders, their status transitions and changes of stock are published to other systems as domain events.
 type OrderService struct {
-	orderRepo order.Repository
+	orderRepo     order.Repository
+	orderItemRepo orderitem.Repository
+	productRepo   product.Repository
+	events        outbox.Repository
+	tx            transaction.Manager
+	audit         *AuditService
+	// taxRate is a tax rate in basis points (1/100 of a percent) applied to order subtotal.
+	taxRate int
 }
 
 // NewOrderService creates a new order entity service.
-func NewOrderService(orderRepo order.Repository) *OrderService {
+func NewOrderService(
+	orderRepo order.Repository,
+	orderItemRepo orderitem.Repository,
+	productRepo product.Repository,
+	events outbox.Repository,
+	tx transaction.Manager,
+	audit *AuditService,
+	taxRate int,
+) *OrderService {
 	return &OrderService{
-		orderRepo: orderRepo,
+		orderRepo:     orderRepo,
+		orderItemRepo: orderItemRepo,
+		productRepo:   productRepo,
+		events:        events,
+		tx:            tx,
+		audit:         audit,
+		taxRate:       taxRate,
 	}
 }
 
 // Create creates a new order.
+// Every new order starts it`s lifecycle as pending.
 func (s *OrderService) Create(ctx context.Context, no entity.NewOrder) (entity.Order, error) {
-	return s.orderRepo.Create(ctx, no)
+	no.Status = entity.OrderStatusPending
+
+	var o entity.Order
+	err := s.tx.Run(ctx, func(ctx context.Context) error {
+		var err error
+		o, err = s.orderRepo.Create(ctx, no)
+		if err != nil {
+			return err
+		}
+
+		err = emit(ctx, s.events, entity.AggregateOrder, o.ID, entity.OrderCreated{
+			OrderID: o.ID,
+			UserID:  o.UserID,
+			Status:  o.Status,
+			Total:   o.Total,
+			Items:   []entity.OrderCreatedItem{},
+		})
+		if err != nil {
+			return err
+		}
+
+		return s.audit.Record(ctx, entity.AuditEntityOrder, o.ID, entity.AuditActionCreate, nil, o)
+	})
+	if err != nil {
+		return entity.Order{}, err
+	}
+
+	return o, nil
+}
+
+// Checkout creates a new order together with it`s items and reserves stock of ordered products.
+// All of that happens inside of a single transaction,
+// so if any of products is out of stock the whole order is rejected with ErrOutOfStock.
+func (s *OrderService) Checkout(ctx context.Context, nc entity.NewCheckout) (entity.Checkout, error) {
+	items := mergeCheckoutItems(nc.Items)
+
+	var checkout entity.Checkout
+	err := s.tx.Run(ctx, func(ctx context.Context) error {
+		o, err := s.orderRepo.Create(ctx, entity.NewOrder{
+			UserID: nc.UserID,
+			Status: entity.OrderStatusPending,
+		})
+		if err != nil {
+			return err
+		}
+		checkout.Order = o
+
+		for _, item := range items {
+			p, err := takeStock(ctx, s.productRepo, s.events, s.audit, item.ProductID, item.Quantity)
+			if err != nil {
+				return err
+			}
+
+			oi, err := s.orderItemRepo.Create(ctx, entity.NewOrderItem{
+				OrderID:      o.ID,
+				ProductID:    item.ProductID,
+				Quantity:     item.Quantity,
+				UnitPrice:    p.Price,
+				ProductTitle: p.Title,
+			})
+			if err != nil {
+				return err
+			}
+			if err := s.audit.Record(ctx, entity.AuditEntityOrderItem, oi.ID, entity.AuditActionCreate, nil, oi); err != nil {
+				return err
+			}
+			checkout.Items = append(checkout.Items, oi)
+		}
+
+		checkout.Order.OrderTotals = entity.CalculateOrderTotals(checkout.Items, s.taxRate)
+		if err := s.orderRepo.UpdateTotals(ctx, o.ID, checkout.Order.OrderTotals); err != nil {
+			return err
+		}
+
+		created := entity.OrderCreated{
+			OrderID: o.ID,
+			UserID:  o.UserID,
+			Status:  o.Status,
+			Total:   checkout.Order.Total,
+			Items:   make([]entity.OrderCreatedItem, 0, len(checkout.Items)),
+		}
+		for _, oi := range checkout.Items {
+			created.Items = append(created.Items, entity.OrderCreatedItem{
+				ProductID: oi.ProductID,
+				Quantity:  oi.Quantity,
+				UnitPrice: oi.UnitPrice,
+			})
+		}
+		if err := emit(ctx, s.events, entity.AggregateOrder, o.ID, created); err != nil {
+			return err
+		}
+
+		return s.audit.Record(ctx, entity.AuditEntityOrder, o.ID, entity.AuditActionCreate, nil, checkout.Order)
+	})
+	if err != nil {
+		return entity.Checkout{}, err
+	}
+
+	return checkout, nil
+}
+
+// recalculateOrderTotals recomputes money amounts of an order from it`s current items and saves them.
+// Order row is locked while doing so, that way concurrent changes of order items do not overwrite each other totals.
+// It should be called with a context that carries a transaction.
+func recalculateOrderTotals(
+	ctx context.Context,
+	orderRepo order.Repository,
+	orderItemRepo orderitem.Repository,
+	taxRate int,
+	orderID string,
+) error {
+	if _, err := orderRepo.QueryByIDForUpdate(ctx, orderID); err != nil {
+		return err
+	}
+
+	items, err := orderItemRepo.QueryByOrderID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	return orderRepo.UpdateTotals(ctx, orderID, entity.CalculateOrderTotals(items, taxRate))
+}
+
+// takeStock takes a quantity of a product out of stock and returns a product as it was before that,
+// a negative quantity gives it back. Product row is locked until the end of a transaction,
+// so concurrent orders can not oversell it, ErrOutOfStock is returned if there is not enough of a product.
+// Every change of stock is recorded into audit log and published as entity.ProductStockChanged.
+// Stock of a deleted product is not given back, since it is not sold anymore.
+// It should be called with a context that carries a transaction.
+func takeStock(
+	ctx context.Context,
+	productRepo product.Repository,
+	events outbox.Repository,
+	audit *AuditService,
+	productID string,
+	quantity int,
+) (entity.Product, error) {
+	p, err := productRepo.QueryByIDForUpdate(ctx, productID)
+	if err != nil {
+		if quantity < 0 && errors.Cause(err) == database.ErrNotFound {
+			return entity.Product{}, nil
+		}
+		return entity.Product{}, err
+	}
+	if quantity == 0 {
+		return p, nil
+	}
+
+	if p.Stock < quantity {
+		return entity.Product{}, errors.Wrapf(ErrOutOfStock, "product with id %s: want %d, have %d", p.ID, quantity, p.Stock)
+	}
+
+	stock := p.Stock - quantity
+	if err := productRepo.Update(ctx, p.ID, p.Version, entity.UpdateProduct{Stock: &stock}); err != nil {
+		return entity.Product{}, err
+	}
+
+	updated, err := productRepo.QueryByID(ctx, p.ID)
+	if err != nil {
+		return entity.Product{}, err
+	}
+	if err := audit.Record(ctx, entity.AuditEntityProduct, p.ID, entity.AuditActionUpdate, p, updated); err != nil {
+		return entity.Product{}, err
+	}
+
+	err = emit(ctx, events, entity.AggregateProduct, p.ID, entity.ProductStockChanged{
+		ProductID: p.ID,
+		FromStock: p.Stock,
+		ToStock:   stock,
+	})
+	if err != nil {
+		return entity.Product{}, err
+	}
+
+	return p, nil
+}
+
+// releaseStock gives quantities of order items back to stock.
+// Products are locked in order of their ids, as they are on checkout, so releases and checkouts can not deadlock.
+// It should be called with a context that carries a transaction.
+func releaseStock(
+	ctx context.Context,
+	productRepo product.Repository,
+	events outbox.Repository,
+	audit *AuditService,
+	items []entity.OrderItem,
+) error {
+	taken := make([]entity.NewCheckoutItem, 0, len(items))
+	for _, oi := range items {
+		taken = append(taken, entity.NewCheckoutItem{ProductID: oi.ProductID, Quantity: oi.Quantity})
+	}
+
+	for _, item := range mergeCheckoutItems(taken) {
+		if _, err := takeStock(ctx, productRepo, events, audit, item.ProductID, -item.Quantity); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reservesStock tells whether items of an order with a given status hold their quantities out of stock.
+// Items of pending and paid orders do, items of shipped and delivered ones have left the stock,
+// and items of cancelled and refunded ones were given back to it.
+func reservesStock(status string) bool {
+	return status == entity.OrderStatusPending || status == entity.OrderStatusPaid
+}
+
+// mergeCheckoutItems sums quantities of repeated products
+// and sorts items by product id, so concurrent checkouts always lock product rows in the same order
+// and can not deadlock each other.
+func mergeCheckoutItems(items []entity.NewCheckoutItem) []entity.NewCheckoutItem {
+	quantities := make(map[string]int, len(items))
+	for _, item := range items {
+		quantities[item.ProductID] += item.Quantity
+	}
+
+	merged := make([]entity.NewCheckoutItem, 0, len(quantities))
+	for id, quantity := range quantities {
+		merged = append(merged, entity.NewCheckoutItem{ProductID: id, Quantity: quantity})
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].ProductID < merged[j].ProductID
+	})
+
+	return merged
 }
 
 // Query gets a paginated list of orders.
-func (s *OrderService) Query(ctx context.Context, lastSeenID, limit string) ([]entity.Order, error) {
-	return s.orderRepo.Query(ctx, lastSeenID, limit)
+func (s *OrderService) Query(ctx context.Context, q query.Query) ([]entity.Order, query.Page, error) {
+	return s.orderRepo.Query(ctx, q)
 }
 
 // QueryByID queries a specific order.
@@ -51,17 +315,267 @@ func (s *OrderService) QueryByUserID(ctx context.Context, userID string) ([]enti
 	return s.orderRepo.QueryByUserID(ctx, userID)
 }
 
+// QueryStatusHistory queries status transitions of a specific order.
+func (s *OrderService) QueryStatusHistory(ctx context.Context, id string) ([]entity.OrderStatusChange, error) {
+	if _, err := s.orderRepo.QueryByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.orderRepo.QueryStatusHistory(ctx, id)
+}
+
 // Update updates a specific order.
-func (s *OrderService) Update(ctx context.Context, id string, uo entity.UpdateOrder) error {
-	return s.orderRepo.Update(ctx, id, uo)
+// Status of an order can only be changed according to order lifecycle,
+// otherwise entity.ErrInvalidStatusTransition is returned.
+// Every status transition is recorded into order status history on behalf of the given actor.
+// Items of an order that is cancelled or refunded before it was shipped are given back to stock.
+// An order is updated only if it still has given version, zero version matches any.
+func (s *OrderService) Update(ctx context.Context, id, actorID string, version int, uo entity.UpdateOrder) error {
+	return s.tx.Run(ctx, func(ctx context.Context) error {
+		o, err := s.orderRepo.QueryByIDForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		statusChanged := uo.Status != nil && *uo.Status != o.Status
+		if statusChanged {
+			if err := entity.ValidateStatusTransition(o.Status, *uo.Status); err != nil {
+				return err
+			}
+		}
+
+		if err := s.orderRepo.Update(ctx, id, version, uo); err != nil {
+			return err
+		}
+
+		// Items of an order that is cancelled or refunded before it was shipped go back to stock.
+		if statusChanged && reservesStock(o.Status) && !reservesStock(*uo.Status) && *uo.Status != entity.OrderStatusShipped {
+			items, err := s.orderItemRepo.QueryByOrderID(ctx, id)
+			if err != nil {
+				return err
+			}
+			if err := releaseStock(ctx, s.productRepo, s.events, s.audit, items); err != nil {
+				return err
+			}
+		}
+
+		if statusChanged {
+			_, err = s.orderRepo.CreateStatusChange(ctx, entity.OrderStatusChange{
+				OrderID:    id,
+				FromStatus: o.Status,
+				ToStatus:   *uo.Status,
+				Actor:      actorID,
+				Reason:     uo.Reason,
+			})
+			if err != nil {
+				return err
+			}
+
+			err = emit(ctx, s.events, entity.AggregateOrder, id, entity.OrderStatusChanged{
+				OrderID:    id,
+				FromStatus: o.Status,
+				ToStatus:   *uo.Status,
+				Actor:      actorID,
+				Reason:     uo.Reason,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		updated, err := s.orderRepo.QueryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return s.audit.Record(ctx, entity.AuditEntityOrder, id, entity.AuditActionUpdate, o, updated)
+	})
 }
 
-// Delete deletes a specific order.
-func (s *OrderService) Delete(ctx context.Context, id string) error {
-	return s.orderRepo.Delete(ctx, id)
+// Delete deletes a specific order if it still has given version, zero version matches any.
+func (s *OrderService) Delete(ctx context.Context, id string, version int) error {
+	return s.tx.Run(ctx, func(ctx context.Context) error {
+		o, err := s.orderRepo.QueryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := s.orderRepo.Delete(ctx, id, version); err != nil {
+			return err
+		}
+		if err := s.audit.Record(ctx, entity.AuditEntityOrder, id, entity.AuditActionDelete, o, nil); err != nil {
+			return err
+		}
+
+		return deleteOrderItems(ctx, s.orderItemRepo, s.audit, id)
+	})
 }
 
-// DeleteByUserID deletes orders belonging to specific user.
+// DeleteByUserID deletes orders belonging to specific user along with their items.
 func (s *OrderService) DeleteByUserID(ctx context.Context, userID string) error {
-	return s.orderRepo.DeleteByUserID(ctx, userID)
+	return s.tx.Run(ctx, func(ctx context.Context) error {
+		return deleteUserOrders(ctx, s.orderRepo, s.orderItemRepo, s.audit, userID)
+	})
+}
+
+// Restore restores a specific deleted order along with items that were deleted with it.
+func (s *OrderService) Restore(ctx context.Context, id string) error {
+	return s.tx.Run(ctx, func(ctx context.Context) error {
+		deleted, err := queryDeletedOrder(ctx, s.orderRepo, id)
+		if err != nil {
+			return err
+		}
+
+		if err := s.orderRepo.Restore(ctx, id); err != nil {
+			return err
+		}
+		if err := restoreOrderItems(ctx, s.orderItemRepo, s.audit, id, *deleted.DeletedAt); err != nil {
+			return err
+		}
+
+		o, err := s.orderRepo.QueryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return s.audit.Record(ctx, entity.AuditEntityOrder, id, entity.AuditActionRestore, nil, o)
+	})
+}
+
+// deleteUserOrders deletes orders of a user along with their items and records that into audit log.
+// It should be called with a context that carries a transaction.
+func deleteUserOrders(ctx context.Context, orders order.Repository, items orderitem.Repository, audit *AuditService, userID string) error {
+	oo, err := orders.QueryByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := orders.DeleteByUserID(ctx, userID); err != nil {
+		return err
+	}
+
+	for _, o := range oo {
+		if err := audit.Record(ctx, entity.AuditEntityOrder, o.ID, entity.AuditActionDelete, o, nil); err != nil {
+			return err
+		}
+		if err := deleteOrderItems(ctx, items, audit, o.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreUserOrders restores orders of a user that were deleted since given time along with their items
+// and records that into audit log. Orders deleted earlier, e.g. on their own, stay deleted.
+// It should be called with a context that carries a transaction.
+func restoreUserOrders(
+	ctx context.Context,
+	orders order.Repository,
+	items orderitem.Repository,
+	audit *AuditService,
+	userID string,
+	since time.Time,
+) error {
+	before, err := orders.QueryByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	live := make(map[string]bool, len(before))
+	for _, o := range before {
+		live[o.ID] = true
+	}
+
+	if err := orders.RestoreByUserID(ctx, userID, since); err != nil {
+		return err
+	}
+
+	after, err := orders.QueryByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, o := range after {
+		if live[o.ID] {
+			continue
+		}
+		if err := audit.Record(ctx, entity.AuditEntityOrder, o.ID, entity.AuditActionRestore, nil, o); err != nil {
+			return err
+		}
+		if err := restoreOrderItems(ctx, items, audit, o.ID, since); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteOrderItems deletes items of an order along with it and records that into audit log.
+// Totals of an order and stock of products are left as they are, so they still match items once it is restored.
+// It should be called with a context that carries a transaction.
+func deleteOrderItems(ctx context.Context, items orderitem.Repository, audit *AuditService, orderID string) error {
+	oo, err := items.QueryByOrderID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	if err := items.DeleteByOrderID(ctx, orderID); err != nil {
+		return err
+	}
+
+	for _, oi := range oo {
+		if err := audit.Record(ctx, entity.AuditEntityOrderItem, oi.ID, entity.AuditActionDelete, oi, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreOrderItems restores items of an order that were deleted since given time and records that into audit log.
+// Items deleted earlier, e.g. on their own, stay deleted.
+// It should be called with a context that carries a transaction.
+func restoreOrderItems(ctx context.Context, items orderitem.Repository, audit *AuditService, orderID string, since time.Time) error {
+	before, err := items.QueryByOrderID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	live := make(map[string]bool, len(before))
+	for _, oi := range before {
+		live[oi.ID] = true
+	}
+
+	if err := items.RestoreByOrderID(ctx, orderID, since); err != nil {
+		return err
+	}
+
+	after, err := items.QueryByOrderID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	for _, oi := range after {
+		if live[oi.ID] {
+			continue
+		}
+		if err := audit.Record(ctx, entity.AuditEntityOrderItem, oi.ID, entity.AuditActionRestore, nil, oi); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// queryDeletedOrder gets a deleted order by given id, so it is known when it was deleted.
+func queryDeletedOrder(ctx context.Context, orders order.Repository, id string) (entity.Order, error) {
+	oo, _, err := orders.Query(ctx, query.Query{
+		Filters:        []query.Filter{{Field: "order_id", Op: query.Eq, Value: id}},
+		Limit:          1,
+		IncludeDeleted: true,
+	})
+	if err != nil {
+		return entity.Order{}, errors.Wrapf(err, "getting a deleted order with id %s", id)
+	}
+	if len(oo) == 0 || oo[0].DeletedAt == nil {
+		return entity.Order{}, errors.Wrapf(database.ErrNotFound, "deleted order %s", id)
+	}
+
+	return oo[0], nil
 }
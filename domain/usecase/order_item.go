@@ -3,42 +3,109 @@ package usecase
 import (
 	"context"
 
+	"github.com/pkg/errors"
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/repository/order"
 	orderitem "github.com/rtbe/clean-rest-api/repository/order_item"
+	"github.com/rtbe/clean-rest-api/repository/outbox"
+	"github.com/rtbe/clean-rest-api/repository/product"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
 )
 
+// ErrOrderNotPending is returned when items of an order are changed after it has left pending status,
+// e.g. once it was paid for.
+var ErrOrderNotPending = entity.ConflictError("items can be changed only while an order is pending")
+
 // OrderItem is an interface that represents order item domain use case.
 type OrderItem interface {
 	Create(ctx context.Context, newOrderItem entity.NewOrderItem) (entity.OrderItem, error)
-	Query(ctx context.Context, lastSeenID, limit string) ([]entity.OrderItem, error)
+	Query(ctx context.Context, q query.Query) ([]entity.OrderItem, query.Page, error)
 	QueryByID(ctx context.Context, id string) (entity.OrderItem, error)
 	QueryByOrderID(ctx context.Context, orderID string) ([]entity.OrderItem, error)
-	Update(ctx context.Context, id string, updateOrderItem entity.UpdateOrderItem) error
-	Delete(ctx context.Context, id string) error
+	Update(ctx context.Context, id string, version int, updateOrderItem entity.UpdateOrderItem) error
+	Delete(ctx context.Context, id string, version int) error
 	DeleteByOrderID(ctx context.Context, orderID string) error
+	Restore(ctx context.Context, id string) error
 }
 
 // OrderItemService is an business domain intermidiate layer
 // between order entity and DB layer (repository).
+// Items can be changed only while their order is pending.
+// It keeps totals of an order up to date whenever it`s items change,
+// and takes quantities of items out of stock and gives them back the same way checkout does.
+// Every change of an order item is recorded into audit log along with it.
 type OrderItemService struct {
-	repo orderitem.Repository
+	repo        orderitem.Repository
+	orderRepo   order.Repository
+	productRepo product.Repository
+	events      outbox.Repository
+	tx          transaction.Manager
+	audit       *AuditService
+	// taxRate is a tax rate in basis points (1/100 of a percent) applied to order subtotal.
+	taxRate int
 }
 
 // NewOrderItemService creates a new order item entity service.
-func NewOrderItemService(r orderitem.Repository) *OrderItemService {
+func NewOrderItemService(
+	r orderitem.Repository,
+	orderRepo order.Repository,
+	productRepo product.Repository,
+	events outbox.Repository,
+	tx transaction.Manager,
+	audit *AuditService,
+	taxRate int,
+) *OrderItemService {
 	return &OrderItemService{
-		repo: r,
+		repo:        r,
+		orderRepo:   orderRepo,
+		productRepo: productRepo,
+		events:      events,
+		tx:          tx,
+		audit:       audit,
+		taxRate:     taxRate,
 	}
 }
 
 // Create creates a new order item.
+// Price and title of a product are captured into an order item,
+// so later changes of a product do not change value of an order.
+// A quantity of an item is taken out of stock, ErrOutOfStock is returned if there is not enough of a product.
 func (s *OrderItemService) Create(ctx context.Context, no entity.NewOrderItem) (entity.OrderItem, error) {
-	return s.repo.Create(ctx, no)
+	var oi entity.OrderItem
+	err := s.tx.Run(ctx, func(ctx context.Context) error {
+		if err := s.lockPendingOrder(ctx, no.OrderID); err != nil {
+			return err
+		}
+
+		p, err := takeStock(ctx, s.productRepo, s.events, s.audit, no.ProductID, no.Quantity)
+		if err != nil {
+			return err
+		}
+		no.UnitPrice = p.Price
+		no.ProductTitle = p.Title
+
+		oi, err = s.repo.Create(ctx, no)
+		if err != nil {
+			return err
+		}
+
+		if err := s.audit.Record(ctx, entity.AuditEntityOrderItem, oi.ID, entity.AuditActionCreate, nil, oi); err != nil {
+			return err
+		}
+
+		return recalculateOrderTotals(ctx, s.orderRepo, s.repo, s.taxRate, oi.OrderID)
+	})
+	if err != nil {
+		return entity.OrderItem{}, err
+	}
+
+	return oi, nil
 }
 
 // Query gets a paginated list of orders items.
-func (s *OrderItemService) Query(ctx context.Context, lastSeenID, limit string) ([]entity.OrderItem, error) {
-	return s.repo.Query(ctx, lastSeenID, limit)
+func (s *OrderItemService) Query(ctx context.Context, q query.Query) ([]entity.OrderItem, query.Page, error) {
+	return s.repo.Query(ctx, q)
 }
 
 // QueryByID gets an order item by given id.
@@ -51,17 +118,136 @@ func (s *OrderItemService) QueryByOrderID(ctx context.Context, orderID string) (
 	return s.repo.QueryByOrderID(ctx, orderID)
 }
 
-// Update updates order item.
-func (s *OrderItemService) Update(ctx context.Context, id string, uoi entity.UpdateOrderItem) error {
-	return s.repo.Update(ctx, id, uoi)
+// Update updates order item if it still has given version, zero version matches any.
+// A change of quantity is taken out of stock or given back to it.
+func (s *OrderItemService) Update(ctx context.Context, id string, version int, uoi entity.UpdateOrderItem) error {
+	return s.tx.Run(ctx, func(ctx context.Context) error {
+		oi, err := s.repo.QueryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := s.lockPendingOrder(ctx, oi.OrderID); err != nil {
+			return err
+		}
+		if uoi.Quantity != nil {
+			if _, err := takeStock(ctx, s.productRepo, s.events, s.audit, oi.ProductID, *uoi.Quantity-oi.Quantity); err != nil {
+				return err
+			}
+		}
+
+		if err := s.repo.Update(ctx, id, version, uoi); err != nil {
+			return err
+		}
+
+		updated, err := s.repo.QueryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.audit.Record(ctx, entity.AuditEntityOrderItem, id, entity.AuditActionUpdate, oi, updated); err != nil {
+			return err
+		}
+
+		return recalculateOrderTotals(ctx, s.orderRepo, s.repo, s.taxRate, oi.OrderID)
+	})
 }
 
-// Delete deletes an order item by given id.
-func (s *OrderItemService) Delete(ctx context.Context, id string) error {
-	return s.repo.Delete(ctx, id)
+// Delete deletes an order item by given id if it still has given version, zero version matches any.
+// A quantity of an item is given back to stock.
+func (s *OrderItemService) Delete(ctx context.Context, id string, version int) error {
+	return s.tx.Run(ctx, func(ctx context.Context) error {
+		oi, err := s.repo.QueryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := s.lockPendingOrder(ctx, oi.OrderID); err != nil {
+			return err
+		}
+
+		if err := s.repo.Delete(ctx, id, version); err != nil {
+			return err
+		}
+		if err := releaseStock(ctx, s.productRepo, s.events, s.audit, []entity.OrderItem{oi}); err != nil {
+			return err
+		}
+
+		if err := s.audit.Record(ctx, entity.AuditEntityOrderItem, id, entity.AuditActionDelete, oi, nil); err != nil {
+			return err
+		}
+
+		return recalculateOrderTotals(ctx, s.orderRepo, s.repo, s.taxRate, oi.OrderID)
+	})
 }
 
-// DeleteByOrderID deletes all order items for particular order.
+// DeleteByOrderID deletes all order items for particular order and gives their quantities back to stock.
 func (s *OrderItemService) DeleteByOrderID(ctx context.Context, orderID string) error {
-	return s.repo.DeleteByOrderID(ctx, orderID)
+	return s.tx.Run(ctx, func(ctx context.Context) error {
+		if err := s.lockPendingOrder(ctx, orderID); err != nil {
+			return err
+		}
+
+		items, err := s.repo.QueryByOrderID(ctx, orderID)
+		if err != nil {
+			return err
+		}
+
+		if err := s.repo.DeleteByOrderID(ctx, orderID); err != nil {
+			return err
+		}
+		if err := releaseStock(ctx, s.productRepo, s.events, s.audit, items); err != nil {
+			return err
+		}
+
+		for _, oi := range items {
+			if err := s.audit.Record(ctx, entity.AuditEntityOrderItem, oi.ID, entity.AuditActionDelete, oi, nil); err != nil {
+				return err
+			}
+		}
+
+		return recalculateOrderTotals(ctx, s.orderRepo, s.repo, s.taxRate, orderID)
+	})
+}
+
+// Restore restores a deleted order item by given id and takes it`s quantity out of stock again.
+func (s *OrderItemService) Restore(ctx context.Context, id string) error {
+	return s.tx.Run(ctx, func(ctx context.Context) error {
+		if err := s.repo.Restore(ctx, id); err != nil {
+			return err
+		}
+
+		oi, err := s.repo.QueryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := s.lockPendingOrder(ctx, oi.OrderID); err != nil {
+			return err
+		}
+		if _, err := takeStock(ctx, s.productRepo, s.events, s.audit, oi.ProductID, oi.Quantity); err != nil {
+			return err
+		}
+
+		if err := s.audit.Record(ctx, entity.AuditEntityOrderItem, id, entity.AuditActionRestore, nil, oi); err != nil {
+			return err
+		}
+
+		return recalculateOrderTotals(ctx, s.orderRepo, s.repo, s.taxRate, oi.OrderID)
+	})
+}
+
+// lockPendingOrder locks an order before products, as it is done on checkout,
+// and returns ErrOrderNotPending if items of an order can not be changed anymore.
+// It should be called with a context that carries a transaction.
+func (s *OrderItemService) lockPendingOrder(ctx context.Context, orderID string) error {
+	o, err := s.orderRepo.QueryByIDForUpdate(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	if o.Status != entity.OrderStatusPending {
+		return errors.Wrapf(ErrOrderNotPending, "order with id %s is %s", o.ID, o.Status)
+	}
+
+	return nil
 }
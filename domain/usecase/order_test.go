@@ -0,0 +1,395 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+	"github.com/rtbe/clean-rest-api/repository/audit"
+	"github.com/rtbe/clean-rest-api/repository/order"
+	orderitem "github.com/rtbe/clean-rest-api/repository/order_item"
+	"github.com/rtbe/clean-rest-api/repository/outbox"
+	"github.com/rtbe/clean-rest-api/repository/product"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
+	"github.com/rtbe/clean-rest-api/repository/user"
+)
+
+// orderFixture is an order service and an order item service along with in-memory repositories they keep data in.
+type orderFixture struct {
+	service   *OrderService
+	items     *OrderItemService
+	orders    *order.InMemRepo
+	orderItem *orderitem.InMemRepo
+	products  *product.InMemRepo
+	events    *outbox.InMemRepo
+	audit     *audit.InMemRepo
+}
+
+// newOrderFixture creates an order service and an order item service on top of empty in-memory repositories.
+func newOrderFixture(taxRate int) orderFixture {
+	f := orderFixture{
+		orders: order.NewInMemRepo(),
+		events: outbox.NewInMemRepo(),
+		audit:  audit.NewInMemRepo(),
+	}
+	f.orderItem = orderitem.NewInMemRepo(f.orders)
+	f.products = product.NewInMemRepo(f.orderItem)
+	tx := transaction.NewInMemManager()
+	f.service = NewOrderService(f.orders, f.orderItem, f.products, f.events, tx, NewAuditService(f.audit), taxRate)
+	f.items = NewOrderItemService(f.orderItem, f.orders, f.products, f.events, tx, NewAuditService(f.audit), taxRate)
+
+	return f
+}
+
+// createProduct creates a product in a fixture or fails a test.
+func (f orderFixture) createProduct(t *testing.T, title string, price entity.Money, stock int) entity.Product {
+	p, err := f.products.Create(context.Background(), entity.NewProduct{Title: title, Price: price, Stock: stock})
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to create a product. Error: %s", tests.Failed, err)
+	}
+	return p
+}
+
+// stock gets a current stock of a product in a fixture or fails a test.
+func (f orderFixture) stock(t *testing.T, id string) int {
+	p, err := f.products.QueryByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to query a product. Error: %s", tests.Failed, err)
+	}
+	return p.Stock
+}
+
+func TestOrderService(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Given the need to reject a whole checkout if a product is out of stock", func(t *testing.T) {
+		f := newOrderFixture(0)
+
+		// Items are processed in order of their product IDs,
+		// so the product that is in stock comes first and is changed before the checkout fails.
+		a := f.createProduct(t, "first product", 100, 5)
+		b := f.createProduct(t, "second product", 200, 1)
+		inStock, outOfStock := a, b
+		if b.ID < a.ID {
+			inStock, outOfStock = b, a
+		}
+
+		_, err := f.service.Checkout(ctx, entity.NewCheckout{
+			UserID: "user",
+			Items: []entity.NewCheckoutItem{
+				{ProductID: inStock.ID, Quantity: 1},
+				{ProductID: outOfStock.ID, Quantity: outOfStock.Stock + 1},
+			},
+		})
+		if errors.Cause(err) != ErrOutOfStock {
+			t.Fatalf("\t%s\tShould get ErrOutOfStock, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould get ErrOutOfStock.", tests.Success)
+
+		if got := f.stock(t, inStock.ID); got != inStock.Stock {
+			t.Fatalf("\t%s\tShould keep stock of a product that is in stock: want %d, got %d", tests.Failed, inStock.Stock, got)
+		}
+		if got := f.stock(t, outOfStock.ID); got != outOfStock.Stock {
+			t.Fatalf("\t%s\tShould keep stock of a product that is out of stock: want %d, got %d", tests.Failed, outOfStock.Stock, got)
+		}
+		t.Logf("\t%s\tShould keep stock of all products.", tests.Success)
+
+		orders, _, err := f.orders.Query(ctx, query.Query{Limit: query.MaxLimit, IncludeDeleted: true})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to query orders. Error: %s", tests.Failed, err)
+		}
+		items, _, err := f.orderItem.Query(ctx, query.Query{Limit: query.MaxLimit, IncludeDeleted: true})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to query order items. Error: %s", tests.Failed, err)
+		}
+		if len(orders) != 0 || len(items) != 0 {
+			t.Fatalf("\t%s\tShould not keep an order or it`s items, got %d orders and %d items", tests.Failed, len(orders), len(items))
+		}
+		t.Logf("\t%s\tShould not keep an order or it`s items.", tests.Success)
+
+		events, err := f.events.QueryPending(ctx, time.Now().Add(time.Hour), query.MaxLimit)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to query events. Error: %s", tests.Failed, err)
+		}
+		records, _, err := f.audit.Query(ctx, query.Query{Limit: query.MaxLimit})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to query audit records. Error: %s", tests.Failed, err)
+		}
+		if len(events) != 0 || len(records) != 0 {
+			t.Fatalf("\t%s\tShould not keep events or audit records, got %d events and %d records", tests.Failed, len(events), len(records))
+		}
+		t.Logf("\t%s\tShould not keep events or audit records.", tests.Success)
+	})
+	t.Run("Given the need to check out an order", func(t *testing.T) {
+		// 8.25% tax.
+		f := newOrderFixture(825)
+		a := f.createProduct(t, "first product", 1999, 10)
+		b := f.createProduct(t, "second product", 350, 5)
+
+		c, err := f.service.Checkout(ctx, entity.NewCheckout{
+			UserID: "user",
+			Items: []entity.NewCheckoutItem{
+				{ProductID: a.ID, Quantity: 2},
+				{ProductID: b.ID, Quantity: 1},
+				{ProductID: a.ID, Quantity: 1},
+			},
+		})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to check out an order. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to check out an order.", tests.Success)
+
+		quantities := make(map[string]int)
+		for _, oi := range c.Items {
+			quantities[oi.ProductID] += oi.Quantity
+		}
+		if len(c.Items) != 2 || quantities[a.ID] != 3 || quantities[b.ID] != 1 {
+			t.Fatalf("\t%s\tWant duplicate items merged into 3 of %s and 1 of %s, got: %+v", tests.Failed, a.ID, b.ID, c.Items)
+		}
+		if items, err := f.orderItem.QueryByOrderID(ctx, c.Order.ID); err != nil || len(items) != 2 {
+			t.Fatalf("\t%s\tWant 2 items to be kept, got: %d, error: %v", tests.Failed, len(items), err)
+		}
+		t.Logf("\t%s\tShould merge duplicate items of a product.", tests.Success)
+
+		if got := f.stock(t, a.ID); got != 7 {
+			t.Fatalf("\t%s\tShould decrement stock of a product by merged quantity: want %d, got %d", tests.Failed, 7, got)
+		}
+		if got := f.stock(t, b.ID); got != 4 {
+			t.Fatalf("\t%s\tShould decrement stock of a product: want %d, got %d", tests.Failed, 4, got)
+		}
+		t.Logf("\t%s\tShould decrement stock of all products.", tests.Success)
+
+		// 3 * 19.99 + 3.50 = 63.47, tax of it is 5.236275 which is rounded to 5.24.
+		want := entity.OrderTotals{Subtotal: 6347, Tax: 524, Total: 6871}
+		if c.Order.OrderTotals != want {
+			t.Fatalf("\t%s\tWant totals: %+v, got: %+v", tests.Failed, want, c.Order.OrderTotals)
+		}
+		o, err := f.orders.QueryByID(ctx, c.Order.ID)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to query an order. Error: %s", tests.Failed, err)
+		}
+		if o.OrderTotals != want {
+			t.Fatalf("\t%s\tWant kept totals: %+v, got: %+v", tests.Failed, want, o.OrderTotals)
+		}
+		t.Logf("\t%s\tShould calculate and keep totals of an order.", tests.Success)
+	})
+
+	t.Run("Given the need to keep stock of a product along with order items", func(t *testing.T) {
+		f := newOrderFixture(0)
+		p := f.createProduct(t, "product", 100, 5)
+
+		c, err := f.service.Checkout(ctx, entity.NewCheckout{UserID: "user", Items: []entity.NewCheckoutItem{{ProductID: p.ID, Quantity: 1}}})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to check out an order. Error: %s", tests.Failed, err)
+		}
+
+		if _, err := f.items.Create(ctx, entity.NewOrderItem{OrderID: c.Order.ID, ProductID: p.ID, Quantity: 5}); errors.Cause(err) != ErrOutOfStock {
+			t.Fatalf("\t%s\tWant ErrOutOfStock on adding more than is in stock, got: %v", tests.Failed, err)
+		}
+		if got := f.stock(t, p.ID); got != 4 {
+			t.Fatalf("\t%s\tShould keep stock of a product: want %d, got %d", tests.Failed, 4, got)
+		}
+		t.Logf("\t%s\tShould not add an item if a product is out of stock.", tests.Success)
+
+		oi, err := f.items.Create(ctx, entity.NewOrderItem{OrderID: c.Order.ID, ProductID: p.ID, Quantity: 2})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to add an item. Error: %s", tests.Failed, err)
+		}
+		if got := f.stock(t, p.ID); got != 2 {
+			t.Fatalf("\t%s\tShould take an added item out of stock: want %d, got %d", tests.Failed, 2, got)
+		}
+		t.Logf("\t%s\tShould take an added item out of stock.", tests.Success)
+
+		tt := []struct {
+			name     string
+			quantity int
+			err      error
+			stock    int
+		}{
+			{name: "Raise over stock", quantity: 5, err: ErrOutOfStock, stock: 2},
+			{name: "Raise within stock", quantity: 4, stock: 0},
+			{name: "Lower", quantity: 1, stock: 3},
+		}
+		for testID, tc := range tt {
+			err := f.items.Update(ctx, oi.ID, 0, entity.UpdateOrderItem{Quantity: &tc.quantity})
+			if errors.Cause(err) != tc.err {
+				t.Fatalf("\t%s\tTest %d:\tWant error: %v, got: %v", tests.Failed, testID, tc.err, err)
+			}
+			if got := f.stock(t, p.ID); got != tc.stock {
+				t.Fatalf("\t%s\tTest %d:\tWant stock: %d, got: %d", tests.Failed, testID, tc.stock, got)
+			}
+			t.Logf("\t%s\tTest %d:\t%s: want stock: %d", tests.Success, testID, tc.name, tc.stock)
+		}
+
+		if err := f.items.Delete(ctx, oi.ID, 0); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete an item. Error: %s", tests.Failed, err)
+		}
+		if got := f.stock(t, p.ID); got != 4 {
+			t.Fatalf("\t%s\tShould give a deleted item back to stock: want %d, got %d", tests.Failed, 4, got)
+		}
+		t.Logf("\t%s\tShould give a deleted item back to stock.", tests.Success)
+
+		cancelled := entity.OrderStatusCancelled
+		if err := f.service.Update(ctx, c.Order.ID, "admin", 0, entity.UpdateOrder{Status: &cancelled}); err != nil {
+			t.Fatalf("\t%s\tShould be able to cancel an order. Error: %s", tests.Failed, err)
+		}
+		if got := f.stock(t, p.ID); got != 5 {
+			t.Fatalf("\t%s\tShould give items of a cancelled order back to stock: want %d, got %d", tests.Failed, 5, got)
+		}
+		t.Logf("\t%s\tShould give items of a cancelled order back to stock.", tests.Success)
+	})
+
+	t.Run("Given the need to change items of pending orders only", func(t *testing.T) {
+		f := newOrderFixture(0)
+		p := f.createProduct(t, "product", 100, 5)
+
+		c, err := f.service.Checkout(ctx, entity.NewCheckout{
+			UserID: "user",
+			Items:  []entity.NewCheckoutItem{{ProductID: p.ID, Quantity: 1}, {ProductID: p.ID, Quantity: 1}},
+		})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to check out an order. Error: %s", tests.Failed, err)
+		}
+		oi, deleted := c.Items[0], entity.OrderItem{}
+		if deleted, err = f.items.Create(ctx, entity.NewOrderItem{OrderID: c.Order.ID, ProductID: p.ID, Quantity: 1}); err != nil {
+			t.Fatalf("\t%s\tShould be able to add an item to a pending order. Error: %s", tests.Failed, err)
+		}
+		if err := f.items.Delete(ctx, deleted.ID, 0); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete an item of a pending order. Error: %s", tests.Failed, err)
+		}
+
+		paid := entity.OrderStatusPaid
+		if err := f.service.Update(ctx, c.Order.ID, "admin", 0, entity.UpdateOrder{Status: &paid}); err != nil {
+			t.Fatalf("\t%s\tShould be able to pay for an order. Error: %s", tests.Failed, err)
+		}
+		quantity := 2
+
+		tt := []struct {
+			name   string
+			change func() error
+		}{
+			{name: "Create", change: func() error {
+				_, err := f.items.Create(ctx, entity.NewOrderItem{OrderID: c.Order.ID, ProductID: p.ID, Quantity: 1})
+				return err
+			}},
+			{name: "Update", change: func() error {
+				return f.items.Update(ctx, oi.ID, 0, entity.UpdateOrderItem{Quantity: &quantity})
+			}},
+			{name: "Delete", change: func() error { return f.items.Delete(ctx, oi.ID, 0) }},
+			{name: "DeleteByOrderID", change: func() error { return f.items.DeleteByOrderID(ctx, c.Order.ID) }},
+			{name: "Restore", change: func() error { return f.items.Restore(ctx, deleted.ID) }},
+		}
+		for testID, tc := range tt {
+			if err := tc.change(); errors.Cause(err) != ErrOrderNotPending {
+				t.Fatalf("\t%s\tTest %d:\tWant ErrOrderNotPending, got: %v", tests.Failed, testID, err)
+			}
+			if got := f.stock(t, p.ID); got != 3 {
+				t.Fatalf("\t%s\tTest %d:\tWant stock: %d, got: %d", tests.Failed, testID, 3, got)
+			}
+			t.Logf("\t%s\tTest %d:\t%s: should not change items of a paid order.", tests.Success, testID, tc.name)
+		}
+
+		o, err := f.service.QueryByID(ctx, c.Order.ID)
+		if err != nil || o.Subtotal != 200 {
+			t.Fatalf("\t%s\tWant subtotal of a paid order to stay %d, got: %d, error: %v", tests.Failed, 200, o.Subtotal, err)
+		}
+		t.Logf("\t%s\tShould keep totals of a paid order.", tests.Success)
+	})
+
+	t.Run("Given the need to delete and restore an order along with it`s items", func(t *testing.T) {
+		f := newOrderFixture(0)
+		p := f.createProduct(t, "product", 100, 10)
+		q := f.createProduct(t, "another product", 200, 10)
+
+		c, err := f.service.Checkout(ctx, entity.NewCheckout{
+			UserID: "user",
+			Items:  []entity.NewCheckoutItem{{ProductID: p.ID, Quantity: 1}, {ProductID: q.ID, Quantity: 1}},
+		})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to check out an order. Error: %s", tests.Failed, err)
+		}
+		removed, kept := c.Items[0], c.Items[1]
+		if err := f.orderItem.Delete(ctx, removed.ID, 0); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete an order item. Error: %s", tests.Failed, err)
+		}
+		time.Sleep(time.Millisecond)
+
+		if err := f.service.Delete(ctx, c.Order.ID, 0); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete an order. Error: %s", tests.Failed, err)
+		}
+		if items, err := f.orderItem.QueryByOrderID(ctx, c.Order.ID); err != nil || len(items) != 0 {
+			t.Fatalf("\t%s\tWant items of a deleted order to be hidden, got: %d, error: %v", tests.Failed, len(items), err)
+		}
+		t.Logf("\t%s\tShould delete items along with an order.", tests.Success)
+
+		if err := f.service.Restore(ctx, c.Order.ID); err != nil {
+			t.Fatalf("\t%s\tShould be able to restore an order. Error: %s", tests.Failed, err)
+		}
+		items, err := f.orderItem.QueryByOrderID(ctx, c.Order.ID)
+		if err != nil || len(items) != 1 || items[0].ID != kept.ID {
+			t.Fatalf("\t%s\tWant only item %s to be restored, got: %+v, error: %v", tests.Failed, kept.ID, items, err)
+		}
+		t.Logf("\t%s\tShould restore items deleted along with an order only.", tests.Success)
+
+		if err := f.service.Restore(ctx, c.Order.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on restore of an order that is not deleted, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould not restore an order that is not deleted.", tests.Success)
+	})
+
+	t.Run("Given the need to delete and restore orders along with a user", func(t *testing.T) {
+		f := newOrderFixture(0)
+		users := NewUserService(user.NewInMemRepo(nil), f.orders, f.orderItem, f.events, transaction.NewInMemManager(), NewAuditService(f.audit))
+		u, err := users.Create(ctx, entity.NewUser{
+			UserName:        "alan",
+			Email:           "alan@example.com",
+			Password:        "OOP_is_about_messages",
+			PasswordConfirm: "OOP_is_about_messages",
+		})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create a user. Error: %s", tests.Failed, err)
+		}
+		p := f.createProduct(t, "product", 100, 10)
+
+		checkout := func() entity.Checkout {
+			c, err := f.service.Checkout(ctx, entity.NewCheckout{UserID: u.ID, Items: []entity.NewCheckoutItem{{ProductID: p.ID, Quantity: 1}}})
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to check out an order. Error: %s", tests.Failed, err)
+			}
+			return c
+		}
+		deleted, active := checkout(), checkout()
+		if err := f.service.Delete(ctx, deleted.Order.ID, 0); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete an order. Error: %s", tests.Failed, err)
+		}
+		time.Sleep(time.Millisecond)
+
+		if err := users.Delete(ctx, u.ID, 0); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete a user. Error: %s", tests.Failed, err)
+		}
+		if orders, err := f.orders.QueryByUserID(ctx, u.ID); err != nil || len(orders) != 0 {
+			t.Fatalf("\t%s\tWant orders of a deleted user to be hidden, got: %d, error: %v", tests.Failed, len(orders), err)
+		}
+		if items, err := f.orderItem.QueryByOrderID(ctx, active.Order.ID); err != nil || len(items) != 0 {
+			t.Fatalf("\t%s\tWant items of orders of a deleted user to be hidden, got: %d, error: %v", tests.Failed, len(items), err)
+		}
+		t.Logf("\t%s\tShould delete orders and their items along with a user.", tests.Success)
+
+		if err := users.Restore(ctx, u.ID); err != nil {
+			t.Fatalf("\t%s\tShould be able to restore a user. Error: %s", tests.Failed, err)
+		}
+		orders, err := f.orders.QueryByUserID(ctx, u.ID)
+		if err != nil || len(orders) != 1 || orders[0].ID != active.Order.ID {
+			t.Fatalf("\t%s\tWant only order %s to be restored, got: %+v, error: %v", tests.Failed, active.Order.ID, orders, err)
+		}
+		if items, err := f.orderItem.QueryByOrderID(ctx, active.Order.ID); err != nil || len(items) != 1 {
+			t.Fatalf("\t%s\tWant items of a restored order to be restored, got: %d, error: %v", tests.Failed, len(items), err)
+		}
+		t.Logf("\t%s\tShould restore orders deleted along with a user only.", tests.Success)
+	})
+}
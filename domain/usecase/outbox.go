@@ -0,0 +1,89 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/event"
+	"github.com/rtbe/clean-rest-api/repository/outbox"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
+)
+
+// emit writes a domain event that happened to an aggregate into outbox.
+// It should be called with the same context a change was made with, so an event is published
+// only if a transaction of the change is committed.
+func emit(ctx context.Context, repo outbox.Repository, aggregateType, aggregateID string, payload entity.EventPayload) error {
+	ne, err := entity.NewDomainEvent(aggregateType, aggregateID, payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.Create(ctx, ne)
+	return err
+}
+
+// OutboxRelayConfig is a configuration of outbox relay.
+type OutboxRelayConfig struct {
+	// BatchSize is a max number of events published at once.
+	BatchSize int
+	// RetryBase is a delay before the first retry to publish an event, it doubles with every failed attempt.
+	RetryBase time.Duration
+	// RetryMax is a max delay between attempts to publish an event.
+	RetryMax time.Duration
+}
+
+// OutboxRelay publishes domain events written into outbox by other services.
+// Delivery is at least once: an event is published again if it`s publishing fails
+// or if the relay stops before an event is marked as published.
+// Events of an aggregate are published one by one in order they happened,
+// an event that can not be published holds back later events of the same aggregate.
+type OutboxRelay struct {
+	repo      outbox.Repository
+	tx        transaction.Manager
+	publisher event.Publisher
+	cfg       OutboxRelayConfig
+}
+
+// NewOutboxRelay creates a new relay of outbox events.
+func NewOutboxRelay(repo outbox.Repository, tx transaction.Manager, publisher event.Publisher, cfg OutboxRelayConfig) *OutboxRelay {
+	return &OutboxRelay{
+		repo:      repo,
+		tx:        tx,
+		publisher: publisher,
+		cfg:       cfg,
+	}
+}
+
+// Relay publishes a batch of pending events and returns how many of them were published and how many failed.
+// Failed events are retried with exponential backoff.
+func (r *OutboxRelay) Relay(ctx context.Context) (published, failed int, err error) {
+	err = r.tx.Run(ctx, func(ctx context.Context) error {
+		published, failed = 0, 0
+
+		events, err := r.repo.QueryPending(ctx, time.Now().UTC(), r.cfg.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range events {
+			if err := r.publisher.Publish(ctx, e); err != nil {
+				next := time.Now().UTC().Add(entity.EventRetryDelay(e.Attempts+1, r.cfg.RetryBase, r.cfg.RetryMax))
+				if err := r.repo.MarkFailed(ctx, e.ID, next, err.Error()); err != nil {
+					return err
+				}
+				failed++
+				continue
+			}
+
+			if err := r.repo.MarkPublished(ctx, e.ID, time.Now().UTC()); err != nil {
+				return err
+			}
+			published++
+		}
+
+		return nil
+	})
+
+	return published, failed, err
+}
@@ -4,39 +4,71 @@ import (
 	"context"
 
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/repository/outbox"
 	"github.com/rtbe/clean-rest-api/repository/product"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
 )
 
 // Product is an interface that represents product business domain use case.
 type Product interface {
 	Create(ctx context.Context, newProduct entity.NewProduct) (entity.Product, error)
-	Query(ctx context.Context, lastSeenID, limit string) ([]entity.Product, error)
+	Query(ctx context.Context, q query.Query) ([]entity.Product, query.Page, error)
+	Search(ctx context.Context, text string, limit int) ([]entity.ProductSearchResult, error)
 	QueryByID(ctx context.Context, id string) (entity.Product, error)
-	Update(ctx context.Context, id string, updateProduct entity.UpdateProduct) error
-	Delete(ctx context.Context, id string) error
+	Update(ctx context.Context, id string, version int, updateProduct entity.UpdateProduct) error
+	Delete(ctx context.Context, id string, version int) error
+	Restore(ctx context.Context, id string) error
 }
 
 // ProductService is an business domain intermidiate layer
 // between product entity and product DB layer (repository).
+// Every change of a product is recorded into audit log along with it,
+// changes of stock are published to other systems as domain events.
 type ProductService struct {
-	repo product.Repository
+	repo   product.Repository
+	events outbox.Repository
+	tx     transaction.Manager
+	audit  *AuditService
 }
 
 // NewProductService creates a new product entity service.
-func NewProductService(r product.Repository) *ProductService {
+func NewProductService(r product.Repository, events outbox.Repository, tx transaction.Manager, audit *AuditService) *ProductService {
 	return &ProductService{
-		repo: r,
+		repo:   r,
+		events: events,
+		tx:     tx,
+		audit:  audit,
 	}
 }
 
 // Create creates a new product.
 func (s *ProductService) Create(ctx context.Context, np entity.NewProduct) (entity.Product, error) {
-	return s.repo.Create(ctx, np)
+	var p entity.Product
+	err := s.tx.Run(ctx, func(ctx context.Context) error {
+		var err error
+		p, err = s.repo.Create(ctx, np)
+		if err != nil {
+			return err
+		}
+
+		return s.audit.Record(ctx, entity.AuditEntityProduct, p.ID, entity.AuditActionCreate, nil, p)
+	})
+	if err != nil {
+		return entity.Product{}, err
+	}
+
+	return p, nil
 }
 
 // Query gets a paginated list of products.
-func (s *ProductService) Query(ctx context.Context, lastSeenID, limit string) ([]entity.Product, error) {
-	return s.repo.Query(ctx, lastSeenID, limit)
+func (s *ProductService) Query(ctx context.Context, q query.Query) ([]entity.Product, query.Page, error) {
+	return s.repo.Query(ctx, q)
+}
+
+// Search finds products by keywords in their title and description, most relevant first.
+func (s *ProductService) Search(ctx context.Context, text string, limit int) ([]entity.ProductSearchResult, error) {
+	return s.repo.Search(ctx, text, limit)
 }
 
 // QueryByID queries product by given id.
@@ -44,12 +76,66 @@ func (s *ProductService) QueryByID(ctx context.Context, id string) (entity.Produ
 	return s.repo.QueryByID(ctx, id)
 }
 
-// Update updates particular product.
-func (s *ProductService) Update(ctx context.Context, id string, up entity.UpdateProduct) error {
-	return s.repo.Update(ctx, id, up)
+// Update updates particular product if it still has given version, zero version matches any.
+func (s *ProductService) Update(ctx context.Context, id string, version int, up entity.UpdateProduct) error {
+	return s.tx.Run(ctx, func(ctx context.Context) error {
+		before, err := s.repo.QueryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := s.repo.Update(ctx, id, version, up); err != nil {
+			return err
+		}
+
+		after, err := s.repo.QueryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if before.Stock != after.Stock {
+			err := emit(ctx, s.events, entity.AggregateProduct, id, entity.ProductStockChanged{
+				ProductID: id,
+				FromStock: before.Stock,
+				ToStock:   after.Stock,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return s.audit.Record(ctx, entity.AuditEntityProduct, id, entity.AuditActionUpdate, before, after)
+	})
 }
 
-// Delete deletes Product by given id.
-func (s *ProductService) Delete(ctx context.Context, id string) error {
-	return s.repo.Delete(ctx, id)
+// Delete deletes Product by given id if it still has given version, zero version matches any.
+func (s *ProductService) Delete(ctx context.Context, id string, version int) error {
+	return s.tx.Run(ctx, func(ctx context.Context) error {
+		before, err := s.repo.QueryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := s.repo.Delete(ctx, id, version); err != nil {
+			return err
+		}
+
+		return s.audit.Record(ctx, entity.AuditEntityProduct, id, entity.AuditActionDelete, before, nil)
+	})
+}
+
+// Restore restores a deleted product by given id.
+func (s *ProductService) Restore(ctx context.Context, id string) error {
+	return s.tx.Run(ctx, func(ctx context.Context) error {
+		if err := s.repo.Restore(ctx, id); err != nil {
+			return err
+		}
+
+		after, err := s.repo.QueryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return s.audit.Record(ctx, entity.AuditEntityProduct, id, entity.AuditActionRestore, nil, after)
+	})
 }
@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/repository/idempotency"
+	"github.com/rtbe/clean-rest-api/repository/order"
+	orderitem "github.com/rtbe/clean-rest-api/repository/order_item"
+	"github.com/rtbe/clean-rest-api/repository/product"
+	"github.com/rtbe/clean-rest-api/repository/user"
+)
+
+// PurgeService permanently removes deleted entities once their retention period is over.
+// Until then deleted entities can be restored.
+// Expired records of requests made with Idempotency-Key header are removed along the way.
+type PurgeService struct {
+	userRepo        user.Repository
+	productRepo     product.Repository
+	orderRepo       order.Repository
+	orderItemRepo   orderitem.Repository
+	idempotencyRepo idempotency.Repository
+	// retention is a period of time deleted entities are kept for, zero retention keeps them forever.
+	retention time.Duration
+}
+
+// NewPurgeService creates a new service that purges deleted entities.
+func NewPurgeService(
+	userRepo user.Repository,
+	productRepo product.Repository,
+	orderRepo order.Repository,
+	orderItemRepo orderitem.Repository,
+	idempotencyRepo idempotency.Repository,
+	retention time.Duration,
+) *PurgeService {
+	return &PurgeService{
+		userRepo:        userRepo,
+		productRepo:     productRepo,
+		orderRepo:       orderRepo,
+		orderItemRepo:   orderItemRepo,
+		idempotencyRepo: idempotencyRepo,
+		retention:       retention,
+	}
+}
+
+// Purge removes entities that were deleted more than retention period ago
+// along with expired idempotency records and returns how many were removed.
+// Order items and orders go first, so products and users they referenced can be removed in the same run.
+func (s *PurgeService) Purge(ctx context.Context) (int64, error) {
+	now := time.Now().UTC()
+
+	total, err := s.idempotencyRepo.Purge(ctx, now)
+	if err != nil || s.retention <= 0 {
+		return total, err
+	}
+
+	before := now.Add(-s.retention)
+	for _, purge := range []func(context.Context, time.Time) (int64, error){
+		s.orderItemRepo.Purge,
+		s.orderRepo.Purge,
+		s.productRepo.Purge,
+		s.userRepo.Purge,
+	} {
+		n, err := purge(ctx, before)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+
+	return total, nil
+}
@@ -0,0 +1,86 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/repository/auth"
+	"github.com/rtbe/clean-rest-api/repository/session"
+)
+
+// Session is an interface that represents session business domain use case.
+type Session interface {
+	QueryByUserID(ctx context.Context, userID string) ([]entity.Session, error)
+	Revoke(ctx context.Context, userID, id string) error
+	RevokeAll(ctx context.Context, userID string) error
+	VerifySession(ctx context.Context, userID, id string) error
+}
+
+// SessionService is an business domain intermidiate layer
+// between session entity and session DB layer (repository).
+type SessionService struct {
+	sessionRepo session.Repository
+	authRepo    auth.Repository
+}
+
+// NewSessionService creates a new session entity service.
+func NewSessionService(sr session.Repository, ar auth.Repository) *SessionService {
+	return &SessionService{
+		sessionRepo: sr,
+		authRepo:    ar,
+	}
+}
+
+// QueryByUserID gets all active sessions of particular user.
+func (s *SessionService) QueryByUserID(ctx context.Context, userID string) ([]entity.Session, error) {
+	return s.sessionRepo.QueryByUserID(ctx, userID)
+}
+
+// Revoke ends a session of particular user, so tokens issued within it can not be used anymore.
+func (s *SessionService) Revoke(ctx context.Context, userID, id string) error {
+	ss, err := s.sessionRepo.QueryByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Sessions of other users are hidden as if they did not exist.
+	if ss.UserID != userID {
+		return errors.Wrapf(database.ErrNotFound, "session %s", id)
+	}
+
+	if err := s.authRepo.DeleteFamily(ctx, id); err != nil {
+		return err
+	}
+
+	return s.sessionRepo.Delete(ctx, id)
+}
+
+// RevokeAll ends all sessions of particular user, signing him out everywhere.
+func (s *SessionService) RevokeAll(ctx context.Context, userID string) error {
+	if err := s.authRepo.DeleteByUserID(ctx, userID); err != nil {
+		return err
+	}
+
+	return s.sessionRepo.DeleteByUserID(ctx, userID)
+}
+
+// VerifySession checks that a session of particular user is neither ended nor expired,
+// so access tokens issued within it are still accepted.
+// It returns entity.ErrSessionEnded otherwise.
+func (s *SessionService) VerifySession(ctx context.Context, userID, id string) error {
+	ss, err := s.sessionRepo.QueryByID(ctx, id)
+	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return entity.ErrSessionEnded
+		}
+		return err
+	}
+
+	if ss.UserID != userID {
+		return entity.ErrSessionEnded
+	}
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/totp"
+	twofactor "github.com/rtbe/clean-rest-api/repository/two_factor"
+)
+
+// TwoFactor is an interface that represents two-factor authentication business domain use case.
+type TwoFactor interface {
+	Enroll(ctx context.Context, userID string) (entity.TwoFactorEnrollment, error)
+	Confirm(ctx context.Context, userID, code string) (entity.RecoveryCodes, error)
+	RegenerateRecoveryCodes(ctx context.Context, userID, code string) (entity.RecoveryCodes, error)
+	Disable(ctx context.Context, userID, code string) error
+	IsEnabled(ctx context.Context, userID string) (bool, error)
+	Verify(ctx context.Context, userID, code string) error
+}
+
+var (
+	// ErrTwoFactorEnabled is returned on enrollment of a user that already has 2FA enabled.
+	ErrTwoFactorEnabled = entity.ConflictError("two-factor authentication is already enabled")
+
+	// ErrTwoFactorNotEnrolled is returned on confirmation of 2FA a user did not enroll in.
+	ErrTwoFactorNotEnrolled = entity.ConflictError("two-factor authentication is not enrolled")
+
+	// ErrTwoFactorNotEnabled is returned when a code is checked for a user that has 2FA disabled.
+	ErrTwoFactorNotEnabled = entity.ConflictError("two-factor authentication is not enabled")
+
+	// ErrInvalidTwoFactorCode is returned when TOTP or recovery code is wrong or was already used.
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor authentication code")
+)
+
+// TwoFactorService is an business domain intermidiate layer
+// between second factor entity and second factor DB layer (repository).
+type TwoFactorService struct {
+	repo        twofactor.Repository
+	userService User
+	// issuer is a name of an application shown by authenticator apps.
+	issuer string
+}
+
+// NewTwoFactorService creates a new second factor entity service.
+func NewTwoFactorService(r twofactor.Repository, u User, issuer string) *TwoFactorService {
+	return &TwoFactorService{
+		repo:        r,
+		userService: u,
+		issuer:      issuer,
+	}
+}
+
+// Enroll generates a new TOTP secret for a user.
+// 2FA stays disabled until a user confirms it with a code from his authenticator app,
+// enrolling again replaces a secret that was not confirmed.
+func (s *TwoFactorService) Enroll(ctx context.Context, userID string) (entity.TwoFactorEnrollment, error) {
+	tf, err := s.repo.QueryByUserID(ctx, userID)
+	if err != nil && errors.Cause(err) != database.ErrNotFound {
+		return entity.TwoFactorEnrollment{}, err
+	}
+	if tf.Enabled {
+		return entity.TwoFactorEnrollment{}, ErrTwoFactorEnabled
+	}
+
+	u, err := s.userService.QueryByID(ctx, userID)
+	if err != nil {
+		return entity.TwoFactorEnrollment{}, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return entity.TwoFactorEnrollment{}, err
+	}
+
+	err = s.repo.Save(ctx, entity.TwoFactor{
+		UserID:      userID,
+		Secret:      secret,
+		DateCreated: time.Now().UTC(),
+	})
+	if err != nil {
+		return entity.TwoFactorEnrollment{}, err
+	}
+
+	return entity.TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.issuer, u.UserName, secret),
+	}, nil
+}
+
+// Confirm enables 2FA of a user if a code from his authenticator app is valid
+// and issues recovery codes.
+func (s *TwoFactorService) Confirm(ctx context.Context, userID, code string) (entity.RecoveryCodes, error) {
+	tf, err := s.repo.QueryByUserID(ctx, userID)
+	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return entity.RecoveryCodes{}, ErrTwoFactorNotEnrolled
+		}
+		return entity.RecoveryCodes{}, err
+	}
+	if tf.Enabled {
+		return entity.RecoveryCodes{}, ErrTwoFactorEnabled
+	}
+
+	if err := s.useTOTP(ctx, tf, code); err != nil {
+		return entity.RecoveryCodes{}, err
+	}
+
+	codes, hashes, err := entity.NewRecoveryCodes()
+	if err != nil {
+		return entity.RecoveryCodes{}, err
+	}
+
+	if err := s.repo.Enable(ctx, userID, hashes); err != nil {
+		return entity.RecoveryCodes{}, err
+	}
+
+	return entity.RecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// RegenerateRecoveryCodes replaces recovery codes of a user that presented a valid code.
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID, code string) (entity.RecoveryCodes, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return entity.RecoveryCodes{}, err
+	}
+
+	codes, hashes, err := entity.NewRecoveryCodes()
+	if err != nil {
+		return entity.RecoveryCodes{}, err
+	}
+
+	if err := s.repo.SetRecoveryCodes(ctx, userID, hashes); err != nil {
+		return entity.RecoveryCodes{}, err
+	}
+
+	return entity.RecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// Disable disables 2FA of a user that presented a valid code.
+func (s *TwoFactorService) Disable(ctx context.Context, userID, code string) error {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+
+	return s.repo.Delete(ctx, userID)
+}
+
+// IsEnabled reports whether a user has 2FA enabled.
+func (s *TwoFactorService) IsEnabled(ctx context.Context, userID string) (bool, error) {
+	tf, err := s.repo.QueryByUserID(ctx, userID)
+	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return tf.Enabled, nil
+}
+
+// Verify checks a TOTP code or a recovery code of a user with enabled 2FA.
+// Every code is accepted only once.
+func (s *TwoFactorService) Verify(ctx context.Context, userID, code string) error {
+	tf, err := s.repo.QueryByUserID(ctx, userID)
+	if err != nil {
+		if errors.Cause(err) == database.ErrNotFound {
+			return ErrTwoFactorNotEnabled
+		}
+		return err
+	}
+	if !tf.Enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if err := s.useTOTP(ctx, tf, code); err != ErrInvalidTwoFactorCode {
+		return err
+	}
+
+	used, err := s.repo.UseRecoveryCode(ctx, userID, entity.HashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// useTOTP checks a TOTP code and remembers it`s period, so it can not be used again.
+func (s *TwoFactorService) useTOTP(ctx context.Context, tf entity.TwoFactor, code string) error {
+	step, ok := totp.Validate(tf.Secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	used, err := s.repo.UseStep(ctx, tf.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
@@ -2,8 +2,14 @@ package usecase
 
 type Services struct {
 	Auth      *AuthService
+	APIKey    *APIKeyService
+	OIDC      *OIDCService
+	Session   *SessionService
+	TwoFactor *TwoFactorService
 	User      *UserService
 	Product   *ProductService
 	Order     *OrderService
 	OrderItem *OrderItemService
+	Audit     *AuditService
+	Webhook   *WebhookService
 }
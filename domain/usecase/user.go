@@ -3,40 +3,93 @@ package usecase
 import (
 	"context"
 
+	"github.com/pkg/errors"
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/repository/order"
+	orderitem "github.com/rtbe/clean-rest-api/repository/order_item"
+	"github.com/rtbe/clean-rest-api/repository/outbox"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
 	"github.com/rtbe/clean-rest-api/repository/user"
 )
 
 // User is an interface that represents user business domain use case.
 type User interface {
 	Create(ctx context.Context, newUser entity.NewUser) (entity.User, error)
-	Query(ctx context.Context, lastSeenUserID, limit string) ([]entity.User, error)
+	Query(ctx context.Context, q query.Query) ([]entity.User, query.Page, error)
 	QueryByID(ctx context.Context, id string) (entity.User, error)
-	Update(ctx context.Context, id string, updateUser entity.UpdateUser) error
-	Delete(ctx context.Context, id string) error
+	QueryByUserName(ctx context.Context, userName string) (entity.User, error)
+	QueryByEmail(ctx context.Context, email string) (entity.User, error)
+	Update(ctx context.Context, id string, version int, updateUser entity.UpdateUser) error
+	Delete(ctx context.Context, id string, version int) error
+	Restore(ctx context.Context, id string) error
 }
 
 // UserService is an business domain intermidiate layer
 // between user entity and user DB layer (repository).
+// Every change of a user is recorded into audit log along with it,
+// registration of a user is published to other systems as a domain event.
+// Orders of a user and their items are deleted and restored along with him.
 type UserService struct {
-	repo user.Repository
+	repo          user.Repository
+	orderRepo     order.Repository
+	orderItemRepo orderitem.Repository
+	events        outbox.Repository
+	tx            transaction.Manager
+	audit         *AuditService
 }
 
 // NewUserService creates a new user entity service.
-func NewUserService(r user.Repository) *UserService {
+func NewUserService(
+	r user.Repository,
+	orderRepo order.Repository,
+	orderItemRepo orderitem.Repository,
+	events outbox.Repository,
+	tx transaction.Manager,
+	audit *AuditService,
+) *UserService {
 	return &UserService{
-		repo: r,
+		repo:          r,
+		orderRepo:     orderRepo,
+		orderItemRepo: orderItemRepo,
+		events:        events,
+		tx:            tx,
+		audit:         audit,
 	}
 }
 
 // Create creates a new user.
 func (s *UserService) Create(ctx context.Context, nu entity.NewUser) (entity.User, error) {
-	return s.repo.Create(ctx, nu)
+	var u entity.User
+	err := s.tx.Run(ctx, func(ctx context.Context) error {
+		var err error
+		u, err = s.repo.Create(ctx, nu)
+		if err != nil {
+			return err
+		}
+
+		err = emit(ctx, s.events, entity.AggregateUser, u.ID, entity.UserRegistered{
+			UserID:   u.ID,
+			UserName: u.UserName,
+			Email:    u.Email,
+		})
+		if err != nil {
+			return err
+		}
+
+		return s.audit.Record(ctx, entity.AuditEntityUser, u.ID, entity.AuditActionCreate, nil, u)
+	})
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	return u, nil
 }
 
 // Query gets a paginated list of users.
-func (s *UserService) Query(ctx context.Context, lastSeenUserID, limit string) ([]entity.User, error) {
-	return s.repo.Query(ctx, lastSeenUserID, limit)
+func (s *UserService) Query(ctx context.Context, q query.Query) ([]entity.User, query.Page, error) {
+	return s.repo.Query(ctx, q)
 }
 
 // QueryByID queries a user by his id.
@@ -44,12 +97,93 @@ func (s *UserService) QueryByID(ctx context.Context, id string) (entity.User, er
 	return s.repo.QueryByID(ctx, id)
 }
 
-// Update updates particular user.
-func (s *UserService) Update(ctx context.Context, id string, uu entity.UpdateUser) error {
-	return s.repo.Update(ctx, id, uu)
+// QueryByUserName queries a user by his user name.
+func (s *UserService) QueryByUserName(ctx context.Context, userName string) (entity.User, error) {
+	return s.repo.QueryByUserName(ctx, userName)
+}
+
+// QueryByEmail queries a user by his email.
+func (s *UserService) QueryByEmail(ctx context.Context, email string) (entity.User, error) {
+	return s.repo.QueryByEmail(ctx, email)
 }
 
-// Delete deletes user by his id.
-func (s *UserService) Delete(ctx context.Context, id string) error {
-	return s.repo.Delete(ctx, id)
+// Update updates particular user if it still has given version, zero version matches any.
+func (s *UserService) Update(ctx context.Context, id string, version int, uu entity.UpdateUser) error {
+	return s.tx.Run(ctx, func(ctx context.Context) error {
+		before, err := s.repo.QueryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := s.repo.Update(ctx, id, version, uu); err != nil {
+			return err
+		}
+
+		after, err := s.repo.QueryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return s.audit.Record(ctx, entity.AuditEntityUser, id, entity.AuditActionUpdate, before, after)
+	})
+}
+
+// Delete deletes user by his id if it still has given version, zero version matches any.
+func (s *UserService) Delete(ctx context.Context, id string, version int) error {
+	return s.tx.Run(ctx, func(ctx context.Context) error {
+		before, err := s.repo.QueryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := s.repo.Delete(ctx, id, version); err != nil {
+			return err
+		}
+		if err := s.audit.Record(ctx, entity.AuditEntityUser, id, entity.AuditActionDelete, before, nil); err != nil {
+			return err
+		}
+
+		return deleteUserOrders(ctx, s.orderRepo, s.orderItemRepo, s.audit, id)
+	})
+}
+
+// Restore restores a deleted user by given id along with orders that were deleted with him.
+func (s *UserService) Restore(ctx context.Context, id string) error {
+	return s.tx.Run(ctx, func(ctx context.Context) error {
+		deleted, err := s.queryDeleted(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := s.repo.Restore(ctx, id); err != nil {
+			return err
+		}
+		if err := restoreUserOrders(ctx, s.orderRepo, s.orderItemRepo, s.audit, id, *deleted.DeletedAt); err != nil {
+			return err
+		}
+
+		after, err := s.repo.QueryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return s.audit.Record(ctx, entity.AuditEntityUser, id, entity.AuditActionRestore, nil, after)
+	})
+}
+
+// queryDeleted gets a deleted user by given id, so it is known when he was deleted.
+func (s *UserService) queryDeleted(ctx context.Context, id string) (entity.User, error) {
+	users, _, err := s.repo.Query(ctx, query.Query{
+		Filters:        []query.Filter{{Field: "user_id", Op: query.Eq, Value: id}},
+		Limit:          1,
+		IncludeDeleted: true,
+	})
+	if err != nil {
+		return entity.User{}, errors.Wrapf(err, "getting a deleted user with id %s", id)
+	}
+	if len(users) == 0 || users[0].DeletedAt == nil {
+		return entity.User{}, errors.Wrapf(database.ErrNotFound, "deleted user %s", id)
+	}
+
+	return users[0], nil
 }
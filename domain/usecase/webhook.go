@@ -0,0 +1,241 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/event"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
+	"github.com/rtbe/clean-rest-api/repository/webhook"
+)
+
+// Webhook is an interface that represents webhook subscriptions business domain use case.
+type Webhook interface {
+	Create(ctx context.Context, newSubscription entity.NewWebhookSubscription) (entity.WebhookSubscription, error)
+	Query(ctx context.Context, q query.Query) ([]entity.WebhookSubscription, query.Page, error)
+	QueryByID(ctx context.Context, id string) (entity.WebhookSubscription, error)
+	Update(ctx context.Context, id string, updateSubscription entity.UpdateWebhookSubscription) error
+	Delete(ctx context.Context, id string) error
+	QueryDeliveries(ctx context.Context, subscriptionID string, q query.Query) ([]entity.WebhookDelivery, query.Page, error)
+	Redeliver(ctx context.Context, subscriptionID, id string) error
+}
+
+// ErrInvalidWebhookSubscription is returned when a subscription has a malformed URL or unknown event types.
+var ErrInvalidWebhookSubscription = &entity.ValidationError{Msg: "invalid webhook subscription"}
+
+// WebhookConfig is a configuration of webhook deliveries.
+type WebhookConfig struct {
+	// BatchSize is a max number of deliveries attempted at once.
+	BatchSize int
+	// RetryBase is a delay before the first retry of a delivery, it doubles with every failed attempt.
+	RetryBase time.Duration
+	// RetryMax is a max delay between attempts of a delivery.
+	RetryMax time.Duration
+	// MaxAttempts is a number of failed attempts after which a delivery is dead.
+	MaxAttempts int
+	// Timeout limits time a receiver has to respond, default is 10 seconds.
+	Timeout time.Duration
+}
+
+// WebhookService is an business domain intermidiate layer
+// between webhook subscription entity and webhook DB layer (repository).
+// It is an event publisher as well: a published event becomes a pending delivery to every subscription to it,
+// then deliveries are posted to receivers one by one and retried with exponential backoff until they die.
+type WebhookService struct {
+	repo   webhook.Repository
+	tx     transaction.Manager
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+// NewWebhookService creates a new webhook subscription entity service.
+func NewWebhookService(r webhook.Repository, tx transaction.Manager, cfg WebhookConfig) *WebhookService {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	return &WebhookService{
+		repo:   r,
+		tx:     tx,
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// Create subscribes a receiver to domain events.
+func (s *WebhookService) Create(ctx context.Context, ns entity.NewWebhookSubscription) (entity.WebhookSubscription, error) {
+	if err := entity.ValidateWebhookURL(ns.URL); err != nil {
+		return entity.WebhookSubscription{}, errors.Wrap(ErrInvalidWebhookSubscription, err.Error())
+	}
+	if err := entity.ValidateEventTypes(ns.EventTypes); err != nil {
+		return entity.WebhookSubscription{}, errors.Wrap(ErrInvalidWebhookSubscription, err.Error())
+	}
+
+	now := time.Now().UTC()
+	ws := entity.WebhookSubscription{
+		ID:          uuid.NewString(),
+		URL:         ns.URL,
+		Secret:      ns.Secret,
+		EventTypes:  ns.EventTypes,
+		DateCreated: now,
+		DateUpdated: now,
+	}
+
+	if err := s.repo.CreateSubscription(ctx, ws); err != nil {
+		return entity.WebhookSubscription{}, err
+	}
+
+	return ws, nil
+}
+
+// Query gets a paginated list of webhook subscriptions.
+func (s *WebhookService) Query(ctx context.Context, q query.Query) ([]entity.WebhookSubscription, query.Page, error) {
+	return s.repo.QuerySubscriptions(ctx, q)
+}
+
+// QueryByID queries webhook subscription by given id.
+func (s *WebhookService) QueryByID(ctx context.Context, id string) (entity.WebhookSubscription, error) {
+	return s.repo.QuerySubscriptionByID(ctx, id)
+}
+
+// Update changes particular webhook subscription, pending deliveries are posted to a new URL and signed with a new secret.
+func (s *WebhookService) Update(ctx context.Context, id string, us entity.UpdateWebhookSubscription) error {
+	if us.URL != nil {
+		if err := entity.ValidateWebhookURL(*us.URL); err != nil {
+			return errors.Wrap(ErrInvalidWebhookSubscription, err.Error())
+		}
+	}
+	if err := entity.ValidateEventTypes(us.EventTypes); err != nil {
+		return errors.Wrap(ErrInvalidWebhookSubscription, err.Error())
+	}
+
+	return s.repo.UpdateSubscription(ctx, id, us)
+}
+
+// Delete unsubscribes a receiver, it`s deliveries are deleted along with it.
+func (s *WebhookService) Delete(ctx context.Context, id string) error {
+	return s.repo.DeleteSubscription(ctx, id)
+}
+
+// QueryDeliveries gets a paginated log of deliveries of particular webhook subscription.
+func (s *WebhookService) QueryDeliveries(ctx context.Context, subscriptionID string, q query.Query) ([]entity.WebhookDelivery, query.Page, error) {
+	if _, err := s.repo.QuerySubscriptionByID(ctx, subscriptionID); err != nil {
+		return nil, query.Page{}, err
+	}
+
+	return s.repo.QueryDeliveries(ctx, subscriptionID, q)
+}
+
+// Redeliver schedules a delivery of particular webhook subscription to be posted again right away,
+// whatever it`s status is. Attempts are counted from scratch, so a dead delivery is retried as a new one.
+func (s *WebhookService) Redeliver(ctx context.Context, subscriptionID, id string) error {
+	d, err := s.repo.QueryDeliveryByID(ctx, subscriptionID, id)
+	if err != nil {
+		return err
+	}
+
+	d.Status = entity.DeliveryStatusPending
+	d.Attempts = 0
+	d.LastError = ""
+	d.NextAttemptAt = time.Now().UTC()
+
+	return s.repo.UpdateDelivery(ctx, d)
+}
+
+// Publish implements event.Publisher interface, it creates a pending delivery of an event
+// to every subscription to events of it`s type.
+// It should be called with the same context an event is taken from outbox with, so both share a transaction.
+func (s *WebhookService) Publish(ctx context.Context, e entity.Event) error {
+	subscriptions, err := s.repo.QuerySubscriptionsByEventType(ctx, e.Type)
+	if err != nil {
+		return err
+	}
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrapf(err, "encoding event %s", e.ID)
+	}
+
+	now := time.Now().UTC()
+	for _, ws := range subscriptions {
+		d := entity.WebhookDelivery{
+			ID:             uuid.NewString(),
+			SubscriptionID: ws.ID,
+			EventID:        e.ID,
+			EventType:      e.Type,
+			Payload:        payload,
+			Status:         entity.DeliveryStatusPending,
+			NextAttemptAt:  now,
+			DateCreated:    now,
+			DateUpdated:    now,
+		}
+
+		if err := s.repo.CreateDelivery(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Deliver posts a batch of due deliveries to receivers and returns how many of them succeeded and how many failed.
+// Failed deliveries are retried with exponential backoff until they fail MaxAttempts times and die.
+func (s *WebhookService) Deliver(ctx context.Context) (delivered, failed int, err error) {
+	err = s.tx.Run(ctx, func(ctx context.Context) error {
+		delivered, failed = 0, 0
+
+		deliveries, err := s.repo.QueryDueDeliveries(ctx, time.Now().UTC(), s.cfg.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		subscriptions := make(map[string]entity.WebhookSubscription)
+		for _, d := range deliveries {
+			ws, ok := subscriptions[d.SubscriptionID]
+			if !ok {
+				if ws, err = s.repo.QuerySubscriptionByID(ctx, d.SubscriptionID); err != nil {
+					return err
+				}
+				subscriptions[d.SubscriptionID] = ws
+			}
+
+			e := entity.Event{ID: d.EventID, Type: d.EventType}
+			status, err := event.Deliver(ctx, s.client, ws.URL, ws.Secret, e, d.Payload)
+
+			now := time.Now().UTC()
+			d.ResponseStatus = status
+			if err != nil {
+				d.Attempts++
+				d.LastError = err.Error()
+				if d.Attempts >= s.cfg.MaxAttempts {
+					d.Status = entity.DeliveryStatusDead
+				} else {
+					d.NextAttemptAt = now.Add(entity.EventRetryDelay(d.Attempts, s.cfg.RetryBase, s.cfg.RetryMax))
+				}
+				failed++
+			} else {
+				d.Status = entity.DeliveryStatusSucceeded
+				d.LastError = ""
+				d.DeliveredAt = &now
+				delivered++
+			}
+
+			if err := s.repo.UpdateDelivery(ctx, d); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return delivered, failed, err
+}
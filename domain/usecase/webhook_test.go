@@ -0,0 +1,262 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/event"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+// webhookRepo is an in-memory webhook repository for tests of webhook service.
+type webhookRepo struct {
+	subscriptions map[string]entity.WebhookSubscription
+	deliveries    []entity.WebhookDelivery
+	sync.Mutex
+}
+
+func (r *webhookRepo) CreateSubscription(ctx context.Context, s entity.WebhookSubscription) error {
+	r.Lock()
+	defer r.Unlock()
+	r.subscriptions[s.ID] = s
+	return nil
+}
+
+func (r *webhookRepo) QuerySubscriptions(ctx context.Context, q query.Query) ([]entity.WebhookSubscription, query.Page, error) {
+	return nil, query.Page{}, nil
+}
+
+func (r *webhookRepo) QuerySubscriptionByID(ctx context.Context, id string) (entity.WebhookSubscription, error) {
+	r.Lock()
+	defer r.Unlock()
+	s, ok := r.subscriptions[id]
+	if !ok {
+		return entity.WebhookSubscription{}, database.ErrNotFound
+	}
+	return s, nil
+}
+
+func (r *webhookRepo) QuerySubscriptionsByEventType(ctx context.Context, t entity.EventType) ([]entity.WebhookSubscription, error) {
+	r.Lock()
+	defer r.Unlock()
+	var subscriptions []entity.WebhookSubscription
+	for _, s := range r.subscriptions {
+		if s.Subscribed(t) {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+	return subscriptions, nil
+}
+
+func (r *webhookRepo) UpdateSubscription(ctx context.Context, id string, u entity.UpdateWebhookSubscription) error {
+	return nil
+}
+
+func (r *webhookRepo) DeleteSubscription(ctx context.Context, id string) error {
+	return nil
+}
+
+func (r *webhookRepo) CreateDelivery(ctx context.Context, d entity.WebhookDelivery) error {
+	r.Lock()
+	defer r.Unlock()
+	for _, existing := range r.deliveries {
+		if existing.SubscriptionID == d.SubscriptionID && existing.EventID == d.EventID {
+			return nil
+		}
+	}
+	r.deliveries = append(r.deliveries, d)
+	return nil
+}
+
+func (r *webhookRepo) QueryDeliveries(ctx context.Context, subscriptionID string, q query.Query) ([]entity.WebhookDelivery, query.Page, error) {
+	return nil, query.Page{}, nil
+}
+
+func (r *webhookRepo) QueryDeliveryByID(ctx context.Context, subscriptionID, id string) (entity.WebhookDelivery, error) {
+	r.Lock()
+	defer r.Unlock()
+	for _, d := range r.deliveries {
+		if d.ID == id && d.SubscriptionID == subscriptionID {
+			return d, nil
+		}
+	}
+	return entity.WebhookDelivery{}, database.ErrNotFound
+}
+
+func (r *webhookRepo) QueryDueDeliveries(ctx context.Context, now time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	r.Lock()
+	defer r.Unlock()
+	var deliveries []entity.WebhookDelivery
+	for _, d := range r.deliveries {
+		if d.Status == entity.DeliveryStatusPending && !d.NextAttemptAt.After(now) && len(deliveries) < limit {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+func (r *webhookRepo) UpdateDelivery(ctx context.Context, d entity.WebhookDelivery) error {
+	r.Lock()
+	defer r.Unlock()
+	for i := range r.deliveries {
+		if r.deliveries[i].ID == d.ID {
+			r.deliveries[i] = d
+			return nil
+		}
+	}
+	return database.ErrNotFound
+}
+
+// noTx runs functions without a transaction.
+type noTx struct{}
+
+func (noTx) Run(ctx context.Context, fn func(ctx context.Context) error) error { return fn(ctx) }
+
+func TestWebhookService(t *testing.T) {
+	ctx := context.Background()
+
+	// Receiver fails requests while status is not 2xx and keeps signed bodies it got.
+	var mu sync.Mutex
+	status := http.StatusServiceUnavailable
+	var received [][]byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		unix, _ := strconv.ParseInt(r.Header.Get(event.HeaderTimestamp), 10, 64)
+		if r.Header.Get(event.HeaderSignature) != event.Sign("receiver secret key", time.Unix(unix, 0), body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, body)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	repo := &webhookRepo{subscriptions: make(map[string]entity.WebhookSubscription)}
+	// Failed deliveries are retried right away.
+	service := NewWebhookService(repo, noTx{}, WebhookConfig{
+		BatchSize:   10,
+		MaxAttempts: 2,
+	})
+
+	t.Run("Given the need to subscribe to domain events", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			ns       entity.NewWebhookSubscription
+			valid    bool
+		}{
+			{
+				testName: "Valid subscription",
+				ns:       entity.NewWebhookSubscription{URL: receiver.URL, Secret: "receiver secret key", EventTypes: []string{string(entity.EventOrderCreated)}},
+				valid:    true,
+			},
+			{
+				testName: "Unknown event type",
+				ns:       entity.NewWebhookSubscription{URL: receiver.URL, Secret: "receiver secret key", EventTypes: []string{"OrderShipped"}},
+				valid:    false,
+			},
+			{
+				testName: "Not an HTTP URL",
+				ns:       entity.NewWebhookSubscription{URL: "ftp://example.com", Secret: "receiver secret key", EventTypes: []string{string(entity.EventOrderCreated)}},
+				valid:    false,
+			},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				_, err := service.Create(ctx, tc.ns)
+				if tc.valid != (err == nil) {
+					t.Fatalf("\t%s\tTest %d:\tWant valid subscription: %t, got error: %v", tests.Failed, testID, tc.valid, err)
+				}
+				t.Logf("\t%s\tTest %d:\tWant valid subscription: %t", tests.Success, testID, tc.valid)
+			})
+		}
+	})
+
+	t.Run("Given the need to deliver events to subscriptions", func(t *testing.T) {
+		orderCreated := entity.Event{ID: "1", Type: entity.EventOrderCreated, Payload: json.RawMessage(`{"order_id":"2"}`)}
+		userRegistered := entity.Event{ID: "2", Type: entity.EventUserRegistered, Payload: json.RawMessage(`{"user_id":"3"}`)}
+
+		for _, e := range []entity.Event{orderCreated, orderCreated, userRegistered} {
+			if err := service.Publish(ctx, e); err != nil {
+				t.Fatalf("\t%s\tShould be able to publish an event. Error: %s", tests.Failed, err)
+			}
+		}
+		if len(repo.deliveries) != 1 {
+			t.Fatalf("\t%s\tWant a single delivery of a subscribed event, got: %d", tests.Failed, len(repo.deliveries))
+		}
+		t.Logf("\t%s\tWant a single delivery of a subscribed event.", tests.Success)
+		d := repo.deliveries[0]
+
+		tt := []struct {
+			testName   string
+			status     int
+			action     func() error
+			wantStatus string
+			wantTries  int
+		}{
+			{
+				testName:   "Failed delivery is retried",
+				status:     http.StatusServiceUnavailable,
+				wantStatus: entity.DeliveryStatusPending,
+				wantTries:  1,
+			},
+			{
+				testName:   "Delivery dies after max attempts",
+				status:     http.StatusServiceUnavailable,
+				wantStatus: entity.DeliveryStatusDead,
+				wantTries:  2,
+			},
+			{
+				testName: "Redelivered delivery succeeds",
+				status:   http.StatusOK,
+				action: func() error {
+					return service.Redeliver(ctx, d.SubscriptionID, d.ID)
+				},
+				wantStatus: entity.DeliveryStatusSucceeded,
+				wantTries:  0,
+			},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				mu.Lock()
+				status = tc.status
+				mu.Unlock()
+
+				if tc.action != nil {
+					if err := tc.action(); err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to change a delivery. Error: %s", tests.Failed, testID, err)
+					}
+				}
+
+				if _, _, err := service.Deliver(ctx); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to deliver events. Error: %s", tests.Failed, testID, err)
+				}
+
+				got, err := repo.QueryDeliveryByID(ctx, d.SubscriptionID, d.ID)
+				if err != nil || got.Status != tc.wantStatus || got.Attempts != tc.wantTries || got.ResponseStatus != tc.status {
+					t.Fatalf("\t%s\tTest %d:\tWant %s delivery after %d failed attempts with status %d, got: %+v (%v)", tests.Failed, testID, tc.wantStatus, tc.wantTries, tc.status, got, err)
+				}
+				t.Logf("\t%s\tTest %d:\tWant %s delivery after %d failed attempts with status %d", tests.Success, testID, tc.wantStatus, tc.wantTries, tc.status)
+			})
+		}
+
+		var e entity.Event
+		if err := json.Unmarshal(received[len(received)-1], &e); err != nil || e.ID != orderCreated.ID {
+			t.Fatalf("\t%s\tWant a signed event delivered to a receiver, got: %s (%v)", tests.Failed, received[len(received)-1], err)
+		}
+		t.Logf("\t%s\tWant a signed event delivered to a receiver.", tests.Success)
+	})
+}
@@ -3,6 +3,7 @@ package config
 
 import (
 	"os"
+	"strings"
 	"sync"
 )
 
@@ -24,6 +25,44 @@ const (
 	authDbPassword = "AUTH_DB_PASSWORD"
 	authDbName     = "AUTH_DB_PASSWORD"
 	jwtSalt        = "JWT_SALT"
+	jwtKeys        = "JWT_KEYS"
+	jwtSigningKey  = "JWT_SIGNING_KEY_ID"
+	taxRate        = "TAX_RATE"
+	rolePerms      = "ROLE_PERMISSIONS"
+	requireEmail   = "REQUIRE_EMAIL_VERIFICATION"
+	resetTTL       = "PASSWORD_RESET_TTL"
+	verifyTTL      = "EMAIL_VERIFICATION_TTL"
+	smtpHost       = "SMTP_HOST"
+	smtpPort       = "SMTP_PORT"
+	smtpUser       = "SMTP_USER"
+	smtpPassword   = "SMTP_PASSWORD"
+	mailFrom       = "MAIL_FROM"
+	mailDir        = "MAIL_DIR"
+	totpIssuer     = "TOTP_ISSUER"
+	challengeTTL   = "TWO_FACTOR_CHALLENGE_TTL"
+	oidcProviders  = "OIDC_PROVIDERS"
+	oidcLoginTTL   = "OIDC_LOGIN_TTL"
+	loginFailures  = "LOGIN_MAX_FAILURES"
+	loginIPFails   = "LOGIN_IP_MAX_FAILURES"
+	loginBackoff   = "LOGIN_BACKOFF"
+	loginLockout   = "LOGIN_LOCKOUT"
+	loginWindow    = "LOGIN_FAILURE_WINDOW"
+	rateLimit      = "RATE_LIMIT"
+	routeLimits    = "RATE_LIMITS"
+	ipRateLimit    = "RATE_LIMIT_IP"
+	idempotencyTTL = "IDEMPOTENCY_TTL"
+	keyLockTimeout = "IDEMPOTENCY_LOCK_TIMEOUT"
+	retention      = "DELETED_RETENTION"
+	purgeInterval  = "PURGE_INTERVAL"
+	eventsURL      = "EVENTS_WEBHOOK_URL"
+	eventsSecret   = "EVENTS_WEBHOOK_SECRET"
+	eventsInterval = "EVENTS_POLL_INTERVAL"
+	eventsBackoff  = "EVENTS_RETRY_BACKOFF"
+	eventsMaxDelay = "EVENTS_RETRY_MAX_DELAY"
+	webhookTries   = "WEBHOOK_MAX_ATTEMPTS"
+	webhookTimeout = "WEBHOOK_TIMEOUT"
+	logFormat      = "LOG_FORMAT"
+	logLevel       = "LOG_LEVEL"
 )
 
 // Cfg is an struct that holds environment variables.
@@ -40,6 +79,97 @@ type Cfg struct {
 	AuthDbPassword string
 	AuthDBName     string
 	JWTSalt        string
+	// JWTKeys lists PEM files with RSA or Ed25519 keys JWT tokens are signed and verified with
+	// in kid=path,kid=path format. If it is empty tokens are signed with HS512 using JWTSalt.
+	JWTKeys string
+	// JWTSigningKeyID is an id of a key from JWTKeys new tokens are signed with,
+	// other keys are only used to verify tokens while keys are rotated.
+	JWTSigningKeyID string
+	// TaxRate is a tax rate applied to orders in basis points (1/100 of a percent), e.g. 2000 is 20%.
+	TaxRate string
+	// RolePermissions defines custom roles in ROLE=permission,permission;ROLE=permission format,
+	// e.g. SUPPORT=order:read,user:read.
+	RolePermissions string
+	// RequireEmailVerification forbids sign in of users that did not verify their email if it is "true".
+	RequireEmailVerification string
+	// PasswordResetTTL and EmailVerificationTTL are periods of time emailed tokens are valid for, e.g. 1h.
+	PasswordResetTTL     string
+	EmailVerificationTTL string
+	// SMTPHost is a host of SMTP server emails are sent through.
+	// If it is empty emails are written into files inside of MailDir instead.
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUser     string
+	SMTPPassword string `json:"-"`
+	MailFrom     string
+	MailDir      string
+	// TOTPIssuer is a name of an application shown by authenticator apps.
+	TOTPIssuer string
+	// TwoFactorChallengeTTL is a period of time a user has to complete sign in with a second factor, e.g. 5m.
+	TwoFactorChallengeTTL string
+	// OIDCProviders are external OpenID Connect identity providers users can sign in with.
+	// Their names are listed in OIDC_PROVIDERS as name,name and every provider is configured with
+	// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET, OIDC_<NAME>_REDIRECT_URL
+	// and optional OIDC_<NAME>_SCOPES variables.
+	OIDCProviders []OIDCProvider
+	// OIDCLoginTTL is a period of time a user has to authenticate at identity provider, e.g. 10m.
+	OIDCLoginTTL string
+	// LoginMaxFailures is a number of failed sign in attempts with a user name after which an account is locked,
+	// LoginIPMaxFailures is the same for attempts from an IP address. Zero disables throttling.
+	// Once half of them failed, next attempts are delayed by LoginBackoff that doubles with every failure.
+	LoginMaxFailures   string
+	LoginIPMaxFailures string
+	LoginBackoff       string
+	// LoginLockout is a period of time sign in is blocked for after too many failures, e.g. 15m.
+	LoginLockout string
+	// LoginFailureWindow is a period of time after which failed sign in attempts are forgotten, e.g. 1h.
+	LoginFailureWindow string
+	// RateLimit is a limit of request rate of a client in limit/period format, e.g. 300/1m. Zero limit disables it.
+	RateLimit string
+	// RouteRateLimits are limits of particular routes that replace RateLimit for them
+	// in pattern=limit/period;pattern=limit/period format, e.g. /auth/signin=10/1m.
+	RouteRateLimits string
+	// IPRateLimit is a limit of request rate of an IP address to protected routes before credentials are checked,
+	// in limit/period format, e.g. 3000/1m. It should be much higher than RateLimit, since clients may share an address.
+	IPRateLimit string
+	// IdempotencyTTL is a period of time responses to requests with Idempotency-Key header are replayed for, e.g. 24h.
+	IdempotencyTTL string
+	// IdempotencyLockTimeout is a period of time a request in progress holds it`s Idempotency-Key, e.g. 1m.
+	// A key of a request that did not complete by then, e.g. because of a crash, can be used again.
+	IdempotencyLockTimeout string
+	// DeletedRetention is a period of time deleted items are kept for before they are purged, e.g. 720h.
+	// Zero retention disables purging.
+	DeletedRetention string
+	// PurgeInterval is a period of time between purges of deleted items and expired idempotency keys, e.g. 1h.
+	PurgeInterval string
+	// EventsWebhookURL is a URL all domain events are posted to besides webhook subscriptions, it is optional.
+	// EventsWebhookSecret signs posted events with HMAC-SHA256.
+	EventsWebhookURL    string
+	EventsWebhookSecret string
+	// EventsPollInterval is a period of time between checks of outbox for new events, e.g. 1s.
+	EventsPollInterval string
+	// EventsRetryBackoff and EventsRetryMaxDelay are the first and the max delay before attempts to publish an event again.
+	EventsRetryBackoff  string
+	EventsRetryMaxDelay string
+	// WebhookMaxAttempts is a number of failed attempts after which a delivery to a webhook subscription is dead.
+	WebhookMaxAttempts string
+	// WebhookTimeout limits time a receiver of a webhook subscription has to respond, e.g. 10s.
+	WebhookTimeout string
+	// LogFormat is a format logs are written in: "json" suits log collectors, "console" is easier to read.
+	LogFormat string
+	// LogLevel is the least level of logs that are written: debug, info, warn, error or fatal.
+	LogLevel string
+}
+
+// OIDCProvider is a configuration of a client registered at external identity provider.
+type OIDCProvider struct {
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string `json:"-"`
+	RedirectURL  string
+	// Scopes are requested in addition to "openid", separated by spaces.
+	Scopes string
 }
 
 // New constructs an config from environment variables.
@@ -47,18 +177,57 @@ func New() *Cfg {
 	once.Do(
 		func() {
 			config = Cfg{
-				APIPort:        parseEnvString(apiPort, "8080"),
-				DbPort:         parseEnvString(dbPort, "5432"),
-				DbHost:         parseEnvString(dbHost, "db"),
-				DbUser:         parseEnvString(dbUser, "admin"),
-				DbPassword:     parseEnvString(dbPassword, "password"),
-				DbName:         parseEnvString(dbUser, "admin"),
-				AuthDbPort:     parseEnvString(authDbPassword, "27017"),
-				AuthDbHost:     parseEnvString(authDbHost, "authDB"),
-				AuthDbUser:     parseEnvString(authDbUser, "admin"),
-				AuthDbPassword: parseEnvString(authDbPassword, "password"),
-				AuthDBName:     parseEnvString(authDbName, "admin"),
-				JWTSalt:        parseEnvString(jwtSalt, "secret123"),
+				APIPort:         parseEnvString(apiPort, "8080"),
+				DbPort:          parseEnvString(dbPort, "5432"),
+				DbHost:          parseEnvString(dbHost, "db"),
+				DbUser:          parseEnvString(dbUser, "admin"),
+				DbPassword:      parseEnvString(dbPassword, "password"),
+				DbName:          parseEnvString(dbUser, "admin"),
+				AuthDbPort:      parseEnvString(authDbPassword, "27017"),
+				AuthDbHost:      parseEnvString(authDbHost, "authDB"),
+				AuthDbUser:      parseEnvString(authDbUser, "admin"),
+				AuthDbPassword:  parseEnvString(authDbPassword, "password"),
+				AuthDBName:      parseEnvString(authDbName, "admin"),
+				JWTSalt:         parseEnvString(jwtSalt, "secret123"),
+				JWTKeys:         parseEnvString(jwtKeys, ""),
+				JWTSigningKeyID: parseEnvString(jwtSigningKey, ""),
+				TaxRate:         parseEnvString(taxRate, "0"),
+				RolePermissions: parseEnvString(rolePerms, ""),
+
+				RequireEmailVerification: parseEnvString(requireEmail, "false"),
+				PasswordResetTTL:         parseEnvString(resetTTL, "1h"),
+				EmailVerificationTTL:     parseEnvString(verifyTTL, "24h"),
+				SMTPHost:                 parseEnvString(smtpHost, ""),
+				SMTPPort:                 parseEnvString(smtpPort, "587"),
+				SMTPUser:                 parseEnvString(smtpUser, ""),
+				SMTPPassword:             parseEnvString(smtpPassword, ""),
+				MailFrom:                 parseEnvString(mailFrom, "no-reply@example.com"),
+				MailDir:                  parseEnvString(mailDir, "./mail"),
+				TOTPIssuer:               parseEnvString(totpIssuer, "clean-rest-api"),
+				TwoFactorChallengeTTL:    parseEnvString(challengeTTL, "5m"),
+				OIDCProviders:            parseOIDCProviders(),
+				OIDCLoginTTL:             parseEnvString(oidcLoginTTL, "10m"),
+				LoginMaxFailures:         parseEnvString(loginFailures, "5"),
+				LoginIPMaxFailures:       parseEnvString(loginIPFails, "50"),
+				LoginBackoff:             parseEnvString(loginBackoff, "1s"),
+				LoginLockout:             parseEnvString(loginLockout, "15m"),
+				LoginFailureWindow:       parseEnvString(loginWindow, "1h"),
+				RateLimit:                parseEnvString(rateLimit, "300/1m"),
+				RouteRateLimits:          parseEnvString(routeLimits, "/auth/signin=10/1m;/auth/signup=10/1m;/auth/password/forgot=5/1m;/auth/email/resend=5/1m"),
+				IPRateLimit:              parseEnvString(ipRateLimit, "3000/1m"),
+				IdempotencyTTL:           parseEnvString(idempotencyTTL, "24h"),
+				IdempotencyLockTimeout:   parseEnvString(keyLockTimeout, "1m"),
+				DeletedRetention:         parseEnvString(retention, "720h"),
+				PurgeInterval:            parseEnvString(purgeInterval, "1h"),
+				EventsWebhookURL:         parseEnvString(eventsURL, ""),
+				EventsWebhookSecret:      parseEnvString(eventsSecret, ""),
+				EventsPollInterval:       parseEnvString(eventsInterval, "1s"),
+				EventsRetryBackoff:       parseEnvString(eventsBackoff, "1s"),
+				EventsRetryMaxDelay:      parseEnvString(eventsMaxDelay, "1h"),
+				WebhookMaxAttempts:       parseEnvString(webhookTries, "10"),
+				WebhookTimeout:           parseEnvString(webhookTimeout, "10s"),
+				LogFormat:                parseEnvString(logFormat, "console"),
+				LogLevel:                 parseEnvString(logLevel, "info"),
 			}
 		},
 	)
@@ -74,3 +243,27 @@ func parseEnvString(key, defaultValue string) string {
 	}
 	return value
 }
+
+// parseOIDCProviders looks for configurations of identity providers listed in OIDC_PROVIDERS.
+func parseOIDCProviders() []OIDCProvider {
+	var providers []OIDCProvider
+
+	for _, name := range strings.Split(parseEnvString(oidcProviders, ""), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, OIDCProvider{
+			Name:         name,
+			IssuerURL:    parseEnvString(prefix+"ISSUER", ""),
+			ClientID:     parseEnvString(prefix+"CLIENT_ID", ""),
+			ClientSecret: parseEnvString(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  parseEnvString(prefix+"REDIRECT_URL", ""),
+			Scopes:       parseEnvString(prefix+"SCOPES", "email profile"),
+		})
+	}
+
+	return providers
+}
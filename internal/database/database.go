@@ -2,10 +2,22 @@
 package database
 
 import (
-	"errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
 )
 
 // Set of errors for database related CRUD operations.
+// They are domain errors, so a client is told what happened without knowing which database is used.
 var (
-	ErrNotFound = errors.New("not found")
+	ErrNotFound = entity.NotFoundError("not found")
+
+	// ErrVersionConflict is returned when a row is changed or deleted with a version
+	// that is not the current one, since it was changed by someone else meanwhile.
+	ErrVersionConflict = entity.PreconditionFailedError("version conflict")
+
+	// ErrDuplicate is returned when a unique field of an entity is already taken.
+	ErrDuplicate = entity.ConflictError("duplicate key")
+
+	// ErrReference is returned when an entity refers to one that does not exist
+	// or when an entity that is referred to by others is removed.
+	ErrReference = entity.ConflictError("reference to other entity is violated")
 )
@@ -0,0 +1,304 @@
+package database
+
+import (
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/internal/query"
+)
+
+// SlicePage applies a list query to items kept in memory and puts a single page of them into a slice,
+// so in-memory repositories filter, sort and paginate exactly as QueryPage does with table rows:
+// the same whitelist of fields, the same tie breaker, the same cursors and the same handling of soft-deleted items.
+// Items should be a slice of structs which fields are mapped to columns by db tags, dest should point to a slice of the same type.
+func SlicePage(
+	items interface{},
+	fields query.Fields,
+	idField string,
+	q query.Query,
+	dest interface{},
+) (query.Page, error) {
+	src := reflect.ValueOf(items)
+	val := reflect.ValueOf(dest)
+	if src.Kind() != reflect.Slice || val.Kind() != reflect.Ptr || val.Elem().Type() != src.Type() {
+		return query.Page{}, errors.New("must provide a slice and a pointer to a slice of the same type")
+	}
+
+	b := builder{fields: fields, args: make(map[string]interface{})}
+
+	sorts, err := b.sorts(q.Sort, idField)
+	if err != nil {
+		return query.Page{}, err
+	}
+
+	// Filters and a cursor are built as SQL conditions only to validate them the same way QueryPage does.
+	for _, f := range q.Filters {
+		if _, err := b.filter(f); err != nil {
+			return query.Page{}, err
+		}
+	}
+
+	var after []*string
+	if q.Cursor != "" {
+		if _, err := b.cursor(q.Cursor, sorts); err != nil {
+			return query.Page{}, err
+		}
+		c, _ := query.DecodeCursor(q.Cursor)
+		for i := range c.Values {
+			after = append(after, &c.Values[i])
+		}
+	}
+
+	softDeleted := mapper.TypeMap(src.Type().Elem()).GetByPath("deleted_at") != nil
+
+	matched := reflect.MakeSlice(src.Type(), 0, src.Len())
+	for i := 0; i < src.Len(); i++ {
+		row := src.Index(i)
+
+		if softDeleted && !q.IncludeDeleted {
+			if _, ok := columnValue(row, "deleted_at"); ok {
+				continue
+			}
+		}
+
+		ok, err := b.matchRow(row, q.Filters)
+		if err != nil {
+			return query.Page{}, err
+		}
+		if !ok {
+			continue
+		}
+
+		if after != nil {
+			keys, err := b.sortKeys(row, sorts)
+			if err != nil {
+				return query.Page{}, err
+			}
+			if b.compareKeys(keys, after, sorts) <= 0 {
+				continue
+			}
+		}
+
+		matched = reflect.Append(matched, row)
+	}
+
+	keys := make([][]*string, matched.Len())
+	for i := range keys {
+		if keys[i], err = b.sortKeys(matched.Index(i), sorts); err != nil {
+			return query.Page{}, err
+		}
+	}
+	sort.Sort(rowSorter{
+		rows: matched,
+		keys: keys,
+		swap: reflect.Swapper(matched.Interface()),
+		less: func(x, y []*string) bool { return b.compareKeys(x, y, sorts) < 0 },
+	})
+
+	limit := q.Limit
+	if limit < 1 || limit > query.MaxLimit {
+		limit = query.DefaultLimit
+	}
+
+	if matched.Len() <= limit {
+		val.Elem().Set(matched)
+		return query.Page{}, nil
+	}
+	val.Elem().Set(matched.Slice(0, limit))
+
+	cursor, err := b.nextCursor(matched.Index(limit-1), sorts)
+	if err != nil {
+		return query.Page{}, err
+	}
+
+	return query.Page{NextCursor: cursor, HasMore: true}, nil
+}
+
+// rowSorter sorts rows of a slice by their precomputed sort keys.
+type rowSorter struct {
+	rows reflect.Value
+	keys [][]*string
+	swap func(i, j int)
+	less func(x, y []*string) bool
+}
+
+func (s rowSorter) Len() int           { return s.rows.Len() }
+func (s rowSorter) Less(i, j int) bool { return s.less(s.keys[i], s.keys[j]) }
+func (s rowSorter) Swap(i, j int) {
+	s.swap(i, j)
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// columnValue returns textual representation of a field a column is mapped to, ok is false if it is NULL (nil pointer).
+func columnValue(row reflect.Value, column string) (v string, ok bool) {
+	fv := fieldByColumn(row, column)
+	for fv.IsValid() && fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return "", false
+		}
+		fv = fv.Elem()
+	}
+	if !fv.IsValid() {
+		return "", false
+	}
+
+	s, err := cursorValue(fv.Interface())
+	if err != nil {
+		return "", false
+	}
+	return s, true
+}
+
+// fieldByColumn returns a field of a row a column is mapped to.
+// Unlike mapper.FieldByName it does not allocate nil pointers on the way, which would alter items kept in memory,
+// so a field behind a nil pointer is returned as invalid value.
+func fieldByColumn(row reflect.Value, column string) reflect.Value {
+	fi := mapper.TypeMap(row.Type()).GetByPath(column)
+	if fi == nil {
+		return reflect.Value{}
+	}
+
+	v := row
+	for _, i := range fi.Index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+// matchRow checks if a row matches all filters, filters are expected to be validated.
+// Like in SQL, NULL values match no filter.
+func (b *builder) matchRow(row reflect.Value, filters []query.Filter) (bool, error) {
+	for _, f := range filters {
+		field := b.fields[f.Field]
+
+		v, ok := columnValue(row, field.Column)
+		if !ok {
+			return false, nil
+		}
+
+		var match bool
+		switch f.Op {
+		case query.Like:
+			match = strings.Contains(strings.ToLower(v), strings.ToLower(f.Value))
+		case query.In:
+			for _, in := range strings.Split(f.Value, ",") {
+				if compareValues(field.Type, v, in) == 0 {
+					match = true
+					break
+				}
+			}
+		default:
+			c := compareValues(field.Type, v, f.Value)
+			switch f.Op {
+			case query.Eq:
+				match = c == 0
+			case query.Ne:
+				match = c != 0
+			case query.Gt:
+				match = c > 0
+			case query.Gte:
+				match = c >= 0
+			case query.Lt:
+				match = c < 0
+			case query.Lte:
+				match = c <= 0
+			default:
+				return false, errors.Wrapf(query.ErrInvalidQuery, "unknown filter operator %q", f.Op)
+			}
+		}
+
+		if !match {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// sortKeys returns values of sort fields of a row, nil stands for NULL.
+func (b *builder) sortKeys(row reflect.Value, sorts []query.Sort) ([]*string, error) {
+	keys := make([]*string, len(sorts))
+	for i, s := range sorts {
+		column := b.fields[s.Field].Column
+		if mapper.TypeMap(row.Type()).GetByPath(column) == nil {
+			return nil, errors.Errorf("there is no field for column %s", column)
+		}
+		if v, ok := columnValue(row, column); ok {
+			keys[i] = &v
+		}
+	}
+	return keys, nil
+}
+
+// compareKeys compares values of sort fields of two rows in a sort order.
+// As in PostgreSQL, NULL values are greater than any other ones.
+func (b *builder) compareKeys(x, y []*string, sorts []query.Sort) int {
+	for i, s := range sorts {
+		var c int
+		switch {
+		case x[i] == nil && y[i] == nil:
+		case x[i] == nil:
+			c = 1
+		case y[i] == nil:
+			c = -1
+		default:
+			c = compareValues(b.fields[s.Field].Type, *x[i], *y[i])
+		}
+
+		if s.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareValues compares textual representations of two values of a field type, they are expected to be valid.
+func compareValues(t query.FieldType, x, y string) int {
+	switch t {
+	case query.Int:
+		a, _ := strconv.ParseInt(x, 10, 64)
+		b, _ := strconv.ParseInt(y, 10, 64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case query.Decimal:
+		a, okA := new(big.Rat).SetString(x)
+		b, okB := new(big.Rat).SetString(y)
+		if !okA || !okB {
+			return strings.Compare(x, y)
+		}
+		return a.Cmp(b)
+	case query.Time:
+		a, _ := time.Parse(time.RFC3339Nano, x)
+		b, _ := time.Parse(time.RFC3339Nano, y)
+		switch {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+		return 0
+	case query.UUID:
+		return strings.Compare(strings.ToLower(x), strings.ToLower(y))
+	default:
+		return strings.Compare(x, y)
+	}
+}
@@ -0,0 +1,6 @@
+-- Users registered before email verification was introduced are considered verified,
+-- so enabling it does not lock them out.
+ALTER TABLE users
+    ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE users SET email_verified = true;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS external_identities;
\ No newline at end of file
@@ -0,0 +1,13 @@
+-- Accounts of users at external OpenID Connect providers.
+CREATE TABLE external_identities (
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id UUID NOT NULL,
+    email TEXT,
+    date_created TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (provider, subject),
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_external_identities_user ON external_identities (user_id);
\ No newline at end of file
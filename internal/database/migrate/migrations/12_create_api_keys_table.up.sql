@@ -0,0 +1,17 @@
+-- API keys machine clients authenticate with on behalf of users, only hashes of keys are stored.
+CREATE TABLE api_keys (
+    api_key_id UUID DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT UNIQUE NOT NULL,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    last_used TIMESTAMP,
+    date_created TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (api_key_id),
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_api_keys_user ON api_keys (user_id);
\ No newline at end of file
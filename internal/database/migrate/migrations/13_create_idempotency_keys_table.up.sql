@@ -0,0 +1,16 @@
+-- Responses to requests made with Idempotency-Key header, so retries of a request get the same response.
+-- Requests in progress have zero status code.
+CREATE TABLE idempotency_keys (
+    principal TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    status_code INT NOT NULL DEFAULT 0,
+    header JSONB NOT NULL DEFAULT '{}',
+    body BYTEA,
+    expires_at TIMESTAMP NOT NULL,
+    date_created TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (principal, idempotency_key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
\ No newline at end of file
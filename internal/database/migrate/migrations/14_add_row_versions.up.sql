@@ -0,0 +1,6 @@
+-- Version of a row is increased by every update of it,
+-- so concurrent updates based on the same version can be told apart and rejected.
+ALTER TABLE users ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE products ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE orders ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE order_items ADD COLUMN version INT NOT NULL DEFAULT 1;
\ No newline at end of file
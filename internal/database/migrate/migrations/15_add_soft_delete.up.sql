@@ -0,0 +1,11 @@
+-- Deleted rows are kept with deletion date until their retention period is over,
+-- so deletions can be undone and history of orders is not lost.
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE products ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE orders ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE order_items ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_products_deleted_at ON products (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_orders_deleted_at ON orders (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_order_items_deleted_at ON order_items (deleted_at) WHERE deleted_at IS NOT NULL;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS audit_records;
+DROP FUNCTION IF EXISTS reject_audit_record_change;
\ No newline at end of file
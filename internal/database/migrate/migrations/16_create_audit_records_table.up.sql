@@ -0,0 +1,32 @@
+-- Records of changes made to users, products, orders and order items.
+-- Records are append-only, they can not be changed or removed once saved.
+CREATE TABLE audit_records (
+    audit_id UUID DEFAULT gen_random_uuid(),
+    actor_id TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    entity_type TEXT NOT NULL,
+    entity_id UUID NOT NULL,
+    action TEXT NOT NULL,
+    changes JSONB NOT NULL DEFAULT '{}',
+    date_created TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (audit_id)
+);
+
+CREATE INDEX idx_audit_records_entity ON audit_records (entity_type, entity_id);
+CREATE INDEX idx_audit_records_actor ON audit_records (actor_id);
+CREATE INDEX idx_audit_records_date_created ON audit_records (date_created);
+
+CREATE FUNCTION reject_audit_record_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit records are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_records_append_only
+    BEFORE UPDATE OR DELETE ON audit_records
+    FOR EACH ROW EXECUTE FUNCTION reject_audit_record_change();
+
+CREATE TRIGGER audit_records_no_truncate
+    BEFORE TRUNCATE ON audit_records
+    FOR EACH STATEMENT EXECUTE FUNCTION reject_audit_record_change();
\ No newline at end of file
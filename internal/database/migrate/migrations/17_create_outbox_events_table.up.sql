@@ -0,0 +1,19 @@
+-- Domain events written in the same transaction as changes they describe,
+-- a relay publishes them to other systems afterwards. Events of an aggregate are published in order of their sequence.
+CREATE TABLE outbox_events (
+    event_id UUID DEFAULT gen_random_uuid(),
+    sequence BIGSERIAL NOT NULL,
+    aggregate_type TEXT NOT NULL,
+    aggregate_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT now(),
+    published_at TIMESTAMP,
+    date_created TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (event_id)
+);
+
+CREATE INDEX idx_outbox_events_pending ON outbox_events (aggregate_type, aggregate_id, sequence) WHERE published_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,34 @@
+-- Subscriptions of receivers to domain events and deliveries of events to them.
+-- Pending deliveries are retried with exponential backoff until they succeed or go dead.
+CREATE TABLE webhook_subscriptions (
+    subscription_id UUID DEFAULT gen_random_uuid(),
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    event_types TEXT[] NOT NULL,
+    date_created TIMESTAMP DEFAULT now(),
+    date_updated TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (subscription_id)
+);
+
+CREATE TABLE webhook_deliveries (
+    delivery_id UUID DEFAULT gen_random_uuid(),
+    subscription_id UUID NOT NULL,
+    event_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    response_status INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT now(),
+    delivered_at TIMESTAMP,
+    date_created TIMESTAMP DEFAULT now(),
+    date_updated TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (delivery_id),
+    UNIQUE (subscription_id, event_id),
+    FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions (subscription_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_webhook_deliveries_pending ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
\ No newline at end of file
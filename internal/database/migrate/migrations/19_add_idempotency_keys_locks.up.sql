@@ -0,0 +1,3 @@
+-- Requests in progress hold their keys until locked_until, so keys of requests that never completed,
+-- e.g. because of a crash, can be used again before they expire.
+ALTER TABLE idempotency_keys ADD COLUMN locked_until TIMESTAMP NOT NULL DEFAULT now();
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Legacy statuses stay mapped, they can be found in status history.
+ALTER TABLE orders
+    DROP CONSTRAINT IF EXISTS orders_status_check,
+    ALTER COLUMN status DROP NOT NULL,
+    ALTER COLUMN status DROP DEFAULT;
\ No newline at end of file
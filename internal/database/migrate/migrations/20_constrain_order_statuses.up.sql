@@ -0,0 +1,43 @@
+-- Orders created before the lifecycle was introduced have free-form statuses.
+-- They are mapped to the closest status of the lifecycle, unknown ones to pending, so they can be reviewed,
+-- and every mapping is recorded into status history, so legacy statuses are not lost.
+WITH mapped AS (
+    SELECT
+        order_id,
+        status AS legacy,
+        CASE lower(trim(COALESCE(status, '')))
+            WHEN 'paid' THEN 'paid'
+            WHEN 'payed' THEN 'paid'
+            WHEN 'shipped' THEN 'shipped'
+            WHEN 'sent' THEN 'shipped'
+            WHEN 'dispatched' THEN 'shipped'
+            WHEN 'in_transit' THEN 'shipped'
+            WHEN 'delivered' THEN 'delivered'
+            WHEN 'completed' THEN 'delivered'
+            WHEN 'complete' THEN 'delivered'
+            WHEN 'fulfilled' THEN 'delivered'
+            WHEN 'cancelled' THEN 'cancelled'
+            WHEN 'canceled' THEN 'cancelled'
+            WHEN 'rejected' THEN 'cancelled'
+            WHEN 'refunded' THEN 'refunded'
+            WHEN 'returned' THEN 'refunded'
+            ELSE 'pending'
+        END AS status
+    FROM orders
+), changed AS (
+    UPDATE orders o
+    SET 
+        status = m.status,
+        version = o.version + 1
+    FROM mapped m
+    WHERE m.order_id = o.order_id AND o.status IS DISTINCT FROM m.status
+    RETURNING o.order_id, m.legacy, o.status
+)
+INSERT INTO order_status_history (order_id, from_status, to_status, actor, reason)
+SELECT order_id, COALESCE(legacy, ''), status, 'migration', 'legacy status mapped to order lifecycle'
+FROM changed;
+
+ALTER TABLE orders
+    ALTER COLUMN status SET DEFAULT 'pending',
+    ALTER COLUMN status SET NOT NULL,
+    ADD CONSTRAINT orders_status_check CHECK (status IN ('pending', 'paid', 'shipped', 'delivered', 'cancelled', 'refunded'));
\ No newline at end of file
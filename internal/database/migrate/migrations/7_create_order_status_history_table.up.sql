@@ -0,0 +1,15 @@
+-- Append only log of order status transitions.
+CREATE TABLE order_status_history (
+    order_status_change_id UUID DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL,
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    actor TEXT,
+    reason TEXT,
+    date_created TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (order_status_change_id),
+    FOREIGN KEY (order_id) REFERENCES orders (order_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_order_status_history_order ON order_status_history (order_id, date_created);
\ No newline at end of file
@@ -0,0 +1,8 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS subtotal,
+    DROP COLUMN IF EXISTS tax,
+    DROP COLUMN IF EXISTS total;
+
+ALTER TABLE order_items
+    DROP COLUMN IF EXISTS unit_price,
+    DROP COLUMN IF EXISTS product_title;
\ No newline at end of file
@@ -0,0 +1,28 @@
+-- Order items keep price and title of a product at the moment they were created,
+-- so later changes of a product do not change value of existing orders.
+ALTER TABLE order_items
+    ADD COLUMN unit_price DECIMAL(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN product_title TEXT NOT NULL DEFAULT '';
+
+UPDATE order_items oi
+SET 
+    unit_price = COALESCE(p.price, 0),
+    product_title = p.title
+FROM products p
+WHERE p.product_id = oi.product_id;
+
+ALTER TABLE orders
+    ADD COLUMN subtotal DECIMAL(12,2) NOT NULL DEFAULT 0,
+    ADD COLUMN tax DECIMAL(12,2) NOT NULL DEFAULT 0,
+    ADD COLUMN total DECIMAL(12,2) NOT NULL DEFAULT 0;
+
+UPDATE orders o
+SET 
+    subtotal = t.subtotal,
+    total = t.subtotal
+FROM (
+    SELECT order_id, SUM(unit_price * quantity) AS subtotal 
+    FROM order_items 
+    GROUP BY order_id
+) t
+WHERE t.order_id = o.order_id;
\ No newline at end of file
@@ -0,0 +1,9 @@
+-- Search vector of a product is generated from it`s title and description,
+-- title matches are weighted higher than description ones.
+ALTER TABLE products
+    ADD COLUMN search tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'B')
+    ) STORED;
+
+CREATE INDEX idx_products_search ON products USING GIN (search);
\ No newline at end of file
@@ -2,15 +2,23 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"net/url"
 	"reflect"
 	"sync"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
+// PostgreSQL error codes that are translated into domain errors,
+// see https://www.postgresql.org/docs/current/errcodes-appendix.html.
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+)
+
 var (
 	postgreConn *sqlx.DB
 	postgreOnce sync.Once
@@ -56,13 +64,90 @@ func NewPostgreSQL(cfg PostgreConfig) (*sqlx.DB, error) {
 	return postgreConn, connErr
 }
 
+// txKey is the context.Context key to store PostgreSQL transaction.
+var txKey = &struct{ name string }{"postgreTx"}
+
+// WithTx returns a copy of a given context that carries PostgreSQL transaction,
+// so every query made with that context will be executed inside of it.
+func WithTx(ctx context.Context, tx *sqlx.Tx) context.Context {
+	return context.WithValue(ctx, txKey, tx)
+}
+
+// TxFromContext returns PostgreSQL transaction from the given context if there is one.
+func TxFromContext(ctx context.Context) (*sqlx.Tx, bool) {
+	tx, ok := ctx.Value(txKey).(*sqlx.Tx)
+	return tx, ok
+}
+
+// conn returns transaction from the given context
+// and falls back to plain database connection if there is no transaction.
+func conn(ctx context.Context, db *sqlx.DB) sqlx.ExtContext {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
+
+// translate turns violations of PostgreSQL constraints into domain errors,
+// details of a violation such as a name of a constraint are kept in an error message.
+// Other errors are returned as is.
+func translate(err error) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return err
+	}
+
+	switch pqErr.Code {
+	case pqUniqueViolation:
+		return errors.Wrap(ErrDuplicate, pqErr.Detail)
+	case pqForeignKeyViolation:
+		return errors.Wrap(ErrReference, pqErr.Detail)
+	default:
+		return err
+	}
+}
+
+// NamedExec executes a named query that does not return any records.
+func NamedExec(ctx context.Context, db *sqlx.DB, query string, data interface{}) (sql.Result, error) {
+	res, err := sqlx.NamedExecContext(ctx, conn(ctx, db), query, data)
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	return res, nil
+}
+
+// NamedExecVersion executes a named query that changes a row only if it still has a version it was read with.
+// If no rows were affected, the row was changed by someone else meanwhile and ErrVersionConflict is returned.
+func NamedExecVersion(ctx context.Context, db *sqlx.DB, query string, data interface{}) error {
+	res, err := NamedExec(ctx, db, query, data)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
 // QueryStruct queries a single record and puts it into a struct.
 func QueryStruct(ctx context.Context, db *sqlx.DB, query string, data interface{}, dest interface{}) error {
-	row, err := db.NamedQueryContext(ctx, query, data)
+	row, err := sqlx.NamedQueryContext(ctx, conn(ctx, db), query, data)
 	if err != nil {
-		return err
+		return translate(err)
 	}
+	defer row.Close()
+
 	if !row.Next() {
+		if err := row.Err(); err != nil {
+			return translate(err)
+		}
 		return ErrNotFound
 	}
 
@@ -80,10 +165,11 @@ func QuerySlice(ctx context.Context, db *sqlx.DB, query string, data interface{}
 		return errors.New("must provide a pointer to a slice")
 	}
 
-	rows, err := db.NamedQueryContext(ctx, query, data)
+	rows, err := sqlx.NamedQueryContext(ctx, conn(ctx, db), query, data)
 	if err != nil {
-		return err
+		return translate(err)
 	}
+	defer rows.Close()
 
 	slice := val.Elem()
 	for rows.Next() {
@@ -94,5 +180,5 @@ func QuerySlice(ctx context.Context, db *sqlx.DB, query string, data interface{}
 		slice.Set(reflect.Append(slice, v.Elem()))
 	}
 
-	return nil
+	return translate(rows.Err())
 }
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestTranslate(t *testing.T) {
+	t.Run("Given the need to translate PostgreSQL errors into errors of their kind", func(t *testing.T) {
+		other := &pq.Error{Code: "42P01", Message: "relation does not exist"}
+		plain := errors.New("connection refused")
+
+		tt := []struct {
+			testName string
+			err      error
+			want     error
+		}{
+			{testName: "Unique violation", err: &pq.Error{Code: pqUniqueViolation, Detail: "Key (email) already exists."}, want: ErrDuplicate},
+			{testName: "Foreign key violation", err: &pq.Error{Code: pqForeignKeyViolation, Detail: "Key (user_id) is not present."}, want: ErrReference},
+			{testName: "Other PostgreSQL error", err: other, want: other},
+			{testName: "Not a PostgreSQL error", err: plain, want: plain},
+		}
+
+		for testID, tc := range tt {
+			if got := errors.Cause(translate(tc.err)); got != tc.want {
+				t.Fatalf("\t%s\tTest %d:\tWant error: %v, got: %v", tests.Failed, testID, tc.want, got)
+			}
+			t.Logf("\t%s\tTest %d:\t%s: should be translated into %v.", tests.Success, testID, tc.testName, tc.want)
+		}
+	})
+}
@@ -0,0 +1,311 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/internal/query"
+)
+
+// defaultSort is a sort order of list queries that do not define it.
+var defaultSort = []query.Sort{{Field: "date_created", Desc: true}}
+
+// mapper finds struct fields by their db tags.
+var mapper = reflectx.NewMapperFunc("db", strings.ToLower)
+
+// comparisons maps filter operators to SQL comparison operators.
+var comparisons = map[query.Operator]string{
+	query.Eq:  "=",
+	query.Ne:  "<>",
+	query.Gt:  ">",
+	query.Gte: ">=",
+	query.Lt:  "<",
+	query.Lte: "<=",
+}
+
+// QueryPage queries a single page of table rows defined by list query and puts them into a slice.
+// Only columns mapped to fields of slice element are selected.
+// Only fields from given whitelist can be used for filtering and sorting,
+// their values are always passed as query parameters, so list query can not inject SQL.
+// Field with idField name is used as a tie breaker, so sort order is always deterministic.
+// Pagination is based on a keyset (values of sort fields of the last seen row), not on offset.
+// Soft-deleted rows of tables with deleted_at column are skipped unless list query includes them.
+func QueryPage(
+	ctx context.Context,
+	db *sqlx.DB,
+	table string,
+	fields query.Fields,
+	idField string,
+	q query.Query,
+	dest interface{},
+) (query.Page, error) {
+	val := reflect.ValueOf(dest)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Slice {
+		return query.Page{}, errors.New("must provide a pointer to a slice")
+	}
+
+	b := builder{fields: fields, args: make(map[string]interface{})}
+
+	sorts, err := b.sorts(q.Sort, idField)
+	if err != nil {
+		return query.Page{}, err
+	}
+
+	var where []string
+	for _, f := range q.Filters {
+		cond, err := b.filter(f)
+		if err != nil {
+			return query.Page{}, err
+		}
+		where = append(where, cond)
+	}
+
+	if !q.IncludeDeleted && mapper.TypeMap(val.Type().Elem().Elem()).GetByPath("deleted_at") != nil {
+		where = append(where, "deleted_at IS NULL")
+	}
+
+	if q.Cursor != "" {
+		cond, err := b.cursor(q.Cursor, sorts)
+		if err != nil {
+			return query.Page{}, err
+		}
+		where = append(where, cond)
+	}
+
+	limit := q.Limit
+	if limit < 1 || limit > query.MaxLimit {
+		limit = query.DefaultLimit
+	}
+	// Fetch one more row than needed to find out if there is a next page.
+	b.args["limit"] = limit + 1
+
+	columns, err := structColumns(val.Type().Elem().Elem())
+	if err != nil {
+		return query.Page{}, err
+	}
+
+	stmt := fmt.Sprintf("SELECT %s FROM %s", columns, table)
+	if len(where) > 0 {
+		stmt += " WHERE " + strings.Join(where, " AND ")
+	}
+	stmt += " ORDER BY " + b.orderBy(sorts) + " LIMIT :limit"
+
+	if err := QuerySlice(ctx, db, stmt, b.args, dest); err != nil {
+		return query.Page{}, err
+	}
+
+	slice := val.Elem()
+	if slice.Len() <= limit {
+		return query.Page{}, nil
+	}
+	slice.Set(slice.Slice(0, limit))
+
+	cursor, err := b.nextCursor(slice.Index(limit-1), sorts)
+	if err != nil {
+		return query.Page{}, err
+	}
+
+	return query.Page{NextCursor: cursor, HasMore: true}, nil
+}
+
+// structColumns returns comma-separated columns that are mapped to fields of a struct type,
+// so tables can have columns that entities do not know about (e.g. search vectors).
+func structColumns(t reflect.Type) (string, error) {
+	if t.Kind() != reflect.Struct {
+		return "", errors.Errorf("can not get columns of %s", t)
+	}
+
+	var columns []string
+	for _, fi := range mapper.TypeMap(t).Index {
+		if fi.Embedded || strings.Contains(fi.Path, ".") {
+			continue
+		}
+		columns = append(columns, fi.Name)
+	}
+
+	return strings.Join(columns, ", "), nil
+}
+
+// builder accumulates parts of a list query and it`s parameters.
+type builder struct {
+	fields query.Fields
+	args   map[string]interface{}
+}
+
+// field looks up a field in the whitelist.
+func (b *builder) field(name string) (query.Field, error) {
+	f, ok := b.fields[name]
+	if !ok {
+		return query.Field{}, errors.Wrapf(query.ErrInvalidQuery, "unknown field %q", name)
+	}
+	return f, nil
+}
+
+// arg registers a query parameter and returns it`s placeholder.
+func (b *builder) arg(v interface{}) string {
+	name := fmt.Sprintf("p%d", len(b.args))
+	b.args[name] = v
+	return ":" + name
+}
+
+// sorts validates sort order and appends a tie breaker to it.
+func (b *builder) sorts(sorts []query.Sort, idField string) ([]query.Sort, error) {
+	if len(sorts) == 0 {
+		sorts = defaultSort
+	}
+
+	result := make([]query.Sort, 0, len(sorts)+1)
+	var hasID bool
+	for _, s := range sorts {
+		if _, err := b.field(s.Field); err != nil {
+			return nil, err
+		}
+		if s.Field == idField {
+			hasID = true
+		}
+		result = append(result, s)
+	}
+
+	if !hasID {
+		result = append(result, query.Sort{Field: idField})
+	}
+
+	return result, nil
+}
+
+// orderBy builds ORDER BY clause.
+func (b *builder) orderBy(sorts []query.Sort) string {
+	parts := make([]string, 0, len(sorts))
+	for _, s := range sorts {
+		dir := "ASC"
+		if s.Desc {
+			dir = "DESC"
+		}
+		parts = append(parts, fmt.Sprintf("%s %s", b.fields[s.Field].Column, dir))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// filter builds a condition for a single filter.
+func (b *builder) filter(f query.Filter) (string, error) {
+	field, err := b.field(f.Field)
+	if err != nil {
+		return "", err
+	}
+
+	switch f.Op {
+	case query.Like:
+		if field.Type != query.String {
+			return "", errors.Wrapf(query.ErrInvalidQuery, "field %q does not support %q", f.Field, f.Op)
+		}
+		return fmt.Sprintf("%s ILIKE %s", field.Column, b.arg("%"+escapeLike(f.Value)+"%")), nil
+
+	case query.In:
+		values := strings.Split(f.Value, ",")
+		placeholders := make([]string, 0, len(values))
+		for _, v := range values {
+			if err := field.Type.Validate(v); err != nil {
+				return "", err
+			}
+			placeholders = append(placeholders, b.arg(v))
+		}
+		return fmt.Sprintf("%s IN (%s)", field.Column, strings.Join(placeholders, ", ")), nil
+
+	default:
+		op, ok := comparisons[f.Op]
+		if !ok {
+			return "", errors.Wrapf(query.ErrInvalidQuery, "unknown filter operator %q", f.Op)
+		}
+		if err := field.Type.Validate(f.Value); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s %s", field.Column, op, b.arg(f.Value)), nil
+	}
+}
+
+// cursor builds a condition that selects rows after the one cursor points to:
+// (a > :a) OR (a = :a AND b < :b) OR ... with comparison direction defined by each sort field.
+func (b *builder) cursor(s string, sorts []query.Sort) (string, error) {
+	c, err := query.DecodeCursor(s)
+	if err != nil {
+		return "", err
+	}
+	if c.Sort != query.SortKey(sorts) || len(c.Values) != len(sorts) {
+		return "", errors.Wrap(query.ErrInvalidQuery, "cursor does not match sort order")
+	}
+
+	placeholders := make([]string, len(sorts))
+	for i, s := range sorts {
+		if err := b.fields[s.Field].Type.Validate(c.Values[i]); err != nil {
+			return "", err
+		}
+		placeholders[i] = b.arg(c.Values[i])
+	}
+
+	var or []string
+	for i, s := range sorts {
+		var and []string
+		for j := 0; j < i; j++ {
+			and = append(and, fmt.Sprintf("%s = %s", b.fields[sorts[j].Field].Column, placeholders[j]))
+		}
+
+		op := ">"
+		if s.Desc {
+			op = "<"
+		}
+		and = append(and, fmt.Sprintf("%s %s %s", b.fields[s.Field].Column, op, placeholders[i]))
+
+		or = append(or, "("+strings.Join(and, " AND ")+")")
+	}
+
+	return "(" + strings.Join(or, " OR ") + ")", nil
+}
+
+// nextCursor builds a cursor that points to a given row.
+func (b *builder) nextCursor(row reflect.Value, sorts []query.Sort) (string, error) {
+	c := query.Cursor{Sort: query.SortKey(sorts)}
+
+	for _, s := range sorts {
+		column := b.fields[s.Field].Column
+		v := mapper.FieldByName(row, column)
+		if !v.IsValid() {
+			return "", errors.Errorf("there is no field for column %s", column)
+		}
+
+		str, err := cursorValue(v.Interface())
+		if err != nil {
+			return "", err
+		}
+		c.Values = append(c.Values, str)
+	}
+
+	return query.EncodeCursor(c)
+}
+
+// cursorValue converts a field value into it`s textual representation.
+func cursorValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), nil
+	case driver.Valuer:
+		dv, err := v.Value()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprint(dv), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// escapeLike escapes wildcard characters of LIKE patterns.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
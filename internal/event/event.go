@@ -0,0 +1,54 @@
+// Package event provides wrapper interface for publishing domain events to other systems
+// to make it implementation-independent.
+// As well as implementations of it that post events to a webhook or keep them in memory.
+package event
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+)
+
+// Headers of requests that deliver events to webhooks.
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderType      = "Webhook-Event"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+)
+
+// Publisher is an interface for event publishers.
+// An error means an event may not be delivered, so it will be published again.
+type Publisher interface {
+	Publish(ctx context.Context, e entity.Event) error
+}
+
+// Publishers publishes an event with each of publishers in turn.
+// It stops at the first error, so publishers that already succeeded get an event again on retry.
+type Publishers []Publisher
+
+// Publish implements Publisher interface.
+func (ps Publishers) Publish(ctx context.Context, e entity.Event) error {
+	for _, p := range ps {
+		if err := p.Publish(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sign returns HMAC-SHA256 signature of a body sent at given time, so a receiver can check
+// that a body came from a holder of a secret and reject replayed ones by their timestamp.
+// Signature covers a timestamp in Unix seconds and a body joined with a dot: sha256=hex(HMAC(secret, "timestamp.body")).
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
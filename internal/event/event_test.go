@@ -0,0 +1,94 @@
+package event
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestPublisher(t *testing.T) {
+	e := entity.Event{
+		ID:            "1",
+		AggregateType: entity.AggregateOrder,
+		AggregateID:   "2",
+		Type:          entity.EventOrderCreated,
+		Payload:       []byte(`{"order_id":"2"}`),
+	}
+
+	t.Run("Given the need to keep published events in memory", func(t *testing.T) {
+		publisher := NewInMemPublisher()
+
+		if err := publisher.Publish(context.Background(), e); err != nil {
+			t.Fatalf("\t%s\tShould be able to publish an event. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to publish an event.", tests.Success)
+
+		events := publisher.Events()
+		if len(events) != 1 || events[0].ID != e.ID {
+			t.Fatalf("\t%s\tShould keep a published event, got: %+v", tests.Failed, events)
+		}
+		t.Logf("\t%s\tShould keep a published event.", tests.Success)
+	})
+
+	t.Run("Given the need to post events to a webhook", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			secret   string
+			status   int
+			valid    bool
+		}{
+			{testName: "Signed delivery", secret: "secret", status: http.StatusNoContent, valid: true},
+			{testName: "Unsigned delivery", status: http.StatusOK, valid: true},
+			{testName: "Failed delivery", secret: "secret", status: http.StatusServiceUnavailable, valid: false},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				var received *http.Request
+				var body []byte
+				receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					received = r
+					body, _ = ioutil.ReadAll(r.Body)
+					w.WriteHeader(tc.status)
+				}))
+				defer receiver.Close()
+
+				publisher := NewWebhookPublisher(WebhookConfig{URL: receiver.URL, Secret: tc.secret})
+				err := publisher.Publish(context.Background(), e)
+				if tc.valid != (err == nil) {
+					t.Fatalf("\t%s\tTest %d:\tWant successful delivery: %t, got error: %v", tests.Failed, testID, tc.valid, err)
+				}
+				t.Logf("\t%s\tTest %d:\tWant successful delivery: %t", tests.Success, testID, tc.valid)
+
+				if received.Header.Get(HeaderID) != e.ID || received.Header.Get(HeaderType) != string(e.Type) {
+					t.Fatalf("\t%s\tTest %d:\tWant event id and type in headers, got: %v", tests.Failed, testID, received.Header)
+				}
+				t.Logf("\t%s\tTest %d:\tWant event id and type in headers.", tests.Success, testID)
+
+				signature := received.Header.Get(HeaderSignature)
+				if tc.secret == "" {
+					if signature != "" {
+						t.Fatalf("\t%s\tTest %d:\tWant unsigned delivery, got signature: %s", tests.Failed, testID, signature)
+					}
+					t.Logf("\t%s\tTest %d:\tWant unsigned delivery.", tests.Success, testID)
+					return
+				}
+
+				unix, err := strconv.ParseInt(received.Header.Get(HeaderTimestamp), 10, 64)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to parse a timestamp. Error: %s", tests.Failed, testID, err)
+				}
+				if want := Sign(tc.secret, time.Unix(unix, 0), body); signature != want {
+					t.Fatalf("\t%s\tTest %d:\tWant signature: %s, got: %s", tests.Failed, testID, want, signature)
+				}
+				t.Logf("\t%s\tTest %d:\tWant valid signature.", tests.Success, testID)
+			})
+		}
+	})
+}
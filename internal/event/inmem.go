@@ -0,0 +1,42 @@
+package event
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+)
+
+// InMemPublisher keeps published events in memory, it is meant for tests and local development.
+type InMemPublisher struct {
+	events []entity.Event
+	sync.Mutex
+}
+
+// NewInMemPublisher returns a new in-memory publisher.
+func NewInMemPublisher() *InMemPublisher {
+	return &InMemPublisher{}
+}
+
+// Publish saves an event in memory.
+func (i *InMemPublisher) Publish(ctx context.Context, e entity.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	i.Lock()
+	defer i.Unlock()
+
+	i.events = append(i.events, e)
+	return nil
+}
+
+// Events returns all published events, oldest first.
+func (i *InMemPublisher) Events() []entity.Event {
+	i.Lock()
+	defer i.Unlock()
+
+	events := make([]entity.Event, len(i.events))
+	copy(events, i.events)
+	return events
+}
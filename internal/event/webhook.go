@@ -0,0 +1,87 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+)
+
+// WebhookConfig is a configuration of a webhook events are posted to.
+type WebhookConfig struct {
+	URL string
+	// Secret signs deliveries, they are not signed if it is empty.
+	Secret string
+	// Timeout limits time a webhook has to respond, default is 10 seconds.
+	Timeout time.Duration
+}
+
+// WebhookPublisher posts events as JSON to a webhook.
+// Any response except 2xx is treated as a failure, so an event is published again later.
+type WebhookPublisher struct {
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+// NewWebhookPublisher returns a new webhook publisher.
+func NewWebhookPublisher(cfg WebhookConfig) *WebhookPublisher {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	return &WebhookPublisher{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// Publish posts an event to a webhook.
+func (p *WebhookPublisher) Publish(ctx context.Context, e entity.Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrapf(err, "encoding event %s", e.ID)
+	}
+
+	_, err = Deliver(ctx, p.client, p.cfg.URL, p.cfg.Secret, e, body)
+	return err
+}
+
+// Deliver posts an encoded event to a URL with a client and checks a response.
+// A request carries an id and a type of an event, and if a secret is given, a timestamp and a signature, see Sign.
+// It returns a status a webhook responded with, or zero if it did not respond.
+func Deliver(ctx context.Context, client *http.Client, url, secret string, e entity.Event, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.Wrapf(err, "creating request to %s", url)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, e.ID)
+	req.Header.Set(HeaderType, string(e.Type))
+
+	if secret != "" {
+		now := time.Now()
+		req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+		req.Header.Set(HeaderSignature, Sign(secret, now, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, errors.Wrapf(err, "posting event %s to %s", e.ID, url)
+	}
+	defer resp.Body.Close()
+	// Drain a body so a connection can be reused.
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.Errorf("posting event %s to %s: unexpected status %s", e.ID, url, resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
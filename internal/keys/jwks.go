@@ -0,0 +1,130 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+
+	// RSA public key parameters.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Ed25519 public key parameters (RFC 8037).
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns public keys of a set, ordered by their ids.
+// Shared secrets are never published.
+func (s *Set) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	for _, k := range s.keys {
+		jwk := JWK{
+			KeyID:     k.ID,
+			Use:       "sig",
+			Algorithm: k.Method.Alg(),
+		}
+
+		switch public := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = encode(public.N.Bytes())
+			jwk.E = encode(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = encode(public)
+		default:
+			continue
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID
+	})
+
+	return jwks
+}
+
+// Key converts a public key in JWK format into a key tokens can be verified with.
+// Only RSA and Ed25519 keys are supported.
+func (j JWK) Key() (Key, error) {
+	switch {
+	case j.KeyType == "RSA":
+		n, err := decode(j.N)
+		if err != nil {
+			return Key{}, errors.Wrapf(err, "decoding modulus of key %s", j.KeyID)
+		}
+		e, err := decode(j.E)
+		if err != nil {
+			return Key{}, errors.Wrapf(err, "decoding exponent of key %s", j.KeyID)
+		}
+
+		return newKey(j.KeyID, &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		})
+	case j.KeyType == "OKP" && j.Curve == "Ed25519":
+		x, err := decode(j.X)
+		if err != nil {
+			return Key{}, errors.Wrapf(err, "decoding key %s", j.KeyID)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return Key{}, errors.Errorf("key %s has invalid size", j.KeyID)
+		}
+
+		return newKey(j.KeyID, ed25519.PublicKey(x))
+	default:
+		return Key{}, errors.Errorf("key %s is of unsupported type %s", j.KeyID, j.KeyType)
+	}
+}
+
+// Set creates a key set of public keys of a JWKS, tokens can only be verified with it.
+// Keys that are not meant for signatures or are of unsupported types are skipped.
+func (j JWKS) Set() *Set {
+	s := Set{keys: make(map[string]Key, len(j.Keys))}
+
+	for _, jwk := range j.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		k, err := jwk.Key()
+		if err != nil {
+			continue
+		}
+		s.keys[k.ID] = k
+	}
+
+	return &s
+}
+
+// encode encodes bytes in base64url without padding as JWK requires.
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decode decodes base64url encoded bytes without padding.
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
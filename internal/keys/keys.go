@@ -0,0 +1,200 @@
+// Package keys manages keys JWT tokens are signed and verified with.
+// Tokens are signed with RSA (RS256) or Ed25519 (EdDSA) private keys and carry id of a key in "kid" header,
+// so several keys can be active at once while keys are rotated.
+// Public keys are published as JSON Web Key Set, so other services can verify tokens on their own.
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// ErrUnknownKey is returned when a token is signed with a key that is not in a key set.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key is a key tokens are signed or verified with.
+type Key struct {
+	// ID of a key, it is passed in "kid" header of tokens.
+	ID     string
+	Method jwt.SigningMethod
+
+	// private is a key tokens are signed with, it is nil for keys that can only verify tokens.
+	private interface{}
+	public  interface{}
+}
+
+// CanSign reports whether tokens can be signed with a key.
+func (k Key) CanSign() bool {
+	return k.private != nil
+}
+
+// Set is a set of keys, one of them is used to sign new tokens,
+// while all of them are used to verify tokens.
+type Set struct {
+	signing Key
+	keys    map[string]Key
+}
+
+// NewSet creates a new key set that signs tokens with a key of given id.
+func NewSet(signingKeyID string, keys ...Key) (*Set, error) {
+	s := Set{keys: make(map[string]Key, len(keys))}
+
+	for _, k := range keys {
+		if _, ok := s.keys[k.ID]; ok {
+			return nil, errors.Errorf("duplicate key id %q", k.ID)
+		}
+		s.keys[k.ID] = k
+	}
+
+	signing, ok := s.keys[signingKeyID]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownKey, "signing key %q", signingKeyID)
+	}
+	if !signing.CanSign() {
+		return nil, errors.Errorf("signing key %q has no private key", signingKeyID)
+	}
+	s.signing = signing
+
+	return &s, nil
+}
+
+// NewHMACSet creates a key set with a single shared secret that signs tokens with HS512.
+// Tokens signed with it can only be verified by holders of the secret, so it is meant for development.
+func NewHMACSet(secret []byte) *Set {
+	k := Key{
+		Method:  jwt.SigningMethodHS512,
+		private: secret,
+		public:  secret,
+	}
+
+	return &Set{
+		signing: k,
+		keys:    map[string]Key{k.ID: k},
+	}
+}
+
+// Load loads keys from PEM files given in kid=path,kid=path format
+// and creates a key set that signs tokens with a key of given id.
+// A file can contain either a private key (PKCS #8 or PKCS #1) or a public key (PKIX),
+// the latter is useful to keep verifying tokens signed with a retired key.
+func Load(spec string, signingKeyID string) (*Set, error) {
+	var keys []Key
+
+	for _, def := range strings.Split(spec, ",") {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+
+		parts := strings.SplitN(def, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("key definition %q is not in kid=path format", def)
+		}
+
+		data, err := ioutil.ReadFile(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading key %s", parts[0])
+		}
+
+		k, err := ParsePEM(parts[0], data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return NewSet(signingKeyID, keys...)
+}
+
+// ParsePEM parses a PEM encoded RSA or Ed25519 key.
+func ParsePEM(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, errors.Errorf("key %s is not PEM encoded", id)
+	}
+
+	var (
+		parsed interface{}
+		err    error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return Key{}, errors.Errorf("key %s has unsupported PEM block type %q", id, block.Type)
+	}
+	if err != nil {
+		return Key{}, errors.Wrapf(err, "parsing key %s", id)
+	}
+
+	return newKey(id, parsed)
+}
+
+// newKey creates a key from parsed RSA or Ed25519 private or public key.
+func newKey(id string, parsed interface{}) (Key, error) {
+	k := Key{ID: id}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.Method, k.private, k.public = jwt.SigningMethodRS256, key, &key.PublicKey
+	case *rsa.PublicKey:
+		k.Method, k.public = jwt.SigningMethodRS256, key
+	case ed25519.PrivateKey:
+		k.Method, k.private, k.public = SigningMethodEdDSA, key, key.Public()
+	case ed25519.PublicKey:
+		k.Method, k.public = SigningMethodEdDSA, key
+	default:
+		return Key{}, errors.Errorf("key %s is of unsupported type %T", id, parsed)
+	}
+
+	return k, nil
+}
+
+// Sign signs claims with a signing key of a set.
+func (s *Set) Sign(claims jwt.Claims) (string, error) {
+	if !s.signing.CanSign() {
+		return "", errors.New("key set has no signing key")
+	}
+
+	token := jwt.NewWithClaims(s.signing.Method, claims)
+	if s.signing.ID != "" {
+		token.Header["kid"] = s.signing.ID
+	}
+
+	signed, err := token.SignedString(s.signing.private)
+	if err != nil {
+		return "", errors.Wrap(err, "signing token")
+	}
+
+	return signed, nil
+}
+
+// Keyfunc finds a key a token was signed with by it`s "kid" header.
+// It can be passed to jwt.Parse functions.
+func (s *Set) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	k, ok := s.keys[kid]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownKey, "kid %q", kid)
+	}
+
+	// Algorithm of a token must match a key, otherwise public key could be used as HMAC secret.
+	if t.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+
+	return k.public, nil
+}
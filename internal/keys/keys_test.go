@@ -0,0 +1,198 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestSet(t *testing.T) {
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to generate RSA key. Error: %s", tests.Failed, err)
+	}
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to generate Ed25519 key. Error: %s", tests.Failed, err)
+	}
+
+	rsaKey := mustParsePEM(t, "rsa-1", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaPrivate))
+	edKey := mustParsePEM(t, "ed-1", "PRIVATE KEY", mustMarshalPKCS8(t, edPrivate))
+	edPublicBytes, err := x509.MarshalPKIXPublicKey(edPrivate.Public())
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to marshal Ed25519 public key. Error: %s", tests.Failed, err)
+	}
+	edPublicKey := mustParsePEM(t, "ed-1", "PUBLIC KEY", edPublicBytes)
+
+	t.Run("Given the need to sign and verify tokens with asymmetric keys", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			key      Key
+			alg      string
+		}{
+			{testName: "RSA key", key: rsaKey, alg: "RS256"},
+			{testName: "Ed25519 key", key: edKey, alg: "EdDSA"},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				s, err := NewSet(tc.key.ID, tc.key)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create key set. Error: %s", tests.Failed, testID, err)
+				}
+
+				signed, err := s.Sign(jwt.StandardClaims{Subject: "user"})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to sign a token. Error: %s", tests.Failed, testID, err)
+				}
+
+				token, err := jwt.ParseWithClaims(signed, &jwt.StandardClaims{}, s.Keyfunc)
+				if err != nil || !token.Valid {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to verify a token. Error: %s", tests.Failed, testID, err)
+				}
+				if token.Header["kid"] != tc.key.ID || token.Header["alg"] != tc.alg {
+					t.Fatalf("\t%s\tTest %d:\tWant kid: %s, alg: %s, got: %v, %v", tests.Failed, testID, tc.key.ID, tc.alg, token.Header["kid"], token.Header["alg"])
+				}
+				t.Logf("\t%s\tTest %d:\tShould sign and verify a token with kid: %s, alg: %s", tests.Success, testID, tc.key.ID, tc.alg)
+			})
+		}
+	})
+
+	t.Run("Given the need to rotate keys", func(t *testing.T) {
+		old, err := NewSet(rsaKey.ID, rsaKey)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create key set. Error: %s", tests.Failed, err)
+		}
+		signedWithOld, err := old.Sign(jwt.StandardClaims{Subject: "user"})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to sign a token. Error: %s", tests.Failed, err)
+		}
+
+		rotated, err := NewSet(edKey.ID, rsaKey, edKey)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create key set. Error: %s", tests.Failed, err)
+		}
+		if _, err := jwt.Parse(signedWithOld, rotated.Keyfunc); err != nil {
+			t.Fatalf("\t%s\tShould verify tokens signed with a previous key. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould verify tokens signed with a previous key.", tests.Success)
+
+		// A set without private key of a retired key can still verify it`s tokens.
+		verifying, err := NewSet(rsaKey.ID, rsaKey, edPublicKey)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create key set. Error: %s", tests.Failed, err)
+		}
+		signedWithNew, err := rotated.Sign(jwt.StandardClaims{Subject: "user"})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to sign a token. Error: %s", tests.Failed, err)
+		}
+		if _, err := jwt.Parse(signedWithNew, verifying.Keyfunc); err != nil {
+			t.Fatalf("\t%s\tShould verify tokens with a public key. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould verify tokens with a public key.", tests.Success)
+
+		if _, err := jwt.Parse(signedWithNew, old.Keyfunc); err == nil {
+			t.Fatalf("\t%s\tShould reject tokens signed with an unknown key.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould reject tokens signed with an unknown key.", tests.Success)
+
+		if _, err := NewSet(edPublicKey.ID, edPublicKey); err == nil {
+			t.Fatalf("\t%s\tShould not sign tokens with a public key.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould not sign tokens with a public key.", tests.Success)
+	})
+
+	t.Run("Given the need to reject tokens with a substituted algorithm", func(t *testing.T) {
+		s, err := NewSet(rsaKey.ID, rsaKey)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create key set. Error: %s", tests.Failed, err)
+		}
+
+		publicPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaPrivate.PublicKey)})
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{Subject: "admin"})
+		forged.Header["kid"] = rsaKey.ID
+		signed, err := forged.SignedString(publicPEM)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to sign a forged token. Error: %s", tests.Failed, err)
+		}
+
+		if _, err := jwt.Parse(signed, s.Keyfunc); err == nil {
+			t.Fatalf("\t%s\tShould reject a token signed with HMAC using a public key.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould reject a token signed with HMAC using a public key.", tests.Success)
+	})
+
+	t.Run("Given the need to publish public keys", func(t *testing.T) {
+		s, err := NewSet(edKey.ID, rsaKey, edKey)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create key set. Error: %s", tests.Failed, err)
+		}
+
+		jwks := s.JWKS()
+		if len(jwks.Keys) != 2 {
+			t.Fatalf("\t%s\tWant 2 keys, got: %d", tests.Failed, len(jwks.Keys))
+		}
+		ed, rsaJWK := jwks.Keys[0], jwks.Keys[1]
+		if ed.KeyType != "OKP" || ed.Curve != "Ed25519" || ed.Algorithm != "EdDSA" || ed.X == "" {
+			t.Fatalf("\t%s\tShould publish Ed25519 key, got: %+v", tests.Failed, ed)
+		}
+		if rsaJWK.KeyType != "RSA" || rsaJWK.Algorithm != "RS256" || rsaJWK.N == "" || rsaJWK.E != "AQAB" {
+			t.Fatalf("\t%s\tShould publish RSA key, got: %+v", tests.Failed, rsaJWK)
+		}
+		t.Logf("\t%s\tShould publish public keys.", tests.Success)
+
+		if len(NewHMACSet([]byte("secret")).JWKS().Keys) != 0 {
+			t.Fatalf("\t%s\tShould never publish shared secrets.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould never publish shared secrets.", tests.Success)
+	})
+
+	t.Run("Given the need to verify tokens with published keys", func(t *testing.T) {
+		s, err := NewSet(rsaKey.ID, rsaKey, edKey)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create key set. Error: %s", tests.Failed, err)
+		}
+
+		published := s.JWKS().Set()
+		for _, signing := range []string{rsaKey.ID, edKey.ID} {
+			signer, err := NewSet(signing, rsaKey, edKey)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to create key set. Error: %s", tests.Failed, err)
+			}
+			signed, err := signer.Sign(jwt.StandardClaims{Subject: "user"})
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to sign a token. Error: %s", tests.Failed, err)
+			}
+			if _, err := jwt.Parse(signed, published.Keyfunc); err != nil {
+				t.Fatalf("\t%s\tShould verify a token signed with %s key. Error: %s", tests.Failed, signing, err)
+			}
+		}
+		t.Logf("\t%s\tShould verify tokens with published keys.", tests.Success)
+
+		if _, err := published.Sign(jwt.StandardClaims{Subject: "user"}); err == nil {
+			t.Fatalf("\t%s\tShould not sign tokens with published keys.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould not sign tokens with published keys.", tests.Success)
+	})
+}
+
+func mustParsePEM(t *testing.T, id, blockType string, b []byte) Key {
+	k, err := ParsePEM(id, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: b}))
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to parse %s key. Error: %s", tests.Failed, id, err)
+	}
+	return k
+}
+
+func mustMarshalPKCS8(t *testing.T, key interface{}) []byte {
+	b, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to marshal private key. Error: %s", tests.Failed, err)
+	}
+	return b
+}
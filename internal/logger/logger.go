@@ -1,8 +1,149 @@
 // Package logger provides wrapper interface for logging to make it implementation-independent.
 // As well as implementation of it with zap logger.
+//
+// Log entries are structured: a message tells what happened and typed fields tell details of it,
+// so logs can be filtered and aggregated by fields instead of parsing messages.
 package logger
 
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
 // Logger is an interface for loggers
 type Logger interface {
-	Log(level, message string)
+	Debug(message string, fields ...Field)
+	Info(message string, fields ...Field)
+	Warn(message string, fields ...Field)
+	Error(message string, fields ...Field)
+	// Fatal logs a message and exits an application.
+	Fatal(message string, fields ...Field)
+
+	// With returns a child logger that adds given fields to every entry it logs.
+	With(fields ...Field) Logger
+}
+
+// Level is a level of importance of log entries.
+type Level int8
+
+// Levels of log entries from the least important to the most important one.
+const (
+	DebugLevel Level = iota - 1
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	FatalLevel
+)
+
+// ParseLevel parses a level from it`s name, e.g. "info".
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return DebugLevel, nil
+	case "info", "":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	case "fatal":
+		return FatalLevel, nil
+	default:
+		return InfoLevel, errors.Errorf("unknown log level %q", s)
+	}
+}
+
+// Field is a typed detail of a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// String is a field with a string value.
+func String(key, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int is a field with an integer value.
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int64 is a field with a 64-bit integer value.
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Bool is a field with a boolean value.
+func Bool(key string, value bool) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Duration is a field with a duration value.
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Time is a field with a time value.
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err is a field with an error under "error" key.
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// Any is a field with a value of any type, typed fields should be preferred to it.
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Nop returns a logger that discards all entries.
+func Nop() Logger {
+	return nop{}
+}
+
+// nop is a logger that discards all entries.
+type nop struct{}
+
+func (nop) Debug(string, ...Field) {}
+func (nop) Info(string, ...Field)  {}
+func (nop) Warn(string, ...Field)  {}
+func (nop) Error(string, ...Field) {}
+func (nop) Fatal(string, ...Field) {}
+func (n nop) With(...Field) Logger { return n }
+
+// ctxKey is the context.Context key to store a logger.
+var ctxKey = &struct{ name string }{"logger"}
+
+// NewContext returns a copy of a given context that carries a logger.
+// Middlewares put a logger with details of a request into it`s context,
+// e.g. an ID of a request and an ID of a user that made it.
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, ctxKey, l)
+}
+
+// FromContext returns a logger from a given context,
+// so entries logged with it have details of a request the context belongs to.
+// If there is no logger in a context, entries are discarded.
+func FromContext(ctx context.Context) Logger {
+	return FromContextOr(ctx, Nop())
+}
+
+// FromContextOr returns a logger from a given context or a given logger if there is no logger in a context,
+// it suits components that log both within requests and outside of them, e.g. in background jobs.
+func FromContextOr(ctx context.Context, l Logger) Logger {
+	if ctx == nil {
+		return l
+	}
+
+	if cl, ok := ctx.Value(ctxKey).(Logger); ok {
+		return cl
+	}
+
+	return l
 }
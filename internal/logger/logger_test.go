@@ -0,0 +1,71 @@
+package logger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestParseLevel(t *testing.T) {
+	tt := []struct {
+		name  string
+		s     string
+		level Level
+		valid bool
+	}{
+		{name: "debug", s: "debug", level: DebugLevel, valid: true},
+		{name: "info", s: "info", level: InfoLevel, valid: true},
+		{name: "empty level is info", s: "", level: InfoLevel, valid: true},
+		{name: "warn", s: "warn", level: WarnLevel, valid: true},
+		{name: "warning", s: "warning", level: WarnLevel, valid: true},
+		{name: "error", s: "error", level: ErrorLevel, valid: true},
+		{name: "fatal", s: "fatal", level: FatalLevel, valid: true},
+		{name: "upper case with spaces", s: " ERROR ", level: ErrorLevel, valid: true},
+		{name: "unknown level", s: "verbose", level: InfoLevel, valid: false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			level, err := ParseLevel(tc.s)
+			if (err == nil) != tc.valid {
+				t.Fatalf("\t%s\tTest %s:\tWant valid: %t, got error: %v", tests.Failed, tc.name, tc.valid, err)
+			}
+			if level != tc.level {
+				t.Fatalf("\t%s\tTest %s:\tWant level: %d, got: %d", tests.Failed, tc.name, tc.level, level)
+			}
+			t.Logf("\t%s\tTest %s:\tShould parse %q as level %d", tests.Success, tc.name, tc.s, tc.level)
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	fallback, err := NewZapLogger(Config{})
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to create a logger. Error: %s", tests.Failed, err)
+	}
+	carried := fallback.With(String("request_id", "1"))
+	ctx := NewContext(context.Background(), carried)
+
+	tt := []struct {
+		name string
+		ctx  context.Context
+		want Logger
+	}{
+		{name: "context with a logger", ctx: ctx, want: carried},
+		{name: "context without a logger", ctx: context.Background(), want: fallback},
+		{name: "nil context", ctx: nil, want: fallback},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := FromContextOr(tc.ctx, fallback); got != tc.want {
+				t.Fatalf("\t%s\tTest %s:\tWant logger: %v, got: %v", tests.Failed, tc.name, tc.want, got)
+			}
+			t.Logf("\t%s\tTest %s:\tShould get an appropriate logger", tests.Success, tc.name)
+		})
+	}
+
+	if got := FromContext(context.Background()); got != Nop() {
+		t.Fatalf("\t%s\tWant entries to be discarded without a logger in a context, got: %v", tests.Failed, got)
+	}
+	t.Logf("\t%s\tShould discard entries without a logger in a context.", tests.Success)
+}
@@ -1,13 +1,22 @@
 package logger
 
 import (
+	"io"
 	"os"
-	"strings"
 
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
+// Config is a configuration of a logger.
+type Config struct {
+	// Format is a format entries are written in: "json" or "console".
+	Format string
+	// Level is the least level of entries that are written.
+	Level Level
+}
+
 // ZapLogger is an wrapper for zap logger
 // which satisfies logger interface
 // ---
@@ -16,36 +25,101 @@ type ZapLogger struct {
 	*zap.Logger
 }
 
-// NewZapLogger returns a new zap logger.
-func NewZapLogger() *ZapLogger {
-	encoder := getEncoder()
-	core := zapcore.NewCore(encoder, zapcore.AddSync(os.Stdout), zapcore.DebugLevel)
+// NewZapLogger returns a new zap logger that writes entries of given level and above to stdout.
+func NewZapLogger(cfg Config) (*ZapLogger, error) {
+	return newZapLogger(cfg, os.Stdout)
+}
+
+// newZapLogger returns a new zap logger that writes entries of given level and above to a given writer.
+func newZapLogger(cfg Config, w io.Writer) (*ZapLogger, error) {
+	encoder, err := getEncoder(cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	core := zapcore.NewCore(encoder, zapcore.AddSync(w), zapLevel(cfg.Level))
 	logger := zap.New(core)
 	zapLogger := &ZapLogger{
 		logger.Named("REST API"),
 	}
-	return zapLogger
+	return zapLogger, nil
 }
 
 // Bunch of settings for zap logger.
-func getEncoder() zapcore.Encoder {
+func getEncoder(format string) (zapcore.Encoder, error) {
 	// Configure encoder
 	encoderConfig := zap.NewProductionEncoderConfig()
-	encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoderConfig.EncodeDuration = zapcore.StringDurationEncoder
 	encoderConfig.CallerKey = "caller"
-	// By default zap uses JSON encoder so let`s change it
-	return zapcore.NewConsoleEncoder(encoderConfig)
-}
-
-// Log info according to passed level and message.
-func (z *ZapLogger) Log(level, message string) {
-	switch strings.ToLower(level) {
-	case "info":
-		z.Info(message)
-	case "error":
-		z.Error(message)
-	case "fatal":
-		z.Fatal(message)
+
+	switch format {
+	case "json":
+		return zapcore.NewJSONEncoder(encoderConfig), nil
+	case "console", "":
+		encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		return zapcore.NewConsoleEncoder(encoderConfig), nil
+	default:
+		return nil, errors.Errorf("unknown log format %q", format)
+	}
+}
+
+// zapLevel converts a level into zap one.
+func zapLevel(l Level) zapcore.Level {
+	switch l {
+	case DebugLevel:
+		return zapcore.DebugLevel
+	case WarnLevel:
+		return zapcore.WarnLevel
+	case ErrorLevel:
+		return zapcore.ErrorLevel
+	case FatalLevel:
+		return zapcore.FatalLevel
+	default:
+		return zapcore.InfoLevel
+	}
+}
+
+// Debug logs a message with given fields at debug level.
+func (z *ZapLogger) Debug(message string, fields ...Field) {
+	z.Logger.Debug(message, zapFields(fields)...)
+}
+
+// Info logs a message with given fields at info level.
+func (z *ZapLogger) Info(message string, fields ...Field) {
+	z.Logger.Info(message, zapFields(fields)...)
+}
+
+// Warn logs a message with given fields at warn level.
+func (z *ZapLogger) Warn(message string, fields ...Field) {
+	z.Logger.Warn(message, zapFields(fields)...)
+}
+
+// Error logs a message with given fields at error level.
+func (z *ZapLogger) Error(message string, fields ...Field) {
+	z.Logger.Error(message, zapFields(fields)...)
+}
+
+// Fatal logs a message with given fields at fatal level and exits an application.
+func (z *ZapLogger) Fatal(message string, fields ...Field) {
+	z.Logger.Fatal(message, zapFields(fields)...)
+}
+
+// With returns a child logger that adds given fields to every entry it logs.
+func (z *ZapLogger) With(fields ...Field) Logger {
+	return &ZapLogger{z.Logger.With(zapFields(fields)...)}
+}
+
+// zapFields converts fields into zap ones, zap picks an encoding of a value by it`s type.
+func zapFields(fields []Field) []zap.Field {
+	zfs := make([]zap.Field, 0, len(fields))
+	for _, f := range fields {
+		if err, ok := f.Value.(error); ok {
+			zfs = append(zfs, zap.NamedError(f.Key, err))
+			continue
+		}
+		zfs = append(zfs, zap.Any(f.Key, f.Value))
 	}
+
+	return zfs
 }
@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestZapLogger(t *testing.T) {
+	t.Run("Given the need to write entries of a given level and above", func(t *testing.T) {
+		var buf bytes.Buffer
+		l, err := newZapLogger(Config{Format: "json", Level: WarnLevel}, &buf)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create a logger. Error: %s", tests.Failed, err)
+		}
+
+		l.Debug("debug entry")
+		l.Info("info entry")
+		l.Warn("warn entry")
+		l.Error("error entry")
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 || !strings.Contains(lines[0], "warn entry") || !strings.Contains(lines[1], "error entry") {
+			t.Fatalf("\t%s\tWant warn and error entries only, got: %q", tests.Failed, lines)
+		}
+		t.Logf("\t%s\tShould write warn and error entries only.", tests.Success)
+	})
+
+	t.Run("Given the need to write entries as JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		l, err := newZapLogger(Config{Format: "json"}, &buf)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create a logger. Error: %s", tests.Failed, err)
+		}
+
+		l.With(String("request_id", "1")).Info("request started", Int("status", 200), Err(errors.New("broken")))
+		l.Info("no request")
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("\t%s\tWant 2 entries, got: %q", tests.Failed, lines)
+		}
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+			t.Fatalf("\t%s\tWant an entry to be JSON, got: %q, error: %v", tests.Failed, lines[0], err)
+		}
+		want := map[string]interface{}{
+			"level":      "info",
+			"msg":        "request started",
+			"logger":     "REST API",
+			"request_id": "1",
+			"status":     float64(200),
+			"error":      "broken",
+		}
+		for key, value := range want {
+			if entry[key] != value {
+				t.Fatalf("\t%s\tWant %s: %v, got: %v", tests.Failed, key, value, entry[key])
+			}
+		}
+		t.Logf("\t%s\tShould write an entry as JSON with fields of it and of a child logger.", tests.Success)
+
+		var parent map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[1]), &parent); err != nil {
+			t.Fatalf("\t%s\tWant an entry to be JSON, got: %q, error: %v", tests.Failed, lines[1], err)
+		}
+		if _, ok := parent["request_id"]; ok {
+			t.Fatalf("\t%s\tWant fields of a child logger not to be added to a parent one, got: %q", tests.Failed, lines[1])
+		}
+		t.Logf("\t%s\tShould not add fields of a child logger to a parent one.", tests.Success)
+	})
+
+	t.Run("Given the need to write entries for a console", func(t *testing.T) {
+		var buf bytes.Buffer
+		l, err := newZapLogger(Config{Format: "console"}, &buf)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create a logger. Error: %s", tests.Failed, err)
+		}
+
+		l.With(String("request_id", "1")).Info("request started")
+
+		line := strings.TrimSpace(buf.String())
+		if json.Valid([]byte(line)) || !strings.Contains(line, "request started") || !strings.Contains(line, `{"request_id": "1"}`) {
+			t.Fatalf("\t%s\tWant a plain text entry with fields, got: %q", tests.Failed, line)
+		}
+		t.Logf("\t%s\tShould write a plain text entry with fields.", tests.Success)
+	})
+
+	t.Run("Given the need to reject an unknown format", func(t *testing.T) {
+		if _, err := NewZapLogger(Config{Format: "xml"}); err == nil {
+			t.Fatalf("\t%s\tWant an error for an unknown format.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould reject an unknown format.", tests.Success)
+	})
+}
@@ -0,0 +1,50 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// FileMailer writes emails into .eml files inside a directory instead of sending them,
+// so they can be read during development.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer returns a new file mailer that writes emails into a given directory.
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{
+		dir:  dir,
+		from: from,
+	}
+}
+
+// Send writes a message into a new file.
+func (f *FileMailer) Send(ctx context.Context, m Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if m.From == "" {
+		m.From = f.from
+	}
+
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return errors.Wrapf(err, "creating mail directory %s", f.dir)
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), uuid.NewString())
+	if err := ioutil.WriteFile(filepath.Join(f.dir, name), m.Bytes(), 0o644); err != nil {
+		return errors.Wrapf(err, "writing email to %v", m.To)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+// InMemMailer keeps sent emails in memory, it is meant for tests.
+type InMemMailer struct {
+	messages []Message
+	sync.Mutex
+}
+
+// NewInMemMailer returns a new in-memory mailer.
+func NewInMemMailer() *InMemMailer {
+	return &InMemMailer{}
+}
+
+// Send saves a message in memory.
+func (i *InMemMailer) Send(ctx context.Context, m Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	i.Lock()
+	defer i.Unlock()
+
+	i.messages = append(i.messages, m)
+	return nil
+}
+
+// Messages returns all sent messages, oldest first.
+func (i *InMemMailer) Messages() []Message {
+	i.Lock()
+	defer i.Unlock()
+
+	messages := make([]Message, len(i.messages))
+	copy(messages, i.messages)
+	return messages
+}
@@ -0,0 +1,82 @@
+package mail
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestMailer(t *testing.T) {
+	m := Message{
+		To:      []string{"user@example.com"},
+		Subject: "Password reset",
+		Body:    "first line\nsecond line",
+	}
+
+	t.Run("Given the need to format a message", func(t *testing.T) {
+		b := string(Message{From: "no-reply@example.com", To: m.To, Subject: m.Subject, Body: m.Body}.Bytes())
+
+		for _, want := range []string{
+			"From: no-reply@example.com\r\n",
+			"To: user@example.com\r\n",
+			"Subject: Password reset\r\n",
+			"\r\n\r\nfirst line\r\nsecond line",
+		} {
+			if !strings.Contains(b, want) {
+				t.Fatalf("\t%s\tShould contain %q, got: %q", tests.Failed, want, b)
+			}
+		}
+		t.Logf("\t%s\tShould format a message with headers and CRLF line endings.", tests.Success)
+	})
+
+	t.Run("Given the need to keep sent messages in memory", func(t *testing.T) {
+		mailer := NewInMemMailer()
+
+		if err := mailer.Send(context.Background(), m); err != nil {
+			t.Fatalf("\t%s\tShould be able to send a message. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to send a message.", tests.Success)
+
+		messages := mailer.Messages()
+		if len(messages) != 1 || messages[0].Subject != m.Subject {
+			t.Fatalf("\t%s\tShould keep a sent message, got: %+v", tests.Failed, messages)
+		}
+		t.Logf("\t%s\tShould keep a sent message.", tests.Success)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := mailer.Send(ctx, m); err == nil {
+			t.Fatalf("\t%s\tShould not send a message with canceled context.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould not send a message with canceled context.", tests.Success)
+	})
+
+	t.Run("Given the need to write sent messages into files", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "mail")
+		mailer := NewFileMailer(dir, "no-reply@example.com")
+
+		if err := mailer.Send(context.Background(), m); err != nil {
+			t.Fatalf("\t%s\tShould be able to send a message. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to send a message.", tests.Success)
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if err != nil || len(files) != 1 {
+			t.Fatalf("\t%s\tShould write a single file, got: %v", tests.Failed, files)
+		}
+		t.Logf("\t%s\tShould write a single file.", tests.Success)
+
+		b, err := ioutil.ReadFile(files[0])
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to read a file. Error: %s", tests.Failed, err)
+		}
+		if !strings.Contains(string(b), "From: no-reply@example.com\r\n") {
+			t.Fatalf("\t%s\tShould use default sender, got: %q", tests.Failed, b)
+		}
+		t.Logf("\t%s\tShould use default sender.", tests.Success)
+	})
+}
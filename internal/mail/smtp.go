@@ -0,0 +1,53 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+
+	"github.com/pkg/errors"
+)
+
+// SMTPConfig is a configuration of SMTP server emails are sent through.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	// From is a sender address used when a message does not define it.
+	From string
+}
+
+// SMTPMailer sends emails through SMTP server.
+type SMTPMailer struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPMailer returns a new SMTP mailer.
+func NewSMTPMailer(cfg SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{cfg: cfg}
+}
+
+// Send sends a message through SMTP server.
+// Server authentication is used only if a user is configured.
+func (s *SMTPMailer) Send(ctx context.Context, m Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if m.From == "" {
+		m.From = s.cfg.From
+	}
+
+	var auth smtp.Auth
+	if s.cfg.User != "" {
+		auth = smtp.PlainAuth("", s.cfg.User, s.cfg.Password, s.cfg.Host)
+	}
+
+	addr := net.JoinHostPort(s.cfg.Host, s.cfg.Port)
+	if err := smtp.SendMail(addr, auth, m.From, m.To, m.Bytes()); err != nil {
+		return errors.Wrapf(err, "sending email to %v", m.To)
+	}
+
+	return nil
+}
@@ -0,0 +1,354 @@
+// Package oidc implements a client of OpenID Connect identity providers
+// for authorization code flow with PKCE (RFC 7636).
+// Provider endpoints are discovered from it`s issuer URL,
+// ID tokens are verified with public keys published by a provider.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/internal/keys"
+)
+
+// ErrInvalidIDToken is returned when ID token is malformed, expired or issued for other client.
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// Config is a configuration of a client registered at identity provider.
+type Config struct {
+	// IssuerURL is an URL of a provider, it`s configuration is discovered at /.well-known/openid-configuration.
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is an URL a provider redirects a user to after authentication.
+	RedirectURL string
+	// Scopes are requested in addition to "openid".
+	Scopes []string
+}
+
+// Claims is an identity of a user asserted by ID token.
+type Claims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	GivenName         string `json:"given_name"`
+	FamilyName        string `json:"family_name"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+}
+
+// leeway is a clock skew between the application and a provider tolerated on ID token verification.
+const leeway = time.Minute
+
+// idTokenClaims are claims of ID token that are checked on verification.
+type idTokenClaims struct {
+	Claims
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	IssuedAt  int64    `json:"iat"`
+}
+
+// Valid implements jwt.Claims interface, it checks time based claims.
+func (c idTokenClaims) Valid() error {
+	now := time.Now()
+
+	if c.ExpiresAt == 0 {
+		return errors.New("token has no expiration")
+	}
+	if now.Add(-leeway).Unix() > c.ExpiresAt {
+		return errors.New("token is expired")
+	}
+	if c.IssuedAt != 0 && now.Add(leeway).Unix() < c.IssuedAt {
+		return errors.New("token is issued in the future")
+	}
+
+	return nil
+}
+
+// audience is "aud" claim, which can be either a string or an array of strings.
+type audience []string
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// metadata is a configuration of a provider published at it`s discovery endpoint.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is a client of particular identity provider.
+// Configuration and keys of a provider are fetched on first use and cached.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     *keys.Set
+}
+
+// NewProvider creates a new client of identity provider.
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Provider{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+// AuthCodeURL returns an URL of provider`s authorization endpoint a user should be redirected to.
+// State and nonce bind a response to a login, code challenge is derived from a PKCE verifier.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := make(url.Values)
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(append([]string{"openid"}, p.cfg.Scopes...), " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", CodeChallenge(codeVerifier))
+	q.Set("code_challenge_method", "S256")
+
+	u, err := url.Parse(md.AuthorizationEndpoint)
+	if err != nil {
+		return "", errors.Wrap(err, "parsing authorization endpoint")
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange exchanges an authorization code for ID token,
+// verifies it and returns an identity of a user.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Claims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := make(url.Values)
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, errors.Wrap(err, "creating token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.do(req, &tokens); err != nil {
+		return Claims{}, errors.Wrap(err, "exchanging authorization code")
+	}
+	if tokens.IDToken == "" {
+		return Claims{}, errors.Wrap(ErrInvalidIDToken, "token response has no ID token")
+	}
+
+	return p.Verify(ctx, tokens.IDToken, nonce)
+}
+
+// Verify checks signature, issuer, audience, expiration and nonce of ID token and returns it`s claims.
+func (p *Provider) Verify(ctx context.Context, idToken, nonce string) (Claims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	var claims idTokenClaims
+	_, err = jwt.ParseWithClaims(idToken, &claims, func(t *jwt.Token) (interface{}, error) {
+		return p.keyfunc(ctx, t)
+	})
+	if err != nil {
+		return Claims{}, errors.Wrap(ErrInvalidIDToken, err.Error())
+	}
+
+	if claims.Issuer != md.Issuer {
+		return Claims{}, errors.Wrapf(ErrInvalidIDToken, "issuer %q", claims.Issuer)
+	}
+	if !claims.Audience.contains(p.cfg.ClientID) {
+		return Claims{}, errors.Wrapf(ErrInvalidIDToken, "audience %v", claims.Audience)
+	}
+	if claims.Subject == "" {
+		return Claims{}, errors.Wrap(ErrInvalidIDToken, "token has no subject")
+	}
+	if claims.Nonce != nonce {
+		return Claims{}, errors.Wrap(ErrInvalidIDToken, "nonce mismatch")
+	}
+
+	return claims.Claims, nil
+}
+
+// keyfunc finds a provider key ID token was signed with.
+// Keys are fetched again once if a key is unknown, since a provider could have rotated them.
+func (p *Provider) keyfunc(ctx context.Context, t *jwt.Token) (interface{}, error) {
+	set, err := p.jwks(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := set.Keyfunc(t)
+	if errors.Cause(err) != keys.ErrUnknownKey {
+		return key, err
+	}
+
+	if set, err = p.jwks(ctx, true); err != nil {
+		return nil, err
+	}
+
+	return set.Keyfunc(t)
+}
+
+// discover fetches configuration of a provider.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating discovery request")
+	}
+
+	var md metadata
+	if err := p.do(req, &md); err != nil {
+		return nil, errors.Wrapf(err, "discovering provider %s", p.cfg.IssuerURL)
+	}
+
+	// Issuer must be exactly the one a configuration was requested for (OpenID Connect Discovery 1.0, 4.3).
+	if md.Issuer != strings.TrimSuffix(p.cfg.IssuerURL, "/") && md.Issuer != p.cfg.IssuerURL {
+		return nil, errors.Errorf("provider issuer %q does not match %q", md.Issuer, p.cfg.IssuerURL)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, errors.Errorf("provider %s configuration is incomplete", p.cfg.IssuerURL)
+	}
+
+	p.metadata = &md
+	return p.metadata, nil
+}
+
+// jwks fetches public keys of a provider, cached keys are returned unless refresh is requested.
+func (p *Provider) jwks(ctx context.Context, refresh bool) (*keys.Set, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil && !refresh {
+		return p.keys, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, md.JWKSURI, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating JWKS request")
+	}
+
+	var jwks keys.JWKS
+	if err := p.do(req, &jwks); err != nil {
+		return nil, errors.Wrapf(err, "fetching keys of provider %s", p.cfg.IssuerURL)
+	}
+
+	p.keys = jwks.Set()
+	return p.keys, nil
+}
+
+// do sends a request and decodes JSON response into dest.
+func (p *Provider) do(req *http.Request, dest interface{}) error {
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return errors.Wrap(err, "reading response")
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status %d: %s", res.StatusCode, body)
+	}
+
+	if err := json.Unmarshal(body, dest); err != nil {
+		return errors.Wrap(err, "decoding response")
+	}
+
+	return nil
+}
+
+// contains reports whether audience includes a client.
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// RandomString returns a random base64url encoded string
+// suitable for state, nonce and PKCE code verifier.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generating random string")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge derives S256 PKCE code challenge from a code verifier.
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
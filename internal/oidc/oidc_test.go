@@ -0,0 +1,199 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/rtbe/clean-rest-api/internal/keys"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+// mockProvider is a local OpenID Connect provider that issues ID tokens for a single authorization code.
+type mockProvider struct {
+	*httptest.Server
+	keys *keys.Set
+
+	// Claims of ID token issued for the code, "iss" is set by a provider.
+	claims jwt.MapClaims
+	code   string
+	// challenge is PKCE code challenge sent to authorization endpoint.
+	challenge string
+}
+
+func newMockProvider(t *testing.T, kid string) *mockProvider {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to generate RSA key. Error: %s", tests.Failed, err)
+	}
+	k, err := keys.ParsePEM(kid, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)}))
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to parse RSA key. Error: %s", tests.Failed, err)
+	}
+	set, err := keys.NewSet(k.ID, k)
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to create key set. Error: %s", tests.Failed, err)
+	}
+
+	mp := mockProvider{keys: set, code: "auth-code"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 mp.URL,
+			"authorization_endpoint": mp.URL + "/authorize",
+			"token_endpoint":         mp.URL + "/token",
+			"jwks_uri":               mp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(mp.keys.JWKS())
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, _ := r.BasicAuth()
+		if clientID != "client" || clientSecret != "secret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.PostFormValue("code") != mp.code || CodeChallenge(r.PostFormValue("code_verifier")) != mp.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		claims := jwt.MapClaims{"iss": mp.URL}
+		for k, v := range mp.claims {
+			claims[k] = v
+		}
+		idToken, err := mp.keys.Sign(claims)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "id_token": idToken})
+	})
+	mp.Server = httptest.NewServer(mux)
+
+	return &mp
+}
+
+func TestProvider(t *testing.T) {
+	mp := newMockProvider(t, "mock-1")
+	defer mp.Close()
+
+	p := NewProvider(Config{
+		IssuerURL:    mp.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/auth/oidc/mock/callback",
+		Scopes:       []string{"email", "profile"},
+	}, nil)
+
+	ctx := context.Background()
+	verifier, err := RandomString()
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to generate code verifier. Error: %s", tests.Failed, err)
+	}
+
+	t.Run("Given the need to redirect a user to a provider", func(t *testing.T) {
+		authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to build authorization URL. Error: %s", tests.Failed, err)
+		}
+
+		u, err := url.Parse(authURL)
+		if err != nil {
+			t.Fatalf("\t%s\tShould build a valid URL. Error: %s", tests.Failed, err)
+		}
+		q := u.Query()
+		if u.Path != "/authorize" || q.Get("state") != "state-1" || q.Get("nonce") != "nonce-1" ||
+			q.Get("scope") != "openid email profile" || q.Get("code_challenge_method") != "S256" {
+			t.Fatalf("\t%s\tShould build authorization URL, got: %s", tests.Failed, authURL)
+		}
+		t.Logf("\t%s\tShould build authorization URL.", tests.Success)
+
+		mp.challenge = q.Get("code_challenge")
+	})
+
+	t.Run("Given the need to exchange an authorization code for an identity", func(t *testing.T) {
+		valid := jwt.MapClaims{
+			"sub":            "external-1",
+			"aud":            []string{"client", "other"},
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          "nonce-1",
+			"email":          "user@corp.example.com",
+			"email_verified": true,
+		}
+		with := func(k string, v interface{}) jwt.MapClaims {
+			claims := jwt.MapClaims{}
+			for key, value := range valid {
+				claims[key] = value
+			}
+			claims[k] = v
+			return claims
+		}
+
+		tt := []struct {
+			testName string
+			claims   jwt.MapClaims
+			verifier string
+			valid    bool
+		}{
+			{testName: "valid ID token", claims: valid, verifier: verifier, valid: true},
+			{testName: "wrong code verifier", claims: valid, verifier: "wrong", valid: false},
+			{testName: "ID token for other client", claims: with("aud", "other"), verifier: verifier, valid: false},
+			{testName: "ID token with wrong nonce", claims: with("nonce", "nonce-2"), verifier: verifier, valid: false},
+			{testName: "expired ID token", claims: with("exp", time.Now().Add(-time.Hour).Unix()), verifier: verifier, valid: false},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				mp.claims = tc.claims
+
+				claims, err := p.Exchange(ctx, mp.code, tc.verifier, "nonce-1")
+				if tc.valid && err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to exchange a code. Error: %s", tests.Failed, testID, err)
+				}
+				if !tc.valid {
+					if err == nil {
+						t.Fatalf("\t%s\tTest %d:\tShould not accept an identity.", tests.Failed, testID)
+					}
+					t.Logf("\t%s\tTest %d:\tShould not accept an identity: %s", tests.Success, testID, err)
+					return
+				}
+
+				if claims.Subject != "external-1" || claims.Email != "user@corp.example.com" || !claims.EmailVerified {
+					t.Fatalf("\t%s\tTest %d:\tShould return claims of ID token, got: %+v", tests.Failed, testID, claims)
+				}
+				t.Logf("\t%s\tTest %d:\tShould return claims of ID token.", tests.Success, testID)
+			})
+		}
+	})
+
+	t.Run("Given the need to follow rotation of provider keys", func(t *testing.T) {
+		old := mp.keys
+		rotated := newMockProvider(t, "mock-2")
+		rotated.Close()
+		mp.keys = rotated.keys
+		defer func() { mp.keys = old }()
+
+		mp.claims = jwt.MapClaims{
+			"sub":   "external-1",
+			"aud":   "client",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": "nonce-1",
+		}
+		if _, err := p.Exchange(ctx, mp.code, verifier, "nonce-1"); err != nil {
+			t.Fatalf("\t%s\tShould verify ID token signed with a new key. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould verify ID token signed with a new key.", tests.Success)
+	})
+}
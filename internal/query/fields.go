@@ -0,0 +1,58 @@
+package query
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// FieldType is a type of a field value, it defines how filter values are validated.
+type FieldType int
+
+// Set of supported field types.
+const (
+	String FieldType = iota
+	Int
+	Decimal
+	Time
+	UUID
+)
+
+// decimal matches decimal numbers.
+var decimal = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+
+// Validate checks if a value can be compared with a field of that type.
+func (t FieldType) Validate(v string) error {
+	var err error
+
+	switch t {
+	case Int:
+		_, err = strconv.ParseInt(v, 10, 64)
+	case Decimal:
+		if !decimal.MatchString(v) {
+			err = errors.New("not a decimal number")
+		}
+	case Time:
+		_, err = time.Parse(time.RFC3339Nano, v)
+	case UUID:
+		_, err = uuid.Parse(v)
+	}
+
+	if err != nil {
+		return errors.Wrapf(ErrInvalidQuery, "value %q: %v", v, err)
+	}
+	return nil
+}
+
+// Field describes an entity field that can be used for filtering and sorting.
+type Field struct {
+	Column string
+	Type   FieldType
+}
+
+// Fields is a whitelist of entity fields available for filtering and sorting,
+// keyed by their names in API.
+type Fields map[string]Field
@@ -0,0 +1,195 @@
+// Package query provides database-agnostic representation of list queries:
+// filtering, sorting and cursor pagination, as well as parsing of it from URL query parameters.
+//
+// Supported URL query parameters:
+//
+//	?filter[field][op]=value - filter by field, op is one of eq, ne, gt, gte, lt, lte, like, in (eq by default)
+//	?sort=-price,title       - sort by set of fields, "-" prefix means descending order
+//	?limit=20                - max number of items on a page
+//	?cursor=...              - opaque cursor of a next page returned by previous request
+//	?include_deleted=true    - include soft-deleted items
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Limits of page size.
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// ErrInvalidQuery is returned when a list query can not be parsed or applied.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Operator is a comparison operator of a filter.
+type Operator string
+
+// Set of supported filter operators.
+const (
+	Eq   Operator = "eq"
+	Ne   Operator = "ne"
+	Gt   Operator = "gt"
+	Gte  Operator = "gte"
+	Lt   Operator = "lt"
+	Lte  Operator = "lte"
+	Like Operator = "like"
+	In   Operator = "in"
+)
+
+// operators is a set of supported filter operators.
+var operators = map[Operator]bool{Eq: true, Ne: true, Gt: true, Gte: true, Lt: true, Lte: true, Like: true, In: true}
+
+// Filter narrows down list of items to ones which field matches a value.
+type Filter struct {
+	Field string
+	Op    Operator
+	Value string
+}
+
+// Sort defines order of items by a single field.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Query is a list query.
+type Query struct {
+	Filters []Filter
+	Sort    []Sort
+	Limit   int
+	Cursor  string
+
+	// IncludeDeleted is true if soft-deleted items should be listed along with other ones.
+	IncludeDeleted bool
+}
+
+// Page is a metadata about a page of items returned by a list query.
+type Page struct {
+	// Cursor of a next page
+	//
+	NextCursor string `json:"next_cursor,omitempty"`
+
+	// Whether there are more items after this page
+	//
+	HasMore bool `json:"has_more"`
+}
+
+// filterKey matches filter[field] and filter[field][op] parameter names.
+var filterKey = regexp.MustCompile(`^filter\[(\w+)\](?:\[(\w+)\])?$`)
+
+// Parse parses a list query from URL query parameters.
+func Parse(values url.Values) (Query, error) {
+	q := Query{
+		Limit:  DefaultLimit,
+		Cursor: values.Get("cursor"),
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		vv := values[key]
+		m := filterKey.FindStringSubmatch(key)
+		if m == nil {
+			continue
+		}
+
+		op := Operator(m[2])
+		if op == "" {
+			op = Eq
+		}
+		if !operators[op] {
+			return Query{}, errors.Wrapf(ErrInvalidQuery, "unknown filter operator %q", op)
+		}
+
+		for _, v := range vv {
+			q.Filters = append(q.Filters, Filter{Field: m[1], Op: op, Value: v})
+		}
+	}
+
+	if s := values.Get("sort"); s != "" {
+		for _, field := range strings.Split(s, ",") {
+			field = strings.TrimSpace(field)
+			desc := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
+			if field == "" {
+				return Query{}, errors.Wrapf(ErrInvalidQuery, "empty sort field in %q", s)
+			}
+			q.Sort = append(q.Sort, Sort{Field: field, Desc: desc})
+		}
+	}
+
+	if l := values.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			return Query{}, errors.Wrapf(ErrInvalidQuery, "limit should be a number from 1 to %d", MaxLimit)
+		}
+		q.Limit = limit
+	}
+
+	if d := values.Get("include_deleted"); d != "" {
+		includeDeleted, err := strconv.ParseBool(d)
+		if err != nil {
+			return Query{}, errors.Wrap(ErrInvalidQuery, "include_deleted should be true or false")
+		}
+		q.IncludeDeleted = includeDeleted
+	}
+
+	return q, nil
+}
+
+// SortKey returns canonical representation of a sort order, e.g. -price,title.
+func SortKey(sorts []Sort) string {
+	fields := make([]string, 0, len(sorts))
+	for _, s := range sorts {
+		if s.Desc {
+			fields = append(fields, "-"+s.Field)
+			continue
+		}
+		fields = append(fields, s.Field)
+	}
+	return strings.Join(fields, ",")
+}
+
+// Cursor is a position of the last item of a page in a particular sort order.
+type Cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+}
+
+// EncodeCursor encodes a cursor into opaque string.
+func EncodeCursor(c Cursor) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", errors.Wrap(err, "encoding cursor")
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor decodes a cursor from opaque string.
+func DecodeCursor(s string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, errors.Wrap(ErrInvalidQuery, "malformed cursor")
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return Cursor{}, errors.Wrap(ErrInvalidQuery, "malformed cursor")
+	}
+
+	return c, nil
+}
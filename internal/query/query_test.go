@@ -0,0 +1,103 @@
+package query
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("Given the need to parse a list query from URL query parameters", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			rawQuery string
+			want     Query
+			valid    bool
+		}{
+			{
+				testName: "Empty query",
+				rawQuery: "",
+				want:     Query{Limit: DefaultLimit},
+				valid:    true,
+			},
+			{
+				testName: "Filters, sort, limit and cursor",
+				rawQuery: "filter[title][like]=juice&filter[price][gte]=10.5&filter[stock]=3&sort=-price,title&limit=5&cursor=abc&include_deleted=true",
+				want: Query{
+					Filters: []Filter{
+						{Field: "price", Op: Gte, Value: "10.5"},
+						{Field: "stock", Op: Eq, Value: "3"},
+						{Field: "title", Op: Like, Value: "juice"},
+					},
+					Sort:           []Sort{{Field: "price", Desc: true}, {Field: "title"}},
+					Limit:          5,
+					Cursor:         "abc",
+					IncludeDeleted: true,
+				},
+				valid: true,
+			},
+			{testName: "Unknown operator", rawQuery: "filter[price][between]=1", valid: false},
+			{testName: "Empty sort field", rawQuery: "sort=price,,title", valid: false},
+			{testName: "Limit is not a number", rawQuery: "limit=ten", valid: false},
+			{testName: "Limit is too big", rawQuery: "limit=1000", valid: false},
+			{testName: "Include deleted is not a boolean", rawQuery: "include_deleted=maybe", valid: false},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				values, err := url.ParseQuery(tc.rawQuery)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to parse raw query. Error: %s", tests.Failed, testID, err)
+				}
+
+				q, err := Parse(values)
+				if !tc.valid {
+					if errors.Cause(err) != ErrInvalidQuery {
+						t.Fatalf("\t%s\tTest %d:\tWant error: %v, got: %v", tests.Failed, testID, ErrInvalidQuery, err)
+					}
+					t.Logf("\t%s\tTest %d:\tWant error: %v, got: %v", tests.Success, testID, ErrInvalidQuery, err)
+					return
+				}
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to parse a list query. Error: %s", tests.Failed, testID, err)
+				}
+
+				if !reflect.DeepEqual(tc.want, q) {
+					t.Fatalf("\t%s\tTest %d:\tWant query: %+v, got: %+v", tests.Failed, testID, tc.want, q)
+				}
+				t.Logf("\t%s\tTest %d:\tWant query: %+v, got: %+v", tests.Success, testID, tc.want, q)
+			})
+		}
+	})
+}
+
+func TestCursor(t *testing.T) {
+	t.Run("Given the need to encode and decode a cursor", func(t *testing.T) {
+		c := Cursor{
+			Sort:   SortKey([]Sort{{Field: "price", Desc: true}, {Field: "product_id"}}),
+			Values: []string{"10.20", "0b2c4a6e-1d2f-4c61-9d0e-8f5a3b7c9d1e"},
+		}
+
+		s, err := EncodeCursor(c)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to encode a cursor. Error: %s", tests.Failed, err)
+		}
+
+		decoded, err := DecodeCursor(s)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to decode a cursor. Error: %s", tests.Failed, err)
+		}
+
+		if !reflect.DeepEqual(c, decoded) {
+			t.Fatalf("\t%s\tWant cursor: %+v, got: %+v", tests.Failed, c, decoded)
+		}
+		t.Logf("\t%s\tWant cursor: %+v, got: %+v", tests.Success, c, decoded)
+
+		if _, err := DecodeCursor("%%%"); errors.Cause(err) != ErrInvalidQuery {
+			t.Fatalf("\t%s\tWant error: %v, got: %v", tests.Failed, ErrInvalidQuery, err)
+		}
+		t.Logf("\t%s\tShould not be able to decode a malformed cursor.", tests.Success)
+	})
+}
@@ -8,9 +8,12 @@ CREATE TABLE users (
     last_name TEXT, 
     password TEXT, 
     email TEXT UNIQUE NOT NULL, 
+    email_verified BOOLEAN NOT NULL DEFAULT false,
     roles TEXT[],
+    version INT NOT NULL DEFAULT 1,
     date_created TIMESTAMP DEFAULT now(), 
     date_updated TIMESTAMP, 
+    deleted_at TIMESTAMP,
 
     PRIMARY KEY (user_id)
 );
@@ -21,18 +24,31 @@ CREATE TABLE products (
     description TEXT NOT NULL,
     price DECIMAL(10,2),
     stock INT,
+    version INT NOT NULL DEFAULT 1,
     date_created TIMESTAMP DEFAULT now(),
     date_updated TIMESTAMP,
+    deleted_at TIMESTAMP,
+    search tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'B')
+    ) STORED,
 
     PRIMARY KEY (product_id)
 );
 
+CREATE INDEX idx_products_search ON products USING GIN (search);
+
 CREATE TABLE orders (
     order_id UUID DEFAULT gen_random_uuid(),
     user_id UUID,
     status TEXT,
+    subtotal DECIMAL(12,2) NOT NULL DEFAULT 0,
+    tax DECIMAL(12,2) NOT NULL DEFAULT 0,
+    total DECIMAL(12,2) NOT NULL DEFAULT 0,
+    version INT NOT NULL DEFAULT 1,
     date_created TIMESTAMP DEFAULT now(),
     date_updated TIMESTAMP,
+    deleted_at TIMESTAMP,
 
     PRIMARY KEY (order_id),
     FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
@@ -43,12 +59,163 @@ CREATE TABLE order_items (
     order_id UUID,
     product_id UUID,
     quantity INT,
+    unit_price DECIMAL(10,2) NOT NULL DEFAULT 0,
+    product_title TEXT NOT NULL DEFAULT '',
+    version INT NOT NULL DEFAULT 1,
     date_created TIMESTAMP DEFAULT now(),
     date_updated TIMESTAMP,
+    deleted_at TIMESTAMP,
     
     PRIMARY KEY (order_item_id),
     FOREIGN KEY (order_id) REFERENCES orders (order_id) ON DELETE CASCADE,
     FOREIGN KEY (product_id) REFERENCES products (product_id) ON DELETE CASCADE
 );
 
-CREATE INDEX idx_order_to_product ON order_items (order_id, product_id);
\ No newline at end of file
+CREATE INDEX idx_order_to_product ON order_items (order_id, product_id);
+
+CREATE INDEX idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_products_deleted_at ON products (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_orders_deleted_at ON orders (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_order_items_deleted_at ON order_items (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE order_status_history (
+    order_status_change_id UUID DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL,
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    actor TEXT,
+    reason TEXT,
+    date_created TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (order_status_change_id),
+    FOREIGN KEY (order_id) REFERENCES orders (order_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_order_status_history_order ON order_status_history (order_id, date_created);
+
+CREATE TABLE external_identities (
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id UUID NOT NULL,
+    email TEXT,
+    date_created TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (provider, subject),
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_external_identities_user ON external_identities (user_id);
+
+CREATE TABLE api_keys (
+    api_key_id UUID DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT UNIQUE NOT NULL,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    last_used TIMESTAMP,
+    date_created TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (api_key_id),
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_api_keys_user ON api_keys (user_id);
+
+CREATE TABLE idempotency_keys (
+    principal TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    status_code INT NOT NULL DEFAULT 0,
+    header JSONB NOT NULL DEFAULT '{}',
+    body BYTEA,
+    expires_at TIMESTAMP NOT NULL,
+    date_created TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (principal, idempotency_key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
+
+CREATE TABLE audit_records (
+    audit_id UUID DEFAULT gen_random_uuid(),
+    actor_id TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    entity_type TEXT NOT NULL,
+    entity_id UUID NOT NULL,
+    action TEXT NOT NULL,
+    changes JSONB NOT NULL DEFAULT '{}',
+    date_created TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (audit_id)
+);
+
+CREATE INDEX idx_audit_records_entity ON audit_records (entity_type, entity_id);
+CREATE INDEX idx_audit_records_actor ON audit_records (actor_id);
+CREATE INDEX idx_audit_records_date_created ON audit_records (date_created);
+
+CREATE FUNCTION reject_audit_record_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit records are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_records_append_only
+    BEFORE UPDATE OR DELETE ON audit_records
+    FOR EACH ROW EXECUTE FUNCTION reject_audit_record_change();
+
+CREATE TRIGGER audit_records_no_truncate
+    BEFORE TRUNCATE ON audit_records
+    FOR EACH STATEMENT EXECUTE FUNCTION reject_audit_record_change();
+
+CREATE TABLE outbox_events (
+    event_id UUID DEFAULT gen_random_uuid(),
+    sequence BIGSERIAL NOT NULL,
+    aggregate_type TEXT NOT NULL,
+    aggregate_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT now(),
+    published_at TIMESTAMP,
+    date_created TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (event_id)
+);
+
+CREATE INDEX idx_outbox_events_pending ON outbox_events (aggregate_type, aggregate_id, sequence) WHERE published_at IS NULL;
+
+CREATE TABLE webhook_subscriptions (
+    subscription_id UUID DEFAULT gen_random_uuid(),
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    event_types TEXT[] NOT NULL,
+    date_created TIMESTAMP DEFAULT now(),
+    date_updated TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (subscription_id)
+);
+
+CREATE TABLE webhook_deliveries (
+    delivery_id UUID DEFAULT gen_random_uuid(),
+    subscription_id UUID NOT NULL,
+    event_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    response_status INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT now(),
+    delivered_at TIMESTAMP,
+    date_created TIMESTAMP DEFAULT now(),
+    date_updated TIMESTAMP DEFAULT now(),
+
+    PRIMARY KEY (delivery_id),
+    UNIQUE (subscription_id, event_id),
+    FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions (subscription_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_webhook_deliveries_pending ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
\ No newline at end of file
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewMongo runs MongoDB inside a docker container and connects to it.
+// Purge should be called when tests are done to kill and remove the container.
+func NewMongo() (db *mongo.Database, purge func() error, err error) {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "connecting to docker")
+	}
+
+	opts := dockertest.RunOptions{
+		Repository: "mongo",
+		Tag:        "4.4",
+		Env: []string{
+			"MONGO_INITDB_ROOT_USERNAME=" + MongoUser,
+			"MONGO_INITDB_ROOT_PASSWORD=" + MongoPassword,
+		},
+		ExposedPorts: []string{"27017"},
+		PortBindings: map[docker.Port][]docker.PortBinding{
+			"27017": {
+				{HostIP: "0.0.0.0", HostPort: MongoPort},
+			},
+		},
+	}
+
+	resource, err := pool.RunWithOptions(&opts)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "starting resource")
+	}
+
+	var client *mongo.Client
+	purge = func() error {
+		if client != nil {
+			client.Disconnect(context.Background())
+		}
+		return pool.Purge(resource)
+	}
+
+	if err = pool.Retry(func() error {
+		client, err = mongo.Connect(context.Background(), options.Client().ApplyURI(fmt.Sprintf(
+			"mongodb://%s:%s@localhost:%s",
+			MongoUser,
+			MongoPassword,
+			resource.GetPort("27017/tcp"),
+		)))
+		if err != nil {
+			return err
+		}
+
+		return client.Ping(context.Background(), nil)
+	}); err != nil {
+		purge()
+		return nil, nil, errors.Wrap(err, "connecting to MongoDB")
+	}
+
+	return client.Database(MongoDB), purge, nil
+}
@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"github.com/pkg/errors"
+)
+
+// NewPostgreSQL runs PostgreSQL inside a docker container, creates a schema from init.sql in it and connects to it.
+// Purge should be called when tests are done to kill and remove the container.
+func NewPostgreSQL() (db *sqlx.DB, purge func() error, err error) {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "connecting to docker")
+	}
+
+	// init.sql lies next to this file, whichever package tests are run from.
+	_, file, _, _ := runtime.Caller(0)
+	opts := dockertest.RunOptions{
+		Repository: "postgres",
+		Tag:        "12.3",
+		Env: []string{
+			"POSTGRES_USER=" + PgUser,
+			"POSTGRES_PASSWORD=" + PgPassword,
+			"POSTGRES_DB=" + PgDB,
+		},
+		ExposedPorts: []string{"5432"},
+		PortBindings: map[docker.Port][]docker.PortBinding{
+			"5432": {
+				{HostIP: "0.0.0.0", HostPort: PgPort},
+			},
+		},
+		Mounts: []string{filepath.Dir(file) + ":/docker-entrypoint-initdb.d/"},
+	}
+
+	resource, err := pool.RunWithOptions(&opts)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "starting resource")
+	}
+	purge = func() error {
+		return pool.Purge(resource)
+	}
+
+	if err = pool.Retry(func() error {
+		db, err = sqlx.Connect("postgres", fmt.Sprintf(
+			"postgres://%s:%s@localhost:%s/%s?sslmode=disable",
+			PgUser,
+			PgPassword,
+			resource.GetPort("5432/tcp"),
+			PgDB,
+		))
+		if err != nil {
+			return err
+		}
+
+		return db.Ping()
+	}); err != nil {
+		purge()
+		return nil, nil, errors.Wrap(err, "connecting to PostgreSQL")
+	}
+
+	return db, purge, nil
+}
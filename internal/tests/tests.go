@@ -30,9 +30,3 @@ func StrPtr(s string) *string {
 func IntPtr(i int) *int {
 	return &i
 }
-
-// StrPtr is a helper functions for tests
-// that helps with updating float32 pointer fields on entities.
-func Float32Ptr(f float32) *float32 {
-	return &f
-}
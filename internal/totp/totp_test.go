@@ -0,0 +1,88 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+func TestTOTP(t *testing.T) {
+	// Secret and expected codes from RFC 6238 appendix B (SHA1), truncated to 6 digits.
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	t.Run("Given the need to generate codes compatible with RFC 6238", func(t *testing.T) {
+		tt := []struct {
+			unix int64
+			code string
+		}{
+			{unix: 59, code: "287082"},
+			{unix: 1111111109, code: "081804"},
+			{unix: 1111111111, code: "050471"},
+			{unix: 1234567890, code: "005924"},
+			{unix: 2000000000, code: "279037"},
+			{unix: 20000000000, code: "353130"},
+		}
+		for testID, tc := range tt {
+			code, err := Code(secret, Step(time.Unix(tc.unix, 0)))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a code. Error: %s", tests.Failed, testID, err)
+			}
+			if code != tc.code {
+				t.Fatalf("\t%s\tTest %d:\tWant code: %s, got: %s", tests.Failed, testID, tc.code, code)
+			}
+			t.Logf("\t%s\tTest %d:\tWant code: %s, got: %s", tests.Success, testID, tc.code, code)
+		}
+	})
+
+	t.Run("Given the need to validate codes", func(t *testing.T) {
+		now := time.Unix(1111111111, 0)
+		tt := []struct {
+			testName string
+			at       time.Time
+			code     string
+			valid    bool
+		}{
+			{testName: "code of current period", at: now, code: "050471", valid: true},
+			{testName: "code of previous period", at: now.Add(Period), code: "050471", valid: true},
+			{testName: "code of too old period", at: now.Add(3 * Period), code: "050471", valid: false},
+			{testName: "wrong code", at: now, code: "123456", valid: false},
+			{testName: "code of wrong length", at: now, code: "0504", valid: false},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				step, ok := Validate(secret, tc.code, tc.at)
+				if ok != tc.valid {
+					t.Fatalf("\t%s\tTest %d:\tWant valid: %v, got: %v", tests.Failed, testID, tc.valid, ok)
+				}
+				if ok && step != Step(now) {
+					t.Fatalf("\t%s\tTest %d:\tWant step: %d, got: %d", tests.Failed, testID, Step(now), step)
+				}
+				t.Logf("\t%s\tTest %d:\tShould validate a code.", tests.Success, testID)
+			})
+		}
+	})
+
+	t.Run("Given the need to enroll an authenticator app", func(t *testing.T) {
+		generated, err := GenerateSecret()
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to generate a secret. Error: %s", tests.Failed, err)
+		}
+		code, err := Code(generated, Step(time.Now()))
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to generate a code of a generated secret. Error: %s", tests.Failed, err)
+		}
+		if _, ok := Validate(generated, code, time.Now()); !ok {
+			t.Fatalf("\t%s\tShould validate a code of a generated secret.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould validate a code of a generated secret.", tests.Success)
+
+		uri := URI("Shop", "admin", generated)
+		if !strings.HasPrefix(uri, "otpauth://totp/Shop:admin?") || !strings.Contains(uri, "secret="+generated) {
+			t.Fatalf("\t%s\tShould build a provisioning URI, got: %s", tests.Failed, uri)
+		}
+		t.Logf("\t%s\tShould build a provisioning URI.", tests.Success)
+	})
+}
@@ -4,122 +4,461 @@ import (
 	"context"
 	"encoding/json"
 	_ "expvar"
-	"fmt"
+	"flag"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
 	"github.com/pkg/errors"
 	"github.com/rtbe/clean-rest-api/delivery/web"
+	mid "github.com/rtbe/clean-rest-api/delivery/web/middlewares"
+	"github.com/rtbe/clean-rest-api/domain/entity"
 	"github.com/rtbe/clean-rest-api/domain/usecase"
 	"github.com/rtbe/clean-rest-api/internal/config"
 	"github.com/rtbe/clean-rest-api/internal/database"
 	"github.com/rtbe/clean-rest-api/internal/database/migrate"
+	"github.com/rtbe/clean-rest-api/internal/event"
+	"github.com/rtbe/clean-rest-api/internal/keys"
 	"github.com/rtbe/clean-rest-api/internal/logger"
+	"github.com/rtbe/clean-rest-api/internal/mail"
+	"github.com/rtbe/clean-rest-api/internal/oidc"
+	actiontoken "github.com/rtbe/clean-rest-api/repository/action_token"
+	apikey "github.com/rtbe/clean-rest-api/repository/api_key"
+	"github.com/rtbe/clean-rest-api/repository/audit"
 	"github.com/rtbe/clean-rest-api/repository/auth"
+	"github.com/rtbe/clean-rest-api/repository/idempotency"
+	"github.com/rtbe/clean-rest-api/repository/identity"
+	loginattempt "github.com/rtbe/clean-rest-api/repository/login_attempt"
+	oidclogin "github.com/rtbe/clean-rest-api/repository/oidc_login"
 	"github.com/rtbe/clean-rest-api/repository/order"
 	orderitem "github.com/rtbe/clean-rest-api/repository/order_item"
+	"github.com/rtbe/clean-rest-api/repository/outbox"
 	"github.com/rtbe/clean-rest-api/repository/product"
+	"github.com/rtbe/clean-rest-api/repository/session"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
+	twofactor "github.com/rtbe/clean-rest-api/repository/two_factor"
 	"github.com/rtbe/clean-rest-api/repository/user"
+	"github.com/rtbe/clean-rest-api/repository/webhook"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func main() {
-	logger := logger.NewZapLogger()
+	// Configuration is loaded before anything else, since a logger is configured by it as well.
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("error loading .env file")
+	}
+	cfg := config.New()
+
+	l, err := newLogger(cfg)
+	if err != nil {
+		log.Fatalf("error creating logger: %v", err)
+	}
 
-	if err := run(logger, os.Args[1:]); err != nil {
+	if err := run(l, cfg, os.Args[1:]); err != nil {
 		// os.Exit(1) will be impliciyly executed.
-		logger.Log("fatal", err.Error())
+		l.Fatal("server failed", logger.Err(err))
 	}
 }
 
-func run(logger logger.Logger, args []string) error {
-	logger.Log("info", "main      : server starting...")
-
-	if err := godotenv.Load(); err != nil {
-		return errors.New("error loading .env file")
+// newLogger creates a logger of a level and a format from configuration.
+func newLogger(cfg *config.Cfg) (logger.Logger, error) {
+	level, err := logger.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
 	}
 
-	// Set up application configuration.
-	cfg := config.New()
+	return logger.NewZapLogger(logger.Config{
+		Format: cfg.LogFormat,
+		Level:  level,
+	})
+}
+
+func run(l logger.Logger, cfg *config.Cfg, args []string) error {
+	l.Info("server starting")
+
 	cfgJSON, err := json.Marshal(cfg)
 	if err != nil {
 		return errors.Wrap(err, "error marshalling config")
 	}
-	logger.Log("info", fmt.Sprintf("config    : %s", cfgJSON))
+	l.Debug("config loaded", logger.String("config", string(cfgJSON)))
 
-	// Initialize connections to databases.
-	postgreConfig := database.PostgreConfig{
-		User:     cfg.DbUser,
-		Password: cfg.DbPassword,
-		Host:     cfg.DbHost,
+	// Repositories are kept in PostgreSQL and MongoDB unless an application runs with --storage=memory,
+	// then everything is kept in-process and lost on restart, which suits development and tests.
+	flags := flag.NewFlagSet("clean-rest-api", flag.ContinueOnError)
+	storage := flags.String("storage", "postgres", "where to keep data: postgres or memory")
+	if err := flags.Parse(args); err != nil {
+		return errors.Wrap(err, "parsing flags")
 	}
 
-	logger.Log("info", "db        : establishing connection to PostgreSQL")
-	postgreDB, err := database.NewPostgreSQL(postgreConfig)
+	// Failed sign in attempts are kept only within a window they are counted in.
+	loginFailureWindow, err := time.ParseDuration(cfg.LoginFailureWindow)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "parsing failed sign in attempts window")
 	}
-	logger.Log("info", "db        : connection to PostgreSQL has been established")
-	defer func() {
-		if err := postgreDB.Close(); err == nil {
-			logger.Log("info", "main      : database disconnected")
+
+	var repos repositories
+	switch *storage {
+	case "postgres":
+		// Initialize connections to databases.
+		postgreConfig := database.PostgreConfig{
+			User:     cfg.DbUser,
+			Password: cfg.DbPassword,
+			Host:     cfg.DbHost,
 		}
-	}()
-	// Run database migrations.
-	logger.Log("info", "db        : running migrations")
-	err = migrate.Do(postgreDB)
+
+		l.Info("connecting to database", logger.String("database", "postgres"))
+		postgreDB, err := database.NewPostgreSQL(postgreConfig)
+		if err != nil {
+			return err
+		}
+		l.Info("database connected", logger.String("database", "postgres"))
+		defer func() {
+			if err := postgreDB.Close(); err == nil {
+				l.Info("database disconnected", logger.String("database", "postgres"))
+			}
+		}()
+		// Run database migrations.
+		l.Info("running migrations")
+		err = migrate.Do(postgreDB)
+		if err != nil {
+			return err
+		}
+
+		mongoConfig := database.MongoConfig{
+			User:     cfg.AuthDbUser,
+			Password: cfg.AuthDbPassword,
+			Host:     cfg.AuthDbHost,
+			Name:     cfg.AuthDBName,
+		}
+		l.Info("connecting to database", logger.String("database", "mongo"))
+		mongoDB, err := database.NewMongo(mongoConfig)
+		if err != nil {
+			return err
+		}
+		l.Info("database connected", logger.String("database", "mongo"))
+		defer func() {
+			if err := mongoDB.Client().Disconnect(context.Background()); err == nil {
+				l.Info("database disconnected", logger.String("database", "mongo"))
+			}
+		}()
+
+		l.Info("creating indexes", logger.String("database", "mongo"))
+		if err := createMongoIndexes(context.Background(), mongoDB, loginFailureWindow); err != nil {
+			return err
+		}
+
+		repos = newPostgreRepositories(postgreDB, mongoDB, l)
+	case "memory":
+		l.Warn("data is kept in memory and will be lost on shutdown")
+		repos = newInMemRepositories()
+	default:
+		return errors.Errorf("unknown storage %q, want postgres or memory", *storage)
+	}
+
+	taxRate, err := strconv.Atoi(cfg.TaxRate)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "parsing tax rate")
 	}
 
-	mongoConfig := database.MongoConfig{
-		User:     cfg.AuthDbUser,
-		Password: cfg.AuthDbPassword,
-		Host:     cfg.AuthDbHost,
-		Name:     cfg.AuthDBName,
+	if cfg.JWTKeys != "" {
+		signingKeys, err := keys.Load(cfg.JWTKeys, cfg.JWTSigningKeyID)
+		if err != nil {
+			return errors.Wrap(err, "loading JWT signing keys")
+		}
+		entity.SetSigningKeys(signingKeys)
 	}
-	logger.Log("info", "auth db   : establishing connection to MongoDB")
-	mongoDB, err := database.NewMongo(mongoConfig)
+
+	rolePermissions, err := entity.ParseRolePermissions(cfg.RolePermissions)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "parsing role permissions")
+	}
+
+	requireEmailVerification, err := strconv.ParseBool(cfg.RequireEmailVerification)
+	if err != nil {
+		return errors.Wrap(err, "parsing email verification requirement")
+	}
+	passwordResetTTL, err := time.ParseDuration(cfg.PasswordResetTTL)
+	if err != nil {
+		return errors.Wrap(err, "parsing password reset token TTL")
+	}
+	emailVerificationTTL, err := time.ParseDuration(cfg.EmailVerificationTTL)
+	if err != nil {
+		return errors.Wrap(err, "parsing email verification token TTL")
+	}
+	twoFactorChallengeTTL, err := time.ParseDuration(cfg.TwoFactorChallengeTTL)
+	if err != nil {
+		return errors.Wrap(err, "parsing two-factor challenge TTL")
+	}
+
+	loginMaxFailures, err := strconv.Atoi(cfg.LoginMaxFailures)
+	if err != nil {
+		return errors.Wrap(err, "parsing max failed sign in attempts")
+	}
+	loginIPMaxFailures, err := strconv.Atoi(cfg.LoginIPMaxFailures)
+	if err != nil {
+		return errors.Wrap(err, "parsing max failed sign in attempts from IP address")
+	}
+	loginBackoff, err := time.ParseDuration(cfg.LoginBackoff)
+	if err != nil {
+		return errors.Wrap(err, "parsing sign in backoff")
+	}
+	loginLockout, err := time.ParseDuration(cfg.LoginLockout)
+	if err != nil {
+		return errors.Wrap(err, "parsing sign in lockout")
+	}
+
+	defaultRate, err := mid.ParseRate(cfg.RateLimit)
+	if err != nil {
+		return errors.Wrap(err, "parsing rate limit")
+	}
+	routeRates, err := mid.ParseRouteRates(cfg.RouteRateLimits)
+	if err != nil {
+		return errors.Wrap(err, "parsing rate limits of routes")
+	}
+	ipRate, err := mid.ParseRate(cfg.IPRateLimit)
+	if err != nil {
+		return errors.Wrap(err, "parsing rate limit of IP addresses")
+	}
+
+	idempotencyTTL, err := time.ParseDuration(cfg.IdempotencyTTL)
+	if err != nil {
+		return errors.Wrap(err, "parsing idempotency key TTL")
+	}
+	idempotencyLockTimeout, err := time.ParseDuration(cfg.IdempotencyLockTimeout)
+	if err != nil {
+		return errors.Wrap(err, "parsing idempotency key lock timeout")
+	}
+
+	deletedRetention, err := time.ParseDuration(cfg.DeletedRetention)
+	if err != nil {
+		return errors.Wrap(err, "parsing retention of deleted items")
+	}
+	purgeInterval, err := time.ParseDuration(cfg.PurgeInterval)
+	if err != nil {
+		return errors.Wrap(err, "parsing purge interval")
+	}
+
+	eventsPollInterval, err := time.ParseDuration(cfg.EventsPollInterval)
+	if err != nil {
+		return errors.Wrap(err, "parsing events poll interval")
+	}
+	eventsRetryBackoff, err := time.ParseDuration(cfg.EventsRetryBackoff)
+	if err != nil {
+		return errors.Wrap(err, "parsing events retry backoff")
+	}
+	eventsRetryMaxDelay, err := time.ParseDuration(cfg.EventsRetryMaxDelay)
+	if err != nil {
+		return errors.Wrap(err, "parsing events retry max delay")
+	}
+
+	webhookMaxAttempts, err := strconv.Atoi(cfg.WebhookMaxAttempts)
+	if err != nil {
+		return errors.Wrap(err, "parsing webhook max attempts")
+	}
+	webhookTimeout, err := time.ParseDuration(cfg.WebhookTimeout)
+	if err != nil {
+		return errors.Wrap(err, "parsing webhook timeout")
 	}
-	logger.Log("info", "auth db   : connection to MongoDB has been established")
-	defer func() {
-		if err := mongoDB.Client().Disconnect(context.Background()); err == nil {
-			logger.Log("info", "main      : auth database disconnected")
+
+	oidcLoginTTL, err := time.ParseDuration(cfg.OIDCLoginTTL)
+	if err != nil {
+		return errors.Wrap(err, "parsing OIDC login TTL")
+	}
+
+	oidcProviders := make(map[string]*oidc.Provider, len(cfg.OIDCProviders))
+	for _, p := range cfg.OIDCProviders {
+		if p.IssuerURL == "" || p.ClientID == "" || p.RedirectURL == "" {
+			return errors.Errorf("identity provider %s: issuer, client id and redirect URL are required", p.Name)
 		}
-	}()
+
+		oidcProviders[p.Name] = oidc.NewProvider(oidc.Config{
+			IssuerURL:    p.IssuerURL,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       strings.Fields(p.Scopes),
+		}, nil)
+	}
+
+	// Emails are written into files if SMTP server is not configured.
+	var mailer mail.Mailer
+	if cfg.SMTPHost != "" {
+		mailer = mail.NewSMTPMailer(mail.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			User:     cfg.SMTPUser,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		})
+	} else {
+		l.Warn("SMTP is not configured, emails are written to files", logger.String("dir", cfg.MailDir))
+		mailer = mail.NewFileMailer(cfg.MailDir, cfg.MailFrom)
+	}
+
 	// Initialize application layers
-	userRepo := user.NewPostgreRepo(postgreDB, logger)
-	userService := usecase.NewUserService(userRepo)
+	const eventsBatchSize = 100
+	txManager := repos.tx
+
+	auditService := usecase.NewAuditService(repos.audit)
+
+	// Events are turned into deliveries to webhook subscriptions and, if it is configured, posted to a webhook.
+	webhookService := usecase.NewWebhookService(repos.webhook, txManager, usecase.WebhookConfig{
+		BatchSize:   eventsBatchSize,
+		RetryBase:   eventsRetryBackoff,
+		RetryMax:    eventsRetryMaxDelay,
+		MaxAttempts: webhookMaxAttempts,
+		Timeout:     webhookTimeout,
+	})
+	publishers := event.Publishers{webhookService}
+	if cfg.EventsWebhookURL != "" {
+		publishers = append(event.Publishers{event.NewWebhookPublisher(event.WebhookConfig{
+			URL:    cfg.EventsWebhookURL,
+			Secret: cfg.EventsWebhookSecret,
+		})}, publishers...)
+	}
+
+	userService := usecase.NewUserService(repos.user, repos.order, repos.orderItem, repos.outbox, txManager, auditService)
+
+	productService := usecase.NewProductService(repos.product, repos.outbox, txManager, auditService)
 
-	productRepo := product.NewPostgreRepo(postgreDB, logger)
-	productService := usecase.NewProductService(productRepo)
+	orderService := usecase.NewOrderService(repos.order, repos.orderItem, repos.product, repos.outbox, txManager, auditService, taxRate)
+	orderItemService := usecase.NewOrderItemService(repos.orderItem, repos.order, repos.product, repos.outbox, txManager, auditService, taxRate)
 
-	orderRepo := order.NewPostgreRepo(postgreDB, logger)
-	orderService := usecase.NewOrderService(orderRepo)
+	twoFactorService := usecase.NewTwoFactorService(repos.twoFactor, userService, cfg.TOTPIssuer)
+	authService := usecase.NewAuthService(repos.auth, repos.session, repos.actionToken, repos.loginAttempt, userService, twoFactorService, mailer, usecase.AuthConfig{
+		RequireVerifiedEmail:  requireEmailVerification,
+		PasswordResetTTL:      passwordResetTTL,
+		EmailVerificationTTL:  emailVerificationTTL,
+		TwoFactorChallengeTTL: twoFactorChallengeTTL,
+		UserNameThrottle: entity.LoginThrottle{
+			MaxFailures: loginMaxFailures,
+			BackoffBase: loginBackoff,
+			Lockout:     loginLockout,
+			Window:      loginFailureWindow,
+		},
+		IPThrottle: entity.LoginThrottle{
+			MaxFailures: loginIPMaxFailures,
+			BackoffBase: loginBackoff,
+			Lockout:     loginLockout,
+			Window:      loginFailureWindow,
+		},
+	})
+	sessionService := usecase.NewSessionService(repos.session, repos.auth)
 
-	orderItemRepo := orderitem.NewPostgreRepo(postgreDB, logger)
-	orderItemService := usecase.NewOrderItemService(orderItemRepo)
+	apiKeyService := usecase.NewAPIKeyService(repos.apiKey, userService)
 
-	authRepo := auth.NewMongoRepo(mongoDB, logger)
-	authService := usecase.NewAuthService(authRepo, userService)
+	oidcService := usecase.NewOIDCService(oidcProviders, repos.oidcLogin, repos.identity, userService, authService, oidcLoginTTL)
 
 	services := usecase.Services{
 		User:      userService,
 		Product:   productService,
 		Order:     orderService,
 		OrderItem: orderItemService,
+		Audit:     auditService,
+		Webhook:   webhookService,
 		Auth:      authService,
+		APIKey:    apiKeyService,
+		OIDC:      oidcService,
+		Session:   sessionService,
+		TwoFactor: twoFactorService,
 	}
 
+	// Deleted items are purged in background once their retention period is over,
+	// and so are expired idempotency keys.
+	if purgeInterval > 0 {
+		purgeService := usecase.NewPurgeService(repos.user, repos.product, repos.order, repos.orderItem, repos.idempotency, deletedRetention)
+		go func() {
+			ticker := time.NewTicker(purgeInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				n, err := purgeService.Purge(context.Background())
+				if err != nil {
+					l.Error("purging deleted items and expired idempotency keys", logger.Err(err))
+					continue
+				}
+				if n > 0 {
+					l.Info("deleted items and expired idempotency keys purged", logger.Int64("count", n))
+				}
+			}
+		}()
+	}
+
+	// Domain events written into outbox are published in background.
+	outboxRelay := usecase.NewOutboxRelay(repos.outbox, txManager, publishers, usecase.OutboxRelayConfig{
+		BatchSize: eventsBatchSize,
+		RetryBase: eventsRetryBackoff,
+		RetryMax:  eventsRetryMaxDelay,
+	})
+	go func() {
+		ticker := time.NewTicker(eventsPollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			// Keep relaying while there are full batches of events.
+			for {
+				published, failed, err := outboxRelay.Relay(context.Background())
+				if err != nil {
+					l.Error("relaying events", logger.Err(err))
+					break
+				}
+				if failed > 0 {
+					l.Warn("events failed to publish and will be retried", logger.Int("count", failed))
+				}
+				if published+failed < eventsBatchSize {
+					break
+				}
+			}
+		}
+	}()
+
+	// Deliveries to webhook subscriptions are posted in background.
+	go func() {
+		ticker := time.NewTicker(eventsPollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			// Keep delivering while there are full batches of deliveries.
+			for {
+				delivered, failed, err := webhookService.Deliver(context.Background())
+				if err != nil {
+					l.Error("delivering webhooks", logger.Err(err))
+					break
+				}
+				if failed > 0 {
+					l.Warn("webhook deliveries failed", logger.Int("count", failed))
+				}
+				if delivered+failed < eventsBatchSize {
+					break
+				}
+			}
+		}
+	}()
+
 	//===============================================Init application server========================================
-	app := web.NewApp(services, logger)
+	// Buckets of clients are kept in-process, so limits hold per instance of an application.
+	rateLimits := mid.RateLimits{
+		Store:   mid.NewMemoryRateLimitStore(),
+		Default: defaultRate,
+		Routes:  routeRates,
+		IP:      ipRate,
+	}
+
+	idempotencyConfig := mid.IdempotencyConfig{
+		Store:       repos.idempotency,
+		TTL:         idempotencyTTL,
+		LockTimeout: idempotencyLockTimeout,
+	}
+
+	app := web.NewApp(services, rolePermissions, rateLimits, idempotencyConfig, l)
 
 	// Configure application server.
 	appServer := &http.Server{
@@ -138,14 +477,10 @@ func run(logger logger.Logger, args []string) error {
 		WriteTimeout: 5 * time.Second,
 	}
 	go func() {
-		logger.Log("info", fmt.Sprintf(
-			"main      : pprof and documentation server listening on port %s",
-			cfg.APIPort,
-		))
+		l.Info("pprof and documentation server listening", logger.String("addr", pprofServer.Addr))
 
 		if err := pprofServer.ListenAndServe(); err != nil {
-			log.Printf("error serving debug/pprof: %v ", err)
-			os.Exit(1)
+			l.Fatal("serving debug/pprof", logger.Err(err))
 		}
 	}()
 
@@ -155,10 +490,7 @@ func run(logger logger.Logger, args []string) error {
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
-		logger.Log("info", fmt.Sprintf(
-			"main      : server listening on port %s",
-			cfg.APIPort,
-		))
+		l.Info("server listening", logger.String("port", cfg.APIPort))
 
 		serverErrors <- appServer.ListenAndServe()
 	}()
@@ -169,10 +501,7 @@ func run(logger logger.Logger, args []string) error {
 		return errors.Wrap(err, "server error")
 
 	case sig := <-shutdown:
-		logger.Log("info", fmt.Sprintf(
-			"main      : %v: start shutdown",
-			sig,
-		))
+		l.Info("shutdown started", logger.String("signal", sig.String()))
 
 		// Give 30 seconds to shut down, then shut down forcefully.
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -187,3 +516,84 @@ func run(logger logger.Logger, args []string) error {
 	}
 	return nil
 }
+
+// repositories are adapters application layers keep their data in.
+type repositories struct {
+	tx           transaction.Manager
+	user         user.Repository
+	product      product.Repository
+	order        order.Repository
+	orderItem    orderitem.Repository
+	audit        audit.Repository
+	outbox       outbox.Repository
+	webhook      webhook.Repository
+	auth         auth.Repository
+	session      session.Repository
+	actionToken  actiontoken.Repository
+	loginAttempt loginattempt.Repository
+	twoFactor    twofactor.Repository
+	apiKey       apikey.Repository
+	oidcLogin    oidclogin.Repository
+	identity     identity.Repository
+	idempotency  idempotency.Repository
+}
+
+// newPostgreRepositories creates repositories that keep data in PostgreSQL and auth data in MongoDB.
+func newPostgreRepositories(postgreDB *sqlx.DB, mongoDB *mongo.Database, l logger.Logger) repositories {
+	return repositories{
+		tx:           transaction.NewPostgreManager(postgreDB, l),
+		user:         user.NewPostgreRepo(postgreDB, l),
+		product:      product.NewPostgreRepo(postgreDB, l),
+		order:        order.NewPostgreRepo(postgreDB, l),
+		orderItem:    orderitem.NewPostgreRepo(postgreDB, l),
+		audit:        audit.NewPostgreRepo(postgreDB, l),
+		outbox:       outbox.NewPostgreRepo(postgreDB, l),
+		webhook:      webhook.NewPostgreRepo(postgreDB, l),
+		auth:         auth.NewMongoRepo(mongoDB, l),
+		session:      session.NewMongoRepo(mongoDB, l),
+		actionToken:  actiontoken.NewMongoRepo(mongoDB, l),
+		loginAttempt: loginattempt.NewMongoRepo(mongoDB, l),
+		twoFactor:    twofactor.NewMongoRepo(mongoDB, l),
+		apiKey:       apikey.NewPostgreRepo(postgreDB, l),
+		oidcLogin:    oidclogin.NewMongoRepo(mongoDB, l),
+		identity:     identity.NewPostgreRepo(postgreDB, l),
+		idempotency:  idempotency.NewPostgreRepo(postgreDB, l),
+	}
+}
+
+// createMongoIndexes creates indexes of MongoDB collections, e.g. TTL ones that remove stale documents.
+// loginWindow is a window failed sign in attempts are counted in.
+func createMongoIndexes(ctx context.Context, mongoDB *mongo.Database, loginWindow time.Duration) error {
+	if err := loginattempt.NewMongoRepo(mongoDB, nil).CreateIndexes(ctx, loginWindow); err != nil {
+		return err
+	}
+
+	return session.NewMongoRepo(mongoDB, nil).CreateIndexes(ctx)
+}
+
+// newInMemRepositories creates repositories that keep data in-process.
+// Transactions are run one at a time and changes of failed ones are undone, see transaction.InMem.
+func newInMemRepositories() repositories {
+	orderRepo := order.NewInMemRepo()
+	orderItemRepo := orderitem.NewInMemRepo(orderRepo)
+
+	return repositories{
+		tx:           transaction.NewInMemManager(),
+		user:         user.NewInMemRepo(orderRepo),
+		product:      product.NewInMemRepo(orderItemRepo),
+		order:        orderRepo,
+		orderItem:    orderItemRepo,
+		audit:        audit.NewInMemRepo(),
+		outbox:       outbox.NewInMemRepo(),
+		webhook:      webhook.NewInMemRepo(),
+		auth:         auth.NewInMemRepo(),
+		session:      session.NewInMemRepo(),
+		actionToken:  actiontoken.NewInMemRepo(),
+		loginAttempt: loginattempt.NewInMemRepo(),
+		twoFactor:    twofactor.NewInMemRepo(),
+		apiKey:       apikey.NewInMemRepo(),
+		oidcLogin:    oidclogin.NewInMemRepo(),
+		identity:     identity.NewInMemRepo(),
+		idempotency:  idempotency.NewInMemRepo(),
+	}
+}
@@ -0,0 +1,18 @@
+// Package actiontoken is responsible for managing information about single-use action tokens in database-agnostic way.
+// This package defines repository interface for abstracting interaction with particular database.
+package actiontoken
+
+import (
+	"context"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+)
+
+// Repository is an interface that represents persistent storage abstraction.
+// This is a port in hexagonal architecture terms,
+// so concrete implementation of database should implements the set of these methods.
+type Repository interface {
+	Create(ctx context.Context, token entity.ActionToken) error
+	MarkUsed(ctx context.Context, id string) (entity.ActionToken, error)
+	DeleteByUserID(ctx context.Context, userID string, purpose entity.TokenPurpose) error
+}
@@ -0,0 +1,67 @@
+package actiontoken
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+)
+
+// InMemRepo is an abstraction layer that manages action token entities inside basic in-memory store (map+RWMutex).
+// It suits a single instance of an application, action tokens are lost on restart.
+type InMemRepo struct {
+	store map[string]entity.ActionToken
+	sync.RWMutex
+}
+
+// NewInMemRepo creates a new in-memory repository for action token entity.
+func NewInMemRepo() *InMemRepo {
+	return &InMemRepo{
+		store: make(map[string]entity.ActionToken),
+	}
+}
+
+// Create saves a new action token inside in-memory store.
+func (r *InMemRepo) Create(ctx context.Context, t entity.ActionToken) error {
+	r.Lock()
+	defer r.Unlock()
+
+	t.Token = ""
+	r.store[t.UUID] = t
+
+	return nil
+}
+
+// MarkUsed marks action token with given id as used
+// and returns it as it was before an update,
+// so a caller can find out whether the token was already used.
+func (r *InMemRepo) MarkUsed(ctx context.Context, id string) (entity.ActionToken, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	t, ok := r.store[id]
+	if !ok {
+		return entity.ActionToken{}, database.ErrNotFound
+	}
+
+	used := t
+	used.Used = true
+	r.store[id] = used
+
+	return t, nil
+}
+
+// DeleteByUserID deletes all action tokens of particular user with given purpose from in-memory store.
+func (r *InMemRepo) DeleteByUserID(ctx context.Context, userID string, purpose entity.TokenPurpose) error {
+	r.Lock()
+	defer r.Unlock()
+
+	for id, t := range r.store {
+		if t.UserID == userID && t.Purpose == purpose {
+			delete(r.store, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package actiontoken
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Mongo is an abstraction layer that manages action token entities inside MongoDB.
+type Mongo struct {
+	db *mongo.Collection
+	logger.Logger
+}
+
+// NewMongoRepo creates a new MongoDB repository for action token entity
+func NewMongoRepo(db *mongo.Database, l logger.Logger) *Mongo {
+	coll := "action_tokens"
+
+	return &Mongo{
+		db.Collection(coll),
+		l,
+	}
+}
+
+// Create saves a new action token inside mongoDB.
+func (r *Mongo) Create(ctx context.Context, t entity.ActionToken) error {
+	if _, err := r.db.InsertOne(ctx, t); err != nil {
+		return errors.Wrap(err, "inserting action token into mongoDB")
+	}
+
+	return nil
+}
+
+// MarkUsed marks action token with given id as used
+// and returns it as it was before an update,
+// so a caller can find out whether the token was already used.
+func (r *Mongo) MarkUsed(ctx context.Context, id string) (entity.ActionToken, error) {
+	var t entity.ActionToken
+
+	err := r.db.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"used": true}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&t)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return entity.ActionToken{}, database.ErrNotFound
+		}
+		return entity.ActionToken{}, errors.Wrapf(err, "marking action token %s as used", id)
+	}
+
+	return t, nil
+}
+
+// DeleteByUserID deletes all action tokens of particular user issued for given action from mongoDB.
+func (r *Mongo) DeleteByUserID(ctx context.Context, userID string, purpose entity.TokenPurpose) error {
+	if _, err := r.db.DeleteMany(ctx, bson.M{"user_id": userID, "purpose": purpose}); err != nil {
+		return errors.Wrapf(err, "deleting %s tokens of user %s", purpose, userID)
+	}
+
+	return nil
+}
@@ -0,0 +1,21 @@
+// Package apikey is responsible for managing information about API keys of users in database-agnostic way.
+// This package defines repository interface for abstracting interaction with particular database.
+package apikey
+
+import (
+	"context"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+)
+
+// Repository is an interface that represents persistent storage abstraction.
+// This is a port in hexagonal architecture terms,
+// so concrete implementation of database should implements the set of these methods.
+type Repository interface {
+	Create(ctx context.Context, key entity.APIKey) error
+	QueryByUserID(ctx context.Context, userID string) ([]entity.APIKey, error)
+	QueryByHash(ctx context.Context, hash string) (entity.APIKey, error)
+	Touch(ctx context.Context, id string, lastUsed time.Time) error
+	Delete(ctx context.Context, userID, id string) error
+}
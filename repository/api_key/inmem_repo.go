@@ -0,0 +1,103 @@
+package apikey
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+)
+
+// InMemRepo is an abstraction layer that manages API key entities inside basic in-memory store (map+RWMutex).
+// It suits a single instance of an application, API keys are lost on restart.
+type InMemRepo struct {
+	store map[string]entity.APIKey
+	sync.RWMutex
+}
+
+// NewInMemRepo creates a new in-memory repository for APIKey entity.
+func NewInMemRepo() *InMemRepo {
+	return &InMemRepo{
+		store: make(map[string]entity.APIKey),
+	}
+}
+
+// Create saves a new API key in in-memory store.
+func (r *InMemRepo) Create(ctx context.Context, k entity.APIKey) error {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, existing := range r.store {
+		if existing.ID == k.ID || existing.Hash == k.Hash {
+			return errors.Wrap(database.ErrDuplicate, "inserting an API key")
+		}
+	}
+	r.store[k.ID] = k
+
+	return nil
+}
+
+// QueryByUserID gets all API keys of particular user from in-memory store, newest first.
+func (r *InMemRepo) QueryByUserID(ctx context.Context, userID string) ([]entity.APIKey, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	keys := []entity.APIKey{}
+	for _, k := range r.store {
+		if k.UserID == userID {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].DateCreated.After(keys[j].DateCreated)
+	})
+
+	return keys, nil
+}
+
+// QueryByHash gets an API key from in-memory store by a hash of it.
+func (r *InMemRepo) QueryByHash(ctx context.Context, hash string) (entity.APIKey, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, k := range r.store {
+		if k.Hash == hash {
+			return k, nil
+		}
+	}
+
+	return entity.APIKey{}, errors.Wrap(database.ErrNotFound, "getting an API key by hash")
+}
+
+// Touch updates time an API key was last used at.
+func (r *InMemRepo) Touch(ctx context.Context, id string, lastUsed time.Time) error {
+	r.Lock()
+	defer r.Unlock()
+
+	k, ok := r.store[id]
+	if !ok {
+		return nil
+	}
+
+	k.LastUsed = &lastUsed
+	r.store[id] = k
+
+	return nil
+}
+
+// Delete deletes an API key of particular user from in-memory store.
+func (r *InMemRepo) Delete(ctx context.Context, userID, id string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	k, ok := r.store[id]
+	if !ok || k.UserID != userID {
+		return errors.Wrapf(database.ErrNotFound, "API key %s", id)
+	}
+	delete(r.store, id)
+
+	return nil
+}
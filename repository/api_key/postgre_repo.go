@@ -0,0 +1,150 @@
+package apikey
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+)
+
+// Postgre is an abstraction layer that manages API key entities inside PostgreSQL DB.
+type Postgre struct {
+	db  *sqlx.DB
+	log logger.Logger
+}
+
+// NewPostgreRepo creates a new PostgreSQL repository for APIKey entity.
+func NewPostgreRepo(db *sqlx.DB, l logger.Logger) *Postgre {
+	return &Postgre{
+		db:  db,
+		log: l,
+	}
+}
+
+// Create saves a new API key in PostgreSQL.
+func (r *Postgre) Create(ctx context.Context, k entity.APIKey) error {
+	const q = `
+	INSERT INTO api_keys
+		(api_key_id, user_id, name, prefix, key_hash, scopes, expires_at, last_used, date_created)
+	VALUES
+		(:api_key_id, :user_id, :name, :prefix, :key_hash, :scopes, :expires_at, :last_used, :date_created)`
+
+	if _, err := database.NamedExec(ctx, r.db, q, k); err != nil {
+		return errors.Wrap(err, "inserting an API key")
+	}
+
+	return nil
+}
+
+// QueryByUserID gets all API keys of particular user from PostgreSQL, newest first.
+func (r *Postgre) QueryByUserID(ctx context.Context, userID string) ([]entity.APIKey, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		api_keys
+	WHERE
+		user_id = :user_id
+	ORDER BY
+		date_created DESC`
+
+	data := struct {
+		UserID string `db:"user_id"`
+	}{
+		UserID: userID,
+	}
+
+	keys := []entity.APIKey{}
+
+	if err := database.QuerySlice(ctx, r.db, q, data, &keys); err != nil {
+		return nil, errors.Wrapf(err, "getting API keys of user %s", userID)
+	}
+
+	return keys, nil
+}
+
+// QueryByHash gets an API key from PostgreSQL by a hash of it.
+func (r *Postgre) QueryByHash(ctx context.Context, hash string) (entity.APIKey, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		api_keys
+	WHERE
+		key_hash = :key_hash`
+
+	data := struct {
+		Hash string `db:"key_hash"`
+	}{
+		Hash: hash,
+	}
+
+	var k entity.APIKey
+
+	if err := database.QueryStruct(ctx, r.db, q, data, &k); err != nil {
+		return entity.APIKey{}, errors.Wrap(err, "getting an API key by hash")
+	}
+
+	return k, nil
+}
+
+// Touch updates time an API key was last used at.
+func (r *Postgre) Touch(ctx context.Context, id string, lastUsed time.Time) error {
+	const q = `
+	UPDATE
+		api_keys
+	SET
+		"last_used" = :last_used
+	WHERE
+		api_key_id = :api_key_id`
+
+	data := struct {
+		ID       string    `db:"api_key_id"`
+		LastUsed time.Time `db:"last_used"`
+	}{
+		ID:       id,
+		LastUsed: lastUsed,
+	}
+
+	if _, err := database.NamedExec(ctx, r.db, q, data); err != nil {
+		return errors.Wrapf(err, "updating last use of an API key with id %s", id)
+	}
+
+	return nil
+}
+
+// Delete deletes an API key of particular user from PostgreSQL.
+func (r *Postgre) Delete(ctx context.Context, userID, id string) error {
+	const q = `
+	DELETE FROM
+		api_keys
+	WHERE
+		api_key_id = :api_key_id AND user_id = :user_id`
+
+	data := struct {
+		ID     string `db:"api_key_id"`
+		UserID string `db:"user_id"`
+	}{
+		ID:     id,
+		UserID: userID,
+	}
+
+	res, err := database.NamedExec(ctx, r.db, q, data)
+	if err != nil {
+		return errors.Wrapf(err, "deleting an API key with id %s", id)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "deleting an API key with id %s", id)
+	}
+	if n == 0 {
+		return errors.Wrapf(database.ErrNotFound, "API key %s", id)
+	}
+
+	return nil
+}
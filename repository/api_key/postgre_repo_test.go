@@ -0,0 +1,157 @@
+package apikey
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+	"github.com/rtbe/clean-rest-api/repository/user"
+)
+
+var pgAPIKeyRepo *Postgre
+var pgUserRepo *user.Postgre
+var validUser entity.User
+
+func TestMain(m *testing.M) {
+	db, purge, err := tests.NewPostgreSQL()
+	if err != nil {
+		log.Fatalf("could not start PostgreSQL: %s", err)
+	}
+
+	// Init global package dependencies after successfull connection to a database
+	pgAPIKeyRepo = NewPostgreRepo(db, nil)
+	pgUserRepo = user.NewPostgreRepo(db, nil)
+
+	newUser := entity.NewUser{
+		UserName:        "AlanKay",
+		FirstName:       "Alan",
+		LastName:        "Kay",
+		Password:        "OOP_is_about_messages",
+		PasswordConfirm: "OOP_is_about_messages",
+		Email:           "AlanKay@zeroxparc.com",
+		Roles:           []string{"user"},
+		EmailVerified:   true,
+	}
+	validUser, err = pgUserRepo.Create(context.Background(), newUser)
+	if err != nil {
+		log.Fatalf("could not prepare test data: %s", err)
+	}
+
+	code := m.Run()
+
+	// When you're done, kill and remove the container
+	if err = purge(); err != nil {
+		log.Fatalf("could not purge resource: %s", err)
+	}
+
+	os.Exit(code)
+}
+
+func TestPostgre(t *testing.T) {
+	var validKey entity.APIKey
+
+	t.Run("Given the need to create an API key inside PostgreSQL", func(t *testing.T) {
+		key, hash, err := entity.GenerateAPIKey()
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to generate an API key. Error: %s", tests.Failed, err)
+		}
+
+		validKey = entity.APIKey{
+			ID:          "6a9a3f1e-3b7c-4c55-9d6e-0f1b2c3d4e5f",
+			UserID:      validUser.ID,
+			Name:        "Nightly export",
+			Prefix:      entity.APIKeyPrefix(key),
+			Hash:        hash,
+			Scopes:      []string{"order:read:own"},
+			ExpiresAt:   time.Now().Add(time.Hour).UTC().Truncate(time.Microsecond),
+			DateCreated: time.Now().UTC().Truncate(time.Microsecond),
+		}
+		if err := pgAPIKeyRepo.Create(context.Background(), validKey); err != nil {
+			t.Fatalf("\t%s\tShould be able to create an API key. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to create an API key.", tests.Success)
+	})
+
+	t.Run("Given the need to get an API key by it`s hash from PostgreSQL", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			hash     string
+			valid    bool
+		}{
+			{testName: "Existing API key", hash: validKey.Hash, valid: true},
+			{testName: "Unknown API key", hash: entity.HashAPIKey("unknown"), valid: false},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				k, err := pgAPIKeyRepo.QueryByHash(context.Background(), tc.hash)
+				if !tc.valid {
+					if errors.Cause(err) != database.ErrNotFound {
+						t.Fatalf("\t%s\tTest %d:\tWant not found error, got: %v", tests.Failed, testID, err)
+					}
+					t.Logf("\t%s\tTest %d:\tWant not found error.", tests.Success, testID)
+					return
+				}
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to get an API key. Error: %s", tests.Failed, testID, err)
+				}
+
+				if k.ID != validKey.ID || k.UserID != validUser.ID || len(k.Scopes) != 1 || k.Scopes[0] != "order:read:own" {
+					t.Fatalf("\t%s\tTest %d:\tWant API key: %+v, got: %+v", tests.Failed, testID, validKey, k)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get saved API key.", tests.Success, testID)
+
+				if k.LastUsed != nil {
+					t.Fatalf("\t%s\tTest %d:\tWant API key that was never used, got last used: %v", tests.Failed, testID, k.LastUsed)
+				}
+				t.Logf("\t%s\tTest %d:\tWant API key that was never used.", tests.Success, testID)
+			})
+		}
+	})
+
+	t.Run("Given the need to remember last use of an API key", func(t *testing.T) {
+		lastUsed := time.Now().UTC().Truncate(time.Microsecond)
+		if err := pgAPIKeyRepo.Touch(context.Background(), validKey.ID, lastUsed); err != nil {
+			t.Fatalf("\t%s\tShould be able to update last use of an API key. Error: %s", tests.Failed, err)
+		}
+
+		keys, err := pgAPIKeyRepo.QueryByUserID(context.Background(), validUser.ID)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to get API keys of a user. Error: %s", tests.Failed, err)
+		}
+
+		if len(keys) != 1 || keys[0].LastUsed == nil || !keys[0].LastUsed.Equal(lastUsed) {
+			t.Fatalf("\t%s\tWant API key last used at %v, got: %+v", tests.Failed, lastUsed, keys)
+		}
+		t.Logf("\t%s\tWant API key last used at %v.", tests.Success, lastUsed)
+	})
+
+	t.Run("Given the need to delete an API key from PostgreSQL", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			userID   string
+			valid    bool
+		}{
+			{testName: "API key of other user", userID: "3f2504e0-4f89-11d3-9a0c-0305e82c3301", valid: false},
+			{testName: "API key of a user", userID: validUser.ID, valid: true},
+			{testName: "Deleted API key", userID: validUser.ID, valid: false},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				err := pgAPIKeyRepo.Delete(context.Background(), tc.userID, validKey.ID)
+				if tc.valid && err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to delete an API key. Error: %s", tests.Failed, testID, err)
+				}
+				if !tc.valid && errors.Cause(err) != database.ErrNotFound {
+					t.Fatalf("\t%s\tTest %d:\tWant not found error, got: %v", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould delete only existing API key of a user.", tests.Success, testID)
+			})
+		}
+	})
+}
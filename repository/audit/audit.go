@@ -0,0 +1,20 @@
+// Package audit is responsible for managing records of changes made to entities in database-agnostic way.
+// This package defines repository interface for abstracting interaction with particular database.
+package audit
+
+import (
+	"context"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/query"
+)
+
+// Repository is an interface that represents persistent storage abstraction.
+// This is a port in hexagonal architecture terms,
+// so concrete implementation of database should implements the set of these methods.
+//
+// Audit records are append-only, so there are no methods to change or remove them.
+type Repository interface {
+	Create(ctx context.Context, newRecord entity.NewAuditRecord) (entity.AuditRecord, error)
+	Query(ctx context.Context, q query.Query) ([]entity.AuditRecord, query.Page, error)
+}
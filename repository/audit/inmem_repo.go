@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
+)
+
+// InMemRepo is an abstraction layer that manages audit records inside basic in-memory store (slice+RWMutex).
+// It suits a single instance of an application, audit records are lost on restart.
+type InMemRepo struct {
+	records []entity.AuditRecord
+	sync.RWMutex
+}
+
+// NewInMemRepo creates a new in-memory repository for AuditRecord entity.
+func NewInMemRepo() *InMemRepo {
+	return &InMemRepo{}
+}
+
+// Create saves a new audit record in in-memory store.
+// A record is removed if a transaction carried by ctx fails, along with a change it describes.
+func (r *InMemRepo) Create(ctx context.Context, nr entity.NewAuditRecord) (entity.AuditRecord, error) {
+	record := entity.AuditRecord{
+		ID:          uuid.NewString(),
+		ActorID:     nr.ActorID,
+		RequestID:   nr.RequestID,
+		EntityType:  nr.EntityType,
+		EntityID:    nr.EntityID,
+		Action:      nr.Action,
+		Changes:     nr.Changes,
+		DateCreated: time.Now().UTC(),
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.records = append(r.records, record)
+	transaction.OnRollback(ctx, func() {
+		r.Lock()
+		defer r.Unlock()
+
+		for i := range r.records {
+			if r.records[i].ID == record.ID {
+				r.records = append(r.records[:i], r.records[i+1:]...)
+				return
+			}
+		}
+	})
+
+	return record, nil
+}
+
+// Query gets a page of audit records from in-memory store defined by list query.
+// By default results are sorted by creation date, newest first.
+func (r *InMemRepo) Query(ctx context.Context, q query.Query) ([]entity.AuditRecord, query.Page, error) {
+	r.RLock()
+	all := append([]entity.AuditRecord(nil), r.records...)
+	r.RUnlock()
+
+	records := []entity.AuditRecord{}
+
+	page, err := database.SlicePage(all, auditFields, "audit_id", q, &records)
+	if err != nil {
+		return nil, query.Page{}, errors.Wrap(err, "selecting audit records")
+	}
+
+	return records, page, nil
+}
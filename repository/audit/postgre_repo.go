@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+	"github.com/rtbe/clean-rest-api/internal/query"
+)
+
+// Postgre is an abstraction layer that manages audit records inside PostgreSQL DB.
+type Postgre struct {
+	db  *sqlx.DB
+	log logger.Logger
+}
+
+// NewPostgreRepo creates a new PostgreSQL repository for AuditRecord entity.
+func NewPostgreRepo(db *sqlx.DB, l logger.Logger) *Postgre {
+	return &Postgre{
+		db:  db,
+		log: l,
+	}
+}
+
+// Create saves a new audit record in PostgreSQL.
+// If the given context carries a transaction a record is saved within it,
+// so a record is kept only if a change it describes is committed.
+func (r *Postgre) Create(ctx context.Context, nr entity.NewAuditRecord) (entity.AuditRecord, error) {
+	const q = `
+	INSERT INTO audit_records
+		(audit_id, actor_id, request_id, entity_type, entity_id, action, changes, date_created)
+	VALUES
+		(:audit_id, :actor_id, :request_id, :entity_type, :entity_id, :action, :changes, :date_created)`
+
+	record := entity.AuditRecord{
+		ID:          uuid.NewString(),
+		ActorID:     nr.ActorID,
+		RequestID:   nr.RequestID,
+		EntityType:  nr.EntityType,
+		EntityID:    nr.EntityID,
+		Action:      nr.Action,
+		Changes:     nr.Changes,
+		DateCreated: time.Now().UTC(),
+	}
+
+	if _, err := database.NamedExec(ctx, r.db, q, record); err != nil {
+		return entity.AuditRecord{}, errors.Wrapf(err, "inserting an audit record of %s %s", nr.EntityType, nr.EntityID)
+	}
+
+	return record, nil
+}
+
+// auditFields is a whitelist of audit records fields that can be used in list queries.
+var auditFields = query.Fields{
+	"audit_id":     {Column: "audit_id", Type: query.UUID},
+	"actor_id":     {Column: "actor_id", Type: query.String},
+	"request_id":   {Column: "request_id", Type: query.String},
+	"entity_type":  {Column: "entity_type", Type: query.String},
+	"entity_id":    {Column: "entity_id", Type: query.UUID},
+	"action":       {Column: "action", Type: query.String},
+	"date_created": {Column: "date_created", Type: query.Time},
+}
+
+// Query gets a page of audit records from PostgreSQL DB defined by list query.
+// By default results are sorted by creation date, newest first.
+func (r *Postgre) Query(ctx context.Context, q query.Query) ([]entity.AuditRecord, query.Page, error) {
+	records := []entity.AuditRecord{}
+
+	page, err := database.QueryPage(ctx, r.db, "audit_records", auditFields, "audit_id", q, &records)
+	if err != nil {
+		return nil, query.Page{}, errors.Wrap(err, "selecting audit records")
+	}
+
+	return records, page, nil
+}
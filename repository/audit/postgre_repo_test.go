@@ -0,0 +1,149 @@
+package audit
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+var pgAuditRepo *Postgre
+var auditDB *sqlx.DB
+
+func TestMain(m *testing.M) {
+	db, purge, err := tests.NewPostgreSQL()
+	if err != nil {
+		log.Fatalf("could not start PostgreSQL: %s", err)
+	}
+
+	// Init global package dependencies after successfull connection to a database
+	pgAuditRepo = NewPostgreRepo(db, nil)
+	auditDB = db
+
+	code := m.Run()
+
+	// When you're done, kill and remove the container
+	if err = purge(); err != nil {
+		log.Fatalf("could not purge resource: %s", err)
+	}
+
+	os.Exit(code)
+}
+
+func TestPostgre(t *testing.T) {
+	ctx := context.Background()
+
+	productID := uuid.NewString()
+	actorID := uuid.NewString()
+
+	var validRecord entity.AuditRecord
+
+	t.Run("Given the need to record a change of an entity inside PostgreSQL", func(t *testing.T) {
+		changes, err := entity.DiffAudit(
+			entity.Product{ID: productID, Price: 1000},
+			entity.Product{ID: productID, Price: 1250},
+		)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to find changed fields of a product. Error: %s", tests.Failed, err)
+		}
+
+		validRecord, err = pgAuditRepo.Create(ctx, entity.NewAuditRecord{
+			ActorID:    actorID,
+			RequestID:  uuid.NewString(),
+			EntityType: entity.AuditEntityProduct,
+			EntityID:   productID,
+			Action:     entity.AuditActionUpdate,
+			Changes:    changes,
+		})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create an audit record. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to create an audit record.", tests.Success)
+
+		if _, err := pgAuditRepo.Create(ctx, entity.NewAuditRecord{
+			EntityType: entity.AuditEntityUser,
+			EntityID:   uuid.NewString(),
+			Action:     entity.AuditActionCreate,
+		}); err != nil {
+			t.Fatalf("\t%s\tShould be able to create an anonymous audit record. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to create an anonymous audit record.", tests.Success)
+	})
+
+	t.Run("Given the need to query audit records from PostgreSQL", func(t *testing.T) {
+		hourAgo := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+		hourLater := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+
+		tt := []struct {
+			testName  string
+			filters   []query.Filter
+			wantCount int
+		}{
+			{
+				testName:  "records of an entity",
+				filters:   []query.Filter{{Field: "entity_type", Op: query.Eq, Value: "product"}, {Field: "entity_id", Op: query.Eq, Value: productID}},
+				wantCount: 1,
+			},
+			{
+				testName:  "records of an actor",
+				filters:   []query.Filter{{Field: "actor_id", Op: query.Eq, Value: actorID}},
+				wantCount: 1,
+			},
+			{
+				testName:  "records of a period of time",
+				filters:   []query.Filter{{Field: "date_created", Op: query.Gte, Value: hourAgo}, {Field: "date_created", Op: query.Lt, Value: hourLater}},
+				wantCount: 2,
+			},
+			{
+				testName: "records of a future period of time",
+				filters:  []query.Filter{{Field: "date_created", Op: query.Gte, Value: hourLater}},
+			},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				records, _, err := pgAuditRepo.Query(ctx, query.Query{Filters: tc.filters})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to get a list of audit records. Error: %s", tests.Failed, testID, err)
+				}
+				if len(records) != tc.wantCount {
+					t.Fatalf("\t%s\tTest %d:\tWant %d records, got: %d", tests.Failed, testID, tc.wantCount, len(records))
+				}
+				t.Logf("\t%s\tTest %d:\tWant %d records, got: %d", tests.Success, testID, tc.wantCount, len(records))
+			})
+		}
+
+		records, _, err := pgAuditRepo.Query(ctx, query.Query{Filters: []query.Filter{{Field: "audit_id", Op: query.Eq, Value: validRecord.ID}}})
+		if err != nil || len(records) != 1 {
+			t.Fatalf("\t%s\tShould be able to get an audit record by it`s id. Error: %v", tests.Failed, err)
+		}
+		if string(records[0].Changes["price"].Before) != "10.00" || string(records[0].Changes["price"].After) != "12.50" {
+			t.Fatalf("\t%s\tWant price change from 10.00 to 12.50, got: %+v", tests.Failed, records[0].Changes)
+		}
+		t.Logf("\t%s\tWant price change from 10.00 to 12.50.", tests.Success)
+	})
+
+	t.Run("Given the need to keep audit records unchanged", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			stmt     string
+		}{
+			{testName: "Update an audit record", stmt: "UPDATE audit_records SET action = 'delete' WHERE audit_id = $1"},
+			{testName: "Delete an audit record", stmt: "DELETE FROM audit_records WHERE audit_id = $1"},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				if _, err := auditDB.ExecContext(ctx, tc.stmt, validRecord.ID); err == nil {
+					t.Fatalf("\t%s\tTest %d:\tShould not be able to change an audit record.", tests.Failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould not be able to change an audit record.", tests.Success, testID)
+			})
+		}
+	})
+}
@@ -13,6 +13,8 @@ import (
 // so concrete implementation of database should implements the set of these methods.
 type Repository interface {
 	Create(ctx context.Context, refreshToken entity.RefreshToken) error
-	Refresh(ctx context.Context, userID string, refreshToken entity.RefreshToken) error
-	Delete(ctx context.Context, userID string) error
+	MarkUsed(ctx context.Context, id string) (entity.RefreshToken, error)
+	Delete(ctx context.Context, id string) error
+	DeleteFamily(ctx context.Context, familyID string) error
+	DeleteByUserID(ctx context.Context, userID string) error
 }
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+)
+
+// InMemRepo is an abstraction layer that manages auth entities inside basic in-memory store (map+RWMutex).
+// It suits a single instance of an application, refresh tokens are lost on restart.
+type InMemRepo struct {
+	store map[string]entity.RefreshToken
+	sync.RWMutex
+}
+
+// NewInMemRepo creates a new in-memory repository for auth entity.
+func NewInMemRepo() *InMemRepo {
+	return &InMemRepo{
+		store: make(map[string]entity.RefreshToken),
+	}
+}
+
+// Create saves a new refresh token inside in-memory store.
+func (r *InMemRepo) Create(ctx context.Context, rt entity.RefreshToken) error {
+	r.Lock()
+	defer r.Unlock()
+
+	rt.Token = ""
+	r.store[rt.UUID] = rt
+
+	return nil
+}
+
+// MarkUsed marks refresh token with given id as used
+// and returns it as it was before an update,
+// so a caller can find out whether the token was already used.
+func (r *InMemRepo) MarkUsed(ctx context.Context, id string) (entity.RefreshToken, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	rt, ok := r.store[id]
+	if !ok {
+		return entity.RefreshToken{}, database.ErrNotFound
+	}
+
+	used := rt
+	used.Used = true
+	r.store[id] = used
+
+	return rt, nil
+}
+
+// Delete deletes refresh token from in-memory store by given id.
+func (r *InMemRepo) Delete(ctx context.Context, id string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.store, id)
+
+	return nil
+}
+
+// DeleteFamily deletes all refresh tokens of given family from in-memory store.
+func (r *InMemRepo) DeleteFamily(ctx context.Context, familyID string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	for id, rt := range r.store {
+		if rt.FamilyID == familyID {
+			delete(r.store, id)
+		}
+	}
+
+	return nil
+}
+
+// DeleteByUserID deletes all refresh tokens of particular user from in-memory store.
+func (r *InMemRepo) DeleteByUserID(ctx context.Context, userID string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	for id, rt := range r.store {
+		if rt.UserID == userID {
+			delete(r.store, id)
+		}
+	}
+
+	return nil
+}
@@ -5,9 +5,11 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
 	"github.com/rtbe/clean-rest-api/internal/logger"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Mongo is an abstraction layer that manages auth entities inside MongoDB.
@@ -26,15 +28,10 @@ func NewMongoRepo(db *mongo.Database, l logger.Logger) *Mongo {
 	}
 }
 
-// Create a new refresh token for particular user inside mongoDB.
+// Create saves a new refresh token inside mongoDB.
+// Refresh tokens are stored by their ids, so a user can have several of them at once.
 func (r *Mongo) Create(ctx context.Context, rt entity.RefreshToken) error {
-	_, err := r.db.InsertOne(
-		ctx,
-		bson.D{
-			{"_id", rt.UserID},
-			{"token", rt.Token},
-			{"expires", rt.ExpiresAt},
-		})
+	_, err := r.db.InsertOne(ctx, rt)
 	if err != nil {
 		return errors.Wrap(err, "error inserting tokens into mongoDB")
 	}
@@ -42,30 +39,50 @@ func (r *Mongo) Create(ctx context.Context, rt entity.RefreshToken) error {
 	return nil
 }
 
-// Refresh replaces refresh token for particular user inside mongoDB.
-func (r *Mongo) Refresh(ctx context.Context, userID string, rt entity.RefreshToken) error {
-	err := r.Delete(ctx, userID)
+// MarkUsed marks refresh token with given id as used
+// and returns it as it was before an update,
+// so a caller can find out whether the token was already used.
+func (r *Mongo) MarkUsed(ctx context.Context, id string) (entity.RefreshToken, error) {
+	var rt entity.RefreshToken
+
+	err := r.db.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"used": true}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&rt)
 	if err != nil {
-		return errors.Wrap(err, "error refreshing tokens inside mongoDB, delete token")
+		if err == mongo.ErrNoDocuments {
+			return entity.RefreshToken{}, database.ErrNotFound
+		}
+		return entity.RefreshToken{}, errors.Wrapf(err, "marking refresh token %s as used", id)
 	}
 
-	err = r.Create(ctx, rt)
-	if err != nil {
-		return errors.Wrap(err, "error refreshing tokens inside mongoDB, create token")
+	return rt, nil
+}
+
+// Delete deletes refresh token from mongoDB by given id.
+func (r *Mongo) Delete(ctx context.Context, id string) error {
+	if _, err := r.db.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return errors.Wrapf(err, "deleting refresh token %s", id)
 	}
 
 	return nil
 }
 
-// Delete deletes refresh token from mongoDB by given user id.
-func (r *Mongo) Delete(ctx context.Context, userID string) error {
-	_, err := r.db.DeleteOne(
-		ctx,
-		bson.D{
-			{"_id", userID},
-		})
-	if err != nil {
-		return err
+// DeleteFamily deletes all refresh tokens of given family from mongoDB.
+func (r *Mongo) DeleteFamily(ctx context.Context, familyID string) error {
+	if _, err := r.db.DeleteMany(ctx, bson.M{"family_id": familyID}); err != nil {
+		return errors.Wrapf(err, "deleting refresh token family %s", familyID)
+	}
+
+	return nil
+}
+
+// DeleteByUserID deletes all refresh tokens of particular user from mongoDB.
+func (r *Mongo) DeleteByUserID(ctx context.Context, userID string) error {
+	if _, err := r.db.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+		return errors.Wrapf(err, "deleting refresh tokens of user %s", userID)
 	}
 
 	return nil
@@ -0,0 +1,25 @@
+// Package idempotency is responsible for managing responses to requests made with Idempotency-Key header
+// in database-agnostic way.
+// This package defines repository interface for abstracting interaction with particular database.
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+)
+
+// Repository is an interface that represents persistent storage abstraction.
+// This is a port in hexagonal architecture terms,
+// so concrete implementation of database should implements the set of these methods.
+type Repository interface {
+	// Reserve saves a record of a request in progress unless there is a record with the same principal and key
+	// that is neither expired nor abandoned, which is returned instead. It reports whether a record was saved.
+	// A record of an abandoned request is replaced only with a record of the same request.
+	Reserve(ctx context.Context, r entity.IdempotencyRecord) (entity.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, r entity.IdempotencyRecord) error
+	Delete(ctx context.Context, principal, key string) error
+	// Purge deletes records that expired before a given time and returns how many were deleted.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
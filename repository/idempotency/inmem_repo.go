@@ -0,0 +1,92 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+)
+
+// InMemRepo is an abstraction layer that manages idempotency records inside basic in-memory store (map+RWMutex).
+// It suits a single instance of an application, records are lost on restart.
+type InMemRepo struct {
+	store map[string]entity.IdempotencyRecord
+	sync.RWMutex
+}
+
+// NewInMemRepo creates a new in-memory repository for idempotency records.
+func NewInMemRepo() *InMemRepo {
+	return &InMemRepo{
+		store: make(map[string]entity.IdempotencyRecord),
+	}
+}
+
+// Reserve saves a record of a request in progress in in-memory store
+// unless there is a record with the same principal and key that is neither expired nor abandoned.
+// A record of an abandoned request is taken over only by the same request, a different one still gets it back.
+func (r *InMemRepo) Reserve(ctx context.Context, rec entity.IdempotencyRecord) (entity.IdempotencyRecord, bool, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	k := storeKey(rec.Principal, rec.Key)
+	if existing, ok := r.store[k]; ok && existing.ExpiresAt.After(rec.DateCreated) {
+		if !existing.Abandoned(rec.DateCreated) || existing.Fingerprint != rec.Fingerprint {
+			return existing, false, nil
+		}
+	}
+
+	r.store[k] = rec
+	return rec, true, nil
+}
+
+// Complete saves a response to a request in in-memory store.
+func (r *InMemRepo) Complete(ctx context.Context, rec entity.IdempotencyRecord) error {
+	r.Lock()
+	defer r.Unlock()
+
+	k := storeKey(rec.Principal, rec.Key)
+	existing, ok := r.store[k]
+	if !ok {
+		return errors.Wrapf(database.ErrNotFound, "idempotency key %s", rec.Key)
+	}
+
+	existing.StatusCode = rec.StatusCode
+	existing.Header = rec.Header
+	existing.Body = rec.Body
+	r.store[k] = existing
+
+	return nil
+}
+
+// Delete deletes a record of a request from in-memory store, so a request can be made again with the same key.
+func (r *InMemRepo) Delete(ctx context.Context, principal, key string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.store, storeKey(principal, key))
+	return nil
+}
+
+// storeKey returns a key a record is stored by.
+func storeKey(principal, key string) string {
+	return principal + "\x00" + key
+}
+
+// Purge deletes records that expired before a given time from in-memory store and returns how many were deleted.
+func (r *InMemRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	var n int64
+	for k, rec := range r.store {
+		if !rec.ExpiresAt.After(before) {
+			delete(r.store, k)
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,172 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+)
+
+// Postgre is an abstraction layer that manages idempotency records inside PostgreSQL DB.
+type Postgre struct {
+	db  *sqlx.DB
+	log logger.Logger
+}
+
+// NewPostgreRepo creates a new PostgreSQL repository for idempotency records.
+func NewPostgreRepo(db *sqlx.DB, l logger.Logger) *Postgre {
+	return &Postgre{
+		db:  db,
+		log: l,
+	}
+}
+
+// reserveAttempts is how many times a key is tried to be reserved if a record that holds it vanishes meanwhile.
+const reserveAttempts = 3
+
+// Reserve saves a record of a request in progress in PostgreSQL
+// unless there is a record with the same principal and key that is neither expired nor abandoned.
+// A record of an abandoned request is taken over only by the same request, a different one still gets it back.
+func (r *Postgre) Reserve(ctx context.Context, rec entity.IdempotencyRecord) (entity.IdempotencyRecord, bool, error) {
+	const qUpsert = `
+	INSERT INTO idempotency_keys
+		(principal, idempotency_key, fingerprint, status_code, header, body, locked_until, expires_at, date_created)
+	VALUES
+		(:principal, :idempotency_key, :fingerprint, :status_code, :header, :body, :locked_until, :expires_at, :date_created)
+	ON CONFLICT (principal, idempotency_key) DO UPDATE SET
+		"fingerprint" = EXCLUDED.fingerprint,
+		"status_code" = EXCLUDED.status_code,
+		"header" = EXCLUDED.header,
+		"body" = EXCLUDED.body,
+		"locked_until" = EXCLUDED.locked_until,
+		"expires_at" = EXCLUDED.expires_at,
+		"date_created" = EXCLUDED.date_created
+	WHERE
+		idempotency_keys.expires_at <= EXCLUDED.date_created
+		OR (
+			idempotency_keys.status_code = 0
+			AND idempotency_keys.locked_until <= EXCLUDED.date_created
+			AND idempotency_keys.fingerprint = EXCLUDED.fingerprint
+		)`
+
+	const qSelect = `
+	SELECT
+		*
+	FROM
+		idempotency_keys
+	WHERE
+		principal = :principal AND idempotency_key = :idempotency_key`
+
+	// A record that holds a key can be deleted after it prevents an insert and before it is read,
+	// e.g. when a request it belongs to fails, then a key is free to be reserved again.
+	for i := 0; i < reserveAttempts; i++ {
+		res, err := database.NamedExec(ctx, r.db, qUpsert, rec)
+		if err != nil {
+			return entity.IdempotencyRecord{}, false, errors.Wrapf(err, "inserting idempotency key %s", rec.Key)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return entity.IdempotencyRecord{}, false, errors.Wrapf(err, "inserting idempotency key %s", rec.Key)
+		}
+		if n == 1 {
+			return rec, true, nil
+		}
+
+		var existing entity.IdempotencyRecord
+
+		err = database.QueryStruct(ctx, r.db, qSelect, rec, &existing)
+		if errors.Cause(err) == database.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return entity.IdempotencyRecord{}, false, errors.Wrapf(err, "getting idempotency key %s", rec.Key)
+		}
+
+		return existing, false, nil
+	}
+
+	return entity.IdempotencyRecord{}, false, errors.Errorf("reserving idempotency key %s: record that holds it keeps vanishing", rec.Key)
+}
+
+// Complete saves a response to a request in PostgreSQL.
+func (r *Postgre) Complete(ctx context.Context, rec entity.IdempotencyRecord) error {
+	const q = `
+	UPDATE
+		idempotency_keys
+	SET
+		"status_code" = :status_code,
+		"header" = :header,
+		"body" = :body
+	WHERE
+		principal = :principal AND idempotency_key = :idempotency_key`
+
+	res, err := database.NamedExec(ctx, r.db, q, rec)
+	if err != nil {
+		return errors.Wrapf(err, "completing idempotency key %s", rec.Key)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "completing idempotency key %s", rec.Key)
+	}
+	if n == 0 {
+		return errors.Wrapf(database.ErrNotFound, "idempotency key %s", rec.Key)
+	}
+
+	return nil
+}
+
+// Delete deletes a record of a request from PostgreSQL, so a request can be made again with the same key.
+func (r *Postgre) Delete(ctx context.Context, principal, key string) error {
+	const q = `
+	DELETE FROM
+		idempotency_keys
+	WHERE
+		principal = :principal AND idempotency_key = :idempotency_key`
+
+	data := struct {
+		Principal string `db:"principal"`
+		Key       string `db:"idempotency_key"`
+	}{
+		Principal: principal,
+		Key:       key,
+	}
+
+	if _, err := database.NamedExec(ctx, r.db, q, data); err != nil {
+		return errors.Wrapf(err, "deleting idempotency key %s", key)
+	}
+
+	return nil
+}
+
+// Purge deletes records that expired before a given time from PostgreSQL and returns how many were deleted.
+func (r *Postgre) Purge(ctx context.Context, before time.Time) (int64, error) {
+	const q = `
+	DELETE FROM
+		idempotency_keys
+	WHERE
+		expires_at <= :before`
+
+	data := struct {
+		Before time.Time `db:"before"`
+	}{
+		Before: before,
+	}
+
+	res, err := database.NamedExec(ctx, r.db, q, data)
+	if err != nil {
+		return 0, errors.Wrap(err, "purging expired idempotency keys")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "purging expired idempotency keys")
+	}
+
+	return n, nil
+}
@@ -0,0 +1,163 @@
+package idempotency
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+var pgIdempotencyRepo *Postgre
+
+func TestMain(m *testing.M) {
+	db, purge, err := tests.NewPostgreSQL()
+	if err != nil {
+		log.Fatalf("could not start PostgreSQL: %s", err)
+	}
+
+	// Init global package dependencies after successfull connection to a database
+	pgIdempotencyRepo = NewPostgreRepo(db, nil)
+
+	code := m.Run()
+
+	// When you're done, kill and remove the container
+	if err = purge(); err != nil {
+		log.Fatalf("could not purge resource: %s", err)
+	}
+
+	os.Exit(code)
+}
+
+func TestPostgre(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	newRecord := func(principal, key, fingerprint string, at time.Time) entity.IdempotencyRecord {
+		return entity.IdempotencyRecord{
+			Principal:   principal,
+			Key:         key,
+			Fingerprint: fingerprint,
+			LockedUntil: at.Add(time.Minute),
+			ExpiresAt:   at.Add(time.Hour),
+			DateCreated: at,
+		}
+	}
+
+	t.Run("Given the need to reserve idempotency keys inside PostgreSQL", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			record   entity.IdempotencyRecord
+			reserved bool
+		}{
+			{testName: "Reserve a new key", record: newRecord("user:1", "k1", "f1", now), reserved: true},
+			{testName: "Reserve the same key again", record: newRecord("user:1", "k1", "f2", now), reserved: false},
+			{testName: "Reserve the same key of another principal", record: newRecord("user:2", "k1", "f1", now), reserved: true},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				rec, reserved, err := pgIdempotencyRepo.Reserve(ctx, tc.record)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to reserve a key. Error: %s", tests.Failed, testID, err)
+				}
+
+				if reserved != tc.reserved {
+					t.Fatalf("\t%s\tTest %d:\tWant reserved: %t, got: %t", tests.Failed, testID, tc.reserved, reserved)
+				}
+				t.Logf("\t%s\tTest %d:\tWant reserved: %t, got: %t", tests.Success, testID, tc.reserved, reserved)
+
+				if !reserved && rec.Fingerprint == tc.record.Fingerprint {
+					t.Fatalf("\t%s\tTest %d:\tWant a record of the first request to be returned", tests.Failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tWant a record of the first request to be returned", tests.Success, testID)
+			})
+		}
+	})
+
+	t.Run("Given the need to save a response inside PostgreSQL", func(t *testing.T) {
+		rec := newRecord("user:1", "k1", "f1", now)
+		rec.StatusCode = 201
+		rec.Header = entity.ResponseHeader{"Content-Type": {"application/json"}}
+		rec.Body = []byte(`{"id":"1"}`)
+
+		if err := pgIdempotencyRepo.Complete(ctx, rec); err != nil {
+			t.Fatalf("\t%s\tShould be able to save a response. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to save a response.", tests.Success)
+
+		saved, reserved, err := pgIdempotencyRepo.Reserve(ctx, newRecord("user:1", "k1", "f1", now))
+		if err != nil || reserved {
+			t.Fatalf("\t%s\tShould be able to get a saved response. Error: %v", tests.Failed, err)
+		}
+
+		if !saved.Completed() || saved.StatusCode != 201 || string(saved.Body) != `{"id":"1"}` ||
+			saved.Header["Content-Type"][0] != "application/json" {
+			t.Fatalf("\t%s\tWant saved response, got: %+v", tests.Failed, saved)
+		}
+		t.Logf("\t%s\tWant saved response.", tests.Success)
+	})
+
+	t.Run("Given the need to delete a key from PostgreSQL", func(t *testing.T) {
+		if err := pgIdempotencyRepo.Delete(ctx, "user:1", "k1"); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete a key. Error: %s", tests.Failed, err)
+		}
+
+		_, reserved, err := pgIdempotencyRepo.Reserve(ctx, newRecord("user:1", "k1", "f1", now))
+		if err != nil || !reserved {
+			t.Fatalf("\t%s\tWant deleted key to be reserved again. Error: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tWant deleted key to be reserved again.", tests.Success)
+	})
+
+	t.Run("Given the need to reuse expired keys inside PostgreSQL", func(t *testing.T) {
+		_, reserved, err := pgIdempotencyRepo.Reserve(ctx, newRecord("user:2", "k1", "f3", now.Add(2*time.Hour)))
+		if err != nil || !reserved {
+			t.Fatalf("\t%s\tWant expired key to be reserved again. Error: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tWant expired key to be reserved again.", tests.Success)
+	})
+
+	t.Run("Given the need to take over keys of abandoned requests inside PostgreSQL", func(t *testing.T) {
+		if _, _, err := pgIdempotencyRepo.Reserve(ctx, newRecord("user:3", "k1", "f1", now)); err != nil {
+			t.Fatalf("\t%s\tShould be able to reserve a key. Error: %s", tests.Failed, err)
+		}
+
+		// The lock is over in two minutes, but the record is not expired yet.
+		later := now.Add(2 * time.Minute)
+
+		if _, reserved, err := pgIdempotencyRepo.Reserve(ctx, newRecord("user:3", "k1", "f2", later)); err != nil || reserved {
+			t.Fatalf("\t%s\tWant a key of an abandoned request to be kept from a different request. Error: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tWant a key of an abandoned request to be kept from a different request.", tests.Success)
+
+		rec, reserved, err := pgIdempotencyRepo.Reserve(ctx, newRecord("user:3", "k1", "f1", later))
+		if err != nil || !reserved {
+			t.Fatalf("\t%s\tWant a key of an abandoned request to be taken over by it`s retry. Error: %v", tests.Failed, err)
+		}
+		if !rec.LockedUntil.Equal(later.Add(time.Minute)) {
+			t.Fatalf("\t%s\tWant a key to be locked again, got locked until: %v", tests.Failed, rec.LockedUntil)
+		}
+		t.Logf("\t%s\tWant a key of an abandoned request to be taken over by it`s retry.", tests.Success)
+	})
+
+	t.Run("Given the need to purge expired keys from PostgreSQL", func(t *testing.T) {
+		if _, _, err := pgIdempotencyRepo.Reserve(ctx, newRecord("user:4", "k1", "f1", now.Add(-2*time.Hour))); err != nil {
+			t.Fatalf("\t%s\tShould be able to reserve a key. Error: %s", tests.Failed, err)
+		}
+
+		n, err := pgIdempotencyRepo.Purge(ctx, now)
+		if err != nil || n < 1 {
+			t.Fatalf("\t%s\tWant expired keys to be purged, got: %d. Error: %v", tests.Failed, n, err)
+		}
+		t.Logf("\t%s\tWant expired keys to be purged.", tests.Success)
+
+		_, reserved, err := pgIdempotencyRepo.Reserve(ctx, newRecord("user:1", "k1", "f2", now))
+		if err != nil || reserved {
+			t.Fatalf("\t%s\tWant unexpired keys to be kept. Error: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tWant unexpired keys to be kept.", tests.Success)
+	})
+}
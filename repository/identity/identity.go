@@ -0,0 +1,19 @@
+// Package identity is responsible for managing information about external identities of users
+// in database-agnostic way.
+// This package defines repository interface for abstracting interaction with particular database.
+package identity
+
+import (
+	"context"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+)
+
+// Repository is an interface that represents persistent storage abstraction.
+// This is a port in hexagonal architecture terms,
+// so concrete implementation of database should implements the set of these methods.
+type Repository interface {
+	Create(ctx context.Context, identity entity.ExternalIdentity) error
+	QueryBySubject(ctx context.Context, provider, subject string) (entity.ExternalIdentity, error)
+	QueryByUserID(ctx context.Context, userID string) ([]entity.ExternalIdentity, error)
+}
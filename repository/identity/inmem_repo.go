@@ -0,0 +1,75 @@
+package identity
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+)
+
+// InMemRepo is an abstraction layer that manages external identity entities inside basic in-memory store (map+RWMutex).
+// It suits a single instance of an application, linked identities are lost on restart.
+type InMemRepo struct {
+	store map[string]entity.ExternalIdentity
+	sync.RWMutex
+}
+
+// NewInMemRepo creates a new in-memory repository for ExternalIdentity entity.
+func NewInMemRepo() *InMemRepo {
+	return &InMemRepo{
+		store: make(map[string]entity.ExternalIdentity),
+	}
+}
+
+// identityKey is a key an external identity is stored by, a subject is unique within a provider only.
+func identityKey(provider, subject string) string {
+	return provider + "\x00" + subject
+}
+
+// Create links an external identity to a user in in-memory store.
+func (r *InMemRepo) Create(ctx context.Context, ei entity.ExternalIdentity) error {
+	r.Lock()
+	defer r.Unlock()
+
+	key := identityKey(ei.Provider, ei.Subject)
+	if _, ok := r.store[key]; ok {
+		return errors.Wrapf(database.ErrDuplicate, "inserting external identity %s of provider %s", ei.Subject, ei.Provider)
+	}
+	r.store[key] = ei
+
+	return nil
+}
+
+// QueryBySubject gets an external identity from in-memory store by a provider and an identifier of a user at it.
+func (r *InMemRepo) QueryBySubject(ctx context.Context, provider, subject string) (entity.ExternalIdentity, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	ei, ok := r.store[identityKey(provider, subject)]
+	if !ok {
+		return entity.ExternalIdentity{}, errors.Wrapf(database.ErrNotFound, "getting external identity %s of provider %s", subject, provider)
+	}
+
+	return ei, nil
+}
+
+// QueryByUserID gets all external identities linked to particular user from in-memory store.
+func (r *InMemRepo) QueryByUserID(ctx context.Context, userID string) ([]entity.ExternalIdentity, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	identities := []entity.ExternalIdentity{}
+	for _, ei := range r.store {
+		if ei.UserID == userID {
+			identities = append(identities, ei)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].DateCreated.Before(identities[j].DateCreated)
+	})
+
+	return identities, nil
+}
@@ -0,0 +1,94 @@
+package identity
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+)
+
+// Postgre is an abstraction layer that manages external identity entities inside PostgreSQL DB.
+type Postgre struct {
+	db  *sqlx.DB
+	log logger.Logger
+}
+
+// NewPostgreRepo creates a new PostgreSQL repository for ExternalIdentity entity.
+func NewPostgreRepo(db *sqlx.DB, l logger.Logger) *Postgre {
+	return &Postgre{
+		db:  db,
+		log: l,
+	}
+}
+
+// Create links an external identity to a user in PostgreSQL.
+func (r *Postgre) Create(ctx context.Context, ei entity.ExternalIdentity) error {
+	const q = `
+	INSERT INTO external_identities
+		(provider, subject, user_id, email, date_created)
+	VALUES
+		(:provider, :subject, :user_id, :email, :date_created)`
+
+	if _, err := database.NamedExec(ctx, r.db, q, ei); err != nil {
+		return errors.Wrapf(err, "inserting external identity %s of provider %s", ei.Subject, ei.Provider)
+	}
+
+	return nil
+}
+
+// QueryBySubject gets an external identity from PostgreSQL by a provider and an identifier of a user at it.
+func (r *Postgre) QueryBySubject(ctx context.Context, provider, subject string) (entity.ExternalIdentity, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		external_identities
+	WHERE
+		provider = :provider AND subject = :subject`
+
+	data := struct {
+		Provider string `db:"provider"`
+		Subject  string `db:"subject"`
+	}{
+		Provider: provider,
+		Subject:  subject,
+	}
+
+	var ei entity.ExternalIdentity
+
+	if err := database.QueryStruct(ctx, r.db, q, data, &ei); err != nil {
+		return entity.ExternalIdentity{}, errors.Wrapf(err, "getting external identity %s of provider %s", subject, provider)
+	}
+
+	return ei, nil
+}
+
+// QueryByUserID gets all external identities linked to particular user from PostgreSQL.
+func (r *Postgre) QueryByUserID(ctx context.Context, userID string) ([]entity.ExternalIdentity, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		external_identities
+	WHERE
+		user_id = :user_id
+	ORDER BY
+		date_created`
+
+	data := struct {
+		UserID string `db:"user_id"`
+	}{
+		UserID: userID,
+	}
+
+	identities := []entity.ExternalIdentity{}
+
+	if err := database.QuerySlice(ctx, r.db, q, data, &identities); err != nil {
+		return nil, errors.Wrapf(err, "getting external identities of user %s", userID)
+	}
+
+	return identities, nil
+}
@@ -0,0 +1,148 @@
+package identity
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+	"github.com/rtbe/clean-rest-api/repository/user"
+)
+
+var pgIdentityRepo *Postgre
+var pgUserRepo *user.Postgre
+var validUser entity.User
+
+func TestMain(m *testing.M) {
+	db, purge, err := tests.NewPostgreSQL()
+	if err != nil {
+		log.Fatalf("could not start PostgreSQL: %s", err)
+	}
+
+	// Init global package dependencies after successfull connection to a database
+	pgIdentityRepo = NewPostgreRepo(db, nil)
+	pgUserRepo = user.NewPostgreRepo(db, nil)
+
+	newUser := entity.NewUser{
+		UserName:        "AlanKay",
+		FirstName:       "Alan",
+		LastName:        "Kay",
+		Password:        "OOP_is_about_messages",
+		PasswordConfirm: "OOP_is_about_messages",
+		Email:           "AlanKay@zeroxparc.com",
+		Roles:           []string{"user"},
+		EmailVerified:   true,
+	}
+	validUser, err = pgUserRepo.Create(context.Background(), newUser)
+	if err != nil {
+		log.Fatalf("could not prepare test data: %s", err)
+	}
+
+	code := m.Run()
+
+	// When you're done, kill and remove the container
+	if err = purge(); err != nil {
+		log.Fatalf("could not purge resource: %s", err)
+	}
+
+	os.Exit(code)
+}
+
+func TestPostgre(t *testing.T) {
+	t.Run("Given the need to link an external identity to a user inside PostgreSQL", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			provider string
+			subject  string
+			valid    bool
+		}{
+			{testName: "Link a new identity", provider: "corp", subject: "248289761001", valid: true},
+			{testName: "Link an identity of other provider", provider: "partner", subject: "248289761001", valid: true},
+			{testName: "Link already linked identity", provider: "corp", subject: "248289761001", valid: false},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				err := pgIdentityRepo.Create(context.Background(), entity.ExternalIdentity{
+					Provider:    tc.provider,
+					Subject:     tc.subject,
+					UserID:      validUser.ID,
+					Email:       validUser.Email,
+					DateCreated: time.Now().UTC(),
+				})
+				if err != nil && tc.valid {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to link an identity. Error: %s", tests.Failed, testID, err)
+				}
+				if err == nil && !tc.valid {
+					t.Fatalf("\t%s\tTest %d:\tShould not be able to link an identity twice.", tests.Failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould link an identity only once.", tests.Success, testID)
+			})
+		}
+	})
+
+	t.Run("Given the need to get an external identity by it`s subject from PostgreSQL", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			provider string
+			subject  string
+			valid    bool
+		}{
+			{testName: "Linked identity", provider: "corp", subject: "248289761001", valid: true},
+			{testName: "Identity of unknown provider", provider: "unknown", subject: "248289761001", valid: false},
+			{testName: "Unknown identity", provider: "corp", subject: "unknown", valid: false},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				ei, err := pgIdentityRepo.QueryBySubject(context.Background(), tc.provider, tc.subject)
+				if !tc.valid {
+					if errors.Cause(err) != database.ErrNotFound {
+						t.Fatalf("\t%s\tTest %d:\tWant not found error, got: %v", tests.Failed, testID, err)
+					}
+					t.Logf("\t%s\tTest %d:\tWant not found error.", tests.Success, testID)
+					return
+				}
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to get an identity. Error: %s", tests.Failed, testID, err)
+				}
+
+				if ei.UserID != validUser.ID {
+					t.Fatalf("\t%s\tTest %d:\tWant user id: %s, got: %s", tests.Failed, testID, validUser.ID, ei.UserID)
+				}
+				t.Logf("\t%s\tTest %d:\tWant user id: %s, got: %s", tests.Success, testID, validUser.ID, ei.UserID)
+			})
+		}
+	})
+
+	t.Run("Given the need to get external identities of a user from PostgreSQL", func(t *testing.T) {
+		identities, err := pgIdentityRepo.QueryByUserID(context.Background(), validUser.ID)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to get identities of a user. Error: %s", tests.Failed, err)
+		}
+
+		if len(identities) != 2 {
+			t.Fatalf("\t%s\tWant 2 identities, got: %d", tests.Failed, len(identities))
+		}
+		t.Logf("\t%s\tWant 2 identities, got: %d", tests.Success, len(identities))
+	})
+
+	t.Run("Given the need to unlink identities of a deleted user", func(t *testing.T) {
+		if err := pgUserRepo.Delete(context.Background(), validUser.ID, 0); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete a user. Error: %s", tests.Failed, err)
+		}
+
+		identities, err := pgIdentityRepo.QueryByUserID(context.Background(), validUser.ID)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to get identities of a user. Error: %s", tests.Failed, err)
+		}
+
+		if len(identities) != 0 {
+			t.Fatalf("\t%s\tWant identities to be deleted with a user, got: %d", tests.Failed, len(identities))
+		}
+		t.Logf("\t%s\tWant identities to be deleted with a user.", tests.Success)
+	})
+}
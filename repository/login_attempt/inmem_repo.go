@@ -0,0 +1,84 @@
+package loginattempt
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+)
+
+// InMemRepo is an abstraction layer that manages failed sign in attempts inside basic in-memory store (map+RWMutex).
+// It suits a single instance of an application, counts are lost on restart.
+type InMemRepo struct {
+	store map[string]entity.LoginAttempts
+	sync.RWMutex
+}
+
+// NewInMemRepo creates a new in-memory repository for failed sign in attempts.
+func NewInMemRepo() *InMemRepo {
+	return &InMemRepo{
+		store: make(map[string]entity.LoginAttempts),
+	}
+}
+
+// Query gets failed sign in attempts counted by particular key from in-memory store.
+func (r *InMemRepo) Query(ctx context.Context, key string) (entity.LoginAttempts, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	a, ok := r.store[key]
+	if !ok {
+		return entity.LoginAttempts{}, database.ErrNotFound
+	}
+
+	return a, nil
+}
+
+// AddFailure counts a failed sign in attempt inside in-memory store and returns attempts counted before it.
+// Counting starts over if the last failure is older than window.
+func (r *InMemRepo) AddFailure(ctx context.Context, key string, at time.Time, window time.Duration) (entity.LoginAttempts, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	prev, ok := r.store[key]
+	if !ok {
+		prev = entity.LoginAttempts{Key: key}
+	}
+
+	a := prev
+	if !a.LastFailure.After(at.Add(-window)) {
+		a = entity.LoginAttempts{Key: key}
+	}
+
+	a.Failures++
+	if at.After(a.LastFailure) {
+		a.LastFailure = at
+	}
+	r.store[key] = a
+
+	return prev, nil
+}
+
+// RemoveFailure takes back a failed sign in attempt counted inside in-memory store.
+func (r *InMemRepo) RemoveFailure(ctx context.Context, key string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if a, ok := r.store[key]; ok && a.Failures > 0 {
+		a.Failures--
+		r.store[key] = a
+	}
+
+	return nil
+}
+
+// Reset forgets failed sign in attempts counted by particular key.
+func (r *InMemRepo) Reset(ctx context.Context, key string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.store, key)
+	return nil
+}
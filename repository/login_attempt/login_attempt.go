@@ -0,0 +1,25 @@
+// Package loginattempt is responsible for counting failed sign in attempts
+// in database-agnostic way.
+// This package defines repository interface for abstracting interaction with particular database.
+package loginattempt
+
+import (
+	"context"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+)
+
+// Repository is an interface that represents persistent storage abstraction.
+// This is a port in hexagonal architecture terms,
+// so concrete implementation of database should implements the set of these methods.
+type Repository interface {
+	Query(ctx context.Context, key string) (entity.LoginAttempts, error)
+	// AddFailure atomically counts an attempt made at particular time as a failed one
+	// and returns attempts counted before it, so of concurrent attempts every one sees the ones counted earlier.
+	// Failures made earlier than window before it are forgotten.
+	AddFailure(ctx context.Context, key string, at time.Time, window time.Duration) (entity.LoginAttempts, error)
+	// RemoveFailure takes back a failure counted by AddFailure for an attempt that turned out successful.
+	RemoveFailure(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
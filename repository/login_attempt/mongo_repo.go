@@ -0,0 +1,134 @@
+package loginattempt
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// lastFailureIndex is a name of TTL index on last failures.
+	lastFailureIndex = "last_failure_ttl"
+
+	// indexOptionsConflict is a code of an error MongoDB returns when an index exists with other options.
+	indexOptionsConflict = 85
+)
+
+// Mongo is an abstraction layer that manages failed sign in attempts inside MongoDB.
+type Mongo struct {
+	db *mongo.Collection
+	logger.Logger
+}
+
+// NewMongoRepo creates a new MongoDB repository for failed sign in attempts.
+func NewMongoRepo(db *mongo.Database, l logger.Logger) *Mongo {
+	coll := "login_attempts"
+
+	return &Mongo{
+		db.Collection(coll),
+		l,
+	}
+}
+
+// Query gets failed sign in attempts counted by particular key from mongoDB.
+func (r *Mongo) Query(ctx context.Context, key string) (entity.LoginAttempts, error) {
+	var a entity.LoginAttempts
+
+	if err := r.db.FindOne(ctx, bson.M{"_id": key}).Decode(&a); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return entity.LoginAttempts{}, database.ErrNotFound
+		}
+		return entity.LoginAttempts{}, errors.Wrapf(err, "getting login attempts by %s", key)
+	}
+
+	return a, nil
+}
+
+// AddFailure counts a failed sign in attempt inside mongoDB and returns attempts counted before it.
+// Counting starts over if the last failure is older than window.
+// Both happen in a single upsert, so concurrent attempts are counted one after another.
+func (r *Mongo) AddFailure(ctx context.Context, key string, at time.Time, window time.Duration) (entity.LoginAttempts, error) {
+	var a entity.LoginAttempts
+
+	// A missing document has no last failure, which is less than any time, so counting starts from one.
+	inWindow := bson.M{"$gt": bson.A{"$last_failure", at.Add(-window)}}
+	update := func() error {
+		return r.db.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": key},
+			bson.A{bson.M{"$set": bson.M{
+				"failures":     bson.M{"$cond": bson.A{inWindow, bson.M{"$add": bson.A{"$failures", 1}}, 1}},
+				"last_failure": bson.M{"$max": bson.A{"$last_failure", at}},
+			}}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+		).Decode(&a)
+	}
+
+	err := update()
+	// Concurrent upserts of a missing document can collide, then the one that lost updates the inserted document.
+	if mongo.IsDuplicateKeyError(err) {
+		err = update()
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return entity.LoginAttempts{Key: key}, nil
+		}
+		return entity.LoginAttempts{}, errors.Wrapf(err, "adding login failure by %s", key)
+	}
+
+	return a, nil
+}
+
+// RemoveFailure takes back a failed sign in attempt counted inside mongoDB.
+func (r *Mongo) RemoveFailure(ctx context.Context, key string) error {
+	_, err := r.db.UpdateOne(
+		ctx,
+		bson.M{"_id": key, "failures": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"failures": -1}},
+	)
+	if err != nil {
+		return errors.Wrapf(err, "removing login failure by %s", key)
+	}
+
+	return nil
+}
+
+// CreateIndexes creates a TTL index that removes attempts once ttl passed since the last failure,
+// so attempts with random user names do not pile up. ttl should be the longest window failures are counted in.
+// An existing index gets a new ttl if it is changed.
+func (r *Mongo) CreateIndexes(ctx context.Context, ttl time.Duration) error {
+	seconds := int32(ttl.Seconds())
+	_, err := r.db.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "last_failure", Value: 1}},
+		Options: options.Index().SetName(lastFailureIndex).SetExpireAfterSeconds(seconds),
+	})
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == indexOptionsConflict {
+		err = r.db.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: r.db.Name()},
+			{Key: "index", Value: bson.M{"name": lastFailureIndex, "expireAfterSeconds": seconds}},
+		}).Err()
+	}
+	if err != nil {
+		return errors.Wrap(err, "creating login attempts indexes")
+	}
+
+	return nil
+}
+
+// Reset forgets failed sign in attempts counted by particular key.
+func (r *Mongo) Reset(ctx context.Context, key string) error {
+	if _, err := r.db.DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+		return errors.Wrapf(err, "resetting login attempts by %s", key)
+	}
+
+	return nil
+}
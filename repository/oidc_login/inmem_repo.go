@@ -0,0 +1,48 @@
+package oidclogin
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+)
+
+// InMemRepo is an abstraction layer that manages OIDC logins inside basic in-memory store (map+RWMutex).
+// It suits a single instance of an application, logins in progress are lost on restart.
+type InMemRepo struct {
+	store map[string]entity.OIDCLogin
+	sync.RWMutex
+}
+
+// NewInMemRepo creates a new in-memory repository for OIDC logins.
+func NewInMemRepo() *InMemRepo {
+	return &InMemRepo{
+		store: make(map[string]entity.OIDCLogin),
+	}
+}
+
+// Create saves an OIDC login in progress inside in-memory store.
+func (r *InMemRepo) Create(ctx context.Context, l entity.OIDCLogin) error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.store[l.State] = l
+
+	return nil
+}
+
+// Take gets an OIDC login with given state and deletes it from in-memory store,
+// so a login can be completed only once.
+func (r *InMemRepo) Take(ctx context.Context, state string) (entity.OIDCLogin, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	l, ok := r.store[state]
+	if !ok {
+		return entity.OIDCLogin{}, database.ErrNotFound
+	}
+	delete(r.store, state)
+
+	return l, nil
+}
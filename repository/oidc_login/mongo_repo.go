@@ -0,0 +1,52 @@
+package oidclogin
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Mongo is an abstraction layer that manages OIDC login entities inside MongoDB.
+type Mongo struct {
+	db *mongo.Collection
+	logger.Logger
+}
+
+// NewMongoRepo creates a new MongoDB repository for OIDC login entity
+func NewMongoRepo(db *mongo.Database, l logger.Logger) *Mongo {
+	coll := "oidc_logins"
+
+	return &Mongo{
+		db.Collection(coll),
+		l,
+	}
+}
+
+// Create saves a new OIDC login inside mongoDB.
+func (r *Mongo) Create(ctx context.Context, l entity.OIDCLogin) error {
+	if _, err := r.db.InsertOne(ctx, l); err != nil {
+		return errors.Wrap(err, "inserting OIDC login into mongoDB")
+	}
+
+	return nil
+}
+
+// Take gets an OIDC login with given state and deletes it from mongoDB,
+// so a login can be completed only once.
+func (r *Mongo) Take(ctx context.Context, state string) (entity.OIDCLogin, error) {
+	var l entity.OIDCLogin
+
+	if err := r.db.FindOneAndDelete(ctx, bson.M{"_id": state}).Decode(&l); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return entity.OIDCLogin{}, database.ErrNotFound
+		}
+		return entity.OIDCLogin{}, errors.Wrap(err, "taking OIDC login")
+	}
+
+	return l, nil
+}
@@ -0,0 +1,18 @@
+// Package oidclogin is responsible for managing information about logins through external identity providers
+// that are in progress in database-agnostic way.
+// This package defines repository interface for abstracting interaction with particular database.
+package oidclogin
+
+import (
+	"context"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+)
+
+// Repository is an interface that represents persistent storage abstraction.
+// This is a port in hexagonal architecture terms,
+// so concrete implementation of database should implements the set of these methods.
+type Repository interface {
+	Create(ctx context.Context, login entity.OIDCLogin) error
+	Take(ctx context.Context, state string) (entity.OIDCLogin, error)
+}
@@ -0,0 +1,331 @@
+package order
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
+)
+
+// InMemRepo is an abstraction layer that manages order entities inside basic in-memory store (map+RWMutex).
+// It behaves as PostgreSQL repository does, but suits a single instance of an application, orders are lost on restart.
+type InMemRepo struct {
+	store   map[string]entity.Order
+	history map[string][]entity.OrderStatusChange
+	sync.RWMutex
+}
+
+// NewInMemRepo creates a new in-memory repository for order entity.
+func NewInMemRepo() *InMemRepo {
+	return &InMemRepo{
+		store:   make(map[string]entity.Order),
+		history: make(map[string][]entity.OrderStatusChange),
+	}
+}
+
+// Create creates an new order in in-memory store.
+func (r *InMemRepo) Create(ctx context.Context, no entity.NewOrder) (entity.Order, error) {
+	order := entity.Order{
+		ID:          uuid.NewString(),
+		UserID:      no.UserID,
+		Status:      no.Status,
+		Version:     1,
+		DateCreated: time.Now().UTC(),
+		DateUpdated: time.Now().UTC(),
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.put(ctx, order.ID, order)
+
+	return order, nil
+}
+
+// Query gets a page of orders from in-memory store defined by list query.
+// By default results are sorted by creation date, newest first.
+func (r *InMemRepo) Query(ctx context.Context, q query.Query) ([]entity.Order, query.Page, error) {
+	r.RLock()
+	all := make([]entity.Order, 0, len(r.store))
+	for _, o := range r.store {
+		all = append(all, o)
+	}
+	r.RUnlock()
+
+	orders := []entity.Order{}
+
+	page, err := database.SlicePage(all, orderFields, "order_id", q, &orders)
+	if err != nil {
+		return nil, query.Page{}, errors.Wrap(err, "selecting orders")
+	}
+
+	return orders, page, nil
+}
+
+// QueryByID gets an order from in-memory store by given id.
+// Deleted orders are not found.
+func (r *InMemRepo) QueryByID(ctx context.Context, id string) (entity.Order, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	order, ok := r.store[id]
+	if !ok || order.DeletedAt != nil {
+		return entity.Order{}, errors.Wrapf(database.ErrNotFound, "getting an order with id %s", id)
+	}
+
+	return order, nil
+}
+
+// QueryByIDForUpdate gets an order from in-memory store by given id.
+// There are no row locks in memory, transaction.InMem runs transactions one at a time instead.
+func (r *InMemRepo) QueryByIDForUpdate(ctx context.Context, id string) (entity.Order, error) {
+	order, err := r.QueryByID(ctx, id)
+	if err != nil {
+		return entity.Order{}, errors.Wrapf(errors.Cause(err), "locking an order with id %s", id)
+	}
+
+	return order, nil
+}
+
+// QueryByUserID gets orders from in-memory store by given user id.
+func (r *InMemRepo) QueryByUserID(ctx context.Context, userID string) ([]entity.Order, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	orders := []entity.Order{}
+	for _, o := range r.store {
+		if o.UserID == userID && o.DeletedAt == nil {
+			orders = append(orders, o)
+		}
+	}
+
+	return orders, nil
+}
+
+// Update updates a specific order inside in-memory store.
+// Non zero version is a version of an order an update is based on,
+// if an order has a different one database.ErrVersionConflict is returned.
+func (r *InMemRepo) Update(ctx context.Context, id string, version int, updateOrder entity.UpdateOrder) error {
+	r.Lock()
+	defer r.Unlock()
+
+	order, ok := r.store[id]
+	if !ok || order.DeletedAt != nil {
+		return errors.Wrapf(database.ErrNotFound, "error updating a order with id %s", id)
+	}
+	if version != 0 && order.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "updating an order with id %s", id)
+	}
+
+	if updateOrder.Status != nil {
+		order.Status = *updateOrder.Status
+	}
+	order.Version++
+	order.DateUpdated = time.Now().UTC()
+	r.put(ctx, id, order)
+
+	return nil
+}
+
+// UpdateTotals updates server-computed money amounts of a specific order inside in-memory store.
+func (r *InMemRepo) UpdateTotals(ctx context.Context, id string, totals entity.OrderTotals) error {
+	r.Lock()
+	defer r.Unlock()
+
+	order, ok := r.store[id]
+	if !ok {
+		return nil
+	}
+
+	order.OrderTotals = totals
+	order.Version++
+	order.DateUpdated = time.Now().UTC()
+	r.put(ctx, id, order)
+
+	return nil
+}
+
+// Delete marks an order in in-memory store as deleted by given order id,
+// it is kept until Purge removes it, so it can be restored meanwhile.
+// Non zero version is a version of an order a client knows about,
+// if an order has a different one database.ErrVersionConflict is returned.
+func (r *InMemRepo) Delete(ctx context.Context, id string, version int) error {
+	r.Lock()
+	defer r.Unlock()
+
+	order, ok := r.store[id]
+	if !ok || order.DeletedAt != nil {
+		return errors.Wrapf(database.ErrNotFound, "deleting an order with id %s", id)
+	}
+	if version != 0 && order.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "deleting an order with id %s", id)
+	}
+
+	now := time.Now().UTC()
+	order.DeletedAt = &now
+	order.Version++
+	r.put(ctx, id, order)
+
+	return nil
+}
+
+// DeleteByUserID marks orders in in-memory store as deleted by given user id.
+func (r *InMemRepo) DeleteByUserID(ctx context.Context, userID string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now().UTC()
+	for id, o := range r.store {
+		if o.UserID == userID && o.DeletedAt == nil {
+			o.DeletedAt = &now
+			o.Version++
+			r.put(ctx, id, o)
+		}
+	}
+
+	return nil
+}
+
+// CreateStatusChange appends a record about an order status transition into in-memory store.
+func (r *InMemRepo) CreateStatusChange(ctx context.Context, sc entity.OrderStatusChange) (entity.OrderStatusChange, error) {
+	sc.ID = uuid.NewString()
+	sc.DateCreated = time.Now().UTC()
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.putHistory(ctx, sc.OrderID, append(r.history[sc.OrderID], sc))
+
+	return sc, nil
+}
+
+// QueryStatusHistory gets status transitions of an order from in-memory store sorted from oldest to newest.
+func (r *InMemRepo) QueryStatusHistory(ctx context.Context, orderID string) ([]entity.OrderStatusChange, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	var history []entity.OrderStatusChange
+	history = append(history, r.history[orderID]...)
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].DateCreated.Before(history[j].DateCreated)
+	})
+
+	return history, nil
+}
+
+// Restore restores a deleted order inside in-memory store by given order id.
+func (r *InMemRepo) Restore(ctx context.Context, id string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	order, ok := r.store[id]
+	if !ok || order.DeletedAt == nil {
+		return errors.Wrapf(database.ErrNotFound, "deleted order %s", id)
+	}
+
+	order.DeletedAt = nil
+	order.Version++
+	order.DateUpdated = time.Now().UTC()
+	r.put(ctx, id, order)
+
+	return nil
+}
+
+// RestoreByUserID restores orders of a user inside in-memory store that were deleted since given time,
+// orders deleted before it stay deleted.
+func (r *InMemRepo) RestoreByUserID(ctx context.Context, userID string, since time.Time) error {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now().UTC()
+	for id, o := range r.store {
+		if o.UserID == userID && o.DeletedAt != nil && !o.DeletedAt.Before(since) {
+			o.DeletedAt = nil
+			o.Version++
+			o.DateUpdated = now
+			r.put(ctx, id, o)
+		}
+	}
+
+	return nil
+}
+
+// Purge permanently removes orders from in-memory store that were deleted before given time,
+// status history of those orders is removed along with them.
+// Items of purged orders are kept in their own repository, see orderitem.InMemRepo.Purge.
+func (r *InMemRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	var n int64
+	for id, order := range r.store {
+		if order.DeletedAt != nil && order.DeletedAt.Before(before) {
+			r.remove(ctx, id)
+			r.putHistory(ctx, id, nil)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// put stores an order by id within in-memory store,
+// if a transaction carried by ctx fails a previous state of it is restored.
+// It must be called with the lock held.
+func (r *InMemRepo) put(ctx context.Context, id string, v entity.Order) {
+	r.journal(ctx, id)
+	r.store[id] = v
+}
+
+// remove removes an order by id from in-memory store,
+// if a transaction carried by ctx fails it is restored.
+// It must be called with the lock held.
+func (r *InMemRepo) remove(ctx context.Context, id string) {
+	r.journal(ctx, id)
+	delete(r.store, id)
+}
+
+// journal registers restoration of current state of an order by id if a transaction carried by ctx fails.
+func (r *InMemRepo) journal(ctx context.Context, id string) {
+	prev, existed := r.store[id]
+	transaction.OnRollback(ctx, func() {
+		r.Lock()
+		defer r.Unlock()
+
+		if existed {
+			r.store[id] = prev
+			return
+		}
+		delete(r.store, id)
+	})
+}
+
+// putHistory replaces status history of an order within in-memory store, nil history removes it,
+// if a transaction carried by ctx fails a previous history is restored.
+// It must be called with the lock held.
+func (r *InMemRepo) putHistory(ctx context.Context, orderID string, history []entity.OrderStatusChange) {
+	prev, existed := r.history[orderID]
+	transaction.OnRollback(ctx, func() {
+		r.Lock()
+		defer r.Unlock()
+
+		if existed {
+			r.history[orderID] = prev
+			return
+		}
+		delete(r.history, orderID)
+	})
+
+	if history == nil {
+		delete(r.history, orderID)
+		return
+	}
+	r.history[orderID] = history
+}
@@ -4,8 +4,10 @@ package order
 
 import (
 	"context"
+	"time"
 
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/query"
 )
 
 // Repository is an interface that represents persistent storage abstraction.
@@ -13,10 +15,17 @@ import (
 // so concrete implementation of database should implements the set of these methods.
 type Repository interface {
 	Create(ctx context.Context, newOrder entity.NewOrder) (entity.Order, error)
-	Query(ctx context.Context, lastSeenID, limit string) ([]entity.Order, error)
+	Query(ctx context.Context, q query.Query) ([]entity.Order, query.Page, error)
 	QueryByID(ctx context.Context, id string) (entity.Order, error)
+	QueryByIDForUpdate(ctx context.Context, id string) (entity.Order, error)
 	QueryByUserID(ctx context.Context, userID string) ([]entity.Order, error)
-	Update(ctx context.Context, id string, updateOrder entity.UpdateOrder) error
-	Delete(ctx context.Context, id string) error
+	Update(ctx context.Context, id string, version int, updateOrder entity.UpdateOrder) error
+	UpdateTotals(ctx context.Context, id string, totals entity.OrderTotals) error
+	Delete(ctx context.Context, id string, version int) error
 	DeleteByUserID(ctx context.Context, userID string) error
+	Restore(ctx context.Context, id string) error
+	RestoreByUserID(ctx context.Context, userID string, since time.Time) error
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	CreateStatusChange(ctx context.Context, statusChange entity.OrderStatusChange) (entity.OrderStatusChange, error)
+	QueryStatusHistory(ctx context.Context, orderID string) ([]entity.OrderStatusChange, error)
 }
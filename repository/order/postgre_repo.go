@@ -10,6 +10,7 @@ import (
 	"github.com/rtbe/clean-rest-api/domain/entity"
 	"github.com/rtbe/clean-rest-api/internal/database"
 	"github.com/rtbe/clean-rest-api/internal/logger"
+	"github.com/rtbe/clean-rest-api/internal/query"
 )
 
 // Postgre is an abstraction layer that manages order entities inside PostgreSQL DB.
@@ -31,67 +32,90 @@ func NewPostgreRepo(db *sqlx.DB, l logger.Logger) *Postgre {
 func (r *Postgre) Create(ctx context.Context, no entity.NewOrder) (entity.Order, error) {
 	const query = `
 	INSERT INTO orders 
-		(order_id, user_id, status, date_created, date_updated) 
+		(order_id, user_id, status, subtotal, tax, total, version, date_created, date_updated) 
 	VALUES
-		(:order_id, :user_id, :status, :date_created, :date_updated)`
+		(:order_id, :user_id, :status, :subtotal, :tax, :total, :version, :date_created, :date_updated)`
 
 	order := entity.Order{
 		ID:          uuid.NewString(),
 		UserID:      no.UserID,
 		Status:      no.Status,
+		Version:     1,
 		DateCreated: time.Now().UTC(),
 		DateUpdated: time.Now().UTC(),
 	}
 
-	if _, err := r.db.NamedExecContext(ctx, query, order); err != nil {
+	if _, err := database.NamedExec(ctx, r.db, query, order); err != nil {
 		return entity.Order{}, errors.Wrap(err, "inserting an order")
 	}
 
 	return order, nil
 }
 
-// Query gets orders from PostgreSQL.
-// This query uses two provided values to implement pagination: last seen id and limit.
-// Results of a query sorted by creation date of selected users.
-func (r *Postgre) Query(ctx context.Context, lastSeenID, limit string) ([]entity.Order, error) {
+// orderFields is a whitelist of orders fields that can be used in list queries.
+var orderFields = query.Fields{
+	"order_id":     {Column: "order_id", Type: query.UUID},
+	"user_id":      {Column: "user_id", Type: query.UUID},
+	"status":       {Column: "status", Type: query.String},
+	"subtotal":     {Column: "subtotal", Type: query.Decimal},
+	"tax":          {Column: "tax", Type: query.Decimal},
+	"total":        {Column: "total", Type: query.Decimal},
+	"date_created": {Column: "date_created", Type: query.Time},
+	"date_updated": {Column: "date_updated", Type: query.Time},
+}
+
+// Query gets a page of orders from PostgreSQL DB defined by list query.
+// By default results are sorted by creation date, newest first.
+func (r *Postgre) Query(ctx context.Context, q query.Query) ([]entity.Order, query.Page, error) {
+	orders := []entity.Order{}
+
+	page, err := database.QueryPage(ctx, r.db, "orders", orderFields, "order_id", q, &orders)
+	if err != nil {
+		return nil, query.Page{}, errors.Wrap(err, "selecting orders")
+	}
+
+	return orders, page, nil
+}
+
+// Query gets an order from PostgreSQL DB by given id.
+// Deleted orders are not found.
+func (r *Postgre) QueryByID(ctx context.Context, id string) (entity.Order, error) {
 	const query = `
 	SELECT 
 		* 
 	FROM 
 		orders 
-	WHERE
-		order_id <= :last_seen_id
-	ORDER BY 
-		order_id DESC
-	FETCH FIRST :limit ROWS ONLY`
-
-	var orders []entity.Order
+	WHERE 
+		order_id = :order_id AND deleted_at IS NULL`
 
 	data := struct {
-		LastSeenID string `db:"last_seen_id"`
-		Limit      string `db:"limit"`
+		ID string `db:"order_id"`
 	}{
-		LastSeenID: lastSeenID,
-		Limit:      limit,
+		ID: id,
 	}
 
-	err := database.QuerySlice(ctx, r.db, query, data, &orders)
+	var order entity.Order
+
+	err := database.QueryStruct(ctx, r.db, query, data, &order)
 	if err != nil {
-		return []entity.Order{}, errors.Wrap(err, "selecting orders")
+		return entity.Order{}, errors.Wrapf(err, "getting an order with id %s", id)
 	}
 
-	return orders, nil
+	return order, nil
 }
 
-// Query gets an order from PostgreSQL DB by given id.
-func (r *Postgre) QueryByID(ctx context.Context, id string) (entity.Order, error) {
+// QueryByIDForUpdate gets an order from PostgreSQL DB by given id and locks it's row
+// until the end of surrounding transaction, so concurrent transactions can not change it meanwhile.
+// It should be called with a context that carries a transaction.
+func (r *Postgre) QueryByIDForUpdate(ctx context.Context, id string) (entity.Order, error) {
 	const query = `
 	SELECT 
 		* 
 	FROM 
 		orders 
 	WHERE 
-		order_id = :order_id`
+		order_id = :order_id AND deleted_at IS NULL
+	FOR UPDATE`
 
 	data := struct {
 		ID string `db:"order_id"`
@@ -103,7 +127,7 @@ func (r *Postgre) QueryByID(ctx context.Context, id string) (entity.Order, error
 
 	err := database.QueryStruct(ctx, r.db, query, data, &order)
 	if err != nil {
-		return entity.Order{}, errors.Wrapf(err, "getting an order with id %s", id)
+		return entity.Order{}, errors.Wrapf(err, "locking an order with id %s", id)
 	}
 
 	return order, nil
@@ -117,7 +141,7 @@ func (r *Postgre) QueryByUserID(ctx context.Context, userID string) ([]entity.Or
 	FROM 
 		orders 
 	WHERE 
-		user_id = :user_id`
+		user_id = :user_id AND deleted_at IS NULL`
 
 	data := struct {
 		UserID string `db:"user_id"`
@@ -125,7 +149,7 @@ func (r *Postgre) QueryByUserID(ctx context.Context, userID string) ([]entity.Or
 		UserID: userID,
 	}
 
-	var orders []entity.Order
+	orders := []entity.Order{}
 
 	err := database.QuerySlice(ctx, r.db, query, data, &orders)
 	if err != nil {
@@ -136,20 +160,26 @@ func (r *Postgre) QueryByUserID(ctx context.Context, userID string) ([]entity.Or
 }
 
 // Update updates a specific order inside PostgreSQL.
-func (r *Postgre) Update(ctx context.Context, id string, updateOrder entity.UpdateOrder) error {
+// Non zero version is a version of an order an update is based on,
+// if an order has a different one database.ErrVersionConflict is returned.
+func (r *Postgre) Update(ctx context.Context, id string, version int, updateOrder entity.UpdateOrder) error {
 	order, err := r.QueryByID(ctx, id)
 	if err != nil {
 		return errors.Wrapf(err, "error updating a order with id %s", id)
 	}
+	if version != 0 && order.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "updating an order with id %s", id)
+	}
 
 	const query = `
 	UPDATE 
 		orders
 	SET	
 		"status" = :status,
+		"version" = "version" + 1,
 		"date_updated" = :date_updated
 	WHERE 
-		order_id = :order_id`
+		order_id = :order_id AND "version" = :version`
 
 	// You should not update not updated order fields.
 	if updateOrder.Status != nil {
@@ -157,52 +187,245 @@ func (r *Postgre) Update(ctx context.Context, id string, updateOrder entity.Upda
 	}
 	order.DateUpdated = time.Now().UTC()
 
-	_, err = r.db.NamedExecContext(ctx, query, order)
-	if err != nil {
+	if err := database.NamedExecVersion(ctx, r.db, query, order); err != nil {
 		return errors.Wrapf(err, "updating an order with id %s", id)
 	}
 
 	return nil
 }
 
-// Delete an order from PostgreSQL DB by given order id.
-func (r *Postgre) Delete(ctx context.Context, id string) error {
+// UpdateTotals updates server-computed money amounts of a specific order inside PostgreSQL.
+func (r *Postgre) UpdateTotals(ctx context.Context, id string, totals entity.OrderTotals) error {
 	const query = `
-	DELETE FROM 
-		orders 
+	UPDATE 
+		orders
+	SET	
+		"subtotal" = :subtotal,
+		"tax" = :tax,
+		"total" = :total,
+		"version" = "version" + 1,
+		"date_updated" = :date_updated
 	WHERE 
 		order_id = :order_id`
 
 	data := struct {
 		ID string `db:"order_id"`
+		entity.OrderTotals
+		DateUpdated time.Time `db:"date_updated"`
 	}{
-		ID: id,
+		ID:          id,
+		OrderTotals: totals,
+		DateUpdated: time.Now().UTC(),
 	}
 
-	if _, err := r.db.NamedExecContext(ctx, query, data); err != nil {
+	if _, err := database.NamedExec(ctx, r.db, query, data); err != nil {
+		return errors.Wrapf(err, "updating totals of an order with id %s", id)
+	}
+
+	return nil
+}
+
+// Delete marks an order in PostgreSQL DB as deleted by given order id,
+// it is kept until Purge removes it, so it can be restored meanwhile.
+// Non zero version is a version of an order a client knows about,
+// if an order has a different one database.ErrVersionConflict is returned.
+func (r *Postgre) Delete(ctx context.Context, id string, version int) error {
+	order, err := r.QueryByID(ctx, id)
+	if err != nil {
+		return errors.Wrapf(err, "deleting an order with id %s", id)
+	}
+	if version != 0 && order.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "deleting an order with id %s", id)
+	}
+
+	const query = `
+	UPDATE 
+		orders 
+	SET
+		"deleted_at" = :deleted_at,
+		"version" = "version" + 1
+	WHERE 
+		order_id = :order_id AND "version" = :version`
+
+	data := struct {
+		ID        string    `db:"order_id"`
+		Version   int       `db:"version"`
+		DeletedAt time.Time `db:"deleted_at"`
+	}{
+		ID:        id,
+		Version:   order.Version,
+		DeletedAt: time.Now().UTC(),
+	}
+
+	if err := database.NamedExecVersion(ctx, r.db, query, data); err != nil {
 		return errors.Wrapf(err, "deleting an order with id %s", id)
 	}
 
 	return nil
 }
 
-// DeleteByUserID deletes orders from PostgreSQL DB by given user id.
+// DeleteByUserID marks orders in PostgreSQL DB as deleted by given user id.
 func (r *Postgre) DeleteByUserID(ctx context.Context, userID string) error {
 	const query = `
-	DELETE FROM 
+	UPDATE 
 		orders 
+	SET
+		"deleted_at" = :deleted_at,
+		"version" = "version" + 1
 	WHERE 
-		user_id = :user_id`
+		user_id = :user_id AND deleted_at IS NULL`
 
 	data := struct {
-		UserID string `db:"user_id"`
+		UserID    string    `db:"user_id"`
+		DeletedAt time.Time `db:"deleted_at"`
 	}{
-		UserID: userID,
+		UserID:    userID,
+		DeletedAt: time.Now().UTC(),
 	}
 
-	if _, err := r.db.NamedExecContext(ctx, query, data); err != nil {
+	if _, err := database.NamedExec(ctx, r.db, query, data); err != nil {
 		return errors.Wrapf(err, "deleting an order with user id %s", userID)
 	}
 
 	return nil
 }
+
+// CreateStatusChange appends a record about an order status transition into PostgreSQL DB.
+func (r *Postgre) CreateStatusChange(ctx context.Context, sc entity.OrderStatusChange) (entity.OrderStatusChange, error) {
+	const query = `
+	INSERT INTO order_status_history 
+		(order_status_change_id, order_id, from_status, to_status, actor, reason, date_created) 
+	VALUES
+		(:order_status_change_id, :order_id, :from_status, :to_status, :actor, :reason, :date_created)`
+
+	sc.ID = uuid.NewString()
+	sc.DateCreated = time.Now().UTC()
+
+	if _, err := database.NamedExec(ctx, r.db, query, sc); err != nil {
+		return entity.OrderStatusChange{}, errors.Wrapf(err, "inserting a status change for order with id %s", sc.OrderID)
+	}
+
+	return sc, nil
+}
+
+// QueryStatusHistory gets status transitions of an order from PostgreSQL DB sorted from oldest to newest.
+func (r *Postgre) QueryStatusHistory(ctx context.Context, orderID string) ([]entity.OrderStatusChange, error) {
+	const query = `
+	SELECT 
+		* 
+	FROM 
+		order_status_history 
+	WHERE 
+		order_id = :order_id
+	ORDER BY 
+		date_created`
+
+	data := struct {
+		OrderID string `db:"order_id"`
+	}{
+		OrderID: orderID,
+	}
+
+	var history []entity.OrderStatusChange
+
+	err := database.QuerySlice(ctx, r.db, query, data, &history)
+	if err != nil {
+		return []entity.OrderStatusChange{}, errors.Wrapf(err, "selecting status history for order with id %s", orderID)
+	}
+
+	return history, nil
+}
+
+// Restore restores a deleted order inside PostgreSQL by given order id.
+func (r *Postgre) Restore(ctx context.Context, id string) error {
+	const query = `
+	UPDATE 
+		orders 
+	SET
+		"deleted_at" = NULL,
+		"version" = "version" + 1,
+		"date_updated" = :date_updated
+	WHERE 
+		order_id = :order_id AND deleted_at IS NOT NULL`
+
+	data := struct {
+		ID          string    `db:"order_id"`
+		DateUpdated time.Time `db:"date_updated"`
+	}{
+		ID:          id,
+		DateUpdated: time.Now().UTC(),
+	}
+
+	res, err := database.NamedExec(ctx, r.db, query, data)
+	if err != nil {
+		return errors.Wrapf(err, "restoring an order with id %s", id)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "restoring an order with id %s", id)
+	}
+	if n == 0 {
+		return errors.Wrapf(database.ErrNotFound, "deleted order %s", id)
+	}
+
+	return nil
+}
+
+// RestoreByUserID restores orders of a user inside PostgreSQL that were deleted since given time,
+// orders deleted before it stay deleted.
+func (r *Postgre) RestoreByUserID(ctx context.Context, userID string, since time.Time) error {
+	const query = `
+	UPDATE 
+		orders 
+	SET
+		"deleted_at" = NULL,
+		"version" = "version" + 1,
+		"date_updated" = :date_updated
+	WHERE 
+		user_id = :user_id AND deleted_at >= :since`
+
+	data := struct {
+		UserID      string    `db:"user_id"`
+		Since       time.Time `db:"since"`
+		DateUpdated time.Time `db:"date_updated"`
+	}{
+		UserID:      userID,
+		Since:       since,
+		DateUpdated: time.Now().UTC(),
+	}
+
+	if _, err := database.NamedExec(ctx, r.db, query, data); err != nil {
+		return errors.Wrapf(err, "restoring orders for user with id %s", userID)
+	}
+
+	return nil
+}
+
+// Purge permanently removes orders from PostgreSQL DB that were deleted before given time,
+// items and status history of those orders are removed along with them.
+func (r *Postgre) Purge(ctx context.Context, before time.Time) (int64, error) {
+	const query = `
+	DELETE FROM 
+		orders 
+	WHERE 
+		deleted_at < :before`
+
+	data := struct {
+		Before time.Time `db:"before"`
+	}{
+		Before: before,
+	}
+
+	res, err := database.NamedExec(ctx, r.db, query, data)
+	if err != nil {
+		return 0, errors.Wrap(err, "purging deleted orders")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "purging deleted orders")
+	}
+
+	return n, nil
+}
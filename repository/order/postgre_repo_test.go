@@ -2,17 +2,12 @@ package order
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 	"testing"
 
-	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
-	"github.com/ory/dockertest/v3"
-	"github.com/ory/dockertest/v3/docker"
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/query"
 	"github.com/rtbe/clean-rest-api/internal/tests"
 	"github.com/rtbe/clean-rest-api/repository/user"
 )
@@ -23,74 +18,33 @@ var validUser entity.User
 var validOrder entity.Order
 
 func TestMain(m *testing.M) {
-	var err error
-	pool, err := dockertest.NewPool("")
+	db, purge, err := tests.NewPostgreSQL()
 	if err != nil {
-		log.Fatalf("could not connect to docker: %s", err)
+		log.Fatalf("could not start PostgreSQL: %s", err)
 	}
 
-	absFilepath, _ := filepath.Abs("../../internal/tests")
-	opts := dockertest.RunOptions{
-		Repository: "postgres",
-		Tag:        "12.3",
-		Env: []string{
-			"POSTGRES_USER=" + tests.PgUser,
-			"POSTGRES_PASSWORD=" + tests.PgPassword,
-			"POSTGRES_DB=" + tests.PgDB,
-		},
-		ExposedPorts: []string{"5432"},
-		PortBindings: map[docker.Port][]docker.PortBinding{
-			"5432": {
-				{HostIP: "0.0.0.0", HostPort: tests.PgPort},
-			},
-		},
-		Mounts: []string{absFilepath + ":/docker-entrypoint-initdb.d/"},
+	// Init global package dependencies after successfull connection to a database
+	pgOrderRepo = NewPostgreRepo(db, nil)
+	pgUserRepo = user.NewPostgreRepo(db, nil)
+
+	newUser := entity.NewUser{
+		UserName:        "AlanKay",
+		FirstName:       "Alan",
+		LastName:        "Kay",
+		Password:        "OOP_is_about_messages",
+		PasswordConfirm: "OOP_is_about_messages",
+		Email:           "AlanKay@zeroxparc.com",
+		Roles:           []string{"admin"},
 	}
-
-	resource, err := pool.RunWithOptions(&opts)
+	validUser, err = pgUserRepo.Create(context.Background(), newUser)
 	if err != nil {
-		log.Fatalf("could not start resource: %s", err)
-	}
-
-	if err = pool.Retry(func() error {
-		var err error
-		db, err := sqlx.Connect("postgres", fmt.Sprintf(
-			"postgres://%s:%s@localhost:%s/%s?sslmode=disable",
-			tests.PgUser,
-			tests.PgPassword,
-			resource.GetPort("5432/tcp"),
-			tests.PgDB,
-		))
-		if err != nil {
-			return err
-		}
-		// Init global package dependencies after successfull connection to a database
-		pgOrderRepo = NewPostgreRepo(db, nil)
-		pgUserRepo = user.NewPostgreRepo(db, nil)
-
-		newUser := entity.NewUser{
-			UserName:        "AlanKay",
-			FirstName:       "Alan",
-			LastName:        "Kay",
-			Password:        "OOP_is_about_messages",
-			PasswordConfirm: "OOP_is_about_messages",
-			Email:           "AlanKay@zeroxparc.com",
-			Roles:           []string{"admin"},
-		}
-		validUser, err = pgUserRepo.Create(context.Background(), newUser)
-		if err != nil {
-			return err
-		}
-
-		return db.Ping()
-	}); err != nil {
-		log.Fatalf("could not connect to docker: %s", err)
+		log.Fatalf("could not prepare test data: %s", err)
 	}
 
 	code := m.Run()
 
 	// When you're done, kill and remove the container
-	if err = pool.Purge(resource); err != nil {
+	if err = purge(); err != nil {
 		log.Fatalf("could not purge resource: %s", err)
 	}
 
@@ -104,7 +58,7 @@ func TestPostgre(t *testing.T) {
 			userID   string
 			status   string
 		}{
-			{testName: "Create an single order", userID: validUser.ID, status: "test"},
+			{testName: "Create an single order", userID: validUser.ID, status: entity.OrderStatusPending},
 		}
 
 		for testID, tc := range tt {
@@ -204,25 +158,32 @@ func TestPostgre(t *testing.T) {
 
 	t.Run("Given the need to query orders from PostgreSQL", func(t *testing.T) {
 		tt := []struct {
-			testName   string
-			lastSeenID string
-			limit      string
+			testName string
+			q        query.Query
+			wantID   string
 		}{
-			{testName: "List existing orders", lastSeenID: validOrder.ID, limit: "1"},
+			{
+				testName: "List existing orders",
+				q: query.Query{
+					Filters: []query.Filter{{Field: "order_id", Op: query.Eq, Value: validOrder.ID}},
+					Limit:   1,
+				},
+				wantID: validOrder.ID,
+			},
 		}
 		for testID, tc := range tt {
 			t.Run(tc.testName, func(t *testing.T) {
-				orders, err := pgOrderRepo.Query(context.Background(), tc.lastSeenID, tc.limit)
+				orders, _, err := pgOrderRepo.Query(context.Background(), tc.q)
 				if err != nil {
 					t.Fatalf("\t%s\tTest %d:\tShould be able to get a list of orders. Error: %s", tests.Failed, testID, err)
 				}
 				t.Logf("\t%s\tTest %d:\tShould be able to get a list of orders.", tests.Success, testID)
 
 				for _, order := range orders {
-					if tc.lastSeenID != order.ID {
-						t.Fatalf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Failed, testID, tc.lastSeenID, order.ID)
+					if tc.wantID != order.ID {
+						t.Fatalf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Failed, testID, tc.wantID, order.ID)
 					}
-					t.Logf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Success, testID, tc.lastSeenID, order.ID)
+					t.Logf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Success, testID, tc.wantID, order.ID)
 				}
 			})
 		}
@@ -238,14 +199,14 @@ func TestPostgre(t *testing.T) {
 				testName: "Update an order",
 				id:       validOrder.ID,
 				updateOrder: entity.UpdateOrder{
-					Status: tests.StrPtr("test"),
+					Status: tests.StrPtr(entity.OrderStatusPaid),
 				}},
 		}
 		for testID, tc := range tt {
 			t.Run(tc.testName, func(t *testing.T) {
 				ctx := context.Background()
 
-				err := pgOrderRepo.Update(ctx, tc.id, tc.updateOrder)
+				err := pgOrderRepo.Update(ctx, tc.id, 0, tc.updateOrder)
 				if err != nil {
 					t.Fatalf("\t%s\tTest %d:\tShould be able to update an order. Error: %s", tests.Failed, testID, err)
 				}
@@ -265,6 +226,59 @@ func TestPostgre(t *testing.T) {
 		}
 	})
 
+	t.Run("Given the need to record status history of an order inside PostgreSQL", func(t *testing.T) {
+		tt := []struct {
+			testName     string
+			statusChange entity.OrderStatusChange
+		}{
+			{
+				testName: "Record a status change",
+				statusChange: entity.OrderStatusChange{
+					OrderID:    validOrder.ID,
+					FromStatus: entity.OrderStatusPending,
+					ToStatus:   entity.OrderStatusPaid,
+					Actor:      validUser.ID,
+					Reason:     "test",
+				}},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				ctx := context.Background()
+
+				savedStatusChange, err := pgOrderRepo.CreateStatusChange(ctx, tc.statusChange)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to record a status change. Error: %s", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to record a status change.", tests.Success, testID)
+
+				history, err := pgOrderRepo.QueryStatusHistory(ctx, tc.statusChange.OrderID)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to get status history of an order. Error: %s", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to get status history of an order.", tests.Success, testID)
+
+				if len(history) == 0 || history[len(history)-1].ID != savedStatusChange.ID {
+					t.Fatalf("\t%s\tTest %d:\tWant last status change id: %s, got: %v", tests.Failed, testID, savedStatusChange.ID, history)
+				}
+				t.Logf("\t%s\tTest %d:\tWant last status change id: %s", tests.Success, testID, savedStatusChange.ID)
+
+				last := history[len(history)-1]
+				if tc.statusChange.ToStatus != last.ToStatus || tc.statusChange.Actor != last.Actor {
+					t.Fatalf("\t%s\tTest %d:\tWant status: %s by %s, got: %s by %s", tests.Failed, testID, tc.statusChange.ToStatus, tc.statusChange.Actor, last.ToStatus, last.Actor)
+				}
+				t.Logf("\t%s\tTest %d:\tWant status: %s by %s", tests.Success, testID, tc.statusChange.ToStatus, tc.statusChange.Actor)
+			})
+		}
+	})
+
+	t.Run("Given the need to keep orders within their lifecycle inside PostgreSQL", func(t *testing.T) {
+		_, err := pgOrderRepo.Create(context.Background(), entity.NewOrder{UserID: validUser.ID, Status: "lost"})
+		if err == nil {
+			t.Fatalf("\t%s\tShould not be able to create an order with a status out of a lifecycle.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould not be able to create an order with a status out of a lifecycle.", tests.Success)
+	})
+
 	t.Run("Given the need to delete an order from PostgreSQL by it`s id", func(t *testing.T) {
 		tt := []struct {
 			testName string
@@ -274,7 +288,7 @@ func TestPostgre(t *testing.T) {
 				testName: "Delete an existing order by it`s id",
 				newOrder: entity.NewOrder{
 					UserID: validUser.ID,
-					Status: "test",
+					Status: entity.OrderStatusPending,
 				}},
 		}
 
@@ -288,7 +302,7 @@ func TestPostgre(t *testing.T) {
 				}
 				t.Logf("\t%s\tTest %d:\tShould be able to create an order.", tests.Success, testID)
 
-				if err := pgOrderRepo.Delete(ctx, savedOrder.ID); err != nil {
+				if err := pgOrderRepo.Delete(ctx, savedOrder.ID, savedOrder.Version); err != nil {
 					t.Fatalf("\t%s\tTest %d:\tShould be able to delete an order by it`s id. Error: %s", tests.Failed, testID, err)
 				}
 				t.Logf("\t%s\tTest %d:\tShould be able to delete an order by it`s id.", tests.Success, testID)
@@ -305,7 +319,7 @@ func TestPostgre(t *testing.T) {
 				testName: "Delete existing products by their`s user id",
 				newOrder: entity.NewOrder{
 					UserID: validUser.ID,
-					Status: "test",
+					Status: entity.OrderStatusPending,
 				}},
 		}
 
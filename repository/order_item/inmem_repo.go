@@ -0,0 +1,282 @@
+package orderitem
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
+)
+
+// Orders is a part of order repository which InMemRepo uses to keep referential integrity.
+type Orders interface {
+	Query(ctx context.Context, q query.Query) ([]entity.Order, query.Page, error)
+}
+
+// InMemRepo is an abstraction layer that manages order item entities inside basic in-memory store (map+RWMutex).
+// It behaves as PostgreSQL repository does, but suits a single instance of an application, order items are lost on restart.
+type InMemRepo struct {
+	store  map[string]entity.OrderItem
+	orders Orders
+	sync.RWMutex
+}
+
+// NewInMemRepo creates a new in-memory repository for order item entity.
+// Items of orders that are purged from the given repository are purged too, it can be nil if there are no orders.
+func NewInMemRepo(orders Orders) *InMemRepo {
+	return &InMemRepo{
+		store:  make(map[string]entity.OrderItem),
+		orders: orders,
+	}
+}
+
+// Create a new order item for particular order in in-memory store.
+func (r *InMemRepo) Create(ctx context.Context, newOrderItem entity.NewOrderItem) (entity.OrderItem, error) {
+	orderItem := entity.OrderItem{
+		ID:           uuid.NewString(),
+		OrderID:      newOrderItem.OrderID,
+		ProductID:    newOrderItem.ProductID,
+		Quantity:     newOrderItem.Quantity,
+		UnitPrice:    newOrderItem.UnitPrice,
+		ProductTitle: newOrderItem.ProductTitle,
+		Version:      1,
+		DateCreated:  time.Now().UTC(),
+		DateUpdated:  time.Now().UTC(),
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.put(ctx, orderItem.ID, orderItem)
+
+	return orderItem, nil
+}
+
+// Query gets a page of order items from in-memory store defined by list query.
+// By default results are sorted by creation date, newest first.
+func (r *InMemRepo) Query(ctx context.Context, q query.Query) ([]entity.OrderItem, query.Page, error) {
+	r.RLock()
+	all := make([]entity.OrderItem, 0, len(r.store))
+	for _, oi := range r.store {
+		all = append(all, oi)
+	}
+	r.RUnlock()
+
+	items := []entity.OrderItem{}
+
+	page, err := database.SlicePage(all, orderItemFields, "order_item_id", q, &items)
+	if err != nil {
+		return nil, query.Page{}, errors.Wrap(err, "selecting order items")
+	}
+
+	return items, page, nil
+}
+
+// QueryByID gets an order item from in-memory store by given id.
+func (r *InMemRepo) QueryByID(ctx context.Context, id string) (entity.OrderItem, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	orderItem, ok := r.store[id]
+	if !ok || orderItem.DeletedAt != nil {
+		return entity.OrderItem{}, errors.Wrapf(database.ErrNotFound, "getting an order item with id %s", id)
+	}
+
+	return orderItem, nil
+}
+
+// QueryByOrderID gets all order items for particular order from in-memory store, oldest first.
+func (r *InMemRepo) QueryByOrderID(ctx context.Context, orderID string) ([]entity.OrderItem, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	var orderItems []entity.OrderItem
+	for _, oi := range r.store {
+		if oi.OrderID == orderID && oi.DeletedAt == nil {
+			orderItems = append(orderItems, oi)
+		}
+	}
+	sort.Slice(orderItems, func(i, j int) bool {
+		return orderItems[i].DateCreated.Before(orderItems[j].DateCreated)
+	})
+
+	return orderItems, nil
+}
+
+// Update an order item in in-memory store.
+// Non zero version is a version of an order item an update is based on,
+// if an order item has a different one database.ErrVersionConflict is returned.
+func (r *InMemRepo) Update(ctx context.Context, id string, version int, updateOrderItem entity.UpdateOrderItem) error {
+	r.Lock()
+	defer r.Unlock()
+
+	orderItem, ok := r.store[id]
+	if !ok || orderItem.DeletedAt != nil {
+		return errors.Wrapf(database.ErrNotFound, "updating an order item with id %s", id)
+	}
+	if version != 0 && orderItem.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "updating an order item with id %s", id)
+	}
+
+	if updateOrderItem.Quantity != nil {
+		orderItem.Quantity = *updateOrderItem.Quantity
+	}
+	orderItem.Version++
+	orderItem.DateUpdated = time.Now().UTC()
+	r.put(ctx, id, orderItem)
+
+	return nil
+}
+
+// Delete marks an order item in in-memory store as deleted by given order item id,
+// it is kept until Purge removes it, so it can be restored meanwhile.
+// Non zero version is a version of an order item a client knows about,
+// if an order item has a different one database.ErrVersionConflict is returned.
+func (r *InMemRepo) Delete(ctx context.Context, id string, version int) error {
+	r.Lock()
+	defer r.Unlock()
+
+	orderItem, ok := r.store[id]
+	if !ok || orderItem.DeletedAt != nil {
+		return errors.Wrapf(database.ErrNotFound, "deleting an order item with id %s", id)
+	}
+	if version != 0 && orderItem.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "deleting an order item with id %s", id)
+	}
+
+	now := time.Now().UTC()
+	orderItem.DeletedAt = &now
+	orderItem.Version++
+	r.put(ctx, id, orderItem)
+
+	return nil
+}
+
+// DeleteByOrderID marks order items in in-memory store as deleted by given order id.
+func (r *InMemRepo) DeleteByOrderID(ctx context.Context, orderID string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now().UTC()
+	for id, oi := range r.store {
+		if oi.OrderID == orderID && oi.DeletedAt == nil {
+			oi.DeletedAt = &now
+			oi.Version++
+			r.put(ctx, id, oi)
+		}
+	}
+
+	return nil
+}
+
+// Restore restores a deleted order item inside in-memory store by given order item id.
+func (r *InMemRepo) Restore(ctx context.Context, id string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	orderItem, ok := r.store[id]
+	if !ok || orderItem.DeletedAt == nil {
+		return errors.Wrapf(database.ErrNotFound, "deleted order item %s", id)
+	}
+
+	orderItem.DeletedAt = nil
+	orderItem.Version++
+	orderItem.DateUpdated = time.Now().UTC()
+	r.put(ctx, id, orderItem)
+
+	return nil
+}
+
+// RestoreByOrderID restores order items of an order inside in-memory store that were deleted since given time,
+// items deleted before it stay deleted.
+func (r *InMemRepo) RestoreByOrderID(ctx context.Context, orderID string, since time.Time) error {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now().UTC()
+	for id, oi := range r.store {
+		if oi.OrderID == orderID && oi.DeletedAt != nil && !oi.DeletedAt.Before(since) {
+			oi.DeletedAt = nil
+			oi.Version++
+			oi.DateUpdated = now
+			r.put(ctx, id, oi)
+		}
+	}
+
+	return nil
+}
+
+// Purge permanently removes order items from in-memory store that were deleted before given time.
+// Items of orders that are no longer in an order repository are removed as well, since PostgreSQL
+// removes them along with their orders. PurgeService purges items before orders,
+// so items of an order purged in one run are removed in the next one.
+func (r *InMemRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	orphans := make(map[string]bool)
+	if r.orders != nil {
+		for _, oi := range r.store {
+			if _, checked := orphans[oi.OrderID]; checked {
+				continue
+			}
+
+			orders, _, err := r.orders.Query(ctx, query.Query{
+				Filters:        []query.Filter{{Field: "order_id", Op: query.Eq, Value: oi.OrderID}},
+				Limit:          1,
+				IncludeDeleted: true,
+			})
+			if err != nil {
+				return 0, errors.Wrap(err, "purging deleted order items")
+			}
+			orphans[oi.OrderID] = len(orders) == 0
+		}
+	}
+
+	var n int64
+	for id, oi := range r.store {
+		if orphans[oi.OrderID] || oi.DeletedAt != nil && oi.DeletedAt.Before(before) {
+			r.remove(ctx, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// put stores an order item by id within in-memory store,
+// if a transaction carried by ctx fails a previous state of it is restored.
+// It must be called with the lock held.
+func (r *InMemRepo) put(ctx context.Context, id string, v entity.OrderItem) {
+	r.journal(ctx, id)
+	r.store[id] = v
+}
+
+// remove removes an order item by id from in-memory store,
+// if a transaction carried by ctx fails it is restored.
+// It must be called with the lock held.
+func (r *InMemRepo) remove(ctx context.Context, id string) {
+	r.journal(ctx, id)
+	delete(r.store, id)
+}
+
+// journal registers restoration of current state of an order item by id if a transaction carried by ctx fails.
+func (r *InMemRepo) journal(ctx context.Context, id string) {
+	prev, existed := r.store[id]
+	transaction.OnRollback(ctx, func() {
+		r.Lock()
+		defer r.Unlock()
+
+		if existed {
+			r.store[id] = prev
+			return
+		}
+		delete(r.store, id)
+	})
+}
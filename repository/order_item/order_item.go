@@ -4,8 +4,10 @@ package orderitem
 
 import (
 	"context"
+	"time"
 
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/query"
 )
 
 // Repository is an interface that represents persistent storage abstraction.
@@ -13,10 +15,13 @@ import (
 // so concrete implementation of database should implements the set of these methods.
 type Repository interface {
 	Create(ctx context.Context, newOrderItem entity.NewOrderItem) (entity.OrderItem, error)
-	Query(ctx context.Context, lastSeenID, limit string) ([]entity.OrderItem, error)
+	Query(ctx context.Context, q query.Query) ([]entity.OrderItem, query.Page, error)
 	QueryByID(ctx context.Context, id string) (entity.OrderItem, error)
 	QueryByOrderID(ctx context.Context, orderID string) ([]entity.OrderItem, error)
-	Update(ctx context.Context, id string, updateOrderItem entity.UpdateOrderItem) error
-	Delete(ctx context.Context, id string) error
+	Update(ctx context.Context, id string, version int, updateOrderItem entity.UpdateOrderItem) error
+	Delete(ctx context.Context, id string, version int) error
 	DeleteByOrderID(ctx context.Context, orderID string) error
+	Restore(ctx context.Context, id string) error
+	RestoreByOrderID(ctx context.Context, orderID string, since time.Time) error
+	Purge(ctx context.Context, before time.Time) (int64, error)
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/rtbe/clean-rest-api/domain/entity"
 	"github.com/rtbe/clean-rest-api/internal/database"
 	"github.com/rtbe/clean-rest-api/internal/logger"
+	"github.com/rtbe/clean-rest-api/internal/query"
 )
 
 // Postgre is an abstraction layer that manages product item entities inside PostgreSQL DB.
@@ -31,57 +32,52 @@ func NewPostgreRepo(db *sqlx.DB, l logger.Logger) *Postgre {
 func (r *Postgre) Create(ctx context.Context, newOrderItem entity.NewOrderItem) (entity.OrderItem, error) {
 	const query = `
 	INSERT INTO order_items
-		(order_item_id, order_id, product_id, quantity, date_created, date_updated) 
+		(order_item_id, order_id, product_id, quantity, unit_price, product_title, version, date_created, date_updated) 
 	VALUES
-		(:order_item_id, :order_id, :product_id , :quantity, :date_created, :date_updated)`
+		(:order_item_id, :order_id, :product_id , :quantity, :unit_price, :product_title, :version, :date_created, :date_updated)`
 
 	orderItem := entity.OrderItem{
-		ID:          uuid.NewString(),
-		OrderID:     newOrderItem.OrderID,
-		ProductID:   newOrderItem.ProductID,
-		Quantity:    newOrderItem.Quantity,
-		DateCreated: time.Now().UTC(),
-		DateUpdated: time.Now().UTC(),
+		ID:           uuid.NewString(),
+		OrderID:      newOrderItem.OrderID,
+		ProductID:    newOrderItem.ProductID,
+		Quantity:     newOrderItem.Quantity,
+		UnitPrice:    newOrderItem.UnitPrice,
+		ProductTitle: newOrderItem.ProductTitle,
+		Version:      1,
+		DateCreated:  time.Now().UTC(),
+		DateUpdated:  time.Now().UTC(),
 	}
 
-	if _, err := r.db.NamedExecContext(ctx, query, orderItem); err != nil {
+	if _, err := database.NamedExec(ctx, r.db, query, orderItem); err != nil {
 		return entity.OrderItem{}, errors.Wrap(err, "inserting an order item")
 	}
 
 	return orderItem, nil
 }
 
-// Query gets order items from PostgreSQL DB.
-// This query uses two provided values to implement pagination: last seen id and limit.
-// Results of a query sorted by creation date of selected users.
-func (r *Postgre) Query(ctx context.Context, lastSeenID, limit string) ([]entity.OrderItem, error) {
-	const query = `
-	SELECT 
-		* 
-	FROM 
-		order_items 
-	WHERE
-		order_item_id <= :last_seen_id
-	ORDER BY 
-		order_item_id DESC
-	FETCH FIRST :limit ROWS ONLY`
+// orderItemFields is a whitelist of order items fields that can be used in list queries.
+var orderItemFields = query.Fields{
+	"order_item_id": {Column: "order_item_id", Type: query.UUID},
+	"order_id":      {Column: "order_id", Type: query.UUID},
+	"product_id":    {Column: "product_id", Type: query.UUID},
+	"quantity":      {Column: "quantity", Type: query.Int},
+	"unit_price":    {Column: "unit_price", Type: query.Decimal},
+	"product_title": {Column: "product_title", Type: query.String},
+	"date_created":  {Column: "date_created", Type: query.Time},
+	"date_updated":  {Column: "date_updated", Type: query.Time},
+}
 
-	var orderItems []entity.OrderItem
+// Query gets a page of order items from PostgreSQL DB defined by list query.
+// By default results are sorted by creation date, newest first.
+func (r *Postgre) Query(ctx context.Context, q query.Query) ([]entity.OrderItem, query.Page, error) {
+	items := []entity.OrderItem{}
 
-	data := struct {
-		LastSeenID string `db:"last_seen_id"`
-		Limit      string `db:"limit"`
-	}{
-		LastSeenID: lastSeenID,
-		Limit:      limit,
-	}
-
-	err := database.QuerySlice(ctx, r.db, query, data, &orderItems)
+	page, err := database.QueryPage(ctx, r.db, "order_items", orderItemFields, "order_item_id", q, &items)
 	if err != nil {
-		return nil, errors.Wrap(err, "selecting order items")
+		return nil, query.Page{}, errors.Wrap(err, "selecting order items")
 	}
 
-	return orderItems, nil
+	return items, page, nil
 }
 
 // QueryByID gets an order item from PostgreSQL DB by given id.
@@ -92,7 +88,7 @@ func (r *Postgre) QueryByID(ctx context.Context, id string) (entity.OrderItem, e
 	FROM 
 		order_items 
 	WHERE 
-		order_item_id = :order_item_id`
+		order_item_id = :order_item_id AND deleted_at IS NULL`
 
 	data := struct {
 		ID string `db:"order_item_id"`
@@ -118,7 +114,7 @@ func (r *Postgre) QueryByOrderID(ctx context.Context, orderID string) ([]entity.
 	FROM 
 		order_items 
 	WHERE 
-		order_id = :order_id 
+		order_id = :order_id AND deleted_at IS NULL 
 	ORDER BY 
 		date_created`
 
@@ -139,72 +135,193 @@ func (r *Postgre) QueryByOrderID(ctx context.Context, orderID string) ([]entity.
 }
 
 // Update an order item in PostgreSQL DB.
-func (r *Postgre) Update(ctx context.Context, id string, updateOrderItem entity.UpdateOrderItem) error {
+// Non zero version is a version of an order item an update is based on,
+// if an order item has a different one database.ErrVersionConflict is returned.
+func (r *Postgre) Update(ctx context.Context, id string, version int, updateOrderItem entity.UpdateOrderItem) error {
 	orderItem, err := r.QueryByID(ctx, id)
 	if err != nil {
 		return errors.Wrapf(err, "updating an order item with id %s", id)
 	}
+	if version != 0 && orderItem.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "updating an order item with id %s", id)
+	}
 
 	const query = `
 	UPDATE 
 		order_items 
 	SET	
 		"quantity" = :quantity,		
+		"version" = "version" + 1,
 		"date_updated" = :date_updated 
 	WHERE
-		order_item_id = :order_item_id`
+		order_item_id = :order_item_id AND "version" = :version`
 
 	if updateOrderItem.Quantity != nil {
 		orderItem.Quantity = *updateOrderItem.Quantity
 	}
 	orderItem.DateUpdated = time.Now().UTC()
 
-	_, err = r.db.NamedExecContext(ctx, query, orderItem)
-	if err != nil {
+	if err := database.NamedExecVersion(ctx, r.db, query, orderItem); err != nil {
 		return errors.Wrapf(err, "updating an order item with id %s", id)
 	}
 
 	return nil
 }
 
-// Delete an order item from PostgreSQL DB by given order item id.
-func (r *Postgre) Delete(ctx context.Context, id string) error {
+// Delete marks an order item in PostgreSQL DB as deleted by given order item id,
+// it is kept until Purge removes it, so it can be restored meanwhile.
+// Non zero version is a version of an order item a client knows about,
+// if an order item has a different one database.ErrVersionConflict is returned.
+func (r *Postgre) Delete(ctx context.Context, id string, version int) error {
+	orderItem, err := r.QueryByID(ctx, id)
+	if err != nil {
+		return errors.Wrapf(err, "deleting an order item with id %s", id)
+	}
+	if version != 0 && orderItem.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "deleting an order item with id %s", id)
+	}
+
 	const query = `
-	DELETE FROM 
+	UPDATE 
 		order_items 
+	SET
+		"deleted_at" = :deleted_at,
+		"version" = "version" + 1
 	WHERE 
-		order_item_id = :order_item_id`
+		order_item_id = :order_item_id AND "version" = :version`
 
 	data := struct {
-		ID string `db:"order_item_id"`
+		ID        string    `db:"order_item_id"`
+		Version   int       `db:"version"`
+		DeletedAt time.Time `db:"deleted_at"`
 	}{
-		ID: id,
+		ID:        id,
+		Version:   orderItem.Version,
+		DeletedAt: time.Now().UTC(),
 	}
 
-	if _, err := r.db.NamedExecContext(ctx, query, data); err != nil {
+	if err := database.NamedExecVersion(ctx, r.db, query, data); err != nil {
 		return errors.Wrapf(err, "deleting an order item with id %s", id)
 	}
 
 	return nil
 }
 
-// DeleteByOrderID deletes order items from PostgreSQL DB by given order id.
+// DeleteByOrderID marks order items in PostgreSQL DB as deleted by given order id.
 func (r *Postgre) DeleteByOrderID(ctx context.Context, orderID string) error {
 	const query = `
-	DELETE FROM 
+	UPDATE 
 		order_items 
+	SET
+		"deleted_at" = :deleted_at,
+		"version" = "version" + 1
 	WHERE 
-		order_id = :order_id`
+		order_id = :order_id AND deleted_at IS NULL`
 
 	data := struct {
-		OrderID string `db:"order_id"`
+		OrderID   string    `db:"order_id"`
+		DeletedAt time.Time `db:"deleted_at"`
 	}{
-		OrderID: orderID,
+		OrderID:   orderID,
+		DeletedAt: time.Now().UTC(),
 	}
 
-	if _, err := r.db.NamedExecContext(ctx, query, data); err != nil {
+	if _, err := database.NamedExec(ctx, r.db, query, data); err != nil {
 		return errors.Wrapf(err, "deleting order items for order with id %s", orderID)
 	}
 
 	return nil
 }
+
+// Restore restores a deleted order item inside PostgreSQL by given order item id.
+func (r *Postgre) Restore(ctx context.Context, id string) error {
+	const query = `
+	UPDATE 
+		order_items 
+	SET
+		"deleted_at" = NULL,
+		"version" = "version" + 1,
+		"date_updated" = :date_updated
+	WHERE 
+		order_item_id = :order_item_id AND deleted_at IS NOT NULL`
+
+	data := struct {
+		ID          string    `db:"order_item_id"`
+		DateUpdated time.Time `db:"date_updated"`
+	}{
+		ID:          id,
+		DateUpdated: time.Now().UTC(),
+	}
+
+	res, err := database.NamedExec(ctx, r.db, query, data)
+	if err != nil {
+		return errors.Wrapf(err, "restoring an order item with id %s", id)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "restoring an order item with id %s", id)
+	}
+	if n == 0 {
+		return errors.Wrapf(database.ErrNotFound, "deleted order item %s", id)
+	}
+
+	return nil
+}
+
+// RestoreByOrderID restores order items of an order inside PostgreSQL that were deleted since given time,
+// items deleted before it stay deleted.
+func (r *Postgre) RestoreByOrderID(ctx context.Context, orderID string, since time.Time) error {
+	const query = `
+	UPDATE 
+		order_items 
+	SET
+		"deleted_at" = NULL,
+		"version" = "version" + 1,
+		"date_updated" = :date_updated
+	WHERE 
+		order_id = :order_id AND deleted_at >= :since`
+
+	data := struct {
+		OrderID     string    `db:"order_id"`
+		Since       time.Time `db:"since"`
+		DateUpdated time.Time `db:"date_updated"`
+	}{
+		OrderID:     orderID,
+		Since:       since,
+		DateUpdated: time.Now().UTC(),
+	}
+
+	if _, err := database.NamedExec(ctx, r.db, query, data); err != nil {
+		return errors.Wrapf(err, "restoring order items for order with id %s", orderID)
+	}
+
+	return nil
+}
+
+// Purge permanently removes order items from PostgreSQL DB that were deleted before given time.
+func (r *Postgre) Purge(ctx context.Context, before time.Time) (int64, error) {
+	const query = `
+	DELETE FROM 
+		order_items 
+	WHERE 
+		deleted_at < :before`
+
+	data := struct {
+		Before time.Time `db:"before"`
+	}{
+		Before: before,
+	}
+
+	res, err := database.NamedExec(ctx, r.db, query, data)
+	if err != nil {
+		return 0, errors.Wrap(err, "purging deleted order items")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "purging deleted order items")
+	}
+
+	return n, nil
+}
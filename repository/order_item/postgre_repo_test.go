@@ -2,17 +2,12 @@ package orderitem
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 	"testing"
 
-	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
-	"github.com/ory/dockertest/v3"
-	"github.com/ory/dockertest/v3/docker"
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/query"
 	"github.com/rtbe/clean-rest-api/internal/tests"
 	"github.com/rtbe/clean-rest-api/repository/order"
 	"github.com/rtbe/clean-rest-api/repository/product"
@@ -29,97 +24,56 @@ var validOrder entity.Order
 var validOrderItem entity.OrderItem
 
 func TestMain(m *testing.M) {
-	var err error
-	pool, err := dockertest.NewPool("")
+	db, purge, err := tests.NewPostgreSQL()
 	if err != nil {
-		log.Fatalf("could not connect to docker: %s", err)
+		log.Fatalf("could not start PostgreSQL: %s", err)
 	}
 
-	absFilepath, _ := filepath.Abs("../../internal/tests")
-	opts := dockertest.RunOptions{
-		Repository: "postgres",
-		Tag:        "12.3",
-		Env: []string{
-			"POSTGRES_USER=" + tests.PgUser,
-			"POSTGRES_PASSWORD=" + tests.PgPassword,
-			"POSTGRES_DB=" + tests.PgDB,
-		},
-		ExposedPorts: []string{"5432"},
-		PortBindings: map[docker.Port][]docker.PortBinding{
-			"5432": {
-				{HostIP: "0.0.0.0", HostPort: tests.PgPort},
-			},
-		},
-		Mounts: []string{absFilepath + ":/docker-entrypoint-initdb.d/"},
+	// Init global package dependencies after successfull connection to a database
+	pgUserRepo = user.NewPostgreRepo(db, nil)
+	pgProductRepo = product.NewPostgreRepo(db, nil)
+	pgOrderRepo = order.NewPostgreRepo(db, nil)
+	pgOrderItemRepo = NewPostgreRepo(db, nil)
+
+	ctx := context.Background()
+	newUser := entity.NewUser{
+		UserName:        "AlanKay",
+		FirstName:       "Alan",
+		LastName:        "Kay",
+		Password:        "OOP_is_about_messages",
+		PasswordConfirm: "OOP_is_about_messages",
+		Email:           "AlanKay@zeroxparc.com",
+		Roles:           []string{"admin"},
 	}
-
-	resource, err := pool.RunWithOptions(&opts)
+	validUser, err = pgUserRepo.Create(ctx, newUser)
 	if err != nil {
-		log.Fatalf("could not start resource: %s", err)
+		log.Fatalf("could not prepare test data: %s", err)
 	}
 
-	if err = pool.Retry(func() error {
-		var err error
-		db, err := sqlx.Connect("postgres", fmt.Sprintf(
-			"postgres://%s:%s@localhost:%s/%s?sslmode=disable",
-			tests.PgUser,
-			tests.PgPassword,
-			resource.GetPort("5432/tcp"),
-			tests.PgDB,
-		))
-		if err != nil {
-			return err
-		}
-		// Init global package dependencies after successfull connection to a database
-		pgUserRepo = user.NewPostgreRepo(db, nil)
-		pgProductRepo = product.NewPostgreRepo(db, nil)
-		pgOrderRepo = order.NewPostgreRepo(db, nil)
-		pgOrderItemRepo = NewPostgreRepo(db, nil)
-
-		ctx := context.Background()
-		newUser := entity.NewUser{
-			UserName:        "AlanKay",
-			FirstName:       "Alan",
-			LastName:        "Kay",
-			Password:        "OOP_is_about_messages",
-			PasswordConfirm: "OOP_is_about_messages",
-			Email:           "AlanKay@zeroxparc.com",
-			Roles:           []string{"admin"},
-		}
-		validUser, err = pgUserRepo.Create(ctx, newUser)
-		if err != nil {
-			return err
-		}
-
-		newProduct := entity.NewProduct{
-			Title:       "Apple Juice",
-			Description: "Just an apple juice",
-			Price:       1.01,
-			Stock:       10,
-		}
-		validProduct, err = pgProductRepo.Create(ctx, newProduct)
-		if err != nil {
-			return err
-		}
-
-		newOrder := entity.NewOrder{
-			UserID: validUser.ID,
-			Status: "test",
-		}
-		validOrder, err = pgOrderRepo.Create(ctx, newOrder)
-		if err != nil {
-			return err
-		}
+	newProduct := entity.NewProduct{
+		Title:       "Apple Juice",
+		Description: "Just an apple juice",
+		Price:       101,
+		Stock:       10,
+	}
+	validProduct, err = pgProductRepo.Create(ctx, newProduct)
+	if err != nil {
+		log.Fatalf("could not prepare test data: %s", err)
+	}
 
-		return db.Ping()
-	}); err != nil {
-		log.Fatalf("could not connect to docker: %s", err)
+	newOrder := entity.NewOrder{
+		UserID: validUser.ID,
+		Status: entity.OrderStatusPending,
+	}
+	validOrder, err = pgOrderRepo.Create(ctx, newOrder)
+	if err != nil {
+		log.Fatalf("could not prepare test data: %s", err)
 	}
 
 	code := m.Run()
 
 	// When you're done, kill and remove the container
-	if err = pool.Purge(resource); err != nil {
+	if err = purge(); err != nil {
 		log.Fatalf("could not purge resource: %s", err)
 	}
 
@@ -133,16 +87,20 @@ func TestPostgre(t *testing.T) {
 			orderID   string
 			productID string
 			quantity  int
+			unitPrice entity.Money
+			title     string
 		}{
-			{testName: "Create an order item", orderID: validOrder.ID, productID: validProduct.ID, quantity: 10},
+			{testName: "Create an order item", orderID: validOrder.ID, productID: validProduct.ID, quantity: 10, unitPrice: validProduct.Price, title: validProduct.Title},
 		}
 
 		for testID, tc := range tt {
 			t.Run(tc.testName, func(t *testing.T) {
 				newOrderItem := entity.NewOrderItem{
-					OrderID:   tc.orderID,
-					ProductID: tc.productID,
-					Quantity:  tc.quantity,
+					OrderID:      tc.orderID,
+					ProductID:    tc.productID,
+					Quantity:     tc.quantity,
+					UnitPrice:    tc.unitPrice,
+					ProductTitle: tc.title,
 				}
 
 				savedOrderItem, err := pgOrderItemRepo.Create(context.Background(), newOrderItem)
@@ -161,6 +119,16 @@ func TestPostgre(t *testing.T) {
 				}
 				t.Logf("\t%s\tTest %d:\tWant product id: %s, got: %s", tests.Success, testID, newOrderItem.ProductID, savedOrderItem.ProductID)
 
+				retrievedOrderItem, err := pgOrderItemRepo.QueryByID(context.Background(), savedOrderItem.ID)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to get an order item by it`s id. Error: %s", tests.Failed, testID, err)
+				}
+
+				if tc.unitPrice != retrievedOrderItem.UnitPrice || tc.title != retrievedOrderItem.ProductTitle {
+					t.Fatalf("\t%s\tTest %d:\tWant snapshot: %s %s, got: %s %s", tests.Failed, testID, tc.title, tc.unitPrice, retrievedOrderItem.ProductTitle, retrievedOrderItem.UnitPrice)
+				}
+				t.Logf("\t%s\tTest %d:\tWant snapshot: %s %s", tests.Success, testID, tc.title, tc.unitPrice)
+
 				// Save product as valid product for further testing
 				validOrderItem = savedOrderItem
 			})
@@ -169,25 +137,32 @@ func TestPostgre(t *testing.T) {
 
 	t.Run("Given the need to query order items from PostgreSQL", func(t *testing.T) {
 		tt := []struct {
-			testName   string
-			lastSeenID string
-			limit      string
+			testName string
+			q        query.Query
+			wantID   string
 		}{
-			{testName: "list existing order items", lastSeenID: validOrderItem.ID, limit: "1"},
+			{
+				testName: "list existing order items",
+				q: query.Query{
+					Filters: []query.Filter{{Field: "order_item_id", Op: query.Eq, Value: validOrderItem.ID}},
+					Limit:   1,
+				},
+				wantID: validOrderItem.ID,
+			},
 		}
 		for testID, tc := range tt {
 			t.Run(tc.testName, func(t *testing.T) {
-				orderItems, err := pgOrderItemRepo.Query(context.Background(), tc.lastSeenID, tc.limit)
+				orderItems, _, err := pgOrderItemRepo.Query(context.Background(), tc.q)
 				if err != nil {
 					t.Fatalf("\t%s\tTest %d:\tShould be able to get a list of order items. Error: %s", tests.Failed, testID, err)
 				}
 				t.Logf("\t%s\tTest %d:\tShould be able to get a list of order items.", tests.Success, testID)
 
 				for _, orderItem := range orderItems {
-					if tc.lastSeenID != orderItem.ID {
-						t.Fatalf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Failed, testID, tc.lastSeenID, orderItem.ID)
+					if tc.wantID != orderItem.ID {
+						t.Fatalf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Failed, testID, tc.wantID, orderItem.ID)
 					}
-					t.Logf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Success, testID, tc.lastSeenID, orderItem.ID)
+					t.Logf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Success, testID, tc.wantID, orderItem.ID)
 				}
 			})
 		}
@@ -276,7 +251,7 @@ func TestPostgre(t *testing.T) {
 			t.Run(tc.testName, func(t *testing.T) {
 				ctx := context.Background()
 
-				err := pgOrderItemRepo.Update(ctx, tc.id, tc.updateOrderItem)
+				err := pgOrderItemRepo.Update(ctx, tc.id, 0, tc.updateOrderItem)
 				if err != nil {
 					t.Fatalf("\t%s\tTest %d:\tShould be able to update a order item. Error: %s", tests.Failed, testID, err)
 				}
@@ -320,7 +295,7 @@ func TestPostgre(t *testing.T) {
 				}
 				t.Logf("\t%s\tTest %d:\tShould be able to create a order item.", tests.Success, testID)
 
-				if err := pgOrderItemRepo.Delete(ctx, savedOrderItem.ID); err != nil {
+				if err := pgOrderItemRepo.Delete(ctx, savedOrderItem.ID, savedOrderItem.Version); err != nil {
 					t.Fatalf("\t%s\tTest %d:\tShould be able to delete a order item by it`s id. Error: %s", tests.Failed, testID, err)
 				}
 				t.Logf("\t%s\tTest %d:\tShould be able to delete a order item by it`s id.", tests.Success, testID)
@@ -0,0 +1,133 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
+)
+
+// InMemRepo is an abstraction layer that manages outbox events inside basic in-memory store (slice+RWMutex).
+// It suits a single instance of an application, unpublished events are lost on restart.
+type InMemRepo struct {
+	events []entity.Event
+	sync.RWMutex
+}
+
+// NewInMemRepo creates a new in-memory repository for Event entity.
+func NewInMemRepo() *InMemRepo {
+	return &InMemRepo{}
+}
+
+// Create writes a new event into outbox in in-memory store.
+// Events are kept in order they were written, so a sequence of an event is its position in the outbox.
+// An event is removed if a transaction carried by ctx fails, along with a change it tells about.
+func (r *InMemRepo) Create(ctx context.Context, ne entity.NewEvent) (entity.Event, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now().UTC()
+	e := entity.Event{
+		ID:            uuid.NewString(),
+		Sequence:      int64(len(r.events) + 1),
+		AggregateType: ne.AggregateType,
+		AggregateID:   ne.AggregateID,
+		Type:          ne.Type,
+		Payload:       ne.Payload,
+		NextAttemptAt: now,
+		DateCreated:   now,
+	}
+	r.events = append(r.events, e)
+	transaction.OnRollback(ctx, func() {
+		r.Lock()
+		defer r.Unlock()
+
+		for i := range r.events {
+			if r.events[i].ID == e.ID {
+				r.events = append(r.events[:i], r.events[i+1:]...)
+				return
+			}
+		}
+	})
+
+	return e, nil
+}
+
+// QueryPending gets the oldest unpublished event of every aggregate which next attempt is due from in-memory store.
+func (r *InMemRepo) QueryPending(ctx context.Context, now time.Time, limit int) ([]entity.Event, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	events := []entity.Event{}
+	seen := make(map[string]bool)
+	for _, e := range r.events {
+		if len(events) == limit {
+			break
+		}
+		if e.PublishedAt != nil {
+			continue
+		}
+
+		aggregate := e.AggregateType + "/" + e.AggregateID
+		if seen[aggregate] {
+			continue
+		}
+		seen[aggregate] = true
+
+		if !e.NextAttemptAt.After(now) {
+			events = append(events, e)
+		}
+	}
+
+	return events, nil
+}
+
+// MarkPublished marks an event as published in in-memory store.
+func (r *InMemRepo) MarkPublished(ctx context.Context, id string, publishedAt time.Time) error {
+	r.Lock()
+	defer r.Unlock()
+
+	for i := range r.events {
+		if r.events[i].ID == id {
+			r.journal(ctx, r.events[i])
+			r.events[i].PublishedAt = &publishedAt
+		}
+	}
+
+	return nil
+}
+
+// MarkFailed records a failed attempt to publish an event in in-memory store and schedules the next one.
+func (r *InMemRepo) MarkFailed(ctx context.Context, id string, nextAttemptAt time.Time, lastError string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	for i := range r.events {
+		if r.events[i].ID == id {
+			r.journal(ctx, r.events[i])
+			r.events[i].Attempts++
+			r.events[i].LastError = lastError
+			r.events[i].NextAttemptAt = nextAttemptAt
+		}
+	}
+
+	return nil
+}
+
+// journal registers restoration of a given state of an event if a transaction carried by ctx fails.
+func (r *InMemRepo) journal(ctx context.Context, prev entity.Event) {
+	transaction.OnRollback(ctx, func() {
+		r.Lock()
+		defer r.Unlock()
+
+		for i := range r.events {
+			if r.events[i].ID == prev.ID {
+				r.events[i] = prev
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,24 @@
+// Package outbox is responsible for managing domain events waiting to be published in database-agnostic way.
+// This package defines repository interface for abstracting interaction with particular database.
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+)
+
+// Repository is an interface that represents persistent storage abstraction.
+// This is a port in hexagonal architecture terms,
+// so concrete implementation of database should implements the set of these methods.
+//
+// QueryPending returns only the oldest unpublished event of every aggregate that is due to be published,
+// so events of an aggregate are never published out of order.
+// Returned events are locked until a transaction carried by the given context ends.
+type Repository interface {
+	Create(ctx context.Context, newEvent entity.NewEvent) (entity.Event, error)
+	QueryPending(ctx context.Context, now time.Time, limit int) ([]entity.Event, error)
+	MarkPublished(ctx context.Context, id string, publishedAt time.Time) error
+	MarkFailed(ctx context.Context, id string, nextAttemptAt time.Time, lastError string) error
+}
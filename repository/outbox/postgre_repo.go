@@ -0,0 +1,149 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+)
+
+// Postgre is an abstraction layer that manages outbox events inside PostgreSQL DB.
+type Postgre struct {
+	db  *sqlx.DB
+	log logger.Logger
+}
+
+// NewPostgreRepo creates a new PostgreSQL repository for Event entity.
+func NewPostgreRepo(db *sqlx.DB, l logger.Logger) *Postgre {
+	return &Postgre{
+		db:  db,
+		log: l,
+	}
+}
+
+// Create writes a new event into outbox in PostgreSQL.
+// If the given context carries a transaction an event is written within it,
+// so an event is published only if a change it describes is committed.
+func (r *Postgre) Create(ctx context.Context, ne entity.NewEvent) (entity.Event, error) {
+	const q = `
+	INSERT INTO outbox_events
+		(event_id, aggregate_type, aggregate_id, event_type, payload, next_attempt_at, date_created)
+	VALUES
+		(:event_id, :aggregate_type, :aggregate_id, :event_type, :payload, :next_attempt_at, :date_created)
+	RETURNING
+		*`
+
+	now := time.Now().UTC()
+	data := entity.Event{
+		ID:            uuid.NewString(),
+		AggregateType: ne.AggregateType,
+		AggregateID:   ne.AggregateID,
+		Type:          ne.Type,
+		Payload:       ne.Payload,
+		NextAttemptAt: now,
+		DateCreated:   now,
+	}
+
+	var e entity.Event
+	if err := database.QueryStruct(ctx, r.db, q, data, &e); err != nil {
+		return entity.Event{}, errors.Wrapf(err, "inserting %s event of %s %s", ne.Type, ne.AggregateType, ne.AggregateID)
+	}
+
+	return e, nil
+}
+
+// QueryPending gets the oldest unpublished event of every aggregate which next attempt is due from PostgreSQL.
+// Events are locked with FOR UPDATE SKIP LOCKED, so several relays can work side by side.
+func (r *Postgre) QueryPending(ctx context.Context, now time.Time, limit int) ([]entity.Event, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		outbox_events e
+	WHERE
+		e.published_at IS NULL AND e.next_attempt_at <= :now
+		AND NOT EXISTS (
+			SELECT 1 FROM outbox_events p
+			WHERE p.aggregate_type = e.aggregate_type AND p.aggregate_id = e.aggregate_id
+				AND p.published_at IS NULL AND p.sequence < e.sequence
+		)
+	ORDER BY
+		e.sequence
+	LIMIT :limit
+	FOR UPDATE SKIP LOCKED`
+
+	data := struct {
+		Now   time.Time `db:"now"`
+		Limit int       `db:"limit"`
+	}{
+		Now:   now,
+		Limit: limit,
+	}
+
+	events := []entity.Event{}
+
+	if err := database.QuerySlice(ctx, r.db, q, data, &events); err != nil {
+		return nil, errors.Wrap(err, "selecting pending events")
+	}
+
+	return events, nil
+}
+
+// MarkPublished marks an event as published in PostgreSQL.
+func (r *Postgre) MarkPublished(ctx context.Context, id string, publishedAt time.Time) error {
+	const q = `
+	UPDATE
+		outbox_events
+	SET
+		published_at = :published_at
+	WHERE
+		event_id = :event_id`
+
+	data := struct {
+		ID          string    `db:"event_id"`
+		PublishedAt time.Time `db:"published_at"`
+	}{
+		ID:          id,
+		PublishedAt: publishedAt,
+	}
+
+	if _, err := database.NamedExec(ctx, r.db, q, data); err != nil {
+		return errors.Wrapf(err, "marking event %s as published", id)
+	}
+
+	return nil
+}
+
+// MarkFailed records a failed attempt to publish an event in PostgreSQL and schedules the next one.
+func (r *Postgre) MarkFailed(ctx context.Context, id string, nextAttemptAt time.Time, lastError string) error {
+	const q = `
+	UPDATE
+		outbox_events
+	SET
+		attempts = attempts + 1,
+		last_error = :last_error,
+		next_attempt_at = :next_attempt_at
+	WHERE
+		event_id = :event_id`
+
+	data := struct {
+		ID            string    `db:"event_id"`
+		NextAttemptAt time.Time `db:"next_attempt_at"`
+		LastError     string    `db:"last_error"`
+	}{
+		ID:            id,
+		NextAttemptAt: nextAttemptAt,
+		LastError:     lastError,
+	}
+
+	if _, err := database.NamedExec(ctx, r.db, q, data); err != nil {
+		return errors.Wrapf(err, "marking event %s as failed", id)
+	}
+
+	return nil
+}
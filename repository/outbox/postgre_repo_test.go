@@ -0,0 +1,113 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+var pgOutboxRepo *Postgre
+
+func TestMain(m *testing.M) {
+	db, purge, err := tests.NewPostgreSQL()
+	if err != nil {
+		log.Fatalf("could not start PostgreSQL: %s", err)
+	}
+
+	// Init global package dependencies after successfull connection to a database
+	pgOutboxRepo = NewPostgreRepo(db, nil)
+
+	code := m.Run()
+
+	// When you're done, kill and remove the container
+	if err = purge(); err != nil {
+		log.Fatalf("could not purge resource: %s", err)
+	}
+
+	os.Exit(code)
+}
+
+func TestPostgre(t *testing.T) {
+	ctx := context.Background()
+
+	orderID, productID := uuid.NewString(), uuid.NewString()
+
+	newEvent := func(aggregateType, aggregateID string, payload entity.EventPayload) entity.Event {
+		ne, err := entity.NewDomainEvent(aggregateType, aggregateID, payload)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to encode an event. Error: %s", tests.Failed, err)
+		}
+
+		e, err := pgOutboxRepo.Create(ctx, ne)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to write an event into outbox. Error: %s", tests.Failed, err)
+		}
+		return e
+	}
+
+	orderCreated := newEvent(entity.AggregateOrder, orderID, entity.OrderCreated{OrderID: orderID, Status: entity.OrderStatusPending})
+	orderPaid := newEvent(entity.AggregateOrder, orderID, entity.OrderStatusChanged{OrderID: orderID, FromStatus: entity.OrderStatusPending, ToStatus: entity.OrderStatusPaid})
+	stockChanged := newEvent(entity.AggregateProduct, productID, entity.ProductStockChanged{ProductID: productID, FromStock: 2, ToStock: 1})
+
+	t.Run("Given the need to publish events of an aggregate in order", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			action   func() error
+			wantIDs  []string
+		}{
+			{
+				testName: "The oldest events of every aggregate are pending",
+				action:   func() error { return nil },
+				wantIDs:  []string{orderCreated.ID, stockChanged.ID},
+			},
+			{
+				testName: "Failed event holds back later events of it`s aggregate",
+				action: func() error {
+					return pgOutboxRepo.MarkFailed(ctx, orderCreated.ID, time.Now().UTC().Add(time.Hour), "unavailable")
+				},
+				wantIDs: []string{stockChanged.ID},
+			},
+			{
+				testName: "Published event is not pending",
+				action: func() error {
+					return pgOutboxRepo.MarkPublished(ctx, stockChanged.ID, time.Now().UTC())
+				},
+			},
+			{
+				testName: "Next event of an aggregate is pending after previous one is published",
+				action: func() error {
+					return pgOutboxRepo.MarkPublished(ctx, orderCreated.ID, time.Now().UTC())
+				},
+				wantIDs: []string{orderPaid.ID},
+			},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				if err := tc.action(); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to change an event. Error: %s", tests.Failed, testID, err)
+				}
+
+				events, err := pgOutboxRepo.QueryPending(ctx, time.Now().UTC(), 10)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to get pending events. Error: %s", tests.Failed, testID, err)
+				}
+
+				ids := make([]string, 0, len(events))
+				for _, e := range events {
+					ids = append(ids, e.ID)
+				}
+				if fmt.Sprint(ids) != fmt.Sprint(tc.wantIDs) {
+					t.Fatalf("\t%s\tTest %d:\tWant pending events: %v, got: %v", tests.Failed, testID, tc.wantIDs, ids)
+				}
+				t.Logf("\t%s\tTest %d:\tWant pending events: %v", tests.Success, testID, tc.wantIDs)
+			})
+		}
+	})
+}
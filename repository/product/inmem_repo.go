@@ -0,0 +1,372 @@
+package product
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
+)
+
+// OrderItems is a part of order item repository which InMemRepo uses to keep referential integrity.
+type OrderItems interface {
+	Query(ctx context.Context, q query.Query) ([]entity.OrderItem, query.Page, error)
+}
+
+// InMemRepo is an abstraction layer that manages product entities inside basic in-memory store (map+RWMutex).
+// It behaves as PostgreSQL repository does, but suits a single instance of an application, products are lost on restart.
+type InMemRepo struct {
+	store map[string]entity.Product
+	items OrderItems
+	sync.RWMutex
+}
+
+// NewInMemRepo creates a new in-memory repository for Product entity.
+// Deleted products that are still referenced by order items in the given repository are not purged,
+// it can be nil if there are no order items.
+func NewInMemRepo(items OrderItems) *InMemRepo {
+	return &InMemRepo{
+		store: make(map[string]entity.Product),
+		items: items,
+	}
+}
+
+// Create a new product in in-memory store.
+// Titles are unique among all products, deleted ones included.
+func (r *InMemRepo) Create(ctx context.Context, newProduct entity.NewProduct) (entity.Product, error) {
+	product := entity.Product{
+		ID:          uuid.NewString(),
+		Title:       newProduct.Title,
+		Description: newProduct.Description,
+		Price:       newProduct.Price,
+		Stock:       newProduct.Stock,
+		Version:     1,
+		DateCreated: time.Now().UTC(),
+		DateUpdated: time.Now().UTC(),
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if err := r.checkUnique(product); err != nil {
+		return entity.Product{}, errors.Wrap(err, "inserting a product")
+	}
+	r.put(ctx, product.ID, product)
+
+	return product, nil
+}
+
+// checkUnique checks that no other product has the same title.
+func (r *InMemRepo) checkUnique(p entity.Product) error {
+	for _, existing := range r.store {
+		if existing.ID != p.ID && existing.Title == p.Title {
+			return errors.Wrapf(database.ErrDuplicate, "title %s", p.Title)
+		}
+	}
+	return nil
+}
+
+// Query gets a page of products from in-memory store defined by list query.
+// By default results are sorted by creation date, newest first.
+func (r *InMemRepo) Query(ctx context.Context, q query.Query) ([]entity.Product, query.Page, error) {
+	r.RLock()
+	all := make([]entity.Product, 0, len(r.store))
+	for _, p := range r.store {
+		all = append(all, p)
+	}
+	r.RUnlock()
+
+	products := []entity.Product{}
+
+	page, err := database.SlicePage(all, productFields, "product_id", q, &products)
+	if err != nil {
+		return nil, query.Page{}, errors.Wrap(err, "selecting products")
+	}
+
+	return products, page, nil
+}
+
+// Search finds products which title or description contain all words of given text, the last word is matched as a prefix.
+// Unlike PostgreSQL full-text search words are matched as they are, without stemming.
+// Results of a search are sorted by their relevance, which is a number of matched words, title ones count twice.
+func (r *InMemRepo) Search(ctx context.Context, text string, limit int) ([]entity.ProductSearchResult, error) {
+	results := []entity.ProductSearchResult{}
+
+	terms := searchWords(strings.ToLower(text))
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, p := range r.store {
+		if p.DeletedAt != nil {
+			continue
+		}
+
+		titleHighlight, titleMatches := highlight(p.Title, terms)
+		descriptionHighlight, descriptionMatches := highlight(p.Description, terms)
+
+		all := true
+		for i := range terms {
+			if titleMatches[i]+descriptionMatches[i] == 0 {
+				all = false
+				break
+			}
+		}
+		if !all {
+			continue
+		}
+
+		var rank float64
+		for i := range terms {
+			rank += float64(2*titleMatches[i] + descriptionMatches[i])
+		}
+
+		results = append(results, entity.ProductSearchResult{
+			Product:              p,
+			Rank:                 rank,
+			TitleHighlight:       titleHighlight,
+			DescriptionHighlight: descriptionHighlight,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].ID < results[j].ID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// searchWords splits a text into words, everything except letters and digits separates them.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// highlight wraps words of a text that match search terms into <b></b> tags
+// and counts matches of each term, the last term matches words it is a prefix of.
+func highlight(text string, terms []string) (string, []int) {
+	matches := make([]int, len(terms))
+
+	var b strings.Builder
+	var word []rune
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+
+		w := strings.ToLower(string(word))
+		matched := false
+		for i, t := range terms {
+			if w == t || i == len(terms)-1 && strings.HasPrefix(w, t) {
+				matches[i]++
+				matched = true
+			}
+		}
+
+		if matched {
+			b.WriteString("<b>" + string(word) + "</b>")
+		} else {
+			b.WriteString(string(word))
+		}
+		word = word[:0]
+	}
+
+	for _, c := range text {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			word = append(word, c)
+			continue
+		}
+		flush()
+		b.WriteRune(c)
+	}
+	flush()
+
+	return b.String(), matches
+}
+
+// QueryByID gets product from in-memory store by given id.
+// Deleted products are not found.
+func (r *InMemRepo) QueryByID(ctx context.Context, id string) (entity.Product, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	product, ok := r.store[id]
+	if !ok || product.DeletedAt != nil {
+		return entity.Product{}, errors.Wrapf(database.ErrNotFound, "getting a product with id %s", id)
+	}
+
+	return product, nil
+}
+
+// QueryByIDForUpdate gets product from in-memory store by given id.
+// There are no row locks in memory, transaction.InMem runs transactions one at a time instead.
+func (r *InMemRepo) QueryByIDForUpdate(ctx context.Context, id string) (entity.Product, error) {
+	product, err := r.QueryByID(ctx, id)
+	if err != nil {
+		return entity.Product{}, errors.Wrapf(errors.Cause(err), "locking a product with id %s", id)
+	}
+
+	return product, nil
+}
+
+// Update a product inside in-memory store.
+// Non zero version is a version of a product an update is based on,
+// if a product has a different one database.ErrVersionConflict is returned.
+func (r *InMemRepo) Update(ctx context.Context, id string, version int, updateProduct entity.UpdateProduct) error {
+	r.Lock()
+	defer r.Unlock()
+
+	product, ok := r.store[id]
+	if !ok || product.DeletedAt != nil {
+		return errors.Wrapf(database.ErrNotFound, "error updating a product with id %s", id)
+	}
+	if version != 0 && product.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "updating a product with id %s", id)
+	}
+
+	if updateProduct.Title != nil {
+		product.Title = *updateProduct.Title
+	}
+	if updateProduct.Description != nil {
+		product.Description = *updateProduct.Description
+	}
+	if updateProduct.Price != nil {
+		product.Price = *updateProduct.Price
+	}
+	if updateProduct.Stock != nil {
+		product.Stock = *updateProduct.Stock
+	}
+	product.Version++
+	product.DateUpdated = time.Now().UTC()
+
+	if err := r.checkUnique(product); err != nil {
+		return errors.Wrapf(err, "updating a product with id %s", id)
+	}
+	r.put(ctx, id, product)
+
+	return nil
+}
+
+// Delete marks a product in in-memory store as deleted by given product id,
+// it is kept until Purge removes it, so it can be restored meanwhile.
+// Non zero version is a version of a product a client knows about,
+// if a product has a different one database.ErrVersionConflict is returned.
+func (r *InMemRepo) Delete(ctx context.Context, id string, version int) error {
+	r.Lock()
+	defer r.Unlock()
+
+	product, ok := r.store[id]
+	if !ok || product.DeletedAt != nil {
+		return errors.Wrapf(database.ErrNotFound, "deleting a product with id %s", id)
+	}
+	if version != 0 && product.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "deleting a product with id %s", id)
+	}
+
+	now := time.Now().UTC()
+	product.DeletedAt = &now
+	product.Version++
+	r.put(ctx, id, product)
+
+	return nil
+}
+
+// Restore restores a deleted product inside in-memory store by given product id.
+func (r *InMemRepo) Restore(ctx context.Context, id string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	product, ok := r.store[id]
+	if !ok || product.DeletedAt == nil {
+		return errors.Wrapf(database.ErrNotFound, "deleted product %s", id)
+	}
+
+	product.DeletedAt = nil
+	product.Version++
+	product.DateUpdated = time.Now().UTC()
+	r.put(ctx, id, product)
+
+	return nil
+}
+
+// Purge permanently removes products from in-memory store that were deleted before given time.
+// Products that are still referenced by order items are kept, as PostgreSQL repository does.
+func (r *InMemRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	var n int64
+	for id, product := range r.store {
+		if product.DeletedAt == nil || !product.DeletedAt.Before(before) {
+			continue
+		}
+
+		if r.items != nil {
+			items, _, err := r.items.Query(ctx, query.Query{
+				Filters:        []query.Filter{{Field: "product_id", Op: query.Eq, Value: id}},
+				Limit:          1,
+				IncludeDeleted: true,
+			})
+			if err != nil {
+				return n, errors.Wrap(err, "purging deleted products")
+			}
+			if len(items) > 0 {
+				continue
+			}
+		}
+
+		r.remove(ctx, id)
+		n++
+	}
+
+	return n, nil
+}
+
+// put stores a product by id within in-memory store,
+// if a transaction carried by ctx fails a previous state of it is restored.
+// It must be called with the lock held.
+func (r *InMemRepo) put(ctx context.Context, id string, v entity.Product) {
+	r.journal(ctx, id)
+	r.store[id] = v
+}
+
+// remove removes a product by id from in-memory store,
+// if a transaction carried by ctx fails it is restored.
+// It must be called with the lock held.
+func (r *InMemRepo) remove(ctx context.Context, id string) {
+	r.journal(ctx, id)
+	delete(r.store, id)
+}
+
+// journal registers restoration of current state of a product by id if a transaction carried by ctx fails.
+func (r *InMemRepo) journal(ctx context.Context, id string) {
+	prev, existed := r.store[id]
+	transaction.OnRollback(ctx, func() {
+		r.Lock()
+		defer r.Unlock()
+
+		if existed {
+			r.store[id] = prev
+			return
+		}
+		delete(r.store, id)
+	})
+}
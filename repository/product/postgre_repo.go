@@ -2,7 +2,9 @@ package product
 
 import (
 	"context"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -10,6 +12,7 @@ import (
 	"github.com/rtbe/clean-rest-api/domain/entity"
 	"github.com/rtbe/clean-rest-api/internal/database"
 	"github.com/rtbe/clean-rest-api/internal/logger"
+	"github.com/rtbe/clean-rest-api/internal/query"
 )
 
 // Postgre is an abstraction layer that manages product entities inside PostgreSQL DB.
@@ -31,9 +34,9 @@ func NewPostgreRepo(db *sqlx.DB, l logger.Logger) *Postgre {
 func (r *Postgre) Create(ctx context.Context, newProduct entity.NewProduct) (entity.Product, error) {
 	const query = `
 	INSERT INTO products 
-		(product_id, title, description, price, stock, date_created, date_updated) 
+		(product_id, title, description, price, stock, version, date_created, date_updated) 
 	VALUES
-		(:product_id, :title, :description, :price, :stock, :date_created, :date_updated)`
+		(:product_id, :title, :description, :price, :stock, :version, :date_created, :date_updated)`
 
 	product := entity.Product{
 		ID:          uuid.NewString(),
@@ -41,59 +44,109 @@ func (r *Postgre) Create(ctx context.Context, newProduct entity.NewProduct) (ent
 		Description: newProduct.Description,
 		Price:       newProduct.Price,
 		Stock:       newProduct.Stock,
+		Version:     1,
 		DateCreated: time.Now().UTC(),
 		DateUpdated: time.Now().UTC(),
 	}
 
-	if _, err := r.db.NamedExecContext(ctx, query, product); err != nil {
+	if _, err := database.NamedExec(ctx, r.db, query, product); err != nil {
 		return entity.Product{}, errors.Wrap(err, "inserting a product")
 	}
 
 	return product, nil
 }
 
-// Query gets products from PostgreSQL DB.
-// This query uses two provided values to implement pagination: last seen id and limit.
-// Results of a query sorted by creation date of selected users.
-func (r *Postgre) Query(ctx context.Context, lastSeenID, limit string) ([]entity.Product, error) {
+// productFields is a whitelist of products fields that can be used in list queries.
+var productFields = query.Fields{
+	"product_id":   {Column: "product_id", Type: query.UUID},
+	"title":        {Column: "title", Type: query.String},
+	"description":  {Column: "description", Type: query.String},
+	"price":        {Column: "price", Type: query.Decimal},
+	"stock":        {Column: "stock", Type: query.Int},
+	"date_created": {Column: "date_created", Type: query.Time},
+	"date_updated": {Column: "date_updated", Type: query.Time},
+}
+
+// Query gets a page of products from PostgreSQL DB defined by list query.
+// By default results are sorted by creation date, newest first.
+func (r *Postgre) Query(ctx context.Context, q query.Query) ([]entity.Product, query.Page, error) {
+	products := []entity.Product{}
+
+	page, err := database.QueryPage(ctx, r.db, "products", productFields, "product_id", q, &products)
+	if err != nil {
+		return nil, query.Page{}, errors.Wrap(err, "selecting products")
+	}
+
+	return products, page, nil
+}
+
+// Search finds products which title or description match given text using PostgreSQL full-text search.
+// The last word of a text is matched as a prefix, so partially typed words can be found too.
+// Results of a search are sorted by their relevance.
+func (r *Postgre) Search(ctx context.Context, text string, limit int) ([]entity.ProductSearchResult, error) {
 	const query = `
 	SELECT 
-		* 
+		product_id, title, description, price, stock, version, date_created, date_updated, deleted_at,
+		ts_rank(search, q) AS rank,
+		ts_headline('english', title, q, 'HighlightAll=true') AS title_highlight,
+		ts_headline('english', description, q, 'MaxFragments=2, MaxWords=20, MinWords=5') AS description_highlight
 	FROM 
-		products 
-	WHERE
-		product_id <= :last_seen_id
+		products,
+		to_tsquery('english', :query) q
+	WHERE 
+		search @@ q AND deleted_at IS NULL
 	ORDER BY 
-		product_id DESC	
-	FETCH FIRST :limit ROWS ONLY`
+		rank DESC, product_id
+	LIMIT :limit`
+
+	results := []entity.ProductSearchResult{}
 
-	var products []entity.Product
+	tsQuery := prefixTSQuery(text)
+	if tsQuery == "" {
+		return results, nil
+	}
 
 	data := struct {
-		LastSeenID string `db:"last_seen_id"`
-		Limit      string `db:"limit"`
+		Query string `db:"query"`
+		Limit int    `db:"limit"`
 	}{
-		LastSeenID: lastSeenID,
-		Limit:      limit,
+		Query: tsQuery,
+		Limit: limit,
 	}
 
-	err := database.QuerySlice(ctx, r.db, query, data, &products)
-	if err != nil {
-		return []entity.Product{}, errors.Wrap(err, "selecting products")
+	if err := database.QuerySlice(ctx, r.db, query, data, &results); err != nil {
+		return nil, errors.Wrapf(err, "searching products by %q", text)
 	}
 
-	return products, nil
+	return results, nil
+}
+
+// prefixTSQuery converts a text into tsquery that matches all words of a text,
+// the last word is matched as a prefix.
+// Everything except letters and digits is dropped, so a text can not break tsquery syntax.
+func prefixTSQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+
+	words[len(words)-1] += ":*"
+
+	return strings.Join(words, " & ")
 }
 
 // QueryByID gets product from PostgreSQL DB by given id.
+// Deleted products are not found.
 func (r *Postgre) QueryByID(ctx context.Context, id string) (entity.Product, error) {
 	const query = `
 	SELECT 
-		* 
+		product_id, title, description, price, stock, version, date_created, date_updated, deleted_at 
 	FROM 
 		products 
 	WHERE 
-		product_id = :product_id`
+		product_id = :product_id AND deleted_at IS NULL`
 
 	data := struct {
 		ID string `db:"product_id"`
@@ -111,12 +164,46 @@ func (r *Postgre) QueryByID(ctx context.Context, id string) (entity.Product, err
 	return product, err
 }
 
+// QueryByIDForUpdate gets product from PostgreSQL DB by given id and locks it's row
+// until the end of surrounding transaction, so concurrent transactions can not change it meanwhile.
+// It should be called with a context that carries a transaction.
+func (r *Postgre) QueryByIDForUpdate(ctx context.Context, id string) (entity.Product, error) {
+	const query = `
+	SELECT 
+		product_id, title, description, price, stock, version, date_created, date_updated, deleted_at 
+	FROM 
+		products 
+	WHERE 
+		product_id = :product_id AND deleted_at IS NULL
+	FOR UPDATE`
+
+	data := struct {
+		ID string `db:"product_id"`
+	}{
+		ID: id,
+	}
+
+	var product entity.Product
+
+	err := database.QueryStruct(ctx, r.db, query, data, &product)
+	if err != nil {
+		return entity.Product{}, errors.Wrapf(err, "locking a product with id %s", id)
+	}
+
+	return product, nil
+}
+
 // Update a product inside PostgreSQL.
-func (r *Postgre) Update(ctx context.Context, id string, updateProduct entity.UpdateProduct) error {
+// Non zero version is a version of a product an update is based on,
+// if a product has a different one database.ErrVersionConflict is returned.
+func (r *Postgre) Update(ctx context.Context, id string, version int, updateProduct entity.UpdateProduct) error {
 	product, err := r.QueryByID(ctx, id)
 	if err != nil {
 		return errors.Wrapf(err, "error updating a product with id %s", id)
 	}
+	if version != 0 && product.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "updating a product with id %s", id)
+	}
 
 	const query = `
 	UPDATE 
@@ -126,9 +213,10 @@ func (r *Postgre) Update(ctx context.Context, id string, updateProduct entity.Up
 		"description" = :description, 
 		"price" = :price, 
 		"stock" = :stock,
+		"version" = "version" + 1,
 		"date_updated" = :date_updated
 	WHERE 
-		"product_id" = :product_id`
+		"product_id" = :product_id AND "version" = :version`
 
 	if updateProduct.Title != nil {
 		product.Title = *updateProduct.Title
@@ -144,31 +232,113 @@ func (r *Postgre) Update(ctx context.Context, id string, updateProduct entity.Up
 	}
 	product.DateUpdated = time.Now().UTC()
 
-	_, err = r.db.NamedExecContext(ctx, query, product)
-	if err != nil {
+	if err := database.NamedExecVersion(ctx, r.db, query, product); err != nil {
 		return errors.Wrapf(err, "updating a product with id %s", id)
 	}
 
 	return nil
 }
 
-// Delete a product from PostgreSQL DB by given product id.
-func (r *Postgre) Delete(ctx context.Context, id string) error {
+// Delete marks a product in PostgreSQL DB as deleted by given product id,
+// it is kept until Purge removes it, so it can be restored meanwhile.
+// Non zero version is a version of a product a client knows about,
+// if a product has a different one database.ErrVersionConflict is returned.
+func (r *Postgre) Delete(ctx context.Context, id string, version int) error {
+	product, err := r.QueryByID(ctx, id)
+	if err != nil {
+		return errors.Wrapf(err, "deleting a product with id %s", id)
+	}
+	if version != 0 && product.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "deleting a product with id %s", id)
+	}
+
 	const query = `
-	DELETE FROM 
+	UPDATE 
 		products 
+	SET
+		"deleted_at" = :deleted_at,
+		"version" = "version" + 1
 	WHERE 
-		"product_id" = :product_id`
+		"product_id" = :product_id AND "version" = :version`
 
 	data := struct {
-		ID string `db:"product_id"`
+		ID        string    `db:"product_id"`
+		Version   int       `db:"version"`
+		DeletedAt time.Time `db:"deleted_at"`
 	}{
-		ID: id,
+		ID:        id,
+		Version:   product.Version,
+		DeletedAt: time.Now().UTC(),
 	}
 
-	if _, err := r.db.NamedExecContext(ctx, query, data); err != nil {
+	if err := database.NamedExecVersion(ctx, r.db, query, data); err != nil {
 		return errors.Wrapf(err, "deleting a product with id %s", id)
 	}
 
 	return nil
 }
+
+// Restore restores a deleted product inside PostgreSQL by given product id.
+func (r *Postgre) Restore(ctx context.Context, id string) error {
+	const query = `
+	UPDATE 
+		products 
+	SET
+		"deleted_at" = NULL,
+		"version" = "version" + 1,
+		"date_updated" = :date_updated
+	WHERE 
+		"product_id" = :product_id AND deleted_at IS NOT NULL`
+
+	data := struct {
+		ID          string    `db:"product_id"`
+		DateUpdated time.Time `db:"date_updated"`
+	}{
+		ID:          id,
+		DateUpdated: time.Now().UTC(),
+	}
+
+	res, err := database.NamedExec(ctx, r.db, query, data)
+	if err != nil {
+		return errors.Wrapf(err, "restoring a product with id %s", id)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "restoring a product with id %s", id)
+	}
+	if n == 0 {
+		return errors.Wrapf(database.ErrNotFound, "deleted product %s", id)
+	}
+
+	return nil
+}
+
+// Purge permanently removes products from PostgreSQL DB that were deleted before given time.
+// Products that are still referenced by order items are kept, since removal of them would remove those order items too.
+func (r *Postgre) Purge(ctx context.Context, before time.Time) (int64, error) {
+	const query = `
+	DELETE FROM 
+		products p
+	WHERE 
+		p.deleted_at < :before
+		AND NOT EXISTS (SELECT 1 FROM order_items oi WHERE oi.product_id = p.product_id)`
+
+	data := struct {
+		Before time.Time `db:"before"`
+	}{
+		Before: before,
+	}
+
+	res, err := database.NamedExec(ctx, r.db, query, data)
+	if err != nil {
+		return 0, errors.Wrap(err, "purging deleted products")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "purging deleted products")
+	}
+
+	return n, nil
+}
@@ -5,93 +5,61 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
-	"github.com/ory/dockertest/v3"
-	"github.com/ory/dockertest/v3/docker"
+	"github.com/pkg/errors"
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/query"
 	"github.com/rtbe/clean-rest-api/internal/tests"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
 	"github.com/rtbe/clean-rest-api/repository/user"
 )
 
 var pgProductRepo *Postgre
+var pgTxManager *transaction.Postgre
 var pgUserRepo *user.Postgre
 var validUser entity.User
 var validProduct entity.Product
 
+// moneyPtr is a helper function that helps with updating money pointer fields on entities.
+func moneyPtr(m entity.Money) *entity.Money {
+	return &m
+}
+
 func TestMain(m *testing.M) {
-	pool, err := dockertest.NewPool("")
+	db, purge, err := tests.NewPostgreSQL()
 	if err != nil {
-		log.Fatalf("could not connect to docker: %s", err)
+		log.Fatalf("could not start PostgreSQL: %s", err)
 	}
 
-	absFilepath, _ := filepath.Abs("../../internal/tests")
-	opts := dockertest.RunOptions{
-		Repository: "postgres",
-		Tag:        "12.3",
-		Env: []string{
-			"POSTGRES_USER=" + tests.PgUser,
-			"POSTGRES_PASSWORD=" + tests.PgPassword,
-			"POSTGRES_DB=" + tests.PgDB,
-		},
-		ExposedPorts: []string{"5432"},
-		PortBindings: map[docker.Port][]docker.PortBinding{
-			"5432": {
-				{HostIP: "0.0.0.0", HostPort: tests.PgPort},
-			},
-		},
-		Mounts: []string{absFilepath + ":/docker-entrypoint-initdb.d/"},
+	// Init global package dependencies after
+	// successfull connection to a database
+	pgProductRepo = NewPostgreRepo(db, nil)
+	pgTxManager = transaction.NewPostgreManager(db, nil)
+	pgUserRepo = user.NewPostgreRepo(db, nil)
+
+	newUser := entity.NewUser{
+		UserName:        "AlanKay",
+		FirstName:       "Alan",
+		LastName:        "Kay",
+		Password:        "OOP_is_about_messages",
+		PasswordConfirm: "OOP_is_about_messages",
+		Email:           "AlanKay@zeroxparc.com",
+		Roles:           []string{"admin"},
 	}
 
-	resource, err := pool.RunWithOptions(&opts)
+	validUser, err = pgUserRepo.Create(context.Background(), newUser)
 	if err != nil {
-		log.Fatalf("could not start resource: %s", err)
-	}
-
-	if err = pool.Retry(func() error {
-		db, err := sqlx.Connect("postgres", fmt.Sprintf(
-			"postgres://%s:%s@localhost:%s/%s?sslmode=disable",
-			tests.PgUser,
-			tests.PgPassword,
-			resource.GetPort("5432/tcp"),
-			tests.PgDB,
-		))
-		if err != nil {
-			return err
-		}
-
-		// Init global package dependencies after
-		// successfull connection to a database
-		pgProductRepo = NewPostgreRepo(db, nil)
-		pgUserRepo = user.NewPostgreRepo(db, nil)
-
-		newUser := entity.NewUser{
-			UserName:        "AlanKay",
-			FirstName:       "Alan",
-			LastName:        "Kay",
-			Password:        "OOP_is_about_messages",
-			PasswordConfirm: "OOP_is_about_messages",
-			Email:           "AlanKay@zeroxparc.com",
-			Roles:           []string{"admin"},
-		}
-
-		validUser, err = pgUserRepo.Create(context.Background(), newUser)
-		if err != nil {
-			return err
-		}
-
-		return db.Ping()
-	}); err != nil {
-		log.Fatalf("could not connect to docker: %s", err)
+		log.Fatalf("could not prepare test data: %s", err)
 	}
 
 	code := m.Run()
 
 	// When you're done, kill and remove the container
-	if err = pool.Purge(resource); err != nil {
+	if err = purge(); err != nil {
 		log.Fatalf("could not purge resource: %s", err)
 	}
 
@@ -104,10 +72,10 @@ func TestPostgre(t *testing.T) {
 			testName    string
 			title       string
 			description string
-			price       float32
+			price       entity.Money
 			stock       int
 		}{
-			{testName: "Create a single product", title: "Apple Juice", description: "Just an apple juice", price: 10.2, stock: 10},
+			{testName: "Create a single product", title: "Apple Juice", description: "Just an apple juice", price: 1020, stock: 10},
 		}
 
 		for testID, tc := range tt {
@@ -136,9 +104,9 @@ func TestPostgre(t *testing.T) {
 				t.Logf("\t%s\tTest %d:\tWant description: %s, got: %s", tests.Success, testID, newProduct.Description, savedProduct.Description)
 
 				if newProduct.Price != savedProduct.Price {
-					t.Fatalf("\t%s\tTest %d:\tWant price: %.2f, got: %.2f", tests.Failed, testID, newProduct.Price, savedProduct.Price)
+					t.Fatalf("\t%s\tTest %d:\tWant price: %s, got: %s", tests.Failed, testID, newProduct.Price, savedProduct.Price)
 				}
-				t.Logf("\t%s\tTest %d:\tWant price: %.2f, got: %.2f", tests.Success, testID, newProduct.Price, savedProduct.Price)
+				t.Logf("\t%s\tTest %d:\tWant price: %s, got: %s", tests.Success, testID, newProduct.Price, savedProduct.Price)
 
 				if newProduct.Stock != savedProduct.Stock {
 					t.Fatalf("\t%s\tTest %d:\tWant stock: %d, got: %d", tests.Failed, testID, newProduct.Stock, savedProduct.Stock)
@@ -183,32 +151,229 @@ func TestPostgre(t *testing.T) {
 		}
 	})
 
+	t.Run("Given the need to lock a product by it`s id inside PostgreSQL transaction", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			id       string
+			stock    int
+			commit   bool
+		}{
+			{testName: "Rolled back stock update", id: validProduct.ID, stock: 1, commit: false},
+			{testName: "Committed stock update", id: validProduct.ID, stock: 2, commit: true},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				ctx := context.Background()
+
+				before, err := pgProductRepo.QueryByID(ctx, tc.id)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to get a product by it`s id. Error: %s", tests.Failed, testID, err)
+				}
+
+				errRollback := fmt.Errorf("rollback")
+				err = pgTxManager.Run(ctx, func(ctx context.Context) error {
+					lockedProduct, err := pgProductRepo.QueryByIDForUpdate(ctx, tc.id)
+					if err != nil {
+						return err
+					}
+					if tc.id != lockedProduct.ID {
+						t.Fatalf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Failed, testID, tc.id, lockedProduct.ID)
+					}
+
+					if err := pgProductRepo.Update(ctx, tc.id, lockedProduct.Version, entity.UpdateProduct{Stock: &tc.stock}); err != nil {
+						return err
+					}
+
+					if !tc.commit {
+						return errRollback
+					}
+					return nil
+				})
+				if err != nil && err != errRollback {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to lock a product by it`s id. Error: %s", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to lock a product by it`s id.", tests.Success, testID)
+
+				after, err := pgProductRepo.QueryByID(ctx, tc.id)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to get a product by it`s id. Error: %s", tests.Failed, testID, err)
+				}
+
+				want := before.Stock
+				if tc.commit {
+					want = tc.stock
+				}
+				if want != after.Stock {
+					t.Fatalf("\t%s\tTest %d:\tWant stock: %d, got: %d", tests.Failed, testID, want, after.Stock)
+				}
+				t.Logf("\t%s\tTest %d:\tWant stock: %d, got: %d", tests.Success, testID, want, after.Stock)
+			})
+		}
+	})
+
 	t.Run("Given the need to query products from PostgreSQL", func(t *testing.T) {
 		tt := []struct {
-			testName   string
-			lastSeenID string
-			limit      string
+			testName string
+			q        query.Query
+			wantID   string
 		}{
-			{testName: "list existing products", lastSeenID: validProduct.ID, limit: "1"},
+			{
+				testName: "list existing products",
+				q: query.Query{
+					Filters: []query.Filter{{Field: "product_id", Op: query.Eq, Value: validProduct.ID}},
+					Limit:   1,
+				},
+				wantID: validProduct.ID,
+			},
 		}
 		for testID, tc := range tt {
 			t.Run(tc.testName, func(t *testing.T) {
-				products, err := pgProductRepo.Query(context.Background(), tc.lastSeenID, tc.limit)
+				products, _, err := pgProductRepo.Query(context.Background(), tc.q)
 				if err != nil {
 					t.Fatalf("\t%s\tTest %d:\tShould be able to get a list of products. Error: %s", tests.Failed, testID, err)
 				}
 				t.Logf("\t%s\tTest %d:\tShould be able to get a list of products.", tests.Success, testID)
 
 				for _, product := range products {
-					if tc.lastSeenID != product.ID {
-						t.Fatalf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Failed, testID, tc.lastSeenID, product.ID)
+					if tc.wantID != product.ID {
+						t.Fatalf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Failed, testID, tc.wantID, product.ID)
 					}
-					t.Logf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Success, testID, tc.lastSeenID, product.ID)
+					t.Logf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Success, testID, tc.wantID, product.ID)
 				}
 			})
 		}
 	})
 
+	t.Run("Given the need to page through products sorted by price from PostgreSQL", func(t *testing.T) {
+		for i, price := range []entity.Money{202, 3000, 202} {
+			newProduct := entity.NewProduct{
+				Title:       fmt.Sprintf("Paged product %d", i),
+				Description: "Product for pagination",
+				Price:       price,
+				Stock:       1,
+			}
+			if _, err := pgProductRepo.Create(context.Background(), newProduct); err != nil {
+				t.Fatalf("\t%s\tShould be able to create a product. Error: %s", tests.Failed, err)
+			}
+		}
+
+		tt := []struct {
+			testName  string
+			q         query.Query
+			wantCount int
+		}{
+			{
+				testName:  "Page through products one by one",
+				q:         query.Query{Sort: []query.Sort{{Field: "price", Desc: true}}, Limit: 1},
+				wantCount: 4,
+			},
+			{
+				testName: "Page through filtered products",
+				q: query.Query{
+					Filters: []query.Filter{{Field: "title", Op: query.Like, Value: "paged"}},
+					Sort:    []query.Sort{{Field: "price", Desc: true}},
+					Limit:   2,
+				},
+				wantCount: 3,
+			},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				var products []entity.Product
+				for {
+					page, meta, err := pgProductRepo.Query(context.Background(), tc.q)
+					if err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to get a page of products. Error: %s", tests.Failed, testID, err)
+					}
+					products = append(products, page...)
+
+					if !meta.HasMore {
+						break
+					}
+					tc.q.Cursor = meta.NextCursor
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to get all pages of products.", tests.Success, testID)
+
+				if len(products) != tc.wantCount {
+					t.Fatalf("\t%s\tTest %d:\tWant count: %d, got: %d", tests.Failed, testID, tc.wantCount, len(products))
+				}
+				t.Logf("\t%s\tTest %d:\tWant count: %d, got: %d", tests.Success, testID, tc.wantCount, len(products))
+
+				seen := make(map[string]bool)
+				for i, product := range products {
+					if seen[product.ID] {
+						t.Fatalf("\t%s\tTest %d:\tShould get product %s only once.", tests.Failed, testID, product.ID)
+					}
+					seen[product.ID] = true
+
+					if i > 0 && products[i-1].Price < product.Price {
+						t.Fatalf("\t%s\tTest %d:\tShould get products sorted by price, got %s before %s", tests.Failed, testID, products[i-1].Price, product.Price)
+					}
+				}
+				t.Logf("\t%s\tTest %d:\tShould get each product once sorted by price.", tests.Success, testID)
+			})
+		}
+	})
+
+	t.Run("Given the need to search products by keywords inside PostgreSQL", func(t *testing.T) {
+		tt := []struct {
+			testName  string
+			text      string
+			wantCount int
+		}{
+			{testName: "Search by title word", text: "juice", wantCount: 1},
+			{testName: "Search by word prefix", text: "Appl", wantCount: 1},
+			{testName: "Search by description words", text: "pagination for prod", wantCount: 3},
+			{testName: "Search by missing word", text: "banana", wantCount: 0},
+			{testName: "Search by punctuation only", text: "&|!:*", wantCount: 0},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				results, err := pgProductRepo.Search(context.Background(), tc.text, 10)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to search products. Error: %s", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to search products.", tests.Success, testID)
+
+				if len(results) != tc.wantCount {
+					t.Fatalf("\t%s\tTest %d:\tWant count: %d, got: %d", tests.Failed, testID, tc.wantCount, len(results))
+				}
+				t.Logf("\t%s\tTest %d:\tWant count: %d, got: %d", tests.Success, testID, tc.wantCount, len(results))
+
+				for _, result := range results {
+					if !strings.Contains(result.TitleHighlight+result.DescriptionHighlight, "<b>") {
+						t.Fatalf("\t%s\tTest %d:\tShould highlight matched words, got: %q, %q", tests.Failed, testID, result.TitleHighlight, result.DescriptionHighlight)
+					}
+					if result.Rank <= 0 {
+						t.Fatalf("\t%s\tTest %d:\tShould rank found products, got: %f", tests.Failed, testID, result.Rank)
+					}
+				}
+				t.Logf("\t%s\tTest %d:\tShould rank found products and highlight matched words.", tests.Success, testID)
+			})
+		}
+	})
+
+	t.Run("Given the need to reject invalid product queries", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			q        query.Query
+		}{
+			{testName: "Filter by unknown field", q: query.Query{Filters: []query.Filter{{Field: "password", Op: query.Eq, Value: "x"}}}},
+			{testName: "Filter by malformed value", q: query.Query{Filters: []query.Filter{{Field: "stock", Op: query.Gt, Value: "1; DROP TABLE products"}}}},
+			{testName: "Sort by unknown field", q: query.Query{Sort: []query.Sort{{Field: "1"}}}},
+			{testName: "Use malformed cursor", q: query.Query{Cursor: "not a cursor"}},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				_, _, err := pgProductRepo.Query(context.Background(), tc.q)
+				if errors.Cause(err) != query.ErrInvalidQuery {
+					t.Fatalf("\t%s\tTest %d:\tWant error: %v, got: %v", tests.Failed, testID, query.ErrInvalidQuery, err)
+				}
+				t.Logf("\t%s\tTest %d:\tWant error: %v, got: %v", tests.Success, testID, query.ErrInvalidQuery, err)
+			})
+		}
+	})
+
 	t.Run("Given the need to update a product inside PostgreSQL", func(t *testing.T) {
 		tt := []struct {
 			testName      string
@@ -221,7 +386,7 @@ func TestPostgre(t *testing.T) {
 				updateProduct: entity.UpdateProduct{
 					Title:       tests.StrPtr("Orange juice"),
 					Description: tests.StrPtr("Just an orange juice"),
-					Price:       tests.Float32Ptr(2.02),
+					Price:       moneyPtr(202),
 					Stock:       tests.IntPtr(33),
 				}},
 		}
@@ -229,7 +394,7 @@ func TestPostgre(t *testing.T) {
 			t.Run(tc.testName, func(t *testing.T) {
 				ctx := context.Background()
 
-				err := pgProductRepo.Update(ctx, tc.id, tc.updateProduct)
+				err := pgProductRepo.Update(ctx, tc.id, 0, tc.updateProduct)
 				if err != nil {
 					t.Fatalf("\t%s\tTest %d:\tShould be able to update a product. Error: %s", tests.Failed, testID, err)
 				}
@@ -252,9 +417,9 @@ func TestPostgre(t *testing.T) {
 				t.Logf("\t%s\tTest %d:\tWant description: %s, got: %s", tests.Success, testID, *tc.updateProduct.Description, retrievedProduct.Description)
 
 				if *tc.updateProduct.Price != retrievedProduct.Price {
-					t.Fatalf("\t%s\tTest %d:\tWant price: %.2f, got: %.2f", tests.Failed, testID, *tc.updateProduct.Price, retrievedProduct.Price)
+					t.Fatalf("\t%s\tTest %d:\tWant price: %s, got: %s", tests.Failed, testID, *tc.updateProduct.Price, retrievedProduct.Price)
 				}
-				t.Logf("\t%s\tTest %d:\tWant price: %.2f, got: %.2f", tests.Success, testID, *tc.updateProduct.Price, retrievedProduct.Price)
+				t.Logf("\t%s\tTest %d:\tWant price: %s, got: %s", tests.Success, testID, *tc.updateProduct.Price, retrievedProduct.Price)
 
 				if *tc.updateProduct.Stock != retrievedProduct.Stock {
 					t.Fatalf("\t%s\tTest %d:\tWant stock: %d, got: %d", tests.Failed, testID, *tc.updateProduct.Stock, retrievedProduct.Stock)
@@ -265,6 +430,155 @@ func TestPostgre(t *testing.T) {
 		}
 	})
 
+	t.Run("Given the need to reject changes of a product based on a stale version", func(t *testing.T) {
+		ctx := context.Background()
+
+		savedProduct, err := pgProductRepo.Create(ctx, entity.NewProduct{
+			Title:       "Versioned product",
+			Description: "Product for optimistic concurrency",
+			Price:       100,
+			Stock:       1,
+		})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create a product. Error: %s", tests.Failed, err)
+		}
+
+		tt := []struct {
+			testName    string
+			version     int
+			delete      bool
+			wantErr     error
+			wantVersion int
+		}{
+			{testName: "Update with current version", version: 1, wantVersion: 2},
+			{testName: "Update with stale version", version: 1, wantErr: database.ErrVersionConflict, wantVersion: 2},
+			{testName: "Update with any version", version: 0, wantVersion: 3},
+			{testName: "Delete with stale version", version: 2, delete: true, wantErr: database.ErrVersionConflict, wantVersion: 3},
+			{testName: "Delete with current version", version: 3, delete: true},
+			{testName: "Delete deleted product", version: 3, delete: true, wantErr: database.ErrNotFound},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				if tc.delete {
+					err = pgProductRepo.Delete(ctx, savedProduct.ID, tc.version)
+				} else {
+					err = pgProductRepo.Update(ctx, savedProduct.ID, tc.version, entity.UpdateProduct{Stock: tests.IntPtr(testID)})
+				}
+				if errors.Cause(err) != tc.wantErr {
+					t.Fatalf("\t%s\tTest %d:\tWant error: %v, got: %v", tests.Failed, testID, tc.wantErr, err)
+				}
+				t.Logf("\t%s\tTest %d:\tWant error: %v, got: %v", tests.Success, testID, tc.wantErr, err)
+
+				if tc.wantVersion == 0 {
+					return
+				}
+
+				retrievedProduct, err := pgProductRepo.QueryByID(ctx, savedProduct.ID)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to get a product by it`s id. Error: %s", tests.Failed, testID, err)
+				}
+				if tc.wantVersion != retrievedProduct.Version {
+					t.Fatalf("\t%s\tTest %d:\tWant version: %d, got: %d", tests.Failed, testID, tc.wantVersion, retrievedProduct.Version)
+				}
+				t.Logf("\t%s\tTest %d:\tWant version: %d, got: %d", tests.Success, testID, tc.wantVersion, retrievedProduct.Version)
+			})
+		}
+	})
+
+	t.Run("Given the need to soft delete, restore and purge a product inside PostgreSQL", func(t *testing.T) {
+		ctx := context.Background()
+
+		savedProduct, err := pgProductRepo.Create(ctx, entity.NewProduct{
+			Title:       "Soft deleted product",
+			Description: "Product for soft deletion",
+			Price:       100,
+			Stock:       1,
+		})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create a product. Error: %s", tests.Failed, err)
+		}
+
+		byID := []query.Filter{{Field: "product_id", Op: query.Eq, Value: savedProduct.ID}}
+
+		tt := []struct {
+			testName  string
+			action    func() error
+			wantErr   error
+			wantFound bool
+			wantAll   bool
+		}{
+			{
+				testName: "Delete a product",
+				action:   func() error { return pgProductRepo.Delete(ctx, savedProduct.ID, savedProduct.Version) },
+				wantAll:  true,
+			},
+			{
+				testName: "Purge a product before it`s retention period is over",
+				action: func() error {
+					_, err := pgProductRepo.Purge(ctx, time.Now().UTC().Add(-time.Hour))
+					return err
+				},
+				wantAll: true,
+			},
+			{
+				testName:  "Restore a deleted product",
+				action:    func() error { return pgProductRepo.Restore(ctx, savedProduct.ID) },
+				wantFound: true,
+				wantAll:   true,
+			},
+			{
+				testName:  "Restore a product that is not deleted",
+				action:    func() error { return pgProductRepo.Restore(ctx, savedProduct.ID) },
+				wantErr:   database.ErrNotFound,
+				wantFound: true,
+				wantAll:   true,
+			},
+			{
+				testName: "Purge a deleted product",
+				action: func() error {
+					if err := pgProductRepo.Delete(ctx, savedProduct.ID, 0); err != nil {
+						return err
+					}
+					_, err := pgProductRepo.Purge(ctx, time.Now().UTC().Add(time.Hour))
+					return err
+				},
+			},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				err := tc.action()
+				if errors.Cause(err) != tc.wantErr {
+					t.Fatalf("\t%s\tTest %d:\tWant error: %v, got: %v", tests.Failed, testID, tc.wantErr, err)
+				}
+				t.Logf("\t%s\tTest %d:\tWant error: %v, got: %v", tests.Success, testID, tc.wantErr, err)
+
+				_, err = pgProductRepo.QueryByID(ctx, savedProduct.ID)
+				if found := err == nil; tc.wantFound != found {
+					t.Fatalf("\t%s\tTest %d:\tWant product to be found by it`s id: %t, got: %t", tests.Failed, testID, tc.wantFound, found)
+				}
+				t.Logf("\t%s\tTest %d:\tWant product to be found by it`s id: %t", tests.Success, testID, tc.wantFound)
+
+				products, _, err := pgProductRepo.Query(ctx, query.Query{Filters: byID, Limit: 1})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to get a list of products. Error: %s", tests.Failed, testID, err)
+				}
+				if listed := len(products) == 1; tc.wantFound != listed {
+					t.Fatalf("\t%s\tTest %d:\tWant product to be listed: %t, got: %t", tests.Failed, testID, tc.wantFound, listed)
+				}
+				t.Logf("\t%s\tTest %d:\tWant product to be listed: %t", tests.Success, testID, tc.wantFound)
+
+				products, _, err = pgProductRepo.Query(ctx, query.Query{Filters: byID, Limit: 1, IncludeDeleted: true})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to get a list of products. Error: %s", tests.Failed, testID, err)
+				}
+				if listed := len(products) == 1; tc.wantAll != listed {
+					t.Fatalf("\t%s\tTest %d:\tWant product to be listed with deleted ones: %t, got: %t", tests.Failed, testID, tc.wantAll, listed)
+				}
+				t.Logf("\t%s\tTest %d:\tWant product to be listed with deleted ones: %t", tests.Success, testID, tc.wantAll)
+			})
+		}
+	})
+
 	t.Run("Given the need to delete a product from PostgreSQL by it`s id", func(t *testing.T) {
 		tt := []struct {
 			testName   string
@@ -275,7 +589,7 @@ func TestPostgre(t *testing.T) {
 				newProduct: entity.NewProduct{
 					Title:       "test",
 					Description: "test",
-					Price:       1.01,
+					Price:       101,
 					Stock:       1,
 				}},
 		}
@@ -290,7 +604,7 @@ func TestPostgre(t *testing.T) {
 				}
 				t.Logf("\t%s\tTest %d:\tShould be able to create a product.", tests.Success, testID)
 
-				if err := pgProductRepo.Delete(ctx, savedProduct.ID); err != nil {
+				if err := pgProductRepo.Delete(ctx, savedProduct.ID, savedProduct.Version); err != nil {
 					t.Fatalf("\t%s\tTest %d:\tShould be able to delete a product by it`s id. Error: %s", tests.Failed, testID, err)
 				}
 				t.Logf("\t%s\tTest %d:\tShould be able to delete a product by it`s id.", tests.Success, testID)
@@ -4,8 +4,10 @@ package product
 
 import (
 	"context"
+	"time"
 
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/query"
 )
 
 // Repository is an interface that represents persistent storage abstraction.
@@ -13,8 +15,12 @@ import (
 // so concrete implementation of database should implements the set of these methods.
 type Repository interface {
 	Create(ctx context.Context, newProduct entity.NewProduct) (entity.Product, error)
-	Query(ctx context.Context, lastSeenID, limit string) ([]entity.Product, error)
+	Query(ctx context.Context, q query.Query) ([]entity.Product, query.Page, error)
+	Search(ctx context.Context, text string, limit int) ([]entity.ProductSearchResult, error)
 	QueryByID(ctx context.Context, id string) (entity.Product, error)
-	Update(ctx context.Context, id string, updateProduct entity.UpdateProduct) error
-	Delete(ctx context.Context, id string) error
+	QueryByIDForUpdate(ctx context.Context, id string) (entity.Product, error)
+	Update(ctx context.Context, id string, version int, updateProduct entity.UpdateProduct) error
+	Delete(ctx context.Context, id string, version int) error
+	Restore(ctx context.Context, id string) error
+	Purge(ctx context.Context, before time.Time) (int64, error)
 }
@@ -0,0 +1,129 @@
+package repotest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+	"github.com/rtbe/clean-rest-api/repository/auth"
+)
+
+// Auth checks that repositories created by newRepo behave as auth.Repository should.
+// Refresh tokens do not refer to other entities, so it takes a factory of a single repository.
+func Auth(t *testing.T, newRepo func(t *testing.T) auth.Repository) {
+	ctx := context.Background()
+
+	newToken := func(t *testing.T, r auth.Repository, userID, familyID string) entity.RefreshToken {
+		t.Helper()
+
+		rt := entity.RefreshToken{
+			UUID:      uuid.NewString(),
+			FamilyID:  familyID,
+			UserID:    userID,
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		}
+		if err := r.Create(ctx, rt); err != nil {
+			t.Fatalf("\t%s\tShould be able to create a refresh token. Error: %s", tests.Failed, err)
+		}
+
+		return rt
+	}
+
+	t.Run("Given the need to use a refresh token", func(t *testing.T) {
+		r := newRepo(t)
+		created := newToken(t, r, uuid.NewString(), uuid.NewString())
+
+		rt, err := r.MarkUsed(ctx, created.UUID)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to mark a refresh token as used. Error: %s", tests.Failed, err)
+		}
+		if rt.UUID != created.UUID || rt.FamilyID != created.FamilyID || rt.UserID != created.UserID || rt.ExpiresAt != created.ExpiresAt || rt.Used {
+			t.Fatalf("\t%s\tWant the refresh token as it was before use, got: %+v", tests.Failed, rt)
+		}
+		if rt, err = r.MarkUsed(ctx, created.UUID); err != nil || !rt.Used {
+			t.Fatalf("\t%s\tWant the refresh token to be already used, got: %+v, error: %v", tests.Failed, rt, err)
+		}
+		t.Logf("\t%s\tShould tell whether a refresh token was already used.", tests.Success)
+
+		if _, err := r.MarkUsed(ctx, uuid.NewString()); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on use of unknown refresh token, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould get not found error.", tests.Success)
+	})
+
+	t.Run("Given the need to delete refresh tokens", func(t *testing.T) {
+		r := newRepo(t)
+		userID, familyID := uuid.NewString(), uuid.NewString()
+		single := newToken(t, r, userID, uuid.NewString())
+		family := []entity.RefreshToken{newToken(t, r, userID, familyID), newToken(t, r, uuid.NewString(), familyID)}
+		other := newToken(t, r, uuid.NewString(), uuid.NewString())
+
+		if err := r.Delete(ctx, single.UUID); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete a refresh token. Error: %s", tests.Failed, err)
+		}
+		if _, err := r.MarkUsed(ctx, single.UUID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant a deleted refresh token to be gone, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to delete a refresh token.", tests.Success)
+
+		if err := r.DeleteFamily(ctx, familyID); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete a family of refresh tokens. Error: %s", tests.Failed, err)
+		}
+		for _, rt := range family {
+			if _, err := r.MarkUsed(ctx, rt.UUID); errors.Cause(err) != database.ErrNotFound {
+				t.Fatalf("\t%s\tWant all refresh tokens of a family to be gone, got: %v", tests.Failed, err)
+			}
+		}
+		t.Logf("\t%s\tShould delete all refresh tokens of a family.", tests.Success)
+
+		mine := newToken(t, r, other.UserID, uuid.NewString())
+		if err := r.DeleteByUserID(ctx, other.UserID); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete refresh tokens of a user. Error: %s", tests.Failed, err)
+		}
+		for _, rt := range []entity.RefreshToken{other, mine} {
+			if _, err := r.MarkUsed(ctx, rt.UUID); errors.Cause(err) != database.ErrNotFound {
+				t.Fatalf("\t%s\tWant all refresh tokens of a user to be gone, got: %v", tests.Failed, err)
+			}
+		}
+		t.Logf("\t%s\tShould delete all refresh tokens of a user.", tests.Success)
+	})
+
+	t.Run("Given the need to use a refresh token concurrently", func(t *testing.T) {
+		r := newRepo(t)
+		created := newToken(t, r, uuid.NewString(), uuid.NewString())
+
+		const users = 10
+		var wg sync.WaitGroup
+		used := make(chan bool, users)
+		for i := 0; i < users; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rt, err := r.MarkUsed(ctx, created.UUID)
+				if err != nil {
+					t.Errorf("\t%s\tShould be able to mark a refresh token as used. Error: %s", tests.Failed, err)
+				}
+				used <- rt.Used
+			}()
+		}
+		wg.Wait()
+		close(used)
+
+		var fresh int
+		for u := range used {
+			if !u {
+				fresh++
+			}
+		}
+		if fresh != 1 {
+			t.Fatalf("\t%s\tWant exactly one use of a refresh token to find it unused, got: %d", tests.Failed, fresh)
+		}
+		t.Logf("\t%s\tShould let exactly one of concurrent uses to find a refresh token unused.", tests.Success)
+	})
+}
@@ -0,0 +1,167 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+	loginattempt "github.com/rtbe/clean-rest-api/repository/login_attempt"
+)
+
+// LoginAttempts checks that repositories created by newRepo behave as loginattempt.Repository should.
+// Attempts do not refer to other entities, so it takes a factory of a single repository.
+func LoginAttempts(t *testing.T, newRepo func(t *testing.T) loginattempt.Repository) {
+	ctx := context.Background()
+	// Times are truncated to milliseconds, which is a precision MongoDB keeps them with.
+	start := time.Now().UTC().Truncate(time.Millisecond)
+	window := time.Hour
+
+	t.Run("Given the need to count failed sign in attempts", func(t *testing.T) {
+		r := newRepo(t)
+		key := unique("user:")
+
+		tt := []struct {
+			testName string
+			at       time.Time
+			before   int
+			after    int
+		}{
+			{testName: "First failure", at: start, before: 0, after: 1},
+			{testName: "Failure within window", at: start.Add(time.Minute), before: 1, after: 2},
+			{testName: "Another failure within window", at: start.Add(30 * time.Minute), before: 2, after: 3},
+			{testName: "Failure after window starts over", at: start.Add(2 * time.Hour), before: 3, after: 1},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				prev, err := r.AddFailure(ctx, key, tc.at, window)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a failure. Error: %s", tests.Failed, testID, err)
+				}
+				if prev.Failures != tc.before {
+					t.Fatalf("\t%s\tTest %d:\tWant failures before: %d, got: %d", tests.Failed, testID, tc.before, prev.Failures)
+				}
+				t.Logf("\t%s\tTest %d:\tWant failures before: %d, got: %d", tests.Success, testID, tc.before, prev.Failures)
+
+				a, err := r.Query(ctx, key)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to get attempts. Error: %s", tests.Failed, testID, err)
+				}
+				if a.Failures != tc.after {
+					t.Fatalf("\t%s\tTest %d:\tWant failures after: %d, got: %d", tests.Failed, testID, tc.after, a.Failures)
+				}
+				if !a.LastFailure.Equal(tc.at) {
+					t.Fatalf("\t%s\tTest %d:\tWant last failure: %v, got: %v", tests.Failed, testID, tc.at, a.LastFailure)
+				}
+				t.Logf("\t%s\tTest %d:\tWant failures after: %d, last failure: %v", tests.Success, testID, tc.after, tc.at)
+			})
+		}
+	})
+
+	t.Run("Given the need to count concurrent failures one after another", func(t *testing.T) {
+		r := newRepo(t)
+		key := unique("ip:")
+		n := 20
+
+		var mu sync.Mutex
+		var before []int
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				prev, err := r.AddFailure(ctx, key, start, window)
+				if err != nil {
+					t.Errorf("\t%s\tShould be able to add a failure. Error: %s", tests.Failed, err)
+					return
+				}
+
+				mu.Lock()
+				before = append(before, prev.Failures)
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		sort.Ints(before)
+		for i, failures := range before {
+			if failures != i {
+				t.Fatalf("\t%s\tWant every failure to see a distinct count of earlier ones, got: %v", tests.Failed, before)
+			}
+		}
+		a, err := r.Query(ctx, key)
+		if err != nil || a.Failures != n {
+			t.Fatalf("\t%s\tWant failures: %d, got: %d, error: %v", tests.Failed, n, a.Failures, err)
+		}
+		t.Logf("\t%s\tShould count every one of %d concurrent failures.", tests.Success, n)
+	})
+
+	t.Run("Given the need to take back a failure", func(t *testing.T) {
+		r := newRepo(t)
+		key := unique("ip:")
+
+		for i := 0; i < 2; i++ {
+			if _, err := r.AddFailure(ctx, key, start, window); err != nil {
+				t.Fatalf("\t%s\tShould be able to add a failure. Error: %s", tests.Failed, err)
+			}
+		}
+		if err := r.RemoveFailure(ctx, key); err != nil {
+			t.Fatalf("\t%s\tShould be able to remove a failure. Error: %s", tests.Failed, err)
+		}
+
+		a, err := r.Query(ctx, key)
+		if err != nil || a.Failures != 1 {
+			t.Fatalf("\t%s\tWant failures: 1, got: %d, error: %v", tests.Failed, a.Failures, err)
+		}
+		t.Logf("\t%s\tShould take back a failure.", tests.Success)
+
+		if err := r.RemoveFailure(ctx, unique("ip:")); err != nil {
+			t.Fatalf("\t%s\tShould ignore removal of a failure by an unknown key. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould ignore removal of a failure by an unknown key.", tests.Success)
+	})
+
+	t.Run("Given the need to count failures by different keys separately", func(t *testing.T) {
+		r := newRepo(t)
+		userKey, ipKey := unique("user:"), unique("ip:")
+
+		if _, err := r.AddFailure(ctx, userKey, start, window); err != nil {
+			t.Fatalf("\t%s\tShould be able to add a failure. Error: %s", tests.Failed, err)
+		}
+		if _, err := r.AddFailure(ctx, ipKey, start, window); err != nil {
+			t.Fatalf("\t%s\tShould be able to add a failure. Error: %s", tests.Failed, err)
+		}
+
+		a, err := r.Query(ctx, userKey)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to get attempts. Error: %s", tests.Failed, err)
+		}
+		if a.Failures != 1 {
+			t.Fatalf("\t%s\tWant failures: 1, got: %d", tests.Failed, a.Failures)
+		}
+		t.Logf("\t%s\tWant failures: 1, got: %d", tests.Success, a.Failures)
+	})
+
+	t.Run("Given the need to reset failed sign in attempts", func(t *testing.T) {
+		r := newRepo(t)
+		key := unique("user:")
+
+		if _, err := r.AddFailure(ctx, key, start, window); err != nil {
+			t.Fatalf("\t%s\tShould be able to add a failure. Error: %s", tests.Failed, err)
+		}
+		if err := r.Reset(ctx, key); err != nil {
+			t.Fatalf("\t%s\tShould be able to reset attempts. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to reset attempts.", tests.Success)
+
+		if _, err := r.Query(ctx, key); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found error after reset, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tWant not found error after reset.", tests.Success)
+	})
+}
@@ -0,0 +1,304 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+// Order checks that repositories created by newRepos behave as order.Repository should.
+func Order(t *testing.T, newRepos Factory) {
+	ctx := context.Background()
+
+	t.Run("Given the need to create and get an order", func(t *testing.T) {
+		repos := newRepos(t)
+		r := repos.Order
+		u := createUser(t, repos.User)
+
+		created, err := r.Create(ctx, entity.NewOrder{UserID: u.ID, Status: entity.OrderStatusPending})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create an order. Error: %s", tests.Failed, err)
+		}
+		if created.ID == "" || created.Version != 1 || created.UserID != u.ID || created.Status != entity.OrderStatusPending || created.Total != 0 {
+			t.Fatalf("\t%s\tWant an order with id, version 1, given fields and zero totals, got: %+v", tests.Failed, created)
+		}
+		t.Logf("\t%s\tShould be able to create an order.", tests.Success)
+
+		for _, get := range []struct {
+			by    string
+			query func() (entity.Order, error)
+		}{
+			{by: "id", query: func() (entity.Order, error) { return r.QueryByID(ctx, created.ID) }},
+			{by: "id for update", query: func() (entity.Order, error) { return r.QueryByIDForUpdate(ctx, created.ID) }},
+		} {
+			o, err := get.query()
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to get an order by %s. Error: %s", tests.Failed, get.by, err)
+			}
+			if o.ID != created.ID || o.UserID != u.ID || o.Status != created.Status {
+				t.Fatalf("\t%s\tWant the created order by %s, got: %+v", tests.Failed, get.by, o)
+			}
+			t.Logf("\t%s\tShould be able to get an order by %s.", tests.Success, get.by)
+		}
+
+		orders, err := r.QueryByUserID(ctx, u.ID)
+		if err != nil || len(orders) != 1 || orders[0].ID != created.ID {
+			t.Fatalf("\t%s\tWant the only order of a user, got: %d orders, error: %v", tests.Failed, len(orders), err)
+		}
+		orders, err = r.QueryByUserID(ctx, createUser(t, repos.User).ID)
+		if err != nil || len(orders) != 0 {
+			t.Fatalf("\t%s\tWant no orders of another user, got: %d orders, error: %v", tests.Failed, len(orders), err)
+		}
+		t.Logf("\t%s\tShould be able to get orders of a user.", tests.Success)
+	})
+
+	t.Run("Given the need to get an order that does not exist", func(t *testing.T) {
+		r := newRepos(t).Order
+
+		if _, err := r.QueryByID(ctx, uuid.NewString()); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found by id, got: %v", tests.Failed, err)
+		}
+		if _, err := r.QueryByIDForUpdate(ctx, uuid.NewString()); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found by id for update, got: %v", tests.Failed, err)
+		}
+		if err := r.Update(ctx, uuid.NewString(), 0, entity.UpdateOrder{Status: tests.StrPtr(entity.OrderStatusPaid)}); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on update, got: %v", tests.Failed, err)
+		}
+		if err := r.Delete(ctx, uuid.NewString(), 0); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on delete, got: %v", tests.Failed, err)
+		}
+		if err := r.Restore(ctx, uuid.NewString()); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on restore, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould get not found errors.", tests.Success)
+	})
+
+	t.Run("Given the need to page through orders", func(t *testing.T) {
+		repos := newRepos(t)
+		r := repos.Order
+		u := createUser(t, repos.User)
+
+		var want []string
+		for i := 0; i < 5; i++ {
+			o, err := r.Create(ctx, entity.NewOrder{UserID: u.ID, Status: entity.OrderStatusPending})
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to create an order. Error: %s", tests.Failed, err)
+			}
+			want = append(want, o.ID)
+		}
+		sort.Strings(want)
+
+		list := func(ctx context.Context, q query.Query) ([]string, query.Page, error) {
+			orders, page, err := r.Query(ctx, q)
+			var ids []string
+			for _, o := range orders {
+				ids = append(ids, o.ID)
+			}
+			return ids, page, err
+		}
+		checkPaging(t, list, query.Query{
+			Filters: []query.Filter{{Field: "user_id", Op: query.Eq, Value: u.ID}},
+			Sort:    []query.Sort{{Field: "order_id"}},
+		}, want)
+
+		// Orders of the same status are told apart by a tie breaker.
+		checkPaging(t, list, query.Query{
+			Filters: []query.Filter{{Field: "user_id", Op: query.Eq, Value: u.ID}},
+			Sort:    []query.Sort{{Field: "status"}},
+		}, want)
+	})
+
+	t.Run("Given the need to update an order", func(t *testing.T) {
+		repos := newRepos(t)
+		r := repos.Order
+		created := createOrder(t, repos)
+
+		if err := r.Update(ctx, created.ID, created.Version, entity.UpdateOrder{}); err != nil {
+			t.Fatalf("\t%s\tShould be able to update an order without changes. Error: %s", tests.Failed, err)
+		}
+		o, err := r.QueryByID(ctx, created.ID)
+		if err != nil || o.Status != created.Status || o.Version != created.Version+1 {
+			t.Fatalf("\t%s\tWant status kept and version bumped, got: %+v, error: %v", tests.Failed, o, err)
+		}
+		if err := r.Update(ctx, created.ID, o.Version, entity.UpdateOrder{Status: tests.StrPtr(entity.OrderStatusPaid)}); err != nil {
+			t.Fatalf("\t%s\tShould be able to update status of an order. Error: %s", tests.Failed, err)
+		}
+		if o, _ = r.QueryByID(ctx, created.ID); o.Status != entity.OrderStatusPaid {
+			t.Fatalf("\t%s\tWant status: %s, got: %s", tests.Failed, entity.OrderStatusPaid, o.Status)
+		}
+		t.Logf("\t%s\tShould update only given fields and bump a version.", tests.Success)
+
+		if err := r.Update(ctx, created.ID, created.Version, entity.UpdateOrder{Status: tests.StrPtr(entity.OrderStatusShipped)}); errors.Cause(err) != database.ErrVersionConflict {
+			t.Fatalf("\t%s\tWant version conflict on update of stale version, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould not update an order of stale version.", tests.Success)
+
+		totals := entity.OrderTotals{Subtotal: 1000, Tax: 200, Total: 1200}
+		if err := r.UpdateTotals(ctx, created.ID, totals); err != nil {
+			t.Fatalf("\t%s\tShould be able to update totals of an order. Error: %s", tests.Failed, err)
+		}
+		updated, err := r.QueryByID(ctx, created.ID)
+		if err != nil || updated.OrderTotals != totals || updated.Status != entity.OrderStatusPaid || updated.Version != o.Version+1 {
+			t.Fatalf("\t%s\tWant only totals updated and version bumped, got: %+v, error: %v", tests.Failed, updated, err)
+		}
+		t.Logf("\t%s\tShould update totals of an order.", tests.Success)
+
+		for _, to := range []string{entity.OrderStatusPaid, entity.OrderStatusShipped} {
+			if _, err := r.CreateStatusChange(ctx, entity.OrderStatusChange{OrderID: created.ID, FromStatus: created.Status, ToStatus: to, Actor: created.UserID}); err != nil {
+				t.Fatalf("\t%s\tShould be able to record a status change. Error: %s", tests.Failed, err)
+			}
+		}
+		history, err := r.QueryStatusHistory(ctx, created.ID)
+		if err != nil || len(history) != 2 || history[0].ToStatus != entity.OrderStatusPaid || history[1].ToStatus != entity.OrderStatusShipped || history[0].ID == "" {
+			t.Fatalf("\t%s\tWant status changes oldest first, got: %+v, error: %v", tests.Failed, history, err)
+		}
+		if history, err := r.QueryStatusHistory(ctx, uuid.NewString()); err != nil || len(history) != 0 {
+			t.Fatalf("\t%s\tWant no status changes of unknown order, got: %d, error: %v", tests.Failed, len(history), err)
+		}
+		t.Logf("\t%s\tShould keep status history of an order.", tests.Success)
+	})
+
+	t.Run("Given the need to delete, restore and purge an order", func(t *testing.T) {
+		repos := newRepos(t)
+		r := repos.Order
+		created := createOrder(t, repos)
+
+		if err := r.Delete(ctx, created.ID, created.Version+1); errors.Cause(err) != database.ErrVersionConflict {
+			t.Fatalf("\t%s\tWant version conflict on delete of stale version, got: %v", tests.Failed, err)
+		}
+		if err := r.Delete(ctx, created.ID, created.Version); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete an order. Error: %s", tests.Failed, err)
+		}
+		if _, err := r.QueryByID(ctx, created.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found for a deleted order, got: %v", tests.Failed, err)
+		}
+		if orders, err := r.QueryByUserID(ctx, created.UserID); err != nil || len(orders) != 0 {
+			t.Fatalf("\t%s\tWant a deleted order not to be listed for a user, got: %d, error: %v", tests.Failed, len(orders), err)
+		}
+		t.Logf("\t%s\tShould hide a deleted order.", tests.Success)
+
+		if err := r.Restore(ctx, created.ID); err != nil {
+			t.Fatalf("\t%s\tShould be able to restore an order. Error: %s", tests.Failed, err)
+		}
+		if err := r.Restore(ctx, created.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on restore of an order that is not deleted, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to restore an order.", tests.Success)
+
+		// Deleting orders of a user deletes all of them.
+		another, err := r.Create(ctx, entity.NewOrder{UserID: created.UserID, Status: entity.OrderStatusPending})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create an order. Error: %s", tests.Failed, err)
+		}
+		if err := r.DeleteByUserID(ctx, created.UserID); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete orders of a user. Error: %s", tests.Failed, err)
+		}
+		for _, id := range []string{created.ID, another.ID} {
+			if _, err := r.QueryByID(ctx, id); errors.Cause(err) != database.ErrNotFound {
+				t.Fatalf("\t%s\tWant all orders of a user deleted, got: %v", tests.Failed, err)
+			}
+		}
+		t.Logf("\t%s\tShould delete all orders of a user.", tests.Success)
+
+		// Restoring orders of a user brings back ones deleted since given time only.
+		if err := r.RestoreByUserID(ctx, created.UserID, time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("\t%s\tShould be able to restore orders of a user. Error: %s", tests.Failed, err)
+		}
+		if _, err := r.QueryByID(ctx, created.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant orders deleted before given time to stay deleted, got: %v", tests.Failed, err)
+		}
+		if err := r.RestoreByUserID(ctx, created.UserID, time.Now().Add(-time.Minute)); err != nil {
+			t.Fatalf("\t%s\tShould be able to restore orders of a user. Error: %s", tests.Failed, err)
+		}
+		if orders, err := r.QueryByUserID(ctx, created.UserID); err != nil || len(orders) != 2 {
+			t.Fatalf("\t%s\tWant all orders of a user restored, got: %d, error: %v", tests.Failed, len(orders), err)
+		}
+		if err := r.DeleteByUserID(ctx, created.UserID); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete orders of a user. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould restore orders of a user deleted since given time.", tests.Success)
+
+		if _, err := r.CreateStatusChange(ctx, entity.OrderStatusChange{OrderID: created.ID, FromStatus: created.Status, ToStatus: entity.OrderStatusCancelled}); err != nil {
+			t.Fatalf("\t%s\tShould be able to record a status change. Error: %s", tests.Failed, err)
+		}
+		if _, err := r.Purge(ctx, time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("\t%s\tShould be able to purge orders. Error: %s", tests.Failed, err)
+		}
+		orders, _, err := r.Query(ctx, query.Query{
+			Filters:        []query.Filter{{Field: "user_id", Op: query.Eq, Value: created.UserID}},
+			IncludeDeleted: true,
+		})
+		if err != nil || len(orders) != 0 {
+			t.Fatalf("\t%s\tWant purged orders to be gone, got: %d, error: %v", tests.Failed, len(orders), err)
+		}
+		if history, err := r.QueryStatusHistory(ctx, created.ID); err != nil || len(history) != 0 {
+			t.Fatalf("\t%s\tWant status history of a purged order to be gone, got: %d, error: %v", tests.Failed, len(history), err)
+		}
+		t.Logf("\t%s\tShould purge deleted orders along with their status history.", tests.Success)
+	})
+
+	t.Run("Given the need to write an order concurrently", func(t *testing.T) {
+		repos := newRepos(t)
+		r := repos.Order
+		created := createOrder(t, repos)
+
+		const writers = 10
+		var wg sync.WaitGroup
+		errs := make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- r.Update(ctx, created.ID, created.Version, entity.UpdateOrder{Status: tests.StrPtr(entity.OrderStatusPaid)})
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		var updated int
+		for err := range errs {
+			switch errors.Cause(err) {
+			case nil:
+				updated++
+			case database.ErrVersionConflict:
+			default:
+				t.Fatalf("\t%s\tWant version conflicts of concurrent updates, got: %v", tests.Failed, err)
+			}
+		}
+		if updated != 1 {
+			t.Fatalf("\t%s\tWant exactly one update of the same version to succeed, got: %d", tests.Failed, updated)
+		}
+		t.Logf("\t%s\tShould apply exactly one of concurrent updates of the same version.", tests.Success)
+
+		errs = make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := r.Create(ctx, entity.NewOrder{UserID: created.UserID, Status: entity.OrderStatusPending})
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to create orders concurrently. Error: %s", tests.Failed, err)
+			}
+		}
+		if orders, err := r.QueryByUserID(ctx, created.UserID); err != nil || len(orders) != writers+1 {
+			t.Fatalf("\t%s\tWant %d orders of a user, got: %d, error: %v", tests.Failed, writers+1, len(orders), err)
+		}
+		t.Logf("\t%s\tShould keep all orders created concurrently.", tests.Success)
+	})
+}
@@ -0,0 +1,283 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+// OrderItem checks that repositories created by newRepos behave as orderitem.Repository should.
+func OrderItem(t *testing.T, newRepos Factory) {
+	ctx := context.Background()
+
+	t.Run("Given the need to create and get an order item", func(t *testing.T) {
+		repos := newRepos(t)
+		r := repos.OrderItem
+		o := createOrder(t, repos)
+		p := createProduct(t, repos.Product)
+
+		created, err := r.Create(ctx, entity.NewOrderItem{
+			OrderID:      o.ID,
+			ProductID:    p.ID,
+			Quantity:     3,
+			UnitPrice:    p.Price,
+			ProductTitle: p.Title,
+		})
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create an order item. Error: %s", tests.Failed, err)
+		}
+		if created.ID == "" || created.Version != 1 || created.Quantity != 3 || created.UnitPrice != p.Price || created.ProductTitle != p.Title {
+			t.Fatalf("\t%s\tWant an order item with id, version 1 and given fields, got: %+v", tests.Failed, created)
+		}
+		t.Logf("\t%s\tShould be able to create an order item.", tests.Success)
+
+		oi, err := r.QueryByID(ctx, created.ID)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to get an order item by id. Error: %s", tests.Failed, err)
+		}
+		if oi.ID != created.ID || oi.OrderID != o.ID || oi.ProductID != p.ID || oi.Quantity != 3 || oi.UnitPrice != p.Price {
+			t.Fatalf("\t%s\tWant the created order item, got: %+v", tests.Failed, oi)
+		}
+		t.Logf("\t%s\tShould be able to get an order item by id.", tests.Success)
+
+		another := createOrderItem(t, repos, o.ID)
+		createOrderItem(t, repos, createOrder(t, repos).ID)
+		items, err := r.QueryByOrderID(ctx, o.ID)
+		if err != nil || len(items) != 2 {
+			t.Fatalf("\t%s\tWant 2 items of an order, got: %d, error: %v", tests.Failed, len(items), err)
+		}
+		got := []string{items[0].ID, items[1].ID}
+		want := []string{created.ID, another.ID}
+		sort.Strings(got)
+		sort.Strings(want)
+		if got[0] != want[0] || got[1] != want[1] {
+			t.Fatalf("\t%s\tWant items %v of an order, got: %v", tests.Failed, want, got)
+		}
+		t.Logf("\t%s\tShould be able to get items of an order.", tests.Success)
+	})
+
+	t.Run("Given the need to get an order item that does not exist", func(t *testing.T) {
+		r := newRepos(t).OrderItem
+
+		if _, err := r.QueryByID(ctx, uuid.NewString()); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found by id, got: %v", tests.Failed, err)
+		}
+		if err := r.Update(ctx, uuid.NewString(), 0, entity.UpdateOrderItem{Quantity: tests.IntPtr(1)}); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on update, got: %v", tests.Failed, err)
+		}
+		if err := r.Delete(ctx, uuid.NewString(), 0); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on delete, got: %v", tests.Failed, err)
+		}
+		if err := r.Restore(ctx, uuid.NewString()); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on restore, got: %v", tests.Failed, err)
+		}
+		if items, err := r.QueryByOrderID(ctx, uuid.NewString()); err != nil || len(items) != 0 {
+			t.Fatalf("\t%s\tWant no items of unknown order, got: %d, error: %v", tests.Failed, len(items), err)
+		}
+		t.Logf("\t%s\tShould get not found errors.", tests.Success)
+	})
+
+	t.Run("Given the need to page through order items", func(t *testing.T) {
+		repos := newRepos(t)
+		o := createOrder(t, repos)
+
+		var want []string
+		for i := 0; i < 5; i++ {
+			want = append(want, createOrderItem(t, repos, o.ID).ID)
+		}
+		sort.Strings(want)
+
+		list := func(ctx context.Context, q query.Query) ([]string, query.Page, error) {
+			items, page, err := repos.OrderItem.Query(ctx, q)
+			var ids []string
+			for _, oi := range items {
+				ids = append(ids, oi.ID)
+			}
+			return ids, page, err
+		}
+		checkPaging(t, list, query.Query{
+			Filters: []query.Filter{{Field: "order_id", Op: query.Eq, Value: o.ID}},
+			Sort:    []query.Sort{{Field: "order_item_id"}},
+		}, want)
+
+		// Items of the same quantity are told apart by a tie breaker.
+		checkPaging(t, list, query.Query{
+			Filters: []query.Filter{{Field: "order_id", Op: query.Eq, Value: o.ID}},
+			Sort:    []query.Sort{{Field: "quantity"}},
+		}, want)
+	})
+
+	t.Run("Given the need to update an order item", func(t *testing.T) {
+		repos := newRepos(t)
+		r := repos.OrderItem
+		created := createOrderItem(t, repos, createOrder(t, repos).ID)
+
+		if err := r.Update(ctx, created.ID, created.Version, entity.UpdateOrderItem{Quantity: tests.IntPtr(5)}); err != nil {
+			t.Fatalf("\t%s\tShould be able to update an order item. Error: %s", tests.Failed, err)
+		}
+		oi, err := r.QueryByID(ctx, created.ID)
+		if err != nil || oi.Quantity != 5 || oi.UnitPrice != created.UnitPrice || oi.ProductTitle != created.ProductTitle || oi.Version != created.Version+1 {
+			t.Fatalf("\t%s\tWant only quantity updated and version bumped, got: %+v, error: %v", tests.Failed, oi, err)
+		}
+		t.Logf("\t%s\tShould update only given fields and bump a version.", tests.Success)
+
+		if err := r.Update(ctx, created.ID, created.Version, entity.UpdateOrderItem{Quantity: tests.IntPtr(7)}); errors.Cause(err) != database.ErrVersionConflict {
+			t.Fatalf("\t%s\tWant version conflict on update of stale version, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould not update an order item of stale version.", tests.Success)
+	})
+
+	t.Run("Given the need to delete, restore and purge an order item", func(t *testing.T) {
+		repos := newRepos(t)
+		r := repos.OrderItem
+		o := createOrder(t, repos)
+		created := createOrderItem(t, repos, o.ID)
+
+		if err := r.Delete(ctx, created.ID, created.Version+1); errors.Cause(err) != database.ErrVersionConflict {
+			t.Fatalf("\t%s\tWant version conflict on delete of stale version, got: %v", tests.Failed, err)
+		}
+		if err := r.Delete(ctx, created.ID, created.Version); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete an order item. Error: %s", tests.Failed, err)
+		}
+		if _, err := r.QueryByID(ctx, created.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found for a deleted order item, got: %v", tests.Failed, err)
+		}
+		if items, err := r.QueryByOrderID(ctx, o.ID); err != nil || len(items) != 0 {
+			t.Fatalf("\t%s\tWant a deleted order item not to be listed for an order, got: %d, error: %v", tests.Failed, len(items), err)
+		}
+		t.Logf("\t%s\tShould hide a deleted order item.", tests.Success)
+
+		if err := r.Restore(ctx, created.ID); err != nil {
+			t.Fatalf("\t%s\tShould be able to restore an order item. Error: %s", tests.Failed, err)
+		}
+		if err := r.Restore(ctx, created.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on restore of an order item that is not deleted, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to restore an order item.", tests.Success)
+
+		// Deleting items of an order deletes all of them.
+		another := createOrderItem(t, repos, o.ID)
+		if err := r.DeleteByOrderID(ctx, o.ID); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete items of an order. Error: %s", tests.Failed, err)
+		}
+		for _, id := range []string{created.ID, another.ID} {
+			if _, err := r.QueryByID(ctx, id); errors.Cause(err) != database.ErrNotFound {
+				t.Fatalf("\t%s\tWant all items of an order deleted, got: %v", tests.Failed, err)
+			}
+		}
+		t.Logf("\t%s\tShould delete all items of an order.", tests.Success)
+
+		// Restoring items of an order brings back ones deleted since given time only.
+		if err := r.RestoreByOrderID(ctx, o.ID, time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("\t%s\tShould be able to restore items of an order. Error: %s", tests.Failed, err)
+		}
+		if _, err := r.QueryByID(ctx, created.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant items deleted before given time to stay deleted, got: %v", tests.Failed, err)
+		}
+		if err := r.RestoreByOrderID(ctx, o.ID, time.Now().Add(-time.Minute)); err != nil {
+			t.Fatalf("\t%s\tShould be able to restore items of an order. Error: %s", tests.Failed, err)
+		}
+		if items, err := r.QueryByOrderID(ctx, o.ID); err != nil || len(items) != 2 {
+			t.Fatalf("\t%s\tWant all items of an order restored, got: %d, error: %v", tests.Failed, len(items), err)
+		}
+		if err := r.DeleteByOrderID(ctx, o.ID); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete items of an order. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould restore items of an order deleted since given time.", tests.Success)
+
+		if _, err := r.Purge(ctx, time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("\t%s\tShould be able to purge order items. Error: %s", tests.Failed, err)
+		}
+		items, _, err := r.Query(ctx, query.Query{
+			Filters:        []query.Filter{{Field: "order_id", Op: query.Eq, Value: o.ID}},
+			IncludeDeleted: true,
+		})
+		if err != nil || len(items) != 0 {
+			t.Fatalf("\t%s\tWant purged order items to be gone, got: %d, error: %v", tests.Failed, len(items), err)
+		}
+		t.Logf("\t%s\tShould purge deleted order items.", tests.Success)
+
+		// Items of a purged order are purged along with it, even if they were not deleted.
+		kept := createOrderItem(t, repos, o.ID)
+		if err := repos.Order.Delete(ctx, o.ID, 0); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete an order. Error: %s", tests.Failed, err)
+		}
+		if _, err := repos.Order.Purge(ctx, time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("\t%s\tShould be able to purge orders. Error: %s", tests.Failed, err)
+		}
+		if _, err := r.Purge(ctx, time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("\t%s\tShould be able to purge order items. Error: %s", tests.Failed, err)
+		}
+		if _, err := r.QueryByID(ctx, kept.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant items of a purged order to be gone, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould purge items of purged orders.", tests.Success)
+	})
+
+	t.Run("Given the need to write an order item concurrently", func(t *testing.T) {
+		repos := newRepos(t)
+		r := repos.OrderItem
+		o := createOrder(t, repos)
+		created := createOrderItem(t, repos, o.ID)
+
+		const writers = 10
+		var wg sync.WaitGroup
+		errs := make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(quantity int) {
+				defer wg.Done()
+				errs <- r.Update(ctx, created.ID, created.Version, entity.UpdateOrderItem{Quantity: tests.IntPtr(quantity)})
+			}(i + 1)
+		}
+		wg.Wait()
+		close(errs)
+
+		var updated int
+		for err := range errs {
+			switch errors.Cause(err) {
+			case nil:
+				updated++
+			case database.ErrVersionConflict:
+			default:
+				t.Fatalf("\t%s\tWant version conflicts of concurrent updates, got: %v", tests.Failed, err)
+			}
+		}
+		if updated != 1 {
+			t.Fatalf("\t%s\tWant exactly one update of the same version to succeed, got: %d", tests.Failed, updated)
+		}
+		t.Logf("\t%s\tShould apply exactly one of concurrent updates of the same version.", tests.Success)
+
+		p := createProduct(t, repos.Product)
+		errs = make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := r.Create(ctx, entity.NewOrderItem{OrderID: o.ID, ProductID: p.ID, Quantity: 1, UnitPrice: p.Price, ProductTitle: p.Title})
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to create order items concurrently. Error: %s", tests.Failed, err)
+			}
+		}
+		if items, err := r.QueryByOrderID(ctx, o.ID); err != nil || len(items) != writers+1 {
+			t.Fatalf("\t%s\tWant %d items of an order, got: %d, error: %v", tests.Failed, writers+1, len(items), err)
+		}
+		t.Logf("\t%s\tShould keep all order items created concurrently.", tests.Success)
+	})
+}
@@ -0,0 +1,256 @@
+package repotest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+// Product checks that repositories created by newRepos behave as product.Repository should.
+func Product(t *testing.T, newRepos Factory) {
+	ctx := context.Background()
+
+	t.Run("Given the need to create and get a product", func(t *testing.T) {
+		r := newRepos(t).Product
+
+		np := entity.NewProduct{
+			Title:       unique("product"),
+			Description: "Just an apple juice",
+			Price:       entity.Money(12345),
+			Stock:       7,
+		}
+		created, err := r.Create(ctx, np)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create a product. Error: %s", tests.Failed, err)
+		}
+		if created.ID == "" || created.Version != 1 {
+			t.Fatalf("\t%s\tWant a product with id and version 1, got: %+v", tests.Failed, created)
+		}
+		t.Logf("\t%s\tShould be able to create a product.", tests.Success)
+
+		for _, get := range []struct {
+			by    string
+			query func() (entity.Product, error)
+		}{
+			{by: "id", query: func() (entity.Product, error) { return r.QueryByID(ctx, created.ID) }},
+			{by: "id for update", query: func() (entity.Product, error) { return r.QueryByIDForUpdate(ctx, created.ID) }},
+		} {
+			p, err := get.query()
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to get a product by %s. Error: %s", tests.Failed, get.by, err)
+			}
+			if p.ID != created.ID || p.Title != np.Title || p.Description != np.Description || p.Price != np.Price || p.Stock != np.Stock {
+				t.Fatalf("\t%s\tWant the created product by %s, got: %+v", tests.Failed, get.by, p)
+			}
+			t.Logf("\t%s\tShould be able to get a product by %s.", tests.Success, get.by)
+		}
+
+		if _, err := r.Create(ctx, np); errors.Cause(err) != database.ErrDuplicate {
+			t.Fatalf("\t%s\tWant duplicate error on attempt to create a product with taken title, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould not be able to create a product with taken title.", tests.Success)
+	})
+
+	t.Run("Given the need to get a product that does not exist", func(t *testing.T) {
+		r := newRepos(t).Product
+
+		if _, err := r.QueryByID(ctx, uuid.NewString()); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found by id, got: %v", tests.Failed, err)
+		}
+		if _, err := r.QueryByIDForUpdate(ctx, uuid.NewString()); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found by id for update, got: %v", tests.Failed, err)
+		}
+		if err := r.Update(ctx, uuid.NewString(), 0, entity.UpdateProduct{Stock: tests.IntPtr(1)}); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on update, got: %v", tests.Failed, err)
+		}
+		if err := r.Delete(ctx, uuid.NewString(), 0); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on delete, got: %v", tests.Failed, err)
+		}
+		if err := r.Restore(ctx, uuid.NewString()); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on restore, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould get not found errors.", tests.Success)
+	})
+
+	t.Run("Given the need to page through products", func(t *testing.T) {
+		r := newRepos(t).Product
+
+		prefix := unique("page")
+		var want []string
+		for i, price := range []entity.Money{300, 100, 500, 200, 400} {
+			p, err := r.Create(ctx, entity.NewProduct{
+				Title:       prefix + string(rune('a'+i)),
+				Description: "Page of products",
+				Price:       price,
+				Stock:       1,
+			})
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to create a product. Error: %s", tests.Failed, err)
+			}
+			want = append(want, p.Title)
+		}
+		byPrice := []string{want[1], want[3], want[0], want[4], want[2]}
+
+		list := func(ctx context.Context, q query.Query) ([]string, query.Page, error) {
+			products, page, err := r.Query(ctx, q)
+			var titles []string
+			for _, p := range products {
+				titles = append(titles, p.Title)
+			}
+			return titles, page, err
+		}
+		checkPaging(t, list, query.Query{
+			Filters: []query.Filter{{Field: "title", Op: query.Like, Value: prefix}},
+			Sort:    []query.Sort{{Field: "price"}},
+		}, byPrice)
+		checkPaging(t, list, query.Query{
+			Filters: []query.Filter{{Field: "title", Op: query.Like, Value: prefix}},
+			Sort:    []query.Sort{{Field: "title", Desc: true}},
+		}, []string{want[4], want[3], want[2], want[1], want[0]})
+
+		titles, _, err := list(ctx, query.Query{
+			Filters: []query.Filter{
+				{Field: "title", Op: query.Like, Value: prefix},
+				{Field: "price", Op: query.Gte, Value: "3.00"},
+				{Field: "price", Op: query.Lt, Value: "5.00"},
+			},
+			Sort: []query.Sort{{Field: "price", Desc: true}},
+		})
+		if err != nil || len(titles) != 2 || titles[0] != want[4] || titles[1] != want[0] {
+			t.Fatalf("\t%s\tWant products priced from 3.00 to 5.00, got: %v, error: %v", tests.Failed, titles, err)
+		}
+		t.Logf("\t%s\tShould filter products by price range.", tests.Success)
+
+		if _, _, err := list(ctx, query.Query{Sort: []query.Sort{{Field: "secret"}}}); errors.Cause(err) != query.ErrInvalidQuery {
+			t.Fatalf("\t%s\tWant invalid query for unknown sort field, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould not sort products by unknown field.", tests.Success)
+	})
+
+	t.Run("Given the need to update some fields of a product", func(t *testing.T) {
+		r := newRepos(t).Product
+		created := createProduct(t, r)
+
+		price := entity.Money(999)
+		if err := r.Update(ctx, created.ID, created.Version, entity.UpdateProduct{Price: &price}); err != nil {
+			t.Fatalf("\t%s\tShould be able to update a product. Error: %s", tests.Failed, err)
+		}
+		p, err := r.QueryByID(ctx, created.ID)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to get a product. Error: %s", tests.Failed, err)
+		}
+		if p.Price != price || p.Title != created.Title || p.Description != created.Description || p.Stock != created.Stock {
+			t.Fatalf("\t%s\tWant only price to be updated, got: %+v", tests.Failed, p)
+		}
+		if p.Version != created.Version+1 {
+			t.Fatalf("\t%s\tWant version: %d, got: %d", tests.Failed, created.Version+1, p.Version)
+		}
+		t.Logf("\t%s\tShould update only given fields and bump a version.", tests.Success)
+
+		if err := r.Update(ctx, created.ID, created.Version, entity.UpdateProduct{Stock: tests.IntPtr(0)}); errors.Cause(err) != database.ErrVersionConflict {
+			t.Fatalf("\t%s\tWant version conflict on update of stale version, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould not update a product of stale version.", tests.Success)
+
+		other := createProduct(t, r)
+		if err := r.Update(ctx, created.ID, 0, entity.UpdateProduct{Title: &other.Title}); errors.Cause(err) != database.ErrDuplicate {
+			t.Fatalf("\t%s\tWant duplicate error on attempt to update a product with taken title, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould not be able to update a product with taken title.", tests.Success)
+	})
+
+	t.Run("Given the need to delete, restore and purge a product", func(t *testing.T) {
+		repos := newRepos(t)
+		r := repos.Product
+		created := createProduct(t, r)
+
+		if err := r.Delete(ctx, created.ID, created.Version+1); errors.Cause(err) != database.ErrVersionConflict {
+			t.Fatalf("\t%s\tWant version conflict on delete of stale version, got: %v", tests.Failed, err)
+		}
+		if err := r.Delete(ctx, created.ID, created.Version); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete a product. Error: %s", tests.Failed, err)
+		}
+		if _, err := r.QueryByID(ctx, created.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found for a deleted product, got: %v", tests.Failed, err)
+		}
+		byID := query.Query{Filters: []query.Filter{{Field: "product_id", Op: query.Eq, Value: created.ID}}}
+		if products, _, err := r.Query(ctx, byID); err != nil || len(products) != 0 {
+			t.Fatalf("\t%s\tWant a deleted product not to be listed, got: %d products, error: %v", tests.Failed, len(products), err)
+		}
+		byID.IncludeDeleted = true
+		if products, _, err := r.Query(ctx, byID); err != nil || len(products) != 1 {
+			t.Fatalf("\t%s\tWant a deleted product to be listed on demand, got: %d products, error: %v", tests.Failed, len(products), err)
+		}
+		t.Logf("\t%s\tShould hide a deleted product.", tests.Success)
+
+		if err := r.Restore(ctx, created.ID); err != nil {
+			t.Fatalf("\t%s\tShould be able to restore a product. Error: %s", tests.Failed, err)
+		}
+		if err := r.Restore(ctx, created.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on restore of a product that is not deleted, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to restore a product.", tests.Success)
+
+		ordered := createOrderItem(t, repos, createOrder(t, repos).ID)
+		for _, id := range []string{created.ID, ordered.ProductID} {
+			if err := r.Delete(ctx, id, 0); err != nil {
+				t.Fatalf("\t%s\tShould be able to delete a product. Error: %s", tests.Failed, err)
+			}
+		}
+		if _, err := r.Purge(ctx, time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("\t%s\tShould be able to purge products. Error: %s", tests.Failed, err)
+		}
+		if err := r.Restore(ctx, created.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant a purged product to be gone, got: %v", tests.Failed, err)
+		}
+		if err := r.Restore(ctx, ordered.ProductID); err != nil {
+			t.Fatalf("\t%s\tWant a deleted product that was ordered to be kept on purge. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould purge deleted products that were not ordered only.", tests.Success)
+	})
+
+	t.Run("Given the need to write a product concurrently", func(t *testing.T) {
+		r := newRepos(t).Product
+		created := createProduct(t, r)
+
+		const writers = 10
+		var wg sync.WaitGroup
+		errs := make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs <- r.Update(ctx, created.ID, 0, entity.UpdateProduct{Stock: tests.IntPtr(i)})
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		var updated int
+		for err := range errs {
+			switch errors.Cause(err) {
+			case nil:
+				updated++
+			case database.ErrVersionConflict:
+			default:
+				t.Fatalf("\t%s\tWant version conflicts of concurrent updates, got: %v", tests.Failed, err)
+			}
+		}
+		p, err := r.QueryByID(ctx, created.ID)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to get a product. Error: %s", tests.Failed, err)
+		}
+		if updated == 0 || p.Version != created.Version+updated {
+			t.Fatalf("\t%s\tWant version bumped by every of %d applied updates, got: %d", tests.Failed, updated, p.Version)
+		}
+		t.Logf("\t%s\tShould not lose any of %d concurrent updates applied.", tests.Success, updated)
+	})
+}
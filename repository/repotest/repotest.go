@@ -0,0 +1,164 @@
+// Package repotest implements conformance suites of repositories.
+// Every implementation of a repository (PostgreSQL, in-memory and future ones) is plugged into a suite
+// with a factory function and checked to behave the same way, so adapters do not drift apart.
+//
+// Suites do not expect a storage to be empty, data of every test is told apart by unique names,
+// so a single database can be shared by all suites.
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+	"github.com/rtbe/clean-rest-api/repository/order"
+	orderitem "github.com/rtbe/clean-rest-api/repository/order_item"
+	"github.com/rtbe/clean-rest-api/repository/product"
+	"github.com/rtbe/clean-rest-api/repository/user"
+)
+
+// Repositories is a set of repositories of a single backend.
+// Repositories of a set share a storage, so suites can check how a change made by one of them affects the others.
+type Repositories struct {
+	User      user.Repository
+	Product   product.Repository
+	Order     order.Repository
+	OrderItem orderitem.Repository
+}
+
+// Factory creates a set of repositories of a backend for a suite.
+type Factory func(t *testing.T) Repositories
+
+// unique returns a name that is unique across tests and runs.
+func unique(prefix string) string {
+	return prefix + strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+}
+
+// createUser creates a user with unique user name and email.
+func createUser(t *testing.T, r user.Repository) entity.User {
+	t.Helper()
+
+	name := unique("user")
+	u, err := r.Create(context.Background(), entity.NewUser{
+		UserName:        name,
+		FirstName:       "Alan",
+		LastName:        "Kay",
+		Email:           name + "@example.com",
+		Password:        "OOP_is_about_messages",
+		PasswordConfirm: "OOP_is_about_messages",
+		Roles:           []string{entity.UserRole},
+	})
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to create a user. Error: %s", tests.Failed, err)
+	}
+
+	return u
+}
+
+// createProduct creates a product with unique title.
+func createProduct(t *testing.T, r product.Repository) entity.Product {
+	t.Helper()
+
+	p, err := r.Create(context.Background(), entity.NewProduct{
+		Title:       unique("product"),
+		Description: "Just an apple juice",
+		Price:       101,
+		Stock:       10,
+	})
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to create a product. Error: %s", tests.Failed, err)
+	}
+
+	return p
+}
+
+// createOrder creates an order of a new user.
+func createOrder(t *testing.T, repos Repositories) entity.Order {
+	t.Helper()
+
+	o, err := repos.Order.Create(context.Background(), entity.NewOrder{
+		UserID: createUser(t, repos.User).ID,
+		Status: entity.OrderStatusPending,
+	})
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to create an order. Error: %s", tests.Failed, err)
+	}
+
+	return o
+}
+
+// createOrderItem creates an item of a new product in given order.
+func createOrderItem(t *testing.T, repos Repositories, orderID string) entity.OrderItem {
+	t.Helper()
+
+	p := createProduct(t, repos.Product)
+	oi, err := repos.OrderItem.Create(context.Background(), entity.NewOrderItem{
+		OrderID:      orderID,
+		ProductID:    p.ID,
+		Quantity:     2,
+		UnitPrice:    p.Price,
+		ProductTitle: p.Title,
+	})
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to create an order item. Error: %s", tests.Failed, err)
+	}
+
+	return oi
+}
+
+// lister gets a page of ids of items defined by list query.
+type lister func(ctx context.Context, q query.Query) ([]string, query.Page, error)
+
+// checkPaging checks that pages of every size cover all wanted items in order, each item exactly once,
+// and that only the last page reports there are no more items.
+func checkPaging(t *testing.T, list lister, q query.Query, want []string) {
+	t.Helper()
+
+	for _, limit := range []int{1, 2, len(want) - 1, len(want), len(want) + 1} {
+		q := q
+		q.Limit = limit
+		q.Cursor = ""
+
+		var got []string
+		for pages := 1; ; pages++ {
+			ids, page, err := list(context.Background(), q)
+			if err != nil {
+				t.Fatalf("\t%s\tLimit %d:\tShould be able to get page %d. Error: %s", tests.Failed, limit, pages, err)
+			}
+			got = append(got, ids...)
+
+			if !page.HasMore {
+				if page.NextCursor != "" {
+					t.Fatalf("\t%s\tLimit %d:\tWant no cursor on the last page, got: %s", tests.Failed, limit, page.NextCursor)
+				}
+				if len(ids) > limit {
+					t.Fatalf("\t%s\tLimit %d:\tWant at most %d items on the last page, got: %d", tests.Failed, limit, limit, len(ids))
+				}
+				break
+			}
+			if len(ids) != limit {
+				t.Fatalf("\t%s\tLimit %d:\tWant %d items on page %d, got: %d", tests.Failed, limit, limit, pages, len(ids))
+			}
+			if pages > len(want) {
+				t.Fatalf("\t%s\tLimit %d:\tWant at most %d pages, got more", tests.Failed, limit, len(want))
+			}
+			q.Cursor = page.NextCursor
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("\t%s\tLimit %d:\tWant items: %v, got: %v", tests.Failed, limit, want, got)
+		}
+		t.Logf("\t%s\tLimit %d:\tWant all %d items in order.", tests.Success, limit, len(want))
+	}
+
+	q.Cursor = "not a cursor"
+	if _, _, err := list(context.Background(), q); err == nil {
+		t.Fatalf("\t%s\tShould not be able to get a page with invalid cursor.", tests.Failed)
+	}
+	t.Logf("\t%s\tShould not be able to get a page with invalid cursor.", tests.Success)
+}
@@ -0,0 +1,150 @@
+package repotest
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+	"github.com/rtbe/clean-rest-api/repository/auth"
+	loginattempt "github.com/rtbe/clean-rest-api/repository/login_attempt"
+	"github.com/rtbe/clean-rest-api/repository/order"
+	orderitem "github.com/rtbe/clean-rest-api/repository/order_item"
+	"github.com/rtbe/clean-rest-api/repository/product"
+	"github.com/rtbe/clean-rest-api/repository/session"
+	"github.com/rtbe/clean-rest-api/repository/user"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// pgDB is shared by all suites run against PostgreSQL, it is nil in short mode.
+	pgDB *sqlx.DB
+
+	// mongoDB is shared by all suites run against MongoDB, it is nil in short mode.
+	mongoDB *mongo.Database
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	// Short mode skips backends that need docker, so in-memory suites can be run anywhere.
+	if testing.Short() {
+		os.Exit(m.Run())
+	}
+
+	db, purge, err := tests.NewPostgreSQL()
+	if err != nil {
+		log.Fatalf("could not start PostgreSQL: %s", err)
+	}
+	pgDB = db
+
+	mdb, purgeMongo, err := tests.NewMongo()
+	if err != nil {
+		purge()
+		log.Fatalf("could not start MongoDB: %s", err)
+	}
+	mongoDB = mdb
+
+	code := m.Run()
+
+	// When you're done, kill and remove the containers
+	if err = purge(); err != nil {
+		log.Fatalf("could not purge resource: %s", err)
+	}
+	if err = purgeMongo(); err != nil {
+		log.Fatalf("could not purge resource: %s", err)
+	}
+
+	os.Exit(code)
+}
+
+func TestInMem(t *testing.T) {
+	newRepos := func(t *testing.T) Repositories {
+		orders := order.NewInMemRepo()
+		items := orderitem.NewInMemRepo(orders)
+
+		return Repositories{
+			User:      user.NewInMemRepo(orders),
+			Product:   product.NewInMemRepo(items),
+			Order:     orders,
+			OrderItem: items,
+		}
+	}
+
+	t.Run("User", func(t *testing.T) { User(t, newRepos) })
+	t.Run("Product", func(t *testing.T) { Product(t, newRepos) })
+	t.Run("Order", func(t *testing.T) { Order(t, newRepos) })
+	t.Run("OrderItem", func(t *testing.T) { OrderItem(t, newRepos) })
+	t.Run("Auth", func(t *testing.T) {
+		Auth(t, func(t *testing.T) auth.Repository { return auth.NewInMemRepo() })
+	})
+	t.Run("LoginAttempts", func(t *testing.T) {
+		LoginAttempts(t, func(t *testing.T) loginattempt.Repository { return loginattempt.NewInMemRepo() })
+	})
+	t.Run("Sessions", func(t *testing.T) {
+		Sessions(t, func(t *testing.T) session.Repository { return session.NewInMemRepo() })
+	})
+}
+
+func TestPostgre(t *testing.T) {
+	if pgDB == nil {
+		t.Skip("PostgreSQL is not started in short mode")
+	}
+
+	newRepos := func(t *testing.T) Repositories {
+		return Repositories{
+			User:      user.NewPostgreRepo(pgDB, nil),
+			Product:   product.NewPostgreRepo(pgDB, nil),
+			Order:     order.NewPostgreRepo(pgDB, nil),
+			OrderItem: orderitem.NewPostgreRepo(pgDB, nil),
+		}
+	}
+
+	t.Run("User", func(t *testing.T) { User(t, newRepos) })
+	t.Run("Product", func(t *testing.T) { Product(t, newRepos) })
+	t.Run("Order", func(t *testing.T) { Order(t, newRepos) })
+	t.Run("OrderItem", func(t *testing.T) { OrderItem(t, newRepos) })
+}
+
+func TestMongo(t *testing.T) {
+	if mongoDB == nil {
+		t.Skip("MongoDB is not started in short mode")
+	}
+
+	t.Run("Auth", func(t *testing.T) {
+		Auth(t, func(t *testing.T) auth.Repository { return auth.NewMongoRepo(mongoDB, nil) })
+	})
+	t.Run("LoginAttempts", func(t *testing.T) {
+		LoginAttempts(t, func(t *testing.T) loginattempt.Repository { return loginattempt.NewMongoRepo(mongoDB, nil) })
+	})
+	t.Run("Sessions", func(t *testing.T) {
+		Sessions(t, func(t *testing.T) session.Repository { return session.NewMongoRepo(mongoDB, nil) })
+	})
+
+	t.Run("Given the need to expire login attempts", func(t *testing.T) {
+		r := loginattempt.NewMongoRepo(mongoDB, nil)
+
+		// Index is created once and then it`s TTL is changed along with a window.
+		for _, ttl := range []time.Duration{time.Hour, time.Hour, 2 * time.Hour} {
+			if err := r.CreateIndexes(context.Background(), ttl); err != nil {
+				t.Fatalf("\t%s\tShould be able to create indexes with TTL %v. Error: %s", tests.Failed, ttl, err)
+			}
+		}
+		t.Logf("\t%s\tShould be able to create and update TTL index.", tests.Success)
+	})
+
+	t.Run("Given the need to expire sessions", func(t *testing.T) {
+		r := session.NewMongoRepo(mongoDB, nil)
+
+		for i := 0; i < 2; i++ {
+			if err := r.CreateIndexes(context.Background()); err != nil {
+				t.Fatalf("\t%s\tShould be able to create indexes. Error: %s", tests.Failed, err)
+			}
+		}
+		t.Logf("\t%s\tShould be able to create TTL index more than once.", tests.Success)
+	})
+}
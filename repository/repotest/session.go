@@ -0,0 +1,126 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+	"github.com/rtbe/clean-rest-api/repository/session"
+)
+
+// Sessions checks that repositories created by newRepo behave as session.Repository should.
+// Sessions do not refer to other entities, so it takes a factory of a single repository.
+func Sessions(t *testing.T, newRepo func(t *testing.T) session.Repository) {
+	ctx := context.Background()
+	// Times are truncated to milliseconds, which is a precision MongoDB keeps them with.
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	newSession := func(userID string, expiresAt time.Time) entity.Session {
+		return entity.Session{
+			ID:          uuid.NewString(),
+			UserID:      userID,
+			Device:      "laptop",
+			DateCreated: now,
+			LastUsed:    now,
+			ExpiresAt:   expiresAt,
+		}
+	}
+
+	t.Run("Given the need to hide expired sessions", func(t *testing.T) {
+		r := newRepo(t)
+		userID := uuid.NewString()
+		active := newSession(userID, now.Add(time.Hour))
+		expired := newSession(userID, now.Add(-time.Minute))
+
+		for _, s := range []entity.Session{active, expired} {
+			if err := r.Create(ctx, s); err != nil {
+				t.Fatalf("\t%s\tShould be able to create a session. Error: %s", tests.Failed, err)
+			}
+		}
+
+		if _, err := r.QueryByID(ctx, active.ID); err != nil {
+			t.Fatalf("\t%s\tShould be able to get an active session. Error: %s", tests.Failed, err)
+		}
+		if _, err := r.QueryByID(ctx, expired.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found error for an expired session, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould get an active session only.", tests.Success)
+
+		sessions, err := r.QueryByUserID(ctx, userID)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to get sessions of a user. Error: %s", tests.Failed, err)
+		}
+		if len(sessions) != 1 || sessions[0].ID != active.ID {
+			t.Fatalf("\t%s\tWant only session %s to be listed, got: %+v", tests.Failed, active.ID, sessions)
+		}
+		t.Logf("\t%s\tShould list active sessions only.", tests.Success)
+	})
+
+	t.Run("Given the need to extend a session", func(t *testing.T) {
+		r := newRepo(t)
+		s := newSession(uuid.NewString(), now.Add(time.Minute))
+		if err := r.Create(ctx, s); err != nil {
+			t.Fatalf("\t%s\tShould be able to create a session. Error: %s", tests.Failed, err)
+		}
+
+		lastUsed, expiresAt := now.Add(time.Second), now.Add(time.Hour)
+		if err := r.Touch(ctx, s.ID, lastUsed, expiresAt); err != nil {
+			t.Fatalf("\t%s\tShould be able to touch a session. Error: %s", tests.Failed, err)
+		}
+
+		got, err := r.QueryByID(ctx, s.ID)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to get a session. Error: %s", tests.Failed, err)
+		}
+		if !got.LastUsed.Equal(lastUsed) || !got.ExpiresAt.Equal(expiresAt) {
+			t.Fatalf("\t%s\tWant last used: %v, expires at: %v, got: %v, %v", tests.Failed, lastUsed, expiresAt, got.LastUsed, got.ExpiresAt)
+		}
+		t.Logf("\t%s\tShould extend a session.", tests.Success)
+
+		expired := newSession(s.UserID, now.Add(-time.Minute))
+		if err := r.Create(ctx, expired); err != nil {
+			t.Fatalf("\t%s\tShould be able to create a session. Error: %s", tests.Failed, err)
+		}
+		if err := r.Touch(ctx, expired.ID, now, expiresAt); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found error on touch of an expired session, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould not bring an expired session back.", tests.Success)
+	})
+
+	t.Run("Given the need to end sessions", func(t *testing.T) {
+		r := newRepo(t)
+		userID := uuid.NewString()
+		first, second := newSession(userID, now.Add(time.Hour)), newSession(userID, now.Add(time.Hour))
+		other := newSession(uuid.NewString(), now.Add(time.Hour))
+
+		for _, s := range []entity.Session{first, second, other} {
+			if err := r.Create(ctx, s); err != nil {
+				t.Fatalf("\t%s\tShould be able to create a session. Error: %s", tests.Failed, err)
+			}
+		}
+
+		if err := r.Delete(ctx, first.ID); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete a session. Error: %s", tests.Failed, err)
+		}
+		if _, err := r.QueryByID(ctx, first.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found error for a deleted session, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould end a session.", tests.Success)
+
+		if err := r.DeleteByUserID(ctx, userID); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete sessions of a user. Error: %s", tests.Failed, err)
+		}
+		if sessions, err := r.QueryByUserID(ctx, userID); err != nil || len(sessions) != 0 {
+			t.Fatalf("\t%s\tWant no sessions of a user, got: %d, error: %v", tests.Failed, len(sessions), err)
+		}
+		if _, err := r.QueryByID(ctx, other.ID); err != nil {
+			t.Fatalf("\t%s\tShould keep sessions of other users. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould end all sessions of a user only.", tests.Success)
+	})
+}
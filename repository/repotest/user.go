@@ -0,0 +1,317 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User checks that repositories created by newRepos behave as user.Repository should.
+func User(t *testing.T, newRepos Factory) {
+	ctx := context.Background()
+
+	t.Run("Given the need to create and get a user", func(t *testing.T) {
+		r := newRepos(t).User
+
+		name := unique("user")
+		nu := entity.NewUser{
+			UserName:        name,
+			FirstName:       "Alan",
+			LastName:        "Kay",
+			Email:           name + "@example.com",
+			Password:        "OOP_is_about_messages",
+			PasswordConfirm: "OOP_is_about_messages",
+			Roles:           []string{entity.AdminRole},
+		}
+		created, err := r.Create(ctx, nu)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to create a user. Error: %s", tests.Failed, err)
+		}
+		if created.ID == "" || created.Version != 1 || created.UserName != nu.UserName || created.Email != nu.Email {
+			t.Fatalf("\t%s\tWant a user with id, version 1 and given fields, got: %+v", tests.Failed, created)
+		}
+		if err := bcrypt.CompareHashAndPassword(created.Password, []byte(nu.Password)); err != nil {
+			t.Fatalf("\t%s\tWant a password to be saved as a hash of it.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould be able to create a user.", tests.Success)
+
+		for _, get := range []struct {
+			by    string
+			query func() (entity.User, error)
+		}{
+			{by: "id", query: func() (entity.User, error) { return r.QueryByID(ctx, created.ID) }},
+			{by: "user name", query: func() (entity.User, error) { return r.QueryByUserName(ctx, created.UserName) }},
+			{by: "email", query: func() (entity.User, error) { return r.QueryByEmail(ctx, created.Email) }},
+		} {
+			u, err := get.query()
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to get a user by %s. Error: %s", tests.Failed, get.by, err)
+			}
+			if u.ID != created.ID || u.FirstName != nu.FirstName || u.LastName != nu.LastName || len(u.Roles) != 1 || u.Roles[0] != entity.AdminRole {
+				t.Fatalf("\t%s\tWant the created user by %s, got: %+v", tests.Failed, get.by, u)
+			}
+			t.Logf("\t%s\tShould be able to get a user by %s.", tests.Success, get.by)
+		}
+
+		dup := nu
+		dup.Email = unique("user") + "@example.com"
+		if _, err := r.Create(ctx, dup); errors.Cause(err) != database.ErrDuplicate {
+			t.Fatalf("\t%s\tWant duplicate error on attempt to create a user with taken user name, got: %v", tests.Failed, err)
+		}
+		dup = nu
+		dup.UserName = unique("user")
+		if _, err := r.Create(ctx, dup); errors.Cause(err) != database.ErrDuplicate {
+			t.Fatalf("\t%s\tWant duplicate error on attempt to create a user with taken email, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould not be able to create a user with taken user name or email.", tests.Success)
+	})
+
+	t.Run("Given the need to get a user that does not exist", func(t *testing.T) {
+		r := newRepos(t).User
+
+		if _, err := r.QueryByID(ctx, uuid.NewString()); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found by id, got: %v", tests.Failed, err)
+		}
+		if _, err := r.QueryByUserName(ctx, unique("user")); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found by user name, got: %v", tests.Failed, err)
+		}
+		if _, err := r.QueryByEmail(ctx, unique("user")+"@example.com"); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found by email, got: %v", tests.Failed, err)
+		}
+		if err := r.Update(ctx, uuid.NewString(), 0, entity.UpdateUser{FirstName: tests.StrPtr("Alan")}); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on update, got: %v", tests.Failed, err)
+		}
+		if err := r.Delete(ctx, uuid.NewString(), 0); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on delete, got: %v", tests.Failed, err)
+		}
+		if err := r.Restore(ctx, uuid.NewString()); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on restore, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould get not found errors.", tests.Success)
+	})
+
+	t.Run("Given the need to page through users", func(t *testing.T) {
+		r := newRepos(t).User
+
+		prefix := unique("page")
+		var want []string
+		for _, suffix := range []string{"c", "a", "e", "b", "d"} {
+			u, err := r.Create(ctx, entity.NewUser{
+				UserName:        prefix + suffix,
+				Email:           prefix + suffix + "@example.com",
+				Password:        "password",
+				PasswordConfirm: "password",
+				Roles:           []string{entity.UserRole},
+			})
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to create a user. Error: %s", tests.Failed, err)
+			}
+			want = append(want, u.UserName)
+		}
+		sort.Strings(want)
+
+		list := func(ctx context.Context, q query.Query) ([]string, query.Page, error) {
+			users, page, err := r.Query(ctx, q)
+			var names []string
+			for _, u := range users {
+				names = append(names, u.UserName)
+			}
+			return names, page, err
+		}
+		checkPaging(t, list, query.Query{
+			Filters: []query.Filter{{Field: "user_name", Op: query.Like, Value: prefix}},
+			Sort:    []query.Sort{{Field: "user_name"}},
+		}, want)
+
+		for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+			want[i], want[j] = want[j], want[i]
+		}
+		checkPaging(t, list, query.Query{
+			Filters: []query.Filter{{Field: "user_name", Op: query.Like, Value: prefix}},
+			Sort:    []query.Sort{{Field: "user_name", Desc: true}},
+		}, want)
+
+		users, _, err := r.Query(ctx, query.Query{Filters: []query.Filter{{Field: "user_name", Op: query.Like, Value: strings.ToUpper(prefix + "c")}}})
+		if err != nil || len(users) != 1 {
+			t.Fatalf("\t%s\tWant a user filtered by user name regardless of case, got: %d users, error: %v", tests.Failed, len(users), err)
+		}
+		t.Logf("\t%s\tShould filter users by user name regardless of case.", tests.Success)
+	})
+
+	t.Run("Given the need to update some fields of a user", func(t *testing.T) {
+		r := newRepos(t).User
+		created := createUser(t, r)
+
+		if err := r.Update(ctx, created.ID, created.Version, entity.UpdateUser{FirstName: tests.StrPtr("Alan Curtis")}); err != nil {
+			t.Fatalf("\t%s\tShould be able to update a user. Error: %s", tests.Failed, err)
+		}
+		u, err := r.QueryByID(ctx, created.ID)
+		if err != nil {
+			t.Fatalf("\t%s\tShould be able to get a user. Error: %s", tests.Failed, err)
+		}
+		if u.FirstName != "Alan Curtis" || u.LastName != created.LastName || u.UserName != created.UserName || u.Email != created.Email {
+			t.Fatalf("\t%s\tWant only first name to be updated, got: %+v", tests.Failed, u)
+		}
+		if u.Version != created.Version+1 {
+			t.Fatalf("\t%s\tWant version: %d, got: %d", tests.Failed, created.Version+1, u.Version)
+		}
+		t.Logf("\t%s\tShould update only given fields and bump a version.", tests.Success)
+
+		if err := r.Update(ctx, created.ID, created.Version, entity.UpdateUser{LastName: tests.StrPtr("Smith")}); errors.Cause(err) != database.ErrVersionConflict {
+			t.Fatalf("\t%s\tWant version conflict on update of stale version, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould not update a user of stale version.", tests.Success)
+
+		if err := r.Update(ctx, created.ID, 0, entity.UpdateUser{Password: tests.StrPtr("new password")}); err != nil {
+			t.Fatalf("\t%s\tShould be able to update a user without version. Error: %s", tests.Failed, err)
+		}
+		u, _ = r.QueryByID(ctx, created.ID)
+		if err := bcrypt.CompareHashAndPassword(u.Password, []byte("new password")); err != nil {
+			t.Fatalf("\t%s\tWant a new password to be saved as a hash of it.", tests.Failed)
+		}
+		t.Logf("\t%s\tShould save a new password as a hash of it.", tests.Success)
+	})
+
+	t.Run("Given the need to delete, restore and purge a user", func(t *testing.T) {
+		repos := newRepos(t)
+		r := repos.User
+		created := createUser(t, r)
+
+		if err := r.Delete(ctx, created.ID, created.Version+1); errors.Cause(err) != database.ErrVersionConflict {
+			t.Fatalf("\t%s\tWant version conflict on delete of stale version, got: %v", tests.Failed, err)
+		}
+		if err := r.Delete(ctx, created.ID, created.Version); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete a user. Error: %s", tests.Failed, err)
+		}
+		if _, err := r.QueryByID(ctx, created.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found for a deleted user, got: %v", tests.Failed, err)
+		}
+		if err := r.Delete(ctx, created.ID, 0); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on delete of a deleted user, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould hide a deleted user.", tests.Success)
+
+		byID := query.Query{Filters: []query.Filter{{Field: "user_id", Op: query.Eq, Value: created.ID}}}
+		if users, _, err := r.Query(ctx, byID); err != nil || len(users) != 0 {
+			t.Fatalf("\t%s\tWant a deleted user not to be listed, got: %d users, error: %v", tests.Failed, len(users), err)
+		}
+		byID.IncludeDeleted = true
+		if users, _, err := r.Query(ctx, byID); err != nil || len(users) != 1 || users[0].DeletedAt == nil {
+			t.Fatalf("\t%s\tWant a deleted user to be listed on demand, got: %d users, error: %v", tests.Failed, len(users), err)
+		}
+		t.Logf("\t%s\tShould list a deleted user only on demand.", tests.Success)
+
+		if err := r.Restore(ctx, created.ID); err != nil {
+			t.Fatalf("\t%s\tShould be able to restore a user. Error: %s", tests.Failed, err)
+		}
+		if err := r.Restore(ctx, created.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found on restore of a user that is not deleted, got: %v", tests.Failed, err)
+		}
+		if _, err := r.QueryByID(ctx, created.ID); err != nil {
+			t.Fatalf("\t%s\tShould be able to get a restored user. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to restore a user.", tests.Success)
+
+		if err := r.DeleteByUserName(ctx, created.UserName); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete a user by user name. Error: %s", tests.Failed, err)
+		}
+		withOrders := createUser(t, r)
+		if _, err := repos.Order.Create(ctx, entity.NewOrder{UserID: withOrders.ID, Status: entity.OrderStatusPending}); err != nil {
+			t.Fatalf("\t%s\tShould be able to create an order. Error: %s", tests.Failed, err)
+		}
+		if err := r.Delete(ctx, withOrders.ID, 0); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete a user. Error: %s", tests.Failed, err)
+		}
+
+		live := createUser(t, r)
+
+		if _, err := r.Purge(ctx, time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("\t%s\tShould be able to purge users. Error: %s", tests.Failed, err)
+		}
+		if err := r.Restore(ctx, created.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant a purged user to be gone, got: %v", tests.Failed, err)
+		}
+		if err := r.Restore(ctx, withOrders.ID); err != nil {
+			t.Fatalf("\t%s\tWant a deleted user with orders to be kept on purge. Error: %s", tests.Failed, err)
+		}
+		if _, err := r.QueryByID(ctx, live.ID); err != nil {
+			t.Fatalf("\t%s\tWant a user that is not deleted to be kept on purge. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould purge deleted users without orders only.", tests.Success)
+	})
+
+	t.Run("Given the need to write a user concurrently", func(t *testing.T) {
+		r := newRepos(t).User
+		created := createUser(t, r)
+
+		const writers = 10
+		var wg sync.WaitGroup
+		errs := make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- r.Update(ctx, created.ID, created.Version, entity.UpdateUser{LastName: tests.StrPtr(unique("name"))})
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		var updated int
+		for err := range errs {
+			switch errors.Cause(err) {
+			case nil:
+				updated++
+			case database.ErrVersionConflict:
+			default:
+				t.Fatalf("\t%s\tWant version conflicts of concurrent updates, got: %v", tests.Failed, err)
+			}
+		}
+		if updated != 1 {
+			t.Fatalf("\t%s\tWant exactly one update of the same version to succeed, got: %d", tests.Failed, updated)
+		}
+		t.Logf("\t%s\tShould apply exactly one of concurrent updates of the same version.", tests.Success)
+
+		prefix := unique("concurrent")
+		errs = make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				name := prefix + string(rune('a'+i))
+				_, err := r.Create(ctx, entity.NewUser{
+					UserName:        name,
+					Email:           name + "@example.com",
+					Password:        "password",
+					PasswordConfirm: "password",
+					Roles:           []string{entity.UserRole},
+				})
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to create users concurrently. Error: %s", tests.Failed, err)
+			}
+		}
+		users, _, err := r.Query(ctx, query.Query{Filters: []query.Filter{{Field: "user_name", Op: query.Like, Value: prefix}}})
+		if err != nil || len(users) != writers {
+			t.Fatalf("\t%s\tWant %d users created concurrently, got: %d, error: %v", tests.Failed, writers, len(users), err)
+		}
+		t.Logf("\t%s\tShould keep all users created concurrently.", tests.Success)
+	})
+}
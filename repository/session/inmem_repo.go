@@ -0,0 +1,114 @@
+package session
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+)
+
+// InMemRepo is an abstraction layer that manages session entities inside basic in-memory store (map+RWMutex).
+// It suits a single instance of an application, sessions are lost on restart.
+// Expired sessions are kept until they are ended, but they are not found.
+type InMemRepo struct {
+	store map[string]entity.Session
+	sync.RWMutex
+}
+
+// NewInMemRepo creates a new in-memory repository for session entity.
+func NewInMemRepo() *InMemRepo {
+	return &InMemRepo{
+		store: make(map[string]entity.Session),
+	}
+}
+
+// Create saves a new session inside in-memory store.
+func (r *InMemRepo) Create(ctx context.Context, s entity.Session) error {
+	r.Lock()
+	defer r.Unlock()
+
+	s.Current = false
+	r.store[s.ID] = s
+
+	return nil
+}
+
+// QueryByID gets a session by given id from in-memory store.
+func (r *InMemRepo) QueryByID(ctx context.Context, id string) (entity.Session, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	s, ok := r.store[id]
+	if !ok || expired(s) {
+		return entity.Session{}, database.ErrNotFound
+	}
+
+	return s, nil
+}
+
+// QueryByUserID gets all sessions of particular user from in-memory store, most recently used first.
+func (r *InMemRepo) QueryByUserID(ctx context.Context, userID string) ([]entity.Session, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	sessions := []entity.Session{}
+	for _, s := range r.store {
+		if s.UserID == userID && !expired(s) {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsed.After(sessions[j].LastUsed)
+	})
+
+	return sessions, nil
+}
+
+// Touch updates time a session was last used at and extends it till a given time.
+func (r *InMemRepo) Touch(ctx context.Context, id string, lastUsed, expiresAt time.Time) error {
+	r.Lock()
+	defer r.Unlock()
+
+	s, ok := r.store[id]
+	if !ok || expired(s) {
+		return database.ErrNotFound
+	}
+
+	s.LastUsed = lastUsed
+	s.ExpiresAt = expiresAt
+	r.store[id] = s
+
+	return nil
+}
+
+// Delete deletes a session from in-memory store by given id.
+func (r *InMemRepo) Delete(ctx context.Context, id string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.store, id)
+
+	return nil
+}
+
+// DeleteByUserID deletes all sessions of particular user from in-memory store.
+func (r *InMemRepo) DeleteByUserID(ctx context.Context, userID string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	for id, s := range r.store {
+		if s.UserID == userID {
+			delete(r.store, id)
+		}
+	}
+
+	return nil
+}
+
+// expired reports whether a session is expired.
+func expired(s entity.Session) bool {
+	return !s.ExpiresAt.After(time.Now().UTC())
+}
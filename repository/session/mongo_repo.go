@@ -0,0 +1,130 @@
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// expiresAtIndex is a name of TTL index on expiration times of sessions.
+const expiresAtIndex = "expires_at_ttl"
+
+// Mongo is an abstraction layer that manages session entities inside MongoDB.
+// Expired sessions are removed by TTL index, see CreateIndexes,
+// and they are filtered out until then, since MongoDB removes them once a minute.
+type Mongo struct {
+	db *mongo.Collection
+	logger.Logger
+}
+
+// NewMongoRepo creates a new MongoDB repository for session entity
+func NewMongoRepo(db *mongo.Database, l logger.Logger) *Mongo {
+	coll := "sessions"
+
+	return &Mongo{
+		db.Collection(coll),
+		l,
+	}
+}
+
+// Create saves a new session inside mongoDB.
+func (r *Mongo) Create(ctx context.Context, s entity.Session) error {
+	if _, err := r.db.InsertOne(ctx, s); err != nil {
+		return errors.Wrap(err, "inserting session into mongoDB")
+	}
+
+	return nil
+}
+
+// QueryByID gets a session by given id from mongoDB.
+func (r *Mongo) QueryByID(ctx context.Context, id string) (entity.Session, error) {
+	var s entity.Session
+
+	if err := r.db.FindOne(ctx, bson.M{"_id": id, "expires_at": active()}).Decode(&s); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return entity.Session{}, database.ErrNotFound
+		}
+		return entity.Session{}, errors.Wrapf(err, "getting session %s", id)
+	}
+
+	return s, nil
+}
+
+// QueryByUserID gets all sessions of particular user from mongoDB, most recently used first.
+func (r *Mongo) QueryByUserID(ctx context.Context, userID string) ([]entity.Session, error) {
+	cur, err := r.db.Find(
+		ctx,
+		bson.M{"user_id": userID, "expires_at": active()},
+		options.Find().SetSort(bson.M{"last_used": -1}),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting sessions of user %s", userID)
+	}
+
+	sessions := []entity.Session{}
+	if err := cur.All(ctx, &sessions); err != nil {
+		return nil, errors.Wrapf(err, "decoding sessions of user %s", userID)
+	}
+
+	return sessions, nil
+}
+
+// Touch updates time a session was last used at and extends it till a given time.
+func (r *Mongo) Touch(ctx context.Context, id string, lastUsed, expiresAt time.Time) error {
+	res, err := r.db.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "expires_at": active()},
+		bson.M{"$set": bson.M{"last_used": lastUsed, "expires_at": expiresAt}},
+	)
+	if err != nil {
+		return errors.Wrapf(err, "updating session %s", id)
+	}
+	if res.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+
+	return nil
+}
+
+// Delete deletes a session from mongoDB by given id.
+func (r *Mongo) Delete(ctx context.Context, id string) error {
+	if _, err := r.db.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return errors.Wrapf(err, "deleting session %s", id)
+	}
+
+	return nil
+}
+
+// DeleteByUserID deletes all sessions of particular user from mongoDB.
+func (r *Mongo) DeleteByUserID(ctx context.Context, userID string) error {
+	if _, err := r.db.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+		return errors.Wrapf(err, "deleting sessions of user %s", userID)
+	}
+
+	return nil
+}
+
+// CreateIndexes creates TTL index that removes sessions once they expire.
+func (r *Mongo) CreateIndexes(ctx context.Context) error {
+	_, err := r.db.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetName(expiresAtIndex).SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return errors.Wrap(err, "creating sessions indexes")
+	}
+
+	return nil
+}
+
+// active is a filter of expiration times of sessions that are not expired yet.
+func active() bson.M {
+	return bson.M{"$gt": time.Now().UTC()}
+}
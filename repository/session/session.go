@@ -0,0 +1,23 @@
+// Package session is responsible for managing information about user sessions in database-agnostic way.
+// This package defines repository interface for abstracting interaction with particular database.
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+)
+
+// Repository is an interface that represents persistent storage abstraction.
+// This is a port in hexagonal architecture terms,
+// so concrete implementation of database should implements the set of these methods.
+// Expired sessions are treated as if they did not exist.
+type Repository interface {
+	Create(ctx context.Context, session entity.Session) error
+	QueryByID(ctx context.Context, id string) (entity.Session, error)
+	QueryByUserID(ctx context.Context, userID string) ([]entity.Session, error)
+	Touch(ctx context.Context, id string, lastUsed, expiresAt time.Time) error
+	Delete(ctx context.Context, id string) error
+	DeleteByUserID(ctx context.Context, userID string) error
+}
@@ -0,0 +1,66 @@
+package transaction
+
+import (
+	"context"
+	"sync"
+)
+
+// InMem is a transaction manager for in-memory repositories, it is meant for tests and local development.
+// Transactions run one at a time, so they do not see each other`s changes half-done.
+// In-memory repositories register how to undo their changes with OnRollback,
+// so changes made before fn fails are reverted.
+type InMem struct {
+	sync.Mutex
+}
+
+// NewInMemManager creates a new in-memory transaction manager.
+func NewInMemManager() *InMem {
+	return &InMem{}
+}
+
+// journal keeps functions that undo changes made within a running in-memory transaction.
+type journal struct {
+	undo []func()
+	sync.Mutex
+}
+
+// txKey is the context.Context key to store a journal of a running in-memory transaction.
+var txKey = &struct{ name string }{"inmem tx"}
+
+// Run executes fn once no other transaction is running.
+// Changes made by fn are undone in reverse order if fn returns an error.
+// If the given context already carries a transaction fn joins it.
+func (m *InMem) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey).(*journal); ok {
+		return fn(ctx)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	j := &journal{}
+	if err := fn(context.WithValue(ctx, txKey, j)); err != nil {
+		j.Lock()
+		defer j.Unlock()
+		for i := len(j.undo) - 1; i >= 0; i-- {
+			j.undo[i]()
+		}
+		return err
+	}
+
+	return nil
+}
+
+// OnRollback registers undo to be called if an in-memory transaction carried by ctx fails.
+// In-memory repositories call it on every change, undo must not expect any lock to be held.
+// Outside of a transaction changes can not be undone, so undo is dropped.
+func OnRollback(ctx context.Context, undo func()) {
+	j, ok := ctx.Value(txKey).(*journal)
+	if !ok {
+		return
+	}
+
+	j.Lock()
+	j.undo = append(j.undo, undo)
+	j.Unlock()
+}
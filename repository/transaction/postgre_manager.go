@@ -0,0 +1,52 @@
+package transaction
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+)
+
+// Postgre is an abstraction layer that manages transactions inside PostgreSQL DB.
+// It's also embed logger for convenience.
+type Postgre struct {
+	db *sqlx.DB
+	logger.Logger
+}
+
+// NewPostgreManager creates a new PostgreSQL transaction manager.
+func NewPostgreManager(db *sqlx.DB, l logger.Logger) *Postgre {
+	return &Postgre{
+		db,
+		l,
+	}
+}
+
+// Run executes fn inside of a PostgreSQL transaction.
+// Transaction is committed if fn returns no error and rolled back otherwise.
+// If the given context already carries a transaction fn joins it.
+func (m *Postgre) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := database.TxFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	if err := fn(database.WithTx(ctx, tx)); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil && m.Logger != nil {
+			logger.FromContextOr(ctx, m.Logger).Error("rolling back a transaction", logger.Err(rbErr))
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	return nil
+}
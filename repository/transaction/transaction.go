@@ -0,0 +1,18 @@
+// Package transaction is responsible for running a set of repository operations as a single unit of work
+// in database-agnostic way.
+// This package defines transaction manager interface for abstracting interaction with particular database.
+package transaction
+
+import (
+	"context"
+)
+
+// Manager is an interface that represents unit of work abstraction.
+// This is a port in hexagonal architecture terms,
+// so concrete implementation of database should implements the set of these methods.
+//
+// Run executes fn inside of a single transaction. Repositories called with the context passed to fn
+// take part in that transaction, so either all of their changes are committed or none of them.
+type Manager interface {
+	Run(ctx context.Context, fn func(ctx context.Context) error) error
+}
@@ -0,0 +1,135 @@
+package twofactor
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+)
+
+// InMemRepo is an abstraction layer that manages second factor entities inside basic in-memory store (map+RWMutex).
+// It suits a single instance of an application, second factors are lost on restart.
+type InMemRepo struct {
+	store map[string]entity.TwoFactor
+	sync.RWMutex
+}
+
+// NewInMemRepo creates a new in-memory repository for second factor entity.
+func NewInMemRepo() *InMemRepo {
+	return &InMemRepo{
+		store: make(map[string]entity.TwoFactor),
+	}
+}
+
+// Save saves a second factor of a user inside in-memory store, replacing existing one.
+func (r *InMemRepo) Save(ctx context.Context, tf entity.TwoFactor) error {
+	r.Lock()
+	defer r.Unlock()
+
+	tf.RecoveryCodes = append([]string(nil), tf.RecoveryCodes...)
+	r.store[tf.UserID] = tf
+
+	return nil
+}
+
+// QueryByUserID gets a second factor of particular user from in-memory store.
+func (r *InMemRepo) QueryByUserID(ctx context.Context, userID string) (entity.TwoFactor, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	tf, ok := r.store[userID]
+	if !ok {
+		return entity.TwoFactor{}, database.ErrNotFound
+	}
+	tf.RecoveryCodes = append([]string(nil), tf.RecoveryCodes...)
+
+	return tf, nil
+}
+
+// Enable enables a second factor of particular user and sets hashes of his recovery codes.
+func (r *InMemRepo) Enable(ctx context.Context, userID string, recoveryCodes []string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	tf, ok := r.store[userID]
+	if !ok {
+		return database.ErrNotFound
+	}
+
+	tf.Enabled = true
+	tf.RecoveryCodes = append([]string(nil), recoveryCodes...)
+	r.store[userID] = tf
+
+	return nil
+}
+
+// SetRecoveryCodes replaces hashes of recovery codes of particular user.
+func (r *InMemRepo) SetRecoveryCodes(ctx context.Context, userID string, recoveryCodes []string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	tf, ok := r.store[userID]
+	if !ok {
+		return database.ErrNotFound
+	}
+
+	tf.RecoveryCodes = append([]string(nil), recoveryCodes...)
+	r.store[userID] = tf
+
+	return nil
+}
+
+// UseStep remembers a TOTP period of an accepted code.
+// It reports false if a code of that or a later period was already accepted.
+func (r *InMemRepo) UseStep(ctx context.Context, userID string, step int64) (bool, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	tf, ok := r.store[userID]
+	if !ok || tf.LastUsedStep >= step {
+		return false, nil
+	}
+
+	tf.LastUsedStep = step
+	r.store[userID] = tf
+
+	return true, nil
+}
+
+// UseRecoveryCode removes a hash of a recovery code of particular user.
+// It reports false if a user has no such recovery code.
+func (r *InMemRepo) UseRecoveryCode(ctx context.Context, userID, recoveryCode string) (bool, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	tf, ok := r.store[userID]
+	if !ok {
+		return false, nil
+	}
+
+	codes := make([]string, 0, len(tf.RecoveryCodes))
+	for _, c := range tf.RecoveryCodes {
+		if c != recoveryCode {
+			codes = append(codes, c)
+		}
+	}
+	if len(codes) == len(tf.RecoveryCodes) {
+		return false, nil
+	}
+
+	tf.RecoveryCodes = codes
+	r.store[userID] = tf
+
+	return true, nil
+}
+
+// Delete deletes a second factor of particular user from in-memory store.
+func (r *InMemRepo) Delete(ctx context.Context, userID string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.store, userID)
+
+	return nil
+}
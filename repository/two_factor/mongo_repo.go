@@ -0,0 +1,131 @@
+package twofactor
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Mongo is an abstraction layer that manages second factor entities inside MongoDB.
+type Mongo struct {
+	db *mongo.Collection
+	logger.Logger
+}
+
+// NewMongoRepo creates a new MongoDB repository for second factor entity
+func NewMongoRepo(db *mongo.Database, l logger.Logger) *Mongo {
+	coll := "two_factor"
+
+	return &Mongo{
+		db.Collection(coll),
+		l,
+	}
+}
+
+// Save saves a second factor of a user inside mongoDB, replacing existing one.
+func (r *Mongo) Save(ctx context.Context, tf entity.TwoFactor) error {
+	_, err := r.db.ReplaceOne(
+		ctx,
+		bson.M{"_id": tf.UserID},
+		tf,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "saving second factor of user %s", tf.UserID)
+	}
+
+	return nil
+}
+
+// QueryByUserID gets a second factor of particular user from mongoDB.
+func (r *Mongo) QueryByUserID(ctx context.Context, userID string) (entity.TwoFactor, error) {
+	var tf entity.TwoFactor
+
+	if err := r.db.FindOne(ctx, bson.M{"_id": userID}).Decode(&tf); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return entity.TwoFactor{}, database.ErrNotFound
+		}
+		return entity.TwoFactor{}, errors.Wrapf(err, "getting second factor of user %s", userID)
+	}
+
+	return tf, nil
+}
+
+// Enable enables a second factor of particular user and sets hashes of his recovery codes.
+func (r *Mongo) Enable(ctx context.Context, userID string, recoveryCodes []string) error {
+	res, err := r.db.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"enabled": true, "recovery_codes": recoveryCodes}},
+	)
+	if err != nil {
+		return errors.Wrapf(err, "enabling second factor of user %s", userID)
+	}
+	if res.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+
+	return nil
+}
+
+// SetRecoveryCodes replaces hashes of recovery codes of particular user.
+func (r *Mongo) SetRecoveryCodes(ctx context.Context, userID string, recoveryCodes []string) error {
+	res, err := r.db.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"recovery_codes": recoveryCodes}},
+	)
+	if err != nil {
+		return errors.Wrapf(err, "setting recovery codes of user %s", userID)
+	}
+	if res.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+
+	return nil
+}
+
+// UseStep remembers a TOTP period of an accepted code.
+// It reports false if a code of that or a later period was already accepted.
+func (r *Mongo) UseStep(ctx context.Context, userID string, step int64) (bool, error) {
+	res, err := r.db.UpdateOne(
+		ctx,
+		bson.M{"_id": userID, "last_used_step": bson.M{"$lt": step}},
+		bson.M{"$set": bson.M{"last_used_step": step}},
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "using TOTP code of user %s", userID)
+	}
+
+	return res.MatchedCount == 1, nil
+}
+
+// UseRecoveryCode removes a hash of a recovery code of particular user.
+// It reports false if a user has no such recovery code.
+func (r *Mongo) UseRecoveryCode(ctx context.Context, userID, recoveryCode string) (bool, error) {
+	res, err := r.db.UpdateOne(
+		ctx,
+		bson.M{"_id": userID, "recovery_codes": recoveryCode},
+		bson.M{"$pull": bson.M{"recovery_codes": recoveryCode}},
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "using recovery code of user %s", userID)
+	}
+
+	return res.MatchedCount == 1, nil
+}
+
+// Delete deletes a second factor of particular user from mongoDB.
+func (r *Mongo) Delete(ctx context.Context, userID string) error {
+	if _, err := r.db.DeleteOne(ctx, bson.M{"_id": userID}); err != nil {
+		return errors.Wrapf(err, "deleting second factor of user %s", userID)
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+// Package twofactor is responsible for managing information about second authentication factors of users
+// in database-agnostic way.
+// This package defines repository interface for abstracting interaction with particular database.
+package twofactor
+
+import (
+	"context"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+)
+
+// Repository is an interface that represents persistent storage abstraction.
+// This is a port in hexagonal architecture terms,
+// so concrete implementation of database should implements the set of these methods.
+type Repository interface {
+	Save(ctx context.Context, tf entity.TwoFactor) error
+	QueryByUserID(ctx context.Context, userID string) (entity.TwoFactor, error)
+	Enable(ctx context.Context, userID string, recoveryCodes []string) error
+	SetRecoveryCodes(ctx context.Context, userID string, recoveryCodes []string) error
+	UseStep(ctx context.Context, userID string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID, recoveryCode string) (bool, error)
+	Delete(ctx context.Context, userID string) error
+}
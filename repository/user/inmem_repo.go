@@ -1,66 +1,316 @@
 package user
 
 import (
-	"fmt"
+	"context"
 	"sync"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
+	"golang.org/x/crypto/bcrypt"
 )
 
-// InMemRepo is an abstraction layer that manages user entities inside basic in-memory store (map+RWMutex)
+// Orders is a part of order repository which InMemRepo uses to keep referential integrity.
+type Orders interface {
+	Query(ctx context.Context, q query.Query) ([]entity.Order, query.Page, error)
+}
+
+// InMemRepo is an abstraction layer that manages user entities inside basic in-memory store (map+RWMutex).
+// It behaves as PostgreSQL repository does, but suits a single instance of an application, users are lost on restart.
 type InMemRepo struct {
-	store map[string]entity.User
+	store  map[string]entity.User
+	orders Orders
 	sync.RWMutex
 }
 
-//NewInMemRepo creates a new in-memory repository for User entity
-func NewInMemRepo() *InMemRepo {
-	m := make(map[string]entity.User)
+// NewInMemRepo creates a new in-memory repository for User entity.
+// Deleted users that still have orders in the given repository are not purged, it can be nil if there are no orders.
+func NewInMemRepo(orders Orders) *InMemRepo {
 	return &InMemRepo{
-		store: m,
+		store:  make(map[string]entity.User),
+		orders: orders,
 	}
 }
 
-//Get gets user from in-memory store
-func (r *InMemRepo) Get(id string) (*entity.User, error) {
-	u, err := r.store[id]
-	if !err {
-		return nil, fmt.Errorf("there are no user with id: %s", id)
+// Create creates a new user in in-memory store.
+// User names and emails are unique among all users, deleted ones included.
+func (r *InMemRepo) Create(ctx context.Context, nu entity.NewUser) (entity.User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(nu.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return entity.User{}, errors.Wrap(err, "generating password hash")
+	}
+
+	u := entity.User{
+		ID:            uuid.NewString(),
+		UserName:      nu.UserName,
+		FirstName:     nu.FirstName,
+		LastName:      nu.LastName,
+		Email:         nu.Email,
+		EmailVerified: nu.EmailVerified,
+		Password:      hash,
+		Roles:         nu.Roles,
+		Version:       1,
+		DateCreated:   time.Now().UTC(),
+		DateUpdated:   time.Now().UTC(),
 	}
-	return &u, nil
-}
 
-//Create creates a new user in in-memory store
-func (r *InMemRepo) Create(u *entity.User) (*entity.User, error) {
 	r.Lock()
 	defer r.Unlock()
 
-	r.store[u.ID] = *u
+	if err := r.checkUnique(u); err != nil {
+		return entity.User{}, errors.Wrap(err, "inserting a user")
+	}
+	r.put(ctx, u.ID, u)
+
 	return u, nil
 }
 
-//Delete deletes user from in-memory store
-func (r *InMemRepo) Delete(id string) error {
+// checkUnique checks that no other user has the same user name or email.
+func (r *InMemRepo) checkUnique(u entity.User) error {
+	for _, existing := range r.store {
+		if existing.ID == u.ID {
+			continue
+		}
+		if existing.UserName == u.UserName {
+			return errors.Wrapf(database.ErrDuplicate, "user_name %s", u.UserName)
+		}
+		if existing.Email == u.Email {
+			return errors.Wrapf(database.ErrDuplicate, "email %s", u.Email)
+		}
+	}
+	return nil
+}
+
+// Query gets a page of users from in-memory store defined by list query.
+// By default results are sorted by creation date, newest first.
+func (r *InMemRepo) Query(ctx context.Context, q query.Query) ([]entity.User, query.Page, error) {
+	r.RLock()
+	all := make([]entity.User, 0, len(r.store))
+	for _, u := range r.store {
+		all = append(all, u)
+	}
+	r.RUnlock()
+
+	users := []entity.User{}
+
+	page, err := database.SlicePage(all, userFields, "user_id", q, &users)
+	if err != nil {
+		return nil, query.Page{}, errors.Wrap(err, "selecting users")
+	}
+
+	return users, page, nil
+}
+
+// QueryByID gets a user from in-memory store by given user id.
+func (r *InMemRepo) QueryByID(ctx context.Context, userID string) (entity.User, error) {
+	return r.queryBy(func(u entity.User) bool { return u.ID == userID }, "getting a user with id %s", userID)
+}
+
+// QueryByUserName gets a user from in-memory store by given user name.
+func (r *InMemRepo) QueryByUserName(ctx context.Context, userName string) (entity.User, error) {
+	return r.queryBy(func(u entity.User) bool { return u.UserName == userName }, "getting a user with user_name %s", userName)
+}
+
+// QueryByEmail gets a user from in-memory store by given email.
+func (r *InMemRepo) QueryByEmail(ctx context.Context, email string) (entity.User, error) {
+	return r.queryBy(func(u entity.User) bool { return u.Email == email }, "getting a user with email %s", email)
+}
+
+// queryBy gets the first not deleted user that matches a condition.
+func (r *InMemRepo) queryBy(match func(u entity.User) bool, format string, arg string) (entity.User, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, u := range r.store {
+		if u.DeletedAt == nil && match(u) {
+			return u, nil
+		}
+	}
+
+	return entity.User{}, errors.Wrapf(database.ErrNotFound, format, arg)
+}
+
+// Update updates a user inside in-memory store.
+// Change of an email resets it`s verification.
+// Non zero version is a version of a user an update is based on,
+// if a user has a different one database.ErrVersionConflict is returned.
+func (r *InMemRepo) Update(ctx context.Context, id string, version int, uu entity.UpdateUser) error {
+	var hash []byte
+	if uu.Password != nil {
+		var err error
+		hash, err = bcrypt.GenerateFromPassword([]byte(*uu.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return errors.Wrap(err, "generating password hash")
+		}
+	}
+
 	r.Lock()
 	defer r.Unlock()
 
-	_, err := r.store[id]
-	if !err {
-		return fmt.Errorf("user with id: %v was not found", id)
+	u, ok := r.store[id]
+	if !ok || u.DeletedAt != nil {
+		return errors.Wrapf(database.ErrNotFound, "error updating a user with id %s", id)
 	}
-	delete(r.store, id)
+	if version != 0 && u.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "updating a user with id %s", id)
+	}
+
+	if uu.UserName != nil {
+		u.UserName = *uu.UserName
+	}
+	if uu.FirstName != nil {
+		u.FirstName = *uu.FirstName
+	}
+	if uu.LastName != nil {
+		u.LastName = *uu.LastName
+	}
+	if uu.Email != nil && *uu.Email != u.Email {
+		u.Email = *uu.Email
+		u.EmailVerified = false
+	}
+	if uu.EmailVerified != nil {
+		u.EmailVerified = *uu.EmailVerified
+	}
+	if hash != nil {
+		u.Password = hash
+	}
+	if uu.Roles != nil {
+		u.Roles = uu.Roles
+	}
+	u.Version++
+	u.DateUpdated = time.Now().UTC()
+
+	if err := r.checkUnique(u); err != nil {
+		return errors.Wrapf(err, "error updating a user with id %s", id)
+	}
+	r.put(ctx, id, u)
+
 	return nil
 }
 
-//List lists all users from in-memory store
-func (r *InMemRepo) List() ([]entity.User, error) {
-	if len(r.store) == 0 {
-		return nil, fmt.Errorf("there are no users")
+// Delete marks user in in-memory store as deleted by given user id,
+// it is kept until Purge removes it, so it can be restored meanwhile.
+// Non zero version is a version of a user a client knows about,
+// if a user has a different one database.ErrVersionConflict is returned.
+func (r *InMemRepo) Delete(ctx context.Context, userID string, version int) error {
+	r.Lock()
+	defer r.Unlock()
+
+	u, ok := r.store[userID]
+	if !ok || u.DeletedAt != nil {
+		return errors.Wrapf(database.ErrNotFound, "deleting a user with id %s", userID)
+	}
+	if version != 0 && u.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "deleting a user with id %s", userID)
 	}
 
-	users := make([]entity.User, 0)
-	for _, user := range r.store {
-		users = append(users, user)
+	now := time.Now().UTC()
+	u.DeletedAt = &now
+	u.Version++
+	r.put(ctx, userID, u)
+
+	return nil
+}
+
+// DeleteByUserName marks user in in-memory store as deleted by given user name.
+func (r *InMemRepo) DeleteByUserName(ctx context.Context, userName string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now().UTC()
+	for id, u := range r.store {
+		if u.UserName == userName && u.DeletedAt == nil {
+			u.DeletedAt = &now
+			u.Version++
+			r.put(ctx, id, u)
+		}
+	}
+
+	return nil
+}
+
+// Restore restores a deleted user inside in-memory store by given user id.
+func (r *InMemRepo) Restore(ctx context.Context, userID string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	u, ok := r.store[userID]
+	if !ok || u.DeletedAt == nil {
+		return errors.Wrapf(database.ErrNotFound, "deleted user %s", userID)
 	}
-	return users, nil
+
+	u.DeletedAt = nil
+	u.Version++
+	u.DateUpdated = time.Now().UTC()
+	r.put(ctx, userID, u)
+
+	return nil
+}
+
+// Purge permanently removes users from in-memory store that were deleted before given time.
+// Users that still have orders are kept, as PostgreSQL repository does.
+func (r *InMemRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	var n int64
+	for id, u := range r.store {
+		if u.DeletedAt == nil || !u.DeletedAt.Before(before) {
+			continue
+		}
+
+		if r.orders != nil {
+			orders, _, err := r.orders.Query(ctx, query.Query{
+				Filters:        []query.Filter{{Field: "user_id", Op: query.Eq, Value: id}},
+				Limit:          1,
+				IncludeDeleted: true,
+			})
+			if err != nil {
+				return n, errors.Wrap(err, "purging deleted users")
+			}
+			if len(orders) > 0 {
+				continue
+			}
+		}
+
+		r.remove(ctx, id)
+		n++
+	}
+
+	return n, nil
+}
+
+// put stores a user by id within in-memory store,
+// if a transaction carried by ctx fails a previous state of it is restored.
+// It must be called with the lock held.
+func (r *InMemRepo) put(ctx context.Context, id string, v entity.User) {
+	r.journal(ctx, id)
+	r.store[id] = v
+}
+
+// remove removes a user by id from in-memory store,
+// if a transaction carried by ctx fails it is restored.
+// It must be called with the lock held.
+func (r *InMemRepo) remove(ctx context.Context, id string) {
+	r.journal(ctx, id)
+	delete(r.store, id)
+}
+
+// journal registers restoration of current state of a user by id if a transaction carried by ctx fails.
+func (r *InMemRepo) journal(ctx context.Context, id string) {
+	prev, existed := r.store[id]
+	transaction.OnRollback(ctx, func() {
+		r.Lock()
+		defer r.Unlock()
+
+		if existed {
+			r.store[id] = prev
+			return
+		}
+		delete(r.store, id)
+	})
 }
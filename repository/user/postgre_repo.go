@@ -10,6 +10,7 @@ import (
 	"github.com/rtbe/clean-rest-api/domain/entity"
 	"github.com/rtbe/clean-rest-api/internal/database"
 	"github.com/rtbe/clean-rest-api/internal/logger"
+	"github.com/rtbe/clean-rest-api/internal/query"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -31,9 +32,9 @@ func NewPostgreRepo(db *sqlx.DB, l logger.Logger) *Postgre {
 func (r *Postgre) Create(ctx context.Context, nu entity.NewUser) (entity.User, error) {
 	const q = `
 	INSERT INTO users 
-		(user_id, user_name, first_name, last_name, password, email, roles, date_created, date_updated) 
+		(user_id, user_name, first_name, last_name, password, email, email_verified, roles, version, date_created, date_updated) 
 	VALUES
-		(:user_id, :user_name, :first_name, :last_name, :password, :email, :roles, :date_created, :date_updated) `
+		(:user_id, :user_name, :first_name, :last_name, :password, :email, :email_verified, :roles, :version, :date_created, :date_updated) `
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(nu.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -41,89 +42,140 @@ func (r *Postgre) Create(ctx context.Context, nu entity.NewUser) (entity.User, e
 	}
 
 	u := entity.User{
-		ID:          uuid.NewString(),
-		UserName:    nu.UserName,
-		FirstName:   nu.FirstName,
-		LastName:    nu.LastName,
-		Email:       nu.Email,
-		Password:    hash,
-		Roles:       nu.Roles,
-		DateCreated: time.Now().UTC(),
-		DateUpdated: time.Now().UTC(),
+		ID:            uuid.NewString(),
+		UserName:      nu.UserName,
+		FirstName:     nu.FirstName,
+		LastName:      nu.LastName,
+		Email:         nu.Email,
+		EmailVerified: nu.EmailVerified,
+		Password:      hash,
+		Roles:         nu.Roles,
+		Version:       1,
+		DateCreated:   time.Now().UTC(),
+		DateUpdated:   time.Now().UTC(),
 	}
 
-	if _, err := r.db.NamedExecContext(ctx, q, u); err != nil {
+	if _, err := database.NamedExec(ctx, r.db, q, u); err != nil {
 		return entity.User{}, errors.Wrapf(err, "inserting a user")
 	}
 
 	return u, nil
 }
 
-// Query gets users from PostgreSQL.
-// This query uses two provided values to implement pagination: last seen id and limit.
-// Results of a query sorted by creation date of selected users.
-func (r *Postgre) Query(ctx context.Context, lastSeenID, limit string) ([]entity.User, error) {
-	query := `
+// userFields is a whitelist of users fields that can be used in list queries.
+var userFields = query.Fields{
+	"user_id":      {Column: "user_id", Type: query.UUID},
+	"user_name":    {Column: "user_name", Type: query.String},
+	"first_name":   {Column: "first_name", Type: query.String},
+	"last_name":    {Column: "last_name", Type: query.String},
+	"email":        {Column: "email", Type: query.String},
+	"date_created": {Column: "date_created", Type: query.Time},
+	"date_updated": {Column: "date_updated", Type: query.Time},
+}
+
+// Query gets a page of users from PostgreSQL DB defined by list query.
+// By default results are sorted by creation date, newest first.
+func (r *Postgre) Query(ctx context.Context, q query.Query) ([]entity.User, query.Page, error) {
+	users := []entity.User{}
+
+	page, err := database.QueryPage(ctx, r.db, "users", userFields, "user_id", q, &users)
+	if err != nil {
+		return nil, query.Page{}, errors.Wrap(err, "selecting users")
+	}
+
+	return users, page, nil
+}
+
+// QueryByID gets a user from PostgreSQL by given user id.
+func (r *Postgre) QueryByID(ctx context.Context, userID string) (entity.User, error) {
+	const q = `
 	SELECT 
 		* 
 	FROM 
 		users 
 	WHERE 
-		user_id <= :last_seen_id 
-	ORDER BY 
-		user_id DESC
-	FETCH FIRST :limit ROWS ONLY`
+		user_id = :user_id AND deleted_at IS NULL`
 
-	var users []entity.User
+	data := struct {
+		ID string `db:"user_id"`
+	}{
+		ID: userID,
+	}
+
+	var user entity.User
+
+	err := database.QueryStruct(ctx, r.db, q, data, &user)
+	if err != nil {
+		return entity.User{}, errors.Wrapf(err, "getting a user with id %s", userID)
+	}
+
+	return user, nil
+}
+
+// QueryByUserName gets a user from PostgreSQL by given user name.
+func (r *Postgre) QueryByUserName(ctx context.Context, userName string) (entity.User, error) {
+	const q = `
+	SELECT 
+		* 
+	FROM 
+		users 
+	WHERE 
+		user_name = :user_name AND deleted_at IS NULL`
 
 	data := struct {
-		LastSeenID string `db:"last_seen_id"`
-		Limit      string `db:"limit"`
+		UserName string `db:"user_name"`
 	}{
-		LastSeenID: lastSeenID,
-		Limit:      limit,
+		UserName: userName,
 	}
 
-	err := database.QuerySlice(ctx, r.db, query, data, &users)
+	var user entity.User
+
+	err := database.QueryStruct(ctx, r.db, q, data, &user)
 	if err != nil {
-		return nil, errors.Wrap(err, "selecting users")
+		return entity.User{}, errors.Wrapf(err, "getting a user with user_name %s", userName)
 	}
 
-	return users, nil
+	return user, nil
 }
 
-// QueryByID gets a user from PostgreSQL by given user id.
-func (r *Postgre) QueryByID(ctx context.Context, userID string) (entity.User, error) {
+// QueryByEmail gets a user from PostgreSQL by given email.
+func (r *Postgre) QueryByEmail(ctx context.Context, email string) (entity.User, error) {
 	const q = `
 	SELECT 
 		* 
 	FROM 
 		users 
 	WHERE 
-		user_id = :user_id`
+		email = :email AND deleted_at IS NULL`
 
 	data := struct {
-		ID string `db:"user_id"`
+		Email string `db:"email"`
 	}{
-		ID: userID,
+		Email: email,
 	}
 
 	var user entity.User
 
 	err := database.QueryStruct(ctx, r.db, q, data, &user)
 	if err != nil {
-		return entity.User{}, errors.Wrapf(err, "getting a user with id %s", userID)
+		return entity.User{}, errors.Wrapf(err, "getting a user with email %s", email)
 	}
 
 	return user, nil
 }
 
 // Update updates a user inside PostgreSQL.
-func (r *Postgre) Update(ctx context.Context, id string, uu entity.UpdateUser) error {
+// Change of an email resets it`s verification.
+// Non zero version is a version of a user an update is based on,
+// if a user has a different one database.ErrVersionConflict is returned.
+func (r *Postgre) Update(ctx context.Context, id string, version int, uu entity.UpdateUser) error {
 	u, err := r.QueryByID(ctx, id)
 	if err != nil {
 		return errors.Wrapf(err, "error updating a user with id %s", id)
 	}
+	if version != 0 && u.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "updating a user with id %s", id)
+	}
 
 	// You should not update not updated user fields.
 	if uu.UserName != nil {
@@ -135,8 +187,12 @@ func (r *Postgre) Update(ctx context.Context, id string, uu entity.UpdateUser) e
 	if uu.LastName != nil {
 		u.LastName = *uu.LastName
 	}
-	if uu.Email != nil {
+	if uu.Email != nil && *uu.Email != u.Email {
 		u.Email = *uu.Email
+		u.EmailVerified = false
+	}
+	if uu.EmailVerified != nil {
+		u.EmailVerified = *uu.EmailVerified
 	}
 	if uu.Password != nil {
 		hash, err := bcrypt.GenerateFromPassword([]byte(*uu.Password), bcrypt.DefaultCost)
@@ -159,57 +215,146 @@ func (r *Postgre) Update(ctx context.Context, id string, uu entity.UpdateUser) e
 		"last_name" = :last_name, 
 		"password" = :password,
 		"email" = :email,
+		"email_verified" = :email_verified,
 		"roles" = :roles,
+		"version" = "version" + 1,
 		"date_updated" = :date_updated 
 	WHERE 
-		user_id = :user_id`
+		user_id = :user_id AND "version" = :version`
 
-	_, err = r.db.NamedExecContext(ctx, q, u)
-	if err != nil {
+	if err := database.NamedExecVersion(ctx, r.db, q, u); err != nil {
 		return errors.Wrapf(err, "error updating a user with id %s", id)
 	}
 
 	return nil
 }
 
-// Delete deletes user from PostgreSQL by given user id.
-func (r *Postgre) Delete(ctx context.Context, userID string) error {
+// Delete marks user in PostgreSQL as deleted by given user id,
+// it is kept until Purge removes it, so it can be restored meanwhile.
+// Non zero version is a version of a user a client knows about,
+// if a user has a different one database.ErrVersionConflict is returned.
+func (r *Postgre) Delete(ctx context.Context, userID string, version int) error {
+	u, err := r.QueryByID(ctx, userID)
+	if err != nil {
+		return errors.Wrapf(err, "deleting a user with id %s", userID)
+	}
+	if version != 0 && u.Version != version {
+		return errors.Wrapf(database.ErrVersionConflict, "deleting a user with id %s", userID)
+	}
+
 	const q = `
-	DELETE FROM 
+	UPDATE 
 		users 
+	SET
+		"deleted_at" = :deleted_at,
+		"version" = "version" + 1
 	WHERE
-		user_id = :user_id`
+		user_id = :user_id AND "version" = :version`
 
 	data := struct {
-		ID string `db:"user_id"`
+		ID        string    `db:"user_id"`
+		Version   int       `db:"version"`
+		DeletedAt time.Time `db:"deleted_at"`
 	}{
-		ID: userID,
+		ID:        userID,
+		Version:   u.Version,
+		DeletedAt: time.Now().UTC(),
 	}
 
-	if _, err := r.db.NamedExecContext(ctx, q, data); err != nil {
+	if err := database.NamedExecVersion(ctx, r.db, q, data); err != nil {
 		return errors.Wrapf(err, "deleting a user with id %s", userID)
 	}
 
 	return nil
 }
 
-// DeleteByUserName deletes user from PostgreSQL by given user name.
+// DeleteByUserName marks user in PostgreSQL as deleted by given user name.
 func (r *Postgre) DeleteByUserName(ctx context.Context, userName string) error {
 	const q = `
-	DELETE FROM 
+	UPDATE 
 		users 
+	SET
+		"deleted_at" = :deleted_at,
+		"version" = "version" + 1
 	WHERE 
-		user_name = :user_name`
+		user_name = :user_name AND deleted_at IS NULL`
 
 	data := struct {
-		ID string `db:"user_name"`
+		ID        string    `db:"user_name"`
+		DeletedAt time.Time `db:"deleted_at"`
 	}{
-		ID: userName,
+		ID:        userName,
+		DeletedAt: time.Now().UTC(),
 	}
 
-	if _, err := r.db.NamedExecContext(ctx, q, data); err != nil {
+	if _, err := database.NamedExec(ctx, r.db, q, data); err != nil {
 		return errors.Wrapf(err, "deleting a user with user_name %s", userName)
 	}
 
 	return nil
 }
+
+// Restore restores a deleted user inside PostgreSQL by given user id.
+func (r *Postgre) Restore(ctx context.Context, userID string) error {
+	const q = `
+	UPDATE 
+		users 
+	SET
+		"deleted_at" = NULL,
+		"version" = "version" + 1,
+		"date_updated" = :date_updated
+	WHERE 
+		user_id = :user_id AND deleted_at IS NOT NULL`
+
+	data := struct {
+		ID          string    `db:"user_id"`
+		DateUpdated time.Time `db:"date_updated"`
+	}{
+		ID:          userID,
+		DateUpdated: time.Now().UTC(),
+	}
+
+	res, err := database.NamedExec(ctx, r.db, q, data)
+	if err != nil {
+		return errors.Wrapf(err, "restoring a user with id %s", userID)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "restoring a user with id %s", userID)
+	}
+	if n == 0 {
+		return errors.Wrapf(database.ErrNotFound, "deleted user %s", userID)
+	}
+
+	return nil
+}
+
+// Purge permanently removes users from PostgreSQL that were deleted before given time.
+// Users that still have orders are kept, since removal of them would remove those orders too.
+func (r *Postgre) Purge(ctx context.Context, before time.Time) (int64, error) {
+	const q = `
+	DELETE FROM 
+		users u
+	WHERE 
+		u.deleted_at < :before
+		AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.user_id)`
+
+	data := struct {
+		Before time.Time `db:"before"`
+	}{
+		Before: before,
+	}
+
+	res, err := database.NamedExec(ctx, r.db, q, data)
+	if err != nil {
+		return 0, errors.Wrap(err, "purging deleted users")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "purging deleted users")
+	}
+
+	return n, nil
+}
@@ -2,17 +2,12 @@ package user
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 	"testing"
 
-	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
-	"github.com/ory/dockertest/v3"
-	"github.com/ory/dockertest/v3/docker"
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/query"
 	"github.com/rtbe/clean-rest-api/internal/tests"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -21,59 +16,19 @@ var pgUserRepo *Postgre
 var validUser entity.User
 
 func TestMain(m *testing.M) {
-	pool, err := dockertest.NewPool("")
+	db, purge, err := tests.NewPostgreSQL()
 	if err != nil {
-		log.Fatalf("could not connect to docker: %s", err)
+		log.Fatalf("could not start PostgreSQL: %s", err)
 	}
 
-	absFilepath, _ := filepath.Abs("../../internal/tests")
-	opts := dockertest.RunOptions{
-		Repository: "postgres",
-		Tag:        "12.3",
-		Env: []string{
-			"POSTGRES_USER=" + tests.PgUser,
-			"POSTGRES_PASSWORD=" + tests.PgPassword,
-			"POSTGRES_DB=" + tests.PgDB,
-		},
-		ExposedPorts: []string{"5432"},
-		PortBindings: map[docker.Port][]docker.PortBinding{
-			"5432": {
-				{HostIP: "0.0.0.0", HostPort: tests.PgPort},
-			},
-		},
-		Mounts: []string{absFilepath + ":/docker-entrypoint-initdb.d/"},
-	}
-
-	resource, err := pool.RunWithOptions(&opts)
-	if err != nil {
-		log.Fatalf("could not start resource: %s", err)
-	}
-
-	if err = pool.Retry(func() error {
-		db, err := sqlx.Connect("postgres", fmt.Sprintf(
-			"postgres://%s:%s@localhost:%s/%s?sslmode=disable",
-			tests.PgUser,
-			tests.PgPassword,
-			resource.GetPort("5432/tcp"),
-			tests.PgDB,
-		))
-		if err != nil {
-			return err
-		}
-
-		// Init global package dependencies after
-		// successfull connection to a database
-		pgUserRepo = NewPostgreRepo(db, nil)
-
-		return db.Ping()
-	}); err != nil {
-		log.Fatalf("could not connect to docker: %s", err)
-	}
+	// Init global package dependencies after
+	// successfull connection to a database
+	pgUserRepo = NewPostgreRepo(db, nil)
 
 	code := m.Run()
 
 	// When you're done, kill and remove the container
-	if err = pool.Purge(resource); err != nil {
+	if err = purge(); err != nil {
 		log.Fatalf("could not purge resource: %s", err)
 	}
 
@@ -182,27 +137,61 @@ func TestPostgre(t *testing.T) {
 		}
 	})
 
+	t.Run("Given the need to get a user by his email from PostgreSQL", func(t *testing.T) {
+		tt := []struct {
+			testName string
+			email    string
+			valid    bool
+		}{
+			{testName: "User with existing email", email: validUser.Email, valid: true},
+			{testName: "User with unknown email", email: "unknown@example.com", valid: false},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				retrievedUser, err := pgUserRepo.QueryByEmail(context.Background(), tc.email)
+				if err != nil && tc.valid {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to get a user by his email. Error: %s", tests.Failed, testID, err)
+				}
+				if err == nil && !tc.valid {
+					t.Fatalf("\t%s\tTest %d:\tShould not be able to get a user by unknown email.", tests.Failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to get a user by his email.", tests.Success, testID)
+
+				if tc.valid && retrievedUser.ID != validUser.ID {
+					t.Fatalf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Failed, testID, validUser.ID, retrievedUser.ID)
+				}
+			})
+		}
+	})
+
 	t.Run("Given the need to query users from PostgreSQL", func(t *testing.T) {
 		tt := []struct {
-			testName   string
-			lastSeenID string
-			limit      string
+			testName string
+			q        query.Query
+			wantID   string
 		}{
-			{testName: "list existing user", lastSeenID: validUser.ID, limit: "1"},
+			{
+				testName: "list existing user",
+				q: query.Query{
+					Filters: []query.Filter{{Field: "user_id", Op: query.Eq, Value: validUser.ID}},
+					Limit:   1,
+				},
+				wantID: validUser.ID,
+			},
 		}
 		for testID, tc := range tt {
 			t.Run(tc.testName, func(t *testing.T) {
-				users, err := pgUserRepo.Query(context.Background(), tc.lastSeenID, tc.limit)
+				users, _, err := pgUserRepo.Query(context.Background(), tc.q)
 				if err != nil {
 					t.Fatalf("\t%s\tTest %d:\tShould be able to get a list of users. Error: %s", tests.Failed, testID, err)
 				}
 				t.Logf("\t%s\tTest %d:\tShould be able to get a list of users.", tests.Success, testID)
 
 				for _, user := range users {
-					if tc.lastSeenID != user.ID {
-						t.Fatalf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Failed, testID, tc.lastSeenID, user.ID)
+					if tc.wantID != user.ID {
+						t.Fatalf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Failed, testID, tc.wantID, user.ID)
 					}
-					t.Logf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Success, testID, tc.lastSeenID, user.ID)
+					t.Logf("\t%s\tTest %d:\tWant id: %s, got: %s", tests.Success, testID, tc.wantID, user.ID)
 				}
 			})
 		}
@@ -231,7 +220,7 @@ func TestPostgre(t *testing.T) {
 			t.Run(tc.testName, func(t *testing.T) {
 				ctx := context.Background()
 
-				err := pgUserRepo.Update(ctx, tc.id, tc.updateUser)
+				err := pgUserRepo.Update(ctx, tc.id, 0, tc.updateUser)
 				if err != nil {
 					t.Fatalf("\t%s\tTest %d:\tShould be able to update a user. Error: %s", tests.Failed, testID, err)
 				}
@@ -273,6 +262,11 @@ func TestPostgre(t *testing.T) {
 				}
 				t.Logf("\t%s\tTest %d:\tWant email : %s, got: %s", tests.Success, testID, *tc.updateUser.Email, retrievedUser.Email)
 
+				if retrievedUser.EmailVerified {
+					t.Fatalf("\t%s\tTest %d:\tWant email verification to be reset on email change", tests.Failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tWant email verification to be reset on email change", tests.Success, testID)
+
 				for i, role := range tc.updateUser.Roles {
 					if role != retrievedUser.Roles[i] {
 						t.Fatalf("\t%s\tTest %d:\tWant role: %s, got: %s", tests.Failed, testID, role, tc.updateUser.Roles[i])
@@ -311,7 +305,7 @@ func TestPostgre(t *testing.T) {
 				}
 				t.Logf("\t%s\tTest %d:\tShould be able to create a user.", tests.Success, testID)
 
-				if err := pgUserRepo.Delete(ctx, savedUser.ID); err != nil {
+				if err := pgUserRepo.Delete(ctx, savedUser.ID, savedUser.Version); err != nil {
 					t.Fatalf("\t%s\tTest %d:\tShould be able to delete a user by his id. Error: %s", tests.Failed, testID, err)
 				}
 				t.Logf("\t%s\tTest %d:\tShould be able to delete a user by his id.", tests.Success, testID)
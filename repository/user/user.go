@@ -4,8 +4,10 @@ package user
 
 import (
 	"context"
+	"time"
 
 	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/query"
 )
 
 // Repository is an interface that represents persistent storage abstraction.
@@ -13,9 +15,13 @@ import (
 // so concrete implementation of database should implements the set of these methods.
 type Repository interface {
 	Create(ctx context.Context, newUser entity.NewUser) (entity.User, error)
-	Query(ctx context.Context, lastSeenUserID, limit string) ([]entity.User, error)
+	Query(ctx context.Context, q query.Query) ([]entity.User, query.Page, error)
 	QueryByID(ctx context.Context, id string) (entity.User, error)
-	Update(ctx context.Context, userID string, user entity.UpdateUser) error
-	Delete(ctx context.Context, id string) error
+	QueryByUserName(ctx context.Context, userName string) (entity.User, error)
+	QueryByEmail(ctx context.Context, email string) (entity.User, error)
+	Update(ctx context.Context, userID string, version int, user entity.UpdateUser) error
+	Delete(ctx context.Context, id string, version int) error
 	DeleteByUserName(ctx context.Context, userName string) error
+	Restore(ctx context.Context, id string) error
+	Purge(ctx context.Context, before time.Time) (int64, error)
 }
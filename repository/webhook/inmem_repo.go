@@ -0,0 +1,296 @@
+package webhook
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/query"
+	"github.com/rtbe/clean-rest-api/repository/transaction"
+)
+
+// InMemRepo is an abstraction layer that manages webhook subscriptions and deliveries inside basic in-memory store (map+RWMutex).
+// It suits a single instance of an application, subscriptions and deliveries are lost on restart.
+type InMemRepo struct {
+	subscriptions map[string]entity.WebhookSubscription
+	deliveries    map[string]entity.WebhookDelivery
+	sync.RWMutex
+}
+
+// NewInMemRepo creates a new in-memory repository for WebhookSubscription and WebhookDelivery entities.
+func NewInMemRepo() *InMemRepo {
+	return &InMemRepo{
+		subscriptions: make(map[string]entity.WebhookSubscription),
+		deliveries:    make(map[string]entity.WebhookDelivery),
+	}
+}
+
+// CreateSubscription saves a new webhook subscription in in-memory store.
+func (r *InMemRepo) CreateSubscription(ctx context.Context, s entity.WebhookSubscription) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.subscriptions[s.ID]; ok {
+		return errors.Wrap(database.ErrDuplicate, "inserting a webhook subscription")
+	}
+	r.putSubscription(ctx, s.ID, s)
+
+	return nil
+}
+
+// QuerySubscriptions gets a page of webhook subscriptions from in-memory store defined by list query.
+// By default results are sorted by creation date, newest first.
+func (r *InMemRepo) QuerySubscriptions(ctx context.Context, q query.Query) ([]entity.WebhookSubscription, query.Page, error) {
+	r.RLock()
+	all := make([]entity.WebhookSubscription, 0, len(r.subscriptions))
+	for _, s := range r.subscriptions {
+		all = append(all, s)
+	}
+	r.RUnlock()
+
+	subscriptions := []entity.WebhookSubscription{}
+
+	page, err := database.SlicePage(all, subscriptionFields, "subscription_id", q, &subscriptions)
+	if err != nil {
+		return nil, query.Page{}, errors.Wrap(err, "selecting webhook subscriptions")
+	}
+
+	return subscriptions, page, nil
+}
+
+// QuerySubscriptionByID gets a webhook subscription from in-memory store by it`s id.
+func (r *InMemRepo) QuerySubscriptionByID(ctx context.Context, id string) (entity.WebhookSubscription, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	s, ok := r.subscriptions[id]
+	if !ok {
+		return entity.WebhookSubscription{}, errors.Wrapf(database.ErrNotFound, "webhook subscription %s", id)
+	}
+
+	return s, nil
+}
+
+// QuerySubscriptionsByEventType gets all webhook subscriptions to events of given type from in-memory store.
+func (r *InMemRepo) QuerySubscriptionsByEventType(ctx context.Context, eventType entity.EventType) ([]entity.WebhookSubscription, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	subscriptions := []entity.WebhookSubscription{}
+	for _, s := range r.subscriptions {
+		if s.Subscribed(eventType) {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].DateCreated.Before(subscriptions[j].DateCreated)
+	})
+
+	return subscriptions, nil
+}
+
+// UpdateSubscription changes a webhook subscription in in-memory store.
+func (r *InMemRepo) UpdateSubscription(ctx context.Context, id string, u entity.UpdateWebhookSubscription) error {
+	r.Lock()
+	defer r.Unlock()
+
+	s, ok := r.subscriptions[id]
+	if !ok {
+		return errors.Wrapf(database.ErrNotFound, "updating a webhook subscription with id %s", id)
+	}
+
+	if u.URL != nil {
+		s.URL = *u.URL
+	}
+	if u.Secret != nil {
+		s.Secret = *u.Secret
+	}
+	if u.EventTypes != nil {
+		s.EventTypes = u.EventTypes
+	}
+	s.DateUpdated = time.Now().UTC()
+	r.putSubscription(ctx, id, s)
+
+	return nil
+}
+
+// DeleteSubscription deletes a webhook subscription along with it`s deliveries from in-memory store.
+func (r *InMemRepo) DeleteSubscription(ctx context.Context, id string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.subscriptions[id]; !ok {
+		return errors.Wrapf(database.ErrNotFound, "webhook subscription %s", id)
+	}
+	r.removeSubscription(ctx, id)
+
+	for deliveryID, d := range r.deliveries {
+		if d.SubscriptionID == id {
+			r.removeDelivery(ctx, deliveryID)
+		}
+	}
+
+	return nil
+}
+
+// CreateDelivery saves a new webhook delivery in in-memory store unless the same event is already delivered to a subscription.
+func (r *InMemRepo) CreateDelivery(ctx context.Context, d entity.WebhookDelivery) error {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, existing := range r.deliveries {
+		if existing.SubscriptionID == d.SubscriptionID && existing.EventID == d.EventID {
+			return nil
+		}
+	}
+	r.putDelivery(ctx, d.ID, d)
+
+	return nil
+}
+
+// QueryDeliveries gets a page of deliveries of a webhook subscription from in-memory store defined by list query.
+// By default results are sorted by creation date, newest first.
+func (r *InMemRepo) QueryDeliveries(ctx context.Context, subscriptionID string, q query.Query) ([]entity.WebhookDelivery, query.Page, error) {
+	r.RLock()
+	all := []entity.WebhookDelivery{}
+	for _, d := range r.deliveries {
+		if d.SubscriptionID == subscriptionID {
+			all = append(all, d)
+		}
+	}
+	r.RUnlock()
+
+	deliveries := []entity.WebhookDelivery{}
+
+	page, err := database.SlicePage(all, deliveryFields, "delivery_id", q, &deliveries)
+	if err != nil {
+		return nil, query.Page{}, errors.Wrapf(err, "selecting deliveries of webhook subscription %s", subscriptionID)
+	}
+
+	return deliveries, page, nil
+}
+
+// QueryDeliveryByID gets a delivery of a webhook subscription from in-memory store by it`s id.
+func (r *InMemRepo) QueryDeliveryByID(ctx context.Context, subscriptionID, id string) (entity.WebhookDelivery, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	d, ok := r.deliveries[id]
+	if !ok || d.SubscriptionID != subscriptionID {
+		return entity.WebhookDelivery{}, errors.Wrapf(database.ErrNotFound, "webhook delivery %s", id)
+	}
+
+	return d, nil
+}
+
+// QueryDueDeliveries gets pending webhook deliveries which next attempt is due from in-memory store, oldest first.
+func (r *InMemRepo) QueryDueDeliveries(ctx context.Context, now time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	deliveries := []entity.WebhookDelivery{}
+	for _, d := range r.deliveries {
+		if d.Status == entity.DeliveryStatusPending && !d.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].NextAttemptAt.Equal(deliveries[j].NextAttemptAt) {
+			return deliveries[i].NextAttemptAt.Before(deliveries[j].NextAttemptAt)
+		}
+		return deliveries[i].DateCreated.Before(deliveries[j].DateCreated)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+// UpdateDelivery saves an outcome of an attempt of a webhook delivery in in-memory store.
+func (r *InMemRepo) UpdateDelivery(ctx context.Context, d entity.WebhookDelivery) error {
+	r.Lock()
+	defer r.Unlock()
+
+	existing, ok := r.deliveries[d.ID]
+	if !ok {
+		return errors.Wrapf(database.ErrNotFound, "webhook delivery %s", d.ID)
+	}
+
+	existing.Status = d.Status
+	existing.Attempts = d.Attempts
+	existing.ResponseStatus = d.ResponseStatus
+	existing.LastError = d.LastError
+	existing.NextAttemptAt = d.NextAttemptAt
+	existing.DeliveredAt = d.DeliveredAt
+	existing.DateUpdated = time.Now().UTC()
+	r.putDelivery(ctx, d.ID, existing)
+
+	return nil
+}
+
+// putSubscription stores a webhook subscription by id within in-memory store,
+// if a transaction carried by ctx fails a previous state of it is restored.
+// It must be called with the lock held.
+func (r *InMemRepo) putSubscription(ctx context.Context, id string, v entity.WebhookSubscription) {
+	r.journalSubscription(ctx, id)
+	r.subscriptions[id] = v
+}
+
+// removeSubscription removes a webhook subscription by id from in-memory store,
+// if a transaction carried by ctx fails it is restored.
+// It must be called with the lock held.
+func (r *InMemRepo) removeSubscription(ctx context.Context, id string) {
+	r.journalSubscription(ctx, id)
+	delete(r.subscriptions, id)
+}
+
+// journalSubscription registers restoration of current state of a webhook subscription by id if a transaction carried by ctx fails.
+func (r *InMemRepo) journalSubscription(ctx context.Context, id string) {
+	prev, existed := r.subscriptions[id]
+	transaction.OnRollback(ctx, func() {
+		r.Lock()
+		defer r.Unlock()
+
+		if existed {
+			r.subscriptions[id] = prev
+			return
+		}
+		delete(r.subscriptions, id)
+	})
+}
+
+// putDelivery stores a webhook delivery by id within in-memory store,
+// if a transaction carried by ctx fails a previous state of it is restored.
+// It must be called with the lock held.
+func (r *InMemRepo) putDelivery(ctx context.Context, id string, v entity.WebhookDelivery) {
+	r.journalDelivery(ctx, id)
+	r.deliveries[id] = v
+}
+
+// removeDelivery removes a webhook delivery by id from in-memory store,
+// if a transaction carried by ctx fails it is restored.
+// It must be called with the lock held.
+func (r *InMemRepo) removeDelivery(ctx context.Context, id string) {
+	r.journalDelivery(ctx, id)
+	delete(r.deliveries, id)
+}
+
+// journalDelivery registers restoration of current state of a webhook delivery by id if a transaction carried by ctx fails.
+func (r *InMemRepo) journalDelivery(ctx context.Context, id string) {
+	prev, existed := r.deliveries[id]
+	transaction.OnRollback(ctx, func() {
+		r.Lock()
+		defer r.Unlock()
+
+		if existed {
+			r.deliveries[id] = prev
+			return
+		}
+		delete(r.deliveries, id)
+	})
+}
@@ -0,0 +1,318 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/logger"
+	"github.com/rtbe/clean-rest-api/internal/query"
+)
+
+// Postgre is an abstraction layer that manages webhook subscriptions and deliveries inside PostgreSQL DB.
+type Postgre struct {
+	db  *sqlx.DB
+	log logger.Logger
+}
+
+// NewPostgreRepo creates a new PostgreSQL repository for WebhookSubscription and WebhookDelivery entities.
+func NewPostgreRepo(db *sqlx.DB, l logger.Logger) *Postgre {
+	return &Postgre{
+		db:  db,
+		log: l,
+	}
+}
+
+// CreateSubscription saves a new webhook subscription in PostgreSQL.
+func (r *Postgre) CreateSubscription(ctx context.Context, s entity.WebhookSubscription) error {
+	const q = `
+	INSERT INTO webhook_subscriptions
+		(subscription_id, url, secret, event_types, date_created, date_updated)
+	VALUES
+		(:subscription_id, :url, :secret, :event_types, :date_created, :date_updated)`
+
+	if _, err := database.NamedExec(ctx, r.db, q, s); err != nil {
+		return errors.Wrap(err, "inserting a webhook subscription")
+	}
+
+	return nil
+}
+
+// subscriptionFields is a whitelist of webhook subscriptions fields that can be used in list queries.
+var subscriptionFields = query.Fields{
+	"subscription_id": {Column: "subscription_id", Type: query.UUID},
+	"url":             {Column: "url", Type: query.String},
+	"date_created":    {Column: "date_created", Type: query.Time},
+	"date_updated":    {Column: "date_updated", Type: query.Time},
+}
+
+// QuerySubscriptions gets a page of webhook subscriptions from PostgreSQL DB defined by list query.
+// By default results are sorted by creation date, newest first.
+func (r *Postgre) QuerySubscriptions(ctx context.Context, q query.Query) ([]entity.WebhookSubscription, query.Page, error) {
+	subscriptions := []entity.WebhookSubscription{}
+
+	page, err := database.QueryPage(ctx, r.db, "webhook_subscriptions", subscriptionFields, "subscription_id", q, &subscriptions)
+	if err != nil {
+		return nil, query.Page{}, errors.Wrap(err, "selecting webhook subscriptions")
+	}
+
+	return subscriptions, page, nil
+}
+
+// QuerySubscriptionByID gets a webhook subscription from PostgreSQL by it`s id.
+func (r *Postgre) QuerySubscriptionByID(ctx context.Context, id string) (entity.WebhookSubscription, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		webhook_subscriptions
+	WHERE
+		subscription_id = :subscription_id`
+
+	data := struct {
+		ID string `db:"subscription_id"`
+	}{
+		ID: id,
+	}
+
+	var s entity.WebhookSubscription
+	if err := database.QueryStruct(ctx, r.db, q, data, &s); err != nil {
+		return entity.WebhookSubscription{}, errors.Wrapf(err, "webhook subscription %s", id)
+	}
+
+	return s, nil
+}
+
+// QuerySubscriptionsByEventType gets all webhook subscriptions to events of given type from PostgreSQL.
+func (r *Postgre) QuerySubscriptionsByEventType(ctx context.Context, eventType entity.EventType) ([]entity.WebhookSubscription, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		webhook_subscriptions
+	WHERE
+		:event_type = ANY(event_types)
+	ORDER BY
+		date_created`
+
+	data := struct {
+		EventType entity.EventType `db:"event_type"`
+	}{
+		EventType: eventType,
+	}
+
+	subscriptions := []entity.WebhookSubscription{}
+
+	if err := database.QuerySlice(ctx, r.db, q, data, &subscriptions); err != nil {
+		return nil, errors.Wrapf(err, "selecting webhook subscriptions to %s", eventType)
+	}
+
+	return subscriptions, nil
+}
+
+// UpdateSubscription changes a webhook subscription in PostgreSQL.
+func (r *Postgre) UpdateSubscription(ctx context.Context, id string, u entity.UpdateWebhookSubscription) error {
+	s, err := r.QuerySubscriptionByID(ctx, id)
+	if err != nil {
+		return errors.Wrapf(err, "updating a webhook subscription with id %s", id)
+	}
+
+	const q = `
+	UPDATE
+		webhook_subscriptions
+	SET
+		url = :url,
+		secret = :secret,
+		event_types = :event_types,
+		date_updated = :date_updated
+	WHERE
+		subscription_id = :subscription_id`
+
+	if u.URL != nil {
+		s.URL = *u.URL
+	}
+	if u.Secret != nil {
+		s.Secret = *u.Secret
+	}
+	if u.EventTypes != nil {
+		s.EventTypes = u.EventTypes
+	}
+	s.DateUpdated = time.Now().UTC()
+
+	if _, err := database.NamedExec(ctx, r.db, q, s); err != nil {
+		return errors.Wrapf(err, "updating a webhook subscription with id %s", id)
+	}
+
+	return nil
+}
+
+// DeleteSubscription deletes a webhook subscription along with it`s deliveries from PostgreSQL.
+func (r *Postgre) DeleteSubscription(ctx context.Context, id string) error {
+	const q = `
+	DELETE FROM
+		webhook_subscriptions
+	WHERE
+		subscription_id = :subscription_id`
+
+	data := struct {
+		ID string `db:"subscription_id"`
+	}{
+		ID: id,
+	}
+
+	res, err := database.NamedExec(ctx, r.db, q, data)
+	if err != nil {
+		return errors.Wrapf(err, "deleting a webhook subscription with id %s", id)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "deleting a webhook subscription with id %s", id)
+	}
+	if n == 0 {
+		return errors.Wrapf(database.ErrNotFound, "webhook subscription %s", id)
+	}
+
+	return nil
+}
+
+// CreateDelivery saves a new webhook delivery in PostgreSQL unless the same event is already delivered to a subscription.
+func (r *Postgre) CreateDelivery(ctx context.Context, d entity.WebhookDelivery) error {
+	const q = `
+	INSERT INTO webhook_deliveries
+		(delivery_id, subscription_id, event_id, event_type, payload, status, next_attempt_at, date_created, date_updated)
+	VALUES
+		(:delivery_id, :subscription_id, :event_id, :event_type, :payload, :status, :next_attempt_at, :date_created, :date_updated)
+	ON CONFLICT
+		(subscription_id, event_id) DO NOTHING`
+
+	if _, err := database.NamedExec(ctx, r.db, q, d); err != nil {
+		return errors.Wrapf(err, "inserting a delivery of event %s", d.EventID)
+	}
+
+	return nil
+}
+
+// deliveryFields is a whitelist of webhook deliveries fields that can be used in list queries.
+var deliveryFields = query.Fields{
+	"delivery_id":     {Column: "delivery_id", Type: query.UUID},
+	"subscription_id": {Column: "subscription_id", Type: query.UUID},
+	"event_id":        {Column: "event_id", Type: query.UUID},
+	"event_type":      {Column: "event_type", Type: query.String},
+	"status":          {Column: "status", Type: query.String},
+	"attempts":        {Column: "attempts", Type: query.Int},
+	"date_created":    {Column: "date_created", Type: query.Time},
+	"date_updated":    {Column: "date_updated", Type: query.Time},
+}
+
+// QueryDeliveries gets a page of deliveries of a webhook subscription from PostgreSQL DB defined by list query.
+// By default results are sorted by creation date, newest first.
+func (r *Postgre) QueryDeliveries(ctx context.Context, subscriptionID string, q query.Query) ([]entity.WebhookDelivery, query.Page, error) {
+	deliveries := []entity.WebhookDelivery{}
+
+	q.Filters = append([]query.Filter{{Field: "subscription_id", Op: query.Eq, Value: subscriptionID}}, q.Filters...)
+
+	page, err := database.QueryPage(ctx, r.db, "webhook_deliveries", deliveryFields, "delivery_id", q, &deliveries)
+	if err != nil {
+		return nil, query.Page{}, errors.Wrapf(err, "selecting deliveries of webhook subscription %s", subscriptionID)
+	}
+
+	return deliveries, page, nil
+}
+
+// QueryDeliveryByID gets a delivery of a webhook subscription from PostgreSQL by it`s id.
+func (r *Postgre) QueryDeliveryByID(ctx context.Context, subscriptionID, id string) (entity.WebhookDelivery, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		webhook_deliveries
+	WHERE
+		delivery_id = :delivery_id AND subscription_id = :subscription_id`
+
+	data := struct {
+		ID             string `db:"delivery_id"`
+		SubscriptionID string `db:"subscription_id"`
+	}{
+		ID:             id,
+		SubscriptionID: subscriptionID,
+	}
+
+	var d entity.WebhookDelivery
+	if err := database.QueryStruct(ctx, r.db, q, data, &d); err != nil {
+		return entity.WebhookDelivery{}, errors.Wrapf(err, "webhook delivery %s", id)
+	}
+
+	return d, nil
+}
+
+// QueryDueDeliveries gets pending webhook deliveries which next attempt is due from PostgreSQL, oldest first.
+// Deliveries are locked with FOR UPDATE SKIP LOCKED, so several workers can deliver them side by side.
+func (r *Postgre) QueryDueDeliveries(ctx context.Context, now time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		webhook_deliveries
+	WHERE
+		status = :status AND next_attempt_at <= :now
+	ORDER BY
+		next_attempt_at, date_created
+	LIMIT :limit
+	FOR UPDATE SKIP LOCKED`
+
+	data := struct {
+		Status string    `db:"status"`
+		Now    time.Time `db:"now"`
+		Limit  int       `db:"limit"`
+	}{
+		Status: entity.DeliveryStatusPending,
+		Now:    now,
+		Limit:  limit,
+	}
+
+	deliveries := []entity.WebhookDelivery{}
+
+	if err := database.QuerySlice(ctx, r.db, q, data, &deliveries); err != nil {
+		return nil, errors.Wrap(err, "selecting due webhook deliveries")
+	}
+
+	return deliveries, nil
+}
+
+// UpdateDelivery saves an outcome of an attempt of a webhook delivery in PostgreSQL.
+func (r *Postgre) UpdateDelivery(ctx context.Context, d entity.WebhookDelivery) error {
+	const q = `
+	UPDATE
+		webhook_deliveries
+	SET
+		status = :status,
+		attempts = :attempts,
+		response_status = :response_status,
+		last_error = :last_error,
+		next_attempt_at = :next_attempt_at,
+		delivered_at = :delivered_at,
+		date_updated = :date_updated
+	WHERE
+		delivery_id = :delivery_id`
+
+	d.DateUpdated = time.Now().UTC()
+
+	res, err := database.NamedExec(ctx, r.db, q, d)
+	if err != nil {
+		return errors.Wrapf(err, "updating a webhook delivery with id %s", d.ID)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "updating a webhook delivery with id %s", d.ID)
+	}
+	if n == 0 {
+		return errors.Wrapf(database.ErrNotFound, "webhook delivery %s", d.ID)
+	}
+
+	return nil
+}
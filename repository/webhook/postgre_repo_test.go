@@ -0,0 +1,150 @@
+package webhook
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/database"
+	"github.com/rtbe/clean-rest-api/internal/tests"
+)
+
+var pgWebhookRepo *Postgre
+
+func TestMain(m *testing.M) {
+	db, purge, err := tests.NewPostgreSQL()
+	if err != nil {
+		log.Fatalf("could not start PostgreSQL: %s", err)
+	}
+
+	// Init global package dependencies after successfull connection to a database
+	pgWebhookRepo = NewPostgreRepo(db, nil)
+
+	code := m.Run()
+
+	// When you're done, kill and remove the container
+	if err = purge(); err != nil {
+		log.Fatalf("could not purge resource: %s", err)
+	}
+
+	os.Exit(code)
+}
+
+func TestPostgre(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	ws := entity.WebhookSubscription{
+		ID:          uuid.NewString(),
+		URL:         "https://warehouse.example.com/webhooks",
+		Secret:      "receiver secret key",
+		EventTypes:  []string{string(entity.EventOrderCreated)},
+		DateCreated: now,
+		DateUpdated: now,
+	}
+	if err := pgWebhookRepo.CreateSubscription(ctx, ws); err != nil {
+		t.Fatalf("\t%s\tShould be able to create a subscription. Error: %s", tests.Failed, err)
+	}
+
+	t.Run("Given the need to find subscriptions to an event type", func(t *testing.T) {
+		tt := []struct {
+			testName  string
+			eventType entity.EventType
+			want      int
+		}{
+			{testName: "Subscribed event type", eventType: entity.EventOrderCreated, want: 1},
+			{testName: "Not subscribed event type", eventType: entity.EventUserRegistered, want: 0},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				subscriptions, err := pgWebhookRepo.QuerySubscriptionsByEventType(ctx, tc.eventType)
+				if err != nil || len(subscriptions) != tc.want {
+					t.Fatalf("\t%s\tTest %d:\tWant %d subscriptions, got: %d (%v)", tests.Failed, testID, tc.want, len(subscriptions), err)
+				}
+				t.Logf("\t%s\tTest %d:\tWant %d subscriptions.", tests.Success, testID, tc.want)
+			})
+		}
+	})
+
+	t.Run("Given the need to deliver an event once", func(t *testing.T) {
+		d := entity.WebhookDelivery{
+			ID:             uuid.NewString(),
+			SubscriptionID: ws.ID,
+			EventID:        uuid.NewString(),
+			EventType:      entity.EventOrderCreated,
+			Payload:        []byte(`{"order_id":"1"}`),
+			Status:         entity.DeliveryStatusPending,
+			NextAttemptAt:  now,
+			DateCreated:    now,
+			DateUpdated:    now,
+		}
+		repeated := d
+		repeated.ID = uuid.NewString()
+
+		for _, delivery := range []entity.WebhookDelivery{d, repeated} {
+			if err := pgWebhookRepo.CreateDelivery(ctx, delivery); err != nil {
+				t.Fatalf("\t%s\tShould be able to create a delivery. Error: %s", tests.Failed, err)
+			}
+		}
+
+		tt := []struct {
+			testName string
+			action   func() error
+			want     int
+		}{
+			{
+				testName: "Repeated event is delivered once",
+				action:   func() error { return nil },
+				want:     1,
+			},
+			{
+				testName: "Delivery is not due until it`s next attempt",
+				action: func() error {
+					d.Attempts = 1
+					d.NextAttemptAt = now.Add(time.Hour)
+					return pgWebhookRepo.UpdateDelivery(ctx, d)
+				},
+				want: 0,
+			},
+			{
+				testName: "Dead delivery is not due",
+				action: func() error {
+					d.Status = entity.DeliveryStatusDead
+					d.NextAttemptAt = now
+					return pgWebhookRepo.UpdateDelivery(ctx, d)
+				},
+				want: 0,
+			},
+		}
+		for testID, tc := range tt {
+			t.Run(tc.testName, func(t *testing.T) {
+				if err := tc.action(); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to change a delivery. Error: %s", tests.Failed, testID, err)
+				}
+
+				deliveries, err := pgWebhookRepo.QueryDueDeliveries(ctx, time.Now().UTC(), 10)
+				if err != nil || len(deliveries) != tc.want {
+					t.Fatalf("\t%s\tTest %d:\tWant %d due deliveries, got: %d (%v)", tests.Failed, testID, tc.want, len(deliveries), err)
+				}
+				t.Logf("\t%s\tTest %d:\tWant %d due deliveries.", tests.Success, testID, tc.want)
+			})
+		}
+	})
+
+	t.Run("Given the need to unsubscribe a receiver", func(t *testing.T) {
+		if err := pgWebhookRepo.DeleteSubscription(ctx, ws.ID); err != nil {
+			t.Fatalf("\t%s\tShould be able to delete a subscription. Error: %s", tests.Failed, err)
+		}
+		t.Logf("\t%s\tShould be able to delete a subscription.", tests.Success)
+
+		if err := pgWebhookRepo.DeleteSubscription(ctx, ws.ID); errors.Cause(err) != database.ErrNotFound {
+			t.Fatalf("\t%s\tWant not found error for deleted subscription, got: %v", tests.Failed, err)
+		}
+		t.Logf("\t%s\tWant not found error for deleted subscription.", tests.Success)
+	})
+}
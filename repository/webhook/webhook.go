@@ -0,0 +1,34 @@
+// Package webhook is responsible for managing webhook subscriptions and deliveries of domain events to them
+// in database-agnostic way.
+// This package defines repository interface for abstracting interaction with particular database.
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/rtbe/clean-rest-api/domain/entity"
+	"github.com/rtbe/clean-rest-api/internal/query"
+)
+
+// Repository is an interface that represents persistent storage abstraction.
+// This is a port in hexagonal architecture terms,
+// so concrete implementation of database should implements the set of these methods.
+//
+// CreateDelivery ignores repeated deliveries of the same event to the same subscription,
+// so events published more than once are delivered once.
+// QueryDueDeliveries locks returned deliveries until a transaction carried by the given context ends.
+type Repository interface {
+	CreateSubscription(ctx context.Context, s entity.WebhookSubscription) error
+	QuerySubscriptions(ctx context.Context, q query.Query) ([]entity.WebhookSubscription, query.Page, error)
+	QuerySubscriptionByID(ctx context.Context, id string) (entity.WebhookSubscription, error)
+	QuerySubscriptionsByEventType(ctx context.Context, eventType entity.EventType) ([]entity.WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, id string, u entity.UpdateWebhookSubscription) error
+	DeleteSubscription(ctx context.Context, id string) error
+
+	CreateDelivery(ctx context.Context, d entity.WebhookDelivery) error
+	QueryDeliveries(ctx context.Context, subscriptionID string, q query.Query) ([]entity.WebhookDelivery, query.Page, error)
+	QueryDeliveryByID(ctx context.Context, subscriptionID, id string) (entity.WebhookDelivery, error)
+	QueryDueDeliveries(ctx context.Context, now time.Time, limit int) ([]entity.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, d entity.WebhookDelivery) error
+}